@@ -68,7 +68,11 @@ func (ctx *context) ProcessChange(change string) {
 }
 
 func handleAAModify(ctxArg interface{}, key string, configArg interface{}) {
-	config := cast.CastAssignableAdapters(configArg)
+	config, err := cast.CastAssignableAdapters(configArg)
+	if err != nil {
+		log.Errorf("handleAAModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*context)
 	// Only care about my model
 	if key != ctx.model {
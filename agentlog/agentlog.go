@@ -50,6 +50,7 @@ func initImpl(agentName string, logdir string, redirect bool,
 		}
 		log.SetReportCaller(true)
 		log.RegisterExitHandler(printStack)
+		initObjectEvents(agentName, logdir)
 
 		sigs := make(chan os.Signal, 1)
 		signal.Notify(sigs, syscall.SIGUSR1)
@@ -285,12 +286,27 @@ func GetOtherLogdir() string {
 	return fmt.Sprintf("%s/log", dirname)
 }
 
+// StillRunningFilename is the file touched by StillRunning
+func StillRunningFilename(agentName string) string {
+	return fmt.Sprintf("/var/run/%s.touch", agentName)
+}
+
+// StillRunningAge returns the time since StillRunning was last called by
+// the agent. Used by hwwatchdog.
+func StillRunningAge(agentName string) (time.Duration, error) {
+	st, err := os.Stat(StillRunningFilename(agentName))
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(st.ModTime()), nil
+}
+
 // Touch a file per agentName to signal the event loop is still running
-// Could be use by watchdog
+// Used by watchdog(8) and hwwatchdog
 func StillRunning(agentName string) {
 
 	log.Debugf("StillRunning(%s)\n", agentName)
-	filename := fmt.Sprintf("/var/run/%s.touch", agentName)
+	filename := StillRunningFilename(agentName)
 	_, err := os.Stat(filename)
 	if err != nil {
 		file, err := os.Create(filename)
@@ -18,7 +18,11 @@ func GetGlobalConfig(sub *pubsub.Subscription) *types.GlobalConfig {
 		log.Infof("GlobalConfig failed %s\n", err)
 		return nil
 	}
-	gc := cast.CastGlobalConfig(m)
+	gc, err := cast.CastGlobalConfig(m)
+	if err != nil {
+		log.Errorf("GetGlobalConfig: %s\n", err)
+		return nil
+	}
 	return &gc
 }
 
@@ -39,7 +43,11 @@ func getLogLevelImpl(sub *pubsub.Subscription, agentName string,
 		log.Infof("GetLogLevel failed %s\n", err)
 		return "", false
 	}
-	gc := cast.CastGlobalConfig(m)
+	gc, err := cast.CastGlobalConfig(m)
+	if err != nil {
+		log.Errorf("getLogLevelImpl: %s\n", err)
+		return "", false
+	}
 	// Do we have an entry for this agent?
 	as, ok := gc.AgentSettings[agentName]
 	if ok && as.LogLevel != "" {
@@ -69,7 +77,11 @@ func getRemoteLogLevelImpl(sub *pubsub.Subscription, agentName string,
 		log.Infof("GetRemoteLogLevel failed %s\n", err)
 		return "", false
 	}
-	gc := cast.CastGlobalConfig(m)
+	gc, err := cast.CastGlobalConfig(m)
+	if err != nil {
+		log.Errorf("getRemoteLogLevelImpl: %s\n", err)
+		return "", false
+	}
 	// Do we have an entry for this agent?
 	as, ok := gc.AgentSettings[agentName]
 	if ok && as.RemoteLogLevel != "" {
@@ -179,5 +191,6 @@ func handleGlobalConfigImpl(sub *pubsub.Subscription, agentName string,
 		}
 	}
 	log.SetLevel(level)
+	enableObjectEvents(gcp != nil && gcp.ObjectEventLog == types.TS_ENABLED)
 	return debug, gcp
 }
@@ -0,0 +1,135 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Compact audit trail of the objects an agent publishes, modifies and
+// deletes. One JSON line per event in <logdir>/objlog/<agent>.log which
+// is kept apart from the verbose log and is not sent by logmanager.
+// When the file reaches objectEventMaxSize it is rotated to .log.1,
+// replacing the previous one. Only enabled with debug.objlog since each
+// change is hashed.
+
+package agentlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/pubsub"
+)
+
+// Replaced by the tests
+var objectEventMaxSize int64 = 1024 * 1024
+
+type objectEvent struct {
+	Time    time.Time
+	Op      string
+	ObjType string
+	Key     string
+	OldHash string `json:",omitempty"`
+	NewHash string `json:",omitempty"`
+}
+
+// Set by initImpl; no events are logged until then
+var objectEvents = struct {
+	sync.Mutex
+	dirName  string
+	fileName string
+	file     *os.File
+	size     int64
+}{}
+
+func initObjectEvents(agentName string, logdir string) {
+	objectEvents.Lock()
+	objectEvents.dirName = logdir + "/objlog"
+	objectEvents.fileName = fmt.Sprintf("%s/%s.log",
+		objectEvents.dirName, agentName)
+	objectEvents.Unlock()
+}
+
+// enableObjectEvents sets or clears the pubsub hook based on the
+// ObjectEventLog in GlobalConfig
+func enableObjectEvents(enable bool) {
+	if enable {
+		pubsub.ObjectEventHook = LogObjectEvent
+	} else {
+		pubsub.ObjectEventHook = nil
+	}
+	objectEvents.Lock()
+	defer objectEvents.Unlock()
+	if !enable && objectEvents.file != nil {
+		objectEvents.file.Close()
+		objectEvents.file = nil
+	}
+}
+
+// LogObjectEvent records a change to an object. The op is e.g.
+// "publish", "modify", or "delete", and the hashes identify the old and
+// new content; empty if the object did not exist before or after.
+func LogObjectEvent(op string, objType string, key string,
+	oldHash string, newHash string) {
+
+	event := objectEvent{
+		Time:    time.Now(),
+		Op:      op,
+		ObjType: objType,
+		Key:     key,
+		OldHash: oldHash,
+		NewHash: newHash,
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("LogObjectEvent: json Marshal failed %s\n", err)
+		return
+	}
+	b = append(b, '\n')
+
+	objectEvents.Lock()
+	defer objectEvents.Unlock()
+	if objectEvents.fileName == "" {
+		return
+	}
+	if objectEvents.file != nil &&
+		objectEvents.size+int64(len(b)) > objectEventMaxSize {
+		objectEvents.file.Close()
+		objectEvents.file = nil
+		if err := os.Rename(objectEvents.fileName,
+			objectEvents.fileName+".1"); err != nil {
+			log.Errorf("LogObjectEvent: rotate failed %s\n", err)
+		}
+	}
+	if objectEvents.file == nil {
+		if err := openObjectEvents(); err != nil {
+			log.Errorf("LogObjectEvent: %s\n", err)
+			return
+		}
+	}
+	n, err := objectEvents.file.Write(b)
+	objectEvents.size += int64(n)
+	if err != nil {
+		log.Errorf("LogObjectEvent: write failed %s\n", err)
+	}
+}
+
+// Caller holds the lock
+func openObjectEvents() error {
+	if err := os.MkdirAll(objectEvents.dirName, 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(objectEvents.fileName,
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	objectEvents.file = file
+	objectEvents.size = st.Size()
+	return nil
+}
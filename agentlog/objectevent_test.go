@@ -0,0 +1,89 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package agentlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/zededa/go-provision/pubsub"
+)
+
+// Returns the events in the file
+func readObjectEvents(t *testing.T, fileName string) []objectEvent {
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Open %s failed: %s\n", fileName, err)
+	}
+	defer f.Close()
+	var events []objectEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event objectEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Errorf("Bad line %s: %s\n", scanner.Text(), err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestObjectEventRotate(t *testing.T) {
+	logdir, err := ioutil.TempDir("", "objlog")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(logdir)
+	oldMaxSize := objectEventMaxSize
+	objectEventMaxSize = 512
+	defer func() {
+		objectEventMaxSize = oldMaxSize
+		enableObjectEvents(false)
+		objectEvents.fileName = ""
+	}()
+
+	initObjectEvents("testagent", logdir)
+	fileName := logdir + "/objlog/testagent.log"
+	enableObjectEvents(true)
+	if pubsub.ObjectEventHook == nil {
+		t.Fatalf("Hook not set when enabled\n")
+	}
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8", "k9"}
+	for _, key := range keys {
+		LogObjectEvent("publish", "testagent/testType", key, "", "0123456789abcdef")
+	}
+
+	st, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Stat failed: %s\n", err)
+	}
+	if st.Size() > objectEventMaxSize {
+		t.Errorf("Size %d above %d\n", st.Size(), objectEventMaxSize)
+	}
+	rotated := readObjectEvents(t, fileName+".1")
+	current := readObjectEvents(t, fileName)
+	if len(rotated) == 0 {
+		t.Fatalf("Nothing rotated\n")
+	}
+	// The latest events are kept, in order; older rotations are dropped
+	all := append(rotated, current...)
+	last := keys[len(keys)-len(all):]
+	for i, event := range all {
+		if event.Key != last[i] || event.Op != "publish" ||
+			event.NewHash != "0123456789abcdef" {
+			t.Errorf("Event %d: got %+v expected key %s\n",
+				i, event, last[i])
+		}
+	}
+
+	// Nothing logged once disabled
+	enableObjectEvents(false)
+	if pubsub.ObjectEventHook != nil {
+		t.Errorf("Hook set when disabled\n")
+	}
+}
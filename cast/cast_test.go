@@ -0,0 +1,30 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cast
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCast(t *testing.T) {
+	// pubsub hands us the map decoded from the JSON file
+	in := map[string]interface{}{"DevName": "sda", "WearPercent": 10}
+	status, err := CastStorageHealthStatus(in)
+	if err != nil {
+		t.Fatalf("Unexpected %s", err)
+	}
+	if status.DevName != "sda" || status.WearPercent != 10 {
+		t.Errorf("Got %+v", status)
+	}
+
+	// A mismatched item names the type we got
+	_, err = CastStorageHealthStatus([]string{"sda"})
+	if err == nil || !strings.Contains(err.Error(), "[]string") {
+		t.Errorf("Expected error naming []string got %v", err)
+	}
+	if _, err := CastDomainStatus(nil); err == nil {
+		t.Errorf("Expected error for nil")
+	}
+}
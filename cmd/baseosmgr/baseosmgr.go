@@ -186,7 +186,11 @@ func handleVerifierRestarted(ctxArg interface{}, done bool) {
 // Wrappers around handleBaseOsCreate/Modify/Delete
 func handleBaseOsConfigModify(ctxArg interface{}, key string, configArg interface{}) {
 	ctx := ctxArg.(*baseOsMgrContext)
-	config := cast.CastBaseOsConfig(configArg)
+	config, err := cast.CastBaseOsConfig(configArg)
+	if err != nil {
+		log.Errorf("handleBaseOsConfigModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleBaseOsConfigModify key/UUID mismatch %s vs %s; ignored %+v\n", key, config.Key(), config)
 		return
@@ -219,7 +223,11 @@ func handleBaseOsConfigDelete(ctxArg interface{}, key string,
 func handleBaseOsCreate(ctxArg interface{}, key string,
 	configArg interface{}) {
 
-	config := cast.CastBaseOsConfig(configArg)
+	config, err := cast.CastBaseOsConfig(configArg)
+	if err != nil {
+		log.Errorf("handleBaseOsCreate: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleBaseOsCreate key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -255,8 +263,7 @@ func handleBaseOsCreate2(ctx *baseOsMgrContext, config types.BaseOsConfig,
 	if err != nil {
 		errStr := fmt.Sprintf("%v", err)
 		log.Errorln(errStr)
-		status.Error = errStr
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errStr)
 		publishBaseOsStatus(ctx, &status)
 		return
 	}
@@ -271,13 +278,21 @@ func handleBaseOsCreate2(ctx *baseOsMgrContext, config types.BaseOsConfig,
 // base os config modify event
 func handleBaseOsModify(ctxArg interface{}, key string,
 	configArg interface{}, statusArg interface{}) {
-	config := cast.CastBaseOsConfig(configArg)
+	config, err := cast.CastBaseOsConfig(configArg)
+	if err != nil {
+		log.Errorf("handleBaseOsModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleBaseOsModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
 		return
 	}
-	status := cast.CastBaseOsStatus(statusArg)
+	status, err := cast.CastBaseOsStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleBaseOsModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleBaseOsModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -294,12 +309,11 @@ func handleBaseOsModify(ctxArg interface{}, key string,
 	}
 
 	// Check total and activated counts
-	err := validateBaseOsConfig(ctx, config)
+	err = validateBaseOsConfig(ctx, config)
 	if err != nil {
 		errStr := fmt.Sprintf("%v", err)
 		log.Errorln(errStr)
-		status.Error = errStr
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errStr)
 		publishBaseOsStatus(ctx, &status)
 		return
 	}
@@ -330,7 +344,11 @@ func handleBaseOsDelete(ctxArg interface{}, key string,
 
 func handleCertObjConfigModify(ctxArg interface{}, key string, configArg interface{}) {
 	ctx := ctxArg.(*baseOsMgrContext)
-	config := cast.CastCertObjConfig(configArg)
+	config, err := cast.CastCertObjConfig(configArg)
+	if err != nil {
+		log.Errorf("handleCertObjConfigModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleCertObjConfigModify key/UUID mismatch %s vs %s; ignored %+v\n", key, config.Key(), config)
 		return
@@ -415,7 +433,11 @@ func handleCertObjDelete(ctx *baseOsMgrContext, key string,
 func handleDownloadStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastDownloaderStatus(statusArg)
+	status, err := cast.CastDownloaderStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDownloadStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleDownloadStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -431,7 +453,11 @@ func handleDownloadStatusModify(ctxArg interface{}, key string,
 func handleDownloadStatusDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastDownloaderStatus(statusArg)
+	status, err := cast.CastDownloaderStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDownloadStatusDelete: %s\n", err)
+		return
+	}
 	log.Infof("handleDownloadStatusDelete RefCount %d Expired %v for %s\n",
 		status.RefCount, status.Expired, key)
 	// Nothing to do
@@ -441,7 +467,11 @@ func handleDownloadStatusDelete(ctxArg interface{}, key string,
 func handleVerifierStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastVerifyImageStatus(statusArg)
+	status, err := cast.CastVerifyImageStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleVerifierStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleVerifierStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -456,7 +486,11 @@ func handleVerifierStatusModify(ctxArg interface{}, key string,
 func handleVerifierStatusDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastVerifyImageStatus(statusArg)
+	status, err := cast.CastVerifyImageStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleVerifierStatusDelete: %s\n", err)
+		return
+	}
 	log.Infof("handleVeriferStatusDelete RefCount %d Expired %v for %s\n",
 		status.RefCount, status.Expired, key)
 	// Nothing to do
@@ -467,7 +501,11 @@ func handleDatastoreConfigModify(ctxArg interface{}, key string,
 	configArg interface{}) {
 
 	ctx := ctxArg.(*baseOsMgrContext)
-	config := cast.CastDatastoreConfig(configArg)
+	config, err := cast.CastDatastoreConfig(configArg)
+	if err != nil {
+		log.Errorf("handleDatastoreConfigModify: %s\n", err)
+		return
+	}
 	checkAndRecreateBaseOs(ctx, config.UUID)
 	log.Infof("handleDatastoreConfigModify for %s\n", key)
 }
@@ -488,7 +526,11 @@ func checkAndRecreateBaseOs(ctx *baseOsMgrContext, datastore uuid.UUID) {
 	pub := ctx.pubBaseOsStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastBaseOsStatus(st)
+		status, err := cast.CastBaseOsStatus(st)
+		if err != nil {
+			log.Errorf("checkAndRecreateBaseOs: %s\n", err)
+			continue
+		}
 		if !status.MissingDatastore {
 			continue
 		}
@@ -521,8 +563,7 @@ func checkAndRecreateBaseOs(ctx *baseOsMgrContext, datastore uuid.UUID) {
 			log.Infof("checkAndRecreateBaseOs(%s) remove error %s for %s\n",
 				datastore.String(), status.Error,
 				status.BaseOsVersion)
-			status.Error = ""
-			status.ErrorTime = time.Time{}
+			status.ClearError()
 		}
 		handleBaseOsCreate2(ctx, *config, status)
 	}
@@ -600,7 +641,7 @@ func initializeSelfPublishHandles(ctx *baseOsMgrContext) {
 	pubCertObjDownloadConfig.ClearRestarted()
 	ctx.pubCertObjDownloadConfig = pubCertObjDownloadConfig
 
-	pubZbootStatus, err := pubsub.Publish(agentName, types.ZbootStatus{})
+	pubZbootStatus, err := pubsub.Publish(agentName, types.BaseOsPartitionStatus{})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -29,7 +29,11 @@ var rebootTimer *time.Timer
 func lookupBaseOsSafename(ctx *baseOsMgrContext, safename string) *types.BaseOsConfig {
 	items := ctx.subBaseOsConfig.GetAll()
 	for _, c := range items {
-		config := cast.CastBaseOsConfig(c)
+		config, err := cast.CastBaseOsConfig(c)
+		if err != nil {
+			log.Errorf("lookupBaseOsSafename: %s\n", err)
+			continue
+		}
 		for _, sc := range config.StorageConfigList {
 			safename1 := types.UrlToSafename(sc.Name,
 				sc.ImageSha256)
@@ -252,14 +256,19 @@ func doBaseOsActivate(ctx *baseOsMgrContext, uuidStr string,
 		errString := fmt.Sprintf("Wrong partition state %s for %s",
 			partStatus.PartitionState, status.PartitionLabel)
 		log.Errorln(errString)
-		status.Error = errString
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errString)
 		changed = true
 		return changed
 	}
 
 	log.Infof("doBaseOsActivate: %s activating\n", uuidStr)
-	zboot.SetOtherPartitionStateUpdating()
+	if err := zboot.MarkTesting(status.PartitionLabel); err != nil {
+		errString := fmt.Sprintf("doBaseOsActivate: %s", err)
+		log.Errorln(errString)
+		status.SetErrorNow(errString)
+		changed = true
+		return changed
+	}
 	publishZbootPartitionStatus(ctx, status.PartitionLabel)
 	baseOsSetPartitionInfoInStatus(ctx, status, status.PartitionLabel)
 	publishBaseOsStatus(ctx, status)
@@ -271,9 +280,10 @@ func doBaseOsActivate(ctx *baseOsMgrContext, uuidStr string,
 		changed = true
 		// Match the version string inside image?
 		if errString := checkInstalledVersion(ctx, *status); errString != "" {
-			status.Error = errString
-			status.ErrorTime = time.Now()
-			zboot.SetOtherPartitionStateUnused()
+			status.SetErrorNow(errString)
+			if err := zboot.Rollback(status.PartitionLabel); err != nil {
+				log.Errorf("doBaseOsActivate: %s\n", err)
+			}
 			publishZbootPartitionStatus(ctx,
 				status.PartitionLabel)
 			baseOsSetPartitionInfoInStatus(ctx, status,
@@ -323,8 +333,7 @@ func doBaseOsInstall(ctx *baseOsMgrContext, uuidStr string,
 				sc.Name, ss.Name,
 				sc.ImageSha256, ss.ImageSha256)
 			log.Errorln(errString)
-			status.Error = errString
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errString)
 			changed = true
 			return changed, proceed
 		}
@@ -367,7 +376,12 @@ func getPartitionState(ctx *baseOsMgrContext, partname string) string {
 	if partStatus != nil {
 		return partStatus.PartitionState
 	}
-	return zboot.GetPartitionState(partname)
+	state, err := zboot.GetPartitionState(partname)
+	if err != nil {
+		log.Errorf("getPartitionState: %s\n", err)
+		return ""
+	}
+	return string(state)
 }
 
 // XXX defer until Activate changes for a BaseOsConfig
@@ -401,8 +415,7 @@ func validateAndAssignPartition(ctx *baseOsMgrContext,
 		errStr := fmt.Sprintf("Attempt to reinstall failed update %s in %s: refused",
 			config.BaseOsVersion, otherPartName)
 		log.Errorln(errStr)
-		status.Error = errStr
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errStr)
 		changed = true
 		return changed, proceed
 	}
@@ -419,8 +432,7 @@ func validateAndAssignPartition(ctx *baseOsMgrContext,
 			log.Infoln(errStr)
 		} else {
 			log.Errorln(errStr)
-			status.Error = errStr
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errStr)
 		}
 		changed = true
 		return changed, proceed
@@ -457,8 +469,7 @@ func checkBaseOsStorageDownloadStatus(ctx *baseOsMgrContext, uuidStr string,
 	status.MissingDatastore = ret.MissingDatastore
 
 	if ret.AllErrors != "" {
-		status.Error = ret.AllErrors
-		status.ErrorTime = ret.ErrorTime
+		status.SetError(ret.AllErrors, ret.ErrorTime)
 		log.Errorf("checkBaseOsStorageDownloadStatus(%s) for %s, Download error at %v: %v\n",
 			config.BaseOsVersion, uuidStr, status.ErrorTime, status.Error)
 		return ret.Changed, false
@@ -490,8 +501,7 @@ func checkBaseOsVerificationStatus(ctx *baseOsMgrContext, uuidStr string,
 	status.State = ret.MinState
 
 	if ret.AllErrors != "" {
-		status.Error = ret.AllErrors
-		status.ErrorTime = ret.ErrorTime
+		status.SetError(ret.AllErrors, ret.ErrorTime)
 		log.Errorf("checkBaseOsVerificationStatus(%s) for %s, Verification error at %v: %v\n",
 			config.BaseOsVersion, uuidStr, status.ErrorTime, status.Error)
 		return ret.Changed, false
@@ -588,7 +598,9 @@ func doBaseOsUninstall(ctx *baseOsMgrContext, uuidStr string,
 			log.Infof("doBaseOsUninstall(%s) for %s, currently on other %s\n",
 				status.BaseOsVersion, uuidStr, partName)
 			log.Infof("Mark other partition %s, unused\n", partName)
-			zboot.SetOtherPartitionStateUnused()
+			if err := zboot.Rollback(partName); err != nil {
+				log.Errorf("doBaseOsUninstall: %s\n", err)
+			}
 			publishZbootPartitionStatus(ctx, partName)
 			baseOsSetPartitionInfoInStatus(ctx, status,
 				status.PartitionLabel)
@@ -677,7 +689,8 @@ func doBaseOsUninstall(ctx *baseOsMgrContext, uuidStr string,
 	return changed, del
 }
 
-func installBaseOsObject(srcFilename string, dstFilename string) error {
+func installBaseOsObject(srcFilename string, dstFilename string,
+	checksum string) error {
 
 	log.Infof("installBaseOsObject: %s to %s\n", srcFilename, dstFilename)
 
@@ -695,6 +708,13 @@ func installBaseOsObject(srcFilename string, dstFilename string) error {
 		log.Errorln(errStr)
 		return errors.New(errStr)
 	}
+	if checksum != "" {
+		err := zboot.RecordPartitionChecksum(dstFilename, checksum)
+		if err != nil {
+			// Only used for reporting
+			log.Errorf("installBaseOsObject: %s\n", err)
+		}
+	}
 	return nil
 }
 
@@ -734,7 +754,11 @@ func lookupBaseOsConfig(ctx *baseOsMgrContext, key string) *types.BaseOsConfig {
 		log.Infof("lookupBaseOsConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastBaseOsConfig(c)
+	config, err := cast.CastBaseOsConfig(c)
+	if err != nil {
+		log.Errorf("lookupBaseOsConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupBaseOsConfig(%s) got %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -750,7 +774,11 @@ func lookupBaseOsStatus(ctx *baseOsMgrContext, key string) *types.BaseOsStatus {
 		log.Infof("lookupBaseOsStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastBaseOsStatus(st)
+	status, err := cast.CastBaseOsStatus(st)
+	if err != nil {
+		log.Errorf("lookupBaseOsStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupBaseOsStatus(%s) got %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -787,7 +815,11 @@ func validateBaseOsConfig(ctx *baseOsMgrContext, config types.BaseOsConfig) erro
 	var osCount, activateCount int
 	items := ctx.subBaseOsConfig.GetAll()
 	for key, c := range items {
-		boc := cast.CastBaseOsConfig(c)
+		boc, err := cast.CastBaseOsConfig(c)
+		if err != nil {
+			log.Errorf("validateBaseOsConfig: %s\n", err)
+			continue
+		}
 		if boc.Key() != key {
 			log.Errorf("validateBaseOsConfig(%s) got %s; ignored %+v\n",
 				key, boc.Key(), boc)
@@ -887,11 +919,10 @@ func doPartitionStateTransition(ctx *baseOsMgrContext, uuidStr string, config ty
 			uuidStr, status.BaseOsVersion, partStatus.ShortVersion,
 			config.BaseOsVersion)
 	} else {
-		if err := zboot.MarkCurrentPartitionStateActive(); err != nil {
+		if err := zboot.Commit(); err != nil {
 			errStr := fmt.Sprintf("mark other active failed %s", err)
 			log.Errorf(errStr)
-			status.Error = errStr
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errStr)
 			status.TestComplete = true
 			publishBaseOsStatus(ctx, &status)
 			// publish the updated partition information
@@ -914,7 +945,11 @@ func updateAndPublishBaseOsStatusAll(ctx *baseOsMgrContext) {
 	pub := ctx.pubBaseOsStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastBaseOsStatus(st)
+		status, err := cast.CastBaseOsStatus(st)
+		if err != nil {
+			log.Errorf("updateAndPublishBaseOsStatusAll: %s\n", err)
+			continue
+		}
 		if status.PartitionLabel == "" {
 			continue
 		}
@@ -927,7 +962,11 @@ func maybeRetryInstall(ctx *baseOsMgrContext) {
 	pub := ctx.pubBaseOsStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastBaseOsStatus(st)
+		status, err := cast.CastBaseOsStatus(st)
+		if err != nil {
+			log.Errorf("maybeRetryInstall: %s\n", err)
+			continue
+		}
 		if !status.TooEarly {
 			log.Infof("maybeRetryInstall(%s) skipped\n",
 				status.Key())
@@ -943,8 +982,7 @@ func maybeRetryInstall(ctx *baseOsMgrContext) {
 		log.Infof("maybeRetryInstall(%s) redoing after %s %v\n",
 			status.Key(), status.Error, status.ErrorTime)
 		status.TooEarly = false
-		status.Error = ""
-		status.ErrorTime = time.Time{}
+		status.ClearError()
 		baseOsHandleStatusUpdate(ctx, config, &status)
 	}
 }
@@ -982,19 +1020,30 @@ func publishZbootPartitionStatus(ctx *baseOsMgrContext, partName string) {
 		return
 	}
 	pub := ctx.pubZbootStatus
-	status := types.ZbootStatus{}
+	status := types.BaseOsPartitionStatus{}
 	status.PartitionLabel = partName
 	status.PartitionDevname = zboot.GetPartitionDevname(partName)
-	status.PartitionState = zboot.GetPartitionState(partName)
-	status.ShortVersion = zboot.GetShortVersion(partName)
+	state, err := zboot.GetPartitionState(partName)
+	if err != nil {
+		log.Errorf("publishZbootPartitionStatus: %s\n", err)
+	}
+	status.PartitionState = string(state)
+	meta, err := zboot.GetPartitionMetadata(partName)
+	if err != nil {
+		// Nothing installed yet in the other partition
+		log.Errorf("publishZbootPartitionStatus: %s\n", err)
+	}
+	status.ShortVersion = meta.Version
 	status.LongVersion = zboot.GetLongVersion(partName)
+	status.BuildDate = meta.BuildDate
+	status.Checksum = meta.Checksum
 	status.CurrentPartition = zboot.IsCurrentPartition(partName)
 	log.Infof("publishZbootPartitionStatus: %v\n", status)
 	pub.Publish(partName, status)
 	syscall.Sync()
 }
 
-func getZbootStatus(ctx *baseOsMgrContext, partName string) *types.ZbootStatus {
+func getZbootStatus(ctx *baseOsMgrContext, partName string) *types.BaseOsPartitionStatus {
 	partName = strings.TrimSpace(partName)
 	if !isValidBaseOsPartitionLabel(partName) {
 		return nil
@@ -1002,7 +1051,11 @@ func getZbootStatus(ctx *baseOsMgrContext, partName string) *types.ZbootStatus {
 	pub := ctx.pubZbootStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastZbootStatus(st)
+		status, err := cast.CastBaseOsPartitionStatus(st)
+		if err != nil {
+			log.Errorf("getZbootStatus: %s\n", err)
+			continue
+		}
 		if status.PartitionLabel == partName {
 			return &status
 		}
@@ -11,7 +11,6 @@ import (
 	"github.com/zededa/go-provision/types"
 	"io"
 	"os"
-	"time"
 )
 
 func lookupCertObjSafename(ctx *baseOsMgrContext, safename string) *types.CertObjConfig {
@@ -19,7 +18,11 @@ func lookupCertObjSafename(ctx *baseOsMgrContext, safename string) *types.CertOb
 	sub := ctx.subCertObjConfig
 	items := sub.GetAll()
 	for key, c := range items {
-		config := cast.CastCertObjConfig(c)
+		config, err := cast.CastCertObjConfig(c)
+		if err != nil {
+			log.Errorf("lookupCertObjSafename: %s\n", err)
+			continue
+		}
 		if config.Key() != key {
 			log.Errorf("certObjHandleStatusUpdateSafename key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, config.Key(), config)
@@ -112,8 +115,7 @@ func doCertObjInstall(ctx *baseOsMgrContext, uuidStr string, config types.CertOb
 		errString := fmt.Sprintf("%s, Storage length mismatch: %d vs %d\n", uuidStr,
 			len(config.StorageConfigList),
 			len(status.StorageStatusList))
-		status.Error = errString
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errString)
 		return changed, false
 	}
 
@@ -127,8 +129,7 @@ func doCertObjInstall(ctx *baseOsMgrContext, uuidStr string, config types.CertOb
 				sc.Name, ss.Name,
 				sc.ImageSha256, ss.ImageSha256)
 			log.Errorln(errString)
-			status.Error = errString
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errString)
 			changed = true
 			return changed, false
 		}
@@ -160,8 +161,7 @@ func checkCertObjStorageDownloadStatus(ctx *baseOsMgrContext, uuidStr string,
 		config.StorageConfigList, status.StorageStatusList)
 
 	status.State = ret.MinState
-	status.Error = ret.AllErrors
-	status.ErrorTime = ret.ErrorTime
+	status.SetError(ret.AllErrors, ret.ErrorTime)
 	status.MissingDatastore = ret.MissingDatastore
 
 	log.Infof("checkCertObjDownloadStatus %s, %v\n", uuidStr, ret.MinState)
@@ -264,7 +264,11 @@ func lookupCertObjConfig(ctx *baseOsMgrContext, key string) *types.CertObjConfig
 		log.Infof("lookupCertObjConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastCertObjConfig(c)
+	config, err := cast.CastCertObjConfig(c)
+	if err != nil {
+		log.Errorf("lookupCertObjConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupCertObjConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -280,7 +284,11 @@ func lookupCertObjStatus(ctx *baseOsMgrContext, key string) *types.CertObjStatus
 		log.Infof("lookupCertObjStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastCertObjStatus(st)
+	status, err := cast.CastCertObjStatus(st)
+	if err != nil {
+		log.Errorf("lookupCertObjStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupCertObjStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
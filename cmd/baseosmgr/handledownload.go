@@ -29,7 +29,11 @@ func lookupDownloaderConfig(ctx *baseOsMgrContext, objType string,
 			objType, safename)
 		return nil
 	}
-	config := cast.CastDownloaderConfig(c)
+	config, err := cast.CastDownloaderConfig(c)
+	if err != nil {
+		log.Errorf("lookupDownloaderConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != safename {
 		log.Errorf("lookupDownloaderConfig(%s) got %s; ignored %+v\n",
 			safename, config.Key(), config)
@@ -177,7 +181,11 @@ func lookupDownloaderStatus(ctx *baseOsMgrContext, objType string,
 			objType, safename)
 		return nil
 	}
-	status := cast.CastDownloaderStatus(c)
+	status, err := cast.CastDownloaderStatus(c)
+	if err != nil {
+		log.Errorf("lookupDownloaderStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != safename {
 		log.Errorf("lookupDownloaderStatus(%s) got %s; ignored %+v\n",
 			safename, status.Key(), status)
@@ -316,13 +324,13 @@ func checkStorageDownloadStatus(ctx *baseOsMgrContext, objType string,
 				safename)
 			continue
 		}
-		if ds.LastErr != "" {
+		if ds.Error != "" {
 			log.Errorf("checkStorageDownloadStatus %s, downloader error, %s\n",
-				uuidStr, ds.LastErr)
-			ss.Error = ds.LastErr
+				uuidStr, ds.Error)
+			ss.Error = ds.Error
 			ret.AllErrors = appendError(ret.AllErrors, "downloader",
-				ds.LastErr)
-			ss.ErrorTime = ds.LastErrTime
+				ds.Error)
+			ss.ErrorTime = ds.ErrorTime
 			ret.ErrorTime = ss.ErrorTime
 			ret.Changed = true
 		}
@@ -378,7 +386,11 @@ func lookupDatastoreConfig(ctx *baseOsMgrContext,
 		log.Errorln(errStr)
 		return nil, errors.New(errStr)
 	}
-	dst := cast.CastDatastoreConfig(cfg)
+	dst, err := cast.CastDatastoreConfig(cfg)
+	if err != nil {
+		log.Errorf("lookupDatastoreConfig: %s\n", err)
+		return nil, err
+	}
 	return &dst, nil
 }
 
@@ -463,7 +475,8 @@ func installDownloadedObject(objType string, safename string,
 			ret = installCertObject(srcFilename, dstFilename, safename)
 
 		case baseOsObj:
-			ret = installBaseOsObject(srcFilename, dstFilename)
+			ret = installBaseOsObject(srcFilename, dstFilename,
+				status.ImageSha256)
 
 		default:
 			errStr := fmt.Sprintf("installDownloadedObject %s, Unsupported Object Type %v",
@@ -481,8 +494,7 @@ func installDownloadedObject(objType string, safename string,
 		status.State = types.INSTALLED
 		log.Infof("installDownloadedObject(%s) done\n", safename)
 	} else {
-		status.Error = fmt.Sprintf("%s", ret)
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%s", ret))
 	}
 	return ret
 }
@@ -18,7 +18,11 @@ func verifierConfigGetSha256(ctx *baseOsMgrContext, objType string,
 	pub := verifierPublication(ctx, objType)
 	items := pub.GetAll()
 	for key, c := range items {
-		config := cast.CastVerifyImageConfig(c)
+		config, err := cast.CastVerifyImageConfig(c)
+		if err != nil {
+			log.Errorf("verifierConfigGetSha256: %s\n", err)
+			continue
+		}
 		if config.ImageSha256 == sha {
 			log.Infof("verifierConfigGetSha256(%s): found key %s safename %s, refcount %d\n",
 				sha, key, config.Safename, config.RefCount)
@@ -39,7 +43,11 @@ func lookupVerifierConfig(ctx *baseOsMgrContext, objType string,
 			objType, safename)
 		return nil
 	}
-	config := cast.CastVerifyImageConfig(c)
+	config, err := cast.CastVerifyImageConfig(c)
+	if err != nil {
+		log.Errorf("lookupVerifierConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != safename {
 		log.Infof("lookupVerifierConfig(%s) got %s; ignored %+v\n",
 			safename, config.Key(), config)
@@ -165,7 +173,11 @@ func lookupVerificationStatusSha256(ctx *baseOsMgrContext, objType string,
 	sub := ctx.subBaseOsVerifierStatus
 	items := sub.GetAll()
 	for _, st := range items {
-		status := cast.CastVerifyImageStatus(st)
+		status, err := cast.CastVerifyImageStatus(st)
+		if err != nil {
+			log.Errorf("lookupVerificationStatusSha256: %s\n", err)
+			continue
+		}
 		if status.ImageSha256 == sha256 {
 			return &status
 		}
@@ -184,7 +196,11 @@ func lookupVerificationStatus(ctx *baseOsMgrContext, objType string,
 			objType, safename)
 		return nil
 	}
-	status := cast.CastVerifyImageStatus(c)
+	status, err := cast.CastVerifyImageStatus(c)
+	if err != nil {
+		log.Errorf("lookupVerificationStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != safename {
 		log.Infof("lookupVerifierStatus(%s) got %s; ignored %+v\n",
 			safename, status.Key(), status)
@@ -250,14 +266,14 @@ func checkStorageVerifierStatus(ctx *baseOsMgrContext, objType string, uuidStr s
 			ss.State = vs.State
 			ret.Changed = true
 		}
-		if vs.LastErr != "" {
+		if vs.Error != "" {
 			log.Errorf("checkStorageVerifierStatus(%s) verifier error for %s: %s\n",
-				uuidStr, safename, vs.LastErr)
-			ss.Error = vs.LastErr
+				uuidStr, safename, vs.Error)
+			ss.Error = vs.Error
 			ret.AllErrors = appendError(ret.AllErrors, "verifier",
-				vs.LastErr)
-			ss.ErrorTime = vs.LastErrTime
-			ret.ErrorTime = vs.LastErrTime
+				vs.Error)
+			ss.ErrorTime = vs.ErrorTime
+			ret.ErrorTime = vs.ErrorTime
 			ret.Changed = true
 			continue
 		}
@@ -0,0 +1,207 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Offline check of the identity files for manufacturing QA. The check
+// mode validates the certificates and keys, the server file, and the
+// hardware model mapping without any network access, prints a PASS or
+// FAIL line per check, and exits non-zero if any check failed.
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zededa/go-provision/hardware"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+type checkResult struct {
+	name   string
+	err    error
+	detail string
+}
+
+func (r checkResult) String() string {
+	if r.err != nil {
+		return fmt.Sprintf("FAIL %s: %s", r.name, r.err)
+	}
+	return fmt.Sprintf("PASS %s: %s", r.name, r.detail)
+}
+
+// runChecks returns the results for the files in identityDirname
+func runChecks(identityDirname string) []checkResult {
+	var results []checkResult
+	now := time.Now()
+
+	rootCertName := identityDirname + "/root-certificate.pem"
+	roots, detail, err := checkRootCertificate(rootCertName, now)
+	results = append(results, checkResult{name: rootCertName, err: err,
+		detail: detail})
+
+	onboardCertName := identityDirname + "/onboard.cert.pem"
+	onboardKeyName := identityDirname + "/onboard.key.pem"
+	if _, err := os.Stat(onboardCertName); err == nil {
+		cert, err := tls.LoadX509KeyPair(onboardCertName, onboardKeyName)
+		if err == nil {
+			detail, err = checkCertificate(cert, roots, now)
+		}
+		results = append(results, checkResult{name: onboardCertName,
+			err: err, detail: detail})
+	}
+
+	deviceCertName := identityDirname + "/device.cert.pem"
+	deviceKeyName := identityDirname + "/device.key.pem"
+	cert, err := zedcloud.LoadKeyPair(deviceCertName, deviceKeyName)
+	if err == nil {
+		detail, err = checkCertificate(cert, roots, now)
+	}
+	results = append(results, checkResult{name: deviceCertName, err: err,
+		detail: detail})
+
+	detail, err = checkServers(identityDirname)
+	results = append(results, checkResult{
+		name: identityDirname + "/server", err: err, detail: detail})
+
+	model := checkModelName(identityDirname)
+	err = nil
+	if !existingModel(model) {
+		errStr := fmt.Sprintf("No %s.json in %s and %s", model,
+			AADirname, DNCDirname)
+		err = errors.New(errStr)
+	}
+	results = append(results, checkResult{name: "hardwaremodel",
+		err: err, detail: model})
+	return results
+}
+
+// checkRootCertificate returns the pool to verify the other certificates
+func checkRootCertificate(filename string,
+	now time.Time) (*x509.CertPool, string, error) {
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	pool := x509.NewCertPool()
+	var subjects []string
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := checkValidity(cert, now); err != nil {
+			return nil, "", err
+		}
+		pool.AddCert(cert)
+		subjects = append(subjects, cert.Subject.CommonName)
+	}
+	if len(subjects) == 0 {
+		errStr := fmt.Sprintf("No certificate in %s", filename)
+		return nil, "", errors.New(errStr)
+	}
+	return pool, strings.Join(subjects, ", "), nil
+}
+
+// checkCertificate checks the validity period and, unless it is
+// self-signed, that the certificate chains to the roots. The key was
+// matched when loading the pair.
+func checkCertificate(cert tls.Certificate, roots *x509.CertPool,
+	now time.Time) (string, error) {
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := checkValidity(leaf, now); err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("%s expires %s", leaf.Subject.CommonName,
+		leaf.NotAfter.UTC().Format(time.RFC3339))
+	if leaf.CheckSignatureFrom(leaf) == nil {
+		return detail + " self-signed", nil
+	}
+	if roots == nil {
+		return "", errors.New("No root certificate to verify the chain")
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots,
+		Intermediates: intermediates, CurrentTime: now,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
+		return "", err
+	}
+	return detail, nil
+}
+
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		errStr := fmt.Sprintf("%s not valid until %s",
+			cert.Subject.CommonName, cert.NotBefore.UTC())
+		return errors.New(errStr)
+	}
+	if now.After(cert.NotAfter) {
+		errStr := fmt.Sprintf("%s expired %s",
+			cert.Subject.CommonName, cert.NotAfter.UTC())
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+func checkServers(identityDirname string) (string, error) {
+	servers, err := zedcloud.ReadServers(identityDirname+"/server",
+		identityDirname+"/server.d")
+	if err != nil {
+		return "", err
+	}
+	for _, server := range servers {
+		if err := zedcloud.CheckServer(server); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(servers, ", "), nil
+}
+
+// checkModelName uses the hardwaremodel file in identityDirname if any
+func checkModelName(identityDirname string) string {
+	b, err := ioutil.ReadFile(identityDirname + "/hardwaremodel")
+	if err == nil {
+		if model := strings.TrimSpace(string(b)); model != "" {
+			return model
+		}
+	}
+	return hardware.GetHardwareModelNoOverride()
+}
+
+// checkIdentity prints the report and returns false if any check failed
+func checkIdentity(identityDirname string) bool {
+	passed := true
+	for _, r := range runChecks(identityDirname) {
+		fmt.Println(r)
+		if r.err != nil {
+			passed = false
+		}
+	}
+	return passed
+}
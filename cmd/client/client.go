@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,7 +20,6 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/google/go-cmp/cmp"
 	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/api/zmet"
@@ -56,7 +56,11 @@ var Version = "No version specified"
 //  device.cert.pem,
 //  device.key.pem		Device certificate/key created before this
 //  		     		client is started.
-//  uuid			Written by getUuid operation
+//  device.key.tpm		Instead of device.key.pem if the key is in
+//  				the TPM; written by tpmDeviceCert operation
+//  uuid			Written by getUuid operation; removed by
+//  				reonboard operation which also replaces the
+//  				device certificate and key
 //  hardwaremodel		Written by getUuid if server returns a hardwaremodel
 //  enterprise			Written by getUuid if server returns an enterprise
 //  name			Written by getUuid if server returns a name
@@ -68,6 +72,7 @@ type clientContext struct {
 	deviceNetworkStatus    *types.DeviceNetworkStatus
 	usableAddressCount     int
 	subGlobalConfig        *pubsub.Subscription
+	ocspPolicy             types.OCSPPolicy
 }
 
 var debug = false
@@ -81,9 +86,13 @@ func Run() {
 	dirPtr := flag.String("D", "/config", "Directory with certs etc")
 	stdoutPtr := flag.Bool("s", false, "Use stdout")
 	noPidPtr := flag.Bool("p", false, "Do not check for running client")
-	maxRetriesPtr := flag.Int("r", 0, "Max ping retries")
+	maxRetriesPtr := flag.Int("r", 0, "Max retries for each step")
 	pingURLPtr := flag.String("U", "", "Override ping url")
 	insecurePtr := flag.Bool("I", false, "Do not check server cert")
+	progressPtr := flag.String("P", "", "Write progress as JSON lines to file or - for stdout")
+	bundlePtr := flag.String("B", "", "Provisioning bundle; default provision.json in the cert directory")
+	checkPtr := flag.Bool("check", false, "Check the identity files without network access and exit")
+	tokenPtr := flag.String("T", "", "Token from the controller for reonboard")
 	flag.Parse()
 
 	versionFlag := *versionPtr
@@ -102,11 +111,20 @@ func Run() {
 	maxRetries := *maxRetriesPtr
 	pingURL := *pingURLPtr
 	insecure := *insecurePtr
+	progressFilename := *progressPtr
+	bundleFilename := *bundlePtr
+	reonboardToken := *tokenPtr
 	args := flag.Args()
 	if versionFlag {
 		fmt.Printf("%s: %s\n", os.Args[0], Version)
 		return
 	}
+	if *checkPtr {
+		if !checkIdentity(identityDirname) {
+			os.Exit(1)
+		}
+		return
+	}
 	// Sending json log format to stdout
 	logf, err := agentlog.Init("client", curpart)
 	if err != nil {
@@ -124,9 +142,12 @@ func Run() {
 	}
 	log.Infof("Starting %s\n", agentName)
 	operations := map[string]bool{
-		"selfRegister": false,
-		"ping":         false,
-		"getUuid":      false,
+		"selfRegister":  false,
+		"ping":          false,
+		"getUuid":       false,
+		"tpmDeviceCert": false,
+		"provision":     false,
+		"reonboard":     false,
 	}
 	for _, op := range args {
 		if _, ok := operations[op]; ok {
@@ -142,17 +163,58 @@ func Run() {
 	onboardKeyName := identityDirname + "/onboard.key.pem"
 	deviceCertName := identityDirname + "/device.cert.pem"
 	deviceKeyName := identityDirname + "/device.key.pem"
-	serverFileName := identityDirname + "/server"
 	uuidFileName := identityDirname + "/uuid"
 	hardwaremodelFileName := identityDirname + "/hardwaremodel"
 	enterpriseFileName := identityDirname + "/enterprise"
 	nameFileName := identityDirname + "/name"
+	serialFileName := identityDirname + "/serial"
+	if bundleFilename == "" {
+		bundleFilename = identityDirname + "/" + provisionBasename
+	}
 
 	cms := zedcloud.GetCloudMetrics() // Need type of data
 	pub, err := pubsub.Publish(agentName, cms)
 	if err != nil {
 		log.Fatal(err)
 	}
+	progress, err := newOnboardingProgress(progressFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if operations["provision"] {
+		err := applyProvisioningBundle(bundleFilename, identityDirname)
+		if err != nil {
+			log.Fatalf("provision %s: %s\n", bundleFilename, err)
+		}
+		log.Infof("Applied %s\n", bundleFilename)
+		if !operations["tpmDeviceCert"] && !operations["selfRegister"] &&
+			!operations["ping"] && !operations["getUuid"] &&
+			!operations["reonboard"] {
+			return
+		}
+	}
+	if operations["reonboard"] {
+		progress.start(types.OnboardingCertificates)
+		if err := reonboard(identityDirname, reonboardToken); err != nil {
+			progress.fatal(types.OnboardingCertError, err)
+		}
+		progress.succeeded()
+		log.Infof("Reonboarding; reboot when done\n")
+		operations["selfRegister"] = true
+		operations["getUuid"] = true
+	}
+	if operations["tpmDeviceCert"] {
+		progress.start(types.OnboardingCertificates)
+		err := createTPMDeviceCert(deviceCertName, deviceKeyName)
+		if err != nil {
+			progress.fatal(types.OnboardingCertError, err)
+		}
+		progress.succeeded()
+		if !operations["selfRegister"] && !operations["ping"] &&
+			!operations["getUuid"] {
+			return
+		}
+	}
 
 	var oldUUID uuid.UUID
 	b, err := ioutil.ReadFile(uuidFileName)
@@ -186,7 +248,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	clientCtx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -195,6 +257,7 @@ func Run() {
 	// After 5 seconds we check; if we already have a UUID we proceed.
 	// Otherwise we start connecting to zedcloud whether or not we
 	// have any IP addresses.
+	progress.start(types.OnboardingNetwork)
 	t1 := time.NewTimer(5 * time.Second)
 	done := clientCtx.usableAddressCount != 0
 
@@ -221,6 +284,9 @@ func Run() {
 
 				log.Infof("Already have a UUID %s; declaring success\n",
 					oldUUID.String())
+				progress.status.Phase = types.OnboardingComplete
+				progress.status.DeviceUUID = oldUUID.String()
+				progress.succeeded()
 				// Likely zero metrics
 				err := pub.Publish("global", zedcloud.GetCloudMetrics())
 				if err != nil {
@@ -232,109 +298,135 @@ func Run() {
 	}
 	log.Infof("Got for deviceNetworkConfig: %d addresses\n",
 		clientCtx.usableAddressCount)
+	progress.succeeded()
+	discoverProxies(clientCtx.deviceNetworkStatus, progress)
 
 	zedcloudCtx := zedcloud.ZedCloudContext{
 		DeviceNetworkStatus: clientCtx.deviceNetworkStatus,
 		FailureFunc:         zedcloud.ZedCloudFailure,
 		SuccessFunc:         zedcloud.ZedCloudSuccess,
+		CompressionFunc:     zedcloud.ZedCloudCompressed,
+		OCSPPolicy:          clientCtx.ocspPolicy,
+		PostResponseHooks: []zedcloud.PostResponseHook{
+			zedcloud.ZedCloudMetricsHook},
 	}
 	var onboardCert, deviceCert tls.Certificate
 	var deviceCertPem []byte
 	deviceCertSet := false
 
+	progress.start(types.OnboardingCertificates)
 	if operations["selfRegister"] ||
 		(operations["ping"] && forceOnboardingCert) {
 		var err error
 		onboardCert, err = tls.LoadX509KeyPair(onboardCertName, onboardKeyName)
 		if err != nil {
-			log.Fatal(err)
+			progress.fatal(types.OnboardingCertError, err)
 		}
 		// Load device text cert for upload
 		deviceCertPem, err = ioutil.ReadFile(deviceCertName)
 		if err != nil {
-			log.Fatal(err)
+			progress.fatal(types.OnboardingCertError, err)
 		}
 	}
 	if operations["getUuid"] ||
 		(operations["ping"] && !forceOnboardingCert) {
 		// Load device cert
 		var err error
-		deviceCert, err = tls.LoadX509KeyPair(deviceCertName,
+		deviceCert, err = zedcloud.LoadKeyPair(deviceCertName,
 			deviceKeyName)
 		if err != nil {
-			log.Fatal(err)
+			progress.fatal(types.OnboardingCertError, err)
 		}
 		deviceCertSet = true
 	}
 
-	server, err := ioutil.ReadFile(serverFileName)
+	// The requests fail over to the other controllers if any
+	servers, err := zedcloud.NewServerListIn(identityDirname)
 	if err != nil {
-		log.Fatal(err)
-	}
-	serverNameAndPort := strings.TrimSpace(string(server))
-	serverName := strings.Split(serverNameAndPort, ":")[0]
+		progress.fatal(types.OnboardingServerError, err)
+	}
+	zedcloudCtx.Servers = servers
+	state := loadOnboardingState(onboardingStateFilename, deviceCertName)
+	policies := loadRetryPolicies(identityDirname+"/"+retryPolicyBasename,
+		maxRetries)
+	serverNameAndPort := servers.Current()
+	serverName := servers.CurrentHost()
 	const return400 = false
 	// Post something without a return type.
 	// Returns true when done; false when retry
 	myPost := func(retryCount int, requrl string, reqlen int64, b *bytes.Buffer) bool {
-		resp, contents, err := zedcloud.SendOnAllIntf(zedcloudCtx,
+		res, err := zedcloud.SendOnAllIntf(zedcloudCtx,
 			requrl, reqlen, b, retryCount, return400)
-		if err != nil {
+		progress.status.Proxy = res.Proxy
+		if res.Resp == nil {
 			log.Errorln(err)
+			progress.setError(types.OnboardingSendError, err.Error())
 			return false
 		}
+		resp := res.Resp
+		contents := res.Contents
 
 		if !zedcloudCtx.NoLedManager {
 			// Inform ledmanager about cloud connectivity
-			types.UpdateLedManagerConfig(3)
+			types.UpdateLedManagerConfig(types.DeviceStateConnected)
 		}
 		switch resp.StatusCode {
 		case http.StatusOK:
 			if !zedcloudCtx.NoLedManager {
 				// Inform ledmanager about existence in cloud
-				types.UpdateLedManagerConfig(4)
+				types.UpdateLedManagerConfig(types.DeviceStateOnboarded)
 			}
 			log.Infof("%s StatusOK\n", requrl)
 		case http.StatusCreated:
 			if !zedcloudCtx.NoLedManager {
 				// Inform ledmanager about existence in cloud
-				types.UpdateLedManagerConfig(4)
+				types.UpdateLedManagerConfig(types.DeviceStateOnboarded)
 			}
 			log.Infof("%s StatusCreated\n", requrl)
 		case http.StatusConflict:
 			if !zedcloudCtx.NoLedManager {
 				// Inform ledmanager about brokenness
-				types.UpdateLedManagerConfig(10)
+				types.UpdateLedManagerConfig(types.DeviceStateOnboardConflict)
 			}
 			log.Errorf("%s StatusConflict\n", requrl)
 			// Retry until fixed
 			log.Errorf("%s\n", string(contents))
+			progress.setError(types.OnboardingConflictError,
+				string(contents))
 			return false
 		case http.StatusNotModified: // XXX from zedcloud
 			if !zedcloudCtx.NoLedManager {
 				// Inform ledmanager about brokenness
-				types.UpdateLedManagerConfig(10)
+				types.UpdateLedManagerConfig(types.DeviceStateOnboardConflict)
 			}
 			log.Errorf("%s StatusNotModified\n", requrl)
 			// Retry until fixed
 			log.Errorf("%s\n", string(contents))
+			progress.setError(types.OnboardingStatusError,
+				http.StatusText(resp.StatusCode))
 			return false
 		default:
 			log.Errorf("%s statuscode %d %s\n",
 				requrl, resp.StatusCode,
 				http.StatusText(resp.StatusCode))
 			log.Errorf("%s\n", string(contents))
+			progress.setError(types.OnboardingStatusError,
+				http.StatusText(resp.StatusCode))
 			return false
 		}
 
 		contentType := resp.Header.Get("Content-Type")
 		if contentType == "" {
 			log.Errorf("%s no content-type\n", requrl)
+			progress.setError(types.OnboardingResponseError,
+				"No content-type")
 			return false
 		}
 		mimeType, _, err := mime.ParseMediaType(contentType)
 		if err != nil {
 			log.Errorf("%s ParseMediaType failed %v\n", requrl, err)
+			progress.setError(types.OnboardingResponseError,
+				err.Error())
 			return false
 		}
 		switch mimeType {
@@ -342,6 +434,8 @@ func Run() {
 			log.Debugf("Received reply %s\n", string(contents))
 		default:
 			log.Errorln("Incorrect Content-Type " + mimeType)
+			progress.setError(types.OnboardingResponseError,
+				"Incorrect Content-Type "+mimeType)
 			return false
 		}
 		return true
@@ -349,15 +443,20 @@ func Run() {
 
 	// Returns true when done; false when retry
 	selfRegister := func(retryCount int) bool {
-		// XXX add option to get this from a file in /config + override
-		// logic
-		productSerial := hardware.GetProductSerial()
+		// A provisioning bundle can override the hardware serial
+		var productSerial string
+		if b, err := ioutil.ReadFile(serialFileName); err == nil {
+			productSerial = string(b)
+		} else {
+			productSerial = hardware.GetSerialNumber()
+		}
 		productSerial = strings.TrimSpace(productSerial)
 		log.Infof("ProductSerial %s\n", productSerial)
 
 		tlsConfig, err := zedcloud.GetTlsConfig(serverName, &onboardCert)
 		if err != nil {
 			log.Errorln(err)
+			progress.setError(types.OnboardingCertError, err.Error())
 			return false
 		}
 		zedcloudCtx.TlsConfig = tlsConfig
@@ -380,22 +479,25 @@ func Run() {
 	// Returns the response when done. Caller can not use resp.Body but
 	// can use the contents []byte
 	myGet := func(requrl string, retryCount int) (bool, *http.Response, []byte) {
-		resp, contents, err := zedcloud.SendOnAllIntf(zedcloudCtx,
+		res, err := zedcloud.SendOnAllIntf(zedcloudCtx,
 			requrl, 0, nil, retryCount, return400)
-		if err != nil {
+		if res.Resp == nil {
 			log.Errorln(err)
+			progress.setError(types.OnboardingSendError, err.Error())
 			return false, nil, nil
 		}
 
-		switch resp.StatusCode {
+		switch res.StatusCode {
 		case http.StatusOK:
 			log.Infof("%s StatusOK\n", requrl)
-			return true, resp, contents
+			return true, res.Resp, res.Contents
 		default:
 			log.Errorf("%s statuscode %d %s\n",
-				requrl, resp.StatusCode,
-				http.StatusText(resp.StatusCode))
-			log.Errorf("Received %s\n", string(contents))
+				requrl, res.StatusCode,
+				http.StatusText(res.StatusCode))
+			log.Errorf("Received %s\n", string(res.Contents))
+			progress.setError(types.OnboardingStatusError,
+				http.StatusText(res.StatusCode))
 			return false, nil, nil
 		}
 	}
@@ -409,8 +511,10 @@ func Run() {
 		log.Infof("Using device cert\n")
 		cert = deviceCert
 	} else {
-		log.Fatalf("No device certificate for %v\n", operations)
+		errStr := fmt.Sprintf("No device certificate for %v", operations)
+		progress.fatal(types.OnboardingCertError, errors.New(errStr))
 	}
+	progress.succeeded()
 
 	if operations["ping"] {
 		var requrl string
@@ -427,66 +531,47 @@ func Run() {
 		}
 		tlsConfig, err := zedcloud.GetTlsConfig(serverName, &cert)
 		if err != nil {
-			log.Fatal(err)
+			progress.fatal(types.OnboardingCertError, err)
 		}
 		tlsConfig.InsecureSkipVerify = insecure
 		zedcloudCtx.TlsConfig = tlsConfig
 		// As we ping the cloud or other URLs, don't affect the LEDs
 		zedcloudCtx.NoLedManager = true
 
-		retryCount := 0
-		done := false
-		var delay time.Duration
-		for !done {
-			time.Sleep(delay)
-			done, _, _ = myGet(requrl, retryCount)
-			if done {
-				continue
-			}
-			retryCount += 1
-			if maxRetries != 0 && retryCount > maxRetries {
-				log.Infof("Exceeded %d retries for ping\n",
-					maxRetries)
-				os.Exit(1)
-			}
-			delay = 2 * (delay + time.Second)
-			if delay > maxDelay {
-				delay = maxDelay
-			}
-			log.Infof("Retrying ping in %d seconds\n",
-				delay/time.Second)
+		step := onboardingStep{
+			phase:  types.OnboardingPing,
+			policy: policies[types.OnboardingPing],
+			run: func(retryCount int) bool {
+				done, _, _ := myGet(requrl, retryCount)
+				return done
+			},
+		}
+		if !runStep(step, progress) {
+			os.Exit(1)
 		}
 	}
 
 	tlsConfig, err := zedcloud.GetTlsConfig(serverName, &cert)
 	if err != nil {
-		log.Fatal(err)
+		progress.fatal(types.OnboardingCertError, err)
 	}
 	zedcloudCtx.TlsConfig = tlsConfig
 
-	if operations["selfRegister"] {
-		retryCount := 0
-		done := false
-		var delay time.Duration
-		for !done {
-			time.Sleep(delay)
-			done = selfRegister(retryCount)
-			if done {
-				continue
-			}
-			retryCount += 1
-			if maxRetries != 0 && retryCount > maxRetries {
-				log.Errorf("Exceeded %d retries for selfRegister\n",
-					maxRetries)
-				os.Exit(1)
-			}
-			delay = 2 * (delay + time.Second)
-			if delay > maxDelay {
-				delay = maxDelay
-			}
-			log.Infof("Retrying selfRegister in %d seconds\n",
-				delay/time.Second)
+	if operations["selfRegister"] &&
+		state.done(types.OnboardingSelfRegister) {
+		log.Infof("selfRegister already done at %v\n",
+			state.Completed[types.OnboardingSelfRegister])
+	} else if operations["selfRegister"] {
+		step := onboardingStep{
+			phase:  types.OnboardingSelfRegister,
+			policy: policies[types.OnboardingSelfRegister],
+			run:    selfRegister,
 		}
+		if !runStep(step, progress) {
+			os.Exit(1)
+		}
+		state.complete(types.OnboardingSelfRegister,
+			onboardingStateFilename)
 	}
 
 	if operations["getUuid"] {
@@ -497,15 +582,8 @@ func Run() {
 
 		doWrite := true
 		requrl := serverNameAndPort + "/api/v1/edgedevice/config"
-		retryCount := 0
-		done := false
-		var delay time.Duration
-		for !done {
-			var resp *http.Response
-			var contents []byte
-
-			time.Sleep(delay)
-			done, resp, contents = myGet(requrl, retryCount)
+		getUuid := func(retryCount int) bool {
+			done, resp, contents := myGet(requrl, retryCount)
 			if done {
 				var err error
 
@@ -513,36 +591,31 @@ func Run() {
 				if err == nil {
 					// Inform ledmanager about config received from cloud
 					if !zedcloudCtx.NoLedManager {
-						types.UpdateLedManagerConfig(4)
+						types.UpdateLedManagerConfig(types.DeviceStateOnboarded)
 					}
-					continue
+					return true
 				}
 				// Keep on trying until it parses
-				done = false
 				log.Errorf("Failed parsing uuid: %s\n",
 					err)
-				continue
+				progress.setError(types.OnboardingResponseError,
+					err.Error())
+				return false
 			}
 			if oldUUID != nilUUID && retryCount > 2 {
 				log.Infof("Sticking with old UUID\n")
 				devUUID = oldUUID
-				done = true
-				continue
-			}
-
-			retryCount += 1
-			if maxRetries != 0 && retryCount > maxRetries {
-				log.Errorf("Exceeded %d retries for getUuid\n",
-					maxRetries)
-				os.Exit(1)
+				return true
 			}
-			delay = 2 * (delay + time.Second)
-			if delay > maxDelay {
-				delay = maxDelay
-			}
-			log.Infof("Retrying config in %d seconds\n",
-				delay/time.Second)
-
+			return false
+		}
+		step := onboardingStep{
+			phase:  types.OnboardingGetUuid,
+			policy: policies[types.OnboardingGetUuid],
+			run:    getUuid,
+		}
+		if !runStep(step, progress) {
+			os.Exit(1)
 		}
 		if oldUUID != nilUUID {
 			if oldUUID != devUUID {
@@ -561,6 +634,8 @@ func Run() {
 			b := []byte(fmt.Sprintf("%s\n", devUUID))
 			err = ioutil.WriteFile(uuidFileName, b, 0644)
 			if err != nil {
+				progress.failed(types.OnboardingWriteError,
+					err.Error())
 				log.Fatal("WriteFile", err, uuidFileName)
 			}
 			log.Debugf("Wrote UUID %s\n", devUUID)
@@ -612,7 +687,13 @@ func Run() {
 			log.Fatal("WriteFile", err, nameFileName)
 		}
 		log.Debugf("Wrote name %s\n", name)
+		// runStep already published the success; the UUID goes out
+		// with OnboardingComplete
+		progress.status.DeviceUUID = devUUID.String()
+		state.complete(types.OnboardingGetUuid, onboardingStateFilename)
 	}
+	progress.status.Phase = types.OnboardingComplete
+	progress.succeeded()
 
 	err = pub.Publish("global", zedcloud.GetCloudMetrics())
 	if err != nil {
@@ -627,7 +708,7 @@ func existingModel(model string) bool {
 		return false
 	}
 	DNCFilename := fmt.Sprintf("%s/%s.json", DNCDirname, model)
-	if _, err := os.Stat(DNCFilename); err == nil {
+	if _, err := os.Stat(DNCFilename); err != nil {
 		log.Debugln(err)
 		return false
 	}
@@ -643,8 +724,12 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 		return
 	}
 	log.Infof("handleGlobalConfigModify for %s\n", key)
-	debug, _ = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
+	var gcp *types.GlobalConfig
+	debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
+	if gcp != nil {
+		ctx.ocspPolicy = gcp.OCSPPolicy
+	}
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
 
@@ -659,12 +744,18 @@ func handleGlobalConfigDelete(ctxArg interface{}, key string,
 	log.Infof("handleGlobalConfigDelete for %s\n", key)
 	debug, _ = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
+	ctx.ocspPolicy = types.GlobalConfigDefaults.OCSPPolicy
 	log.Infof("handleGlobalConfigDelete done for %s\n", key)
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*clientContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -675,13 +766,15 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(ctx.deviceNetworkStatus, status))
 	*ctx.deviceNetworkStatus = status
 	newAddrCount := types.CountLocalAddrAnyNoLinkLocal(*ctx.deviceNetworkStatus)
 	if newAddrCount != ctx.usableAddressCount {
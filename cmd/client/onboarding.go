@@ -0,0 +1,192 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Onboarding steps, each with its own retry policy. The steps which change
+// the state in the controller are recorded under /persist so that after a
+// power loss we resume with the next step instead of repeating e.g.,
+// selfRegister, which fails with a conflict once it has been done.
+// The retry policies can be set per step in onboarding-retry.json in the
+// identity directory, for example
+//  {"selfRegister": {"BaseDelay": 5, "MaxDelay": 60, "MaxRetries": 20,
+//   "MaxElapsed": 600}}
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+const (
+	onboardingStateDirname  = "/persist/status/" + agentName
+	onboardingStateFilename = onboardingStateDirname + "/onboarding.json"
+	retryPolicyBasename     = "onboarding-retry.json"
+)
+
+// retryPolicy for a step. The delays are in seconds.
+type retryPolicy struct {
+	BaseDelay  uint32
+	MaxDelay   uint32
+	Jitter     float64
+	MaxRetries int    // Zero means retry forever
+	MaxElapsed uint32 // Zero means no limit
+}
+
+// Each attempt does a single pass over the interfaces
+var defaultRetryPolicy = retryPolicy{
+	BaseDelay: 1,
+	MaxDelay:  uint32(maxDelay / time.Second),
+	Jitter:    0.3,
+}
+
+func (p retryPolicy) retryConfig() zedcloud.RetryConfig {
+	return zedcloud.RetryConfig{
+		BaseDelay:  time.Duration(p.BaseDelay) * time.Second,
+		MaxDelay:   time.Duration(p.MaxDelay) * time.Second,
+		Jitter:     p.Jitter,
+		MaxElapsed: time.Duration(p.MaxElapsed) * time.Second,
+	}
+}
+
+// loadRetryPolicies returns the policy for each step, using the default
+// for the steps which are not in filename. A non-zero maxRetries from the
+// command line overrides the file.
+func loadRetryPolicies(filename string,
+	maxRetries int) map[types.OnboardingPhase]retryPolicy {
+
+	policies := make(map[types.OnboardingPhase]retryPolicy)
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err := json.Unmarshal(b, &policies); err != nil {
+			log.Errorf("Ignoring %s: %s\n", filename, err)
+			policies = make(map[types.OnboardingPhase]retryPolicy)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Errorf("Ignoring %s: %s\n", filename, err)
+	}
+	for _, phase := range []types.OnboardingPhase{types.OnboardingPing,
+		types.OnboardingSelfRegister, types.OnboardingGetUuid} {
+
+		p, ok := policies[phase]
+		if !ok {
+			p = defaultRetryPolicy
+		}
+		if p.MaxDelay == 0 {
+			p.MaxDelay = defaultRetryPolicy.MaxDelay
+		}
+		if maxRetries != 0 {
+			p.MaxRetries = maxRetries
+		}
+		policies[phase] = p
+	}
+	return policies
+}
+
+// onboardingState records the completed steps for a device certificate.
+// A new device certificate starts over.
+type onboardingState struct {
+	DeviceCertHash string
+	Completed      map[types.OnboardingPhase]time.Time
+}
+
+func deviceCertHash(certFilename string) string {
+	b, err := ioutil.ReadFile(certFilename)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func loadOnboardingState(filename string,
+	certFilename string) *onboardingState {
+
+	certHash := deviceCertHash(certFilename)
+	state := onboardingState{}
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		if err := json.Unmarshal(b, &state); err != nil {
+			log.Errorf("Ignoring %s: %s\n", filename, err)
+			state = onboardingState{}
+		}
+	}
+	if state.DeviceCertHash != certHash {
+		if state.DeviceCertHash != "" {
+			log.Infof("Device certificate changed; starting onboarding over\n")
+		}
+		state = onboardingState{DeviceCertHash: certHash}
+	}
+	if state.Completed == nil {
+		state.Completed = make(map[types.OnboardingPhase]time.Time)
+	}
+	return &state
+}
+
+func (state *onboardingState) done(phase types.OnboardingPhase) bool {
+	_, ok := state.Completed[phase]
+	return ok
+}
+
+// complete records the step; written to a temporary file and renamed so
+// that a power loss does not leave a partial file
+func (state *onboardingState) complete(phase types.OnboardingPhase,
+	filename string) {
+
+	state.Completed[phase] = time.Now()
+	b, err := json.Marshal(state)
+	if err != nil {
+		log.Errorf("complete %s: %s\n", phase, err)
+		return
+	}
+	if err := os.MkdirAll(onboardingStateDirname, 0700); err != nil {
+		log.Errorf("complete %s: %s\n", phase, err)
+		return
+	}
+	tmpFilename := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpFilename, b, 0600); err != nil {
+		log.Errorf("complete %s: %s\n", phase, err)
+		return
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		log.Errorf("complete %s: %s\n", phase, err)
+	}
+}
+
+// onboardingStep run returns true when done
+type onboardingStep struct {
+	phase  types.OnboardingPhase
+	policy retryPolicy
+	run    func(retryCount int) bool
+}
+
+// runStep retries with backoff until the step is done. Returns false if
+// the step exceeded its retries or its time budget.
+func runStep(step onboardingStep, progress *onboardingProgress) bool {
+	progress.start(step.phase)
+	retryConfig := step.policy.retryConfig()
+	retryCount := 0
+	done := retryConfig.Retry(step.policy.MaxRetries, step.run,
+		func(count int, delay time.Duration) {
+			retryCount = count
+			progress.retrying(retryCount)
+			log.Infof("Retrying %s in %d seconds\n", step.phase,
+				delay/time.Second)
+		})
+	if !done {
+		log.Errorf("Giving up on %s after %d retries\n",
+			step.phase, retryCount)
+		progress.failed(types.OnboardingRetriesExceeded,
+			progress.status.Error)
+		return false
+	}
+	progress.succeeded()
+	return true
+}
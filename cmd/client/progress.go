@@ -0,0 +1,115 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Onboarding progress for installers and factory tooling. Each change in
+// phase or state is published as OnboardingStatus and, if requested with
+// -P, appended to a file as a JSON line.
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+)
+
+type onboardingProgress struct {
+	pub    *pubsub.Publication
+	out    io.Writer // nil unless requested
+	status types.OnboardingStatus
+}
+
+// newOnboardingProgress writes the JSON lines to filename, or to stdout
+// if filename is "-"
+func newOnboardingProgress(filename string) (*onboardingProgress, error) {
+	pub, err := pubsub.Publish(agentName, types.OnboardingStatus{})
+	if err != nil {
+		return nil, err
+	}
+	p := &onboardingProgress{pub: pub}
+	switch filename {
+	case "":
+	case "-":
+		p.out = os.Stdout
+	default:
+		f, err := os.OpenFile(filename,
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		p.out = f
+	}
+	return p, nil
+}
+
+func (p *onboardingProgress) update() {
+	p.status.UpdateTime = time.Now()
+	log.Infof("Onboarding %s %s %s %s\n", p.status.Phase, p.status.State,
+		p.status.ErrorCode, p.status.Error)
+	if err := p.pub.Publish(p.status.Key(), p.status); err != nil {
+		log.Errorln(err)
+	}
+	if p.out == nil {
+		return
+	}
+	b, err := json.Marshal(p.status)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	b = append(b, '\n')
+	if _, err := p.out.Write(b); err != nil {
+		log.Errorln(err)
+	}
+}
+
+func (p *onboardingProgress) start(phase types.OnboardingPhase) {
+	p.status.Phase = phase
+	p.status.State = types.OnboardingStarted
+	p.status.ErrorCode = types.OnboardingNoError
+	p.status.Error = ""
+	p.status.RetryCount = 0
+	p.update()
+}
+
+// setError records the reason for the next retrying or failed
+func (p *onboardingProgress) setError(code types.OnboardingErrorCode,
+	errStr string) {
+
+	p.status.ErrorCode = code
+	p.status.Error = errStr
+}
+
+func (p *onboardingProgress) retrying(retryCount int) {
+	p.status.State = types.OnboardingRetrying
+	p.status.RetryCount = retryCount
+	p.update()
+}
+
+func (p *onboardingProgress) succeeded() {
+	p.status.State = types.OnboardingSucceeded
+	p.status.ErrorCode = types.OnboardingNoError
+	p.status.Error = ""
+	p.update()
+}
+
+func (p *onboardingProgress) failed(code types.OnboardingErrorCode,
+	errStr string) {
+
+	p.setError(code, errStr)
+	p.status.State = types.OnboardingFailed
+	p.update()
+}
+
+// fatal records the failure before exiting
+func (p *onboardingProgress) fatal(code types.OnboardingErrorCode,
+	err error) {
+
+	p.failed(code, err.Error())
+	log.Fatal(err)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Pre-provisioning from a bundle for factory flows which image many
+// devices identically. The provision operation checks the whole bundle
+// before writing anything, then writes the files in the identity
+// directory which differ from the bundle. A bundle dropped into the
+// identity directory is renamed once applied; one on a USB stick is left
+// alone since it is used for many devices.
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+const provisionBasename = "provision.json"
+
+// provisioningBundle has PEM strings for the certificates and key. Empty
+// fields leave the current files alone.
+type provisioningBundle struct {
+	Serial           string // Sent in selfRegister instead of the hardware serial
+	Server           string // host[:port] of the controller
+	RootCertificate  string
+	OnboardCert      string
+	OnboardKey       string
+	DevicePortConfig *types.DevicePortConfig // Written as override.json
+}
+
+// A file to write in the identity directory
+type provisionFile struct {
+	name     string
+	contents []byte
+	mode     os.FileMode
+}
+
+func readProvisioningBundle(filename string) (*provisioningBundle, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var bundle provisioningBundle
+	if err := json.Unmarshal(b, &bundle); err != nil {
+		errStr := fmt.Sprintf("Malformed %s: %s", filename, err)
+		return nil, errors.New(errStr)
+	}
+	return &bundle, nil
+}
+
+// provisionFiles checks the bundle and returns the files to write
+func provisionFiles(bundle *provisioningBundle) ([]provisionFile, error) {
+	var files []provisionFile
+	if bundle.Serial != "" {
+		files = append(files, provisionFile{name: "serial",
+			contents: []byte(bundle.Serial + "\n"), mode: 0644})
+	}
+	if bundle.Server != "" {
+		if strings.Contains(bundle.Server, "/") {
+			errStr := fmt.Sprintf("Server %s must be host[:port]",
+				bundle.Server)
+			return nil, errors.New(errStr)
+		}
+		files = append(files, provisionFile{name: "server",
+			contents: []byte(bundle.Server + "\n"), mode: 0644})
+	}
+	if bundle.RootCertificate != "" {
+		if err := checkCertificates(bundle.RootCertificate); err != nil {
+			return nil, err
+		}
+		files = append(files, provisionFile{
+			name:     "root-certificate.pem",
+			contents: []byte(bundle.RootCertificate), mode: 0644})
+	}
+	if (bundle.OnboardCert == "") != (bundle.OnboardKey == "") {
+		return nil, errors.New("OnboardCert and OnboardKey must be provided together")
+	}
+	if bundle.OnboardCert != "" {
+		_, err := tls.X509KeyPair([]byte(bundle.OnboardCert),
+			[]byte(bundle.OnboardKey))
+		if err != nil {
+			errStr := fmt.Sprintf("Bad onboarding certificate: %s",
+				err)
+			return nil, errors.New(errStr)
+		}
+		files = append(files,
+			provisionFile{name: "onboard.cert.pem",
+				contents: []byte(bundle.OnboardCert), mode: 0644},
+			provisionFile{name: "onboard.key.pem",
+				contents: []byte(bundle.OnboardKey), mode: 0600})
+	}
+	if bundle.DevicePortConfig != nil {
+		dpc := *bundle.DevicePortConfig
+		if len(dpc.Ports) == 0 {
+			return nil, errors.New("DevicePortConfig has no ports")
+		}
+		if dpc.Key == "" {
+			dpc.Key = "override"
+		}
+		b, err := json.Marshal(dpc)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, provisionFile{
+			name:     "DevicePortConfig/override.json",
+			contents: b, mode: 0644})
+	}
+	return files, nil
+}
+
+func checkCertificates(certsPEM string) error {
+	rest := []byte(certsPEM)
+	count := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			errStr := fmt.Sprintf("Bad root certificate: %s", err)
+			return errors.New(errStr)
+		}
+		count++
+	}
+	if count == 0 {
+		return errors.New("No root certificate in bundle")
+	}
+	return nil
+}
+
+// applyProvisioningBundle writes the files which changed. Each file is
+// written to a temporary file and renamed.
+func applyProvisioningBundle(filename string, identityDirname string) error {
+	bundle, err := readProvisioningBundle(filename)
+	if err != nil {
+		return err
+	}
+	files, err := provisionFiles(bundle)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(identityDirname, f.name)
+		if old, err := ioutil.ReadFile(path); err == nil &&
+			string(old) == string(f.contents) {
+			log.Infof("provision: %s unchanged\n", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		tmpPath := path + ".tmp"
+		if err := ioutil.WriteFile(tmpPath, f.contents, f.mode); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return err
+		}
+		log.Infof("provision: wrote %s\n", path)
+	}
+	if filepath.Dir(filename) == filepath.Clean(identityDirname) {
+		if err := os.Rename(filename, filename+".applied"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
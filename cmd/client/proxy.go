@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// WPAD before onboarding. nim fetches the PAC file on its own schedule,
+// so when we start right after boot the DeviceNetworkStatus might have
+// WPAD enabled but no PAC file yet, and on networks which only allow
+// the proxy we would fail to reach the controller.
+
+package client
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+// discoverProxies fetches the PAC file for the management ports which
+// have WPAD enabled but no PAC file. Failures are reported but not fatal
+// since the controller might be reachable without the proxy.
+func discoverProxies(status *types.DeviceNetworkStatus,
+	progress *onboardingProgress) {
+
+	progress.start(types.OnboardingProxy)
+	var lastErr error
+	for i := range status.Ports {
+		port := &status.Ports[i]
+		if !port.IsMgmt || !port.NetworkProxyEnable ||
+			port.Pacfile != "" {
+			continue
+		}
+		err := devicenetwork.CheckAndGetNetworkProxy(status, port)
+		if err != nil {
+			log.Errorf("discoverProxies(%s): %s\n", port.IfName, err)
+			lastErr = err
+			continue
+		}
+		wpadURL := port.WpadURL
+		if wpadURL == "" {
+			wpadURL = port.NetworkProxyURL
+		}
+		log.Infof("discoverProxies(%s): PAC file from %s\n",
+			port.IfName, wpadURL)
+		progress.status.WpadURL = wpadURL
+	}
+	if lastErr != nil {
+		progress.failed(types.OnboardingProxyError, lastErr.Error())
+	} else {
+		progress.succeeded()
+	}
+}
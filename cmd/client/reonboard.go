@@ -0,0 +1,131 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Re-onboarding with a new identity, e.g., when moving a device to a
+// different enterprise or after a key compromise. The controller allows
+// it by setting the device.reonboard.token config item, and the
+// operator runs the reonboard operation with the same token. We then
+// remove the UUID and the state saved for it, create a new device key
+// and certificate, and selfRegister and getUuid as for a new device.
+// The device must be rebooted afterwards so that all agents use the new
+// identity.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+const checkpointDirname = "/persist/checkpoint"
+
+// State which belongs to the old UUID. We keep the DevicePortConfigList
+// since the network has not changed.
+var reonboardStateNames = []string{
+	onboardingStateFilename,
+	checkpointDirname,
+	pubsub.PersistentDirName("zedmanager") + "/UuidToNum",
+	pubsub.PersistentDirName("zedrouter") + "/UuidToNum",
+}
+
+// checkReonboardToken compares with the token from the controller
+func checkReonboardToken(token string) error {
+	expected, err := types.ReadReonboardToken()
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		return errors.New("Reonboarding not allowed by the controller")
+	}
+	if subtle.ConstantTimeCompare([]byte(token),
+		[]byte(expected)) != 1 {
+		return errors.New("Reonboarding token does not match")
+	}
+	return nil
+}
+
+// wipeIdentity removes the UUID and the related files in identityDirname
+// and the state saved for the UUID
+func wipeIdentity(identityDirname string) error {
+	for _, name := range []string{"uuid", "enterprise", "name"} {
+		filename := identityDirname + "/" + name
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, name := range reonboardStateNames {
+		log.Infof("wipeIdentity: removing %s\n", name)
+		if err := os.RemoveAll(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateDeviceCert replaces the device key and certificate. A key in the
+// TPM is replaced by a new key in the TPM. The new key and certificate
+// are in place before the old key is deleted, hence a failure part way
+// leaves a usable identity.
+func rotateDeviceCert(certFile string, keyFile string) error {
+	tpmFile := zedcloud.DeviceKeyFile(keyFile)
+	if strings.HasSuffix(tpmFile, ".tpm") {
+		return rotateTPMDeviceCert(certFile, tpmFile)
+	}
+	return createDeviceCert(certFile, keyFile)
+}
+
+// createDeviceCert is the same as generate-device.sh. The key is written
+// to a temporary file and renamed so that a power loss does not leave a
+// key without its certificate.
+func createDeviceCert(certFile string, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	tmpKeyFile := keyFile + ".tmp"
+	if err := ioutil.WriteFile(tmpKeyFile, b, 0600); err != nil {
+		return err
+	}
+	tmpCertFile := certFile + ".tmp"
+	if err := writeDeviceCert(tmpCertFile, key.Public(), key); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpKeyFile, keyFile); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpCertFile, certFile); err != nil {
+		return err
+	}
+	log.Infof("Wrote %s and %s\n", certFile, keyFile)
+	return nil
+}
+
+// reonboard prepares for selfRegister with a new device certificate
+func reonboard(identityDirname string, token string) error {
+	if err := checkReonboardToken(token); err != nil {
+		return err
+	}
+	if err := wipeIdentity(identityDirname); err != nil {
+		return err
+	}
+	return rotateDeviceCert(identityDirname+"/device.cert.pem",
+		identityDirname+"/device.key.pem")
+}
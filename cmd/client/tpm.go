@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Device key in the TPM. The tpmDeviceCert operation creates the key and
+// a self-signed device certificate.
+// XXX no attestation quote is sent when self-registering since the
+// controller API has no message or endpoint for one yet.
+
+package client
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/tpm"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+const deviceCertLifetime = 20 * 365 * 24 * time.Hour
+
+// createTPMDeviceCert creates the key unless it already exists, e.g.,
+// from an attempt which did not finish, and writes the certificate and
+// the handle file for keyFile
+func createTPMDeviceCert(certFile string, keyFile string) error {
+	handle := uint32(tpm.DeviceKeyHandle)
+	pub, err := tpm.ReadPublic(handle)
+	if err != nil {
+		log.Infof("Creating device key in TPM\n")
+		pub, err = tpm.CreateDeviceKey(handle)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Infof("Using existing device key in TPM\n")
+	}
+	signer, err := tpm.NewSigner(handle)
+	if err != nil {
+		return err
+	}
+	if err := writeDeviceCert(certFile, pub, signer); err != nil {
+		return err
+	}
+	tpmFile := zedcloud.TPMKeyFile(keyFile)
+	if err := zedcloud.WriteTPMKeyFile(tpmFile, handle); err != nil {
+		return err
+	}
+	log.Infof("Wrote %s and %s\n", certFile, tpmFile)
+	return nil
+}
+
+// rotateTPMDeviceCert creates a new key at the other device key handle,
+// switches the certificate and the handle file in tpmFile to it, and
+// then deletes the old key
+func rotateTPMDeviceCert(certFile string, tpmFile string) error {
+	oldHandle, err := zedcloud.ReadTPMKeyFile(tpmFile)
+	if err != nil {
+		return err
+	}
+	handle := uint32(tpm.DeviceKeyHandle)
+	if oldHandle == handle {
+		handle = tpm.AltDeviceKeyHandle
+	}
+	// Left over from a rotation which did not finish
+	if _, err := tpm.ReadPublic(handle); err == nil {
+		log.Infof("Deleting unused TPM key 0x%x\n", handle)
+		if err := tpm.DeleteKey(handle); err != nil {
+			return err
+		}
+	}
+	log.Infof("Creating device key in TPM at 0x%x\n", handle)
+	pub, err := tpm.CreateDeviceKey(handle)
+	if err != nil {
+		return err
+	}
+	signer, err := tpm.NewSigner(handle)
+	if err != nil {
+		return err
+	}
+	tmpCertFile := certFile + ".tmp"
+	if err := writeDeviceCert(tmpCertFile, pub, signer); err != nil {
+		return err
+	}
+	tmpTPMFile := tpmFile + ".tmp"
+	if err := zedcloud.WriteTPMKeyFile(tmpTPMFile, handle); err != nil {
+		return err
+	}
+	// A power loss between the renames leaves a certificate which
+	// does not match the key; LoadKeyPair reports that and the
+	// reonboard operation can be run again.
+	if err := os.Rename(tmpTPMFile, tpmFile); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpCertFile, certFile); err != nil {
+		return err
+	}
+	log.Infof("Wrote %s and %s\n", certFile, tpmFile)
+	if err := tpm.DeleteKey(oldHandle); err != nil {
+		// The new identity is in place; just a leaked key
+		log.Errorf("Deleting old TPM key 0x%x failed: %s\n",
+			oldHandle, err)
+	}
+	return nil
+}
+
+// writeDeviceCert writes a self-signed certificate for the key
+func writeDeviceCert(certFile string, pub crypto.PublicKey,
+	signer crypto.Signer) error {
+
+	serial, err := rand.Int(rand.Reader,
+		new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	// Same subject as generate-device.sh
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Country:      []string{"US"},
+			Province:     []string{"California"},
+			Locality:     []string{"Santa Clara"},
+			Organization: []string{"Zededa, Inc"},
+			CommonName:   "device",
+		},
+		NotBefore: now,
+		NotAfter:  now.Add(deviceCertLifetime),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template,
+		pub, signer)
+	if err != nil {
+		return err
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return ioutil.WriteFile(certFile, b, 0644)
+}
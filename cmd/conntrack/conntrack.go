@@ -1,43 +1,165 @@
 // Copyright (c) 2019 Zededa, Inc.
 // SPDX-License-Identifier: Apache-2.0
 
+// Dump or watch the conntrack table, optionally filtered, as text or
+// JSON, or delete the flows which match the filter.
+// Usage: conntrack [flags] [list|delete]
+
 package conntrack
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/eriknordmark/netlink"
-	log "github.com/sirupsen/logrus"
+	"os"
 	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/conntrack"
 )
 
 func Run() {
 	// XXX curpartPtr := flag.String("c", "", "Current partition")
+	protoPtr := flag.String("p", "", "Protocol name or number")
+	srcPtr := flag.String("s", "", "Source address or subnet")
+	dstPtr := flag.String("d", "", "Destination address or subnet")
+	portPtr := flag.Uint("P", 0, "Source or destination port")
+	bridgePtr := flag.String("b", "", "App bridge e.g., bn1")
+	zonePtr := flag.Uint("z", 0, "Conntrack zone i.e., the bridge number")
+	jsonPtr := flag.Bool("j", false, "JSON output")
+	watchPtr := flag.Bool("w", false, "Watch new and destroyed flows")
+	updatesPtr := flag.Bool("u", false, "Also watch updated flows")
 	flag.Parse()
-	// XXX args := flag.Args()
+	args := flag.Args()
 	// XXX curpart := *curpartPtr
-	res, err := netlink.ConntrackTableList(netlink.ConntrackTable, syscall.AF_INET)
+
+	filter, err := makeFilter(*protoPtr, *srcPtr, *dstPtr, *portPtr,
+		*bridgePtr, *zonePtr)
 	if err != nil {
-		log.Println("ContrackTableList", err)
-	} else {
-		for i, entry := range res {
-			fmt.Printf("[%d]: %s\n", i, entry.String())
-			fmt.Printf("[%d]: forward packets %d bytes %d\n", i,
-				entry.Forward.Packets, entry.Forward.Bytes)
-			fmt.Printf("[%d]: reverse packets %d bytes %d\n", i,
-				entry.Reverse.Packets, entry.Reverse.Bytes)
+		log.Fatal(err)
+	}
+	verb := "list"
+	if len(args) > 0 {
+		verb = args[0]
+	}
+	switch verb {
+	case "list":
+	case "delete":
+		// Require a filter since the zero filter matches all flows
+		if filter.Empty() {
+			log.Fatal("delete requires a filter\n")
+		}
+		count, err := conntrack.Delete(syscall.AF_UNSPEC, filter)
+		if err != nil {
+			log.Fatalf("conntrack.Delete: %s\n", err)
+		}
+		fmt.Printf("Deleted %d flows\n", count)
+		return
+	default:
+		log.Fatalf("Unknown verb %s\n", verb)
+	}
+	if *watchPtr {
+		watch(filter, *updatesPtr, *jsonPtr)
+		return
+	}
+	flows, err := conntrack.List(syscall.AF_UNSPEC)
+	if err != nil {
+		log.Fatalf("conntrack.List: %s\n", err)
+	}
+	matched := []conntrack.Flow{}
+	for _, flow := range flows {
+		if filter.Match(flow) {
+			matched = append(matched, flow)
+		}
+	}
+	if *jsonPtr {
+		b, err := json.MarshalIndent(matched, "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	for i, flow := range matched {
+		fmt.Printf("[%d]: %s\n", i, flow)
+	}
+	fmt.Printf("%d of %d flows\n", len(matched), len(flows))
+}
+
+func makeFilter(proto string, src string, dst string, port uint,
+	bridge string, zone uint) (conntrack.Filter, error) {
+
+	var filter conntrack.Filter
+	var err error
+	if proto != "" {
+		filter.Protocol, err = conntrack.ParseProto(proto)
+		if err != nil {
+			return filter, err
 		}
 	}
-	res, err = netlink.ConntrackTableList(netlink.ConntrackTable, syscall.AF_INET6)
+	if src != "" {
+		filter.Src, err = conntrack.ParseIPNet(src)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if dst != "" {
+		filter.Dst, err = conntrack.ParseIPNet(dst)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if port > 65535 {
+		errStr := fmt.Sprintf("Bad port %d", port)
+		return filter, errors.New(errStr)
+	}
+	filter.Port = uint16(port)
+	if zone > 65535 {
+		errStr := fmt.Sprintf("Bad zone %d", zone)
+		return filter, errors.New(errStr)
+	}
+	filter.Zone = uint16(zone)
+	if bridge != "" {
+		filter.Subnets, err = conntrack.InterfaceSubnets(bridge)
+		if err != nil {
+			return filter, err
+		}
+		if len(filter.Subnets) == 0 {
+			errStr := fmt.Sprintf("No addresses on %s", bridge)
+			return filter, errors.New(errStr)
+		}
+	}
+	return filter, nil
+}
+
+// watch streams the events until killed; one JSON object per line
+// if asJSON
+func watch(filter conntrack.Filter, updates bool, asJSON bool) {
+	w, err := conntrack.Watch(updates)
 	if err != nil {
-		log.Println("ContrackTableList", err)
-	} else {
-		for i, entry := range res {
-			fmt.Printf("[%d]: %s\n", i, entry.String())
-			fmt.Printf("[%d]: forward packets %d bytes %d\n", i,
-				entry.Forward.Packets, entry.Forward.Bytes)
-			fmt.Printf("[%d]: reverse packets %d bytes %d\n", i,
-				entry.Reverse.Packets, entry.Reverse.Bytes)
+		log.Fatalf("conntrack.Watch: %s\n", err)
+	}
+	defer w.Close()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		events, err := w.Receive()
+		if err == syscall.ENOBUFS {
+			log.Warnf("Lost conntrack events\n")
+		} else if err != nil {
+			log.Fatalf("Receive: %s\n", err)
+		}
+		for _, ev := range events {
+			if !filter.Match(ev.Flow) {
+				continue
+			}
+			if asJSON {
+				if err := enc.Encode(ev); err != nil {
+					log.Errorln(err)
+				}
+				continue
+			}
+			fmt.Printf("[%s] %s\n", ev.Type, ev.Flow)
 		}
 	}
 }
@@ -184,7 +184,11 @@ func handleGlobalConfigDelete(ctxArg interface{}, key string,
 func handleExpModify(ctxArg interface{}, key string, statusArg interface{}) {
 	ctx := ctxArg.(*dptypes.DataplaneContext)
 
-	status := cast.CastLispDataplaneConfig(statusArg)
+	status, err := cast.CastLispDataplaneConfig(statusArg)
+	if err != nil {
+		log.Errorf("handleExpModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Infof("handleExpModify: ignoring %s", key)
 		return
@@ -379,7 +383,11 @@ var deviceNetworkStatus types.DeviceNetworkStatus
 
 func handleDNSModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 
 	if key != "global" {
 		log.Infof("ETR: handleDNSModify: ignoring %s", key)
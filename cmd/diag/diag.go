@@ -6,12 +6,12 @@
 package diag
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"flag"
 	"fmt"
 	"github.com/eriknordmark/ipinfo"
-	"github.com/google/go-cmp/cmp"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/agentlog"
 	"github.com/zededa/go-provision/cast"
@@ -21,10 +21,10 @@ import (
 	"github.com/zededa/go-provision/types"
 	"github.com/zededa/go-provision/zedcloud"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -36,12 +36,13 @@ const (
 	DNCDirname      = tmpDirname + "/DeviceNetworkConfig"
 	identityDirname = "/config"
 	selfRegFile     = identityDirname + "/self-register-failed"
-	serverFileName  = identityDirname + "/server"
 	deviceCertName  = identityDirname + "/device.cert.pem"
 	deviceKeyName   = identityDirname + "/device.key.pem"
 	onboardCertName = identityDirname + "/onboard.cert.pem"
 	onboardKeyName  = identityDirname + "/onboard.key.pem"
 	maxRetries      = 5
+	// How long to wait for nim's persisted DevicePortConfigList
+	dpcListTimeout = 30 * time.Second
 )
 
 // State passed to handlers
@@ -50,19 +51,24 @@ type diagContext struct {
 	DevicePortConfigList    *types.DevicePortConfigList
 	forever                 bool // Keep on reporting until ^C
 	pacContents             bool // Print PAC file contents
-	ledCounter              int
-	derivedLedCounter       int // Based on ledCounter + usableAddressCount
+	suggest                 bool // Print a suggested override.json
+	deviceState             types.DeviceStateCode
+	derivedState            types.DeviceStateCode // Based on deviceState + usableAddressCount
 	subGlobalConfig         *pubsub.Subscription
 	subLedBlinkCounter      *pubsub.Subscription
 	subDeviceNetworkStatus  *pubsub.Subscription
 	subDevicePortConfigList *pubsub.Subscription
+	subHardwareInventory    *pubsub.Subscription
+	subBaseOsPartition      *pubsub.Subscription
+	subZedcloudMetrics      *pubsub.Subscription
 	gotBC                   bool
 	gotDNS                  bool
-	gotDPCList              bool
 	serverNameAndPort       string
 	serverName              string // Without port number
 	zedcloudCtx             *zedcloud.ZedCloudContext
 	cert                    *tls.Certificate
+	testCtx                 context.Context // Cancelled by the next printOutput
+	portResults             []*portResult   // From the last printOutput
 }
 
 // Set from Makefile
@@ -73,6 +79,13 @@ var debugOverride bool // From command line arg
 var simulateDnsFailure = false
 var simulatePingFailure = false
 
+// Retry every second up to maxRetries since the user is waiting for the
+// output
+var retryConfig = zedcloud.RetryConfig{
+	BaseDelay: time.Second,
+	MaxDelay:  time.Second,
+}
+
 func Run() {
 	versionPtr := flag.Bool("v", false, "Version")
 	debugPtr := flag.Bool("d", false, "Debug flag")
@@ -80,6 +93,7 @@ func Run() {
 	stdoutPtr := flag.Bool("s", false, "Use stdout")
 	foreverPtr := flag.Bool("f", false, "Forever flag")
 	pacContentsPtr := flag.Bool("p", false, "Print PAC file contents")
+	suggestPtr := flag.Bool("suggest", false, "Print a suggested override.json")
 	simulateDnsFailurePtr := flag.Bool("D", false, "simulateDnsFailure flag")
 	simulatePingFailurePtr := flag.Bool("P", false, "simulatePingFailure flag")
 	flag.Parse()
@@ -112,26 +126,26 @@ func Run() {
 	ctx := diagContext{
 		forever:     *foreverPtr,
 		pacContents: *pacContentsPtr,
+		suggest:     *suggestPtr,
 	}
 	ctx.DeviceNetworkStatus = &types.DeviceNetworkStatus{}
 	ctx.DevicePortConfigList = &types.DevicePortConfigList{}
 
-	// XXX should we subscribe to and get GlobalConfig for debug??
-
-	server, err := ioutil.ReadFile(serverFileName)
+	servers, err := zedcloud.NewServerList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	ctx.serverNameAndPort = strings.TrimSpace(string(server))
-	ctx.serverName = strings.Split(ctx.serverNameAndPort, ":")[0]
+	ctx.serverNameAndPort = servers.Current()
+	ctx.serverName = servers.CurrentHost()
 
 	zedcloudCtx := zedcloud.ZedCloudContext{
 		DeviceNetworkStatus: ctx.DeviceNetworkStatus,
 		FailureFunc:         zedcloud.ZedCloudFailure,
 		SuccessFunc:         zedcloud.ZedCloudSuccess,
 	}
-	if fileExists(deviceCertName) && fileExists(deviceKeyName) {
-		cert, err := tls.LoadX509KeyPair(deviceCertName,
+	if fileExists(deviceCertName) &&
+		fileExists(zedcloud.DeviceKeyFile(deviceKeyName)) {
+		cert, err := zedcloud.LoadKeyPair(deviceCertName,
 			deviceKeyName)
 		if err != nil {
 			log.Fatal(err)
@@ -170,13 +184,25 @@ func Run() {
 	ctx.subLedBlinkCounter = subLedBlinkCounter
 	subLedBlinkCounter.Activate()
 
+	// XXX should we also use GlobalConfig for debug??
+	subGlobalConfig, err := pubsub.Subscribe("", types.GlobalConfig{},
+		false, &ctx)
+	if err != nil {
+		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
+		panic(errStr)
+	}
+	subGlobalConfig.ModifyHandler = handleGlobalConfigModify
+	subGlobalConfig.DeleteHandler = handleGlobalConfigDelete
+	ctx.subGlobalConfig = subGlobalConfig
+	subGlobalConfig.Activate()
+
 	subDeviceNetworkStatus, err := pubsub.Subscribe("nim",
 		types.DeviceNetworkStatus{}, false, &ctx)
 	if err != nil {
 		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
 		panic(errStr)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	ctx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -187,25 +213,67 @@ func Run() {
 		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
 		panic(errStr)
 	}
-	subDevicePortConfigList.ModifyHandler = handleDPCModify
+	subDevicePortConfigList.ModifyDiffHandler = handleDPCModify
+	subDevicePortConfigList.InitialStateHandler = handleDPCInitialState
+	subDevicePortConfigList.InitialStateTimeout = dpcListTimeout
 	ctx.subDevicePortConfigList = subDevicePortConfigList
 	subDevicePortConfigList.Activate()
 
+	subHardwareInventory, err := pubsub.Subscribe("zedagent",
+		types.HardwareInventory{}, false, &ctx)
+	if err != nil {
+		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
+		panic(errStr)
+	}
+	ctx.subHardwareInventory = subHardwareInventory
+	subHardwareInventory.Activate()
+
+	subBaseOsPartition, err := pubsub.Subscribe("baseosmgr",
+		types.BaseOsPartitionStatus{}, false, &ctx)
+	if err != nil {
+		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
+		panic(errStr)
+	}
+	ctx.subBaseOsPartition = subBaseOsPartition
+	subBaseOsPartition.Activate()
+
+	// Merged from all agents by zedagent
+	subZedcloudMetrics, err := pubsub.Subscribe("zedagent",
+		zedcloud.GetCloudMetrics(), false, &ctx)
+	if err != nil {
+		errStr := fmt.Sprintf("ERROR: internal Subscribe failed %s\n", err)
+		panic(errStr)
+	}
+	ctx.subZedcloudMetrics = subZedcloudMetrics
+	subZedcloudMetrics.Activate()
+
 	for {
 		select {
 		case change := <-subLedBlinkCounter.C:
 			ctx.gotBC = true
 			subLedBlinkCounter.ProcessChange(change)
 
+		case change := <-subGlobalConfig.C:
+			subGlobalConfig.ProcessChange(change)
+
 		case change := <-subDeviceNetworkStatus.C:
 			ctx.gotDNS = true
 			subDeviceNetworkStatus.ProcessChange(change)
 
 		case change := <-subDevicePortConfigList.C:
-			ctx.gotDPCList = true
 			subDevicePortConfigList.ProcessChange(change)
+
+		case change := <-subHardwareInventory.C:
+			subHardwareInventory.ProcessChange(change)
+
+		case change := <-subBaseOsPartition.C:
+			subBaseOsPartition.ProcessChange(change)
+
+		case change := <-subZedcloudMetrics.C:
+			subZedcloudMetrics.ProcessChange(change)
 		}
-		if !ctx.forever && ctx.gotDNS && ctx.gotBC && ctx.gotDPCList {
+		if !ctx.forever && ctx.gotDNS && ctx.gotBC &&
+			subDevicePortConfigList.InitialStateDone() {
 			break
 		}
 	}
@@ -226,10 +294,45 @@ func AAExists(model string) bool {
 	return fileExists(AAFilename)
 }
 
+// The OCSP policy applies to the following requests
+func handleGlobalConfigModify(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	ctx := ctxArg.(*diagContext)
+	if key != "global" {
+		log.Infof("handleGlobalConfigModify: ignoring %s\n", key)
+		return
+	}
+	status, err := cast.CastGlobalConfig(statusArg)
+	if err != nil {
+		log.Errorf("handleGlobalConfigModify: %s\n", err)
+		return
+	}
+	gc := types.ApplyGlobalConfig(status)
+	ctx.zedcloudCtx.OCSPPolicy = gc.OCSPPolicy
+	log.Infof("handleGlobalConfigModify done for %s\n", key)
+}
+
+func handleGlobalConfigDelete(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	ctx := ctxArg.(*diagContext)
+	if key != "global" {
+		log.Infof("handleGlobalConfigDelete: ignoring %s\n", key)
+		return
+	}
+	ctx.zedcloudCtx.OCSPPolicy = types.GlobalConfigDefaults.OCSPPolicy
+	log.Infof("handleGlobalConfigDelete done for %s\n", key)
+}
+
 func handleLedBlinkModify(ctxArg interface{}, key string,
 	configArg interface{}) {
 
-	config := cast.CastLedBlinkCounter(configArg)
+	config, err := cast.CastLedBlinkCounter(configArg)
+	if err != nil {
+		log.Errorf("handleLedBlinkModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*diagContext)
 
 	if key != "ledconfig" {
@@ -237,44 +340,52 @@ func handleLedBlinkModify(ctxArg interface{}, key string,
 		return
 	}
 	// Supress work and logging if no change
-	if config.BlinkCounter == ctx.ledCounter {
+	if config.DeviceState == ctx.deviceState {
 		return
 	}
-	ctx.ledCounter = config.BlinkCounter
-	ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+	ctx.deviceState = config.DeviceState
+	ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 		ctx.UsableAddressCount)
-	log.Infof("counter %d usableAddr %d, derived %d\n",
-		ctx.ledCounter, ctx.UsableAddressCount, ctx.derivedLedCounter)
+	log.Infof("state %s usableAddr %d, derived %s\n",
+		ctx.deviceState, ctx.UsableAddressCount, ctx.derivedState)
 	// XXX wait in case we get another handle call?
 	// XXX set output sched in ctx; print one second later?
 	printOutput(ctx)
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*diagContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
 		return
 	}
 	log.Infof("handleDNSModify for %s\n", key)
-	if cmp.Equal(ctx.DeviceNetworkStatus, status) {
-		log.Infof("handleDNSModify unchanged\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(ctx.DeviceNetworkStatus, status))
 	*ctx.DeviceNetworkStatus = status
 	newAddrCount := types.CountLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus)
 	log.Infof("handleDNSModify %d usable addresses\n", newAddrCount)
 	if (ctx.UsableAddressCount == 0 && newAddrCount != 0) ||
 		(ctx.UsableAddressCount != 0 && newAddrCount == 0) {
 		ctx.UsableAddressCount = newAddrCount
-		ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+		ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 			ctx.UsableAddressCount)
-		log.Infof("counter %d usableAddr %d, derived %d\n",
-			ctx.ledCounter, ctx.UsableAddressCount, ctx.derivedLedCounter)
+		log.Infof("state %s usableAddr %d, derived %s\n",
+			ctx.deviceState, ctx.UsableAddressCount, ctx.derivedState)
 	}
 	// XXX can we limit to interfaces which changed?
 	// XXX wait in case we get another handle call?
@@ -299,10 +410,10 @@ func handleDNSDelete(ctxArg interface{}, key string,
 	if (ctx.UsableAddressCount == 0 && newAddrCount != 0) ||
 		(ctx.UsableAddressCount != 0 && newAddrCount == 0) {
 		ctx.UsableAddressCount = newAddrCount
-		ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+		ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 			ctx.UsableAddressCount)
-		log.Infof("counter %d usableAddr %d, derived %d\n",
-			ctx.ledCounter, ctx.UsableAddressCount, ctx.derivedLedCounter)
+		log.Infof("state %s usableAddr %d, derived %s\n",
+			ctx.deviceState, ctx.UsableAddressCount, ctx.derivedState)
 	}
 	// XXX wait in case we get another handle call?
 	// XXX set output sched in ctx; print one second later?
@@ -310,20 +421,29 @@ func handleDNSDelete(ctxArg interface{}, key string,
 	log.Infof("handleDNSDelete done for %s\n", key)
 }
 
-func handleDPCModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDPCModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDevicePortConfigList(statusArg)
+	status, err := cast.CastDevicePortConfigList(statusArg)
+	if err != nil {
+		log.Errorf("handleDPCModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*diagContext)
 	if key != "global" {
 		log.Infof("handleDPCModify: ignoring %s\n", key)
 		return
 	}
 	log.Infof("handleDPCModify for %s\n", key)
-	if cmp.Equal(ctx.DevicePortConfigList, status) {
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDevicePortConfigList(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDPCModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDPCModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDPCModify: changed %v",
-		cmp.Diff(ctx.DevicePortConfigList, status))
 	*ctx.DevicePortConfigList = status
 	// XXX can we limit to interfaces which changed?
 	// XXX exclude if only timestamps changed?
@@ -333,19 +453,88 @@ func handleDPCModify(ctxArg interface{}, key string, statusArg interface{}) {
 	log.Infof("handleDPCModify done for %s\n", key)
 }
 
+// Called once nim's DevicePortConfigList has been read, or found not to
+// exist, or after dpcListTimeout
+func handleDPCInitialState(ctxArg interface{}, count int, timedOut bool) {
+
+	ctx := ctxArg.(*diagContext)
+	if timedOut {
+		fmt.Printf("WARNING: no DevicePortConfigList from nim after %v\n",
+			dpcListTimeout)
+	} else if count == 0 {
+		fmt.Printf("WARNING: nim has not saved a DevicePortConfigList\n")
+	}
+	printOutput(ctx)
+}
+
+// The inventory is published by zedagent hence might not be there yet
+func printHardwareInventory(ctx *diagContext) {
+	item, err := ctx.subHardwareInventory.Get("global")
+	if err != nil {
+		return
+	}
+	inventory, err := cast.CastHardwareInventory(item)
+	if err != nil {
+		log.Errorf("printHardwareInventory: %s\n", err)
+		return
+	}
+	for _, line := range strings.Split(inventory.Summary(), "\n") {
+		fmt.Printf("INFO: hardware %s\n", line)
+	}
+}
+
+func printBaseOsPartitions(ctx *diagContext) {
+	for _, partName := range []string{"IMGA", "IMGB"} {
+		item, err := ctx.subBaseOsPartition.Get(partName)
+		if err != nil {
+			continue
+		}
+		status, err := cast.CastBaseOsPartitionStatus(item)
+		if err != nil {
+			log.Errorf("printBaseOsPartitions: %s\n", err)
+			continue
+		}
+		current := ""
+		if status.CurrentPartition {
+			current = " (current)"
+		}
+		buildDate := "unknown"
+		if !status.BuildDate.IsZero() {
+			buildDate = status.BuildDate.Format(time.RFC3339)
+		}
+		checksum := status.Checksum
+		if checksum == "" {
+			checksum = "unknown"
+		}
+		fmt.Printf("INFO: partition %s%s %s version %s built %s sha256 %s\n",
+			status.PartitionLabel, current, status.PartitionState,
+			status.ShortVersion, buildDate, checksum)
+	}
+}
+
 // Print output for all interfaces
 // XXX can we limit to interfaces which changed?
 func printOutput(ctx *diagContext) {
 
-	// Defer until we have an initial BlinkCounter and DeviceNetworkStatus
-	if !ctx.gotDNS || !ctx.gotBC || !ctx.gotDPCList {
+	// Defer until we have an initial DeviceState and DeviceNetworkStatus
+	if !ctx.gotDNS || !ctx.gotBC ||
+		!ctx.subDevicePortConfigList.InitialStateDone() {
 		return
 	}
 
+	ctx.testCtx = devicenetwork.VerifyContext(&ctx.DeviceNetworkContext)
 	fmt.Printf("\nINFO: updated diag information at %v\n",
 		time.Now().Format(time.RFC3339Nano))
 	savedHardwareModel := hardware.GetHardwareModelOverride()
-	hardwareModel := hardware.GetHardwareModelNoOverride()
+	modelInfo := hardware.GetHardwareModelInfoNoOverride()
+	hardwareModel := modelInfo.Model
+	fmt.Printf("INFO: model %s from %s vendor %s product %s serial %s\n",
+		hardwareModel, modelInfo.Source, modelInfo.Vendor,
+		modelInfo.Product, modelInfo.Serial)
+	fmt.Printf("INFO: serial number %s asset tag %s\n",
+		hardware.GetSerialNumber(), hardware.GetAssetTag())
+	printHardwareInventory(ctx)
+	printBaseOsPartitions(ctx)
 	if savedHardwareModel != "" && savedHardwareModel != hardwareModel {
 		fmt.Printf("INFO: dmidecode model string %s overridden as %s\n",
 			hardwareModel, savedHardwareModel)
@@ -376,28 +565,28 @@ func printOutput(ctx *diagContext) {
 		// XXX print onboarding cert
 	}
 
-	switch ctx.derivedLedCounter {
-	case 0:
-		fmt.Printf("ERROR: Summary: Unknown LED counter 0\n")
-	case 1:
+	switch ctx.derivedState {
+	case types.DeviceStateUnknown:
+		fmt.Printf("ERROR: Summary: Unknown device state\n")
+	case types.DeviceStateNoDHCP:
 		fmt.Printf("ERROR: Summary: Waiting for DHCP IP address(es)\n")
-	case 2:
+	case types.DeviceStateConnectingController:
 		fmt.Printf("ERROR: Summary: Trying to connect to EV Controller\n")
-	case 3:
+	case types.DeviceStateConnected:
 		fmt.Printf("WARNING: Summary: Connected to EV Controller but not onboarded\n")
-	case 4:
+	case types.DeviceStateOnboarded:
 		fmt.Printf("INFO: Summary: Connected to EV Controller and onboarded\n")
-	case 10:
+	case types.DeviceStateOnboardConflict:
 		fmt.Printf("ERROR: Summary: Onboarding failure or conflict\n")
-	case 11:
+	case types.DeviceStateNoModel:
 		fmt.Printf("ERROR: Summary: Missing /var/tmp/zededa/DeviceNetworkConfig/ model file\n")
-	case 12:
+	case types.DeviceStateNoTLS:
 		fmt.Printf("ERROR: Summary: Response without TLS - ignored\n")
-	case 13:
+	case types.DeviceStateBadOCSP:
 		fmt.Printf("ERROR: Summary: Response without OSCP or bad OSCP - ignored\n")
 	default:
-		fmt.Printf("ERROR: Summary: Unsupported LED counter %d\n",
-			ctx.derivedLedCounter)
+		fmt.Printf("ERROR: Summary: Unsupported device state %s\n",
+			ctx.derivedState)
 	}
 
 	testing := ctx.DeviceNetworkStatus.Testing
@@ -444,6 +633,19 @@ func printOutput(ctx *diagContext) {
 			}
 		}
 	}
+	dns := ctx.DeviceNetworkStatus
+	if dns.DPCKey != "" {
+		fmt.Printf("INFO: Port status is from DevicePortConfig key %s priority %s\n",
+			dns.DPCKey, dns.TimePriority.Format(time.RFC3339Nano))
+		if !dns.LastSucceeded.IsZero() {
+			fmt.Printf("INFO: DevicePortConfig last succeeded at %s\n",
+				dns.LastSucceeded.Format(time.RFC3339Nano))
+		}
+		if dns.LastFailed.After(dns.LastSucceeded) {
+			fmt.Printf("WARNING: DevicePortConfig last failed at %s\n",
+				dns.LastFailed.Format(time.RFC3339Nano))
+		}
+	}
 	if testing {
 		fmt.Printf("WARNING: The configuration below is under test hence might report failures\n")
 	}
@@ -454,6 +656,7 @@ func printOutput(ctx *diagContext) {
 
 	numMgmtPorts := len(types.GetMgmtPortsAny(*ctx.DeviceNetworkStatus, 0))
 	fmt.Printf("INFO: Have %d total ports. %d ports should be connected to EV controller\n", numPorts, numMgmtPorts)
+	ctx.portResults = nil
 	for _, port := range ctx.DeviceNetworkStatus.Ports {
 		// Print usefully formatted info based on which
 		// fields are set and Dhcp type; proxy info order
@@ -469,6 +672,8 @@ func printOutput(ctx *diagContext) {
 		if isMgmt {
 			mgmtPorts += 1
 		}
+		result := &portResult{ifname: ifname, isMgmt: isMgmt}
+		ctx.portResults = append(ctx.portResults, result)
 
 		typeStr := "for application use"
 		if isFree {
@@ -513,7 +718,21 @@ func printOutput(ctx *diagContext) {
 			fmt.Printf("INFO: %s: Static NTP server: %s\n",
 				ifname, port.NtpServer.String())
 		}
+		if port.DhcpFallback {
+			fmt.Printf("WARNING: %s: DHCP failed; using fallback static address\n",
+				ifname)
+		}
+		if port.AddrConflict != nil {
+			fmt.Printf("ERROR: %s: %s\n", ifname,
+				port.AddrConflict.String())
+		}
+		if port.Wireless != nil {
+			fmt.Printf("INFO: %s: Wireless %s\n",
+				ifname, port.Wireless.Summary())
+		}
 		printProxy(ctx, port, ifname)
+		printBandwidth(ifname)
+		printCloudHistory(ctx, ifname)
 
 		if !isMgmt {
 			fmt.Printf("INFO: %s: not intended for EV controller; skipping those tests\n",
@@ -523,13 +742,16 @@ func printOutput(ctx *diagContext) {
 		if ipCount == 0 {
 			fmt.Printf("WARNING: %s: No IP address to connect to EV controller\n",
 				ifname)
+			result.noIP = true
 			continue
 		}
 		// DNS lookup, ping and getUuid calls
 		if !tryLookupIP(ctx, ifname) {
+			result.dnsFailed = true
 			continue
 		}
 		if !tryPing(ctx, ifname, "") {
+			result.pingFailed = true
 			fmt.Printf("ERROR: %s: ping failed to %s; trying google\n",
 				ifname, ctx.serverNameAndPort)
 			origServerName := ctx.serverName
@@ -538,6 +760,7 @@ func printOutput(ctx *diagContext) {
 			ctx.serverNameAndPort = ctx.serverName
 			res := tryPing(ctx, ifname, "http://www.google.com")
 			if res {
+				result.internet = true
 				fmt.Printf("WARNING: %s: Can reach http://google.com but not https://%s\n",
 					ifname, origServerNameAndPort)
 			} else {
@@ -546,6 +769,7 @@ func printOutput(ctx *diagContext) {
 			}
 			res = tryPing(ctx, ifname, "https://www.google.com")
 			if res {
+				result.internet = true
 				fmt.Printf("WARNING: %s: Can reach https://google.com but not https://%s\n",
 					ifname, origServerNameAndPort)
 			} else {
@@ -566,8 +790,10 @@ func printOutput(ctx *diagContext) {
 			continue
 		}
 		if !tryGetUuid(ctx, ifname) {
+			result.getUuidFailed = true
 			continue
 		}
+		result.passed = true
 		if isMgmt {
 			passPorts += 1
 		} else {
@@ -587,6 +813,79 @@ func printOutput(ctx *diagContext) {
 		fmt.Printf("WARNING: %d out of %d ports specified to have EV controller connectivity passed test\n",
 			passPorts, mgmtPorts)
 	}
+	if ctx.suggest {
+		printSuggestion(ctx)
+	}
+}
+
+// Print the saved byte counts per category
+func printBandwidth(ifname string) {
+	bw, err := zedcloud.ReadAllBandwidth()
+	if err != nil {
+		fmt.Printf("ERROR: %s: ReadAllBandwidth failed %s\n",
+			ifname, err)
+		return
+	}
+	cats, ok := bw[ifname]
+	if !ok {
+		return
+	}
+	var keys []string
+	for cat := range cats {
+		keys = append(keys, cat)
+	}
+	sort.Strings(keys)
+	for _, cat := range keys {
+		c := cats[cat]
+		fmt.Printf("INFO: %s: %s sent %d bytes received %d bytes\n",
+			ifname, cat, c.SentBytes, c.RecvBytes)
+	}
+}
+
+// printCloudHistory shows the success and failures talking to the
+// controller per HistoryInterval in the past hour
+func printCloudHistory(ctx *diagContext, ifname string) {
+	item, err := ctx.subZedcloudMetrics.Get("global")
+	if err != nil {
+		return
+	}
+	cms := zedcloud.CastCloudMetrics(item)
+	cm, ok := cms[ifname]
+	if !ok {
+		return
+	}
+	history := cm.RecentHistory(time.Now())
+	if len(history) == 0 {
+		fmt.Printf("INFO: %s: no controller connectivity history in the past hour\n",
+			ifname)
+		return
+	}
+	var success, failure uint64
+	lastError := ""
+	for _, i := range history {
+		success += i.SuccessCount
+		failure += i.FailureCount
+		if i.LastError != "" {
+			lastError = i.LastError
+		}
+	}
+	rate := 0.0
+	if success+failure != 0 {
+		rate = 100 * float64(success) / float64(success+failure)
+	}
+	fmt.Printf("INFO: %s: controller connectivity in the past hour: %d successes, %d failures (%.1f%% success)\n",
+		ifname, success, failure, rate)
+	fmt.Printf("INFO: %s:   %-8s %8s %8s\n", ifname, "start",
+		"success", "failure")
+	for _, i := range history {
+		fmt.Printf("INFO: %s:   %-8s %8d %8d\n", ifname,
+			i.Start.Local().Format("15:04"), i.SuccessCount,
+			i.FailureCount)
+	}
+	if failure != 0 && lastError != "" {
+		fmt.Printf("WARNING: %s: last controller failure at %s: %s\n",
+			ifname, cm.LastFailure.Format(time.RFC3339), lastError)
+	}
 }
 
 func printProxy(ctx *diagContext, port types.NetworkPortStatus,
@@ -702,22 +1001,15 @@ func tryPing(ctx *diagContext, ifname string, requrl string) bool {
 	// As we ping the cloud or other URLs, don't affect the LEDs
 	zedcloudCtx.NoLedManager = true
 
-	retryCount := 0
-	done := false
-	var delay time.Duration
-	for !done {
-		time.Sleep(delay)
-		done, _, _ = myGet(zedcloudCtx, requrl, ifname, retryCount)
-		if done {
-			break
-		}
-		retryCount += 1
-		if maxRetries != 0 && retryCount > maxRetries {
-			fmt.Printf("ERROR: %s: Exceeded %d retries for ping\n",
-				ifname, maxRetries)
-			return false
-		}
-		delay = time.Second
+	done := retryConfig.Retry(maxRetries, func(retryCount int) bool {
+		done, _, _ := myGet(ctx.testCtx, zedcloudCtx, requrl, ifname,
+			retryCount)
+		return done
+	}, nil)
+	if !done {
+		fmt.Printf("ERROR: %s: Exceeded %d retries for ping\n",
+			ifname, maxRetries)
+		return false
 	}
 	if simulatePingFailure {
 		fmt.Printf("INFO: %s: Simulate ping failure\n", ifname)
@@ -732,22 +1024,15 @@ func tryGetUuid(ctx *diagContext, ifname string) bool {
 	requrl := ctx.serverNameAndPort + "/api/v1/edgedevice/config"
 	// As we ping the cloud or other URLs, don't affect the LEDs
 	zedcloudCtx.NoLedManager = true
-	retryCount := 0
-	done := false
-	var delay time.Duration
-	for !done {
-		time.Sleep(delay)
-		done, _, _ = myGet(zedcloudCtx, requrl, ifname, retryCount)
-		if done {
-			break
-		}
-		retryCount += 1
-		if maxRetries != 0 && retryCount > maxRetries {
-			fmt.Printf("ERROR: %s: Exceeded %d retries for get config\n",
-				ifname, maxRetries)
-			return false
-		}
-		delay = time.Second
+	done := retryConfig.Retry(maxRetries, func(retryCount int) bool {
+		done, _, _ := myGet(ctx.testCtx, zedcloudCtx, requrl, ifname,
+			retryCount)
+		return done
+	}, nil)
+	if !done {
+		fmt.Printf("ERROR: %s: Exceeded %d retries for get config\n",
+			ifname, maxRetries)
+		return false
 	}
 	return true
 }
@@ -756,8 +1041,8 @@ func tryGetUuid(ctx *diagContext, ifname string) bool {
 // Returns true when done; false when retry.
 // Returns the response when done. Caller can not use resp.Body but
 // can use the contents []byte
-func myGet(zedcloudCtx *zedcloud.ZedCloudContext, requrl string, ifname string,
-	retryCount int) (bool, *http.Response, []byte) {
+func myGet(reqCtx context.Context, zedcloudCtx *zedcloud.ZedCloudContext,
+	requrl string, ifname string, retryCount int) (bool, *http.Response, []byte) {
 
 	var preqUrl string
 	if strings.HasPrefix(requrl, "http:") {
@@ -773,27 +1058,46 @@ func myGet(zedcloudCtx *zedcloud.ZedCloudContext, requrl string, ifname string,
 		fmt.Printf("ERROR: %s: LookupProxy failed: %s\n", ifname, err)
 	} else if proxyUrl != nil {
 		fmt.Printf("INFO: %s: Proxy %s to reach %s\n",
-			ifname, proxyUrl.String(), requrl)
+			ifname, zedcloud.RedactedProxy(proxyUrl), requrl)
 	}
 	const allowProxy = true
-	resp, contents, err := zedcloud.SendOnIntf(*zedcloudCtx,
+	res, err := zedcloud.SendOnIntf(reqCtx, *zedcloudCtx,
 		requrl, ifname, 0, nil, allowProxy, 15)
-	if err != nil {
+	if res.Resp == nil {
 		fmt.Printf("ERROR: %s: get %s failed: %s\n",
 			ifname, requrl, err)
+		for _, attempt := range res.Attempts {
+			fmt.Printf("ERROR: %s: source %v proxy <%s>: %s\n",
+				ifname, attempt.LocalAddr, attempt.Proxy,
+				attempt.Error)
+		}
 		return false, nil, nil
 	}
 
-	switch resp.StatusCode {
+	switch res.StatusCode {
 	case http.StatusOK:
 		fmt.Printf("INFO: %s: %s StatusOK\n", ifname, requrl)
-		return true, resp, contents
+		if res.TLSVersion != 0 {
+			fmt.Printf("INFO: %s: %s using %s resumed %t\n",
+				ifname, requrl, res.Protocol, res.DidResume)
+		}
+		fmt.Printf("INFO: %s: %s connected from %v to %s\n",
+			ifname, requrl, res.LocalAddr, res.RemoteAddr)
+		if res.OCSPStatus != zedcloud.OCSPNotChecked {
+			fmt.Printf("INFO: %s: %s OCSP %s\n",
+				ifname, requrl, res.OCSPStatus)
+		}
+		if res.TrustAnchor != "" {
+			fmt.Printf("INFO: %s: %s validated by %s\n",
+				ifname, requrl, res.TrustAnchor)
+		}
+		return true, res.Resp, res.Contents
 	default:
 		fmt.Printf("ERROR: %s: %s statuscode %d %s\n",
-			ifname, requrl, resp.StatusCode,
-			http.StatusText(resp.StatusCode))
+			ifname, requrl, res.StatusCode,
+			http.StatusText(res.StatusCode))
 		fmt.Printf("ERRROR: %s: Received %s\n",
-			ifname, string(contents))
+			ifname, string(res.Contents))
 		return false, nil, nil
 	}
 }
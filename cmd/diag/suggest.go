@@ -0,0 +1,272 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Suggest an override.json based on the test failures of the management
+// ports, so a field installer does not have to guess what to change.
+// Values we can not determine are left as "<...>" placeholders.
+
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+const overrideFile = "/config/DevicePortConfig/override.json"
+
+// Outcome of the tests for a port in printOutput
+type portResult struct {
+	ifname        string
+	isMgmt        bool
+	noIP          bool
+	dnsFailed     bool
+	pingFailed    bool
+	internet      bool // Could reach google after pingFailed
+	getUuidFailed bool
+	passed        bool
+}
+
+// A suggested port config. Placeholders replace fields of the JSON
+// which are not known
+type portSuggestion struct {
+	original     types.NetworkPortConfig
+	port         types.NetworkPortConfig
+	placeholders map[string]interface{}
+	notes        []string
+}
+
+// modified is true if the suggested port config differs from the current
+func (suggestion portSuggestion) modified() bool {
+	return len(suggestion.placeholders) != 0 ||
+		!reflect.DeepEqual(suggestion.port, suggestion.original)
+}
+
+// printSuggestion prints the changes and the resulting override.json
+func printSuggestion(ctx *diagContext) {
+	passedMgmt := 0
+	for _, result := range ctx.portResults {
+		if result.isMgmt && result.passed {
+			passedMgmt++
+		}
+	}
+	changed := false
+	var suggestions []portSuggestion
+	for _, port := range ctx.DeviceNetworkStatus.Ports {
+		suggestion := suggestPort(ctx, port, passedMgmt)
+		for _, note := range suggestion.notes {
+			fmt.Printf("INFO: Suggest: %s: %s\n", port.IfName, note)
+		}
+		if suggestion.modified() {
+			changed = true
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if !changed {
+		fmt.Printf("INFO: Suggest: no changes to the DevicePortConfig\n")
+		return
+	}
+	var ports []map[string]interface{}
+	for _, suggestion := range suggestions {
+		ports = append(ports, suggestionJSON(suggestion))
+	}
+	dpc := map[string]interface{}{
+		"Version": types.DPCIsMgmt,
+		"Ports":   ports,
+	}
+	fmt.Printf("INFO: Suggest: replace the <...> values and place in %s:\n",
+		overrideFile)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(dpc); err != nil {
+		fmt.Printf("ERROR: Suggest: encode failed: %s\n", err)
+	}
+}
+
+// suggestPort determines the changes for one port based on its status
+// and test result
+func suggestPort(ctx *diagContext, port types.NetworkPortStatus,
+	passedMgmt int) portSuggestion {
+
+	portConfig := lookupPortConfig(ctx, port)
+	suggestion := portSuggestion{
+		original:     portConfig,
+		port:         portConfig,
+		placeholders: make(map[string]interface{}),
+	}
+	result := lookupPortResult(ctx, port.IfName)
+	if result == nil || !result.isMgmt {
+		return suggestion
+	}
+	prefix := "<prefix>"
+	if port.Subnet.IP != nil {
+		ones, _ := port.Subnet.Mask.Size()
+		prefix = fmt.Sprintf("%d", ones)
+	}
+	if port.AddrConflict != nil {
+		if port.Dhcp == types.DT_STATIC {
+			suggestion.placeholders["AddrSubnet"] = "<unused address>/" + prefix
+			suggestion.notes = append(suggestion.notes,
+				fmt.Sprintf("pick a static address not in use; %s",
+					port.AddrConflict.String()))
+		} else {
+			suggestion.notes = append(suggestion.notes,
+				fmt.Sprintf("have the DHCP server fixed; %s",
+					port.AddrConflict.String()))
+		}
+		return suggestion
+	}
+	if result.noIP {
+		if passedMgmt != 0 {
+			suggestion.port.IsMgmt = false
+			suggestion.notes = append(suggestion.notes,
+				"no IP address while other ports work; mark as not for management")
+		} else if port.Dhcp == types.DT_CLIENT {
+			// Only if there is no DHCP server; the address must not
+			// be in the range of one
+			suggestStatic(&suggestion, "<address>/<prefix>", nil)
+			suggestion.notes = append(suggestion.notes,
+				"no address from DHCP; if there is no DHCP server switch to a static address outside of any DHCP range")
+		}
+		return suggestion
+	}
+	if port.DhcpFallback {
+		suggestStatic(&suggestion, suggestion.port.FallbackAddrSubnet,
+			suggestion.port.FallbackGateway)
+		suggestion.notes = append(suggestion.notes,
+			"DHCP failed and the fallback address is in use; switch to it as a static address")
+	}
+	if result.dnsFailed {
+		if port.Dhcp == types.DT_CLIENT && !port.DhcpFallback {
+			// Making the leased address static would conflict with
+			// the DHCP server handing it out again
+			suggestion.notes = append(suggestion.notes,
+				fmt.Sprintf("DNS lookup failed using %v from DHCP; have the DHCP server fixed",
+					port.DnsServers))
+			return suggestion
+		}
+		suggestion.port.DnsServers = nil
+		suggestion.placeholders["DnsServers"] = []string{"<dns server>"}
+		suggestion.notes = append(suggestion.notes,
+			fmt.Sprintf("DNS lookup failed using %v; specify a working DNS server",
+				port.DnsServers))
+		return suggestion
+	}
+	if result.pingFailed {
+		if devicenetwork.IsProxyConfigEmpty(port.ProxyConfig) {
+			suggestion.port.NetworkProxyEnable = true
+			suggestion.notes = append(suggestion.notes,
+				"controller not reachable without a proxy; enable WPAD or set Proxies instead")
+		} else if len(port.Proxies) == 0 && port.Pacfile == "" &&
+			port.WpadURL == "" {
+			suggestion.port.NetworkProxyEnable = false
+			suggestion.placeholders["Proxies"] = []map[string]interface{}{
+				{"Server": "<proxy host>", "Port": "<proxy port>",
+					"Type": types.NPT_HTTPS},
+			}
+			suggestion.notes = append(suggestion.notes,
+				"WPAD found no proxy; specify the https proxy")
+		} else if result.internet {
+			suggestion.notes = append(suggestion.notes,
+				fmt.Sprintf("proxy does not let through %s; add it to the proxy allow list",
+					ctx.serverName))
+		} else {
+			suggestion.notes = append(suggestion.notes,
+				"no connectivity through the configured proxy; check the proxy address and Exceptions")
+		}
+		return suggestion
+	}
+	if result.getUuidFailed {
+		// Not a port config problem
+		fmt.Printf("INFO: Suggest: %s: controller reachable but get config failed; check onboarding and the device certificate\n",
+			port.IfName)
+	}
+	return suggestion
+}
+
+// Make the port static with addrSubnet. The gateway is a placeholder
+// if not known
+func suggestStatic(suggestion *portSuggestion, addrSubnet string,
+	gateway net.IP) {
+
+	suggestion.port.Dhcp = types.DT_STATIC
+	suggestion.port.AddrSubnet = addrSubnet
+	suggestion.port.DhcpTimeout = 0
+	suggestion.port.FallbackAddrSubnet = ""
+	suggestion.port.FallbackGateway = nil
+	if len(gateway) == 0 {
+		suggestion.placeholders["Gateway"] = "<gateway>"
+	} else {
+		suggestion.port.Gateway = gateway
+	}
+	if len(suggestion.port.DnsServers) == 0 {
+		suggestion.placeholders["DnsServers"] = []string{"<dns server>"}
+	}
+}
+
+// The port from the DevicePortConfig used for the DeviceNetworkStatus,
+// or from the status if not found
+func lookupPortConfig(ctx *diagContext,
+	port types.NetworkPortStatus) types.NetworkPortConfig {
+
+	for _, dpc := range ctx.DevicePortConfigList.PortConfigList {
+		if dpc.Key != ctx.DeviceNetworkStatus.DPCKey ||
+			!dpc.TimePriority.Equal(ctx.DeviceNetworkStatus.TimePriority) {
+			continue
+		}
+		for _, portConfig := range dpc.Ports {
+			if portConfig.IfName == port.IfName {
+				return portConfig
+			}
+		}
+	}
+	return types.NetworkPortConfig{
+		IfName:      port.IfName,
+		Name:        port.Name,
+		IsMgmt:      port.IsMgmt,
+		Free:        port.Free,
+		DhcpConfig:  types.DhcpConfig{Dhcp: port.Dhcp},
+		ProxyConfig: port.ProxyConfig,
+	}
+}
+
+func lookupPortResult(ctx *diagContext, ifname string) *portResult {
+	for _, result := range ctx.portResults {
+		if result.ifname == ifname {
+			return result
+		}
+	}
+	return nil
+}
+
+// The JSON fields of the port with the placeholders applied
+func suggestionJSON(suggestion portSuggestion) map[string]interface{} {
+	port := suggestion.port
+	// Not to be printed
+	port.Proxies = append([]types.ProxyEntry{}, port.Proxies...)
+	for i := range port.Proxies {
+		if port.Proxies[i].Password != "" {
+			port.Proxies[i].Password = "<password>"
+		}
+	}
+	fields := make(map[string]interface{})
+	b, err := json.Marshal(port)
+	if err == nil {
+		err = json.Unmarshal(b, &fields)
+	}
+	if err != nil {
+		fmt.Printf("ERROR: Suggest: %s: internal json failed: %s\n",
+			port.IfName, err)
+	}
+	delete(fields, "WpadURL")
+	for key, value := range suggestion.placeholders {
+		fields[key] = value
+	}
+	return fields
+}
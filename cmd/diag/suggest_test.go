@@ -0,0 +1,143 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diag
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+// A diagContext with one management port; the test sets the status and
+// the result
+func testSuggestContext(port types.NetworkPortStatus,
+	result portResult) *diagContext {
+
+	port.IfName = "eth0"
+	port.IsMgmt = true
+	result.ifname = "eth0"
+	result.isMgmt = true
+	return &diagContext{
+		DeviceNetworkStatus: &types.DeviceNetworkStatus{
+			Ports: []types.NetworkPortStatus{port},
+		},
+		DevicePortConfigList: &types.DevicePortConfigList{},
+		portResults:          []*portResult{&result},
+		serverName:           "zedcloud.example.com",
+	}
+}
+
+func hasNote(suggestion portSuggestion, substr string) bool {
+	for _, note := range suggestion.notes {
+		if strings.Contains(note, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSuggestPort(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	dhcpPort := types.NetworkPortStatus{}
+	dhcpPort.Dhcp = types.DT_CLIENT
+	dhcpPort.Subnet = *subnet
+	dhcpPort.DnsServers = []net.IP{net.ParseIP("192.168.1.1")}
+	staticPort := dhcpPort
+	staticPort.Dhcp = types.DT_STATIC
+
+	// No address and no other working port
+	ctx := testSuggestContext(dhcpPort, portResult{noIP: true})
+	suggestion := suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if suggestion.port.Dhcp != types.DT_STATIC ||
+		suggestion.placeholders["Gateway"] == nil ||
+		!hasNote(suggestion, "outside of any DHCP range") {
+		t.Errorf("noIP: got %+v\n", suggestion)
+	}
+
+	// No address while another port works
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 1)
+	if suggestion.port.IsMgmt || suggestion.port.Dhcp != types.DT_CLIENT {
+		t.Errorf("noIP with other port: got %+v\n", suggestion)
+	}
+
+	// Bad DNS server from DHCP is not made static
+	ctx = testSuggestContext(dhcpPort, portResult{dnsFailed: true})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if suggestion.modified() || !hasNote(suggestion, "DHCP server") {
+		t.Errorf("dnsFailed DHCP: got %+v\n", suggestion)
+	}
+
+	// Bad static DNS server
+	ctx = testSuggestContext(staticPort, portResult{dnsFailed: true})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if suggestion.port.DnsServers != nil ||
+		suggestion.placeholders["DnsServers"] == nil {
+		t.Errorf("dnsFailed static: got %+v\n", suggestion)
+	}
+
+	// Static address in use by another host
+	conflictPort := staticPort
+	conflictPort.AddrConflict = &types.AddrConflict{
+		Addr: net.ParseIP("192.168.1.10"), Mac: "00:16:3e:00:01:02"}
+	ctx = testSuggestContext(conflictPort, portResult{})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if suggestion.placeholders["AddrSubnet"] != "<unused address>/24" {
+		t.Errorf("conflict: got %+v\n", suggestion)
+	}
+
+	// Controller not reachable without a proxy
+	ctx = testSuggestContext(dhcpPort, portResult{pingFailed: true})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if !suggestion.port.NetworkProxyEnable {
+		t.Errorf("pingFailed: got %+v\n", suggestion)
+	}
+
+	// Proxy blocks the controller
+	proxyPort := dhcpPort
+	proxyPort.Proxies = []types.ProxyEntry{
+		{Type: types.NPT_HTTPS, Server: "proxy", Port: 3128}}
+	ctx = testSuggestContext(proxyPort,
+		portResult{pingFailed: true, internet: true})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 0)
+	if suggestion.modified() || !hasNote(suggestion, ctx.serverName) {
+		t.Errorf("proxy allow list: got %+v\n", suggestion)
+	}
+
+	// Working port
+	ctx = testSuggestContext(dhcpPort, portResult{passed: true})
+	suggestion = suggestPort(ctx, ctx.DeviceNetworkStatus.Ports[0], 1)
+	if suggestion.modified() || len(suggestion.notes) != 0 {
+		t.Errorf("passed: got %+v\n", suggestion)
+	}
+}
+
+func TestSuggestionJSON(t *testing.T) {
+	port := types.NetworkPortConfig{IfName: "eth0", IsMgmt: true}
+	port.Proxies = []types.ProxyEntry{
+		{Type: types.NPT_HTTPS, Server: "proxy", Port: 3128,
+			Username: "user", Password: "secret"}}
+	port.WpadURL = "http://wpad.example.com/wpad.dat"
+	suggestion := portSuggestion{
+		original:     port,
+		port:         port,
+		placeholders: map[string]interface{}{"Gateway": "<gateway>"},
+	}
+	fields := suggestionJSON(suggestion)
+	proxies := fields["Proxies"].([]interface{})
+	proxy := proxies[0].(map[string]interface{})
+	if proxy["Password"] != "<password>" {
+		t.Errorf("Password printed: %v\n", proxy["Password"])
+	}
+	if port.Proxies[0].Password != "secret" {
+		t.Errorf("Password of the port config changed\n")
+	}
+	if _, ok := fields["WpadURL"]; ok {
+		t.Errorf("WpadURL printed\n")
+	}
+	if fields["Gateway"] != "<gateway>" {
+		t.Errorf("Placeholder not applied: %v\n", fields["Gateway"])
+	}
+}
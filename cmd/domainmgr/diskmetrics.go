@@ -0,0 +1,154 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Periodically collect the sizes of the app disks and of the image
+// directories, and the I/O rates of the disks, for zedagent to report.
+// qemu-img can take a long time on large or busy images, hence the sizes
+// are collected by diskMetricsWorker and only published by the main loop.
+
+package domainmgr
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/diskmetrics"
+	"github.com/zededa/go-provision/types"
+)
+
+// What the worker should look at
+type diskMetricsRequest struct {
+	apps     []types.AppDiskMetric // With only the DiskPath filled in
+	dirnames []string
+}
+
+type diskMetricsResult struct {
+	apps  []types.AppDiskMetric
+	usage types.DiskUsage
+}
+
+// Replaced by the tests
+var getImgInfo = diskmetrics.GetImgInfo
+var dirImgInfo = diskmetrics.DirImgInfo
+var readDiskIOStats = diskmetrics.ReadDiskIOStats
+
+// The I/O rates are computed against the previous sample taken by the
+// worker
+func diskMetricsWorker(requests <-chan diskMetricsRequest,
+	results chan<- diskMetricsResult) {
+
+	var prevIOStats []types.DiskIOStats
+	for req := range requests {
+		res := collectDiskMetrics(req)
+		ioStats, err := readDiskIOStats()
+		if err != nil {
+			log.Errorf("diskMetricsWorker: %s\n", err)
+		} else {
+			diskmetrics.SetDiskIORates(ioStats, prevIOStats)
+			prevIOStats = ioStats
+			res.usage.IOStats = ioStats
+		}
+		results <- res
+	}
+}
+
+// requestDiskMetrics hands the disks of the current domains to the worker
+// unless it is still busy with the previous request. Returns false if it
+// was busy.
+func requestDiskMetrics(ctx *domainContext) bool {
+
+	log.Debugf("requestDiskMetrics()\n")
+	req := diskMetricsRequest{
+		dirnames: []string{rwImgDirname, verifiedDirname},
+	}
+	for _, st := range ctx.pubDomainStatus.GetAll() {
+		status, err := cast.CastDomainStatus(st)
+		if err != nil {
+			log.Errorf("requestDiskMetrics: %s\n", err)
+			continue
+		}
+		app := types.AppDiskMetric{
+			UUIDandVersion: status.UUIDandVersion,
+			DisplayName:    status.DisplayName,
+			DomainName:     status.DomainName,
+		}
+		for _, ds := range status.DiskStatusList {
+			if ds.ActiveFileLocation == "" {
+				continue
+			}
+			app.DiskMetrics = append(app.DiskMetrics,
+				types.DiskMetric{DiskPath: ds.ActiveFileLocation})
+		}
+		req.apps = append(req.apps, app)
+	}
+	select {
+	case ctx.diskMetricsRequests <- req:
+		return true
+	default:
+		log.Warnf("requestDiskMetrics: previous collection still running\n")
+		return false
+	}
+}
+
+// collectDiskMetrics runs in the worker. Disks which can not be read are
+// left out.
+func collectDiskMetrics(req diskMetricsRequest) diskMetricsResult {
+
+	var res diskMetricsResult
+	for _, app := range req.apps {
+		metric := app
+		metric.DiskMetrics = nil
+		for _, dm := range app.DiskMetrics {
+			imgInfo, err := getImgInfo(dm.DiskPath)
+			if err != nil {
+				log.Errorf("collectDiskMetrics(%s): %s\n",
+					app.DisplayName, err)
+				continue
+			}
+			metric.DiskMetrics = append(metric.DiskMetrics,
+				types.DiskMetric{
+					DiskPath:         dm.DiskPath,
+					Format:           imgInfo.Format,
+					ProvisionedBytes: imgInfo.VirtualSize,
+					UsedBytes:        imgInfo.ActualSize,
+					Dirty:            imgInfo.DirtyFlag,
+				})
+			metric.ProvisionedBytes += imgInfo.VirtualSize
+			metric.UsedBytes += imgInfo.ActualSize
+		}
+		res.apps = append(res.apps, metric)
+	}
+	for _, dirname := range req.dirnames {
+		dirUsage := types.DirDiskUsage{Dirname: dirname}
+		for _, imgInfo := range dirImgInfo(dirname) {
+			dirUsage.ImageCount++
+			dirUsage.ProvisionedBytes += imgInfo.VirtualSize
+			dirUsage.UsedBytes += imgInfo.ActualSize
+		}
+		res.usage.DirUsage = append(res.usage.DirUsage, dirUsage)
+		res.usage.ProvisionedBytes += dirUsage.ProvisionedBytes
+		res.usage.UsedBytes += dirUsage.UsedBytes
+	}
+	return res
+}
+
+// publishDiskMetrics is called with the result from the worker. Domains
+// which were deleted since the request are not published.
+func publishDiskMetrics(ctx *domainContext, res diskMetricsResult) {
+
+	log.Debugf("publishDiskMetrics()\n")
+	pub := ctx.pubAppDiskMetric
+	items := ctx.pubDomainStatus.GetAll()
+	for _, metric := range res.apps {
+		if _, ok := items[metric.Key()]; !ok {
+			continue
+		}
+		pub.Publish(metric.Key(), metric)
+	}
+	// Remove the metrics of deleted domains
+	for key := range pub.GetAll() {
+		if _, ok := items[key]; !ok {
+			pub.Unpublish(key)
+		}
+	}
+	ctx.pubDiskUsage.Publish(res.usage.Key(), res.usage)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package domainmgr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/diskmetrics"
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+)
+
+// Sizes of the fake images by path; a missing path fails
+var testImgInfo = map[string]diskmetrics.ImgInfo{
+	"/persist/img/a.qcow2": {Format: "qcow2", VirtualSize: 1000,
+		ActualSize: 100},
+	"/persist/img/b.img": {Format: "raw", VirtualSize: 2000,
+		ActualSize: 2000},
+}
+
+func fakeImgInfo(block chan struct{}) func() {
+	getImgInfo = func(path string) (*diskmetrics.ImgInfo, error) {
+		if block != nil {
+			<-block
+		}
+		info, ok := testImgInfo[path]
+		if !ok {
+			return nil, errors.New("no such image")
+		}
+		return &info, nil
+	}
+	dirImgInfo = func(dirname string) []diskmetrics.ImgInfo {
+		if dirname != "/persist/img" {
+			return nil
+		}
+		return []diskmetrics.ImgInfo{testImgInfo["/persist/img/a.qcow2"],
+			testImgInfo["/persist/img/b.img"]}
+	}
+	return func() {
+		getImgInfo = diskmetrics.GetImgInfo
+		dirImgInfo = diskmetrics.DirImgInfo
+	}
+}
+
+func testDomainStatus(name string, paths ...string) types.DomainStatus {
+	id, _ := uuid.NewV4()
+	status := types.DomainStatus{
+		UUIDandVersion: types.UUIDandVersion{UUID: id},
+		DisplayName:    name,
+		DomainName:     name + ".1",
+	}
+	for _, path := range paths {
+		status.DiskStatusList = append(status.DiskStatusList,
+			types.DiskStatus{ActiveFileLocation: path})
+	}
+	return status
+}
+
+func TestCollectDiskMetrics(t *testing.T) {
+	defer fakeImgInfo(nil)()
+	req := diskMetricsRequest{
+		apps: []types.AppDiskMetric{
+			{DisplayName: "app1", DiskMetrics: []types.DiskMetric{
+				{DiskPath: "/persist/img/a.qcow2"},
+				{DiskPath: "/persist/img/missing.img"},
+				{DiskPath: "/persist/img/b.img"}}},
+			{DisplayName: "app2"},
+		},
+		dirnames: []string{"/persist/img", "/persist/empty"},
+	}
+	res := collectDiskMetrics(req)
+	if len(res.apps) != 2 {
+		t.Fatalf("Got %d apps\n", len(res.apps))
+	}
+	app := res.apps[0]
+	if len(app.DiskMetrics) != 2 || app.DisplayName != "app1" ||
+		app.ProvisionedBytes != 3000 || app.UsedBytes != 2100 ||
+		app.DiskMetrics[0].Format != "qcow2" {
+		t.Errorf("Got %+v\n", app)
+	}
+	if len(res.apps[1].DiskMetrics) != 0 {
+		t.Errorf("Got %+v\n", res.apps[1])
+	}
+	usage := res.usage
+	if len(usage.DirUsage) != 2 || usage.DirUsage[0].ImageCount != 2 ||
+		usage.DirUsage[1].ImageCount != 0 ||
+		usage.ProvisionedBytes != 3000 || usage.UsedBytes != 2100 {
+		t.Errorf("Got %+v\n", usage)
+	}
+}
+
+// The main loop does not wait for a slow qemu-img and only publishes the
+// domains which still exist
+func TestDiskMetricsWorker(t *testing.T) {
+	block := make(chan struct{})
+	defer fakeImgInfo(block)()
+
+	pubDomainStatus, err := pubsub.PublishInMemory("domainmgr",
+		types.DomainStatus{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pubAppDiskMetric, err := pubsub.PublishInMemory("domainmgr",
+		types.AppDiskMetric{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pubDiskUsage, err := pubsub.PublishInMemory("domainmgr",
+		types.DiskUsage{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	ctx := domainContext{
+		pubDomainStatus:     pubDomainStatus,
+		pubAppDiskMetric:    pubAppDiskMetric,
+		pubDiskUsage:        pubDiskUsage,
+		diskMetricsRequests: make(chan diskMetricsRequest),
+	}
+	results := make(chan diskMetricsResult)
+	go diskMetricsWorker(ctx.diskMetricsRequests, results)
+	defer close(ctx.diskMetricsRequests)
+
+	app1 := testDomainStatus("app1", "/persist/img/a.qcow2")
+	app2 := testDomainStatus("app2", "/persist/img/b.img")
+	pubDomainStatus.Publish(app1.Key(), app1)
+	pubDomainStatus.Publish(app2.Key(), app2)
+	// A stale metric
+	pubAppDiskMetric.Publish("stale", types.AppDiskMetric{})
+
+	// Wait for the worker to be ready
+	sent := false
+	for i := 0; i < 100 && !sent; i++ {
+		sent = requestDiskMetrics(&ctx)
+		if !sent {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if !sent {
+		t.Fatalf("Request not taken by the worker\n")
+	}
+	// Blocked in getImgInfo; the next request is skipped
+	if requestDiskMetrics(&ctx) {
+		t.Errorf("Request taken by a busy worker\n")
+	}
+
+	pubDomainStatus.Unpublish(app2.Key())
+	close(block)
+	var res diskMetricsResult
+	select {
+	case res = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No result\n")
+	}
+	if len(res.apps) != 2 {
+		t.Errorf("Collected %d apps\n", len(res.apps))
+	}
+	publishDiskMetrics(&ctx, res)
+	items := pubAppDiskMetric.GetAll()
+	if len(items) != 1 {
+		t.Fatalf("Published %d app metrics\n", len(items))
+	}
+	metric, err := cast.CastAppDiskMetric(items[app1.Key()])
+	if err != nil {
+		t.Fatalf("CastAppDiskMetric failed: %s\n", err)
+	}
+	if metric.DisplayName != "app1" || metric.UsedBytes != 100 {
+		t.Errorf("Published %+v\n", metric)
+	}
+	st, err := pubDiskUsage.Get("global")
+	if err != nil {
+		t.Fatalf("No DiskUsage: %s\n", err)
+	}
+	usage, err := cast.CastDiskUsage(st)
+	if err != nil {
+		t.Fatalf("CastDiskUsage failed: %s\n", err)
+	}
+	if len(usage.DirUsage) != 2 {
+		t.Errorf("Published %+v\n", usage)
+	}
+}
+
+// The rates are computed from one request to the next
+func TestDiskMetricsWorkerIORates(t *testing.T) {
+	defer fakeImgInfo(nil)()
+	start := time.Now()
+	sample := 0
+	readDiskIOStats = func() ([]types.DiskIOStats, error) {
+		sample++
+		return []types.DiskIOStats{{DevName: "mmcblk0",
+			SampleTime: start.Add(time.Duration(sample) * time.Second),
+			ReadCount:  uint64(100 * sample),
+			WriteCount: uint64(10 * sample),
+			IOTimeMs:   uint64(500 * sample)}}, nil
+	}
+	defer func() { readDiskIOStats = diskmetrics.ReadDiskIOStats }()
+
+	requests := make(chan diskMetricsRequest)
+	results := make(chan diskMetricsResult)
+	go diskMetricsWorker(requests, results)
+	defer close(requests)
+
+	var res diskMetricsResult
+	for i := 0; i < 2; i++ {
+		requests <- diskMetricsRequest{}
+		select {
+		case res = <-results:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No result\n")
+		}
+		if len(res.usage.IOStats) != 1 {
+			t.Fatalf("Got %+v\n", res.usage.IOStats)
+		}
+		if i == 0 && res.usage.IOStats[0].ReadsPerSec != 0 {
+			t.Errorf("Rates without a previous sample: %+v\n",
+				res.usage.IOStats[0])
+		}
+	}
+	stats := res.usage.IOStats[0]
+	if stats.ReadsPerSec != 100 || stats.WritesPerSec != 10 ||
+		stats.UtilPercent != 50 {
+		t.Errorf("Got %+v\n", stats)
+	}
+}
@@ -9,6 +9,7 @@
 package domainmgr
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"flag"
@@ -82,6 +83,11 @@ type domainContext struct {
 	subGlobalConfig        *pubsub.Subscription
 	pubImageStatus         *pubsub.Publication
 	pubAssignableAdapters  *pubsub.Publication
+	pubAppDiskMetric       *pubsub.Publication
+	pubDiskUsage           *pubsub.Publication
+	pubUsbDeviceStatus     *pubsub.Publication
+	diskMetricsRequests    chan diskMetricsRequest
+	subDiskSpaceAlarm      *pubsub.Subscription
 	usbAccess              bool
 	createSema             sema.Semaphore
 }
@@ -95,6 +101,9 @@ var debugOverride bool                                     // From command line
 var vdiskGCTime = time.Duration(3600) * time.Second        // Unless from GlobalConfig
 var domainBootRetryTime = time.Duration(600) * time.Second // Unless from GlobalConfig
 
+// How long qemu-img resize can take
+const resizeTimeout = 5 * time.Minute
+
 func Run() {
 	handlersInit()
 	versionPtr := flag.Bool("v", false, "Version")
@@ -198,6 +207,26 @@ func Run() {
 	domainCtx.pubAssignableAdapters = pubAssignableAdapters
 	pubAssignableAdapters.ClearRestarted()
 
+	pubAppDiskMetric, err := pubsub.Publish(agentName,
+		types.AppDiskMetric{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	domainCtx.pubAppDiskMetric = pubAppDiskMetric
+
+	pubDiskUsage, err := pubsub.Publish(agentName, types.DiskUsage{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	domainCtx.pubDiskUsage = pubDiskUsage
+
+	pubUsbDeviceStatus, err := pubsub.Publish(agentName,
+		types.UsbDeviceStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	domainCtx.pubUsbDeviceStatus = pubUsbDeviceStatus
+
 	// Look for global config such as log levels
 	subGlobalConfig, err := pubsub.Subscribe("", types.GlobalConfig{},
 		false, &domainCtx)
@@ -219,6 +248,16 @@ func Run() {
 	domainCtx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
 
+	// Remove unused images early when /persist is full
+	subDiskSpaceAlarm, err := pubsub.Subscribe("zedagent",
+		types.DiskSpaceAlarm{}, false, &domainCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	subDiskSpaceAlarm.ModifyHandler = handleDiskSpaceAlarmModify
+	domainCtx.subDiskSpaceAlarm = subDiskSpaceAlarm
+	subDiskSpaceAlarm.Activate()
+
 	model := hardware.GetHardwareModel()
 	// Logic to fall back to default.json model if cloud sends wrong
 	// model string
@@ -292,10 +331,24 @@ func Run() {
 	domainCtx.subDomainConfig = subDomainConfig
 	subDomainConfig.Activate()
 
+	// Listen before the scan so that we do not miss any changes
+	usbChanges := hardware.UsbChangeInit()
+	publishUsbDevices(&domainCtx)
+
 	// We will cleanup zero RefCount objects after a while
 	// We run timer 10 times more often than the limit on LastUse
 	gc := time.NewTicker(vdiskGCTime / 10)
 
+	// Collect the disk sizes every 5 minutes
+	diskMetricsInterval := time.Duration(5 * time.Minute)
+	diskMetricsMax := float64(diskMetricsInterval)
+	diskMetricsMin := diskMetricsMax * 0.3
+	diskMetricsTimer := flextimer.NewRangeTicker(
+		time.Duration(diskMetricsMin), time.Duration(diskMetricsMax))
+	domainCtx.diskMetricsRequests = make(chan diskMetricsRequest)
+	diskMetricsResults := make(chan diskMetricsResult)
+	go diskMetricsWorker(domainCtx.diskMetricsRequests, diskMetricsResults)
+
 	for {
 		select {
 		case change := <-subGlobalConfig.C:
@@ -310,8 +363,20 @@ func Run() {
 		case change := <-subAa.C:
 			subAa.ProcessChange(change)
 
+		case change := <-subDiskSpaceAlarm.C:
+			subDiskSpaceAlarm.ProcessChange(change)
+
 		case <-gc.C:
-			gcObjects(&domainCtx, rwImgDirname)
+			gcObjects(&domainCtx, rwImgDirname, vdiskGCTime)
+
+		case <-diskMetricsTimer.C:
+			requestDiskMetrics(&domainCtx)
+
+		case res := <-diskMetricsResults:
+			publishDiskMetrics(&domainCtx, res)
+
+		case change := <-usbChanges:
+			handleUsbChange(&domainCtx, change)
 
 		case <-stillRunning.C:
 			agentlog.StillRunning(agentName)
@@ -377,7 +442,11 @@ func addImageStatus(ctx *domainContext, fileLocation string) {
 		}
 		publishImageStatus(ctx, &status)
 	} else {
-		status := cast.CastImageStatus(st)
+		status, err := cast.CastImageStatus(st)
+		if err != nil {
+			log.Errorf("addImageStatus: %s\n", err)
+			return
+		}
 		log.Infof("addImageStatus(%s) found RefCount %d LastUse %v\n",
 			filename, status.RefCount, status.LastUse)
 
@@ -399,21 +468,30 @@ func delImageStatus(ctx *domainContext, fileLocation string) {
 		log.Errorf("delImageStatus(%s) not found\n", filename)
 		return
 	}
-	status := cast.CastImageStatus(st)
+	status, err := cast.CastImageStatus(st)
+	if err != nil {
+		log.Errorf("delImageStatus: %s\n", err)
+		return
+	}
 	log.Infof("delImageStatus(%s) found RefCount %d LastUse %v\n",
 		filename, status.RefCount, status.LastUse)
 	unpublishImageStatus(ctx, &status)
 }
 
-// Periodic garbage collection looking at RefCount=0 files
-func gcObjects(ctx *domainContext, dirName string) {
+// Periodic garbage collection looking at RefCount=0 files which have
+// not been used for maxAge
+func gcObjects(ctx *domainContext, dirName string, maxAge time.Duration) {
 
 	log.Debugf("gcObjects()\n")
 
 	pub := ctx.pubImageStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastImageStatus(st)
+		status, err := cast.CastImageStatus(st)
+		if err != nil {
+			log.Errorf("gcObjects: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("gcObjects key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -435,9 +513,9 @@ func gcObjects(ctx *domainContext, dirName string) {
 			continue
 		}
 		timePassed := time.Since(status.LastUse)
-		if timePassed < vdiskGCTime {
+		if timePassed < maxAge {
 			log.Debugf("gcObjects: skipping recently used %s remains %d seconds\n",
-				key, (timePassed-vdiskGCTime)/time.Second)
+				key, (timePassed-maxAge)/time.Second)
 			continue
 		}
 		log.Infof("gcObjects: removing %s LastUse %v now %v: %s\n",
@@ -455,7 +533,11 @@ func findActiveFileLocation(ctx *domainContext, filename string) bool {
 	pub := ctx.pubDomainStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastDomainStatus(st)
+		status, err := cast.CastDomainStatus(st)
+		if err != nil {
+			log.Errorf("findActiveFileLocation: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("findActiveFileLocation key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -536,7 +618,11 @@ func handleDomainModify(ctxArg interface{}, key string, configArg interface{}) {
 
 	log.Infof("handleDomainModify(%s)\n", key)
 	ctx := ctxArg.(*domainContext)
-	config := cast.CastDomainConfig(configArg)
+	config, err := cast.CastDomainConfig(configArg)
+	if err != nil {
+		log.Errorf("handleDomainModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleDomainModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -589,7 +675,11 @@ func runHandler(ctx *domainContext, key string, c <-chan interface{}) {
 		select {
 		case configArg, ok := <-c:
 			if ok {
-				config := cast.CastDomainConfig(configArg)
+				config, err := cast.CastDomainConfig(configArg)
+				if err != nil {
+					log.Errorf("runHandler: %s\n", err)
+					continue
+				}
 				status := lookupDomainStatus(ctx, key)
 				if status == nil {
 					handleCreate(ctx, key, &config)
@@ -634,8 +724,7 @@ func verifyStatus(ctx *domainContext, status *types.DomainStatus) {
 		if !status.Activated {
 			log.Warnf("verifyDomain(%s) domain came back alive; id  %d\n",
 				status.Key(), domainId)
-			status.LastErr = ""
-			status.LastErrTime = time.Time{}
+			status.ClearError()
 			status.DomainId = domainId
 			status.Activated = true
 			status.State = types.RUNNING
@@ -657,7 +746,7 @@ func maybeRetryBoot(ctx *domainContext, status *types.DomainStatus) {
 	}
 
 	t := time.Now()
-	elapsed := t.Sub(status.LastErrTime)
+	elapsed := t.Sub(status.ErrorTime)
 	if elapsed < domainBootRetryTime {
 		log.Infof("maybeRetryBoot(%s) %v remaining\n",
 			status.Key(),
@@ -665,10 +754,9 @@ func maybeRetryBoot(ctx *domainContext, status *types.DomainStatus) {
 		return
 	}
 	log.Infof("maybeRetryBoot(%s) after %s at %v\n",
-		status.Key(), status.LastErr, status.LastErrTime)
+		status.Key(), status.Error, status.ErrorTime)
 
-	status.LastErr = ""
-	status.LastErrTime = time.Time{}
+	status.ClearError()
 	status.TriedCount += 1
 
 	filename := xenCfgFilename(status.AppNum)
@@ -679,8 +767,7 @@ func maybeRetryBoot(ctx *domainContext, status *types.DomainStatus) {
 		log.Errorf("maybeRetryBoot xl create for %s: %s\n",
 			status.DomainName, err)
 		status.BootFailed = true
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		publishDomainStatus(ctx, status)
 		return
 	}
@@ -697,7 +784,11 @@ func lookupDomainStatus(ctx *domainContext, key string) *types.DomainStatus {
 		log.Infof("lookupDomainStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastDomainStatus(st)
+	status, err := cast.CastDomainStatus(st)
+	if err != nil {
+		log.Errorf("lookupDomainStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupDomainStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -714,7 +805,11 @@ func lookupDomainConfig(ctx *domainContext, key string) *types.DomainConfig {
 		log.Infof("lookupDomainConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastDomainConfig(c)
+	config, err := cast.CastDomainConfig(c)
+	if err != nil {
+		log.Errorf("lookupDomainConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupDomainConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -743,6 +838,7 @@ func handleCreate(ctx *domainContext, key string, config *types.DomainConfig) {
 		EnableVnc:          config.EnableVnc,
 		VncDisplay:         config.VncDisplay,
 		VncPasswd:          config.VncPasswd,
+		IOThreadCPUs:       config.IOThreadCPUs,
 		State:              types.INSTALLED,
 	}
 	status.DiskStatusList = make([]types.DiskStatus,
@@ -752,12 +848,19 @@ func handleCreate(ctx *domainContext, key string, config *types.DomainConfig) {
 		config.UUIDandVersion, status.DomainName,
 		config.DisplayName)
 
+	if err := config.Validate(); err != nil {
+		log.Errorf("handleCreate(%s) invalid config: %s\n", key, err)
+		status.PendingAdd = false
+		status.SetErrorNow(fmt.Sprintf("%v", err))
+		publishDomainStatus(ctx, &status)
+		return
+	}
+
 	if err := configToStatus(ctx, *config, &status); err != nil {
 		log.Errorf("Failed to create DomainStatus from %v: %s\n",
 			config, err)
 		status.PendingAdd = false
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		publishDomainStatus(ctx, &status)
 		return
 	}
@@ -766,8 +869,7 @@ func handleCreate(ctx *domainContext, key string, config *types.DomainConfig) {
 		log.Errorf("Failed to reserve adapters for %v: %s\n",
 			config, err)
 		status.PendingAdd = false
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		status.AdaptersFailed = true
 		publishDomainStatus(ctx, &status)
 		cleanupAdapters(ctx, config.IoAdapterList,
@@ -800,8 +902,7 @@ func handleCreate(ctx *domainContext, key string, config *types.DomainConfig) {
 				log.Errorf("Copy failed from %s to %s: %s\n",
 					ds.FileLocation, ds.ActiveFileLocation, err)
 				status.PendingAdd = false
-				status.LastErr = fmt.Sprintf("%v", err)
-				status.LastErrTime = time.Now()
+				status.SetErrorNow(fmt.Sprintf("%v", err))
 				publishDomainStatus(ctx, &status)
 				return
 			}
@@ -812,8 +913,7 @@ func handleCreate(ctx *domainContext, key string, config *types.DomainConfig) {
 				errStr := fmt.Sprintf("handleCreate(%s) failed %v",
 					status.Key(), err)
 				log.Errorln(errStr)
-				status.LastErr = errStr
-				status.LastErrTime = time.Now()
+				status.SetErrorNow(errStr)
 				status.PendingAdd = false
 				publishDomainStatus(ctx, &status)
 				return
@@ -892,8 +992,7 @@ func doAssignIoAdaptersToDomain(ctx *domainContext, config types.DomainConfig,
 				status.DomainName)
 			err := pciAssignableAdd(ib.PciLong)
 			if err != nil {
-				status.LastErr = fmt.Sprintf("%v", err)
-				status.LastErrTime = time.Now()
+				status.SetErrorNow(fmt.Sprintf("%v", err))
 				return
 			}
 			ib.IsPCIBack = true
@@ -913,8 +1012,7 @@ func doActivate(ctx *domainContext, config types.DomainConfig,
 			log.Errorf("Failed to reserve adapters for %v: %s\n",
 				config, err)
 			status.PendingAdd = false
-			status.LastErr = fmt.Sprintf("%v", err)
-			status.LastErrTime = time.Now()
+			status.SetErrorNow(fmt.Sprintf("%v", err))
 			status.AdaptersFailed = true
 			publishDomainStatus(ctx, status)
 			cleanupAdapters(ctx, config.IoAdapterList,
@@ -942,8 +1040,7 @@ func doActivate(ctx *domainContext, config types.DomainConfig,
 		} else if err := cp(ds.ActiveFileLocation, ds.FileLocation); err != nil {
 			log.Errorf("Copy failed from %s to %s: %s\n",
 				ds.FileLocation, ds.ActiveFileLocation, err)
-			status.LastErr = fmt.Sprintf("%v", err)
-			status.LastErrTime = time.Now()
+			status.SetErrorNow(fmt.Sprintf("%v", err))
 			return
 		}
 		addImageStatus(ctx, ds.ActiveFileLocation)
@@ -951,6 +1048,17 @@ func doActivate(ctx *domainContext, config types.DomainConfig,
 			ds.FileLocation, ds.ActiveFileLocation)
 	}
 
+	// Check the backing files of the disks are all there
+	for _, ds := range status.DiskStatusList {
+		if err := diskmetrics.ValidateImgChain(ds.ActiveFileLocation); err != nil {
+			log.Errorf("doActivate(%s) bad image chain: %s\n",
+				config.DisplayName, err)
+			status.SetErrorNow(fmt.Sprintf("%v", err))
+			publishDomainStatus(ctx, status)
+			return
+		}
+	}
+
 	filename := xenCfgFilename(config.AppNum)
 	file, err := os.Create(filename)
 	if err != nil {
@@ -961,8 +1069,7 @@ func doActivate(ctx *domainContext, config types.DomainConfig,
 	if err := configToXencfg(config, *status, ctx.assignableAdapters,
 		file); err != nil {
 		log.Errorf("Failed to create DomainStatus from %v\n", config)
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		return
 	}
 
@@ -981,8 +1088,7 @@ func doActivate(ctx *domainContext, config types.DomainConfig,
 		if status.TriedCount >= 3 {
 			log.Errorf("xl create for %s: %s\n", status.DomainName, err)
 			status.BootFailed = true
-			status.LastErr = fmt.Sprintf("%v", err)
-			status.LastErrTime = time.Now()
+			status.SetErrorNow(fmt.Sprintf("%v", err))
 			publishDomainStatus(ctx, status)
 			return
 		}
@@ -1013,12 +1119,18 @@ func doActivateTail(ctx *domainContext, status *types.DomainStatus,
 		log.Errorf("xlDisableVifOffload for %s: %s\n",
 			status.DomainName, err)
 	}
+	if status.IOThreadCPUs != "" {
+		err := pinIOThreads(domainId, status.IOThreadCPUs)
+		if err != nil {
+			log.Errorf("pinIOThreads for %s: %s\n",
+				status.DomainName, err)
+		}
+	}
 	err = xlUnpause(status.DomainName, domainId)
 	if err != nil {
 		// XXX shouldn't we destroy it?
 		log.Errorf("xl unpause for %s: %s\n", status.DomainName, err)
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		return
 	}
 
@@ -1120,8 +1232,7 @@ func doInactivate(ctx *domainContext, status *types.DomainStatus) {
 		errStr := fmt.Sprintf("doInactivate(%s) failed to halt/destroy %d",
 			status.Key(), status.DomainId)
 		log.Errorln(errStr)
-		status.LastErr = errStr
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(errStr)
 	} else {
 		status.Activated = false
 		status.State = types.HALTED
@@ -1186,8 +1297,7 @@ func pciUnassign(ctx *domainContext, status *types.DomainStatus,
 				status.DomainName)
 			err := pciAssignableRemove(ib.PciLong)
 			if err != nil && !ignoreErrors {
-				status.LastErr = fmt.Sprintf("%v", err)
-				status.LastErrTime = time.Now()
+				status.SetErrorNow(fmt.Sprintf("%v", err))
 			} else {
 				ib.IsPCIBack = false
 			}
@@ -1212,6 +1322,8 @@ func configToStatus(ctx *domainContext, config types.DomainConfig,
 		ds.Format = dc.Format
 		ds.Maxsizebytes = dc.Maxsizebytes
 		ds.Devtype = dc.Devtype
+		ds.Virtio = dc.Virtio
+		ds.Queues = dc.Queues
 		// map from i=1 to xvda, 2 to xvdb etc
 		xv := "xvd" + string(int('a')+i)
 		ds.Vdev = xv
@@ -1428,6 +1540,10 @@ func configToXencfg(config types.DomainConfig, status types.DomainStatus,
 
 	diskString := ""
 	for i, ds := range status.DiskStatusList {
+		if ds.Virtio {
+			// Added to device_model_args_hvm below
+			continue
+		}
 		access := "rw"
 		if ds.ReadOnly {
 			access = "ro"
@@ -1447,6 +1563,10 @@ func configToXencfg(config types.DomainConfig, status types.DomainStatus,
 	for _, net := range config.VifList {
 		oneVif := fmt.Sprintf("'bridge=%s,vifname=%s,mac=%s'",
 			net.Bridge, net.Vif, net.Mac)
+		if net.Virtio {
+			oneVif = fmt.Sprintf("'bridge=%s,vifname=%s,mac=%s,model=virtio-net-pci'",
+				net.Bridge, net.Vif, net.Mac)
+		}
 		if vifString == "" {
 			vifString = oneVif
 		} else {
@@ -1455,6 +1575,12 @@ func configToXencfg(config types.DomainConfig, status types.DomainStatus,
 	}
 	file.WriteString(fmt.Sprintf("vif = [%s]\n", vifString))
 
+	dmArgs := virtioDeviceModelArgs(config, status)
+	if len(dmArgs) != 0 {
+		file.WriteString(fmt.Sprintf("device_model_args_hvm = [\"%s\"]\n",
+			strings.Join(dmArgs, "\", \"")))
+	}
+
 	// Gather all PCI assignments into a single line
 	var pciAssignments []string
 
@@ -1535,6 +1661,14 @@ func handleModify(ctx *domainContext, key string,
 	status.PendingModify = true
 	publishDomainStatus(ctx, status)
 
+	if err := config.Validate(); err != nil {
+		log.Errorf("handleModify(%s) invalid config: %s\n", key, err)
+		status.PendingModify = false
+		status.SetErrorNow(fmt.Sprintf("%v", err))
+		publishDomainStatus(ctx, status)
+		return
+	}
+
 	changed := false
 	if config.Activate && !status.Activated {
 		// AppNum could have changed if we did not already Activate
@@ -1549,11 +1683,10 @@ func handleModify(ctx *domainContext, key string,
 
 		// This has the effect of trying a boot again for any
 		// handleModify after an error.
-		if status.LastErr != "" {
+		if status.Error != "" {
 			log.Infof("handleModify(%v) ignoring existing error for %s\n",
 				config.UUIDandVersion, config.DisplayName)
-			status.LastErr = ""
-			status.LastErrTime = time.Time{}
+			status.ClearError()
 			publishDomainStatus(ctx, status)
 			doInactivate(ctx, status)
 		}
@@ -1561,11 +1694,10 @@ func handleModify(ctx *domainContext, key string,
 		doActivate(ctx, *config, status)
 		changed = true
 	} else if !config.Activate {
-		if status.LastErr != "" {
+		if status.Error != "" {
 			log.Infof("handleModify(%v) clearing existing error for %s\n",
 				config.UUIDandVersion, config.DisplayName)
-			status.LastErr = ""
-			status.LastErrTime = time.Time{}
+			status.ClearError()
 			publishDomainStatus(ctx, status)
 			doInactivate(ctx, status)
 			updateStatusFromConfig(status, *config)
@@ -1589,7 +1721,7 @@ func handleModify(ctx *domainContext, key string,
 		return
 	}
 
-	// XXX check if we have status.LastErr != "" and delete and retry
+	// XXX check if we have status.Error != "" and delete and retry
 	// even if same version. XXX won't the above Activate/Activated checks
 	// result in redoing things? Could have failures during copy i.e.
 	// before activation.
@@ -1620,6 +1752,7 @@ func updateStatusFromConfig(status *types.DomainStatus, config types.DomainConfi
 	status.EnableVnc = config.EnableVnc
 	status.VncDisplay = config.VncDisplay
 	status.VncPasswd = config.VncPasswd
+	status.IOThreadCPUs = config.IOThreadCPUs
 }
 
 // Used to wait both after shutdown and destroy
@@ -1969,13 +2102,17 @@ func pciAssignableRemove(long string) error {
 
 func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*domainContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
+	if ctx.deviceNetworkStatus.Equal(status) {
 		log.Infof("handleDNSModify unchanged\n")
 		return
 	}
@@ -2002,6 +2139,23 @@ func handleDNSDelete(ctxArg interface{}, key string, statusArg interface{}) {
 	log.Infof("handleDNSDelete done for %s\n", key)
 }
 
+func handleDiskSpaceAlarmModify(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	ctx := ctxArg.(*domainContext)
+	alarm, err := cast.CastDiskSpaceAlarm(statusArg)
+	if err != nil {
+		log.Errorf("handleDiskSpaceAlarmModify: %s\n", err)
+		return
+	}
+	if alarm.MountPath != persistDir || !alarm.Cleanup {
+		return
+	}
+	log.Warnf("handleDiskSpaceAlarmModify: %s %d%% used; removing unused images\n",
+		alarm.MountPath, alarm.UsedPercent)
+	gcObjects(ctx, rwImgDirname, 0)
+}
+
 func handleGlobalConfigModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
@@ -2015,12 +2169,8 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 	debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
 	if gcp != nil {
-		if gcp.VdiskGCTime != 0 {
-			vdiskGCTime = time.Duration(gcp.VdiskGCTime) * time.Second
-		}
-		if gcp.DomainBootRetryTime != 0 {
-			domainBootRetryTime = time.Duration(gcp.DomainBootRetryTime) * time.Second
-		}
+		vdiskGCTime = gcp.GetVdiskGCTime()
+		domainBootRetryTime = gcp.GetDomainBootRetryTime()
 		if gcp.UsbAccess != ctx.usbAccess {
 			ctx.usbAccess = gcp.UsbAccess
 			updateUsbAccess(ctx)
@@ -2059,8 +2209,9 @@ func maybeResizeDisk(diskfile string, maxsizebytes uint64) error {
 			diskfile, maxsizebytes, currentSize)
 		return nil
 	}
-	err = diskmetrics.ResizeImg(diskfile, maxsizebytes)
-	return err
+	ctx, cancel := context.WithTimeout(context.Background(), resizeTimeout)
+	defer cancel()
+	return diskmetrics.ResizeImage(ctx, diskfile, maxsizebytes)
 }
 
 func getDiskVirtualSize(diskfile string) (uint64, error) {
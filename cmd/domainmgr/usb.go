@@ -0,0 +1,59 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Publish the USB devices seen by dom0 so that the other agents can react
+// to modems and NICs which are attached after boot
+
+package domainmgr
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/hardware"
+)
+
+// publishUsbDevices publishes the devices found at startup and removes
+// the ones from before a restart which are gone
+func publishUsbDevices(ctx *domainContext) {
+	found := make(map[string]bool)
+	for _, busPath := range hardware.ListUsbDevices() {
+		found[busPath] = true
+		publishUsbDevice(ctx, busPath)
+	}
+	pub := ctx.pubUsbDeviceStatus
+	for key := range pub.GetAll() {
+		if !found[key] {
+			log.Infof("publishUsbDevices: %s is gone\n", key)
+			pub.Unpublish(key)
+		}
+	}
+}
+
+func publishUsbDevice(ctx *domainContext, busPath string) {
+	status, err := hardware.GetUsbDevice(busPath)
+	if err != nil {
+		// Detached while we were looking
+		log.Errorf("publishUsbDevice(%s): %s\n", busPath, err)
+		return
+	}
+	log.Infof("publishUsbDevice(%s) %s %s %s classes %v\n", busPath,
+		status.VendorProduct(), status.Manufacturer, status.Product,
+		status.InterfaceClasses)
+	if status.MaybeNetwork() {
+		log.Infof("publishUsbDevice(%s) might be a modem or NIC\n",
+			busPath)
+	}
+	ctx.pubUsbDeviceStatus.Publish(status.Key(), status)
+}
+
+func handleUsbChange(ctx *domainContext, change hardware.UsbChange) {
+	log.Infof("handleUsbChange(%s) attached %v\n", change.BusPath,
+		change.Attached)
+	if change.Attached {
+		publishUsbDevice(ctx, change.BusPath)
+		return
+	}
+	pub := ctx.pubUsbDeviceStatus
+	if st, _ := pub.Get(change.BusPath); st != nil {
+		pub.Unpublish(change.BusPath)
+	}
+}
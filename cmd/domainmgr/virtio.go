@@ -0,0 +1,162 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Virtio disks and IO threads for HVM domains. xl has no virtio-blk
+// disks nor IO threads hence they are passed to qemu as
+// device_model_args_hvm. The IO threads are pinned once qemu is running.
+
+package domainmgr
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/wrap"
+)
+
+// Where to look for the qemu processes and their threads. A variable
+// for the tests.
+var procDir = "/proc"
+
+// Prefix of the name qemu gives the thread of an iothread object
+const ioThreadCommPrefix = "IO iothread"
+
+// virtioDeviceModelArgs returns the qemu arguments for the virtio disks,
+// the IO threads and the virtio-net queues
+func virtioDeviceModelArgs(config types.DomainConfig,
+	status types.DomainStatus) []string {
+
+	var args []string
+	if config.VirtualizationMode != types.HVM {
+		return args
+	}
+	for i := 0; i < config.IOThreads; i++ {
+		args = append(args, "-object",
+			fmt.Sprintf("iothread,id=iothread%d", i))
+	}
+	diskNum := 0
+	for _, ds := range status.DiskStatusList {
+		if !ds.Virtio {
+			continue
+		}
+		readOnly := "off"
+		if ds.ReadOnly {
+			readOnly = "on"
+		}
+		format := ds.Format
+		if format == "" {
+			format = "raw"
+		}
+		args = append(args, "-drive",
+			fmt.Sprintf("file=%s,if=none,id=vdisk%d,format=%s,readonly=%s",
+				ds.ActiveFileLocation, diskNum, format, readOnly))
+		device := fmt.Sprintf("virtio-blk-pci,drive=vdisk%d", diskNum)
+		if ds.Queues != 0 {
+			device += fmt.Sprintf(",num-queues=%d", ds.Queues)
+		}
+		if config.IOThreads != 0 {
+			// Spread the disks over the IO threads
+			device += fmt.Sprintf(",iothread=iothread%d",
+				diskNum%config.IOThreads)
+		}
+		args = append(args, "-device", device)
+		diskNum++
+	}
+	// xl has no per vif queues; the most asked for applies to all
+	// the virtio-net devices
+	queues := 0
+	for _, vif := range config.VifList {
+		if vif.Virtio && vif.Queues > queues {
+			queues = vif.Queues
+		}
+	}
+	if queues > 1 {
+		args = append(args, "-global", "virtio-net-pci.mq=on",
+			"-global", fmt.Sprintf("virtio-net-pci.vectors=%d",
+				2*queues+2))
+	}
+	return args
+}
+
+// pinIOThreads pins the IO threads of the qemu for the domain to the cpus
+func pinIOThreads(domainId int, cpus string) error {
+	log.Infof("pinIOThreads(%d, %s)\n", domainId, cpus)
+	pid, err := deviceModelPid(domainId)
+	if err != nil {
+		return err
+	}
+	tids, err := ioThreadIds(pid)
+	if err != nil {
+		return err
+	}
+	if len(tids) == 0 {
+		errStr := fmt.Sprintf("No IO threads in qemu %d for domain %d",
+			pid, domainId)
+		return errors.New(errStr)
+	}
+	for _, tid := range tids {
+		out, err := wrap.Command("taskset", "-p", "-c", cpus,
+			strconv.Itoa(tid)).CombinedOutput()
+		if err != nil {
+			errStr := fmt.Sprintf("taskset %d failed: %s: %s",
+				tid, err, string(out))
+			return errors.New(errStr)
+		}
+	}
+	return nil
+}
+
+// deviceModelPid finds the qemu with "-xen-domid <domainId>"
+func deviceModelPid(domainId int) (int, error) {
+	dirs, err := filepath.Glob(procDir + "/[0-9]*/cmdline")
+	if err != nil {
+		return 0, err
+	}
+	domid := strconv.Itoa(domainId)
+	for _, filename := range dirs {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			// Process went away
+			continue
+		}
+		args := strings.Split(string(b), "\x00")
+		for i := 0; i+1 < len(args); i++ {
+			if args[i] == "-xen-domid" && args[i+1] == domid {
+				pidStr := filepath.Base(filepath.Dir(filename))
+				return strconv.Atoi(pidStr)
+			}
+		}
+	}
+	errStr := fmt.Sprintf("No qemu for domain %d", domainId)
+	return 0, errors.New(errStr)
+}
+
+// ioThreadIds returns the thread ids of the IO threads in the process
+func ioThreadIds(pid int) ([]int, error) {
+	var tids []int
+	pattern := fmt.Sprintf("%s/%d/task/[0-9]*/comm", procDir, pid)
+	comms, err := filepath.Glob(pattern)
+	if err != nil {
+		return tids, err
+	}
+	for _, filename := range comms {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(string(b), ioThreadCommPrefix) {
+			continue
+		}
+		tid, err := strconv.Atoi(filepath.Base(filepath.Dir(filename)))
+		if err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
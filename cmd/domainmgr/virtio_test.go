@@ -0,0 +1,121 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package domainmgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestVirtioDeviceModelArgs(t *testing.T) {
+	config := types.DomainConfig{
+		VmConfig: types.VmConfig{VirtualizationMode: types.HVM,
+			IOThreads: 2},
+		VifList: []types.VifInfo{
+			{Bridge: "bn1", Vif: "nbu1x1", Virtio: true, Queues: 2},
+			{Bridge: "bn1", Vif: "nbu2x1", Virtio: true, Queues: 4},
+			{Bridge: "bn2", Vif: "nbu3x1"},
+		},
+	}
+	status := types.DomainStatus{
+		DiskStatusList: []types.DiskStatus{
+			{ActiveFileLocation: "/persist/img/a.qcow2",
+				Format: "qcow2", Virtio: true, Queues: 4},
+			{ActiveFileLocation: "/persist/img/b.img"},
+			{ActiveFileLocation: "/persist/img/c.img", ReadOnly: true,
+				Virtio: true},
+			{ActiveFileLocation: "/persist/img/d.img", Virtio: true},
+		},
+	}
+	expected := []string{
+		"-object", "iothread,id=iothread0",
+		"-object", "iothread,id=iothread1",
+		"-drive", "file=/persist/img/a.qcow2,if=none,id=vdisk0,format=qcow2,readonly=off",
+		"-device", "virtio-blk-pci,drive=vdisk0,num-queues=4,iothread=iothread0",
+		"-drive", "file=/persist/img/c.img,if=none,id=vdisk1,format=raw,readonly=on",
+		"-device", "virtio-blk-pci,drive=vdisk1,iothread=iothread1",
+		"-drive", "file=/persist/img/d.img,if=none,id=vdisk2,format=raw,readonly=off",
+		"-device", "virtio-blk-pci,drive=vdisk2,iothread=iothread0",
+		"-global", "virtio-net-pci.mq=on",
+		"-global", "virtio-net-pci.vectors=10",
+	}
+	args := virtioDeviceModelArgs(config, status)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Got\n%s\nexpected\n%s\n", strings.Join(args, " "),
+			strings.Join(expected, " "))
+	}
+
+	// No IO threads and a single queue
+	config.IOThreads = 0
+	config.VifList = config.VifList[:1]
+	config.VifList[0].Queues = 0
+	status.DiskStatusList = status.DiskStatusList[3:]
+	expected = []string{
+		"-drive", "file=/persist/img/d.img,if=none,id=vdisk0,format=raw,readonly=off",
+		"-device", "virtio-blk-pci,drive=vdisk0",
+	}
+	args = virtioDeviceModelArgs(config, status)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Got\n%s\nexpected\n%s\n", strings.Join(args, " "),
+			strings.Join(expected, " "))
+	}
+
+	// Nothing for PV
+	config.VirtualizationMode = types.PV
+	if args := virtioDeviceModelArgs(config, status); len(args) != 0 {
+		t.Errorf("Got %v for PV\n", args)
+	}
+}
+
+func writeTestProcFile(t *testing.T, dir string, name string, content string) {
+	fileName := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %s\n", err)
+	}
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+}
+
+func TestIOThreadIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "virtiotest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	savedProcDir := procDir
+	procDir = dir
+	defer func() { procDir = savedProcDir }()
+
+	writeTestProcFile(t, dir, "100/cmdline",
+		"qemu-system-i386\x00-xen-domid\x0012\x00-nodefaults\x00")
+	writeTestProcFile(t, dir, "123/cmdline",
+		"qemu-system-i386\x00-xen-domid\x005\x00-nodefaults\x00")
+	writeTestProcFile(t, dir, "123/task/123/comm", "qemu-system-i38\n")
+	writeTestProcFile(t, dir, "123/task/130/comm", "IO iothread0\n")
+	writeTestProcFile(t, dir, "123/task/131/comm", "IO iothread1\n")
+	writeTestProcFile(t, dir, "123/task/132/comm", "CPU 0/KVM\n")
+
+	pid, err := deviceModelPid(5)
+	if err != nil || pid != 123 {
+		t.Errorf("deviceModelPid got %d %v\n", pid, err)
+	}
+	if _, err := deviceModelPid(1); err == nil {
+		t.Errorf("deviceModelPid found a qemu for domain 1\n")
+	}
+	tids, err := ioThreadIds(pid)
+	if err != nil || !reflect.DeepEqual(tids, []int{130, 131}) {
+		t.Errorf("ioThreadIds got %v %v\n", tids, err)
+	}
+	tids, err = ioThreadIds(100)
+	if err != nil || len(tids) != 0 {
+		t.Errorf("ioThreadIds got %v %v for no threads\n", tids, err)
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/go-cmp/cmp"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/api/zconfig"
 	"github.com/zededa/go-provision/agentlog"
@@ -106,6 +105,7 @@ func Run() {
 	stillRunning := time.NewTicker(25 * time.Second)
 	agentlog.StillRunning(agentName)
 
+	zedcloud.InitBandwidth(agentName)
 	cms := zedcloud.GetCloudMetrics() // Need type of data
 	pub, err := pubsub.Publish(agentName, cms)
 	if err != nil {
@@ -275,6 +275,9 @@ func Run() {
 			if err != nil {
 				log.Errorln(err)
 			}
+			if err := zedcloud.SaveBandwidth(false); err != nil {
+				log.Errorln(err)
+			}
 
 		case <-gc.C:
 			gcObjects(&ctx)
@@ -327,7 +330,11 @@ func lookupDownloaderStatus(ctx *downloaderContext, objType string,
 		log.Infof("lookupDownloaderStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastDownloaderStatus(st)
+	status, err := cast.CastDownloaderStatus(st)
+	if err != nil {
+		log.Errorf("lookupDownloaderStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupDownloaderStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -345,7 +352,11 @@ func lookupDownloaderConfig(ctx *downloaderContext, objType string,
 		log.Infof("lookupDownloaderConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastDownloaderConfig(c)
+	config, err := cast.CastDownloaderConfig(c)
+	if err != nil {
+		log.Errorf("lookupDownloaderConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupDownloaderConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -375,7 +386,11 @@ func handleDownloaderModify(ctxArg interface{}, objType string,
 
 	log.Infof("handleDownloaderModify(%s)\n", key)
 	ctx := ctxArg.(*downloaderContext)
-	config := cast.CastDownloaderConfig(configArg)
+	config, err := cast.CastDownloaderConfig(configArg)
+	if err != nil {
+		log.Errorf("handleDownloaderModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleDownloaderModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -426,7 +441,11 @@ func runHandler(ctx *downloaderContext, objType string, key string,
 		select {
 		case configArg, ok := <-c:
 			if ok {
-				config := cast.CastDownloaderConfig(configArg)
+				config, err := cast.CastDownloaderConfig(configArg)
+				if err != nil {
+					log.Errorf("runHandler: %s\n", err)
+					continue
+				}
 				status := lookupDownloaderStatus(ctx,
 					objType, key)
 				if status == nil {
@@ -459,11 +478,11 @@ func runHandler(ctx *downloaderContext, objType string, key string,
 func maybeRetryDownload(ctx *downloaderContext,
 	status *types.DownloaderStatus) {
 
-	if status.LastErr == "" {
+	if status.Error == "" {
 		return
 	}
 	t := time.Now()
-	elapsed := t.Sub(status.LastErrTime)
+	elapsed := t.Sub(status.ErrorTime)
 	if elapsed < downloadRetryTime {
 		log.Infof("maybeRetryDownload(%s) %v remaining\n",
 			status.Key(),
@@ -471,7 +490,7 @@ func maybeRetryDownload(ctx *downloaderContext,
 		return
 	}
 	log.Infof("maybeRetryDownload(%s) after %s at %v\n",
-		status.Key(), status.LastErr, status.LastErrTime)
+		status.Key(), status.Error, status.ErrorTime)
 
 	config := lookupDownloaderConfig(ctx, status.ObjType, status.Key())
 	if config == nil {
@@ -479,8 +498,7 @@ func maybeRetryDownload(ctx *downloaderContext,
 			status.Key())
 		return
 	}
-	status.LastErr = ""
-	status.LastErrTime = time.Time{}
+	status.ClearError()
 	status.RetryCount += 1
 	// XXX do we need to adjust reservedspace??
 
@@ -520,8 +538,7 @@ func handleCreate(ctx *downloaderContext, objType string,
 		log.Errorln(errString)
 		status.PendingAdd = false
 		status.Size = 0
-		status.LastErr = errString
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(errString)
 		status.RetryCount += 1
 		publishDownloaderStatus(ctx, &status)
 		log.Errorf("handleCreate failed for %s\n", config.DownloadURL)
@@ -537,8 +554,7 @@ func handleCreate(ctx *downloaderContext, objType string,
 		log.Errorln(errString)
 		status.PendingAdd = false
 		status.Size = 0
-		status.LastErr = errString
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(errString)
 		status.RetryCount += 1
 		publishDownloaderStatus(ctx, &status)
 		log.Errorf("handleCreate deferred for %s\n", config.DownloadURL)
@@ -572,7 +588,7 @@ func handleModify(ctx *downloaderContext, key string,
 	// If the sha changes, we treat it as a delete and recreate.
 	// Ditto if we had a failure.
 	if (status.ImageSha256 != "" && status.ImageSha256 != config.ImageSha256) ||
-		status.LastErr != "" {
+		status.Error != "" {
 		reason := ""
 		if status.ImageSha256 != config.ImageSha256 {
 			reason = "sha256 changed"
@@ -645,6 +661,15 @@ func deletefile(dirname string, status *types.DownloaderStatus) {
 					filename, err)
 			}
 		}
+		// Left behind by an interrupted HTTP download
+		partFilename := filename + ".part"
+		if _, err := os.Stat(partFilename); err == nil {
+			log.Infof("Deleting %s\n", partFilename)
+			if err := os.Remove(partFilename); err != nil {
+				log.Errorf("Failed to remove %s: err %s\n",
+					partFilename, err)
+			}
+		}
 	}
 }
 
@@ -713,7 +738,11 @@ func handleGlobalDownloadConfigModify(ctxArg interface{}, key string,
 	configArg interface{}) {
 
 	ctx := ctxArg.(*downloaderContext)
-	config := cast.CastGlobalDownloadConfig(configArg)
+	config, err := cast.CastGlobalDownloadConfig(configArg)
+	if err != nil {
+		log.Errorf("handleGlobalDownloadConfigModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Errorf("handleGlobalDownloadConfigModify: unexpected key %s\n", key)
 		return
@@ -786,7 +815,11 @@ func gcObjects(ctx *downloaderContext) {
 	for _, pub := range publications {
 		items := pub.GetAll()
 		for key, st := range items {
-			status := cast.CastDownloaderStatus(st)
+			status, err := cast.CastDownloaderStatus(st)
+			if err != nil {
+				log.Errorf("gcObjects: %s\n", err)
+				continue
+			}
 			if status.Key() != key {
 				log.Errorf("gcObjects key/UUID mismatch %s vs %s; ignored %+v\n",
 					key, status.Key(), status)
@@ -940,83 +973,59 @@ func downloaderSubscription(ctx *downloaderContext, objType string) *pubsub.Subs
 
 // cloud storage interface functions/APIs
 
-func doHttp(ctx *downloaderContext, status *types.DownloaderStatus,
-	syncOp zedUpload.SyncOpType, serverUrl, dpath string, maxsize uint64,
-	ifname string, ipSrc net.IP, filename, locFilename string) error {
-
-	auth := &zedUpload.AuthInput{
-		AuthType: "http",
-	}
+// Number of times zedcloud.DownloadOnIntf resumes after an interruption
+const httpMaxResume = 3
 
-	trType := zedUpload.SyncHttpTr
+// doHttp downloads using zedcloud.DownloadOnIntf which also records the
+// metrics and bandwidth for ifname
+func doHttp(ctx *downloaderContext, status *types.DownloaderStatus,
+	downloadUrl string, imageSha256 string, maxsize uint64, ifname string,
+	locFilename string) error {
 
-	// create Endpoint
-	dEndPoint, err := ctx.dCtx.NewSyncerDest(trType, serverUrl, dpath, auth)
-	if err != nil {
-		log.Errorf("NewSyncerDest failed: %s\n", err)
-		return err
+	zedcloudCtx := zedcloud.ZedCloudContext{
+		DeviceNetworkStatus: &ctx.deviceNetworkStatus,
+		FailureFunc:         zedcloud.ZedCloudFailure,
+		SuccessFunc:         zedcloud.ZedCloudSuccess,
+		NoLedManager:        true,
+		Category:            zedcloud.CategoryImage,
 	}
-	proxyUrl, err := zedcloud.LookupProxy(
-		&ctx.deviceNetworkStatus, ifname, serverUrl)
-	if err == nil && proxyUrl != nil {
-		log.Infof("doHttp: Using proxy %s", proxyUrl.String())
-		dEndPoint.WithSrcIpAndProxySelection(ipSrc, proxyUrl)
-	} else {
-		dEndPoint.WithSrcIpSelection(ipSrc)
-	}
-	var respChan = make(chan *zedUpload.DronaRequest)
-
-	log.Infof("doHttp syncOp for <%s>, <%s>, <%s>\n", serverUrl, dpath,
-		filename)
-	// create Request
-	// Round up from bytes to Mbytes
+	// Round up to Mbytes as the size limit has always been
 	maxMB := (maxsize + 1024*1024 - 1) / (1024 * 1024)
-	req := dEndPoint.NewRequest(syncOp, filename, locFilename, int64(maxMB), true, respChan)
-	if req == nil {
-		return errors.New("NewRequest failed")
-	}
-
-	req.Post()
-	for {
-		select {
-		case resp, ok := <-respChan:
-			if resp.IsDnUpdate() {
-				asize := resp.GetAsize()
-				osize := resp.GetOsize()
-				log.Infof("Update progress for %v: %v/%v",
-					resp.GetLocalName(), asize, osize)
-				if osize == 0 {
-					status.Progress = 0
-				} else {
-					percent := 100 * asize / osize
-					status.Progress = uint(percent)
-				}
-				publishDownloaderStatus(ctx, status)
-				continue
+	dreq := zedcloud.DownloadRequest{
+		Url:       downloadUrl,
+		Filename:  locFilename,
+		Sha256:    imageSha256,
+		MaxSize:   int64(maxMB * 1024 * 1024),
+		MaxResume: httpMaxResume,
+		Progress: func(downloaded int64, total int64) {
+			if total == 0 {
+				total = int64(maxsize)
 			}
-			if !ok {
-				errStr := fmt.Sprintf("respChan EOF for <%s>, <%s>",
-					serverUrl, filename)
-				log.Errorln(errStr)
-				return errors.New(errStr)
+			if total == 0 {
+				return
 			}
-			if syncOp == zedUpload.SyncOpDownload {
-				err = resp.GetDnStatus()
-			} else {
-				_, err = resp.GetUpStatus()
+			percent := uint(100 * downloaded / total)
+			if percent > 100 {
+				percent = 100
 			}
-			if resp.IsError() {
-				return err
-			} else {
-				log.Infof("Done for %v: size %v/%v",
-					resp.GetLocalName(),
-					resp.GetAsize(), resp.GetOsize())
-				status.Progress = 100
+			// Only publish when the percentage changes
+			if percent != status.Progress {
+				status.Progress = percent
 				publishDownloaderStatus(ctx, status)
-				return nil
 			}
-		}
+		},
 	}
+	log.Infof("doHttp <%s> to <%s> using %s\n", downloadUrl, locFilename,
+		ifname)
+	res, err := zedcloud.DownloadOnIntf(zedcloudCtx, dreq, ifname)
+	if err != nil {
+		return err
+	}
+	log.Infof("Done for %s: size %d resumed %d times\n",
+		locFilename, res.Size, res.Resumed)
+	status.Progress = 100
+	publishDownloaderStatus(ctx, status)
+	return nil
 }
 
 func doS3(ctx *downloaderContext, status *types.DownloaderStatus,
@@ -1042,7 +1051,7 @@ func doS3(ctx *downloaderContext, status *types.DownloaderStatus,
 	proxyUrl, err := zedcloud.LookupProxy(
 		&ctx.deviceNetworkStatus, ifname, dnldUrl)
 	if err == nil && proxyUrl != nil {
-		log.Infof("doS3: Using proxy %s", proxyUrl.String())
+		log.Infof("doS3: Using proxy %s", zedcloud.RedactedProxy(proxyUrl))
 		dEndPoint.WithSrcIpAndProxySelection(ipSrc, proxyUrl)
 	} else {
 		dEndPoint.WithSrcIpSelection(ipSrc)
@@ -1271,6 +1280,8 @@ func handleSyncOp(ctx *downloaderContext, key string,
 				size := info.Size()
 				zedcloud.ZedCloudSuccess(ifname,
 					metricsUrl, 1024, size)
+				zedcloud.AddBandwidth(ifname,
+					zedcloud.CategoryImage, 1024, size)
 				handleSyncOpResponse(ctx, config, status,
 					locFilename, key, "")
 				return
@@ -1294,26 +1305,20 @@ func handleSyncOp(ctx *downloaderContext, key string,
 				size := info.Size()
 				zedcloud.ZedCloudSuccess(ifname,
 					metricsUrl, 1024, size)
+				zedcloud.AddBandwidth(ifname,
+					zedcloud.CategoryImage, 1024, size)
 				handleSyncOpResponse(ctx, config, status,
 					locFilename, key, "")
 				return
 			}
 		case zconfig.DsType_DsHttp.String(), zconfig.DsType_DsHttps.String(), "":
-			serverUrl := getServerUrl(config, filename)
-			err = doHttp(ctx, status, syncOp, serverUrl, config.Dpath,
-				config.Size, ifname, ipSrc, filename, locFilename)
+			err = doHttp(ctx, status, config.DownloadURL,
+				config.ImageSha256, config.Size, ifname, locFilename)
 			if err != nil {
 				log.Errorf("Source IP %s failed: %s\n",
 					ipSrc.String(), err)
 				errStr = errStr + "\n" + err.Error()
-				zedcloud.ZedCloudFailure(ifname,
-					metricsUrl, 1024, 0)
 			} else {
-				// Record how much we downloaded
-				info, _ := os.Stat(locFilename)
-				size := info.Size()
-				zedcloud.ZedCloudSuccess(ifname,
-					metricsUrl, 1024, size)
 				handleSyncOpResponse(ctx, config, status,
 					locFilename, key, "")
 				return
@@ -1352,8 +1357,7 @@ func handleSyncOpResponse(ctx *downloaderContext, config types.DownloaderConfig,
 		doDelete(ctx, key, locDirname, status)
 		status.PendingAdd = false
 		status.Size = 0
-		status.LastErr = errStr
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(errStr)
 		status.RetryCount += 1
 		publishDownloaderStatus(ctx, status)
 		log.Errorf("handleSyncOpResponse failed for %s, <%s>\n",
@@ -1369,8 +1373,7 @@ func handleSyncOpResponse(ctx *downloaderContext, config types.DownloaderConfig,
 		doDelete(ctx, key, locDirname, status)
 		status.PendingAdd = false
 		status.Size = 0
-		status.LastErr = fmt.Sprintf("%v", err)
-		status.LastErrTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%v", err))
 		status.RetryCount += 1
 		publishDownloaderStatus(ctx, status)
 		return
@@ -1395,7 +1398,11 @@ func handleSyncOpResponse(ctx *downloaderContext, config types.DownloaderConfig,
 func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 
 	ctx := ctxArg.(*downloaderContext)
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
 		return
@@ -1405,7 +1412,7 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
+	if ctx.deviceNetworkStatus.Equal(status) {
 		log.Infof("handleDNSModify unchanged\n")
 		return
 	}
@@ -1442,12 +1449,8 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 	debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
 	if gcp != nil {
-		if gcp.DownloadGCTime != 0 {
-			downloadGCTime = time.Duration(gcp.DownloadGCTime) * time.Second
-		}
-		if gcp.DownloadRetryTime != 0 {
-			downloadRetryTime = time.Duration(gcp.DownloadRetryTime) * time.Second
-		}
+		downloadGCTime = gcp.GetDownloadGCTime()
+		downloadRetryTime = gcp.GetDownloadRetryTime()
 	}
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
@@ -0,0 +1,150 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Drive the hardware watchdog as long as the agents given as arguments
+// keep on calling agentlog.StillRunning and their pidfile processes exist.
+// An agent which has not yet called it is not checked since the agents are
+// started in stages. Once an agent is stale or gone we report it and stop
+// pinging hence the hardware resets the device.
+
+package hwwatchdog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/hardware"
+	"github.com/zededa/go-provision/pidfile"
+)
+
+const (
+	agentName    = "hwwatchdog"
+	reportBinary = "/opt/zededa/bin/watchdog-report.sh"
+)
+
+// Set from Makefile
+var Version = "No version specified"
+
+func Run() {
+	versionPtr := flag.Bool("v", false, "Version")
+	debugPtr := flag.Bool("d", false, "Debug flag")
+	curpartPtr := flag.String("c", "", "Current partition")
+	devicePtr := flag.String("D", hardware.WatchdogDevice, "Watchdog device")
+	timeoutPtr := flag.Int("t", 60, "Hardware timeout in seconds")
+	intervalPtr := flag.Int("i", 10, "Ping interval in seconds")
+	maxAgePtr := flag.Int("a", 300, "Max seconds since StillRunning")
+	flag.Parse()
+	if *debugPtr {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+	if *versionPtr {
+		fmt.Printf("%s: %s\n", os.Args[0], Version)
+		return
+	}
+	logf, err := agentlog.Init(agentName, *curpartPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logf.Close()
+	if err := pidfile.CheckAndCreatePidfile(agentName); err != nil {
+		log.Fatal(err)
+	}
+	agents := flag.Args()
+	log.Infof("Starting %s for %v\n", agentName, agents)
+
+	wd, err := hardware.OpenWatchdog(*devicePtr,
+		time.Duration(*timeoutPtr)*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interval := time.Duration(*intervalPtr) * time.Second
+	if wd.Timeout != 0 && interval >= wd.Timeout {
+		interval = wd.Timeout / 2
+		log.Warnf("Ping interval reduced to %v\n", interval)
+	}
+	maxAge := time.Duration(*maxAgePtr) * time.Second
+
+	if err := wd.Ping(); err != nil {
+		log.Errorf("Ping failed: %s\n", err)
+	}
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		reason, filename := checkAgents(agents, maxAge)
+		if reason != "" {
+			// Keep the device open until the reset
+			log.Errorf("%s; no longer pinging %s\n", reason, *devicePtr)
+			ticker.Stop()
+			report(filename)
+			select {}
+		}
+		if err := wd.Ping(); err != nil {
+			log.Errorf("Ping failed: %s\n", err)
+		}
+	}
+}
+
+// Replaced by the tests
+var stillRunningAge = agentlog.StillRunningAge
+var isRunning = pidfile.IsRunning
+
+// checkAgents returns why we should stop pinging, if so, and the file to
+// pass to the report
+func checkAgents(agents []string, maxAge time.Duration) (string, string) {
+	agent, age := staleAgent(agents, maxAge)
+	if agent != "" {
+		reason := fmt.Sprintf("%s did not call StillRunning for %v",
+			agent, age)
+		return reason, agentlog.StillRunningFilename(agent)
+	}
+	agent = exitedAgent(agents)
+	if agent != "" {
+		return agent + " exited", pidfile.Filename(agent)
+	}
+	return "", ""
+}
+
+// staleAgent returns the first agent which has not called StillRunning
+// within maxAge
+func staleAgent(agents []string, maxAge time.Duration) (string, time.Duration) {
+	for _, agent := range agents {
+		age, err := stillRunningAge(agent)
+		if err != nil {
+			log.Debugf("staleAgent(%s): %s\n", agent, err)
+			continue
+		}
+		if age > maxAge {
+			return agent, age
+		}
+	}
+	return "", 0
+}
+
+// exitedAgent returns the first agent which has started but whose process
+// is gone
+func exitedAgent(agents []string) string {
+	for _, agent := range agents {
+		if _, err := stillRunningAge(agent); err != nil {
+			continue
+		}
+		if !isRunning(agent) {
+			return agent
+		}
+	}
+	return ""
+}
+
+// report records the reason in /persist/reboot-reason and asks the agent
+// for a stack trace, same as for watchdog(8)
+func report(filename string) {
+	cmd := exec.Command(reportBinary, agentName, filename)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Infof("%s: %s %s\n", reportBinary, err, string(out))
+	}
+}
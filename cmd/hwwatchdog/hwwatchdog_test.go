@@ -0,0 +1,47 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hwwatchdog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAgents(t *testing.T) {
+	ages := map[string]time.Duration{
+		"zedagent": 10 * time.Second,
+		"nim":      20 * time.Second,
+	}
+	running := map[string]bool{"zedagent": true, "nim": true}
+	stillRunningAge = func(agent string) (time.Duration, error) {
+		age, ok := ages[agent]
+		if !ok {
+			return 0, errors.New("not started")
+		}
+		return age, nil
+	}
+	isRunning = func(agent string) bool { return running[agent] }
+
+	// Not yet started agents are not checked
+	agents := []string{"zedagent", "nim", "zedrouter"}
+	if reason, _ := checkAgents(agents, time.Minute); reason != "" {
+		t.Errorf("Got %s\n", reason)
+	}
+
+	running["nim"] = false
+	reason, filename := checkAgents(agents, time.Minute)
+	if reason != "nim exited" || filename != "/var/run/nim.pid" {
+		t.Errorf("Got %s %s\n", reason, filename)
+	}
+
+	// Stale is reported first
+	ages["zedagent"] = 2 * time.Minute
+	reason, filename = checkAgents(agents, time.Minute)
+	if !strings.HasPrefix(reason, "zedagent did not call StillRunning") ||
+		filename != "/var/run/zedagent.touch" {
+		t.Errorf("Got %s %s\n", reason, filename)
+	}
+}
@@ -165,7 +165,11 @@ func handleEIDConfigModify(ctxArg interface{}, key string, configArg interface{}
 
 	log.Infof("handleEIDConfigModify(%s)\n", key)
 	ctx := ctxArg.(*identityContext)
-	config := cast.CastEIDConfig(configArg)
+	config, err := cast.CastEIDConfig(configArg)
+	if err != nil {
+		log.Errorf("handleEIDConfigModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleEIDConfigModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -203,7 +207,11 @@ func lookupEIDStatus(ctx *identityContext, key string) *types.EIDStatus {
 		log.Infof("lookupEIDStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastEIDStatus(st)
+	status, err := cast.CastEIDStatus(st)
+	if err != nil {
+		log.Errorf("lookupEIDStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupEIDStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -220,7 +228,11 @@ func lookupEIDConfig(ctx *identityContext, key string) *types.EIDConfig {
 		log.Infof("lookupEIDConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastEIDConfig(c)
+	config, err := cast.CastEIDConfig(c)
+	if err != nil {
+		log.Errorf("lookupEIDConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupEIDConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -20,7 +20,6 @@ package ledmanager
 import (
 	"flag"
 	"fmt"
-	"github.com/google/go-cmp/cmp"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/agentlog"
 	"github.com/zededa/go-provision/cast"
@@ -42,13 +41,13 @@ const (
 // State passed to handlers
 type ledManagerContext struct {
 	countChange            chan int
-	ledCounter             int // Supress work and logging if no change
+	deviceState            types.DeviceStateCode // Supress work and logging if no change
 	subGlobalConfig        *pubsub.Subscription
 	subLedBlinkCounter     *pubsub.Subscription
 	subDeviceNetworkStatus *pubsub.Subscription
 	deviceNetworkStatus    types.DeviceNetworkStatus
 	usableAddressCount     int
-	derivedLedCounter      int // Based on ledCounter + usableAddressCount
+	derivedState           types.DeviceStateCode // Based on deviceState + usableAddressCount
 }
 
 type Blink200msFunc func()
@@ -218,7 +217,11 @@ func Run() {
 func handleLedBlinkModify(ctxArg interface{}, key string,
 	configArg interface{}) {
 
-	config := cast.CastLedBlinkCounter(configArg)
+	config, err := cast.CastLedBlinkCounter(configArg)
+	if err != nil {
+		log.Errorf("handleLedBlinkModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*ledManagerContext)
 
 	if key != "ledconfig" {
@@ -226,15 +229,15 @@ func handleLedBlinkModify(ctxArg interface{}, key string,
 		return
 	}
 	// Supress work and logging if no change
-	if config.BlinkCounter == ctx.ledCounter {
+	if config.DeviceState == ctx.deviceState {
 		return
 	}
-	ctx.ledCounter = config.BlinkCounter
-	ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+	ctx.deviceState = config.DeviceState
+	ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 		ctx.usableAddressCount)
-	log.Infof("counter %d usableAddr %d, derived %d\n",
-		ctx.ledCounter, ctx.usableAddressCount, ctx.derivedLedCounter)
-	ctx.countChange <- ctx.derivedLedCounter
+	log.Infof("state %s usableAddr %d, derived %s\n",
+		ctx.deviceState, ctx.usableAddressCount, ctx.derivedState)
+	ctx.countChange <- blinkCount(ctx.derivedState)
 	log.Infof("handleLedBlinkModify done for %s\n", key)
 }
 
@@ -249,15 +252,33 @@ func handleLedBlinkDelete(ctxArg interface{}, key string,
 		return
 	}
 	// XXX or should we tell the blink go routine to exit?
-	ctx.ledCounter = 0
-	ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+	ctx.deviceState = types.DeviceStateUnknown
+	ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 		ctx.usableAddressCount)
-	log.Infof("counter %d usableAddr %d, derived %d\n",
-		ctx.ledCounter, ctx.usableAddressCount, ctx.derivedLedCounter)
-	ctx.countChange <- ctx.derivedLedCounter
+	log.Infof("state %s usableAddr %d, derived %s\n",
+		ctx.deviceState, ctx.usableAddressCount, ctx.derivedState)
+	ctx.countChange <- blinkCount(ctx.derivedState)
 	log.Infof("handleLedBlinkDelete done for %s\n", key)
 }
 
+// Number of blinks for each device state. The numbers are what the
+// people installing devices have been told to look for.
+var stateBlinkCounts = map[types.DeviceStateCode]int{
+	types.DeviceStateNoDHCP:               1,
+	types.DeviceStateConnectingController: 2,
+	types.DeviceStateConnected:            3,
+	types.DeviceStateOnboarded:            4,
+	types.DeviceStateOnboardConflict:      10,
+	types.DeviceStateNoModel:              11,
+	types.DeviceStateNoTLS:                12,
+	types.DeviceStateBadOCSP:              13,
+}
+
+// blinkCount returns zero for unknown states
+func blinkCount(state types.DeviceStateCode) int {
+	return stateBlinkCounts[state]
+}
+
 func TriggerBlinkOnDevice(countChange chan int, blinkFunc Blink200msFunc) {
 	var counter int
 	for {
@@ -330,7 +351,11 @@ func ExecuteWifiLedCmd() {
 func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 
 	ctx := ctxArg.(*ledManagerContext)
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
 		return
@@ -340,7 +365,7 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
+	if ctx.deviceNetworkStatus.Equal(status) {
 		log.Infof("handleDNSModify no change\n")
 		return
 	}
@@ -350,11 +375,11 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 	if (ctx.usableAddressCount == 0 && newAddrCount != 0) ||
 		(ctx.usableAddressCount != 0 && newAddrCount == 0) {
 		ctx.usableAddressCount = newAddrCount
-		ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+		ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 			ctx.usableAddressCount)
-		log.Infof("counter %d usableAddr %d, derived %d\n",
-			ctx.ledCounter, ctx.usableAddressCount, ctx.derivedLedCounter)
-		ctx.countChange <- ctx.derivedLedCounter
+		log.Infof("state %s usableAddr %d, derived %s\n",
+			ctx.deviceState, ctx.usableAddressCount, ctx.derivedState)
+		ctx.countChange <- blinkCount(ctx.derivedState)
 	}
 	log.Infof("handleDNSModify done for %s\n", key)
 }
@@ -373,11 +398,11 @@ func handleDNSDelete(ctxArg interface{}, key string, statusArg interface{}) {
 	if (ctx.usableAddressCount == 0 && newAddrCount != 0) ||
 		(ctx.usableAddressCount != 0 && newAddrCount == 0) {
 		ctx.usableAddressCount = newAddrCount
-		ctx.derivedLedCounter = types.DeriveLedCounter(ctx.ledCounter,
+		ctx.derivedState = types.DeriveDeviceState(ctx.deviceState,
 			ctx.usableAddressCount)
-		log.Infof("counter %d usableAddr %d, derived %d\n",
-			ctx.ledCounter, ctx.usableAddressCount, ctx.derivedLedCounter)
-		ctx.countChange <- ctx.derivedLedCounter
+		log.Infof("state %s usableAddr %d, derived %s\n",
+			ctx.deviceState, ctx.usableAddressCount, ctx.derivedState)
+		ctx.countChange <- blinkCount(ctx.derivedState)
 	}
 	log.Infof("handleDNSDelete done for %s\n", key)
 }
@@ -23,7 +23,11 @@ func handleDomainStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleDomainStatusModify for %s\n", key)
-	status := cast.CastDomainStatus(statusArg)
+	status, err := cast.CastDomainStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDomainStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleDomainStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -40,7 +44,11 @@ func handleDomainStatusDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleDomainStatusDelete for %s\n", key)
-	status := cast.CastDomainStatus(statusArg)
+	status, err := cast.CastDomainStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDomainStatusDelete: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleDomainStatusDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
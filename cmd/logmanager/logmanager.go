@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
-	"github.com/google/go-cmp/cmp"
 	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/api/zmet"
@@ -35,7 +34,6 @@ import (
 const (
 	agentName        = "logmanager"
 	identityDirname  = "/config"
-	serverFilename   = identityDirname + "/server"
 	uuidFileName     = identityDirname + "/uuid"
 	xenLogDirname    = "/var/log/xen"
 	lastSentDirname  = "lastlogsent"  // Directory in /persist/
@@ -175,6 +173,7 @@ func Run() {
 			log.Fatal(err)
 		}
 	}
+	zedcloud.InitBandwidth(agentName)
 	cms := zedcloud.GetCloudMetrics() // Need type of data
 	pub, err := pubsub.Publish(agentName, cms)
 	if err != nil {
@@ -324,6 +323,9 @@ func Run() {
 			if err != nil {
 				log.Errorln(err)
 			}
+			if err := zedcloud.SaveBandwidth(false); err != nil {
+				log.Errorln(err)
+			}
 		case change := <-deferredChan:
 			done := zedcloud.HandleDeferred(change, 1*time.Second)
 			dbg.FreeOSMemory()
@@ -364,7 +366,11 @@ func handleXenLogDir(logDirChanges chan string, logDirName string,
 
 func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DNSContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -375,7 +381,7 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(deviceNetworkStatus, status) {
+	if deviceNetworkStatus.Equal(status) {
 		log.Infof("handleDNSModify no change\n")
 		return
 	}
@@ -615,17 +621,17 @@ func sendProtoStrForLogs(reportLogs *zmet.LogBundle, image string,
 		log.Infof("SendProtoStrForLogs queued after existing for %s\n",
 			image)
 		zedcloud.AddDeferred(image, buf, size, logsUrl, zedcloudCtx,
-			return400)
+			return400, zedcloud.DeferredLow)
 		reportLogs.Log = []*zmet.LogEntry{}
 		return false
 	}
-	resp, _, err := zedcloud.SendOnAllIntf(zedcloudCtx, logsUrl,
+	res, err := zedcloud.SendOnAllIntf(zedcloudCtx, logsUrl,
 		size, buf, iteration, return400)
 	// XXX We seem to still get large or bad messages which are rejected
 	// by the server. Ignore them to make sure we can log subsequent ones.
 	// XXX Should we inject a separate log entry to record that we dropped
 	// this one?
-	if resp != nil && resp.StatusCode == 400 {
+	if res.HasStatus(400) {
 		log.Errorf("Failed sending %d bytes image %s to %s; code 400; ignored error\n",
 			size, image, logsUrl)
 		reportLogs.Log = []*zmet.LogEntry{}
@@ -638,7 +644,7 @@ func sendProtoStrForLogs(reportLogs *zmet.LogBundle, image string,
 		// will sleep until the timer takes care of sending this
 		// hence we'll keep things in order for a given image
 		zedcloud.AddDeferred(image, buf, size, logsUrl, zedcloudCtx,
-			return400)
+			return400, zedcloud.DeferredLow)
 		reportLogs.Log = []*zmet.LogEntry{}
 		return false
 	}
@@ -648,13 +654,13 @@ func sendProtoStrForLogs(reportLogs *zmet.LogBundle, image string,
 }
 
 func sendCtxInit() {
-	//get server name
-	bytes, err := ioutil.ReadFile(serverFilename)
+	//get server name; the requests fail over to the others
+	servers, err := zedcloud.NewServerList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	strTrim := strings.TrimSpace(string(bytes))
-	serverName = strings.Split(strTrim, ":")[0]
+	serverName = servers.CurrentHost()
+	zedcloudCtx.Servers = servers
 
 	//set log url
 	logsUrl = serverName + "/" + logsApi
@@ -665,8 +671,17 @@ func sendCtxInit() {
 	}
 	zedcloudCtx.DeviceNetworkStatus = deviceNetworkStatus
 	zedcloudCtx.TlsConfig = tlsConfig
+	zedcloudCtx.CertProvider = zedcloud.DeviceCertProvider()
+	zedcloudCtx.AuthProviders, err = zedcloud.ReadAuthProviders(
+		zedcloud.AuthConfigFilename)
+	if err != nil {
+		log.Errorln(err)
+	}
 	zedcloudCtx.FailureFunc = zedcloud.ZedCloudFailure
 	zedcloudCtx.SuccessFunc = zedcloud.ZedCloudSuccess
+	zedcloudCtx.CompressionFunc = zedcloud.ZedCloudCompressed
+	zedcloudCtx.PostResponseHooks = append(zedcloudCtx.PostResponseHooks,
+		zedcloud.ZedCloudMetricsHook)
 
 	// In case we run early, wait for UUID file to appear
 	for {
@@ -971,9 +986,17 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 		return
 	}
 	log.Infof("handleGlobalConfigModify for %s\n", key)
-	status := cast.CastGlobalConfig(statusArg)
+	status, err := cast.CastGlobalConfig(statusArg)
+	if err != nil {
+		log.Errorf("handleGlobalConfigModify: %s\n", err)
+		return
+	}
 	debug, _ = agentlog.HandleGlobalConfigNoDefault(ctx.subGlobalConfig,
 		agentName, debugOverride)
+	sane := types.EnforceGlobalConfigMinimums(types.ApplyGlobalConfig(status))
+	sane = types.EnforceGlobalConfigMaximums(sane)
+	zedcloudCtx.Timeouts = zedcloud.TimeoutsFromGlobalConfig(sane)
+	zedcloudCtx.OCSPPolicy = sane.OCSPPolicy
 	foundAgents := make(map[string]bool)
 	if status.DefaultRemoteLogLevel != "" {
 		foundAgents["default"] = true
@@ -10,6 +10,7 @@
 package nim
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -29,6 +30,7 @@ import (
 	"github.com/zededa/go-provision/pidfile"
 	"github.com/zededa/go-provision/pubsub"
 	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
 )
 
 const (
@@ -41,16 +43,29 @@ const (
 type nimContext struct {
 	devicenetwork.DeviceNetworkContext
 	subGlobalConfig *pubsub.Subscription
-	GCInitialized   bool // Received initial GlobalConfig
 	globalConfig    *types.GlobalConfig
 	sshAccess       bool
 	allowAppVnc     bool
 
+	sshAllowedPrefixes []string
+	vncAllowedPrefixes []string
+	sshRateLimit       uint32
+	sshRateLimitDrops  uint64 // Last reported
+	mgmtIcmp           iptables.IcmpPolicy
+	appIcmp            iptables.IcmpPolicy
+	rejectLogRate      uint32
+	rejectLog          rejectLog
+	pubFirewallStatus  *pubsub.Publication
+
 	subNetworkInstanceStatus *pubsub.Subscription
 
 	networkFallbackAnyEth types.TriState
+	geoTimer              flextimer.FlexTickerHandle
+	lastTriggeredTest     time.Time // By link or address change
 	fallbackPortMap       map[string]bool
 	filteredFallback      map[string]bool
+	usbNetworkDevices     map[string]time.Time // Zero time if at startup
+	usbSynchronized       bool
 
 	// CLI args
 	debug         bool
@@ -103,7 +118,7 @@ func waitForDeviceNetworkConfigFile() string {
 			break
 		}
 		// Tell the world that we have issues
-		types.UpdateLedManagerConfig(11)
+		types.UpdateLedManagerConfig(types.DeviceStateNoModel)
 		log.Warningln(err)
 		log.Warningf("You need to create this file for this hardware: %s\n",
 			DNCFilename)
@@ -120,11 +135,14 @@ func waitForDeviceNetworkConfigFile() string {
 // Run - Main function - invoked from zedbox.go
 func Run() {
 	nimCtx := nimContext{
-		fallbackPortMap:  make(map[string]bool),
-		filteredFallback: make(map[string]bool),
+		fallbackPortMap:   make(map[string]bool),
+		filteredFallback:  make(map[string]bool),
+		usbNetworkDevices: make(map[string]time.Time),
 	}
 	nimCtx.AssignableAdapters = &types.AssignableAdapters{}
 	nimCtx.sshAccess = true // Kernel default - no iptables filters
+	nimCtx.mgmtIcmp = iptables.IcmpAllowAll
+	nimCtx.appIcmp = iptables.IcmpAllowAll
 	nimCtx.globalConfig = &types.GlobalConfigDefaults
 
 	nimCtx.processArgs()
@@ -178,6 +196,20 @@ func Run() {
 	}
 	pubDevicePortConfigList.ClearRestarted()
 
+	pubFirewallStatus, err := pubsub.Publish(agentName,
+		types.FirewallStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	nimCtx.pubFirewallStatus = pubFirewallStatus
+
+	pubRejectedConnections, err := pubsub.Publish(agentName,
+		types.RejectedConnections{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	nimCtx.rejectLog.pub = pubRejectedConnections
+
 	// Look for global config such as log levels
 	subGlobalConfig, err := pubsub.Subscribe("", types.GlobalConfig{},
 		false, &nimCtx)
@@ -186,7 +218,7 @@ func Run() {
 	}
 	subGlobalConfig.ModifyHandler = handleGlobalConfigModify
 	subGlobalConfig.DeleteHandler = handleGlobalConfigDelete
-	subGlobalConfig.SynchronizedHandler = handleGlobalConfigSynchronized
+	subGlobalConfig.InitialStateHandler = handleGlobalConfigInitialState
 	nimCtx.subGlobalConfig = subGlobalConfig
 	subGlobalConfig.Activate()
 
@@ -195,7 +227,11 @@ func Run() {
 	nimCtx.DevicePortConfig = &types.DevicePortConfig{}
 	item, _ := pubDevicePortConfigList.Get("global")
 	if item != nil {
-		dpcl := cast.CastDevicePortConfigList(item)
+		dpcl, err := cast.CastDevicePortConfigList(item)
+		if err != nil {
+			log.Errorf("Run: %s\n", err)
+			return
+		}
 		nimCtx.DevicePortConfigList = &dpcl
 		log.Infof("Initial DPCL %+v\n", nimCtx.DevicePortConfigList)
 	} else {
@@ -217,6 +253,7 @@ func Run() {
 	}
 	subDeviceNetworkConfig.ModifyHandler = devicenetwork.HandleDNCModify
 	subDeviceNetworkConfig.DeleteHandler = devicenetwork.HandleDNCDelete
+	subDeviceNetworkConfig.InitialStateHandler = handleDNCInitialState
 	nimCtx.SubDeviceNetworkConfig = subDeviceNetworkConfig
 	subDeviceNetworkConfig.Activate()
 
@@ -278,15 +315,28 @@ func Run() {
 	nimCtx.subNetworkInstanceStatus = subNetworkInstanceStatus
 	subNetworkInstanceStatus.Activate()
 
+	// USB devices which might be modems or NICs
+	subUsbDeviceStatus, err := pubsub.Subscribe("domainmgr",
+		types.UsbDeviceStatus{}, false, &nimCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	subUsbDeviceStatus.ModifyHandler = handleUsbDeviceModify
+	subUsbDeviceStatus.DeleteHandler = handleUsbDeviceDelete
+	subUsbDeviceStatus.SynchronizedHandler = handleUsbDeviceSynchronized
+	subUsbDeviceStatus.Activate()
+
 	devicenetwork.DoDNSUpdate(&nimCtx.DeviceNetworkContext)
 
 	// Apply any changes from the port config to date.
 	publishDeviceNetworkStatus(&nimCtx)
 
 	// Wait for initial GlobalConfig and the DeviceNetworkConfig
-	for !nimCtx.GCInitialized || !nimCtx.DNCInitialized {
-		log.Infof("Waiting for GCInitialized %v or DNCInitialized %v\n",
-			nimCtx.GCInitialized, nimCtx.DNCInitialized)
+	for !subGlobalConfig.InitialStateDone() ||
+		!subDeviceNetworkConfig.InitialStateDone() {
+		log.Infof("Waiting for initial GlobalConfig %v or DeviceNetworkConfig %v\n",
+			subGlobalConfig.InitialStateDone(),
+			subDeviceNetworkConfig.InitialStateDone())
 		select {
 		case change := <-subGlobalConfig.C:
 			subGlobalConfig.ProcessChange(change)
@@ -297,19 +347,20 @@ func Run() {
 	}
 
 	// We refresh the gelocation information when the underlay
-	// IP address(es) change, plus periodically based on this timer
-	geoRedoTime := time.Duration(nimCtx.globalConfig.NetworkGeoRedoTime) * time.Second
+	// IP address(es) change, plus periodically based on
+	// NetworkGeoRedoTime which is re-read on each geoTimer
 
-	// Timer for retries after failure etc. Should be less than geoRedoTime
-	geoInterval := time.Duration(nimCtx.globalConfig.NetworkGeoRetryTime) * time.Second
-	geoMax := float64(geoInterval)
-	geoMin := geoMax * 0.3
-	geoTimer := flextimer.NewRangeTicker(time.Duration(geoMin),
-		time.Duration(geoMax))
+	// Timer for retries after failure etc. Should be less than
+	// NetworkGeoRedoTime
+	geoMin, geoMax := geoTimerRange(nimCtx.globalConfig.GetNetworkGeoRetryTime())
+	geoTimer := flextimer.NewRangeTicker(geoMin, geoMax)
+	nimCtx.geoTimer = geoTimer
 
 	dnc := &nimCtx.DeviceNetworkContext
 	// TIme we wait for DHCP to get an address before giving up
-	dnc.DPCTestDuration = nimCtx.globalConfig.NetworkTestDuration
+	dnc.DPCTestDuration = uint32(nimCtx.globalConfig.GetNetworkTestDuration() / time.Second)
+	dnc.Timeouts = zedcloud.TimeoutsFromGlobalConfig(*nimCtx.globalConfig)
+	dnc.OCSPPolicy = nimCtx.globalConfig.OCSPPolicy
 
 	// Timer for checking/verifying pending device network status
 	// We stop this timer before using in the select loop below, because
@@ -322,14 +373,15 @@ func Run() {
 	dnc.Pending.PendTimer = pendTimer
 
 	// Periodic timer that tests device cloud connectivity
-	dnc.NetworkTestInterval = nimCtx.globalConfig.NetworkTestInterval
-	networkTestInterval := time.Duration(time.Duration(dnc.NetworkTestInterval) * time.Second)
+	networkTestInterval := nimCtx.globalConfig.GetNetworkTestInterval()
+	dnc.NetworkTestInterval = uint32(networkTestInterval / time.Second)
 	networkTestTimer := time.NewTimer(networkTestInterval)
 	dnc.NetworkTestTimer = networkTestTimer
 	// We start assuming cloud connectivity works
 	dnc.CloudConnectivityWorks = true
 
-	dnc.NetworkTestBetterInterval = nimCtx.globalConfig.NetworkTestBetterInterval
+	networkTestBetterInterval := nimCtx.globalConfig.GetNetworkTestBetterInterval()
+	dnc.NetworkTestBetterInterval = uint32(networkTestBetterInterval / time.Second)
 	if dnc.NetworkTestBetterInterval == 0 {
 		log.Warnln("NOT running TestBetterTimer")
 		// Dummy which is stopped needed for select loop
@@ -337,7 +389,6 @@ func Run() {
 		networkTestBetterTimer.Stop()
 		dnc.NetworkTestBetterTimer = networkTestBetterTimer
 	} else {
-		networkTestBetterInterval := time.Duration(dnc.NetworkTestBetterInterval) * time.Second
 		networkTestBetterTimer := time.NewTimer(networkTestBetterInterval)
 		dnc.NetworkTestBetterTimer = networkTestBetterTimer
 	}
@@ -375,6 +426,9 @@ func Run() {
 		case change := <-subNetworkInstanceStatus.C:
 			subNetworkInstanceStatus.ProcessChange(change)
 
+		case change := <-subUsbDeviceStatus.C:
+			subUsbDeviceStatus.ProcessChange(change)
+
 		case change, ok := <-addrChanges:
 			if !ok {
 				log.Errorf("addrChanges closed\n")
@@ -382,7 +436,7 @@ func Run() {
 				addrChanges = devicenetwork.AddrChangeInit()
 			} else {
 				if devicenetwork.AddrChange(change) {
-					devicenetwork.HandleAddressChange(&nimCtx.DeviceNetworkContext)
+					handleAddressChange(&nimCtx)
 				}
 			}
 
@@ -393,11 +447,18 @@ func Run() {
 				// XXX Need to discard all cached information?
 			} else if devicenetwork.LinkChange(change) {
 				handleLinkChange(&nimCtx)
-				// XXX trigger testing??
 			}
 
+		case ifname := <-devicenetwork.AddrConflictChanges:
+			log.Infof("AddrConflictChanges for %s\n", ifname)
+			handleAddressChange(&nimCtx)
+
+		case probe := <-devicenetwork.StaticAddrProbes:
+			devicenetwork.HandleStaticAddrProbe(probe)
+
 		case <-geoTimer.C:
 			log.Debugln("geoTimer at", time.Now())
+			geoRedoTime := nimCtx.globalConfig.GetNetworkGeoRedoTime()
 			change := devicenetwork.UpdateDeviceNetworkGeo(
 				geoRedoTime, nimCtx.DeviceNetworkStatus)
 			if change {
@@ -480,6 +541,9 @@ func Run() {
 		case change := <-subNetworkInstanceStatus.C:
 			subNetworkInstanceStatus.ProcessChange(change)
 
+		case change := <-subUsbDeviceStatus.C:
+			subUsbDeviceStatus.ProcessChange(change)
+
 		case change, ok := <-addrChanges:
 			if !ok {
 				log.Errorf("addrChanges closed\n")
@@ -487,7 +551,7 @@ func Run() {
 				// XXX Need to discard all cached information?
 			} else {
 				if devicenetwork.AddrChange(change) {
-					devicenetwork.HandleAddressChange(&nimCtx.DeviceNetworkContext)
+					handleAddressChange(&nimCtx)
 				}
 			}
 
@@ -498,11 +562,18 @@ func Run() {
 				// XXX Need to discard all cached information?
 			} else if devicenetwork.LinkChange(change) {
 				handleLinkChange(&nimCtx)
-				// XXX trigger testing??
 			}
 
+		case ifname := <-devicenetwork.AddrConflictChanges:
+			log.Infof("AddrConflictChanges for %s\n", ifname)
+			handleAddressChange(&nimCtx)
+
+		case probe := <-devicenetwork.StaticAddrProbes:
+			devicenetwork.HandleStaticAddrProbe(probe)
+
 		case <-geoTimer.C:
 			log.Debugln("geoTimer at", time.Now())
+			geoRedoTime := nimCtx.globalConfig.GetNetworkGeoRedoTime()
 			change := devicenetwork.UpdateDeviceNetworkGeo(
 				geoRedoTime, nimCtx.DeviceNetworkStatus)
 			if change {
@@ -550,15 +621,47 @@ func Run() {
 
 		case <-stillRunning.C:
 			agentlog.StillRunning(agentName)
+			// Restore any of our rules flushed by others
+			iptables.ReconcileAll()
+			status := iptables.FirewallStatus(agentName)
+			nimCtx.pubFirewallStatus.Publish(status.Key(), status)
+			checkSshRateLimitDrops(&nimCtx)
+			publishRejected(&nimCtx)
+
+		case packets := <-nimCtx.rejectLog.packets:
+			addRejected(&nimCtx, packets)
 		}
 	}
 }
 
+// Report ssh connections rejected by the rate limit e.g., due to
+// password guessing
+func checkSshRateLimitDrops(ctx *nimContext) {
+	if !ctx.sshAccess || ctx.sshRateLimit == 0 {
+		return
+	}
+	drops, err := iptables.SshRateLimitDrops()
+	if err != nil {
+		log.Errorf("checkSshRateLimitDrops: %s\n", err)
+		return
+	}
+	if drops < ctx.sshRateLimitDrops {
+		// Counters reset when the rules were re-added
+		ctx.sshRateLimitDrops = 0
+	}
+	if drops > ctx.sshRateLimitDrops {
+		log.Warnf("ssh rate limit rejected %d connections (%d total)\n",
+			drops-ctx.sshRateLimitDrops, drops)
+	}
+	ctx.sshRateLimitDrops = drops
+}
+
 func handleLinkChange(ctx *nimContext) {
 	// Create superset; update to have the latest upFlag
 	// Note that upFlag gets cleared when the device is assigned away to pciback
 	ifmap := devicenetwork.IfindexGetLastResortMap()
 	changed := false
+	var cameUp, newPorts []string
 	for ifname, upFlag := range ifmap {
 		v, ok := ctx.fallbackPortMap[ifname]
 		if ok && v == upFlag {
@@ -567,15 +670,79 @@ func handleLinkChange(ctx *nimContext) {
 		changed = true
 		if !ok {
 			log.Infof("fallbackPortMap added %s %t\n", ifname, upFlag)
+			newPorts = append(newPorts, ifname)
 		} else {
 			log.Infof("fallbackPortMap updated %s to %t\n", ifname, upFlag)
 		}
+		if upFlag {
+			cameUp = append(cameUp, ifname)
+		}
 		ctx.fallbackPortMap[ifname] = upFlag
 	}
 	if changed {
 		log.Infof("new fallbackPortmap: %+v\n", ctx.fallbackPortMap)
 		updateFilteredFallback(ctx)
 	}
+	for _, ifname := range newPorts {
+		handleNewPort(ctx, ifname)
+	}
+	// Without an address we wait for handleAddressChange
+	for _, ifname := range cameUp {
+		dns := *ctx.DeviceNetworkStatus
+		if types.IsMgmtPort(dns, ifname) &&
+			types.CountLocalAddrAnyNoLinkLocalIf(dns, ifname) != 0 {
+			triggerNetworkTest(ctx, ifname+" came up")
+			break
+		}
+	}
+}
+
+func handleAddressChange(ctx *nimContext) {
+	before := types.CountLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus)
+	handleDNCAddressChange(&ctx.DeviceNetworkContext)
+	after := types.CountLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus)
+	if after > before {
+		triggerNetworkTest(ctx,
+			fmt.Sprintf("addresses went from %d to %d", before, after))
+	}
+}
+
+// Minimum time between tests triggered by link and address changes
+const triggeredTestHoldoff = 10 * time.Second
+
+// Replaced by the tests
+var handleDNCAddressChange = devicenetwork.HandleAddressChange
+var restartVerify = devicenetwork.RestartVerify
+var tryConnectivity = tryDeviceConnectivityToCloud
+
+// triggerNetworkTest runs the same test as the NetworkTestTimer right
+// away so that we recover quickly when e.g., a cable is plugged back in
+func triggerNetworkTest(ctx *nimContext, reason string) {
+	dnc := &ctx.DeviceNetworkContext
+	if dnc.Pending.Inprogress {
+		log.Infof("triggerNetworkTest(%s): verification in progress\n",
+			reason)
+		return
+	}
+	if dnc.NetworkTestTimer == nil {
+		// Not yet started the tests
+		return
+	}
+	if time.Since(ctx.lastTriggeredTest) < triggeredTestHoldoff {
+		log.Infof("triggerNetworkTest(%s): holdoff\n", reason)
+		return
+	}
+	ctx.lastTriggeredTest = time.Now()
+	log.Infof("triggerNetworkTest(%s)\n", reason)
+	dnc.NetworkTestTimer.Stop()
+	// Both restart NetworkTestTimer when done
+	if ctx.DevicePortConfigList.CurrentIndex == -1 {
+		restartVerify(dnc, "triggerNetworkTest")
+		return
+	}
+	if tryConnectivity(dnc) {
+		log.Infof("triggerNetworkTest(%s): connectivity works\n", reason)
+	}
 }
 
 func updateFilteredFallback(ctx *nimContext) {
@@ -587,7 +754,19 @@ func updateFilteredFallback(ctx *nimContext) {
 }
 
 func tryDeviceConnectivityToCloud(ctx *devicenetwork.DeviceNetworkContext) bool {
-	err := devicenetwork.VerifyDeviceNetworkStatus(*ctx.DeviceNetworkStatus, 1)
+	var err error
+	status := *ctx.DeviceNetworkStatus
+	if !devicenetwork.RunVerify(ctx, func(reqCtx context.Context) {
+		err = devicenetwork.VerifyDeviceNetworkStatus(reqCtx, status, 1,
+			ctx.Timeouts, ctx.OCSPPolicy)
+	}) {
+		log.Infof("tryDeviceConnectivityToCloud: aborted by a port config change\n")
+		if !ctx.Pending.Inprogress {
+			// Test the new configuration in the next slot
+			ctx.NetworkTestTimer = time.NewTimer(time.Duration(ctx.NetworkTestInterval) * time.Second)
+		}
+		return false
+	}
 	if err == nil {
 		log.Infof("tryDeviceConnectivityToCloud: Device cloud connectivity test passed.")
 		if ctx.NextDPCIndex < len(ctx.DevicePortConfigList.PortConfigList) {
@@ -644,53 +823,127 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 	var gcp *types.GlobalConfig
 	ctx.debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		ctx.debugOverride)
-	first := !ctx.GCInitialized
+	// Nothing applied before the initial state
+	first := !ctx.subGlobalConfig.InitialStateDone()
 	if gcp != nil {
 		if !cmp.Equal(ctx.globalConfig, *gcp) {
 			log.Infof("handleGlobalConfigModify: diff %v\n",
 				cmp.Diff(ctx.globalConfig, *gcp))
+			if err := types.ValidateGlobalConfig(*gcp); err != nil {
+				log.Errorf("handleGlobalConfigModify: %s\n", err)
+			}
 			updated := types.ApplyGlobalConfig(*gcp)
 			log.Infof("handleGlobalConfigModify: updated with defaults %v\n",
 				cmp.Diff(*gcp, updated))
 			sane := types.EnforceGlobalConfigMinimums(updated)
-			log.Infof("handleGlobalConfigModify: enforced minimums %v\n",
+			sane = types.EnforceGlobalConfigMaximums(sane)
+			log.Infof("handleGlobalConfigModify: enforced bounds %v\n",
 				cmp.Diff(updated, sane))
 			*gcp = sane
 		}
-		if gcp.SshAccess != ctx.sshAccess || first {
+		// The reject rules added by the ssh and VNC updates are logged
+		rejectLogChanged := gcp.RejectLogRate != ctx.rejectLogRate
+		if rejectLogChanged {
+			ctx.rejectLogRate = gcp.RejectLogRate
+			iptables.SetRejectLogRate(ctx.rejectLogRate)
+			if ctx.rejectLogRate != 0 {
+				startRejectLog(ctx)
+			}
+		}
+		if gcp.SshAccess != ctx.sshAccess || first || rejectLogChanged ||
+			!cmp.Equal(gcp.SshAllowedPrefixes, ctx.sshAllowedPrefixes) ||
+			gcp.SshRateLimit != ctx.sshRateLimit {
 			ctx.sshAccess = gcp.SshAccess
-			iptables.UpdateSshAccess(ctx.sshAccess, first)
+			ctx.sshAllowedPrefixes = gcp.SshAllowedPrefixes
+			ctx.sshRateLimit = gcp.SshRateLimit
+			iptables.UpdateSshAccess(ctx.sshAccess,
+				ctx.sshAllowedPrefixes, ctx.sshRateLimit)
+			ctx.sshRateLimitDrops = 0
 		}
-		if gcp.AllowAppVnc != ctx.allowAppVnc || first {
+		if gcp.AllowAppVnc != ctx.allowAppVnc || first || rejectLogChanged ||
+			!cmp.Equal(gcp.VncAllowedPrefixes, ctx.vncAllowedPrefixes) {
 			ctx.allowAppVnc = gcp.AllowAppVnc
-			iptables.UpdateVncAccess(ctx.allowAppVnc)
+			ctx.vncAllowedPrefixes = gcp.VncAllowedPrefixes
+			iptables.UpdateVncAccess(ctx.allowAppVnc,
+				ctx.vncAllowedPrefixes)
+		}
+		mgmtIcmp := iptables.IcmpPolicy{
+			Echo:         gcp.IcmpEchoMgmt != types.TS_DISABLED,
+			RouterAdvert: gcp.Icmpv6RaMgmt != types.TS_DISABLED,
+		}
+		appIcmp := iptables.IcmpPolicy{
+			Echo:         gcp.IcmpEchoApp != types.TS_DISABLED,
+			RouterAdvert: gcp.Icmpv6RaApp != types.TS_DISABLED,
+		}
+		if mgmtIcmp != ctx.mgmtIcmp || appIcmp != ctx.appIcmp || first {
+			ctx.mgmtIcmp = mgmtIcmp
+			ctx.appIcmp = appIcmp
+			iptables.UpdateIcmpAccess(ctx.mgmtIcmp, ctx.appIcmp)
 		}
 		if gcp.NetworkFallbackAnyEth != ctx.networkFallbackAnyEth || first {
 			ctx.networkFallbackAnyEth = gcp.NetworkFallbackAnyEth
 			updateFallbackAnyEth(ctx)
 		}
-		// Check for change to NetworkTestBetterInterval
-		if ctx.NetworkTestBetterInterval != gcp.NetworkTestBetterInterval {
-			if gcp.NetworkTestBetterInterval == 0 {
-				log.Warnln("NOT running TestBetterTimer")
-				networkTestBetterTimer := time.NewTimer(time.Hour)
-				networkTestBetterTimer.Stop()
-				ctx.NetworkTestBetterTimer = networkTestBetterTimer
-			} else {
-				log.Infof("Starting TestBetterTimer: %d",
-					gcp.NetworkTestBetterInterval)
-				networkTestBetterInterval := time.Duration(ctx.NetworkTestBetterInterval) * time.Second
-				networkTestBetterTimer := time.NewTimer(networkTestBetterInterval)
-				ctx.NetworkTestBetterTimer = networkTestBetterTimer
-			}
-			ctx.NetworkTestBetterInterval = gcp.NetworkTestBetterInterval
+		updateNetworkTestTimers(ctx, gcp)
+		// geoTimer is nil until we have waited for the initial config
+		retryTime := gcp.GetNetworkGeoRetryTime()
+		if retryTime != ctx.globalConfig.GetNetworkGeoRetryTime() &&
+			ctx.geoTimer.C != nil {
+			geoMin, geoMax := geoTimerRange(retryTime)
+			log.Infof("Updating geoTimer to %v-%v\n", geoMin, geoMax)
+			ctx.geoTimer.UpdateRangeTicker(geoMin, geoMax)
 		}
 		ctx.globalConfig = gcp
 	}
-	ctx.GCInitialized = true
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
 
+// updateNetworkTestTimers applies changes to the test intervals to the
+// running timers. The timers are nil until we have waited for the initial
+// config. A stopped NetworkTestTimer is left stopped since DPC verification
+// restarts it when done. The timeouts and the OCSP policy apply to the
+// next test.
+func updateNetworkTestTimers(ctx *nimContext, gcp *types.GlobalConfig) {
+	ctx.DPCTestDuration = uint32(gcp.GetNetworkTestDuration() / time.Second)
+	ctx.Timeouts = zedcloud.TimeoutsFromGlobalConfig(*gcp)
+	ctx.OCSPPolicy = gcp.OCSPPolicy
+	interval := gcp.GetNetworkTestInterval()
+	if ctx.NetworkTestInterval != uint32(interval/time.Second) {
+		log.Infof("NetworkTestInterval changed from %d to %d\n",
+			ctx.NetworkTestInterval, uint32(interval/time.Second))
+		ctx.NetworkTestInterval = uint32(interval / time.Second)
+		if ctx.NetworkTestTimer != nil && !ctx.Pending.Inprogress &&
+			ctx.NetworkTestTimer.Stop() {
+			ctx.NetworkTestTimer = time.NewTimer(interval)
+		}
+	}
+	betterInterval := gcp.GetNetworkTestBetterInterval()
+	if ctx.NetworkTestBetterInterval != uint32(betterInterval/time.Second) {
+		ctx.NetworkTestBetterInterval = uint32(betterInterval / time.Second)
+		if ctx.NetworkTestBetterTimer != nil {
+			ctx.NetworkTestBetterTimer.Stop()
+		}
+		if ctx.NetworkTestBetterInterval == 0 {
+			log.Warnln("NOT running TestBetterTimer")
+			networkTestBetterTimer := time.NewTimer(time.Hour)
+			networkTestBetterTimer.Stop()
+			ctx.NetworkTestBetterTimer = networkTestBetterTimer
+		} else {
+			log.Infof("Starting TestBetterTimer: %d",
+				ctx.NetworkTestBetterInterval)
+			networkTestBetterTimer := time.NewTimer(betterInterval)
+			ctx.NetworkTestBetterTimer = networkTestBetterTimer
+		}
+	}
+}
+
+// geoTimerRange returns the randomized range for NetworkGeoRetryTime
+func geoTimerRange(retryTime time.Duration) (time.Duration, time.Duration) {
+	max := float64(retryTime)
+	min := max * 0.3
+	return time.Duration(min), time.Duration(max)
+}
+
 func handleGlobalConfigDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
@@ -706,17 +959,27 @@ func handleGlobalConfigDelete(ctxArg interface{}, key string,
 	log.Infof("handleGlobalConfigDelete done for %s\n", key)
 }
 
-// In case there is no GlobalConfig.json this will move us forward
-func handleGlobalConfigSynchronized(ctxArg interface{}, done bool) {
+// In case there is no GlobalConfig.json apply the defaults
+func handleGlobalConfigInitialState(ctxArg interface{}, count int,
+	timedOut bool) {
+
 	ctx := ctxArg.(*nimContext)
+	log.Infof("handleGlobalConfigInitialState(%d)\n", count)
+	if _, err := ctx.subGlobalConfig.Get("global"); err == nil {
+		// Applied by handleGlobalConfigModify
+		return
+	}
+	iptables.UpdateSshAccess(ctx.sshAccess, ctx.sshAllowedPrefixes,
+		ctx.sshRateLimit)
+	iptables.UpdateVncAccess(ctx.allowAppVnc, ctx.vncAllowedPrefixes)
+	iptables.UpdateIcmpAccess(ctx.mgmtIcmp, ctx.appIcmp)
+}
 
-	log.Infof("handleGlobalConfigSynchronized(%v)\n", done)
-	if done {
-		first := !ctx.GCInitialized
-		if first {
-			iptables.UpdateSshAccess(ctx.sshAccess, first)
-		}
-		ctx.GCInitialized = true
+// Without a DeviceNetworkConfig for the model we rely on the override,
+// zedagent and the fallback to any Ethernet port
+func handleDNCInitialState(ctxArg interface{}, count int, timedOut bool) {
+	if count == 0 {
+		log.Warnf("handleDNCInitialState: no DeviceNetworkConfig\n")
 	}
 }
 
@@ -824,7 +1087,11 @@ func isSwitch(ctx *nimContext, ifname string) bool {
 
 	foundExcl := false
 	for _, st := range items {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("isSwitch: %s\n", err)
+			continue
+		}
 
 		if !status.IsUsingPort(ifname) {
 			continue
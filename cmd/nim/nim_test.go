@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package nim
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+// Counts the calls to the verification functions until the returned
+// function is called
+type testVerify struct {
+	restarts int
+	tries    int
+}
+
+func useTestVerify() (*testVerify, func()) {
+	tv := &testVerify{}
+	oldRestart := restartVerify
+	oldTry := tryConnectivity
+	restartVerify = func(ctx *devicenetwork.DeviceNetworkContext,
+		caller string) {
+		tv.restarts++
+	}
+	tryConnectivity = func(ctx *devicenetwork.DeviceNetworkContext) bool {
+		tv.tries++
+		return true
+	}
+	return tv, func() {
+		restartVerify = oldRestart
+		tryConnectivity = oldTry
+	}
+}
+
+func testNimContext() *nimContext {
+	ctx := &nimContext{}
+	ctx.DeviceNetworkStatus = &types.DeviceNetworkStatus{}
+	ctx.DevicePortConfigList = &types.DevicePortConfigList{}
+	return ctx
+}
+
+func TestTriggerNetworkTest(t *testing.T) {
+	tv, restore := useTestVerify()
+	defer restore()
+	ctx := testNimContext()
+
+	// Not yet started the tests
+	triggerNetworkTest(ctx, "test")
+	if tv.restarts != 0 || tv.tries != 0 {
+		t.Errorf("Triggered before the tests started: %+v\n", tv)
+	}
+
+	ctx.NetworkTestTimer = time.NewTimer(time.Hour)
+	defer ctx.NetworkTestTimer.Stop()
+	ctx.Pending.Inprogress = true
+	triggerNetworkTest(ctx, "test")
+	if tv.restarts != 0 || tv.tries != 0 {
+		t.Errorf("Triggered during verification: %+v\n", tv)
+	}
+	ctx.Pending.Inprogress = false
+
+	// Using a DevicePortConfig
+	triggerNetworkTest(ctx, "test")
+	if tv.restarts != 0 || tv.tries != 1 {
+		t.Errorf("Expected one connectivity test: %+v\n", tv)
+	}
+	triggerNetworkTest(ctx, "test")
+	if tv.tries != 1 {
+		t.Errorf("Triggered during the holdoff: %+v\n", tv)
+	}
+
+	// None working
+	ctx.lastTriggeredTest = time.Now().Add(-triggeredTestHoldoff)
+	ctx.DevicePortConfigList.CurrentIndex = -1
+	triggerNetworkTest(ctx, "test")
+	if tv.restarts != 1 || tv.tries != 1 {
+		t.Errorf("Expected a restarted verification: %+v\n", tv)
+	}
+}
+
+func TestHandleAddressChange(t *testing.T) {
+	tv, restore := useTestVerify()
+	defer restore()
+	oldHandle := handleDNCAddressChange
+	defer func() { handleDNCAddressChange = oldHandle }()
+
+	ctx := testNimContext()
+	ctx.NetworkTestTimer = time.NewTimer(time.Hour)
+	defer ctx.NetworkTestTimer.Stop()
+	var addrs []types.NetworkPortStatus
+	handleDNCAddressChange = func(dnc *devicenetwork.DeviceNetworkContext) {
+		dnc.DeviceNetworkStatus.Ports = addrs
+	}
+	port := func(addr string) types.NetworkPortStatus {
+		return types.NetworkPortStatus{IfName: "eth0", IsMgmt: true,
+			AddrInfoList: []types.AddrInfo{{Addr: net.ParseIP(addr)}}}
+	}
+
+	// Only a link-local address
+	addrs = []types.NetworkPortStatus{port("fe80::1")}
+	handleAddressChange(ctx)
+	if tv.tries != 0 {
+		t.Errorf("Triggered for a link-local address: %+v\n", tv)
+	}
+
+	addrs = []types.NetworkPortStatus{port("192.168.1.10")}
+	handleAddressChange(ctx)
+	if tv.tries != 1 {
+		t.Errorf("Not triggered for a new address: %+v\n", tv)
+	}
+
+	// Losing the address does not trigger
+	ctx.lastTriggeredTest = time.Time{}
+	addrs = nil
+	handleAddressChange(ctx)
+	if tv.tries != 1 {
+		t.Errorf("Triggered for a removed address: %+v\n", tv)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Summarize the packets rejected on the uplinks which iptables logs to
+// the NFLOG group, for security monitoring.
+
+package nim
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/iptables"
+	"github.com/zededa/go-provision/nflog"
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+)
+
+// Sources kept in the summary; the least recent are dropped
+const maxRejectedSources = 100
+
+type rejectLog struct {
+	packets chan []nflog.Packet
+	sources map[string]*types.RejectedSource
+	changed bool
+	pub     *pubsub.Publication
+}
+
+// startRejectLog starts the reader the first time the logging is enabled.
+// The reader is kept after it is disabled since there is nothing to read.
+func startRejectLog(ctx *nimContext) {
+	if ctx.rejectLog.packets != nil {
+		return
+	}
+	r, err := nflog.Open(iptables.RejectLogGroup)
+	if err != nil {
+		log.Errorf("startRejectLog: %s\n", err)
+		return
+	}
+	ctx.rejectLog.packets = make(chan []nflog.Packet, 10)
+	ctx.rejectLog.sources = make(map[string]*types.RejectedSource)
+	go readRejectLog(r, ctx.rejectLog.packets)
+}
+
+func readRejectLog(r *nflog.Reader, packets chan<- []nflog.Packet) {
+	for {
+		p, err := r.Receive()
+		if err != nil {
+			if err == syscall.ENOBUFS {
+				log.Warnf("readRejectLog: lost packets\n")
+			} else {
+				log.Errorf("readRejectLog: %s\n", err)
+				time.Sleep(10 * time.Second)
+			}
+		}
+		if len(p) != 0 {
+			packets <- p
+		}
+	}
+}
+
+func rejectedKey(ifName string, proto uint8, src net.IP,
+	dstPort uint16) string {
+
+	return fmt.Sprintf("%s %d %s %d", ifName, proto, src, dstPort)
+}
+
+// addRejected adds the packets to the summary
+func addRejected(ctx *nimContext, packets []nflog.Packet) {
+	now := time.Now()
+	for _, p := range packets {
+		if p.Prefix != iptables.RejectLogPrefix {
+			continue
+		}
+		key := rejectedKey(p.InIfName, p.Protocol, p.Src, p.DstPort)
+		s, ok := ctx.rejectLog.sources[key]
+		if !ok {
+			log.Infof("Rejected %s proto %d from %s to port %d\n",
+				p.InIfName, p.Protocol, p.Src, p.DstPort)
+			s = &types.RejectedSource{IfName: p.InIfName,
+				Protocol: p.Protocol, SrcIP: p.Src, DstPort: p.DstPort,
+				FirstTime: now}
+			ctx.rejectLog.sources[key] = s
+		}
+		s.Count++
+		s.LastTime = now
+		ctx.rejectLog.changed = true
+	}
+}
+
+// publishRejected publishes the summary if it changed
+func publishRejected(ctx *nimContext) {
+	if !ctx.rejectLog.changed {
+		return
+	}
+	ctx.rejectLog.changed = false
+	var sources []types.RejectedSource
+	for _, s := range ctx.rejectLog.sources {
+		sources = append(sources, *s)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].LastTime.After(sources[j].LastTime)
+	})
+	if len(sources) > maxRejectedSources {
+		for _, s := range sources[maxRejectedSources:] {
+			delete(ctx.rejectLog.sources, rejectedKey(s.IfName,
+				s.Protocol, s.SrcIP, s.DstPort))
+		}
+		sources = sources[:maxRejectedSources]
+	}
+	status := types.RejectedConnections{Sources: sources}
+	ctx.rejectLog.pub.Publish(status.Key(), status)
+}
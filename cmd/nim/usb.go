@@ -0,0 +1,113 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// React to USB modems and NICs which are attached after boot. The network
+// interface shows up some time after domainmgr publishes the USB device,
+// once the driver is bound, hence we remember the attach and look at the
+// new interfaces in handleLinkChange. A port which was missing when the
+// DevicePortConfig list was verified can make a better DevicePortConfig
+// work, so we verify the list again from the top.
+
+package nim
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+// How long after a USB attach we expect its network interface
+const usbAttachWindow = time.Minute
+
+func handleUsbDeviceModify(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	ctx := ctxArg.(*nimContext)
+	status, err := cast.CastUsbDeviceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleUsbDeviceModify(%s): %s\n", key, err)
+		return
+	}
+	if !status.MaybeNetwork() {
+		return
+	}
+	if _, ok := ctx.usbNetworkDevices[key]; ok {
+		return
+	}
+	// The ones present at startup are not attaches
+	var attached time.Time
+	if ctx.usbSynchronized {
+		attached = time.Now()
+	}
+	log.Infof("handleUsbDeviceModify(%s) %s %s might be a network port\n",
+		key, status.VendorProduct(), status.Product)
+	ctx.usbNetworkDevices[key] = attached
+}
+
+func handleUsbDeviceDelete(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	ctx := ctxArg.(*nimContext)
+	if _, ok := ctx.usbNetworkDevices[key]; ok {
+		log.Infof("handleUsbDeviceDelete(%s)\n", key)
+		delete(ctx.usbNetworkDevices, key)
+	}
+}
+
+func handleUsbDeviceSynchronized(ctxArg interface{}, synchronized bool) {
+	ctx := ctxArg.(*nimContext)
+	ctx.usbSynchronized = synchronized
+}
+
+// usbAttachedSince returns true if a network capable USB device was
+// attached after the time
+func usbAttachedSince(devices map[string]time.Time, since time.Time) bool {
+	for _, attached := range devices {
+		if attached.After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// portInDPCList returns true if any DevicePortConfig uses the interface
+func portInDPCList(dpcl *types.DevicePortConfigList, ifname string) bool {
+	for _, dpc := range dpcl.PortConfigList {
+		for _, port := range dpc.Ports {
+			if port.IfName == ifname {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleNewPort is called by handleLinkChange for an interface which we
+// had not seen before
+func handleNewPort(ctx *nimContext, ifname string) {
+	if !usbAttachedSince(ctx.usbNetworkDevices,
+		time.Now().Add(-usbAttachWindow)) {
+		return
+	}
+	if !portInDPCList(ctx.DevicePortConfigList, ifname) {
+		log.Infof("handleNewPort(%s) not in any DevicePortConfig\n",
+			ifname)
+		return
+	}
+	dnc := &ctx.DeviceNetworkContext
+	if dnc.NetworkTestTimer == nil || dnc.Pending.Inprogress {
+		// The verification will see the port
+		return
+	}
+	if ctx.DevicePortConfigList.CurrentIndex == 0 {
+		log.Infof("handleNewPort(%s) already using the first DevicePortConfig\n",
+			ifname)
+		return
+	}
+	log.Infof("handleNewPort(%s) attached over USB; verifying again\n",
+		ifname)
+	devicenetwork.RestartVerify(dnc, "USB port "+ifname)
+}
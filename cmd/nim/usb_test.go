@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package nim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestUsbDeviceAttach(t *testing.T) {
+	ctx := nimContext{usbNetworkDevices: make(map[string]time.Time)}
+	modem := types.UsbDeviceStatus{BusPath: "1-1",
+		InterfaceClasses: []uint8{types.UsbClassVendor}}
+	disk := types.UsbDeviceStatus{BusPath: "1-2",
+		InterfaceClasses: []uint8{types.UsbClassMassStorage}}
+	since := time.Now().Add(-usbAttachWindow)
+
+	// Present at startup
+	handleUsbDeviceModify(&ctx, modem.Key(), modem)
+	handleUsbDeviceSynchronized(&ctx, true)
+	if usbAttachedSince(ctx.usbNetworkDevices, since) {
+		t.Errorf("Startup device counted as attached\n")
+	}
+	// Not a network device
+	handleUsbDeviceModify(&ctx, disk.Key(), disk)
+	if len(ctx.usbNetworkDevices) != 1 {
+		t.Errorf("Got %v\n", ctx.usbNetworkDevices)
+	}
+	// Detached and attached again
+	handleUsbDeviceDelete(&ctx, modem.Key(), modem)
+	handleUsbDeviceModify(&ctx, modem.Key(), modem)
+	if !usbAttachedSince(ctx.usbNetworkDevices, since) {
+		t.Errorf("Attach not seen\n")
+	}
+	if usbAttachedSince(ctx.usbNetworkDevices,
+		time.Now().Add(time.Second)) {
+		t.Errorf("Attach seen after the window\n")
+	}
+}
+
+func TestPortInDPCList(t *testing.T) {
+	dpcl := types.DevicePortConfigList{
+		PortConfigList: []types.DevicePortConfig{
+			{Ports: []types.NetworkPortConfig{{IfName: "eth0"}}},
+			{Ports: []types.NetworkPortConfig{{IfName: "eth0"},
+				{IfName: "wwan0"}}},
+		},
+	}
+	if !portInDPCList(&dpcl, "wwan0") || portInDPCList(&dpcl, "eth1") {
+		t.Errorf("Wrong ports in %+v\n", dpcl)
+	}
+}
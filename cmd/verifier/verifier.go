@@ -273,7 +273,11 @@ func handleInitWorkinProgressObjects(ctx *verifierContext) {
 	for _, pub := range publications {
 		items := pub.GetAll()
 		for key, st := range items {
-			status := cast.CastVerifyImageStatus(st)
+			status, err := cast.CastVerifyImageStatus(st)
+			if err != nil {
+				log.Errorf("handleInitWorkinProgressObjects: %s\n", err)
+				continue
+			}
 			if status.Key() != key {
 				log.Errorf("handleInitWorkin key/UUID mismatch %s vs %s; ignored %+v\n",
 					key, status.Key(), status)
@@ -434,7 +438,11 @@ func handleInitMarkedDeletePendingObjects(ctx *verifierContext) {
 	for _, pub := range publications {
 		items := pub.GetAll()
 		for key, st := range items {
-			status := cast.CastVerifyImageStatus(st)
+			status, err := cast.CastVerifyImageStatus(st)
+			if err != nil {
+				log.Errorf("handleInitMarkedDeletePendingObjects: %s\n", err)
+				continue
+			}
 			if status.Key() != key {
 				log.Errorf("handleInitMarked key/UUID mismatch %s vs %s; ignored %+v\n",
 					key, status.Key(), status)
@@ -500,7 +508,11 @@ func gcVerifiedObjects(ctx *verifierContext) {
 	for _, pub := range publications {
 		items := pub.GetAll()
 		for key, st := range items {
-			status := cast.CastVerifyImageStatus(st)
+			status, err := cast.CastVerifyImageStatus(st)
+			if err != nil {
+				log.Errorf("gcVerifiedObjects: %s\n", err)
+				continue
+			}
 			if status.Key() != key {
 				log.Errorf("gcVerifiedObjects key/UUID mismatch %s vs %s; ignored %+v\n",
 					key, status.Key(), status)
@@ -529,8 +541,7 @@ func gcVerifiedObjects(ctx *verifierContext) {
 func updateVerifyErrStatus(ctx *verifierContext,
 	status *types.VerifyImageStatus, lastErr string) {
 
-	status.LastErr = lastErr
-	status.LastErrTime = time.Now()
+	status.SetErrorNow(lastErr)
 	status.PendingAdd = false
 	publishVerifyImageStatus(ctx, status)
 }
@@ -608,7 +619,11 @@ func lookupVerifyImageStatus(ctx *verifierContext, objType string,
 		log.Infof("lookupVerifyImageStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastVerifyImageStatus(st)
+	status, err := cast.CastVerifyImageStatus(st)
+	if err != nil {
+		log.Errorf("lookupVerifyImageStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupVerifyImageStatus(%s) got %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -638,7 +653,11 @@ func handleVerifyImageModify(ctxArg interface{}, objType string,
 
 	log.Infof("handleVerifyImageModify(%s)\n", key)
 	ctx := ctxArg.(*verifierContext)
-	config := cast.CastVerifyImageConfig(configArg)
+	config, err := cast.CastVerifyImageConfig(configArg)
+	if err != nil {
+		log.Errorf("handleVerifyImageModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleVerifyImageModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -685,7 +704,11 @@ func runHandler(ctx *verifierContext, objType string, key string,
 		select {
 		case configArg, ok := <-c:
 			if ok {
-				config := cast.CastVerifyImageConfig(configArg)
+				config, err := cast.CastVerifyImageConfig(configArg)
+				if err != nil {
+					log.Errorf("runHandler: %s\n", err)
+					continue
+				}
 				status := lookupVerifyImageStatus(ctx,
 					objType, key)
 				if status == nil {
@@ -1193,8 +1216,8 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 	var gcp *types.GlobalConfig
 	debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
-	if gcp != nil && gcp.DownloadGCTime != 0 {
-		downloadGCTime = time.Duration(gcp.DownloadGCTime) * time.Second
+	if gcp != nil {
+		downloadGCTime = gcp.GetDownloadGCTime()
 	}
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
@@ -9,7 +9,6 @@ package waitforaddr
 import (
 	"flag"
 	"fmt"
-	"github.com/google/go-cmp/cmp"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/agentlog"
 	"github.com/zededa/go-provision/cast"
@@ -87,7 +86,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	DNSctx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -112,9 +111,14 @@ func Run() {
 	}
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DNSContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -125,12 +129,15 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(ctx.deviceNetworkStatus, status))
 	ctx.deviceNetworkStatus = status
 	newAddrCount := types.CountLocalAddrAnyNoLinkLocal(ctx.deviceNetworkStatus)
 	ctx.DNSinitialized = true
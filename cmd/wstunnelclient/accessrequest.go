@@ -0,0 +1,147 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// On-demand tunnels requested by the controller using RemoteAccessRequest.
+// Each request in its time window adds a channel to the tunnel for its
+// destination, and keeps the tunnel open even if no app instance has
+// RemoteConsole set. The destination must be an address assigned to the
+// app instance named in the request.
+
+package wstunnelclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/types"
+)
+
+func handleRemoteAccessRequestModify(ctxArg interface{}, key string,
+	configArg interface{}) {
+
+	log.Infof("handleRemoteAccessRequestModify for %s\n", key)
+	ctx := ctxArg.(*wstunnelclientContext)
+	scanAIConfigs(ctx)
+	log.Infof("handleRemoteAccessRequestModify done for %s\n", key)
+}
+
+func handleRemoteAccessRequestDelete(ctxArg interface{}, key string,
+	configArg interface{}) {
+
+	log.Infof("handleRemoteAccessRequestDelete for %s\n", key)
+	ctx := ctxArg.(*wstunnelclientContext)
+	scanAIConfigs(ctx)
+	log.Infof("handleRemoteAccessRequestDelete done for %s\n", key)
+}
+
+// The addresses of the app instance can change
+func handleAppNetworkStatusModify(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	log.Debugf("handleAppNetworkStatusModify for %s\n", key)
+	ctx := ctxArg.(*wstunnelclientContext)
+	if len(ctx.subRemoteAccessRequest.GetAll()) != 0 {
+		scanAIConfigs(ctx)
+	}
+}
+
+func handleAppNetworkStatusDelete(ctxArg interface{}, key string,
+	statusArg interface{}) {
+
+	log.Debugf("handleAppNetworkStatusDelete for %s\n", key)
+	ctx := ctxArg.(*wstunnelclientContext)
+	if len(ctx.subRemoteAccessRequest.GetAll()) != 0 {
+		scanAIConfigs(ctx)
+	}
+}
+
+// accessRequestAllowed checks that the destination is an address of the
+// app instance. Returns the app instance name.
+func accessRequestAllowed(ctx *wstunnelclientContext,
+	req types.RemoteAccessRequest) (string, error) {
+
+	host, _, err := net.SplitHostPort(req.Destination)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		errStr := fmt.Sprintf("Destination %s is not an IP address",
+			req.Destination)
+		return "", errors.New(errStr)
+	}
+	st, err := ctx.subAppNetworkStatus.Get(req.AppUUID)
+	if err != nil {
+		errStr := fmt.Sprintf("Unknown app instance %s", req.AppUUID)
+		return "", errors.New(errStr)
+	}
+	status, err := cast.CastAppNetworkStatus(st)
+	if err != nil {
+		log.Errorf("accessRequestAllowed: %s\n", err)
+		return "", err
+	}
+	for _, ulStatus := range status.UnderlayNetworkList {
+		if ip.Equal(net.ParseIP(ulStatus.AssignedIPAddr)) {
+			return status.DisplayName, nil
+		}
+	}
+	for _, olStatus := range status.OverlayNetworkList {
+		if ip.Equal(olStatus.EID) || ip.Equal(olStatus.AppIPAddr) {
+			return status.DisplayName, nil
+		}
+	}
+	errStr := fmt.Sprintf("Destination %s is not an address of %s",
+		req.Destination, status.DisplayName)
+	return "", errors.New(errStr)
+}
+
+// activeAccessRequests returns the allowed requests in their time window
+// and the corresponding app instances
+func activeAccessRequests(ctx *wstunnelclientContext,
+	now time.Time) ([]types.RemoteAccessRequest, []consoleApp) {
+
+	var reqs []types.RemoteAccessRequest
+	var apps []consoleApp
+	for _, r := range ctx.subRemoteAccessRequest.GetAll() {
+		req, err := cast.CastRemoteAccessRequest(r)
+		if err != nil {
+			log.Errorf("activeAccessRequests: %s\n", err)
+			continue
+		}
+		if !req.Active(now) {
+			log.Debugf("RemoteAccessRequest %s not active\n",
+				req.RequestId)
+			continue
+		}
+		name, err := accessRequestAllowed(ctx, req)
+		if err != nil {
+			log.Errorf("RemoteAccessRequest %s denied: %s\n",
+				req.RequestId, err)
+			continue
+		}
+		reqs = append(reqs, req)
+		apps = append(apps, consoleApp{uuid: req.AppUUID, name: name,
+			channels: []string{req.ChannelName()}})
+	}
+	return reqs, apps
+}
+
+// checkAccessRequests rescans when a request enters or leaves its time
+// window
+func checkAccessRequests(ctx *wstunnelclientContext) {
+	reqs, _ := activeAccessRequests(ctx, time.Now())
+	if len(reqs) != len(ctx.activeAccessRequests) {
+		scanAIConfigs(ctx)
+		return
+	}
+	for _, req := range reqs {
+		if !ctx.activeAccessRequests[req.RequestId] {
+			scanAIConfigs(ctx)
+			return
+		}
+	}
+}
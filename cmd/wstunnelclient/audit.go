@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Audit trail of remote console access. The events from the tunnel are
+// appended as JSON lines to a file under /persist and published so that
+// other agents can report them. The file is rotated once it reaches
+// maxAuditFileSize; one old file is kept.
+
+package wstunnelclient
+
+import (
+	"encoding/json"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+const (
+	auditDirname     = "/persist/audit"
+	auditFilename    = auditDirname + "/" + agentName + ".log"
+	maxAuditFileSize = 1024 * 1024
+	// Number of events kept in the publication
+	maxAuditPublished = 100
+)
+
+// An app instance using the tunnel, for attributing the events
+type consoleApp struct {
+	uuid     string
+	name     string
+	channels []string
+}
+
+// Called from the tunnel goroutines; we record the events in the main
+// loop
+func (ctx *wstunnelclientContext) auditFunc(event types.TunnelAuditEvent) {
+	select {
+	case ctx.auditChan <- event:
+	default:
+		log.Errorf("Audit queue full; dropped %+v\n", event)
+	}
+}
+
+func recordAudit(ctx *wstunnelclientContext, event types.TunnelAuditEvent) {
+	ctx.auditSequence++
+	event.Sequence = ctx.auditSequence
+	for _, app := range ctx.consoleApps {
+		if event.Channel != "" && !appUsesChannel(app, event.Channel) {
+			continue
+		}
+		event.AppUUIDs = append(event.AppUUIDs, app.uuid)
+		event.AppNames = append(event.AppNames, app.name)
+	}
+	log.Infof("recordAudit: %s %s %s apps %v in %d out %d %s\n",
+		event.Event, event.SessionId, event.Channel, event.AppNames,
+		event.BytesIn, event.BytesOut, event.Reason)
+	if err := appendAudit(auditFilename, event); err != nil {
+		log.Errorf("recordAudit: %s\n", err)
+	}
+	pub := ctx.pubTunnelAudit
+	pub.Publish(event.Key(), event)
+	if event.Sequence > maxAuditPublished {
+		old := types.TunnelAuditEvent{
+			Sequence: event.Sequence - maxAuditPublished}
+		if _, err := pub.Get(old.Key()); err == nil {
+			pub.Unpublish(old.Key())
+		}
+	}
+}
+
+// The guacamole channel is used by all the app instances
+func appUsesChannel(app consoleApp, channel string) bool {
+	if channel == zedcloud.DefaultTunnelChannel {
+		return true
+	}
+	for _, c := range app.channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func appendAudit(filename string, event types.TunnelAuditEvent) error {
+	if err := os.MkdirAll(auditDirname, 0700); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(filename); err == nil &&
+		fi.Size() >= maxAuditFileSize {
+		if err := os.Rename(filename, filename+".1"); err != nil {
+			log.Errorf("appendAudit: rotate %s\n", err)
+		}
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+		0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b = append(b, '\n')
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	return f.Sync()
+}
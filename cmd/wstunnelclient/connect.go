@@ -0,0 +1,129 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Pick the management port, source address, and proxy for the tunnel.
+// We try every address on every management port, free ports first,
+// looking up the proxy for each port. The combination which worked last
+// time is tried first.
+
+package wstunnelclient
+
+import (
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+// After this many consecutive failures to reconnect we look for a
+// different port or address
+const maxConnectFailures = 3
+
+// Time between attempts when we could not connect on any port
+const connectRetryInterval = time.Minute
+
+type tunnelCandidate struct {
+	intf  string
+	addr  net.IP
+	proxy string // Redacted; empty if no proxy
+}
+
+// All the port and source address combinations in the order to try
+func tunnelCandidates(ctx *wstunnelclientContext) []tunnelCandidate {
+	status := *ctx.dnsContext.deviceNetworkStatus
+	var candidates []tunnelCandidate
+	last := ctx.lastWorking
+	if last.intf != "" && hasAddr(status, last.intf, last.addr) {
+		candidates = append(candidates, last)
+	}
+	for _, ifname := range tunnelPorts(status) {
+		addrCount := types.CountLocalAddrAnyNoLinkLocalIf(status, ifname)
+		if addrCount == 0 {
+			log.Infof("No IP addresses to connect tunnel using intf %s\n",
+				ifname)
+			continue
+		}
+		for i := 0; i < addrCount; i++ {
+			addr, err := types.GetLocalAddrAnyNoLinkLocal(status, i,
+				ifname)
+			if err != nil {
+				log.Info(err)
+				continue
+			}
+			if ifname == last.intf && addr.Equal(last.addr) {
+				continue
+			}
+			candidates = append(candidates,
+				tunnelCandidate{intf: ifname, addr: addr})
+		}
+	}
+	return candidates
+}
+
+// connectTunnel starts the tunnel using the first candidate which passes
+// the connection test. Returns false if none did.
+func connectTunnel(ctx *wstunnelclientContext,
+	channels []types.TunnelChannel) bool {
+
+	deviceNetworkStatus := ctx.dnsContext.deviceNetworkStatus
+	wstunnelclient := zedcloud.InitializeTunnelClient(ctx.serverName, "localhost:4822")
+	wstunnelclient.SetChannels(channels)
+	wstunnelclient.AuditFunc = ctx.auditFunc
+	wstunnelclient.SetRateLimit(
+		uint64(ctx.globalConfig.RemoteConsoleRxRate),
+		uint64(ctx.globalConfig.RemoteConsoleTxRate))
+	wstunnelclient.SetOCSPPolicy(ctx.globalConfig.OCSPPolicy)
+	destURL := wstunnelclient.Tunnel
+	ctx.lastConnectAttempt = time.Now()
+
+	for _, cand := range tunnelCandidates(ctx) {
+		// The proxy depends on the port
+		proxyURL, err := zedcloud.LookupProxy(deviceNetworkStatus,
+			cand.intf, destURL)
+		if err != nil {
+			log.Errorf("LookupProxy for %s failed: %s\n", cand.intf, err)
+			proxyURL = nil
+		}
+		cand.proxy = zedcloud.RedactedProxy(proxyURL)
+		log.Infof("Connecting to %s using intf %s source %v proxy <%s>\n",
+			destURL, cand.intf, cand.addr, cand.proxy)
+		if err := wstunnelclient.TestConnection(proxyURL, cand.addr); err != nil {
+			log.Infof("Could not connect to %s using intf %s source %v: %s\n",
+				destURL, cand.intf, cand.addr, err)
+			continue
+		}
+		log.Infof("Tunnel to %s using intf %s source %v proxy <%s>\n",
+			destURL, cand.intf, cand.addr, cand.proxy)
+		wstunnelclient.Start()
+		ctx.wstunnelclient = wstunnelclient
+		ctx.tunnelIntf = cand.intf
+		ctx.tunnelAddr = cand.addr
+		ctx.tunnelStart = time.Now()
+		ctx.lastWorking = cand
+		return true
+	}
+	return false
+}
+
+// checkTunnelHealth looks for a different port or address if the tunnel
+// keeps failing to reconnect. Also retries if we could not connect at all,
+// and migrates once the holdoff in maybeMigrateTunnel has passed.
+func checkTunnelHealth(ctx *wstunnelclientContext) {
+	if ctx.wstunnelclient == nil {
+		if ctx.tunnelRequired &&
+			time.Since(ctx.lastConnectAttempt) > connectRetryInterval {
+			scanAIConfigs(ctx)
+		}
+		return
+	}
+	status := ctx.wstunnelclient.Status()
+	if status.ConnectFailures >= maxConnectFailures {
+		restartTunnel(ctx, status.Error)
+		return
+	}
+	if ctx.migrateIntf != "" {
+		maybeMigrateTunnel(ctx)
+	}
+}
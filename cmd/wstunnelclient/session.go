@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Remote console session lifetime. An app instance with RemoteConsole set
+// has a session which starts when we first see the config. The session is
+// closed when it exceeds the maximum duration or when the tunnel has had
+// no requests for the idle timeout. A closed session does not keep the
+// tunnel open, and is only reopened when the controller re-authorizes it
+// by sending a new version of the config or by turning RemoteConsole off
+// and on again.
+
+package wstunnelclient
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/types"
+)
+
+type consoleSession struct {
+	version string // UUIDandVersion.Version which authorized it
+	start   time.Time
+	closed  string // Reason; empty if the session is active
+}
+
+// consoleSessionActive creates or restarts the session as needed and
+// returns true if the app instance needs the tunnel
+func consoleSessionActive(ctx *wstunnelclientContext,
+	config types.AppInstanceConfig) bool {
+
+	key := config.Key()
+	version := config.UUIDandVersion.Version
+	s, ok := ctx.sessions[key]
+	if !ok || s.version != version {
+		log.Infof("Remote console session for %s version %s started\n",
+			config.DisplayName, version)
+		s = &consoleSession{version: version, start: time.Now()}
+		ctx.sessions[key] = s
+	}
+	return s.closed == ""
+}
+
+// Remove the sessions for app instances without RemoteConsole
+func pruneConsoleSessions(ctx *wstunnelclientContext, keep map[string]bool) {
+	for key := range ctx.sessions {
+		if !keep[key] {
+			log.Infof("Remote console session for %s removed\n", key)
+			delete(ctx.sessions, key)
+		}
+	}
+}
+
+// The per app instance limits override the GlobalConfig ones
+func consoleLimits(ctx *wstunnelclientContext,
+	config types.AppInstanceConfig) (time.Duration, time.Duration) {
+
+	maxDuration := ctx.globalConfig.RemoteConsoleMaxDuration
+	if config.RemoteConsoleMaxDuration != 0 {
+		maxDuration = config.RemoteConsoleMaxDuration
+	}
+	idleTimeout := ctx.globalConfig.RemoteConsoleIdleTimeout
+	if config.RemoteConsoleIdleTimeout != 0 {
+		idleTimeout = config.RemoteConsoleIdleTimeout
+	}
+	return time.Duration(maxDuration) * time.Second,
+		time.Duration(idleTimeout) * time.Second
+}
+
+// checkConsoleSessions closes the sessions which reached their limits
+// and stops the tunnel if no session needs it any more.
+// The idle time is for the tunnel as a whole since the requests do not
+// identify the app instance.
+func checkConsoleSessions(ctx *wstunnelclientContext, now time.Time) {
+	var lastActivity time.Time
+	if ctx.wstunnelclient != nil {
+		lastActivity = ctx.wstunnelclient.Status().LastActivity
+		if ctx.tunnelStart.After(lastActivity) {
+			lastActivity = ctx.tunnelStart
+		}
+	}
+	changed := false
+	for _, c := range ctx.subAppInstanceConfig.GetAll() {
+		config, err := cast.CastAppInstanceConfig(c)
+		if err != nil {
+			log.Errorf("checkConsoleSessions: %s\n", err)
+			continue
+		}
+		s, ok := ctx.sessions[config.Key()]
+		if !ok || s.closed != "" {
+			continue
+		}
+		maxDuration, idleTimeout := consoleLimits(ctx, config)
+		s.closed = sessionLimitReached(s, maxDuration, idleTimeout,
+			lastActivity, now)
+		if s.closed != "" {
+			log.Infof("Remote console session for %s closed: %s\n",
+				config.DisplayName, s.closed)
+			changed = true
+		}
+	}
+	if changed {
+		scanAIConfigs(ctx)
+	}
+}
+
+// sessionLimitReached returns why the session needs to be closed, or ""
+// if it does not. A zero lastActivity means there is no tunnel hence the
+// session can not be idle.
+func sessionLimitReached(s *consoleSession, maxDuration time.Duration,
+	idleTimeout time.Duration, lastActivity time.Time,
+	now time.Time) string {
+
+	if maxDuration != 0 && now.Sub(s.start) > maxDuration {
+		return "maximum duration"
+	}
+	if idleTimeout != 0 && !lastActivity.IsZero() {
+		idleStart := lastActivity
+		if s.start.After(idleStart) {
+			idleStart = s.start
+		}
+		if now.Sub(idleStart) > idleTimeout {
+			return "idle timeout"
+		}
+	}
+	return ""
+}
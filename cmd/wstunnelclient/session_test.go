@@ -0,0 +1,96 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wstunnelclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestSessionLimitReached(t *testing.T) {
+	start := time.Now()
+	s := &consoleSession{version: "1", start: start}
+	tests := []struct {
+		name         string
+		maxDuration  time.Duration
+		idleTimeout  time.Duration
+		lastActivity time.Time
+		now          time.Time
+		expected     string
+	}{
+		{"no limits", 0, 0, start, start.Add(24 * time.Hour), ""},
+		{"within duration", time.Hour, 0, start,
+			start.Add(30 * time.Minute), ""},
+		{"duration", time.Hour, 0, start, start.Add(61 * time.Minute),
+			"maximum duration"},
+		{"active", time.Hour, 10 * time.Minute,
+			start.Add(25 * time.Minute), start.Add(30 * time.Minute), ""},
+		{"idle", time.Hour, 10 * time.Minute,
+			start.Add(15 * time.Minute), start.Add(30 * time.Minute),
+			"idle timeout"},
+		// Activity before the session started does not count
+		{"idle since start", 0, 10 * time.Minute,
+			start.Add(-time.Hour), start.Add(5 * time.Minute), ""},
+		{"idle after start", 0, 10 * time.Minute,
+			start.Add(-time.Hour), start.Add(11 * time.Minute),
+			"idle timeout"},
+		// No tunnel hence not idle
+		{"no tunnel", 0, 10 * time.Minute, time.Time{},
+			start.Add(time.Hour), ""},
+		{"duration first", time.Hour, 10 * time.Minute,
+			start, start.Add(2 * time.Hour), "maximum duration"},
+	}
+	for _, test := range tests {
+		reason := sessionLimitReached(s, test.maxDuration,
+			test.idleTimeout, test.lastActivity, test.now)
+		if reason != test.expected {
+			t.Errorf("%s: got %q expected %q\n", test.name, reason,
+				test.expected)
+		}
+	}
+}
+
+// The per app instance limits override the GlobalConfig ones
+func TestConsoleLimits(t *testing.T) {
+	ctx := wstunnelclientContext{globalConfig: types.GlobalConfigDefaults}
+	ctx.globalConfig.RemoteConsoleMaxDuration = 3600
+	ctx.globalConfig.RemoteConsoleIdleTimeout = 600
+	config := types.AppInstanceConfig{}
+	maxDuration, idleTimeout := consoleLimits(&ctx, config)
+	if maxDuration != time.Hour || idleTimeout != 10*time.Minute {
+		t.Errorf("Global got %v %v\n", maxDuration, idleTimeout)
+	}
+	config.RemoteConsoleMaxDuration = 60
+	config.RemoteConsoleIdleTimeout = 30
+	maxDuration, idleTimeout = consoleLimits(&ctx, config)
+	if maxDuration != time.Minute || idleTimeout != 30*time.Second {
+		t.Errorf("Per app got %v %v\n", maxDuration, idleTimeout)
+	}
+}
+
+// A closed session is reopened by a new version of the config
+func TestConsoleSessionActive(t *testing.T) {
+	ctx := wstunnelclientContext{
+		sessions: make(map[string]*consoleSession),
+	}
+	config := types.AppInstanceConfig{RemoteConsole: true}
+	config.UUIDandVersion.Version = "1"
+	if !consoleSessionActive(&ctx, config) {
+		t.Errorf("New session not active\n")
+	}
+	ctx.sessions[config.Key()].closed = "idle timeout"
+	if consoleSessionActive(&ctx, config) {
+		t.Errorf("Closed session active\n")
+	}
+	config.UUIDandVersion.Version = "2"
+	if !consoleSessionActive(&ctx, config) {
+		t.Errorf("Session not reopened by a new version\n")
+	}
+	pruneConsoleSessions(&ctx, map[string]bool{})
+	if len(ctx.sessions) != 0 {
+		t.Errorf("Session not pruned\n")
+	}
+}
@@ -6,10 +6,10 @@ package wstunnelclient
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"strings"
+	"net"
 
 	"os"
+	"sort"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
@@ -25,7 +25,6 @@ import (
 const (
 	agentName       = "wstunnelclient"
 	identityDirname = "/config"
-	serverFilename  = identityDirname + "/server"
 )
 
 // Set from Makefile
@@ -35,6 +34,7 @@ var Version = "No version specified"
 type DNSContext struct {
 	usableAddressCount     int
 	DNSinitialized         bool // Received initial DeviceNetworkStatus
+	addressChanged         bool // Tunnel might need a different source
 	subDeviceNetworkStatus *pubsub.Subscription
 	deviceNetworkStatus    *types.DeviceNetworkStatus
 }
@@ -42,10 +42,30 @@ type DNSContext struct {
 type wstunnelclientContext struct {
 	subGlobalConfig      *pubsub.Subscription
 	subAppInstanceConfig *pubsub.Subscription
+	pubTunnelStatus      *pubsub.Publication
+	pubTunnelAudit       *pubsub.Publication
+	auditChan            chan types.TunnelAuditEvent
+	auditSequence        uint64
+	consoleApps          []consoleApp // Using the tunnel
 	serverName           string
 	wstunnelclient       *zedcloud.WSTunnelClient
+	tunnelIntf           string // Port and source address used by the tunnel
+	tunnelAddr           net.IP
+	tunnelStart          time.Time
+	lastWorking          tunnelCandidate // Tried first when connecting
+	migrateIntf          string          // Preferred port in the holdoff
+	migrateSince         time.Time
+	lastConnectAttempt   time.Time
+	tunnelRequired       bool
+	sessions             map[string]*consoleSession // By app instance key
+	globalConfig         types.GlobalConfig
 	dnsContext           *DNSContext
 	// XXX add any output from scanAIConfigs()?
+
+	// On-demand tunnels; see accessrequest.go
+	subRemoteAccessRequest *pubsub.Subscription
+	subAppNetworkStatus    *pubsub.Subscription
+	activeAccessRequests   map[string]bool
 }
 
 var debug = false
@@ -87,7 +107,28 @@ func Run() {
 		deviceNetworkStatus: &types.DeviceNetworkStatus{},
 	}
 
-	wscCtx := wstunnelclientContext{}
+	wscCtx := wstunnelclientContext{
+		sessions:     make(map[string]*consoleSession),
+		globalConfig: types.GlobalConfigDefaults,
+	}
+
+	pubTunnelStatus, err := pubsub.Publish(agentName,
+		types.WSTunnelStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	wscCtx.pubTunnelStatus = pubTunnelStatus
+
+	pubTunnelAudit, err := pubsub.Publish(agentName,
+		types.TunnelAuditEvent{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	wscCtx.pubTunnelAudit = pubTunnelAudit
+	wscCtx.auditChan = make(chan types.TunnelAuditEvent, 100)
+
+	// Publish tunnel health periodically
+	publishTimer := time.NewTicker(10 * time.Second)
 
 	// Look for global config such as log levels
 	subGlobalConfig, err := pubsub.Subscribe("", types.GlobalConfig{},
@@ -105,7 +146,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	DNSctx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -121,14 +162,34 @@ func Run() {
 	subAppInstanceConfig.DeleteHandler = handleAppInstanceConfigDelete
 	wscCtx.subAppInstanceConfig = subAppInstanceConfig
 
+	subRemoteAccessRequest, err := pubsub.Subscribe("zedagent",
+		types.RemoteAccessRequest{}, false, &wscCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	subRemoteAccessRequest.ModifyHandler = handleRemoteAccessRequestModify
+	subRemoteAccessRequest.DeleteHandler = handleRemoteAccessRequestDelete
+	wscCtx.subRemoteAccessRequest = subRemoteAccessRequest
+
+	// To check the destination of a RemoteAccessRequest
+	subAppNetworkStatus, err := pubsub.Subscribe("zedrouter",
+		types.AppNetworkStatus{}, false, &wscCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	subAppNetworkStatus.ModifyHandler = handleAppNetworkStatusModify
+	subAppNetworkStatus.DeleteHandler = handleAppNetworkStatusDelete
+	wscCtx.subAppNetworkStatus = subAppNetworkStatus
+	subAppNetworkStatus.Activate()
+
 	//get server name
-	bytes, err := ioutil.ReadFile(serverFilename)
+	servers, err := zedcloud.NewServerList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	strTrim := strings.TrimSpace(string(bytes))
-	wscCtx.serverName = strings.Split(strTrim, ":")[0]
+	wscCtx.serverName = servers.CurrentHost()
 	subAppInstanceConfig.Activate()
+	subRemoteAccessRequest.Activate()
 
 	wscCtx.dnsContext = &DNSctx
 	// Wait for knowledge about IP addresses. XXX needed?
@@ -150,10 +211,29 @@ func Run() {
 
 		case change := <-subDeviceNetworkStatus.C:
 			subDeviceNetworkStatus.ProcessChange(change)
+			if DNSctx.addressChanged {
+				DNSctx.addressChanged = false
+				maybeMigrateTunnel(&wscCtx)
+			}
 
 		case change := <-subAppInstanceConfig.C:
 			subAppInstanceConfig.ProcessChange(change)
 
+		case change := <-subRemoteAccessRequest.C:
+			subRemoteAccessRequest.ProcessChange(change)
+
+		case change := <-subAppNetworkStatus.C:
+			subAppNetworkStatus.ProcessChange(change)
+
+		case event := <-wscCtx.auditChan:
+			recordAudit(&wscCtx, event)
+
+		case <-publishTimer.C:
+			checkTunnelHealth(&wscCtx)
+			checkConsoleSessions(&wscCtx, time.Now())
+			checkAccessRequests(&wscCtx)
+			publishTunnelStatus(&wscCtx)
+
 		case <-stillRunning.C:
 			agentlog.StillRunning(agentName)
 		}
@@ -169,11 +249,26 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 		return
 	}
 	log.Infof("handleGlobalConfigModify for %s\n", key)
-	debug, _ = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
+	var gcp *types.GlobalConfig
+	debug, gcp = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
+	if gcp != nil {
+		ctx.globalConfig = *gcp
+		applyTunnelConfig(ctx)
+	}
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
 
+func applyTunnelConfig(ctx *wstunnelclientContext) {
+	if ctx.wstunnelclient == nil {
+		return
+	}
+	ctx.wstunnelclient.SetRateLimit(
+		uint64(ctx.globalConfig.RemoteConsoleRxRate),
+		uint64(ctx.globalConfig.RemoteConsoleTxRate))
+	ctx.wstunnelclient.SetOCSPPolicy(ctx.globalConfig.OCSPPolicy)
+}
+
 func handleGlobalConfigDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
@@ -185,12 +280,19 @@ func handleGlobalConfigDelete(ctxArg interface{}, key string,
 	log.Infof("handleGlobalConfigDelete for %s\n", key)
 	debug, _ = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
+	ctx.globalConfig = types.GlobalConfigDefaults
+	applyTunnelConfig(ctx)
 	log.Infof("handleGlobalConfigDelete done for %s\n", key)
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DNSContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -201,24 +303,45 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(*ctx.deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
+	}
+	// The tunnel is bound to a source address which might be gone
+	if ctx.DNSinitialized &&
+		!cmp.Equal(mgmtAddrs(*ctx.deviceNetworkStatus), mgmtAddrs(status)) {
+		ctx.addressChanged = true
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(*ctx.deviceNetworkStatus, status))
 	*ctx.deviceNetworkStatus = status
 	newAddrCount := types.CountLocalAddrAnyNoLinkLocal(*ctx.deviceNetworkStatus)
-	if newAddrCount != 0 && ctx.usableAddressCount == 0 {
+	if newAddrCount != ctx.usableAddressCount {
 		log.Infof("DeviceNetworkStatus from %d to %d addresses\n",
 			ctx.usableAddressCount, newAddrCount)
-		// XXX do we need to trigger something like a reconnect?
 	}
 	ctx.DNSinitialized = true
 	ctx.usableAddressCount = newAddrCount
 	log.Infof("handleDNSModify done for %s\n", key)
 }
 
+// Addresses on the management ports, for change detection
+func mgmtAddrs(status types.DeviceNetworkStatus) []string {
+	var addrs []string
+	for _, port := range status.Ports {
+		if !types.IsMgmtPort(status, port.IfName) {
+			continue
+		}
+		for _, ai := range port.AddrInfoList {
+			addrs = append(addrs, port.IfName+"/"+ai.Addr.String())
+		}
+	}
+	return addrs
+}
+
 func handleDNSDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
@@ -255,76 +378,206 @@ func handleAppInstanceConfigDelete(ctxArg interface{}, key string,
 	log.Infof("handleAppInstanceConfigDelete done for %s\n", key)
 }
 
+// Management ports in the order we try them for the tunnel; free first
+func tunnelPorts(status types.DeviceNetworkStatus) []string {
+	ports := types.GetMgmtPortsFree(status, 0)
+	return append(ports, types.GetMgmtPortsNonFree(status, 0)...)
+}
+
+// A port which is tried before the tunnel port has to be usable for this
+// long, and the tunnel up for this long, before we move the tunnel to it.
+// Avoids flapping between ports when an address comes and goes.
+const migrateHoldoff = 2 * time.Minute
+
+// Replaced by the tests
+var migrateTunnel = restartTunnel
+
+// maybeMigrateTunnel is called when the management port addresses change,
+// and periodically during the holdoff. Move the tunnel if its source
+// address is gone or if a port which is tried before the current one
+// has had an address for migrateHoldoff.
+func maybeMigrateTunnel(ctx *wstunnelclientContext) {
+	if ctx.wstunnelclient == nil {
+		// Perhaps we could not connect before
+		scanAIConfigs(ctx)
+		publishTunnelStatus(ctx)
+		return
+	}
+	status := *ctx.dnsContext.deviceNetworkStatus
+	if !hasAddr(status, ctx.tunnelIntf, ctx.tunnelAddr) {
+		migrateTunnel(ctx, fmt.Sprintf("%s lost %v",
+			ctx.tunnelIntf, ctx.tunnelAddr))
+		return
+	}
+	for _, ifname := range tunnelPorts(status) {
+		if ifname == ctx.tunnelIntf {
+			log.Infof("maybeMigrateTunnel: keeping tunnel on %s\n",
+				ifname)
+			ctx.migrateIntf = ""
+			return
+		}
+		if types.CountLocalAddrAnyNoLinkLocalIf(status, ifname) == 0 {
+			continue
+		}
+		if ctx.migrateIntf != ifname {
+			ctx.migrateIntf = ifname
+			ctx.migrateSince = time.Now()
+		}
+		since := ctx.migrateSince
+		if ctx.tunnelStart.After(since) {
+			since = ctx.tunnelStart
+		}
+		if time.Since(since) < migrateHoldoff {
+			log.Infof("maybeMigrateTunnel: %s usable; holdoff\n",
+				ifname)
+			return
+		}
+		migrateTunnel(ctx, fmt.Sprintf("%s usable", ifname))
+		return
+	}
+}
+
+func hasAddr(status types.DeviceNetworkStatus, ifname string,
+	addr net.IP) bool {
+
+	for i := 0; i < types.CountLocalAddrAnyNoLinkLocalIf(status, ifname); i++ {
+		a, err := types.GetLocalAddrAnyNoLinkLocal(status, i, ifname)
+		if err == nil && a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redo the connection test so we pick a currently working interface
+// and source address
+func restartTunnel(ctx *wstunnelclientContext, reason string) {
+	if ctx.wstunnelclient == nil {
+		return
+	}
+	log.Infof("restartTunnel from %s/%v: %s\n",
+		ctx.tunnelIntf, ctx.tunnelAddr, reason)
+	stopTunnel(ctx)
+	// Try in priority order since we are moving for a reason
+	ctx.lastWorking = tunnelCandidate{}
+	scanAIConfigs(ctx)
+	publishTunnelStatus(ctx)
+}
+
+func stopTunnel(ctx *wstunnelclientContext) {
+	ctx.wstunnelclient.Stop()
+	ctx.wstunnelclient = nil
+	ctx.tunnelIntf = ""
+	ctx.tunnelAddr = nil
+	ctx.migrateIntf = ""
+}
+
+func publishTunnelStatus(ctx *wstunnelclientContext) {
+	status := types.WSTunnelStatus{ServerName: ctx.serverName}
+	if ctx.wstunnelclient != nil {
+		status = ctx.wstunnelclient.Status()
+	}
+	log.Debugf("publishTunnelStatus connected %t uptime %v reconnects %d last error %s\n",
+		status.Connected, status.Uptime(), status.ReconnectCount,
+		status.Error)
+	ctx.pubTunnelStatus.Publish(status.Key(), status)
+}
+
 // walk over all instances to determine new value
 func scanAIConfigs(ctx *wstunnelclientContext) {
 
 	isTunnelRequired := false
+	var channels []types.TunnelChannel
+	consoleApps := make(map[string]bool)
+	ctx.consoleApps = nil
 	sub := ctx.subAppInstanceConfig
 	items := sub.GetAll()
 	for _, c := range items {
-		config := cast.CastAppInstanceConfig(c)
+		config, err := cast.CastAppInstanceConfig(c)
+		if err != nil {
+			log.Errorf("scanAIConfigs: %s\n", err)
+			continue
+		}
 		log.Debugf("Remote console status for app-instance: %s: %t\n",
 			config.DisplayName, config.RemoteConsole)
-		isTunnelRequired = config.RemoteConsole || isTunnelRequired
+		if !config.RemoteConsole {
+			continue
+		}
+		consoleApps[config.Key()] = true
+		if !consoleSessionActive(ctx, config) {
+			log.Debugf("Remote console session for %s closed\n",
+				config.DisplayName)
+			continue
+		}
+		isTunnelRequired = true
+		channels = addChannels(channels, config.RemoteConsoleChannels)
+		app := consoleApp{uuid: config.UUIDandVersion.UUID.String(),
+			name: config.DisplayName}
+		for _, c := range config.RemoteConsoleChannels {
+			app.channels = append(app.channels, c.Name)
+		}
+		ctx.consoleApps = append(ctx.consoleApps, app)
+	}
+	pruneConsoleSessions(ctx, consoleApps)
+
+	accessRequests, accessApps := activeAccessRequests(ctx, time.Now())
+	ctx.activeAccessRequests = make(map[string]bool)
+	for _, req := range accessRequests {
+		log.Debugf("RemoteAccessRequest %s to %s until %v\n",
+			req.RequestId, req.Destination, req.NotAfter)
+		ctx.activeAccessRequests[req.RequestId] = true
+		isTunnelRequired = true
+		channels = addChannels(channels, []types.TunnelChannel{
+			{Name: req.ChannelName(), Addr: req.Destination}})
 	}
+	ctx.consoleApps = append(ctx.consoleApps, accessApps...)
+	// GetAll order is random; keep the channel identifiers stable
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
 	log.Infof("Tunnel check status after checking app-instance configs: %t\n",
 		isTunnelRequired)
+	ctx.tunnelRequired = isTunnelRequired
 
 	if !isTunnelRequired {
 		if ctx.wstunnelclient != nil {
-			ctx.wstunnelclient.Stop()
-			ctx.wstunnelclient = nil
+			stopTunnel(ctx)
 		}
 		return
 	}
 	if ctx.wstunnelclient != nil {
+		if ctx.wstunnelclient.SetChannels(channels) {
+			log.Infof("Tunnel channels changed to %v\n", channels)
+			ctx.wstunnelclient.Reconnect()
+		}
 		return
 	}
-	deviceNetworkStatus := ctx.dnsContext.deviceNetworkStatus
-	for _, port := range deviceNetworkStatus.Ports {
-		ifname := port.IfName
-		if !types.IsMgmtPort(*deviceNetworkStatus, ifname) {
-			log.Debugf("Skipping connection using non-mangement intf %s\n",
-				ifname)
-			continue
-		}
-		wstunnelclient := zedcloud.InitializeTunnelClient(ctx.serverName, "localhost:4822")
-		destURL := wstunnelclient.Tunnel
-
-		addrCount := types.CountLocalAddrAnyNoLinkLocalIf(*deviceNetworkStatus, ifname)
-		log.Infof("Connecting to %s using intf %s #sources %d\n",
-			destURL, ifname, addrCount)
-
-		if addrCount == 0 {
-			errStr := fmt.Sprintf("No IP addresses to connect to %s using intf %s",
-				destURL, ifname)
-			log.Infoln(errStr)
-			continue
-		}
-
-		var connected bool
-		for retryCount := 0; retryCount < addrCount; retryCount++ {
-			localAddr, err := types.GetLocalAddrAnyNoLinkLocal(*deviceNetworkStatus,
-				retryCount, ifname)
-			if err != nil {
-				log.Info(err)
-				continue
-			}
+	if !connectTunnel(ctx, channels) {
+		log.Errorf("Could not connect tunnel to %s on any port\n",
+			ctx.serverName)
+	}
+}
 
-			proxyURL, _ := zedcloud.LookupProxy(deviceNetworkStatus,
-				ifname, destURL)
-			if err := wstunnelclient.TestConnection(proxyURL, localAddr); err != nil {
-				log.Info(err)
-				continue
+// Add the channels which are not already present. The first app instance
+// to use a name determines its address.
+func addChannels(channels []types.TunnelChannel,
+	add []types.TunnelChannel) []types.TunnelChannel {
+
+	for _, a := range add {
+		found := false
+		for _, c := range channels {
+			if c.Name == a.Name {
+				found = true
+				if c.Addr != a.Addr {
+					log.Warnf("Tunnel channel %s: ignoring %s; using %s\n",
+						a.Name, a.Addr, c.Addr)
+				}
+				break
 			}
-			connected = true
-			break
 		}
-		if connected == true {
-			wstunnelclient.Start()
-			ctx.wstunnelclient = wstunnelclient
-			break
+		if !found {
+			channels = append(channels, a)
 		}
-		log.Infof("Could not connect to %s using intf %s\n", destURL, ifname)
 	}
+	return channels
 }
@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wstunnelclient
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+// The first app instance to use a channel name determines its address
+func TestAddChannels(t *testing.T) {
+	app1 := []types.TunnelChannel{
+		{Name: "ssh", Addr: "localhost:22"},
+		{Name: "console", Addr: "localhost:5900"},
+	}
+	app2 := []types.TunnelChannel{
+		{Name: "ssh", Addr: "localhost:2222"},
+		{Name: "web", Addr: "localhost:8080"},
+	}
+	var channels []types.TunnelChannel
+	channels = addChannels(channels, app1)
+	channels = addChannels(channels, app2)
+	expected := []types.TunnelChannel{
+		{Name: "ssh", Addr: "localhost:22"},
+		{Name: "console", Addr: "localhost:5900"},
+		{Name: "web", Addr: "localhost:8080"},
+	}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Got %v\n", channels)
+	}
+}
+
+// A preferred port has to stay usable for migrateHoldoff
+func TestMigrateHoldoff(t *testing.T) {
+	var reasons []string
+	oldMigrate := migrateTunnel
+	migrateTunnel = func(ctx *wstunnelclientContext, reason string) {
+		reasons = append(reasons, reason)
+	}
+	defer func() { migrateTunnel = oldMigrate }()
+
+	port := func(ifname string, free bool, addr string) types.NetworkPortStatus {
+		p := types.NetworkPortStatus{IfName: ifname, IsMgmt: true,
+			Free: free}
+		if addr != "" {
+			p.AddrInfoList = []types.AddrInfo{{Addr: net.ParseIP(addr)}}
+		}
+		return p
+	}
+	dns := &DNSContext{deviceNetworkStatus: &types.DeviceNetworkStatus{}}
+	ctx := &wstunnelclientContext{dnsContext: dns,
+		wstunnelclient: &zedcloud.WSTunnelClient{},
+		tunnelIntf:     "wwan0", tunnelAddr: net.ParseIP("10.1.0.2"),
+		tunnelStart: time.Now().Add(-time.Hour)}
+	wwan0 := port("wwan0", false, "10.1.0.2")
+
+	// The free port gets an address
+	dns.deviceNetworkStatus.Ports = []types.NetworkPortStatus{
+		port("eth0", true, "192.168.1.10"), wwan0}
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 0 || ctx.migrateIntf != "eth0" {
+		t.Errorf("Migrated during the holdoff: %v\n", reasons)
+	}
+
+	// and loses it again before the holdoff
+	dns.deviceNetworkStatus.Ports[0] = port("eth0", true, "")
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 0 || ctx.migrateIntf != "" {
+		t.Errorf("Holdoff not cleared: %v %s\n", reasons,
+			ctx.migrateIntf)
+	}
+
+	// Back again; the holdoff starts over
+	dns.deviceNetworkStatus.Ports[0] = port("eth0", true, "192.168.1.10")
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 0 {
+		t.Errorf("Migrated during the holdoff: %v\n", reasons)
+	}
+	ctx.migrateSince = time.Now().Add(-migrateHoldoff)
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 1 || reasons[0] != "eth0 usable" {
+		t.Errorf("Not migrated after the holdoff: %v\n", reasons)
+	}
+
+	// A recently started tunnel is kept for the holdoff
+	reasons = nil
+	ctx.tunnelStart = time.Now()
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 0 {
+		t.Errorf("Migrated a new tunnel: %v\n", reasons)
+	}
+
+	// Losing the source address moves the tunnel at once
+	dns.deviceNetworkStatus.Ports[1] = port("wwan0", false, "10.1.0.3")
+	maybeMigrateTunnel(ctx)
+	if len(reasons) != 1 || reasons[0] != "wwan0 lost 10.1.0.2" {
+		t.Errorf("Not migrated after losing the address: %v\n", reasons)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Raise alarms when /persist or /config is close to full, and if enabled
+// remove old logs when /persist is critical. domainmgr removes the unused
+// app images based on the alarm.
+
+package zedagent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/types"
+)
+
+var alarmPaths = []string{persistPath, "/config"}
+
+// Log files not written for this long are removed by the cleanup
+const oldLogAge = 24 * time.Hour
+
+func checkDiskSpace(ctx *zedagentContext) {
+	for _, path := range alarmPaths {
+		u, err := disk.Usage(path)
+		if err != nil {
+			log.Errorf("checkDiskSpace: %s\n", err)
+			continue
+		}
+		alarm := types.DiskSpaceAlarm{
+			MountPath:   path,
+			UsedPercent: int(u.UsedPercent),
+			TotalBytes:  u.Total,
+			FreeBytes:   u.Free,
+		}
+		alarm.Level = types.DiskSpaceLevelFor(alarm.UsedPercent,
+			globalConfig.GetStorageWarnPercent(),
+			globalConfig.GetStorageCriticalPercent())
+		alarm.Cleanup = alarm.Level == types.DiskSpaceCritical &&
+			globalConfig.StorageCleanup == types.TS_ENABLED
+		prevLevel := types.DiskSpaceOK
+		if st, _ := ctx.pubDiskSpaceAlarm.Get(alarm.Key()); st != nil {
+			prev, err := cast.CastDiskSpaceAlarm(st)
+			if err != nil {
+				log.Errorf("checkDiskSpace: %s\n", err)
+				continue
+			}
+			prevLevel = prev.Level
+			alarm.LevelTime = prev.LevelTime
+		}
+		if alarm.Level != prevLevel {
+			alarm.LevelTime = time.Now()
+			if alarm.Level == types.DiskSpaceOK {
+				log.Infof("Disk space %s ok: %d%% used\n",
+					path, alarm.UsedPercent)
+			} else {
+				log.Warnf("Disk space %s %s: %d%% used %d bytes free\n",
+					path, alarm.Level, alarm.UsedPercent,
+					alarm.FreeBytes)
+			}
+		}
+		if alarm.Cleanup && path == persistPath {
+			removeOldLogs([]string{agentlog.GetCurrentLogdir(),
+				persistPath + "/log"}, oldLogAge)
+		}
+		ctx.pubDiskSpaceAlarm.Publish(alarm.Key(), alarm)
+	}
+}
+
+// removeOldLogs removes the files in the directories which have not
+// been modified for maxAge. The current log of a quiet agent can be that
+// old, hence we skip the files which a process has open; removing those
+// would neither free the space nor keep the log.
+func removeOldLogs(dirnames []string, maxAge time.Duration) {
+	open := openFiles(procDir)
+	for _, dirname := range dirnames {
+		locations, err := ioutil.ReadDir(dirname)
+		if err != nil {
+			continue
+		}
+		for _, location := range locations {
+			if !location.Mode().IsRegular() ||
+				time.Since(location.ModTime()) < maxAge {
+				continue
+			}
+			filename := filepath.Join(dirname, location.Name())
+			if open[filename] {
+				log.Debugf("removeOldLogs: %s in use\n", filename)
+				continue
+			}
+			log.Infof("removeOldLogs: removing %s size %d\n",
+				filename, location.Size())
+			if err := os.Remove(filename); err != nil {
+				log.Errorln(err)
+			}
+		}
+	}
+}
+
+// Replaced by the tests
+var procDir = "/proc"
+
+// openFiles returns the files open by any process, based on the fd
+// symlinks under procDir
+func openFiles(procDir string) map[string]bool {
+	open := make(map[string]bool)
+	fds, err := filepath.Glob(procDir + "/[0-9]*/fd/*")
+	if err != nil {
+		log.Errorf("openFiles: %s\n", err)
+		return open
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink(fd)
+		if err != nil {
+			// The process or the fd went away
+			continue
+		}
+		open[target] = true
+	}
+	return open
+}
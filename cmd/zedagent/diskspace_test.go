@@ -0,0 +1,69 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedagent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRemoveOldLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskspace")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	logdir := filepath.Join(dir, "log")
+	fdDir := filepath.Join(dir, "proc", "123", "fd")
+	for _, d := range []string{logdir, fdDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %s\n", err)
+		}
+	}
+	old := time.Now().Add(-2 * oldLogAge)
+	files := map[string]time.Time{
+		"zedagent.log":     old, // Current log of a quiet agent
+		"zedagent.log.1":   old,
+		"downloader.log":   time.Now(),
+		"device-steps.log": old,
+	}
+	for name, mtime := range files {
+		filename := filepath.Join(logdir, name)
+		if err := ioutil.WriteFile(filename, []byte("log\n"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %s\n", err)
+		}
+		if err := os.Chtimes(filename, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %s\n", err)
+		}
+	}
+	for i, name := range []string{"zedagent.log", "device-steps.log"} {
+		err := os.Symlink(filepath.Join(logdir, name),
+			filepath.Join(fdDir, strconv.Itoa(3+i)))
+		if err != nil {
+			t.Fatalf("Symlink failed: %s\n", err)
+		}
+	}
+	saved := procDir
+	procDir = filepath.Join(dir, "proc")
+	defer func() { procDir = saved }()
+
+	removeOldLogs([]string{logdir, filepath.Join(dir, "missing")},
+		oldLogAge)
+	for name, expected := range map[string]bool{
+		"zedagent.log":     true,
+		"zedagent.log.1":   false,
+		"downloader.log":   true,
+		"device-steps.log": true,
+	} {
+		_, err := os.Stat(filepath.Join(logdir, name))
+		if (err == nil) != expected {
+			t.Errorf("%s: expected present %v, got %v\n",
+				name, expected, err)
+		}
+	}
+}
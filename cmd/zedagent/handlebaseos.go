@@ -21,7 +21,11 @@ func lookupBaseOsConfig(ctx *getconfigContext, key string) *types.BaseOsConfig {
 		log.Infof("lookupBaseOsConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastBaseOsConfig(st)
+	config, err := cast.CastBaseOsConfig(st)
+	if err != nil {
+		log.Errorf("lookupBaseOsConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupBaseOsConfig(%s) got %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -37,7 +41,11 @@ func lookupBaseOsStatus(ctx *zedagentContext, key string) *types.BaseOsStatus {
 		log.Infof("lookupBaseOsStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastBaseOsStatus(st)
+	status, err := cast.CastBaseOsStatus(st)
+	if err != nil {
+		log.Errorf("lookupBaseOsStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupBaseOsStatus(%s) got %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -53,7 +61,11 @@ func initiateBaseOsZedCloudTestComplete(ctx *getconfigContext) {
 	pub := ctx.pubBaseOsConfig
 	items := pub.GetAll()
 	for key, c := range items {
-		config := cast.CastBaseOsConfig(c)
+		config, err := cast.CastBaseOsConfig(c)
+		if err != nil {
+			log.Errorf("initiateBaseOsZedCloudTestComplete: %s\n", err)
+			continue
+		}
 		if config.TestComplete {
 			continue
 		}
@@ -122,7 +134,7 @@ func getBaseOsPartitionStatusAll(ctx *zedagentContext) map[string]interface{} {
 	return items
 }
 
-func getBaseOsPartitionStatus(ctx *zedagentContext, partName string) *types.ZbootStatus {
+func getBaseOsPartitionStatus(ctx *zedagentContext, partName string) *types.BaseOsPartitionStatus {
 	partName = strings.TrimSpace(partName)
 	if !isBaseOsValidPartitionLabel(partName) {
 		log.Errorf("getBaseOsPartitionStatus(%s) invalid partition\n", partName)
@@ -130,7 +142,11 @@ func getBaseOsPartitionStatus(ctx *zedagentContext, partName string) *types.Zboo
 	}
 	items := getBaseOsPartitionStatusAll(ctx)
 	for _, st := range items {
-		status := cast.CastZbootStatus(st)
+		status, err := cast.CastBaseOsPartitionStatus(st)
+		if err != nil {
+			log.Errorf("getBaseOsPartitionStatus: %s\n", err)
+			continue
+		}
 		if status.PartitionLabel == partName {
 			return &status
 		}
@@ -147,7 +163,11 @@ func getBaseOsCurrentPartition(ctx *zedagentContext) string {
 	}
 	items := getBaseOsPartitionStatusAll(ctx)
 	for _, st := range items {
-		status := cast.CastZbootStatus(st)
+		status, err := cast.CastBaseOsPartitionStatus(st)
+		if err != nil {
+			log.Errorf("getBaseOsCurrentPartition: %s\n", err)
+			continue
+		}
 		if status.CurrentPartition {
 			log.Debugf("getBaseOsCurrentPartition:%s\n", status.PartitionLabel)
 			return status.PartitionLabel
@@ -165,7 +185,11 @@ func getBaseOsOtherPartition(ctx *zedagentContext) string {
 	}
 	items := getBaseOsPartitionStatusAll(ctx)
 	for _, st := range items {
-		status := cast.CastZbootStatus(st)
+		status, err := cast.CastBaseOsPartitionStatus(st)
+		if err != nil {
+			log.Errorf("getBaseOsOtherPartition: %s\n", err)
+			continue
+		}
 		if !status.CurrentPartition {
 			log.Debugf("getBaseOsOtherPartition:%s\n", status.PartitionLabel)
 			return status.PartitionLabel
@@ -35,15 +35,14 @@ var serverName string
 
 const (
 	identityDirname = "/config"
-	serverFilename  = identityDirname + "/server"
 	uuidFileName    = identityDirname + "/uuid"
 )
 
 var globalConfig = types.GlobalConfigDefaults
 
 type getconfigContext struct {
-	zedagentCtx                 *zedagentContext // Cross link
-	ledManagerCount             int              // Current count
+	zedagentCtx                 *zedagentContext      // Cross link
+	ledManagerState             types.DeviceStateCode // Current state
 	startTime                   time.Time
 	lastReceivedConfigFromCloud time.Time
 	readSavedConfig             bool
@@ -60,6 +59,7 @@ type getconfigContext struct {
 	pubBaseOsConfig             *pubsub.Publication
 	pubDatastoreConfig          *pubsub.Publication
 	pubNetworkInstanceConfig    *pubsub.Publication
+	pubRemoteAccessRequest      *pubsub.Publication
 	rebootFlag                  bool
 }
 
@@ -77,13 +77,12 @@ var nilUUID uuid.UUID
 
 func handleConfigInit() {
 
-	// get the server name
-	bytes, err := ioutil.ReadFile(serverFilename)
+	// get the server name; the requests fail over to the others
+	servers, err := zedcloud.NewServerList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	strTrim := strings.TrimSpace(string(bytes))
-	serverName = strings.Split(strTrim, ":")[0]
+	serverName = servers.CurrentHost()
 
 	tlsConfig, err := zedcloud.GetTlsConfig(serverName, nil)
 	if err != nil {
@@ -91,8 +90,20 @@ func handleConfigInit() {
 	}
 	zedcloudCtx.DeviceNetworkStatus = deviceNetworkStatus
 	zedcloudCtx.TlsConfig = tlsConfig
+	zedcloudCtx.Servers = servers
+	zedcloudCtx.CertProvider = zedcloud.DeviceCertProvider()
+	zedcloudCtx.AuthProviders, err = zedcloud.ReadAuthProviders(
+		zedcloud.AuthConfigFilename)
+	if err != nil {
+		log.Errorln(err)
+	}
 	zedcloudCtx.FailureFunc = zedcloud.ZedCloudFailure
 	zedcloudCtx.SuccessFunc = zedcloud.ZedCloudSuccess
+	zedcloudCtx.CompressionFunc = zedcloud.ZedCloudCompressed
+	zedcloudCtx.OCSPPolicy = globalConfig.OCSPPolicy
+	zedcloudCtx.Timeouts = zedcloud.TimeoutsFromGlobalConfig(globalConfig)
+	zedcloudCtx.PostResponseHooks = append(zedcloudCtx.PostResponseHooks,
+		zedcloud.ZedCloudMetricsHook)
 
 	b, err := ioutil.ReadFile(uuidFileName)
 	if err != nil {
@@ -119,11 +130,13 @@ func configTimerTask(handleChannel chan interface{},
 	getconfigCtx.rebootFlag = getLatestConfig(configUrl, iteration,
 		updateInprogress, getconfigCtx)
 
-	interval := time.Duration(globalConfig.ConfigInterval) * time.Second
+	interval := globalConfig.GetConfigInterval()
 	max := float64(interval)
 	min := max * 0.3
 	ticker := flextimer.NewRangeTicker(time.Duration(min),
 		time.Duration(max))
+	// Fetch right away after a suspend or when NTP first sets the clock
+	ticker.SetCatchUp(true)
 	// Return handle to caller
 	handleChannel <- ticker
 	for range ticker.C {
@@ -148,7 +161,7 @@ func triggerGetConfig(tickerHandle interface{}) {
 // Called when globalConfig changes
 // Assumes the caller has verifier that the interval has changed
 func updateConfigTimer(tickerHandle interface{}) {
-	interval := time.Duration(globalConfig.ConfigInterval) * time.Second
+	interval := globalConfig.GetConfigInterval()
 	log.Infof("updateConfigTimer() change to %v\n", interval)
 	max := float64(interval)
 	min := max * 0.3
@@ -171,7 +184,7 @@ func getLatestConfig(url string, iteration int, updateInprogress bool,
 	// Did we exceed the time limits?
 	timePassed := time.Since(getconfigCtx.lastReceivedConfigFromCloud)
 
-	resetLimit := time.Second * time.Duration(globalConfig.ResetIfCloudGoneTime)
+	resetLimit := globalConfig.GetResetIfCloudGoneTime()
 	if timePassed > resetLimit {
 		errStr := fmt.Sprintf("Exceeded outage for cloud connectivity %d by %d seconds; rebooting\n",
 			resetLimit/time.Second,
@@ -183,7 +196,7 @@ func getLatestConfig(url string, iteration int, updateInprogress bool,
 		return true
 	}
 	if updateInprogress {
-		fallbackLimit := time.Second * time.Duration(globalConfig.FallbackIfCloudGoneTime)
+		fallbackLimit := globalConfig.GetFallbackIfCloudGoneTime()
 		if timePassed > fallbackLimit {
 			errStr := fmt.Sprintf("Exceeded fallback outage for cloud connectivity %d by %d seconds; rebooting\n",
 				fallbackLimit/time.Second,
@@ -197,13 +210,13 @@ func getLatestConfig(url string, iteration int, updateInprogress bool,
 	}
 
 	const return400 = false
-	resp, contents, err := zedcloud.SendOnAllIntf(zedcloudCtx, url, 0, nil, iteration, return400)
+	res, err := zedcloud.SendOnAllIntf(zedcloudCtx, url, 0, nil, iteration, return400)
 	if err != nil {
 		log.Errorf("getLatestConfig failed: %s\n", err)
-		if getconfigCtx.ledManagerCount == 4 {
+		if getconfigCtx.ledManagerState == types.DeviceStateOnboarded {
 			// Inform ledmanager about loss of config from cloud
-			types.UpdateLedManagerConfig(2)
-			getconfigCtx.ledManagerCount = 2
+			types.UpdateLedManagerConfig(types.DeviceStateConnectingController)
+			getconfigCtx.ledManagerState = types.DeviceStateConnectingController
 		}
 		// If we didn't yet get a config, then look for a file
 		// XXX should we try a few times?
@@ -234,15 +247,16 @@ func getLatestConfig(url string, iteration int, updateInprogress bool,
 		// Wait for a bit to detect an agent crash. Should run for
 		// at least N minutes to make sure we don't hit a watchdog.
 		timePassed := time.Since(getconfigCtx.startTime)
-		successLimit := time.Second *
-			time.Duration(globalConfig.MintimeUpdateSuccess)
+		successLimit := globalConfig.GetMintimeUpdateSuccess()
 		ctx := getconfigCtx.zedagentCtx
 		curPart := getBaseOsCurrentPartition(ctx)
 		if timePassed < successLimit {
 			log.Infof("getLatestConfig, curPart %s inprogress waiting for %d seconds\n", curPart, (successLimit-timePassed)/time.Second)
 			ctx.remainingTestTime = successLimit - timePassed
 		} else {
-			initiateBaseOsZedCloudTestComplete(getconfigCtx)
+			if checkUpdateHealth(getconfigCtx) {
+				return true
+			}
 			ctx.remainingTestTime = 0
 		}
 		// Send updated remainingTestTime to zedcloud
@@ -257,29 +271,29 @@ func getLatestConfig(url string, iteration int, updateInprogress bool,
 	// a short timeout during validation of a image post update.
 	zboot.WatchdogOK()
 
-	if err := validateConfigMessage(url, resp); err != nil {
+	if err := validateConfigMessage(url, res.Resp); err != nil {
 		log.Errorln("validateConfigMessage: ", err)
 		// Inform ledmanager about cloud connectivity
-		types.UpdateLedManagerConfig(3)
-		getconfigCtx.ledManagerCount = 3
+		types.UpdateLedManagerConfig(types.DeviceStateConnected)
+		getconfigCtx.ledManagerState = types.DeviceStateConnected
 		return false
 	}
 
-	changed, config, err := readDeviceConfigProtoMessage(contents)
+	changed, config, err := readDeviceConfigProtoMessage(res.Contents)
 	if err != nil {
 		log.Errorln("readDeviceConfigProtoMessage: ", err)
 		// Inform ledmanager about cloud connectivity
-		types.UpdateLedManagerConfig(3)
-		getconfigCtx.ledManagerCount = 3
+		types.UpdateLedManagerConfig(types.DeviceStateConnected)
+		getconfigCtx.ledManagerState = types.DeviceStateConnected
 		return false
 	}
 
 	// Inform ledmanager about config received from cloud
-	types.UpdateLedManagerConfig(4)
-	getconfigCtx.ledManagerCount = 4
+	types.UpdateLedManagerConfig(types.DeviceStateOnboarded)
+	getconfigCtx.ledManagerState = types.DeviceStateOnboarded
 
 	getconfigCtx.lastReceivedConfigFromCloud = time.Now()
-	writeReceivedProtoMessage(contents)
+	writeReceivedProtoMessage(res.Contents)
 
 	if !changed {
 		log.Debugf("Configuration from zedcloud is unchanged\n")
@@ -350,7 +364,7 @@ func readSavedProtoMessage(filename string, force bool) (*zconfig.EdgeDevConfig,
 		}
 	}
 	age := time.Since(info.ModTime())
-	staleLimit := time.Second * time.Duration(globalConfig.StaleConfigTime)
+	staleLimit := globalConfig.GetStaleConfigTime()
 	if !force && age > staleLimit {
 		errStr := fmt.Sprintf("savedProto too old: age %v limit %d\n",
 			age, staleLimit)
@@ -9,12 +9,14 @@ package zedagent
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/tls"
+	"encoding/asn1"
 	"encoding/base64"
 	"fmt"
+	"math/big"
 	"net"
 	"os"
 	"os/exec"
@@ -24,7 +26,9 @@ import (
 	"github.com/eriknordmark/ipinfo"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/api/zconfig"
+	"github.com/zededa/go-provision/tpm"
 	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
 )
 
 const (
@@ -130,7 +134,7 @@ func handleLookupParam(getconfigCtx *getconfigContext,
 	log.Infof("handleLookupParam: updated lispInfo %v\n", lispInfo)
 
 	// Load device cert
-	deviceCert, err := tls.LoadX509KeyPair(deviceCertName,
+	deviceCert, err := zedcloud.LoadKeyPair(deviceCertName,
 		deviceKeyName)
 	if err != nil {
 		log.Fatal(err)
@@ -195,6 +199,22 @@ func handleLookupParam(getconfigCtx *getconfigContext,
 		log.Debugf("sigres (len %d): % x\n",
 			len(sigres), sigres)
 		log.Debugln("signature:", signature)
+	case *tpm.Signer:
+		key := deviceCert.PrivateKey.(*tpm.Signer)
+		b, err := key.Sign(rand.Reader, hash, crypto.SHA256)
+		if err != nil {
+			log.Fatal("tpm.Sign: ", err)
+		}
+		var sig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(b, &sig); err != nil {
+			log.Fatal("tpm.Sign: ", err)
+		}
+		sigres := sig.R.Bytes()
+		sigres = append(sigres, sig.S.Bytes()...)
+		signature = base64.StdEncoding.EncodeToString(sigres)
+		log.Debugln("signature:", signature)
 	}
 	log.Debugf("MapServers %+v\n", lispConfig.MapServers)
 	log.Debugf("Lisp IID %d\n", lispConfig.LispInstance)
@@ -45,6 +45,7 @@ var appPersistPaths = []string{"/persist/img", "/persist/downloads/appImg.obj"}
 func publishMetrics(ctx *zedagentContext, iteration int) {
 	cpuMemoryStat := ExecuteXentopCmd()
 	PublishMetricsToZedCloud(ctx, cpuMemoryStat, iteration)
+	checkDiskSpace(ctx)
 }
 
 // Run a periodic post of the metrics
@@ -54,7 +55,7 @@ func metricsTimerTask(ctx *zedagentContext, handleChannel chan interface{}) {
 	log.Infoln("starting report metrics timer task")
 	publishMetrics(ctx, iteration)
 
-	interval := time.Duration(globalConfig.MetricInterval) * time.Second
+	interval := globalConfig.GetMetricInterval()
 	max := float64(interval)
 	min := max * 0.3
 	ticker := flextimer.NewRangeTicker(time.Duration(min), time.Duration(max))
@@ -69,7 +70,7 @@ func metricsTimerTask(ctx *zedagentContext, handleChannel chan interface{}) {
 // Called when globalConfig changes
 // Assumes the caller has verifier that the interval has changed
 func updateMetricsTimer(tickerHandle interface{}) {
-	interval := time.Duration(globalConfig.MetricInterval) * time.Second
+	interval := globalConfig.GetMetricInterval()
 	log.Infof("updateMetricsTimer() change to %v\n", interval)
 	max := float64(interval)
 	min := max * 0.3
@@ -112,7 +113,11 @@ func handleDomainStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Debugf("handleDomainStatusModify for %s\n", key)
-	status := cast.CastDomainStatus(statusArg)
+	status, err := cast.CastDomainStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDomainStatusModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedagentContext)
 	if status.Key() != key {
 		log.Errorf("handleDomainStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
@@ -167,7 +172,11 @@ func handleDomainStatusDelete(ctxArg interface{}, key string,
 
 	ctx := ctxArg.(*zedagentContext)
 	log.Infof("handleDomainStatusDelete for %s\n", key)
-	status := cast.CastDomainStatus(statusArg)
+	status, err := cast.CastDomainStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDomainStatusDelete: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleDomainStatusDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -200,7 +209,11 @@ func lookupDomainStatus(ctx *zedagentContext, key string) *types.DomainStatus {
 		log.Infof("lookupDomainStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastDomainStatus(st)
+	status, err := cast.CastDomainStatus(st)
+	if err != nil {
+		log.Errorf("lookupDomainStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupDomainStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -495,7 +508,30 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 	if cms1 != nil {
 		cms = zedcloud.Append(cms, cms1)
 	}
+	if ctx.pubZedcloudMetrics != nil {
+		err := ctx.pubZedcloudMetrics.Publish("global", cms)
+		if err != nil {
+			log.Errorf("publish zedcloud metrics failed: %s\n", err)
+		}
+	}
+	spoolMetrics := zedcloud.GetSpoolMetrics()
+	if spoolMetrics.Items != 0 {
+		log.Infof("Spool has %d messages %d bytes\n",
+			spoolMetrics.Items, spoolMetrics.Bytes)
+	}
+	if ctx.pubSpoolMetrics != nil {
+		err := ctx.pubSpoolMetrics.Publish("global", spoolMetrics)
+		if err != nil {
+			log.Errorf("publish spool metrics failed: %s\n", err)
+		}
+	}
+	if err := zedcloud.SaveBandwidth(false); err != nil {
+		log.Errorf("SaveBandwidth failed: %s\n", err)
+	}
 	for ifname, cm := range cms {
+		log.Debugf("CloudMetrics[%s] mean latency %d ms sent %d recv %d last error <%s>\n",
+			ifname, cm.MeanLatencyMs(), cm.SentByteCount,
+			cm.RecvByteCount, cm.LastError)
 		metric := zmet.ZedcloudMetric{IfName: ifname,
 			Failures: cm.FailureCount,
 			Success:  cm.SuccessCount,
@@ -577,7 +613,11 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 	// as disks)
 	verifierStatusMap := verifierGetAll(ctx)
 	for _, st := range verifierStatusMap {
-		vs := cast.CastVerifyImageStatus(st)
+		vs, err := cast.CastVerifyImageStatus(st)
+		if err != nil {
+			log.Errorf("PublishMetricsToZedCloud: %s\n", err)
+			continue
+		}
 		log.Debugf("verifierStatusMap %s size %d\n",
 			vs.Safename, vs.Size)
 		metric := zmet.DiskMetric{
@@ -588,7 +628,11 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 	}
 	downloaderStatusMap := downloaderGetAll(ctx)
 	for _, st := range downloaderStatusMap {
-		ds := cast.CastDownloaderStatus(st)
+		ds, err := cast.CastDownloaderStatus(st)
+		if err != nil {
+			log.Errorf("PublishMetricsToZedCloud: %s\n", err)
+			continue
+		}
 		log.Debugf("downloaderStatusMap %s size %d\n",
 			ds.Safename, ds.Size)
 		if _, found := verifierStatusMap[ds.Key()]; found {
@@ -602,10 +646,18 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 		ReportDeviceMetric.Disk = append(ReportDeviceMetric.Disk, &metric)
 	}
 
+	// The image directories and the disk I/O as seen by domainmgr
+	var ioItems []types.MetricItem
+	if usage := lookupDiskUsage(ctx); usage != nil {
+		ReportDeviceMetric.Disk = append(ReportDeviceMetric.Disk,
+			diskUsageMetrics(*usage)...)
+		ioItems = diskIOMetricItems(usage.IOStats)
+	}
+
 	// Note that these are associated with the device and not with a
 	// device name like ppp0 or wwan0
 	lte := readLTEMetrics()
-	for _, i := range lte {
+	for _, i := range append(lte, ioItems...) {
 		item := new(zmet.MetricItem)
 		item.Key = i.Key
 		item.Type = zmet.MetricItemType(i.Type)
@@ -638,7 +690,11 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 	sub := ctx.getconfigCtx.subAppInstanceStatus
 	items := sub.GetAll()
 	for _, st := range items {
-		aiStatus := cast.CastAppInstanceStatus(st)
+		aiStatus, err := cast.CastAppInstanceStatus(st)
+		if err != nil {
+			log.Errorf("PublishMetricsToZedCloud: %s\n", err)
+			continue
+		}
 
 		ReportAppMetric := new(zmet.AppMetric)
 		ReportAppMetric.Cpu = new(zmet.AppCpuMetric)
@@ -718,18 +774,31 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 				networkDetails)
 		}
 
-		appDiskList := ReadAppDiskList(aiStatus.DomainName)
-		// Use the network metrics from zedrouter subscription
-		for _, diskfile := range appDiskList {
-			appDiskDetails := new(zmet.AppDiskMetric)
-			err := getDiskInfo(diskfile, appDiskDetails)
-			if err != nil {
-				log.Errorf("getDiskInfo(%s) failed %v\n",
-					diskfile, err)
-				continue
+		// Use the disk metrics from domainmgr subscription if any
+		if diskMetrics := lookupAppDiskMetric(ctx, aiStatus.Key()); diskMetrics != nil {
+			for _, dm := range diskMetrics.DiskMetrics {
+				appDiskDetails := new(zmet.AppDiskMetric)
+				appDiskDetails.Disk = dm.DiskPath
+				appDiskDetails.Provisioned = RoundToMbytes(dm.ProvisionedBytes)
+				appDiskDetails.Used = RoundToMbytes(dm.UsedBytes)
+				appDiskDetails.DiskType = dm.Format
+				appDiskDetails.Dirty = dm.Dirty
+				ReportAppMetric.Disk = append(ReportAppMetric.Disk,
+					appDiskDetails)
+			}
+		} else {
+			appDiskList := ReadAppDiskList(aiStatus.DomainName)
+			for _, diskfile := range appDiskList {
+				appDiskDetails := new(zmet.AppDiskMetric)
+				err := getDiskInfo(diskfile, appDiskDetails)
+				if err != nil {
+					log.Errorf("getDiskInfo(%s) failed %v\n",
+						diskfile, err)
+					continue
+				}
+				ReportAppMetric.Disk = append(ReportAppMetric.Disk,
+					appDiskDetails)
 			}
-			ReportAppMetric.Disk = append(ReportAppMetric.Disk,
-				appDiskDetails)
 		}
 		ReportMetrics.Am = append(ReportMetrics.Am, ReportAppMetric)
 	}
@@ -743,6 +812,74 @@ func PublishMetricsToZedCloud(ctx *zedagentContext, cpuMemoryStat [][]string,
 	SendMetricsProtobuf(ReportMetrics, iteration)
 }
 
+func lookupAppDiskMetric(ctx *zedagentContext, key string) *types.AppDiskMetric {
+	st, _ := ctx.subAppDiskMetric.Get(key)
+	if st == nil {
+		return nil
+	}
+	metric, err := cast.CastAppDiskMetric(st)
+	if err != nil {
+		log.Errorf("lookupAppDiskMetric: %s\n", err)
+		return nil
+	}
+	return &metric
+}
+
+func lookupDiskUsage(ctx *zedagentContext) *types.DiskUsage {
+	st, _ := ctx.subDiskUsage.Get("global")
+	if st == nil {
+		return nil
+	}
+	usage, err := cast.CastDiskUsage(st)
+	if err != nil {
+		log.Errorf("lookupDiskUsage: %s\n", err)
+		return nil
+	}
+	return &usage
+}
+
+// diskUsageMetrics reports each image directory like a disk whose total
+// is the virtual size of the images and used is what they take on the
+// filesystem
+func diskUsageMetrics(usage types.DiskUsage) []*zmet.DiskMetric {
+	var metrics []*zmet.DiskMetric
+	for _, du := range usage.DirUsage {
+		metrics = append(metrics, &zmet.DiskMetric{
+			Disk:  du.Dirname,
+			Total: RoundToMbytes(du.ProvisionedBytes),
+			Used:  RoundToMbytes(du.UsedBytes),
+		})
+	}
+	return metrics
+}
+
+// diskIOMetricItems reports the rates and queueing of each disk, which
+// the DiskMetric counters do not cover
+func diskIOMetricItems(stats []types.DiskIOStats) []types.MetricItem {
+	var items []types.MetricItem
+	for _, st := range stats {
+		prefix := "disk." + st.DevName + "."
+		items = append(items,
+			types.MetricItem{Key: prefix + "reads_per_sec",
+				Type: types.MetricItemGauge, Value: float32(st.ReadsPerSec)},
+			types.MetricItem{Key: prefix + "writes_per_sec",
+				Type: types.MetricItemGauge, Value: float32(st.WritesPerSec)},
+			types.MetricItem{Key: prefix + "read_bytes_per_sec",
+				Type:  types.MetricItemGauge,
+				Value: float32(st.ReadBytesPerSec)},
+			types.MetricItem{Key: prefix + "write_bytes_per_sec",
+				Type:  types.MetricItemGauge,
+				Value: float32(st.WriteBytesPerSec)},
+			types.MetricItem{Key: prefix + "util_percent",
+				Type: types.MetricItemGauge, Value: float32(st.UtilPercent)},
+			types.MetricItem{Key: prefix + "in_flight",
+				Type: types.MetricItemGauge, Value: st.InFlight},
+			types.MetricItem{Key: prefix + "queue_time_ms",
+				Type: types.MetricItemCounter, Value: st.QueueTimeMs})
+	}
+	return items
+}
+
 func getDiskInfo(diskfile string, appDiskDetails *zmet.AppDiskMetric) error {
 	imgInfo, err := diskmetrics.GetImgInfo(diskfile)
 	if err != nil {
@@ -877,6 +1014,12 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 		ReportDeviceManufacturerInfo.BiosVendor = *proto.String(strings.TrimSpace(biosVendor))
 		ReportDeviceManufacturerInfo.BiosVersion = *proto.String(strings.TrimSpace(biosVersion))
 		ReportDeviceManufacturerInfo.BiosReleaseDate = *proto.String(strings.TrimSpace(biosReleaseDate))
+	} else {
+		// No DMI; use what we got from the device tree or OEM strings
+		modelInfo := hardware.GetHardwareModelInfoNoOverride()
+		ReportDeviceManufacturerInfo.Manufacturer = *proto.String(modelInfo.Vendor)
+		ReportDeviceManufacturerInfo.ProductName = *proto.String(modelInfo.Product)
+		ReportDeviceManufacturerInfo.SerialNumber = *proto.String(modelInfo.Serial)
 	}
 	compatible := hardware.GetCompatible()
 	ReportDeviceManufacturerInfo.Compatible = *proto.String(compatible)
@@ -887,7 +1030,11 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 		// Look for a matching IMGA/IMGB in baseOsStatus
 		items := subBaseOsStatus.GetAll()
 		for _, st := range items {
-			bos := cast.CastBaseOsStatus(st)
+			bos, err := cast.CastBaseOsStatus(st)
+			if err != nil {
+				log.Errorf("PublishDeviceInfoToZedCloud: %s\n", err)
+				continue
+			}
 			if bos.PartitionLabel == partLabel {
 				return &bos
 			}
@@ -914,10 +1061,7 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 				log.Debugf("reportMetrics sending error time %v error %v for %s\n",
 					bos.ErrorTime, bos.Error,
 					bos.BaseOsVersion)
-				errInfo := new(zmet.ErrorInfo)
-				errInfo.Description = bos.Error
-				errTime, _ := ptypes.TimestampProto(bos.ErrorTime)
-				errInfo.Timestamp = errTime
+				errInfo := encodeErrorInfo(bos.ErrorAndTime)
 				swInfo.SwErr = errInfo
 			}
 		} else {
@@ -949,7 +1093,11 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 	// Report any other BaseOsStatus which might have errors
 	items := subBaseOsStatus.GetAll()
 	for _, st := range items {
-		bos := cast.CastBaseOsStatus(st)
+		bos, err := cast.CastBaseOsStatus(st)
+		if err != nil {
+			log.Errorf("PublishDeviceInfoToZedCloud: %s\n", err)
+			continue
+		}
 		if bos.PartitionLabel != "" {
 			continue
 		}
@@ -966,10 +1114,7 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 		if !bos.ErrorTime.IsZero() {
 			log.Debugf("reportMetrics sending error time %v error %v for %s\n",
 				bos.ErrorTime, bos.Error, bos.BaseOsVersion)
-			errInfo := new(zmet.ErrorInfo)
-			errInfo.Description = bos.Error
-			errTime, _ := ptypes.TimestampProto(bos.ErrorTime)
-			errInfo.Timestamp = errTime
+			errInfo := encodeErrorInfo(bos.ErrorAndTime)
 			swInfo.SwErr = errInfo
 		}
 		addUserSwInfo(ctx, swInfo)
@@ -1079,15 +1224,15 @@ func PublishDeviceInfoToZedCloud(ctx *zedagentContext) {
 	}
 
 	statusUrl := serverName + "/" + statusApi
-	zedcloud.RemoveDeferred(deviceUUID)
+	zedcloud.RemoveSpooled(deviceUUID)
 	buf := bytes.NewBuffer(data)
 	size := int64(proto.Size(ReportInfo))
 	err = SendProtobuf(statusUrl, buf, size, iteration)
 	if err != nil {
 		log.Errorf("PublishDeviceInfoToZedCloud failed: %s\n", err)
 		// Try sending later
-		zedcloud.SetDeferred(deviceUUID, buf, size, statusUrl,
-			zedcloudCtx, true)
+		zedcloud.SpoolMessage(deviceUUID, buf, statusUrl, true, true,
+			zedcloud.DeferredHigh)
 	} else {
 		writeSentDeviceInfoProtoMessage(data)
 	}
@@ -1244,10 +1389,7 @@ func getNetInfo(interfaceDetail psutilnet.InterfaceStat,
 		}
 		// Any error?
 		if !port.ErrorTime.IsZero() {
-			errInfo := new(zmet.ErrorInfo)
-			errInfo.Description = port.Error
-			errTime, _ := ptypes.TimestampProto(port.ErrorTime)
-			errInfo.Timestamp = errTime
+			errInfo := encodeErrorInfo(port.ErrorAndTime)
 			networkInfo.NetworkErr = errInfo
 		}
 		if port.Proxy != nil {
@@ -1257,6 +1399,18 @@ func getNetInfo(interfaceDetail psutilnet.InterfaceStat,
 	return networkInfo
 }
 
+// encodeErrorInfo reports the error with the retry hint if there is one
+func encodeErrorInfo(et types.ErrorAndTime) *zmet.ErrorInfo {
+	errInfo := new(zmet.ErrorInfo)
+	errInfo.Description = et.Error
+	if et.ErrorRetryCondition != "" {
+		errInfo.Description += " (retry: " + et.ErrorRetryCondition + ")"
+	}
+	errTime, _ := ptypes.TimestampProto(et.ErrorTime)
+	errInfo.Timestamp = errTime
+	return errInfo
+}
+
 func encodeProxyStatus(proxyConfig *types.ProxyConfig) *zmet.ProxyStatus {
 	status := new(zmet.ProxyStatus)
 	status.Proxies = make([]*zmet.ProxyEntry, len(proxyConfig.Proxies))
@@ -1368,10 +1522,7 @@ func PublishAppInfoToZedCloud(ctx *zedagentContext, uuid string,
 		}
 
 		if !aiStatus.ErrorTime.IsZero() {
-			errInfo := new(zmet.ErrorInfo)
-			errInfo.Description = aiStatus.Error
-			errTime, _ := ptypes.TimestampProto(aiStatus.ErrorTime)
-			errInfo.Timestamp = errTime
+			errInfo := encodeErrorInfo(aiStatus.ErrorAndTime)
 			ReportAppInfo.AppErr = append(ReportAppInfo.AppErr,
 				errInfo)
 		}
@@ -1461,15 +1612,15 @@ func PublishAppInfoToZedCloud(ctx *zedagentContext, uuid string,
 	}
 	statusUrl := serverName + "/" + statusApi
 
-	zedcloud.RemoveDeferred(uuid)
+	zedcloud.RemoveSpooled(uuid)
 	buf := bytes.NewBuffer(data)
 	size := int64(proto.Size(ReportInfo))
 	err = SendProtobuf(statusUrl, buf, size, iteration)
 	if err != nil {
 		log.Errorf("PublishAppInfoToZedCloud failed: %s\n", err)
 		// Try sending later
-		zedcloud.SetDeferred(uuid, buf, size, statusUrl, zedcloudCtx,
-			true)
+		zedcloud.SpoolMessage(uuid, buf, statusUrl, true, true,
+			zedcloud.DeferredHigh)
 	} else {
 		writeSentAppInfoProtoMessage(data)
 	}
@@ -1496,11 +1647,11 @@ func SendProtobuf(url string, buf *bytes.Buffer, size int64,
 	iteration int) error {
 
 	const return400 = true
-	resp, _, err := zedcloud.SendOnAllIntf(zedcloudCtx, url,
+	res, err := zedcloud.SendOnAllIntf(zedcloudCtx, url,
 		size, buf, iteration, return400)
-	if resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 {
+	if res.Resp != nil && res.StatusCode >= 400 && res.StatusCode < 500 {
 		log.Infof("SendProtoBuf: %s silently ignore code %d\n",
-			url, resp.StatusCode)
+			url, res.StatusCode)
 		return nil
 	}
 	return err
@@ -1520,11 +1671,19 @@ func SendMetricsProtobuf(ReportMetrics *zmet.ZMetricMsg,
 	size := int64(proto.Size(ReportMetrics))
 	metricsUrl := serverName + "/" + metricsApi
 	const return400 = false
-	_, _, err = zedcloud.SendOnAllIntf(zedcloudCtx, metricsUrl,
+	if zedcloud.SpoolPriorityDepth(zedcloud.DeferredLow) != 0 {
+		// Keep the order; sent when the spool drains
+		zedcloud.SpoolMessage("metrics", buf, metricsUrl, return400,
+			false, zedcloud.DeferredLow)
+		return
+	}
+	_, err = zedcloud.SendOnAllIntf(zedcloudCtx, metricsUrl,
 		size, buf, iteration, return400)
 	if err != nil {
-		// Hopefully next timeout will be more successful
 		log.Errorf("SendMetricsProtobuf failed: %s\n", err)
+		// Send once the controller is reachable
+		zedcloud.SpoolMessage("metrics", buf, metricsUrl, return400,
+			false, zedcloud.DeferredLow)
 		return
 	} else {
 		writeSentMetricsProtoMessage(data)
@@ -0,0 +1,62 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedagent
+
+import (
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestDiskUsageMetrics(t *testing.T) {
+	const mbyte = 1024 * 1024
+	usage := types.DiskUsage{
+		DirUsage: []types.DirDiskUsage{
+			{Dirname: "/persist/img", ImageCount: 2,
+				ProvisionedBytes: 4096 * mbyte, UsedBytes: 1024 * mbyte},
+			{Dirname: "/persist/downloads/appImg.obj/verified"},
+		},
+	}
+	metrics := diskUsageMetrics(usage)
+	if len(metrics) != 2 {
+		t.Fatalf("Got %d metrics\n", len(metrics))
+	}
+	if metrics[0].Disk != "/persist/img" || metrics[0].Total != 4096 ||
+		metrics[0].Used != 1024 {
+		t.Errorf("Got %+v\n", metrics[0])
+	}
+	if metrics[1].Total != 0 || metrics[1].Used != 0 {
+		t.Errorf("Got %+v\n", metrics[1])
+	}
+}
+
+func TestDiskIOMetricItems(t *testing.T) {
+	stats := []types.DiskIOStats{
+		{DevName: "mmcblk0", ReadsPerSec: 12.5, UtilPercent: 80,
+			InFlight: 3, QueueTimeMs: 1000},
+		{DevName: "sda"},
+	}
+	items := diskIOMetricItems(stats)
+	byKey := make(map[string]types.MetricItem)
+	for _, item := range items {
+		byKey[item.Key] = item
+	}
+	if len(byKey) != len(items) || len(items) != 14 {
+		t.Errorf("Got %d items %d keys\n", len(items), len(byKey))
+	}
+	if item := byKey["disk.mmcblk0.reads_per_sec"]; item.Value != float32(12.5) ||
+		item.Type != types.MetricItemGauge {
+		t.Errorf("Got %+v\n", item)
+	}
+	if item := byKey["disk.mmcblk0.util_percent"]; item.Value != float32(80) {
+		t.Errorf("Got %+v\n", item)
+	}
+	if item := byKey["disk.mmcblk0.queue_time_ms"]; item.Value != uint64(1000) ||
+		item.Type != types.MetricItemCounter {
+		t.Errorf("Got %+v\n", item)
+	}
+	if _, ok := byKey["disk.sda.in_flight"]; !ok {
+		t.Errorf("No item for sda\n")
+	}
+}
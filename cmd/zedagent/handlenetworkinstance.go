@@ -19,7 +19,11 @@ import (
 func handleNetworkInstanceModify(ctxArg interface{}, key string, statusArg interface{}) {
 	log.Infof("handleNetworkInstanceStatusModify(%s)\n", key)
 	ctx := ctxArg.(*zedagentContext)
-	status := cast.CastNetworkInstanceStatus(statusArg)
+	status, err := cast.CastNetworkInstanceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkInstanceModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleNetworkInstanceModify key/UUID mismatch %s vs %s; ignored %+v\n", key, status.Key(), status)
 		return
@@ -36,7 +40,11 @@ func handleNetworkInstanceDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleNetworkInstanceDelete(%s)\n", key)
-	status := cast.CastNetworkInstanceStatus(statusArg)
+	status, err := cast.CastNetworkInstanceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkInstanceDelete: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleNetworkInstanceDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -64,10 +72,7 @@ func prepareAndPublishNetworkInstanceInfoMsg(ctx *zedagentContext,
 	info.InstType = uint32(status.Type)
 
 	if !status.ErrorTime.IsZero() {
-		errInfo := new(zmet.ErrorInfo)
-		errInfo.Description = status.Error
-		errTime, _ := ptypes.TimestampProto(status.ErrorTime)
-		errInfo.Timestamp = errTime
+		errInfo := encodeErrorInfo(status.ErrorAndTime)
 		info.NetworkErr = append(info.NetworkErr, errInfo)
 	}
 
@@ -232,7 +237,11 @@ func handleNetworkInstanceMetricsModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Debugf("handleNetworkInstanceMetricsModify(%s)\n", key)
-	metrics := cast.CastNetworkInstanceMetrics(statusArg)
+	metrics, err := cast.CastNetworkInstanceMetrics(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkInstanceMetricsModify: %s\n", err)
+		return
+	}
 	if metrics.Key() != key {
 		log.Errorf("handleNetworkInstanceMetricsModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, metrics.Key(), metrics)
@@ -245,7 +254,11 @@ func handleNetworkInstanceMetricsDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleNetworkInstanceMetricsDelete(%s)\n", key)
-	metrics := cast.CastNetworkInstanceMetrics(statusArg)
+	metrics, err := cast.CastNetworkInstanceMetrics(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkInstanceMetricsDelete: %s\n", err)
+		return
+	}
 	if metrics.Key() != key {
 		log.Errorf("handleNetworkInstanceMetricsDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, metrics.Key(), metrics)
@@ -262,7 +275,11 @@ func createNetworkInstanceMetrics(ctx *zedagentContext, reportMetrics *zmet.ZMet
 		return
 	}
 	for _, met := range metlist {
-		metrics := cast.CastNetworkInstanceMetrics(met)
+		metrics, err := cast.CastNetworkInstanceMetrics(met)
+		if err != nil {
+			log.Errorf("createNetworkInstanceMetrics: %s\n", err)
+			continue
+		}
 		metricInstance := protoEncodeNetworkInstanceMetricProto(metrics)
 		reportMetrics.Nm = append(reportMetrics.Nm, metricInstance)
 	}
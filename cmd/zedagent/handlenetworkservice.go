@@ -20,7 +20,11 @@ import (
 func handleNetworkServiceModify(ctxArg interface{}, key string, statusArg interface{}) {
 	log.Infof("handleNetworkServiceStatusModify(%s)\n", key)
 	ctx := ctxArg.(*zedagentContext)
-	status := cast.CastNetworkServiceStatus(statusArg)
+	status, err := cast.CastNetworkServiceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkServiceModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleNetworkServiceModify key/UUID mismatch %s vs %s; ignored %+v\n", key, status.Key(), status)
 		return
@@ -44,7 +48,11 @@ func handleNetworkServiceDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleNetworkServiceDelete(%s)\n", key)
-	status := cast.CastNetworkServiceStatus(statusArg)
+	status, err := cast.CastNetworkServiceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkServiceDelete: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleNetworkServiceDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -180,10 +188,7 @@ func prepareVpnServiceInfoMsg(ctx *zedagentContext, status types.NetworkServiceS
 	upTime, _ := ptypes.TimestampProto(vpnStatus.UpTime)
 	svcInfo.UpTimeStamp = upTime
 	if !status.ErrorTime.IsZero() {
-		errInfo := new(zmet.ErrorInfo)
-		errInfo.Description = status.Error
-		errTime, _ := ptypes.TimestampProto(status.ErrorTime)
-		errInfo.Timestamp = errTime
+		errInfo := encodeErrorInfo(status.ErrorAndTime)
 		svcInfo.SvcErr = append(svcInfo.SvcErr, errInfo)
 	}
 
@@ -314,15 +319,15 @@ func publishInfoToZedCloud(UUID string, infoMsg *zmet.ZInfoMsg, iteration int) {
 		log.Fatal("publishNetworkServiceInfoToZedCloud proto marshaling error: ", err)
 	}
 	statusUrl := serverName + "/" + statusApi
-	zedcloud.RemoveDeferred(UUID)
+	zedcloud.RemoveSpooled(UUID)
 	buf := bytes.NewBuffer(data)
 	size := int64(proto.Size(infoMsg))
 	err = SendProtobuf(statusUrl, buf, size, iteration)
 	if err != nil {
 		log.Errorf("publishNetworkServiceInfoToZedCloud failed: %s\n", err)
 		// Try sending later
-		zedcloud.SetDeferred(UUID, buf, size, statusUrl,
-			zedcloudCtx, true)
+		zedcloud.SpoolMessage(UUID, buf, statusUrl, true, true,
+			zedcloud.DeferredHigh)
 	} else {
 		writeSentDeviceInfoProtoMessage(data)
 	}
@@ -332,7 +337,11 @@ func handleNetworkServiceMetricsModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Debugf("handleNetworkServiceMetricsModify(%s)\n", key)
-	metrics := cast.CastNetworkServiceMetrics(statusArg)
+	metrics, err := cast.CastNetworkServiceMetrics(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkServiceMetricsModify: %s\n", err)
+		return
+	}
 	if metrics.Key() != key {
 		log.Errorf("handleNetworkServiceMetricsModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, metrics.Key(), metrics)
@@ -345,7 +354,11 @@ func handleNetworkServiceMetricsDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	log.Infof("handleNetworkServiceMetricsDelete(%s)\n", key)
-	metrics := cast.CastNetworkServiceMetrics(statusArg)
+	metrics, err := cast.CastNetworkServiceMetrics(statusArg)
+	if err != nil {
+		log.Errorf("handleNetworkServiceMetricsDelete: %s\n", err)
+		return
+	}
 	if metrics.Key() != key {
 		log.Errorf("handleNetworkServiceMetricsDelete key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, metrics.Key(), metrics)
@@ -362,7 +375,11 @@ func createNetworkServiceMetrics(ctx *zedagentContext, reportMetrics *zmet.ZMetr
 		return
 	}
 	for _, met := range metlist {
-		metrics := cast.CastNetworkServiceMetrics(met)
+		metrics, err := cast.CastNetworkServiceMetrics(met)
+		if err != nil {
+			log.Errorf("createNetworkServiceMetrics: %s\n", err)
+			continue
+		}
 		metricService := protoEncodeNetworkServiceMetricProto(metrics)
 		reportMetrics.Sm = append(reportMetrics.Sm, metricService)
 	}
@@ -29,12 +29,18 @@ import (
 	"github.com/zededa/go-provision/pubsub"
 	"github.com/zededa/go-provision/types"
 	"github.com/zededa/go-provision/zboot"
+	"github.com/zededa/go-provision/zedcloud"
 )
 
 const (
 	MaxBaseOsCount       = 2
 	BaseOsImageCount     = 1
 	rebootConfigFilename = configDir + "/rebootConfig"
+	// Static ARP/ND entries per network instance UUID.
+	// XXX take them from the NetworkInstanceConfig once the API carries them
+	staticNeighborsFilename = configDir + "/StaticNeighbors.json"
+	// Config item with a secret value which we do not log
+	reonboardTokenKey = "device.reonboard.token"
 )
 
 var rebootDelay int = 30 // take a 30 second delay
@@ -99,7 +105,11 @@ func shutdownApps(getconfigCtx *getconfigContext) {
 	pub := getconfigCtx.pubAppInstanceConfig
 	items := pub.GetAll()
 	for key, c := range items {
-		config := cast.CastAppInstanceConfig(c)
+		config, err := cast.CastAppInstanceConfig(c)
+		if err != nil {
+			log.Errorf("shutdownApps: %s\n", err)
+			continue
+		}
 		if config.Key() != key {
 			log.Errorf("shutdownApps key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, config.Key(), config)
@@ -217,7 +227,11 @@ func lookupBaseOsConfigPub(getconfigCtx *getconfigContext, key string) *types.Ba
 		log.Infof("lookupBaseOsConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastBaseOsConfig(c)
+	config, err := cast.CastBaseOsConfig(c)
+	if err != nil {
+		log.Errorf("lookupBaseOsConfigPub: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupBaseOsConfig(%s) got %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -294,7 +308,11 @@ func unpublishDeletedNetworkInstanceConfig(ctx *getconfigContext,
 			continue
 		}
 
-		config := cast.CastNetworkInstanceConfig(entry)
+		config, err := cast.CastNetworkInstanceConfig(entry)
+		if err != nil {
+			log.Errorf("unpublishDeletedNetworkInstanceConfig: %s\n", err)
+			continue
+		}
 		log.Infof("unpublishing NetworkInstance %s (Name: %s) \n",
 			key, config.DisplayName)
 		if err := ctx.pubNetworkInstanceConfig.Unpublish(key); err != nil {
@@ -457,12 +475,56 @@ func publishNetworkInstanceConfig(ctx *getconfigContext,
 			parseDnsNameToIpListForNetworkInstanceConfig(apiConfigEntry,
 				&networkInstanceConfig)
 		}
+		parseStaticNeighborsForNetworkInstanceConfig(&networkInstanceConfig)
 
 		ctx.pubNetworkInstanceConfig.Publish(networkInstanceConfig.UUID.String(),
 			&networkInstanceConfig)
 	}
 }
 
+// The file is a map from the network instance UUID to a list of
+// {"IP": "10.1.0.20", "Mac": "00:16:3e:00:01:02"}
+type staticNeighborEntry struct {
+	IP  string
+	Mac string
+}
+
+func parseStaticNeighborsForNetworkInstanceConfig(
+	config *types.NetworkInstanceConfig) {
+
+	b, err := ioutil.ReadFile(staticNeighborsFilename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("parseStaticNeighbors: %s\n", err)
+		}
+		return
+	}
+	var entries map[string][]staticNeighborEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		log.Errorf("parseStaticNeighbors: %s: %s\n",
+			staticNeighborsFilename, err)
+		return
+	}
+	neighbors := []types.StaticNeighbor{}
+	for _, entry := range entries[config.UUID.String()] {
+		ip := net.ParseIP(entry.IP)
+		mac, err := net.ParseMAC(entry.Mac)
+		if ip == nil || err != nil {
+			log.Errorf("Bad static neighbor %s %s ignored\n",
+				entry.IP, entry.Mac)
+			continue
+		}
+		neighbors = append(neighbors,
+			types.StaticNeighbor{IP: ip, Mac: mac})
+	}
+	config.StaticNeighbors = neighbors
+	if err := config.ValidateStaticNeighbors(); err != nil {
+		log.Errorf("NetworkInstance %s static neighbors ignored: %s\n",
+			config.DisplayName, err)
+		config.StaticNeighbors = nil
+	}
+}
+
 func populateLispConfig(apiConfigEntry *zconfig.NetworkInstanceConfig,
 	networkInstanceConfig *types.NetworkInstanceConfig) {
 	lispConfig := apiConfigEntry.Cfg.LispConfig
@@ -621,6 +683,9 @@ func parseAppInstanceConfig(config *zconfig.EdgeDevConfig,
 
 		appInstance.CloudInitUserData = userData
 		appInstance.RemoteConsole = cfgApp.GetRemoteConsole()
+		// XXX set RemoteConsoleChannels once the API carries them
+		// XXX set the RemoteConsole limits once the API carries them;
+		// until then the GlobalConfig limits apply
 		// get the certs for image sha verification
 		certInstance := getCertObjects(appInstance.UUIDandVersion,
 			appInstance.ConfigSha256, appInstance.StorageConfigList)
@@ -731,7 +796,11 @@ func parseSystemAdapterConfig(config *zconfig.EdgeDevConfig,
 					sysAdapter.NetworkUUID, err)
 				continue
 			}
-			network := cast.CastNetworkObjectConfig(networkObject)
+			network, err := cast.CastNetworkObjectConfig(networkObject)
+			if err != nil {
+				log.Errorf("parseSystemAdapterConfig: %s\n", err)
+				continue
+			}
 			addrSubnet := network.Subnet
 			addrSubnet.IP = ip
 			port.AddrSubnet = addrSubnet.String()
@@ -749,26 +818,24 @@ func parseSystemAdapterConfig(config *zconfig.EdgeDevConfig,
 					port.Dhcp = types.DT_NONE
 					break
 				}
-				if port.Gateway.IsUnspecified() || port.AddrSubnet == "" ||
-					port.DnsServers == nil {
-					log.Errorf("parseSystemAdapterConfig: DT_STATIC but missing parameters in %+v; ignored\n",
+				// Validate allows a static port without DNS
+				// servers in an override file, but we need
+				// them to reach the controller by name
+				if port.DnsServers == nil {
+					log.Errorf("parseSystemAdapterConfig: DT_STATIC but missing DnsServers in %+v; ignored\n",
 						port)
 					continue
 				}
-			case types.DT_CLIENT:
-				// Do nothing
-			case types.DT_NONE:
-				// Do nothing
-			default:
-				log.Warnf("parseSystemAdapterConfig: ignore unsupported dhcp type %v\n",
-					network.Dhcp)
-				continue
 			}
 			// XXX use DnsNameToIpList?
 			if network.Proxy != nil {
 				port.ProxyConfig = *network.Proxy
 			}
 		}
+		if err := port.Validate(); err != nil {
+			log.Errorf("parseSystemAdapterConfig: %s; ignored\n", err)
+			continue
+		}
 		newPorts = append(newPorts, port)
 	}
 	if len(newPorts) == 0 {
@@ -785,13 +852,22 @@ func parseSystemAdapterConfig(config *zconfig.EdgeDevConfig,
 		log.Infof("parseSystemAdapterConfig: Done with no change")
 		return
 	}
+	// The generated Diff redacts the proxy passwords
+	oldPortConfig := types.DevicePortConfig{
+		Version: getconfigCtx.devicePortConfig.Version,
+		Ports:   getconfigCtx.devicePortConfig.Ports,
+	}
 	log.Infof("parseSystemAdapterConfig: version %d/%d diff %v",
 		getconfigCtx.devicePortConfig.Version, portConfig.Version,
-		cmp.Diff(getconfigCtx.devicePortConfig.Ports, portConfig.Ports))
+		oldPortConfig.Diff(*portConfig))
 
 	// This is suboptimal after a reboot since the config will be the same
 	// yet the timestamp be new. HandleDPCModify takes care of that.
 	portConfig.TimePriority = time.Now()
+	if err := portConfig.Validate(); err != nil {
+		log.Errorf("parseSystemAdapterConfig: %s; ignored\n", err)
+		return
+	}
 	getconfigCtx.devicePortConfig = *portConfig
 
 	getconfigCtx.pubDevicePortConfig.Publish("zedagent", *portConfig)
@@ -1200,7 +1276,11 @@ func publishNetworkServiceConfig(ctx *getconfigContext,
 		if svcEnt != nil {
 			continue
 		}
-		config := cast.CastNetworkServiceConfig(c)
+		config, err := cast.CastNetworkServiceConfig(c)
+		if err != nil {
+			log.Errorf("publishNetworkServiceConfig: %s\n", err)
+			continue
+		}
 		if config.Key() != k {
 			log.Errorf("publishNetworkServiceConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 				k, config.Key(), config)
@@ -1437,6 +1517,7 @@ func parseUnderlayNetworkConfigEntry(
 		}
 		ulCfg.ACLs[aclIdx] = *aclCfg
 	}
+	// XXX set Limits once the API NetworkAdapter carries them
 	return ulCfg
 }
 
@@ -1573,6 +1654,7 @@ func parseOverlayNetworkConfigEntry(
 	olCfg.EIDConfigDetails.LispSignature = intfEnt.Lispsignature
 	olCfg.EIDConfigDetails.PemCert = intfEnt.Pemcert
 	olCfg.EIDConfigDetails.PemPrivateKey = intfEnt.Pemprivatekey
+	// XXX set Limits once the API NetworkAdapter carries them
 
 	return olCfg
 }
@@ -1617,15 +1699,23 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			configHash)
 		return
 	}
-	log.Infof("parseConfigItems: Applying updated config sha % x vs. % x: %v\n",
-		itemsPrevConfigHash, configHash, items)
+	// The items are logged one by one below with any secrets redacted
+	log.Infof("parseConfigItems: Applying updated config sha % x vs. % x: %d items\n",
+		itemsPrevConfigHash, configHash, len(items))
 
 	// Start with the defaults so that we revert to default when no data
 	newGlobalConfig := types.GlobalConfigDefaults
+	// Not part of GlobalConfig since that is logged, saved, and
+	// published to all agents
+	reonboardToken := ""
 
 	for _, item := range items {
+		value := item.Value
+		if item.Key == reonboardTokenKey {
+			value = "<redacted>"
+		}
 		log.Infof("parseConfigItems key %s value %s\n",
-			item.Key, item.Value)
+			item.Key, value)
 
 		key := item.Key
 		switch key {
@@ -1674,6 +1764,15 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			}
 			newGlobalConfig.MintimeUpdateSuccess = uint32(i64)
 
+		case "timer.test.baseimage.checks":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.UpdateCheckWindow = uint32(i64)
+
 		case "timer.port.georedo":
 			i64, err := strconv.ParseInt(item.Value, 10, 32)
 			if err != nil {
@@ -1728,6 +1827,42 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			}
 			newGlobalConfig.NetworkFallbackAnyEth = newTs
 
+		case "network.icmp.echo.mgmt":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.IcmpEchoMgmt = newTs
+
+		case "network.icmp.echo.app":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.IcmpEchoApp = newTs
+
+		case "network.icmpv6.ra.mgmt":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.Icmpv6RaMgmt = newTs
+
+		case "network.icmpv6.ra.app":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.Icmpv6RaApp = newTs
+
 		case "debug.enable.usb":
 			newBool, err := strconv.ParseBool(item.Value)
 			if err != nil {
@@ -1755,6 +1890,42 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			}
 			newGlobalConfig.AllowAppVnc = newBool
 
+		case "debug.ssh.allowed.prefixes":
+			prefixes, err := types.ParsePrefixList(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad prefix list %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.SshAllowedPrefixes = prefixes
+
+		case "debug.ssh.ratelimit":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.SshRateLimit = uint32(i64)
+
+		case "network.reject.log.rate":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.RejectLogRate = uint32(i64)
+
+		case "app.vnc.allowed.prefixes":
+			prefixes, err := types.ParsePrefixList(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad prefix list %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.VncAllowedPrefixes = prefixes
+
 		case "timer.use.config.checkpoint":
 			i64, err := strconv.ParseInt(item.Value, 10, 32)
 			if err != nil {
@@ -1800,6 +1971,171 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			}
 			newGlobalConfig.DomainBootRetryTime = uint32(i64)
 
+		case "timer.send.timeout":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.NetworkSendTimeout = uint32(i64)
+
+		case "timer.send.connect":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.NetworkConnectTimeout = uint32(i64)
+
+		case "timer.send.tlshandshake":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.NetworkTLSHandshakeTimeout = uint32(i64)
+
+		case "timer.send.responseheader":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.NetworkResponseHeaderTimeout = uint32(i64)
+
+		case "timer.remoteconsole.maxduration":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.RemoteConsoleMaxDuration = uint32(i64)
+
+		case "timer.remoteconsole.idle":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.RemoteConsoleIdleTimeout = uint32(i64)
+
+		case "network.remoteconsole.rxrate":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.RemoteConsoleRxRate = uint32(i64)
+
+		case "network.remoteconsole.txrate":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.RemoteConsoleTxRate = uint32(i64)
+
+		case reonboardTokenKey:
+			reonboardToken = item.Value
+
+		case "network.conntrack.warn.percent":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil || i64 > 100 {
+				log.Errorf("parseConfigItems: bad percent value %s for %s: %v\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.ConntrackWarnPercent = uint32(i64)
+
+		case "network.conntrack.max":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.ConntrackMax = uint32(i64)
+
+		case "timer.conntrack.evict":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.ConntrackEvictTimeout = uint32(i64)
+
+		case "storage.warn.percent":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.StorageWarnPercent = uint32(i64)
+
+		case "storage.critical.percent":
+			i64, err := strconv.ParseInt(item.Value, 10, 32)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad int value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.StorageCriticalPercent = uint32(i64)
+
+		case "storage.cleanup":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.StorageCleanup = newTs
+
+		case "network.ocsp.policy":
+			newPolicy, err := types.ParseOCSPPolicy(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad OCSP policy %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.OCSPPolicy = newPolicy
+
+		case "network.uplink.change.notify":
+			newNotify, err := types.ParseUplinkChangeNotify(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad uplink change notify %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.UplinkChangeNotify = newNotify
+
+		case "network.local.dns.ntp.proxy":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.LocalDnsNtpProxy = newTs
+
+		case "debug.objlog":
+			newTs, err := types.ParseTriState(item.Value)
+			if err != nil {
+				log.Errorf("parseConfigItems: bad tristate value %s for %s: %s\n",
+					item.Value, key, err)
+				continue
+			}
+			newGlobalConfig.ObjectEventLog = newTs
+
 		case "debug.default.loglevel":
 			newGlobalConfig.DefaultLogLevel = item.Value
 
@@ -1846,6 +2182,12 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 			}
 		}
 	}
+	if err := types.WriteReonboardToken(reonboardToken); err != nil {
+		log.Errorf("parseConfigItems: %s\n", err)
+	}
+	if err := types.ValidateGlobalConfig(newGlobalConfig); err != nil {
+		log.Errorf("parseConfigItems: %s\n", err)
+	}
 	newGlobalConfig = types.ApplyGlobalConfig(newGlobalConfig)
 	if !cmp.Equal(globalConfig, newGlobalConfig) {
 		log.Infof("parseConfigItems: change %v",
@@ -1853,6 +2195,7 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 
 		oldGlobalConfig := globalConfig
 		globalConfig = types.EnforceGlobalConfigMinimums(newGlobalConfig)
+		globalConfig = types.EnforceGlobalConfigMaximums(globalConfig)
 		if globalConfig.ConfigInterval != oldGlobalConfig.ConfigInterval {
 			log.Infof("parseConfigItems: %s change from %d to %d\n",
 				"ConfigInterval",
@@ -1867,6 +2210,19 @@ func parseConfigItems(config *zconfig.EdgeDevConfig, ctx *getconfigContext) {
 				globalConfig.MetricInterval)
 			updateMetricsTimer(ctx.metricsTickerHandle)
 		}
+		if globalConfig.OCSPPolicy != oldGlobalConfig.OCSPPolicy {
+			log.Infof("parseConfigItems: %s change from %s to %s\n",
+				"OCSPPolicy",
+				oldGlobalConfig.OCSPPolicy,
+				globalConfig.OCSPPolicy)
+			zedcloudCtx.OCSPPolicy = globalConfig.OCSPPolicy
+		}
+		newTimeouts := zedcloud.TimeoutsFromGlobalConfig(globalConfig)
+		if newTimeouts != zedcloudCtx.Timeouts {
+			log.Infof("parseConfigItems: %s change from %+v to %+v\n",
+				"Timeouts", zedcloudCtx.Timeouts, newTimeouts)
+			zedcloudCtx.Timeouts = newTimeouts
+		}
 		err := pubsub.PublishToDir("/persist/config/", "global",
 			&globalConfig)
 		if err != nil {
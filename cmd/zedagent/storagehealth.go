@@ -0,0 +1,67 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Periodically check the SMART health of the disks so that failing or
+// worn out flash can be flagged before the device stops working.
+
+package zedagent
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/diskmetrics"
+	"github.com/zededa/go-provision/flextimer"
+)
+
+// Warn when this much of the rated endurance is used
+const storageWearWarnPercent = 90
+
+func storageHealthTask(ctx *zedagentContext) {
+	log.Infoln("starting storage health task")
+	publishStorageHealth(ctx)
+
+	interval := time.Duration(time.Hour)
+	max := float64(interval)
+	min := max * 0.3
+	ticker := flextimer.NewRangeTicker(time.Duration(min), time.Duration(max))
+	for range ticker.C {
+		publishStorageHealth(ctx)
+	}
+}
+
+func publishStorageHealth(ctx *zedagentContext) {
+	pub := ctx.pubStorageHealthStatus
+	disks := make(map[string]bool)
+	for _, devName := range diskmetrics.ListDisks() {
+		disks[devName] = true
+		status := diskmetrics.GetStorageHealth(devName)
+		if status.Error != "" {
+			log.Debugf("publishStorageHealth(%s): %s\n", devName,
+				status.Error)
+		}
+		status.Warning = status.Supported && (!status.Passed ||
+			status.WearPercent >= storageWearWarnPercent ||
+			status.PendingSectors != 0 || status.MediaErrors != 0)
+		wasWarning := false
+		if st, _ := pub.Get(status.Key()); st != nil {
+			prev, err := cast.CastStorageHealthStatus(st)
+			if err == nil {
+				wasWarning = prev.Warning
+			}
+		}
+		if status.Warning && !wasWarning {
+			log.Warnf("Disk %s %s health: passed %v wear %d%% pending sectors %d media errors %d\n",
+				devName, status.Model, status.Passed,
+				status.WearPercent, status.PendingSectors,
+				status.MediaErrors)
+		}
+		pub.Publish(status.Key(), status)
+	}
+	for key := range pub.GetAll() {
+		if !disks[key] {
+			pub.Unpublish(key)
+		}
+	}
+}
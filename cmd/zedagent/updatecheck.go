@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Health checks which must pass after a baseimage update before the
+// partition is committed. If they do not pass within UpdateCheckWindow we
+// reboot while the partition is inprogress which makes zboot fall back to
+// the other partition.
+
+package zedagent
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/zboot"
+)
+
+// The agents which must be running; same as watchdog(8) checks
+var updateCheckAgents = []string{"ledmanager", "nim", "zedmanager",
+	"zedrouter", "domainmgr", "downloader", "verifier", "identitymgr",
+	"baseosmgr", "logmanager"}
+
+// Same as the change limit in the watchdog(8) config
+const agentMaxStillRunningAge = 300 * time.Second
+
+// The filesystems which must be mounted
+var updateCheckMounts = []string{"/config", "/persist"}
+
+// Created when the checks first run; nil until then
+var updateChecker *zboot.HealthChecker
+
+func newUpdateChecker(getconfigCtx *getconfigContext) *zboot.HealthChecker {
+	window := globalConfig.GetUpdateCheckWindow()
+	hc := zboot.NewHealthChecker(window)
+	hc.Register("controller", func() error {
+		return checkController(getconfigCtx)
+	})
+	hc.Register("agents", checkAgentsRunning)
+	hc.Register("mounts", checkMounts)
+	return hc
+}
+
+// checkUpdateHealth runs the checks and marks the test complete if they
+// pass. Returns true if we are rebooting since they failed.
+func checkUpdateHealth(getconfigCtx *getconfigContext) bool {
+	if updateChecker == nil {
+		updateChecker = newUpdateChecker(getconfigCtx)
+	}
+	result, failures := updateChecker.Run(time.Now())
+	switch result {
+	case zboot.HealthCheckPassed:
+		initiateBaseOsZedCloudTestComplete(getconfigCtx)
+	case zboot.HealthCheckPending:
+		log.Infof("checkUpdateHealth: waiting for %v\n", failures)
+	case zboot.HealthCheckFailed:
+		errStr := zboot.FailureReason(failures)
+		log.Errorf("%s; rebooting to fall back\n", errStr)
+		agentlog.RebootReason(errStr)
+		shutdownAppsGlobal(getconfigCtx.zedagentCtx)
+		execReboot(true)
+		return true
+	}
+	return false
+}
+
+// checkController requires a config from the controller since the boot
+func checkController(getconfigCtx *getconfigContext) error {
+	if !getconfigCtx.lastReceivedConfigFromCloud.After(getconfigCtx.startTime) {
+		return errors.New("no config received from controller")
+	}
+	return nil
+}
+
+func checkAgentsRunning() error {
+	var stale []string
+	for _, agent := range updateCheckAgents {
+		age, err := agentlog.StillRunningAge(agent)
+		if err != nil {
+			stale = append(stale, agent+" not started")
+		} else if age > agentMaxStillRunningAge {
+			stale = append(stale,
+				fmt.Sprintf("%s stale for %v", agent, age))
+		}
+	}
+	if len(stale) != 0 {
+		return errors.New(strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+func checkMounts() error {
+	b, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return err
+	}
+	mounted := make(map[string]bool)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			mounted[fields[1]] = true
+		}
+	}
+	var missing []string
+	for _, m := range updateCheckMounts {
+		if !mounted[m] {
+			missing = append(missing, m)
+		}
+	}
+	if len(missing) != 0 {
+		errStr := fmt.Sprintf("not mounted %s", strings.Join(missing, ", "))
+		return errors.New(errStr)
+	}
+	return nil
+}
@@ -34,6 +34,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/agentlog"
 	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/hardware"
 	"github.com/zededa/go-provision/pidfile"
 	"github.com/zededa/go-provision/pubsub"
 	"github.com/zededa/go-provision/types"
@@ -98,6 +99,8 @@ type zedagentContext struct {
 	subAppImgVerifierStatus   *pubsub.Subscription
 	subNetworkServiceMetrics  *pubsub.Subscription
 	subNetworkInstanceMetrics *pubsub.Subscription
+	subAppDiskMetric          *pubsub.Subscription
+	subDiskUsage              *pubsub.Subscription
 	subGlobalConfig           *pubsub.Subscription
 	GCInitialized             bool // Received initial GlobalConfig
 	subZbootStatus            *pubsub.Subscription
@@ -108,6 +111,10 @@ type zedagentContext struct {
 	subDevicePortConfigList   *pubsub.Subscription
 	devicePortConfigList      types.DevicePortConfigList
 	remainingTestTime         time.Duration
+	pubZedcloudMetrics        *pubsub.Publication // Merged from all agents
+	pubSpoolMetrics           *pubsub.Publication
+	pubStorageHealthStatus    *pubsub.Publication
+	pubDiskSpaceAlarm         *pubsub.Publication
 }
 
 var debug = false
@@ -231,6 +238,8 @@ func Run() {
 
 	// Timer for deferred sends of info messages
 	deferredChan := zedcloud.InitDeferred()
+	// Messages queued during an outage before we restarted
+	zedcloud.InitSpool(agentName, &zedcloudCtx)
 
 	// Make sure we have a GlobalConfig file with defaults
 	types.EnsureGCFile()
@@ -293,6 +302,14 @@ func Run() {
 	// XXX defer this until we have some config from cloud or saved copy
 	pubAppInstanceConfig.SignalRestarted()
 
+	// For wstunnelclient. XXX publish once the API carries them
+	pubRemoteAccessRequest, err := pubsub.Publish(agentName,
+		types.RemoteAccessRequest{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	getconfigCtx.pubRemoteAccessRequest = pubRemoteAccessRequest
+
 	pubCertObjConfig, err := pubsub.Publish(agentName,
 		types.CertObjConfig{})
 	if err != nil {
@@ -368,6 +385,23 @@ func Run() {
 	zedagentCtx.subNetworkInstanceMetrics = subNetworkInstanceMetrics
 	subNetworkInstanceMetrics.Activate()
 
+	// Disk sizes collected by domainmgr
+	subAppDiskMetric, err := pubsub.Subscribe("domainmgr",
+		types.AppDiskMetric{}, false, &zedagentCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.subAppDiskMetric = subAppDiskMetric
+	subAppDiskMetric.Activate()
+
+	subDiskUsage, err := pubsub.Subscribe("domainmgr",
+		types.DiskUsage{}, false, &zedagentCtx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.subDiskUsage = subDiskUsage
+	subDiskUsage.Activate()
+
 	// Look for AppInstanceStatus from zedmanager
 	subAppInstanceStatus, err := pubsub.Subscribe("zedmanager",
 		types.AppInstanceStatus{}, false, &zedagentCtx)
@@ -392,7 +426,7 @@ func Run() {
 
 	// Look for zboot status
 	subZbootStatus, err := pubsub.Subscribe("baseosmgr",
-		types.ZbootStatus{}, false, &zedagentCtx)
+		types.BaseOsPartitionStatus{}, false, &zedagentCtx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -473,7 +507,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	DNSctx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -483,7 +517,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDevicePortConfigList.ModifyHandler = handleDPCLModify
+	subDevicePortConfigList.ModifyDiffHandler = handleDPCLModify
 	subDevicePortConfigList.DeleteHandler = handleDPCLDelete
 	zedagentCtx.subDevicePortConfigList = subDevicePortConfigList
 	subDevicePortConfigList.Activate()
@@ -498,12 +532,12 @@ func Run() {
 		}
 	}
 
-	time1 := time.Duration(globalConfig.ResetIfCloudGoneTime)
-	t1 := time.NewTimer(time1 * time.Second)
-	log.Infof("Started timer for reset for %d seconds\n", time1)
-	time2 := time.Duration(globalConfig.FallbackIfCloudGoneTime)
-	log.Infof("Started timer for fallback,  reset for %d seconds\n", time2)
-	t2 := time.NewTimer(time2 * time.Second)
+	time1 := globalConfig.GetResetIfCloudGoneTime()
+	t1 := time.NewTimer(time1)
+	log.Infof("Started timer for reset for %v\n", time1)
+	time2 := globalConfig.GetFallbackIfCloudGoneTime()
+	log.Infof("Started timer for fallback,  reset for %v\n", time2)
+	t2 := time.NewTimer(time2)
 
 	// wait till, zboot status is ready
 	for !zedagentCtx.zbootRestarted {
@@ -605,6 +639,43 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Publish the merged cloud metrics for diag et al
+	pubZedcloudMetrics, err := pubsub.Publish(agentName, cms)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.pubZedcloudMetrics = pubZedcloudMetrics
+
+	pubSpoolMetrics, err := pubsub.Publish(agentName,
+		zedcloud.SpoolMetrics{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.pubSpoolMetrics = pubSpoolMetrics
+
+	pubStorageHealthStatus, err := pubsub.Publish(agentName,
+		types.StorageHealthStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.pubStorageHealthStatus = pubStorageHealthStatus
+
+	pubDiskSpaceAlarm, err := pubsub.Publish(agentName,
+		types.DiskSpaceAlarm{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedagentCtx.pubDiskSpaceAlarm = pubDiskSpaceAlarm
+
+	// The hardware does not change hence we publish it once
+	pubHardwareInventory, err := pubsub.Publish(agentName,
+		types.HardwareInventory{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	inventory := hardware.GetHardwareInventory()
+	log.Infof("Hardware inventory: %+v\n", inventory)
+	pubHardwareInventory.Publish(inventory.Key(), inventory)
 
 	// Publish initial device info.
 	publishDevInfo(&zedagentCtx)
@@ -615,6 +686,9 @@ func Run() {
 	metricsTickerHandle := <-handleChannel
 	getconfigCtx.metricsTickerHandle = metricsTickerHandle
 
+	// start the storage health task
+	go storageHealthTask(&zedagentCtx)
+
 	// Process the verifierStatus to avoid downloading an image we
 	// already have in place
 	log.Infof("Handling initial verifier Status\n")
@@ -777,6 +851,12 @@ func Run() {
 		case change := <-subNetworkInstanceMetrics.C:
 			subNetworkInstanceMetrics.ProcessChange(change)
 
+		case change := <-subAppDiskMetric.C:
+			subAppDiskMetric.ProcessChange(change)
+
+		case change := <-subDiskUsage.C:
+			subDiskUsage.ProcessChange(change)
+
 		case change := <-subDevicePortConfigList.C:
 			subDevicePortConfigList.ProcessChange(change)
 
@@ -809,7 +889,11 @@ func handleVerifierRestarted(ctxArg interface{}, done bool) {
 func handleVerifierStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastVerifyImageStatus(statusArg)
+	status, err := cast.CastVerifyImageStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleVerifierStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleVerifierStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -823,7 +907,11 @@ func handleVerifierStatusModify(ctxArg interface{}, key string,
 func handleVerifierStatusDelete(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastVerifyImageStatus(statusArg)
+	status, err := cast.CastVerifyImageStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleVerifierStatusDelete: %s\n", err)
+		return
+	}
 	log.Infof("handleVeriferStatusDelete RefCount %d Expired %v for %s\n",
 		status.RefCount, status.Expired, key)
 	// Nothing to do
@@ -840,6 +928,7 @@ func handleZbootRestarted(ctxArg interface{}, done bool) {
 func handleInit() {
 	initializeDirs()
 	handleConfigInit()
+	zedcloud.InitBandwidth(agentName)
 }
 
 func initializeDirs() {
@@ -876,7 +965,11 @@ func initializeDirs() {
 
 func handleAppInstanceStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
-	status := cast.CastAppInstanceStatus(statusArg)
+	status, err := cast.CastAppInstanceStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleAppInstanceStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleAppInstanceStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -907,7 +1000,11 @@ func lookupAppInstanceStatus(ctx *zedagentContext, key string) *types.AppInstanc
 		log.Infof("lookupAppInstanceStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastAppInstanceStatus(st)
+	status, err := cast.CastAppInstanceStatus(st)
+	if err != nil {
+		log.Errorf("lookupAppInstanceStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupAppInstanceStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -916,9 +1013,14 @@ func lookupAppInstanceStatus(ctx *zedagentContext, key string) *types.AppInstanc
 	return &status
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DNSContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -929,12 +1031,15 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(*deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(*deviceNetworkStatus, status))
 	*deviceNetworkStatus = status
 	// Did we (re-)gain the first usable address?
 	// XXX should we also trigger if the count increases?
@@ -967,22 +1072,30 @@ func handleDNSDelete(ctxArg interface{}, key string,
 	log.Infof("handleDNSDelete done for %s\n", key)
 }
 
-func handleDPCLModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDPCLModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDevicePortConfigList(statusArg)
+	status, err := cast.CastDevicePortConfigList(statusArg)
+	if err != nil {
+		log.Errorf("handleDPCLModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedagentContext)
 	if key != "global" {
 		log.Infof("handleDPCLModify: ignoring %s\n", key)
 		return
 	}
-	if cmp.Equal(ctx.devicePortConfigList, status) {
-		log.Infof("handleDPCLModify no change\n")
-		return
-	}
 	// Note that lastSucceeded will increment a lot; ignore it but compare
 	// lastFailed/lastError?? XXX how?
-	log.Infof("handleDPCLModify: changed %v",
-		cmp.Diff(ctx.devicePortConfigList, status))
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDevicePortConfigList(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDPCLModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDPCLModify: changed %v",
+			oldStatus.Diff(status))
+	}
 	ctx.devicePortConfigList = status
 	ctx.TriggerDeviceInfo = true
 }
@@ -1004,7 +1117,11 @@ func handleDPCLDelete(ctxArg interface{}, key string, statusArg interface{}) {
 
 func handleBaseOsStatusModify(ctxArg interface{}, key string, statusArg interface{}) {
 	ctx := ctxArg.(*zedagentContext)
-	status := cast.CastBaseOsStatus(statusArg)
+	status, err := cast.CastBaseOsStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleBaseOsStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleBaseOsStatusModify key/UUID mismatch %s vs %s; ignored %+v\n", key, status.Key(), status)
 		return
@@ -1050,9 +1167,12 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 		log.Infof("handleGlobalConfigModify setting initials to %+v\n",
 			updated)
 		sane := types.EnforceGlobalConfigMinimums(updated)
-		log.Infof("handleGlobalConfigModify: enforced minimums %v\n",
+		sane = types.EnforceGlobalConfigMaximums(sane)
+		log.Infof("handleGlobalConfigModify: enforced bounds %v\n",
 			cmp.Diff(updated, sane))
 		globalConfig = sane
+		zedcloudCtx.OCSPPolicy = globalConfig.OCSPPolicy
+		zedcloudCtx.Timeouts = zedcloud.TimeoutsFromGlobalConfig(globalConfig)
 		ctx.GCInitialized = true
 	}
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
@@ -1077,7 +1197,11 @@ func handleAAModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	ctx := ctxArg.(*zedagentContext)
-	status := cast.CastAssignableAdapters(statusArg)
+	status, err := cast.CastAssignableAdapters(statusArg)
+	if err != nil {
+		log.Errorf("handleAAModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Infof("handleAAModify: ignoring %s\n", key)
 		return
@@ -1104,10 +1228,17 @@ func handleAADelete(ctxArg interface{}, key string,
 
 func handleZbootStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
-	if isBaseOsValidPartitionLabel(key) {
-		log.Infof("handleZbootStatusModify: for %s\n", key)
+	if !isBaseOsValidPartitionLabel(key) {
+		return
 	}
-	// Nothing to do
+	status, err := cast.CastBaseOsPartitionStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleZbootStatusModify: %s\n", err)
+		return
+	}
+	log.Infof("handleZbootStatusModify: for %s %s version %s built %v sha256 %s\n",
+		key, status.PartitionState, status.ShortVersion,
+		status.BuildDate, status.Checksum)
 }
 
 func handleZbootStatusDelete(ctxArg interface{}, key string,
@@ -12,7 +12,11 @@ import (
 func handleCertObjStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastCertObjStatus(statusArg)
+	status, err := cast.CastCertObjStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleCertObjStatusModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedmanagerContext)
 	uuidStr := status.Key()
 
@@ -44,7 +48,11 @@ func lookupCertObjStatus(ctx *zedmanagerContext, key string) *types.CertObjStatu
 		log.Infof("lookupCertObjStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastCertObjStatus(st)
+	status, err := cast.CastCertObjStatus(st)
+	if err != nil {
+		log.Errorf("lookupCertObjStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupCertObjStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -92,6 +92,8 @@ func MaybeAddDomainConfig(ctx *zedmanagerContext,
 			disk.Format = sc.Format
 			disk.Maxsizebytes = sc.Maxsizebytes
 			disk.Devtype = sc.Devtype
+			// XXX Virtio and Queues are left unset until the
+			// zededa/api Drive and NetworkAdapter carry them
 			i++
 		case "kernel":
 			if dc.Kernel != "" {
@@ -131,6 +133,10 @@ func MaybeAddDomainConfig(ctx *zedmanagerContext,
 			dc.VifList[i+ulNum] = ol.VifInfo
 		}
 	}
+	if err := dc.Validate(); err != nil {
+		log.Errorf("MaybeAddDomainConfig(%s): %s\n", key, err)
+		return err
+	}
 	publishDomainConfig(ctx, &dc)
 
 	log.Infof("MaybeAddDomainConfig done for %s\n", key)
@@ -145,7 +151,11 @@ func lookupDomainConfig(ctx *zedmanagerContext, key string) *types.DomainConfig
 		log.Infof("lookupDomainConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastDomainConfig(c)
+	config, err := cast.CastDomainConfig(c)
+	if err != nil {
+		log.Errorf("lookupDomainConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupDomainConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -162,7 +172,11 @@ func lookupDomainStatus(ctx *zedmanagerContext, key string) *types.DomainStatus
 		log.Infof("lookupDomainStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastDomainStatus(st)
+	status, err := cast.CastDomainStatus(st)
+	if err != nil {
+		log.Errorf("lookupDomainStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupDomainStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -196,7 +210,11 @@ func unpublishDomainConfig(ctx *zedmanagerContext, uuidStr string) {
 func handleDomainStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastDomainStatus(statusArg)
+	status, err := cast.CastDomainStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDomainStatusModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedmanagerContext)
 	if status.Key() != key {
 		log.Errorf("handleDomainStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
@@ -81,7 +81,11 @@ func unpublishDownloaderConfig(ctx *zedmanagerContext,
 
 func handleDownloaderStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
-	status := cast.CastDownloaderStatus(statusArg)
+	status, err := cast.CastDownloaderStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDownloaderStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleDownloaderStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -136,7 +140,11 @@ func lookupDownloaderConfig(ctx *zedmanagerContext,
 		log.Infof("lookupDownloaderConfig(%s) not found\n", safename)
 		return nil
 	}
-	config := cast.CastDownloaderConfig(c)
+	config, err := cast.CastDownloaderConfig(c)
+	if err != nil {
+		log.Errorf("lookupDownloaderConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != safename {
 		log.Errorf("lookupDownloaderConfig(%s) got %s; ignored %+v\n",
 			safename, config.Key(), config)
@@ -155,7 +163,11 @@ func lookupDownloaderStatus(ctx *zedmanagerContext,
 		log.Infof("lookupDownloaderStatus(%s) not found\n", safename)
 		return nil
 	}
-	status := cast.CastDownloaderStatus(c)
+	status, err := cast.CastDownloaderStatus(c)
+	if err != nil {
+		log.Errorf("lookupDownloaderStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != safename {
 		log.Errorf("lookupDownloaderStatus(%s) got %s; ignored %+v\n",
 			safename, status.Key(), status)
@@ -41,7 +41,11 @@ func lookupEIDConfig(ctx *zedmanagerContext, key string) *types.EIDConfig {
 		log.Infof("lookupEIDConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastEIDConfig(c)
+	config, err := cast.CastEIDConfig(c)
+	if err != nil {
+		log.Errorf("lookupEIDConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupEIDConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -58,7 +62,11 @@ func lookupEIDStatus(ctx *zedmanagerContext, key string) *types.EIDStatus {
 		log.Infof("lookupEIDStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastEIDStatus(st)
+	status, err := cast.CastEIDStatus(st)
+	if err != nil {
+		log.Errorf("lookupEIDStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupEIDStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -92,7 +100,11 @@ func unpublishEIDConfig(ctx *zedmanagerContext, uuidAndVers types.UUIDandVersion
 
 func handleEIDStatusModify(ctxArg interface{}, keyArg string,
 	statusArg interface{}) {
-	status := cast.CastEIDStatus(statusArg)
+	status, err := cast.CastEIDStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleEIDStatusModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedmanagerContext)
 	key := status.Key()
 	log.Infof("handleEIDStatusModify for %s\n", key)
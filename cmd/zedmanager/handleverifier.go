@@ -20,7 +20,11 @@ func lookupVerifyImageConfig(ctx *zedmanagerContext,
 			safename)
 		return nil
 	}
-	config := cast.CastVerifyImageConfig(c)
+	config, err := cast.CastVerifyImageConfig(c)
+	if err != nil {
+		log.Errorf("lookupVerifyImageConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != safename {
 		log.Errorf("lookupVerifyImageConfig(%s) got %s; ignored %+v\n",
 			safename, config.Key(), config)
@@ -35,7 +39,11 @@ func lookupVerifyImageConfigSha256(ctx *zedmanagerContext,
 	pub := ctx.pubAppImgVerifierConfig
 	items := pub.GetAll()
 	for _, c := range items {
-		config := cast.CastVerifyImageConfig(c)
+		config, err := cast.CastVerifyImageConfig(c)
+		if err != nil {
+			log.Errorf("lookupVerifyImageConfigSha256: %s\n", err)
+			continue
+		}
 		if config.ImageSha256 == sha256 {
 			return &config
 		}
@@ -123,7 +131,11 @@ func unpublishVerifyImageConfig(ctx *zedmanagerContext,
 func handleVerifyImageStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
-	status := cast.CastVerifyImageStatus(statusArg)
+	status, err := cast.CastVerifyImageStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleVerifyImageStatusModify: %s\n", err)
+		return
+	}
 	if status.Key() != key {
 		log.Errorf("handleVerifyImageStatusModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -181,7 +193,11 @@ func lookupVerifyImageStatus(ctx *zedmanagerContext,
 		log.Infof("lookupVerifyImageStatus(%s) not found\n", safename)
 		return nil
 	}
-	status := cast.CastVerifyImageStatus(c)
+	status, err := cast.CastVerifyImageStatus(c)
+	if err != nil {
+		log.Errorf("lookupVerifyImageStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != safename {
 		log.Errorf("lookupVerifyImageStatus(%s) got %s; ignored %+v\n",
 			safename, status.Key(), status)
@@ -196,7 +212,11 @@ func lookupVerifyImageStatusSha256(ctx *zedmanagerContext,
 	sub := ctx.subAppImgVerifierStatus
 	items := sub.GetAll()
 	for _, st := range items {
-		status := cast.CastVerifyImageStatus(st)
+		status, err := cast.CastVerifyImageStatus(st)
+		if err != nil {
+			log.Errorf("lookupVerifyImageStatusSha256: %s\n", err)
+			continue
+		}
 		if status.ImageSha256 == sha256 {
 			return &status
 		}
@@ -46,6 +46,12 @@ func MaybeAddAppNetworkConfig(ctx *zedmanagerContext,
 				changed = true
 				break
 			}
+			if new.Limits != old.Limits {
+				log.Infof("Over Limits changed from %v to %v\n",
+					old.Limits, new.Limits)
+				changed = true
+				break
+			}
 		}
 		for i, new := range aiConfig.UnderlayNetworkList {
 			old := m.UnderlayNetworkList[i]
@@ -55,6 +61,12 @@ func MaybeAddAppNetworkConfig(ctx *zedmanagerContext,
 				changed = true
 				break
 			}
+			if new.Limits != old.Limits {
+				log.Infof("Under Limits changed from %v to %v\n",
+					old.Limits, new.Limits)
+				changed = true
+				break
+			}
 		}
 	} else {
 		log.Debugf("appNetwork config add for %s\n", key)
@@ -75,6 +87,7 @@ func MaybeAddAppNetworkConfig(ctx *zedmanagerContext,
 			ol.EID = ols.EID
 			ol.LispSignature = ols.LispSignature
 			ol.ACLs = olc.ACLs
+			ol.Limits = olc.Limits
 			ol.AppMacAddr = olc.AppMacAddr
 			ol.AppIPAddr = olc.AppIPAddr
 			ol.Network = olc.Network
@@ -100,7 +113,11 @@ func lookupAppNetworkConfig(ctx *zedmanagerContext, key string) *types.AppNetwor
 		log.Infof("lookupAppNetworkConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastAppNetworkConfig(c)
+	config, err := cast.CastAppNetworkConfig(c)
+	if err != nil {
+		log.Errorf("lookupAppNetworkConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupAppNetworkConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -117,7 +134,11 @@ func lookupAppNetworkStatus(ctx *zedmanagerContext, key string) *types.AppNetwor
 		log.Infof("lookupAppNetworkStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastAppNetworkStatus(st)
+	status, err := cast.CastAppNetworkStatus(st)
+	if err != nil {
+		log.Errorf("lookupAppNetworkStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupAppNetworkStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -150,7 +171,11 @@ func unpublishAppNetworkConfig(ctx *zedmanagerContext, uuidStr string) {
 
 func handleAppNetworkStatusModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
-	status := cast.CastAppNetworkStatus(statusArg)
+	status, err := cast.CastAppNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleAppNetworkStatusModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedmanagerContext)
 	log.Infof("handleAppNetworkStatusModify: key:%s, name:%s\n",
 		key, status.DisplayName)
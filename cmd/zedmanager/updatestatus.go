@@ -22,7 +22,11 @@ func updateAIStatusSafename(ctx *zedmanagerContext, safename string) {
 	pub := ctx.pubAppInstanceStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastAppInstanceStatus(st)
+		status, err := cast.CastAppInstanceStatus(st)
+		if err != nil {
+			log.Errorf("updateAIStatusSafename: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("updateAIStatusSafename key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -128,7 +132,11 @@ func removeAIStatusSafename(ctx *zedmanagerContext, safename string) {
 	pub := ctx.pubAppInstanceStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastAppInstanceStatus(st)
+		status, err := cast.CastAppInstanceStatus(st)
+		if err != nil {
+			log.Errorf("removeAIStatusSafename: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("removeAIStatusSafename key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -245,8 +253,7 @@ func doInstall(ctx *zedmanagerContext, uuidStr string,
 			len(status.StorageStatusList))
 		if status.PurgeInprogress == types.NONE {
 			log.Errorln(errString)
-			status.Error = errString
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errString)
 			changed = true
 			return changed, false
 		}
@@ -295,8 +302,7 @@ func doInstall(ctx *zedmanagerContext, uuidStr string,
 		if status.PurgeInprogress == types.NONE {
 			// Report to zedcloud
 			log.Errorln(errString)
-			status.Error = errString
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(errString)
 			changed = true
 			return changed, false
 		}
@@ -428,16 +434,16 @@ func doInstall(ctx *zedmanagerContext, uuidStr string,
 		// XXX check if ErrorAllowed; if so proceed with ss.Error set
 		// but no allErrors
 		// XXX what about errorSource which goes into status? Don't set it.
-		if ds.LastErr != "" {
+		if ds.Error != "" {
 			log.Errorf("Received error from downloader for %s: %s\n",
-				safename, ds.LastErr)
-			ss.Error = ds.LastErr
+				safename, ds.Error)
+			ss.Error = ds.Error
 			ss.ErrorSource = pubsub.TypeToName(types.DownloaderStatus{})
 			errorSource = ss.ErrorSource
 			allErrors = appendError(allErrors, "downloader",
-				ds.LastErr)
-			ss.ErrorTime = ds.LastErrTime
-			errorTime = ds.LastErrTime
+				ds.Error)
+			ss.ErrorTime = ds.ErrorTime
+			errorTime = ds.ErrorTime
 			changed = true
 			continue
 		} else if ss.ErrorSource == pubsub.TypeToName(types.DownloaderStatus{}) {
@@ -531,16 +537,16 @@ func doInstall(ctx *zedmanagerContext, uuidStr string,
 		// XXX check if ErrorAllowed; if so proceed with ss.Error set
 		// but no allErrors
 		// XXX what about errorSource which goes into status? Don't set it.
-		if vs.LastErr != "" {
+		if vs.Error != "" {
 			log.Errorf("Received error from verifier for %s: %s\n",
-				safename, vs.LastErr)
-			ss.Error = vs.LastErr
+				safename, vs.Error)
+			ss.Error = vs.Error
 			ss.ErrorSource = pubsub.TypeToName(types.VerifyImageStatus{})
 			errorSource = ss.ErrorSource
 			allErrors = appendError(allErrors, "verifier",
-				vs.LastErr)
-			ss.ErrorTime = vs.LastErrTime
-			errorTime = vs.LastErrTime
+				vs.Error)
+			ss.ErrorTime = vs.ErrorTime
+			errorTime = vs.ErrorTime
 			changed = true
 			continue
 		} else if ss.ErrorSource == pubsub.TypeToName(types.VerifyImageStatus{}) {
@@ -599,8 +605,7 @@ func doPrepare(ctx *zedmanagerContext, uuidStr string,
 			len(config.OverlayNetworkList),
 			len(status.EIDList))
 		log.Errorln(errString)
-		status.Error = errString
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errString)
 		changed = true
 		return changed, false
 	}
@@ -671,7 +676,11 @@ func lookupDatastoreConfig(ctx *zedmanagerContext,
 		log.Errorln(errStr)
 		return nil, errors.New(errStr)
 	}
-	dst := cast.CastDatastoreConfig(cfg)
+	dst, err := cast.CastDatastoreConfig(cfg)
+	if err != nil {
+		log.Errorf("lookupDatastoreConfig: %s\n", err)
+		return nil, err
+	}
 	return &dst, nil
 }
 
@@ -695,7 +704,7 @@ func doActivate(ctx *zedmanagerContext, uuidStr string,
 			status.BootTime = ds.BootTime
 			changed = true
 		}
-		if ds != nil && !ds.Activated && ds.LastErr == "" {
+		if ds != nil && !ds.Activated && ds.Error == "" {
 			log.Infof("RestartInprogress(%s) came down - set bring up\n",
 				status.Key())
 			status.RestartInprogress = types.BRING_UP
@@ -794,12 +803,12 @@ func doActivate(ctx *zedmanagerContext, uuidStr string,
 	}
 	// Look for xen errors. Ignore if we are going down
 	if status.RestartInprogress != types.BRING_DOWN {
-		if ds.LastErr != "" {
+		if ds.Error != "" {
 			log.Errorf("Received error from domainmgr for %s: %s\n",
-				uuidStr, ds.LastErr)
-			status.Error = ds.LastErr
+				uuidStr, ds.Error)
+			status.Error = ds.Error
 			status.ErrorSource = pubsub.TypeToName(types.DomainStatus{})
-			status.ErrorTime = ds.LastErrTime
+			status.ErrorTime = ds.ErrorTime
 			changed = true
 		} else if status.ErrorSource == pubsub.TypeToName(types.DomainStatus{}) {
 			log.Infof("Clearing domainmgr error %s\n", status.Error)
@@ -809,9 +818,9 @@ func doActivate(ctx *zedmanagerContext, uuidStr string,
 			changed = true
 		}
 	} else {
-		if ds.LastErr != "" {
+		if ds.Error != "" {
 			log.Warnf("bringDown sees error from domainmgr for %s: %s\n",
-				uuidStr, ds.LastErr)
+				uuidStr, ds.Error)
 		}
 		if status.ErrorSource == pubsub.TypeToName(types.DomainStatus{}) {
 			log.Infof("Clearing domainmgr error %s\n", status.Error)
@@ -1019,12 +1028,12 @@ func doInactivate(ctx *zedmanagerContext, uuidStr string,
 		log.Infof("Waiting for DomainStatus removal for %s\n", uuidStr)
 		// Look for xen errors.
 		if !ds.Activated {
-			if ds.LastErr != "" {
+			if ds.Error != "" {
 				log.Errorf("Received error from domainmgr for %s: %s\n",
-					uuidStr, ds.LastErr)
-				status.Error = ds.LastErr
+					uuidStr, ds.Error)
+				status.Error = ds.Error
 				status.ErrorSource = pubsub.TypeToName(types.DomainStatus{})
-				status.ErrorTime = ds.LastErrTime
+				status.ErrorTime = ds.ErrorTime
 				changed = true
 			} else if status.ErrorSource == pubsub.TypeToName(types.DomainStatus{}) {
 				log.Infof("Clearing domainmgr error %s\n",
@@ -1204,8 +1213,7 @@ func doInactivateHalt(ctx *zedmanagerContext, uuidStr string,
 	if err != nil {
 		log.Errorf("Error from MaybeAddDomainConfig for %s: %s\n",
 			uuidStr, err)
-		status.Error = fmt.Sprintf("%s", err)
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(fmt.Sprintf("%s", err))
 		changed = true
 		log.Infof("Waiting for DomainStatus Activated for %s\n",
 			uuidStr)
@@ -1238,9 +1246,9 @@ func doInactivateHalt(ctx *zedmanagerContext, uuidStr string,
 		}
 	}
 	// Ignore errors during a halt
-	if ds.LastErr != "" {
+	if ds.Error != "" {
 		log.Warnf("doInactivateHalt sees error from domainmgr for %s: %s\n",
-			uuidStr, ds.LastErr)
+			uuidStr, ds.Error)
 	}
 	if status.ErrorSource == pubsub.TypeToName(types.DomainStatus{}) {
 		log.Infof("Clearing domainmgr error %s\n", status.Error)
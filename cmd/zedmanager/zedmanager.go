@@ -253,7 +253,7 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	ctx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -403,7 +403,11 @@ func handleAppInstanceConfigModify(ctxArg interface{}, key string, configArg int
 
 	log.Infof("handleAppInstanceConfigModify(%s)\n", key)
 	ctx := ctxArg.(*zedmanagerContext)
-	config := cast.CastAppInstanceConfig(configArg)
+	config, err := cast.CastAppInstanceConfig(configArg)
+	if err != nil {
+		log.Errorf("handleAppInstanceConfigModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleAppInstanceConfigModify key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -441,7 +445,11 @@ func lookupAppInstanceStatus(ctx *zedmanagerContext, key string) *types.AppInsta
 		log.Infof("lookupAppInstanceStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastAppInstanceStatus(st)
+	status, err := cast.CastAppInstanceStatus(st)
+	if err != nil {
+		log.Errorf("lookupAppInstanceStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupAppInstanceStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -458,7 +466,11 @@ func lookupAppInstanceConfig(ctx *zedmanagerContext, key string) *types.AppInsta
 		log.Infof("lookupAppInstanceConfig(%s) not found\n", key)
 		return nil
 	}
-	config := cast.CastAppInstanceConfig(c)
+	config, err := cast.CastAppInstanceConfig(c)
+	if err != nil {
+		log.Errorf("lookupAppInstanceConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupAppInstanceConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -768,9 +780,14 @@ func quantifyChanges(config types.AppInstanceConfig,
 	return needPurge, needRestart
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Debugf("handleDNSModify: ignoring %s\n", key)
 		return
@@ -780,12 +797,15 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(deviceNetworkStatus, status))
 	deviceNetworkStatus = status
 	log.Infof("handleDNSModify done for %s\n", key)
 }
@@ -805,7 +825,11 @@ func handleDatastoreConfigModify(ctxArg interface{}, key string,
 	configArg interface{}) {
 
 	ctx := ctxArg.(*zedmanagerContext)
-	config := cast.CastDatastoreConfig(configArg)
+	config, err := cast.CastDatastoreConfig(configArg)
+	if err != nil {
+		log.Errorf("handleDatastoreConfigModify: %s\n", err)
+		return
+	}
 	checkAndRecreateAppInstance(ctx, config.UUID)
 	log.Infof("handleDatastoreConfigModify for %s\n", key)
 }
@@ -825,7 +849,11 @@ func checkAndRecreateAppInstance(ctx *zedmanagerContext, datastore uuid.UUID) {
 	pub := ctx.pubAppInstanceStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastAppInstanceStatus(st)
+		status, err := cast.CastAppInstanceStatus(st)
+		if err != nil {
+			log.Errorf("checkAndRecreateAppInstance: %s\n", err)
+			continue
+		}
 		if !status.MissingDatastore {
 			continue
 		}
@@ -858,8 +886,7 @@ func checkAndRecreateAppInstance(ctx *zedmanagerContext, datastore uuid.UUID) {
 			log.Infof("checkAndRecreateAppInstance(%s) remove error %s for %s\n",
 				datastore.String(), status.Error,
 				status.DisplayName)
-			status.Error = ""
-			status.ErrorTime = time.Time{}
+			status.ClearError()
 		}
 		handleCreate2(ctx, *config, status)
 	}
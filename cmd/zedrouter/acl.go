@@ -9,10 +9,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"reflect"
 	"strconv"
+	"strings"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/conntrack"
 	"github.com/zededa/go-provision/iptables"
 	"github.com/zededa/go-provision/types"
 )
@@ -90,7 +94,11 @@ func compileNetworkIpsetsStatus(ctx *zedrouterContext,
 	pub := ctx.pubAppNetworkStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastAppNetworkStatus(st)
+		status, err := cast.CastAppNetworkStatus(st)
+		if err != nil {
+			log.Errorf("compileNetworkIpsetsStatus: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("compileNetworkIpsetsStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -131,7 +139,11 @@ func compileNetworkIpsetsConfig(ctx *zedrouterContext,
 	sub := ctx.subAppNetworkConfig
 	items := sub.GetAll()
 	for key, c := range items {
-		config := cast.CastAppNetworkConfig(c)
+		config, err := cast.CastAppNetworkConfig(c)
+		if err != nil {
+			log.Errorf("compileNetworkIpsetsConfig: %s\n", err)
+			continue
+		}
 		if config.Key() != key {
 			log.Errorf("compileNetworkIpsetsConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, config.Key(), config)
@@ -203,14 +215,15 @@ func compileOldAppInstanceIpsets(ctx *zedrouterContext,
 // For a shared bridge call aclToRules for each ifname, then aclDropRules,
 // then concat all the rules and pass to applyACLrules
 // Note that only bridgeName is set with ifMgmt
-func createACLConfiglet(bridgeName string, vifName string, isMgmt bool,
-	ACLs []types.ACE, bridgeIP string, appIP string) error {
+func createACLConfiglet(ctx *zedrouterContext, bridgeName string,
+	vifName string, isMgmt bool, ACLs []types.ACE, bridgeIP string,
+	appIP string) error {
 
 	log.Infof("createACLConfiglet: ifname %s, vifName %s, ACLs %v, IP %s/%s\n",
 		bridgeName, vifName, ACLs, bridgeIP, appIP)
 	ipVer := determineIpVer(isMgmt, bridgeIP)
 	rules, err := aclToRules(bridgeName, vifName, ACLs, ipVer,
-		bridgeIP, appIP)
+		bridgeIP, appIP, hasNtpRelay(ctx, bridgeName))
 	if err != nil {
 		return err
 	}
@@ -242,45 +255,49 @@ func determineIpVer(isMgmt bool, bridgeIP string) int {
 	}
 }
 
+// aclOwner names the iptables rules of the interface
+func aclOwner(bridgeName string, vifName string) string {
+	return "acl-" + bridgeName + "-" + vifName
+}
+
+// applyACLRules sets the complete list of rules for the interface; any
+// previous rules not in the list are removed
 func applyACLRules(rules IptablesRuleList, bridgeName string, vifName string,
 	isMgmt bool, ipVer int, appIP string) error {
 
 	log.Debugf("applyACLRules: bridgeName %s ipVer %d appIP %s with %d rules\n",
 		bridgeName, ipVer, appIP, len(rules))
-	var err error
+	var iptRules []iptables.Rule
 	for _, rule := range rules {
-		log.Debugf("createACLConfiglet: rule %v\n", rule)
-		args := rulePrefix("-A", isMgmt, ipVer, vifName, appIP, rule)
-		if args == nil {
-			log.Debugf("createACLConfiglet: skipping rule %v\n",
+		log.Debugf("applyACLRules: rule %v\n", rule)
+		iptRule := aclRule(isMgmt, ipVer, vifName, appIP, rule)
+		if iptRule == nil {
+			log.Debugf("applyACLRules: skipping rule %v\n",
 				rule)
 			continue
 		}
-		args = append(args, rule...)
-		if ipVer == 4 {
-			err = iptables.IptableCmd(args...)
-		} else if ipVer == 6 {
-			err = iptables.Ip6tableCmd(args...)
-		} else {
-			err = errors.New(fmt.Sprintf("ACL: Unknown IP version %d", ipVer))
-		}
-		if err != nil {
-			return err
-		}
+		iptRules = append(iptRules, *iptRule)
+	}
+	set := iptables.RuleSet{Owner: aclOwner(bridgeName, vifName)}
+	switch ipVer {
+	case 4:
+		set.IPv4 = iptRules
+	case 6:
+		set.IPv6 = iptRules
+	default:
+		return errors.New(fmt.Sprintf("ACL: Unknown IP version %d", ipVer))
 	}
 	if !isMgmt {
 		// Add mangle rules for IPv6 packets from the domU (overlay or
 		// underlay) since netfront/netback thinks there is checksum
 		// offload
-		// XXX add error checks?
-		iptables.Ip6tableCmd("-t", "mangle", "-A", "PREROUTING", "-i", bridgeName,
-			"-p", "tcp", "-j", "CHECKSUM", "--checksum-fill")
-		iptables.Ip6tableCmd("-t", "mangle", "-A", "PREROUTING", "-i", bridgeName,
-			"-p", "udp", "-j", "CHECKSUM", "--checksum-fill")
-		iptables.IptableCmd("-t", "mangle", "-A", "PREROUTING", "-i", bridgeName,
-			"-p", "tcp", "-j", "CHECKSUM", "--checksum-fill")
-		iptables.IptableCmd("-t", "mangle", "-A", "PREROUTING", "-i", bridgeName,
-			"-p", "udp", "-j", "CHECKSUM", "--checksum-fill")
+		for _, proto := range []string{"tcp", "udp"} {
+			rule := iptables.Rule{Table: "mangle", Chain: "PREROUTING",
+				Args: []string{"-i", bridgeName, "-p", proto,
+					"-j", "CHECKSUM", "--checksum-fill"}}
+			set.IPv4 = append(set.IPv4, rule)
+			set.IPv6 = append(set.IPv6, rule)
+		}
 	}
 	// XXX isMgmt is painful; related to commenting out eidset accepts
 	// XXX won't need this when zedmanager is in a separate domU
@@ -288,16 +305,17 @@ func applyACLRules(rules IptablesRuleList, bridgeName string, vifName string,
 	if false && ipVer == 6 && !isMgmt {
 		// Manually add rules so that lispers.net doesn't see and drop
 		// the packet on dbo1x0
-		// XXX add error checks?
-		iptables.Ip6tableCmd("-A", "FORWARD", "-i", bridgeName, "-o", "dbo1x0",
-			"-j", "DROP")
+		set.IPv6 = append(set.IPv6, iptables.Rule{Chain: iptables.EveForwardChain,
+			Args: []string{"-i", bridgeName, "-o", "dbo1x0",
+				"-j", "DROP"}})
 	}
-	return nil
+	return iptables.SetRules(set)
 }
 
 // Returns a list of iptables commands, witout the initial "-A FORWARD"
+// With ntpRelay the bridgeIP is also the NTP server; see serviceproxy.go
 func aclToRules(bridgeName string, vifName string, ACLs []types.ACE, ipVer int,
-	bridgeIP string, appIP string) (IptablesRuleList, error) {
+	bridgeIP string, appIP string, ntpRelay bool) (IptablesRuleList, error) {
 
 	rulesList := IptablesRuleList{}
 	log.Debugf("aclToRules(%s, %s, %v, %d, %s, %s\n",
@@ -364,6 +382,13 @@ func aclToRules(bridgeName string, vifName string, ACLs []types.ACE, ipVer int,
 		rule4 = []string{"-i", bridgeName, "-s", bridgeIP,
 			"-p", "tcp", "--sport", "domain", "-j", "ACCEPT"}
 		rulesList = append(rulesList, rule1, rule2, rule3, rule4)
+		if ntpRelay {
+			rule1 = []string{"-i", bridgeName, "-d", bridgeIP,
+				"-p", "udp", "--dport", "ntp", "-j", "ACCEPT"}
+			rule2 = []string{"-i", bridgeName, "-s", bridgeIP,
+				"-p", "udp", "--sport", "ntp", "-j", "ACCEPT"}
+			rulesList = append(rulesList, rule1, rule2)
+		}
 	}
 	for _, ace := range ACLs {
 		rules, err := aceToRules(bridgeName, vifName, ace, ipVer,
@@ -620,14 +645,13 @@ func aceToRules(bridgeName string, vifName string, ace types.ACE, ipVer int, bri
 	return rulesList, nil
 }
 
-// Determine which rules to skip and what prefix/table to use
+// Determine which rules to skip and what table and chain to use
 // We append a '+' to the vifname to handle PV/qemu which for some
 // reason have a second <vifname>-emu bridge interface.
-func rulePrefix(operation string, isMgmt bool, ipVer int, vifName string,
-	appIP string, rule IptablesRule) IptablesRule {
+func aclRule(isMgmt bool, ipVer int, vifName string, appIP string,
+	rule IptablesRule) *iptables.Rule {
 
 	vifName += "+"
-	prefix := []string{}
 	if isMgmt {
 		// Enforcing sending on OUTPUT. Enforcing receiving
 		// using FORWARD since packet FORWARDED from lispers.net
@@ -638,55 +662,39 @@ func rulePrefix(operation string, isMgmt bool, ipVer int, vifName string,
 			// set for all the EIDs)
 			// This special handling will go away when ZedManager
 			// is in a domU
-			// prefix = []string{operation, "FORWARD"}
 			return nil
 		} else if rule[0] == "-i" {
-			prefix = []string{operation, "OUTPUT"}
-			rule[0] = "-o"
-		} else {
-			return nil
-		}
-	} else if ipVer == 6 {
-		// The input rules (from domU are applied to raw to intercept
-		// before lisp/pcap can pick them up.
-		// The output rules (to domU) are applied in forwarding path
-		// since packets are forwarded from lispers.net interface after
-		// decap.
-		// Note that the counter parsing code assumes this.
-		if rule[0] == "-i" {
-			prefix = []string{"-t", "raw", operation, "PREROUTING",
-				"-m", "physdev", "--physdev-in", vifName}
-		} else if rule[0] == "-o" {
-			if appIP != "" {
-				prefix = []string{operation, "FORWARD",
-					"-d", appIP}
-			} else {
-				prefix = []string{operation, "FORWARD"}
-			}
-		} else {
-			return nil
-		}
-	} else {
-		// Underlay; we have NAT rules and otherwise the same as
-		// for IPv6
-		if rule[0] == "PREROUTING" || rule[0] == "POSTROUTING" {
-			// NAT verbatim rule
-			prefix = []string{"-t", "nat", operation}
-		} else if rule[0] == "-i" {
-			prefix = []string{"-t", "raw", operation, "PREROUTING",
-				"-m", "physdev", "--physdev-in", vifName}
-		} else if rule[0] == "-o" {
-			if appIP != "" {
-				prefix = []string{operation, "FORWARD",
-					"-d", appIP}
-			} else {
-				prefix = []string{operation, "FORWARD"}
-			}
+			args := append([]string{"-o"}, rule[1:]...)
+			return &iptables.Rule{Chain: "OUTPUT", Args: args}
 		} else {
 			return nil
 		}
 	}
-	return prefix
+	// For IPv6 the input rules (from domU are applied to raw to
+	// intercept before lisp/pcap can pick them up.
+	// The output rules (to domU) are applied in forwarding path
+	// since packets are forwarded from lispers.net interface after
+	// decap.
+	// Underlay IPv4 also has NAT rules and is otherwise the same.
+	// Note that the counter parsing code assumes this.
+	if ipVer == 4 && (rule[0] == "PREROUTING" || rule[0] == "POSTROUTING") {
+		// NAT verbatim rule
+		return &iptables.Rule{Table: "nat", Chain: rule[0],
+			Args: rule[1:]}
+	} else if rule[0] == "-i" {
+		args := append([]string{"-m", "physdev", "--physdev-in", vifName},
+			rule...)
+		return &iptables.Rule{Table: "raw", Chain: "PREROUTING",
+			Args: args}
+	} else if rule[0] == "-o" {
+		args := []string(rule)
+		if appIP != "" {
+			args = append([]string{"-d", appIP}, rule...)
+		}
+		return &iptables.Rule{Chain: iptables.EveForwardChain,
+			Args: args}
+	}
+	return nil
 }
 
 func equalRule(r1 IptablesRule, r2 IptablesRule) bool {
@@ -741,87 +749,31 @@ func diffIpsets(newIpsets, oldIpsets []string) ([]string, []string, bool) {
 	return newIpsets, staleIpsets, restartDnsmasq
 }
 
-func updateACLConfiglet(bridgeName string, vifName string, isMgmt bool,
-	oldACLs []types.ACE, newACLs []types.ACE, bridgeIP string,
-	appIP string) error {
+func updateACLConfiglet(ctx *zedrouterContext, bridgeName string,
+	vifName string, isMgmt bool, oldACLs []types.ACE, newACLs []types.ACE,
+	bridgeIP string, appIP string) error {
 
 	log.Infof("updateACLConfiglet: bridgeName %s, vifName %s, appIP %s, oldACLs %v newACLs %v\n",
 		bridgeName, vifName, appIP, oldACLs, newACLs)
 
 	ipVer := determineIpVer(isMgmt, bridgeIP)
-	oldRules, err := aclToRules(bridgeName, vifName, oldACLs, ipVer,
-		bridgeIP, appIP)
+	ntpRelay := hasNtpRelay(ctx, bridgeName)
+	newRules, err := aclToRules(bridgeName, vifName, newACLs, ipVer,
+		bridgeIP, appIP, ntpRelay)
 	if err != nil {
 		return err
 	}
-	newRules, err := aclToRules(bridgeName, vifName, newACLs, ipVer,
-		bridgeIP, appIP)
+	dropRules, err := aclDropRules(bridgeName, vifName)
 	if err != nil {
 		return err
 	}
-	return applyACLUpdate(isMgmt, ipVer, vifName, appIP, oldRules, newRules)
-}
-
-func applyACLUpdate(isMgmt bool, ipVer int, vifName string, appIP string,
-	oldRules IptablesRuleList, newRules IptablesRuleList) error {
-
-	log.Debugf("applyACLUpdate: isMgmt %v ipVer %d vifName %s appIP %s oldRules %v newRules %v\n",
-		isMgmt, ipVer, vifName, appIP, oldRules, newRules)
-
-	var err error
-	// Look for old which should be deleted
-	for _, rule := range oldRules {
-		if containsRule(newRules, rule) {
-			continue
-		}
-		log.Debugf("applyACLUpdate: delete rule %v\n", rule)
-		args := rulePrefix("-D", isMgmt, ipVer, vifName, appIP, rule)
-		if args == nil {
-			log.Debugf("applyACLUpdate: skipping delete rule %v\n",
-				rule)
-			continue
-		}
-		args = append(args, rule...)
-		if ipVer == 4 {
-			err = iptables.IptableCmd(args...)
-		} else if ipVer == 6 {
-			err = iptables.Ip6tableCmd(args...)
-		} else {
-			err = errors.New(fmt.Sprintf("ACL: Unknown IP version %d", ipVer))
-		}
-		if err != nil {
-			return err
-		}
-	}
-	// Look for new which should be inserted
-	// We insert at the top in reverse order so that the relative order of the new rules
-	// is preserved. Note that they are all added before any existing rules.
-	numRules := len(newRules)
-	for numRules > 0 {
-		numRules--
-		rule := newRules[numRules]
-		if containsRule(oldRules, rule) {
-			continue
-		}
-		log.Debugf("applyACLUpdate: add rule %v\n", rule)
-		args := rulePrefix("-I", isMgmt, ipVer, vifName, appIP, rule)
-		if args == nil {
-			log.Debugf("applyACLUpdate: skipping insert rule %v\n",
-				rule)
-			continue
-		}
-		args = append(args, rule...)
-		if ipVer == 4 {
-			err = iptables.IptableCmd(args...)
-		} else if ipVer == 6 {
-			err = iptables.Ip6tableCmd(args...)
-		} else {
-			err = errors.New(fmt.Sprintf("ACL: Unknown IP version %d", ipVer))
-		}
-		if err != nil {
-			return err
-		}
+	rules := append(newRules, dropRules...)
+	err = applyACLRules(rules, bridgeName, vifName, isMgmt, ipVer, appIP)
+	if err != nil {
+		return err
 	}
+	// Flows allowed by a removed rule would otherwise stay alive
+	deleteRemovedACEFlows(bridgeName, appIP, oldACLs, newACLs)
 	return nil
 }
 
@@ -831,51 +783,149 @@ func deleteACLConfiglet(bridgeName string, vifName string, isMgmt bool,
 	log.Infof("deleteACLConfiglet: ifname %s vifName %s ACLs %v\n",
 		bridgeName, vifName, ACLs)
 
-	ipVer := determineIpVer(isMgmt, bridgeIP)
-	rules, err := aclToRules(bridgeName, vifName, ACLs, ipVer,
-		bridgeIP, appIP)
+	err := iptables.DeleteRules(aclOwner(bridgeName, vifName))
 	if err != nil {
 		return err
 	}
-	dropRules, err := aclDropRules(bridgeName, vifName)
+	deleteAppFlows(bridgeName, appIP)
+	return nil
+}
+
+// deleteAppFlows removes the conntrack entries for the app so that
+// stale NAT state does not keep blocked flows alive
+func deleteAppFlows(bridgeName string, appIP string) {
+	if appIP == "" {
+		return
+	}
+	subnet, err := conntrack.ParseIPNet(appIP)
 	if err != nil {
-		return err
+		log.Errorf("deleteAppFlows: %s\n", err)
+		return
 	}
-	rules = append(rules, dropRules...)
-	for _, rule := range rules {
-		log.Debugf("deleteACLConfiglet: rule %v\n", rule)
-		args := rulePrefix("-D", isMgmt, ipVer, vifName, appIP, rule)
-		if args == nil {
-			log.Debugf("deleteACLConfiglet: skipping rule %v\n",
-				rule)
-			continue
+	filter := conntrack.Filter{
+		Subnets: []*net.IPNet{subnet},
+		Zone:    bridgeZone(bridgeName),
+	}
+	count, err := conntrack.Delete(syscall.AF_UNSPEC, filter)
+	if err != nil {
+		log.Errorf("deleteAppFlows(%s) failed: %s\n", appIP, err)
+		return
+	}
+	log.Infof("deleteAppFlows(%s) deleted %d flows\n", appIP, count)
+}
+
+// deleteRemovedACEFlows removes the conntrack entries of the app which
+// match an ACE which is not in newACLs
+func deleteRemovedACEFlows(bridgeName string, appIP string,
+	oldACLs []types.ACE, newACLs []types.ACE) {
+
+	if appIP == "" {
+		return
+	}
+	app := net.ParseIP(appIP)
+	if app == nil {
+		log.Errorf("deleteRemovedACEFlows: bad appIP %s\n", appIP)
+		return
+	}
+	var removed []types.ACE
+	for _, ace := range oldACLs {
+		if !containsACE(newACLs, ace) {
+			removed = append(removed, ace)
 		}
-		args = append(args, rule...)
-		if ipVer == 4 {
-			err = iptables.IptableCmd(args...)
-		} else if ipVer == 6 {
-			err = iptables.Ip6tableCmd(args...)
-		} else {
-			err = errors.New(fmt.Sprintf("ACL: Unknown IP version %d", ipVer))
+	}
+	if len(removed) == 0 {
+		return
+	}
+	zone := bridgeZone(bridgeName)
+	match := func(flow conntrack.Flow) bool {
+		if zone != 0 && flow.Zone != zone {
+			return false
 		}
-		if err != nil {
-			return err
+		for _, ace := range removed {
+			if aceMatchesFlow(ace, app, flow) {
+				return true
+			}
 		}
+		return false
 	}
-	if !isMgmt {
-		// Remove mangle rules for IPv6 packets added above
-		// XXX error checks?
-		iptables.Ip6tableCmd("-t", "mangle", "-D", "PREROUTING", "-i", bridgeName,
-			"-p", "tcp", "-j", "CHECKSUM", "--checksum-fill")
-		iptables.Ip6tableCmd("-t", "mangle", "-D", "PREROUTING", "-i", bridgeName,
-			"-p", "udp", "-j", "CHECKSUM", "--checksum-fill")
-	}
-	// XXX see above
-	if false && ipVer == 6 && !isMgmt {
-		// Manually delete the manual add above
-		// XXX error checks?
-		iptables.Ip6tableCmd("-D", "FORWARD", "-i", bridgeName, "-o", "dbo1x0",
-			"-j", "DROP")
+	count, err := conntrack.DeleteFunc(syscall.AF_UNSPEC, match)
+	if err != nil {
+		log.Errorf("deleteRemovedACEFlows(%s) failed: %s\n", appIP, err)
+		return
 	}
-	return nil
+	log.Infof("deleteRemovedACEFlows(%s) deleted %d flows for %v\n",
+		appIP, count, removed)
+}
+
+func containsACE(set []types.ACE, member types.ACE) bool {
+	for _, ace := range set {
+		if reflect.DeepEqual(ace, member) {
+			return true
+		}
+	}
+	return false
+}
+
+// aceMatchesFlow returns true if the flow is to or from the app and the
+// other end matches the ACE. We do not know the content of the ipsets
+// hence host and eidset match any address; the other matches of such an
+// ACE still apply. Same for values we can not parse, since aceToRules
+// would have rejected those.
+func aceMatchesFlow(ace types.ACE, app net.IP, flow conntrack.Flow) bool {
+	var remote net.IP
+	var remotePort, localPort uint16
+	switch {
+	case app.Equal(flow.Orig.Src):
+		// From the app, possibly SNATed
+		remote = flow.Orig.Dst
+		remotePort = flow.Orig.DstPort
+		localPort = flow.Orig.SrcPort
+	case app.Equal(flow.Reply.Src):
+		// To the app; with a port map the lport is the one on the uplink
+		remote = flow.Orig.Src
+		remotePort = flow.Orig.SrcPort
+		localPort = flow.Orig.DstPort
+	default:
+		return false
+	}
+	for _, match := range ace.Matches {
+		switch match.Type {
+		case "ip":
+			subnet, err := conntrack.ParseIPNet(match.Value)
+			if err == nil && !subnet.Contains(remote) {
+				return false
+			}
+		case "protocol":
+			proto, err := conntrack.ParseProto(match.Value)
+			if err == nil && proto != flow.Orig.Protocol {
+				return false
+			}
+		case "fport":
+			if !portMatches(match.Value, remotePort) {
+				return false
+			}
+		case "lport":
+			if !portMatches(match.Value, localPort) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// portMatches accepts a port or a range as in iptables --dport
+func portMatches(value string, port uint16) bool {
+	bounds := strings.SplitN(value, ":", 2)
+	low, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return true
+	}
+	high := low
+	if len(bounds) == 2 {
+		high, err = strconv.ParseUint(bounds[1], 10, 16)
+		if err != nil {
+			return true
+		}
+	}
+	return uint64(port) >= low && uint64(port) <= high
 }
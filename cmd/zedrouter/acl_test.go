@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/zededa/go-provision/conntrack"
+	"github.com/zededa/go-provision/types"
+)
+
+func TestACEMatchesFlow(t *testing.T) {
+	app := net.ParseIP("10.1.0.2")
+	// From the app to a web server, SNATed on the uplink
+	outbound := conntrack.Flow{
+		Orig: conntrack.Tuple{Src: app, Dst: net.ParseIP("192.0.2.1"),
+			Protocol: conntrack.ProtoTCP, SrcPort: 40000, DstPort: 443},
+		Reply: conntrack.Tuple{Src: net.ParseIP("192.0.2.1"),
+			Dst: net.ParseIP("198.51.100.7"), Protocol: conntrack.ProtoTCP,
+			SrcPort: 443, DstPort: 40000},
+	}
+	// Through a port map from 8080 on the uplink to 80 in the app
+	inbound := conntrack.Flow{
+		Orig: conntrack.Tuple{Src: net.ParseIP("203.0.113.9"),
+			Dst: net.ParseIP("198.51.100.7"), Protocol: conntrack.ProtoTCP,
+			SrcPort: 50000, DstPort: 8080},
+		Reply: conntrack.Tuple{Src: app, Dst: net.ParseIP("203.0.113.9"),
+			Protocol: conntrack.ProtoTCP, SrcPort: 80, DstPort: 50000},
+	}
+	// Another app
+	other := outbound
+	other.Orig.Src = net.ParseIP("10.1.0.3")
+
+	ace := func(matches ...string) types.ACE {
+		var ace types.ACE
+		for i := 0; i < len(matches); i += 2 {
+			ace.Matches = append(ace.Matches,
+				types.ACEMatch{Type: matches[i], Value: matches[i+1]})
+		}
+		return ace
+	}
+	tests := map[string]struct {
+		ace      types.ACE
+		flow     conntrack.Flow
+		expected bool
+	}{
+		"Any":          {ace("ip", "0.0.0.0/0"), outbound, true},
+		"Other app":    {ace("ip", "0.0.0.0/0"), other, false},
+		"Remote":       {ace("ip", "192.0.2.0/24"), outbound, true},
+		"Other remote": {ace("ip", "192.0.2.2"), outbound, false},
+		"Protocol and fport": {ace("protocol", "tcp", "fport", "443"),
+			outbound, true},
+		"Other fport": {ace("protocol", "tcp", "fport", "80"),
+			outbound, false},
+		"Fport range": {ace("protocol", "tcp", "fport", "400:500"),
+			outbound, true},
+		"Other protocol": {ace("protocol", "udp"), outbound, false},
+		"Host": {ace("host", "zededa.net", "protocol", "tcp"),
+			outbound, true},
+		"Inbound remote": {ace("ip", "203.0.113.0/24"), inbound, true},
+		"Port map": {ace("protocol", "tcp", "lport", "8080"),
+			inbound, true},
+		"Other port map": {ace("protocol", "tcp", "lport", "8081"),
+			inbound, false},
+	}
+	for name, test := range tests {
+		if aceMatchesFlow(test.ace, app, test.flow) != test.expected {
+			t.Errorf("%s: expected %v\n", name, test.expected)
+		}
+	}
+}
+
+func TestPortMatches(t *testing.T) {
+	if !portMatches("80", 80) || portMatches("80", 81) {
+		t.Errorf("Single port\n")
+	}
+	if !portMatches("1000:2000", 1500) || portMatches("1000:2000", 2001) {
+		t.Errorf("Port range\n")
+	}
+	// Not narrowed by what we can not parse
+	if !portMatches("http", 80) {
+		t.Errorf("Unparsed port\n")
+	}
+}
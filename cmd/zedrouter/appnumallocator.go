@@ -37,7 +37,11 @@ func appNumAllocatorInit(ctx *zedrouterContext) {
 
 	items := pubUuidToNum.GetAll()
 	for key, st := range items {
-		status := cast.CastUuidToNum(st)
+		status, err := cast.CastUuidToNum(st)
+		if err != nil {
+			log.Errorf("appNumAllocatorInit: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("appNumAllocatorInit key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -68,7 +72,11 @@ func appNumAllocatorInit(ctx *zedrouterContext) {
 	// AppNetworkStatus
 	items = pubAppNetworkStatus.GetAll()
 	for key, st := range items {
-		status := cast.CastAppNetworkStatus(st)
+		status, err := cast.CastAppNetworkStatus(st)
+		if err != nil {
+			log.Errorf("appNumAllocatorInit: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("appNumAllocatorInit key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
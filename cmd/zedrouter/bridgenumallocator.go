@@ -27,7 +27,11 @@ func bridgeNumAllocatorInit(ctx *zedrouterContext) {
 
 	items := pubUuidToNum.GetAll()
 	for key, st := range items {
-		status := cast.CastUuidToNum(st)
+		status, err := cast.CastUuidToNum(st)
+		if err != nil {
+			log.Errorf("bridgeNumAllocatorInit: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("bridgeNumAllocatorInit key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -57,7 +61,11 @@ func bridgeNumAllocatorInit(ctx *zedrouterContext) {
 	// NetworkObjectStatus
 	items = pubNetworkObjectStatus.GetAll()
 	for key, st := range items {
-		status := cast.CastNetworkObjectStatus(st)
+		status, err := cast.CastNetworkObjectStatus(st)
+		if err != nil {
+			log.Errorf("bridgeNumAllocatorInit: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("bridgeNumAllocatorInit key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Watch how full the conntrack table is since the kernel silently drops
+// new flows when it is full.
+
+package zedrouter
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/conntrack"
+	"github.com/zededa/go-provision/types"
+)
+
+func publishConntrackStatus(ctx *zedrouterContext) {
+	usage, err := conntrack.ReadUsage()
+	if err != nil {
+		log.Errorf("publishConntrackStatus: %s\n", err)
+		return
+	}
+	gc := types.GlobalConfigDefaults
+	if gcp := agentlog.GetGlobalConfig(ctx.subGlobalConfig); gcp != nil {
+		gc = types.ApplyGlobalConfig(*gcp)
+	}
+	status := ctx.conntrackStatus
+	status.Count = usage.Count
+	status.Max = usage.Max
+	status.Percent = usage.Percent()
+	warning := status.Percent >= int(gc.GetConntrackWarnPercent())
+	if warning && !status.Warning {
+		log.Warnf("Conntrack table %d%% full: %d of %d flows\n",
+			status.Percent, usage.Count, usage.Max)
+		status.WarningTime = time.Now()
+		if gc.ConntrackMax > uint32(usage.Max) {
+			log.Warnf("Raising nf_conntrack_max from %d to %d\n",
+				usage.Max, gc.ConntrackMax)
+			if err := conntrack.SetMax(int(gc.ConntrackMax)); err != nil {
+				log.Errorf("SetMax failed: %s\n", err)
+			}
+		}
+	} else if !warning && status.Warning {
+		log.Infof("Conntrack table %d%% full: %d of %d flows\n",
+			status.Percent, usage.Count, usage.Max)
+	}
+	status.Warning = warning
+	status.Evicting = evictIdleFlows(warning, gc.ConntrackEvictTimeout)
+	ctx.conntrackStatus = status
+	ctx.pubConntrackStatus.Publish(status.Key(), status)
+}
+
+// evictIdleFlows deletes the TCP flows idle for more than evictTimeout
+// seconds while the table is above the warning level. Returns true if it
+// did.
+func evictIdleFlows(warning bool, evictTimeout uint32) bool {
+	if !warning || evictTimeout == 0 {
+		return false
+	}
+	count, err := conntrack.EvictIdle(int(evictTimeout))
+	if err != nil {
+		log.Errorf("EvictIdle failed: %s\n", err)
+		return false
+	}
+	log.Warnf("Evicted %d flows idle for %d seconds\n", count, evictTimeout)
+	return true
+}
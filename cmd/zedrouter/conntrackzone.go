@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Conntrack zone per network instance so that app subnets which overlap
+// across network instances do not collide in the flow table. The zone
+// is the bridgeNum. It only applies to the original direction so that
+// the replies to NATed flows, which arrive on the uplink, still match.
+
+package zedrouter
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/iptables"
+)
+
+// Zone for each bridge with zone rules
+var bridgeZones = make(map[string]uint16)
+
+func conntrackZoneOwner(bridgeName string) string {
+	return "zone-" + bridgeName
+}
+
+func conntrackZoneAdd(bridgeName string, bridgeNum int) error {
+	zone := uint16(bridgeNum)
+	log.Infof("conntrackZoneAdd(%s, %d)\n", bridgeName, zone)
+
+	rule := iptables.Rule{Table: "raw", Chain: "PREROUTING",
+		Args: []string{"-i", bridgeName, "-j", "CT",
+			"--zone-orig", strconv.Itoa(int(zone))}}
+	set := iptables.RuleSet{
+		Owner: conntrackZoneOwner(bridgeName),
+		IPv4:  []iptables.Rule{rule},
+		IPv6:  []iptables.Rule{rule},
+	}
+	if err := iptables.SetRules(set); err != nil {
+		return err
+	}
+	bridgeZones[bridgeName] = zone
+	return nil
+}
+
+func conntrackZoneDelete(bridgeName string, bridgeNum int) {
+	log.Infof("conntrackZoneDelete(%s, %d)\n", bridgeName, bridgeNum)
+
+	err := iptables.DeleteRules(conntrackZoneOwner(bridgeName))
+	if err != nil {
+		log.Errorf("conntrackZoneDelete(%s) failed: %s\n",
+			bridgeName, err)
+	}
+	delete(bridgeZones, bridgeName)
+}
+
+// bridgeZone returns the zone of the bridge, or zero if it has none
+func bridgeZone(bridgeName string) uint16 {
+	return bridgeZones[bridgeName]
+}
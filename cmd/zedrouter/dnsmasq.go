@@ -58,7 +58,7 @@ func dnsmasqDhcpHostDir(bridgeName string) string {
 // createDnsmasqConfigletForNetworkInstance
 // When we create a linux bridge we set this up
 // Also called when we need to update the ipsets
-func createDnsmasqConfigletForNetworkInstance(
+func createDnsmasqConfigletForNetworkInstance(ctx *zedrouterContext,
 	bridgeName string, bridgeIPAddr string,
 	netconf *types.NetworkInstanceConfig, hostsDir string,
 	ipsets []string, Ipv4Eid bool) {
@@ -108,6 +108,23 @@ func createDnsmasqConfigletForNetworkInstance(
 	}
 	file.WriteString(fmt.Sprintf("hostsdir=%s\n", hostsDir))
 	file.WriteString(fmt.Sprintf("dhcp-hostsdir=%s\n", dhcphostsDir))
+	// The FORCERENEW keys of the apps, see forcerenew.go
+	dhcpoptsDir := dnsmasqDhcpOptsDir(bridgeName)
+	ensureDir(dhcpoptsDir)
+	file.WriteString(fmt.Sprintf("dhcp-optsdir=%s\n", dhcpoptsDir))
+	file.WriteString(fmt.Sprintf("dhcp-match=set:%s,%d\n",
+		forceRenewCapableTag, dhcpOptForceRenewNonce))
+
+	// Relay DNS via the uplink of the network instance. Without servers
+	// dnsmasq uses the ones of the device
+	proxy := ctx.serviceProxies[bridgeName]
+	if proxy != nil && len(proxy.dns) != 0 {
+		file.WriteString("no-resolv\n")
+		for _, ns := range proxy.dns {
+			file.WriteString(fmt.Sprintf("server=%s@%s\n",
+				ns.String(), proxy.local.String()))
+		}
+	}
 
 	ipv4Netmask := "255.255.255.0" // Default unless there is a Subnet
 	dhcpRange := bridgeIPAddr      // Default unless there is a DhcpRange
@@ -147,14 +164,25 @@ func createDnsmasqConfigletForNetworkInstance(
 	if Ipv4Eid {
 		advertizeDns = true
 	}
-	for _, ns := range netconf.DnsServers {
+	if proxy != nil {
+		// We are the DNS and NTP server
 		advertizeDns = true
 		file.WriteString(fmt.Sprintf("dhcp-option=option:dns-server,%s\n",
-			ns.String()))
-	}
-	if netconf.NtpServer != nil {
-		file.WriteString(fmt.Sprintf("dhcp-option=option:ntp-server,%s\n",
-			netconf.NtpServer.String()))
+			bridgeIPAddr))
+		if proxy.ntpRelay != nil {
+			file.WriteString(fmt.Sprintf("dhcp-option=option:ntp-server,%s\n",
+				bridgeIPAddr))
+		}
+	} else {
+		for _, ns := range netconf.DnsServers {
+			advertizeDns = true
+			file.WriteString(fmt.Sprintf("dhcp-option=option:dns-server,%s\n",
+				ns.String()))
+		}
+		if netconf.NtpServer != nil {
+			file.WriteString(fmt.Sprintf("dhcp-option=option:ntp-server,%s\n",
+				netconf.NtpServer.String()))
+		}
 	}
 	if netconf.Subnet.IP != nil {
 		ipv4Netmask = net.IP(netconf.Subnet.Mask).String()
@@ -413,8 +441,9 @@ func addhostDnsmasq(bridgeName string, appMac string, appIPAddr string,
 		file.WriteString(fmt.Sprintf("%s,[%s],%s\n",
 			appMac, appIPAddr, hostname))
 	} else {
-		file.WriteString(fmt.Sprintf("%s,id:*,%s,%s\n",
-			appMac, appIPAddr, hostname))
+		file.WriteString(fmt.Sprintf("%s,id:*,%s,%s,set:%s\n",
+			appMac, appIPAddr, hostname, forceRenewTag(appMac)))
+		addForceRenewKey(bridgeName, appMac)
 	}
 	file.Close()
 	if dnsmasqStopStart {
@@ -442,6 +471,9 @@ func removehostDnsmasq(bridgeName string, appMac string, appIPAddr string) {
 	dhcphostsDir := dnsmasqDhcpHostDir(bridgeName)
 	ensureDir(dhcphostsDir)
 
+	if !isIPv6 {
+		removeForceRenewKey(bridgeName, appMac)
+	}
 	cfgPathname := dhcphostsDir + "/" + appMac + suffix
 	if _, err := os.Stat(cfgPathname); err != nil {
 		log.Infof("removehostDnsmasq(%s, %s) failed: %s\n",
@@ -474,6 +506,12 @@ func deleteDnsmasqConfiglet(bridgeName string) {
 		errStr := fmt.Sprintf("deleteDnsmasqConfiglet %v", err)
 		log.Errorln(errStr)
 	}
+	dhcpoptsDir := dnsmasqDhcpOptsDir(bridgeName)
+	ensureDir(dhcpoptsDir)
+	if err := RemoveDirContent(dhcpoptsDir); err != nil {
+		errStr := fmt.Sprintf("deleteDnsmasqConfiglet %v", err)
+		log.Errorln(errStr)
+	}
 }
 
 func RemoveDirContent(dir string) error {
@@ -0,0 +1,93 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Publish the number of conntrack flows and the top talkers for each
+// app instance
+
+package zedrouter
+
+import (
+	"net"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/conntrack"
+	"github.com/zededa/go-provision/types"
+)
+
+// Number of remote endpoints reported per app instance
+const topTalkers = 5
+
+func publishFlowCountMetricsAll(ctx *zedrouterContext) {
+	pub := ctx.pubFlowCountMetrics
+	flows, err := conntrack.List(syscall.AF_UNSPEC)
+	if err != nil {
+		log.Errorf("publishFlowCountMetricsAll: %s\n", err)
+		return
+	}
+	appList := ctx.pubAppNetworkStatus.GetAll()
+	for key, a := range appList {
+		status, err := cast.CastAppNetworkStatus(a)
+		if err != nil {
+			log.Errorf("publishFlowCountMetricsAll: %s\n", err)
+			continue
+		}
+		if status.Key() != key {
+			log.Errorf("publishFlowCountMetricsAll key/UUID mismatch %s vs %s; ignored %+v\n",
+				key, status.Key(), status)
+			continue
+		}
+		counts := conntrack.CountFlows(flows, appEndpoints(status),
+			topTalkers)
+		metrics := types.FlowCountMetrics{
+			UUIDandVersion: status.UUIDandVersion,
+			DisplayName:    status.DisplayName,
+			TotalFlows:     counts.Flows,
+			ProtocolFlows:  counts.Protocols,
+		}
+		for _, t := range counts.TopTalkers {
+			metrics.TopTalkers = append(metrics.TopTalkers,
+				types.FlowTalker{
+					RemoteIP: t.Remote,
+					Flows:    t.Flows,
+					Packets:  t.Packets,
+					Bytes:    t.Bytes,
+				})
+		}
+		log.Debugf("publishFlowCountMetricsAll: %s %d flows\n",
+			metrics.DisplayName, metrics.TotalFlows)
+		pub.Publish(metrics.Key(), metrics)
+	}
+	// Remove the metrics of app instances which are gone
+	for key := range pub.GetAll() {
+		if _, ok := appList[key]; !ok {
+			log.Infof("publishFlowCountMetricsAll: unpublish %s\n", key)
+			pub.Unpublish(key)
+		}
+	}
+}
+
+// appEndpoints returns the addresses of the app instance's interfaces
+// in the conntrack zones of their bridges
+func appEndpoints(status types.AppNetworkStatus) []conntrack.Endpoint {
+	var endpoints []conntrack.Endpoint
+	for _, olStatus := range status.OverlayNetworkList {
+		if olStatus.EID != nil {
+			endpoints = append(endpoints, conntrack.Endpoint{
+				IP:   olStatus.EID,
+				Zone: bridgeZone(olStatus.Bridge),
+			})
+		}
+	}
+	for _, ulStatus := range status.UnderlayNetworkList {
+		ip := net.ParseIP(ulStatus.AssignedIPAddr)
+		if ip != nil {
+			endpoints = append(endpoints, conntrack.Endpoint{
+				IP:   ip,
+				Zone: bridgeZone(ulStatus.Bridge),
+			})
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// DHCP FORCERENEW (RFC 3203) to the apps. Clients drop a FORCERENEW
+// which is not authenticated as per RFC 3118, hence we use the
+// Forcerenew Nonce Authentication of RFC 6704: dnsmasq hands a random
+// key per app in the DHCPACK to the clients which say they support it,
+// and we sign the FORCERENEW with HMAC-MD5 using that key. Clients
+// without support do not get a key and ignore the FORCERENEW.
+
+package zedrouter
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DHCP message type and options per RFC 2131, RFC 3118, RFC 3203 and
+// RFC 6704
+const (
+	dhcpOptServerID        = 54
+	dhcpOptMessageType     = 53
+	dhcpOptAuth            = 90
+	dhcpOptForceRenewNonce = 145
+	dhcpOptEnd             = 255
+	dhcpForceRenew         = 9
+	dhcpMinPacket          = 300
+
+	authProtoNonce   = 3 // Forcerenew Nonce Authentication
+	authAlgHMACMD5   = 1
+	authRDMCounter   = 0 // Monotonically increasing replay detection
+	authTypeKey      = 1 // In the DHCPACK
+	authTypeHMACMD5  = 2 // In the FORCERENEW
+	forceRenewKeyLen = 16
+	authOptLen       = 3 + 8 + 1 + forceRenewKeyLen
+)
+
+// Set by dnsmasq for the clients which sent the option
+const forceRenewCapableTag = "forcerenew-capable"
+
+func dnsmasqDhcpOptsDir(bridgeName string) string {
+	return runDirname + "/dhcp-opts." + bridgeName
+}
+
+func forceRenewKeyFile(bridgeName string, mac string) string {
+	return dnsmasqDhcpOptsDir(bridgeName) + "/" + mac + ".forcerenew"
+}
+
+// The dnsmasq tag for the app, set by its dhcp-host
+func forceRenewTag(mac string) string {
+	return "fr" + strings.Replace(mac, ":", "", -1)
+}
+
+// authOption returns the RFC 3118 authentication option with the key or
+// with an empty HMAC-MD5
+func authOption(authType byte, replay uint64, value []byte) []byte {
+	opt := []byte{dhcpOptAuth, authOptLen, authProtoNonce, authAlgHMACMD5,
+		authRDMCounter}
+	var rd [8]byte
+	binary.BigEndian.PutUint64(rd[:], replay)
+	opt = append(opt, rd[:]...)
+	opt = append(opt, authType)
+	return append(opt, value...)
+}
+
+// dnsmasq dhcp-option for the DHCPACK to the app. The replay detection
+// is zero so that any FORCERENEW counter is larger.
+func forceRenewKeyOption(mac string, key []byte) string {
+	opt := authOption(authTypeKey, 0, key)
+	hexBytes := make([]string, 0, len(opt)-2)
+	for _, b := range opt[2:] {
+		hexBytes = append(hexBytes, fmt.Sprintf("%02x", b))
+	}
+	return fmt.Sprintf("tag:%s,tag:%s,%d,%s\n", forceRenewCapableTag,
+		forceRenewTag(mac), dhcpOptAuth, strings.Join(hexBytes, ":"))
+}
+
+// parseForceRenewKeyOption returns the key from forceRenewKeyOption
+func parseForceRenewKeyOption(line string) ([]byte, error) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	value, err := hex.DecodeString(strings.Replace(fields[len(fields)-1],
+		":", "", -1))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) != authOptLen {
+		errStr := fmt.Sprintf("bad length %d", len(value))
+		return nil, errors.New(errStr)
+	}
+	return value[authOptLen-forceRenewKeyLen:], nil
+}
+
+// addForceRenewKey writes the dnsmasq option with the key for the app,
+// keeping the existing key since the app might have it already
+func addForceRenewKey(bridgeName string, mac string) {
+	if _, err := readForceRenewKey(bridgeName, mac); err == nil {
+		return
+	}
+	key := make([]byte, forceRenewKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		log.Errorf("addForceRenewKey(%s, %s): %s\n", bridgeName, mac, err)
+		return
+	}
+	ensureDir(dnsmasqDhcpOptsDir(bridgeName))
+	filename := forceRenewKeyFile(bridgeName, mac)
+	err := ioutil.WriteFile(filename, []byte(forceRenewKeyOption(mac, key)),
+		0600)
+	if err != nil {
+		log.Errorf("addForceRenewKey(%s, %s): %s\n", bridgeName, mac, err)
+	}
+}
+
+func removeForceRenewKey(bridgeName string, mac string) {
+	filename := forceRenewKeyFile(bridgeName, mac)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		log.Errorf("removeForceRenewKey(%s, %s): %s\n", bridgeName, mac,
+			err)
+	}
+}
+
+func readForceRenewKey(bridgeName string, mac string) ([]byte, error) {
+	b, err := ioutil.ReadFile(forceRenewKeyFile(bridgeName, mac))
+	if err != nil {
+		return nil, err
+	}
+	return parseForceRenewKeyOption(string(b))
+}
+
+// Form a DHCPFORCERENEW for the client with mac from serverIP, signed
+// with the key
+func forceRenewPacket(serverIP net.IP, mac net.HardwareAddr,
+	xid uint32, key []byte, replay uint64) []byte {
+
+	pkt := make([]byte, 240, dhcpMinPacket)
+	pkt[0] = 2 // BOOTREPLY
+	pkt[1] = 1 // Ethernet
+	pkt[2] = byte(len(mac))
+	binary.BigEndian.PutUint32(pkt[4:], xid)
+	copy(pkt[28:44], mac)
+	copy(pkt[236:], []byte{99, 130, 83, 99})
+	pkt = append(pkt, dhcpOptMessageType, 1, dhcpForceRenew)
+	pkt = append(pkt, dhcpOptServerID, 4)
+	pkt = append(pkt, serverIP.To4()...)
+	// The HMAC is computed over the packet with a zero HMAC field
+	pkt = append(pkt, authOption(authTypeHMACMD5, replay,
+		make([]byte, forceRenewKeyLen))...)
+	hmacOffset := len(pkt) - forceRenewKeyLen
+	pkt = append(pkt, dhcpOptEnd)
+	for len(pkt) < dhcpMinPacket {
+		pkt = append(pkt, 0)
+	}
+	mac5 := hmac.New(md5.New, key)
+	mac5.Write(pkt)
+	copy(pkt[hmacOffset:], mac5.Sum(nil))
+	return pkt
+}
+
+// Send a DHCPFORCERENEW to the app. From the server port if we can bind
+// to it in addition to dnsmasq
+func sendForceRenew(serverIP net.IP, appIP net.IP,
+	mac net.HardwareAddr, key []byte) error {
+
+	if appIP.To4() == nil {
+		errStr := fmt.Sprintf("not IPv4 %s", appIP)
+		return errors.New(errStr)
+	}
+	raddr := &net.UDPAddr{IP: appIP, Port: 68}
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: serverIP, Port: 67},
+		raddr)
+	if err != nil {
+		log.Debugf("sendForceRenew: bind to port 67 failed: %s\n", err)
+		conn, err = net.DialUDP("udp4", &net.UDPAddr{IP: serverIP},
+			raddr)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+	log.Infof("sendForceRenew to %s %s\n", appIP, mac)
+	var xid [4]byte
+	rand.Read(xid[:])
+	// Larger than the one of any earlier FORCERENEW
+	replay := uint64(time.Now().UnixNano())
+	_, err = conn.Write(forceRenewPacket(serverIP, mac,
+		binary.BigEndian.Uint32(xid[:]), key, replay))
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestForceRenewPacket(t *testing.T) {
+	serverIP := net.ParseIP("10.1.0.1")
+	mac, _ := net.ParseMAC("00:16:3e:00:01:02")
+	key := []byte("0123456789abcdef")
+	pkt := forceRenewPacket(serverIP, mac, 0x12345678, key, 42)
+
+	if len(pkt) != dhcpMinPacket || pkt[0] != 2 ||
+		binary.BigEndian.Uint32(pkt[4:]) != 0x12345678 ||
+		!bytes.Equal(pkt[28:34], mac) ||
+		!bytes.Equal(pkt[236:240], []byte{99, 130, 83, 99}) {
+		t.Fatalf("Bad header % x\n", pkt[:240])
+	}
+	// Walk the options
+	opts := make(map[byte][]byte)
+	authOffset := 0
+	for i := 240; i < len(pkt); {
+		code := pkt[i]
+		if code == dhcpOptEnd {
+			break
+		}
+		length := int(pkt[i+1])
+		if code == dhcpOptAuth {
+			authOffset = i + 2
+		}
+		opts[code] = pkt[i+2 : i+2+length]
+		i += 2 + length
+	}
+	if !bytes.Equal(opts[dhcpOptMessageType], []byte{dhcpForceRenew}) ||
+		!bytes.Equal(opts[dhcpOptServerID], serverIP.To4()) {
+		t.Errorf("Bad options %v\n", opts)
+	}
+	auth := opts[dhcpOptAuth]
+	if len(auth) != authOptLen || auth[0] != authProtoNonce ||
+		auth[1] != authAlgHMACMD5 || auth[2] != authRDMCounter ||
+		binary.BigEndian.Uint64(auth[3:11]) != 42 ||
+		auth[11] != authTypeHMACMD5 {
+		t.Fatalf("Bad auth option % x\n", auth)
+	}
+	// The HMAC is over the packet with a zero HMAC field
+	digest := append([]byte{}, auth[12:]...)
+	zeroed := append([]byte{}, pkt...)
+	copy(zeroed[authOffset+12:], make([]byte, forceRenewKeyLen))
+	h := hmac.New(md5.New, key)
+	h.Write(zeroed)
+	if !hmac.Equal(digest, h.Sum(nil)) {
+		t.Errorf("Bad HMAC % x\n", digest)
+	}
+	other := forceRenewPacket(serverIP, mac, 0x12345678,
+		[]byte("fedcba9876543210"), 42)
+	if bytes.Equal(pkt, other) {
+		t.Errorf("Same packet with another key\n")
+	}
+}
+
+func TestForceRenewKeyOption(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	line := forceRenewKeyOption("00:16:3e:00:01:02", key)
+	if !strings.HasPrefix(line,
+		"tag:forcerenew-capable,tag:fr00163e000102,90,03:01:00:00:00:00:00:00:00:00:00:01:") {
+		t.Errorf("Got %s\n", line)
+	}
+	got, err := parseForceRenewKeyOption(line)
+	if err != nil {
+		t.Fatalf("parseForceRenewKeyOption failed: %s\n", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("Got key % x\n", got)
+	}
+	if _, err := parseForceRenewKeyOption("tag:x,90,03:01"); err == nil {
+		t.Errorf("Short option accepted\n")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Harness which runs a test in a new network namespace with veth pairs so
+// the netlink calls operate on a real kernel without touching the host.
+// The tests are skipped if we can not create a network namespace, e.g.,
+// when not running as root.
+
+package zedrouter
+
+import (
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+	"github.com/vishvananda/netns"
+	"github.com/zededa/go-provision/devicenetwork"
+)
+
+type testNetns struct {
+	t     *testing.T
+	orig  netns.NsHandle
+	ns    netns.NsHandle
+	links map[int]string // Added to the ifindex cache
+}
+
+// newTestNetns switches the calling thread to a new network namespace.
+// Call close when done, e.g., using defer.
+func newTestNetns(t *testing.T) *testNetns {
+	runtime.LockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("Can not get network namespace: %s", err)
+	}
+	ns, err := netns.New()
+	if err != nil {
+		orig.Close()
+		runtime.UnlockOSThread()
+		t.Skipf("Can not create network namespace: %s", err)
+	}
+	return &testNetns{t: t, orig: orig, ns: ns, links: make(map[int]string)}
+}
+
+// close returns the thread to the original network namespace
+func (tn *testNetns) close() {
+	for ifindex, ifname := range tn.links {
+		devicenetwork.IfindexToNameDel(ifindex, ifname)
+	}
+	if err := netns.Set(tn.orig); err != nil {
+		// Do not let the thread be reused
+		tn.t.Errorf("Can not restore network namespace: %s", err)
+		return
+	}
+	tn.ns.Close()
+	tn.orig.Close()
+	runtime.UnlockOSThread()
+}
+
+// addVeth creates the veth pair with addrSubnet on ifname, brings both
+// ends up, and returns the ifindex of ifname
+func (tn *testNetns) addVeth(ifname string, peer string,
+	addrSubnet string) int {
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: ifname},
+		PeerName: peer}
+	if err := netlink.LinkAdd(veth); err != nil {
+		tn.t.Fatalf("LinkAdd %s failed: %s", ifname, err)
+	}
+	for _, name := range []string{ifname, peer} {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			tn.t.Fatalf("LinkByName %s failed: %s", name, err)
+		}
+		if err := netlink.LinkSetUp(link); err != nil {
+			tn.t.Fatalf("LinkSetUp %s failed: %s", name, err)
+		}
+	}
+	link, _ := netlink.LinkByName(ifname)
+	addr, err := netlink.ParseAddr(addrSubnet)
+	if err != nil {
+		tn.t.Fatalf("ParseAddr %s failed: %s", addrSubnet, err)
+	}
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		tn.t.Fatalf("AddrAdd %s to %s failed: %s", addrSubnet, ifname, err)
+	}
+	ifindex := link.Attrs().Index
+	devicenetwork.IfindexToNameAdd(ifindex, ifname, link.Type(), true, true)
+	tn.links[ifindex] = ifname
+	return ifindex
+}
+
+// addRoute adds a route to dst ("" for default) via gateway in the main
+// table and returns it as listed by the kernel
+func (tn *testNetns) addRoute(ifindex int, dst string,
+	gateway string) netlink.Route {
+
+	rt := netlink.Route{LinkIndex: ifindex, Gw: net.ParseIP(gateway)}
+	if dst != "" {
+		_, ipnet, err := net.ParseCIDR(dst)
+		if err != nil {
+			tn.t.Fatalf("ParseCIDR %s failed: %s", dst, err)
+		}
+		rt.Dst = ipnet
+	}
+	if err := netlink.RouteAdd(&rt); err != nil {
+		tn.t.Fatalf("RouteAdd %v failed: %s", rt, err)
+	}
+	for _, found := range tn.routes(syscall.RT_TABLE_MAIN, ifindex) {
+		if found.Gw.Equal(rt.Gw) && found.Dst.String() == rt.Dst.String() {
+			return found
+		}
+	}
+	tn.t.Fatalf("Route %v not listed", rt)
+	return rt
+}
+
+// routes returns the IPv4 routes in the table for ifindex
+func (tn *testNetns) routes(table int, ifindex int) []netlink.Route {
+	filter := netlink.Route{Table: table, LinkIndex: ifindex}
+	routes, err := netlink.RouteListFiltered(syscall.AF_INET, &filter,
+		netlink.RT_FILTER_TABLE|netlink.RT_FILTER_OIF)
+	if err != nil {
+		tn.t.Fatalf("RouteList failed: %s", err)
+	}
+	return routes
+}
+
+// rules returns the IPv4 rules for the table
+func (tn *testNetns) rules(table int) []netlink.Rule {
+	rules, err := netlink.RuleList(syscall.AF_INET)
+	if err != nil {
+		tn.t.Fatalf("RuleList failed: %s", err)
+	}
+	var result []netlink.Rule
+	for _, r := range rules {
+		if r.Table == table {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// hasRoute returns true if the routes include one to dst ("" for
+// default) via gateway
+func hasRoute(routes []netlink.Route, dst string, gateway string) bool {
+	for _, rt := range routes {
+		if !rt.Gw.Equal(net.ParseIP(gateway)) {
+			continue
+		}
+		if (dst == "" && rt.Dst == nil) ||
+			(rt.Dst != nil && rt.Dst.String() == dst) {
+			return true
+		}
+	}
+	return false
+}
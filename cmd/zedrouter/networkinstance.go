@@ -222,6 +222,7 @@ func networkInstanceBridgeDelete(
 	netlink.LinkDel(link)
 
 	if status.BridgeNum != 0 {
+		conntrackZoneDelete(status.BridgeName, status.BridgeNum)
 		status.BridgeName = ""
 		status.BridgeNum = 0
 		bridgeNumFree(ctx, status.UUID)
@@ -325,7 +326,11 @@ func doNetworkInstanceBridgeAclsDelete(
 	// Delete ACLs attached to this network aka linux bridge
 	items := ctx.pubAppNetworkStatus.GetAll()
 	for _, ans := range items {
-		appNetStatus := cast.CastAppNetworkStatus(ans)
+		appNetStatus, err := cast.CastAppNetworkStatus(ans)
+		if err != nil {
+			log.Errorf("doNetworkInstanceBridgeAclsDelete: %s\n", err)
+			continue
+		}
 
 		for _, olStatus := range appNetStatus.OverlayNetworkList {
 			if olStatus.UsesNetworkInstance && olStatus.Network != status.UUID {
@@ -373,7 +378,11 @@ func handleNetworkInstanceModify(
 
 	ctx := ctxArg.(*zedrouterContext)
 	pub := ctx.pubNetworkInstanceStatus
-	config := cast.CastNetworkInstanceConfig(configArg)
+	config, err := cast.CastNetworkInstanceConfig(configArg)
+	if err != nil {
+		log.Errorf("handleNetworkInstanceModify: %s\n", err)
+		return
+	}
 	status := lookupNetworkInstanceStatus(ctx, key)
 	if status != nil {
 		log.Infof("handleNetworkInstanceModify(%s)\n", key)
@@ -429,6 +438,7 @@ func handleNetworkInstanceCreate(
 		} else {
 			log.Infof("Activated network instance %s %s", status.UUID, status.DisplayName)
 			status.Activated = true
+			applyStaticNeighbors(ctx, &status)
 		}
 	}
 	status.ChangeInProgress = types.ChangeInProgressTypeNone
@@ -491,6 +501,10 @@ func doNetworkInstanceCreate(ctx *zedrouterContext,
 
 	log.Infof("bridge created. BridgeMac: %s\n", bridgeMac)
 
+	if err := conntrackZoneAdd(bridgeName, bridgeNum); err != nil {
+		return err
+	}
+
 	if err := setBridgeIPAddrForNetworkInstance(ctx, status); err != nil {
 		return err
 	}
@@ -514,7 +528,7 @@ func doNetworkInstanceCreate(ctx *zedrouterContext,
 	stopDnsmasq(bridgeName, false, false)
 
 	if status.BridgeIPAddr != "" {
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			status.BridgeIPAddr, &status.NetworkInstanceConfig,
 			hostsDirpath, status.BridgeIPSets, status.Ipv4Eid)
 		startDnsmasq(bridgeName)
@@ -524,7 +538,7 @@ func doNetworkInstanceCreate(ctx *zedrouterContext,
 		// XXX do we need same logic as for IPv4 dnsmasq to not
 		// advertize as default router? Might we need lower
 		// radvd preference if isolated local network?
-		restartRadvdWithNewConfig(bridgeName)
+		restartRadvdWithNewConfig(bridgeName, radvdPrefix(status))
 	}
 
 	switch status.Type {
@@ -593,6 +607,9 @@ func doNetworkInstanceSanityCheck(
 		return errors.New(err)
 	}
 
+	if err := status.ValidateStaticNeighbors(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -695,6 +712,14 @@ func doNetworkInstanceModify(ctx *zedrouterContext,
 		return
 	}
 
+	if err := config.ValidateStaticNeighbors(); err != nil {
+		log.Errorf("doNetworkInstanceModify(%s) static neighbors: %s\n",
+			config.Key(), err)
+		status.SetError(err)
+	} else {
+		status.StaticNeighbors = config.StaticNeighbors
+	}
+
 	if config.Activate && !status.Activated {
 		err := doNetworkInstanceActivate(ctx, status)
 		if err != nil {
@@ -708,6 +733,9 @@ func doNetworkInstanceModify(ctx *zedrouterContext,
 		doNetworkInstanceInactivate(ctx, status)
 		status.Activated = false
 	}
+	if status.Activated {
+		applyStaticNeighbors(ctx, status)
+	}
 }
 
 // getSwitchNetworkInstanceUsingPort
@@ -721,7 +749,11 @@ func getSwitchNetworkInstanceUsingPort(
 	items := pub.GetAll()
 
 	for _, st := range items {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("getSwitchNetworkInstanceUsingPort: %s\n", err)
+			continue
+		}
 		ifname2 := types.AdapterToIfName(ctx.deviceNetworkStatus,
 			status.Port)
 		if ifname2 != ifname {
@@ -746,7 +778,7 @@ func getSwitchNetworkInstanceUsingPort(
 	return nil
 }
 
-func restartDnsmasq(status *types.NetworkInstanceStatus) {
+func restartDnsmasq(ctx *zedrouterContext, status *types.NetworkInstanceStatus) {
 	bridgeName := status.BridgeName
 	stopDnsmasq(bridgeName, false, true)
 
@@ -756,7 +788,7 @@ func restartDnsmasq(status *types.NetworkInstanceStatus) {
 		[]string{status.BridgeIPAddr})
 
 	// Use existing BridgeIPSets
-	createDnsmasqConfigletForNetworkInstance(bridgeName, status.BridgeIPAddr,
+	createDnsmasqConfigletForNetworkInstance(ctx, bridgeName, status.BridgeIPAddr,
 		&status.NetworkInstanceConfig, hostsDirpath, status.BridgeIPSets,
 		status.Ipv4Eid)
 	startDnsmasq(bridgeName)
@@ -1006,7 +1038,8 @@ func setBridgeIPAddrForNetworkInstance(
 	// Create new radvd configuration and restart radvd if ipv6
 	if status.IsIPv6() {
 		log.Infof("Restart Radvd\n")
-		restartRadvdWithNewConfig(status.BridgeName)
+		restartRadvdWithNewConfig(status.BridgeName,
+			radvdPrefix(status))
 	}
 	return nil
 }
@@ -1028,7 +1061,10 @@ func updateBridgeIPAddrForNetworkInstance(
 	if status.BridgeIPAddr != old && status.BridgeIPAddr != "" {
 		log.Infof("updateBridgeIPAddrForNetworkInstance(%s) restarting dnsmasq\n",
 			status.Key())
-		restartDnsmasq(status)
+		// The NTP relay listens on the bridge IP
+		if !updateServiceProxy(ctx, status) {
+			restartDnsmasq(ctx, status)
+		}
 	}
 }
 
@@ -1148,6 +1184,8 @@ func doNetworkInstanceInactivate(
 	log.Infof("doNetworkInstanceInactivate NetworkInstance key %s type %d\n",
 		status.UUID, status.Type)
 
+	removeStaticNeighbors(ctx, status)
+	removeServiceProxy(ctx, status)
 	bridgeInactivateforNetworkInstance(ctx, status)
 	natInactivateForNetworkInstance(ctx, status)
 	switch status.Type {
@@ -1198,7 +1236,11 @@ func lookupNetworkInstanceConfig(ctx *zedrouterContext, key string) *types.Netwo
 	if c == nil {
 		return nil
 	}
-	config := cast.CastNetworkInstanceConfig(c)
+	config, err := cast.CastNetworkInstanceConfig(c)
+	if err != nil {
+		log.Errorf("lookupNetworkInstanceConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupNetworkInstanceConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -1213,7 +1255,11 @@ func lookupNetworkInstanceStatus(ctx *zedrouterContext, key string) *types.Netwo
 	if st == nil {
 		return nil
 	}
-	status := cast.CastNetworkInstanceStatus(st)
+	status, err := cast.CastNetworkInstanceStatus(st)
+	if err != nil {
+		log.Errorf("lookupNetworkInstanceStatus: %s\n", err)
+		return nil
+	}
 	return &status
 }
 
@@ -1223,7 +1269,11 @@ func lookupNetworkInstanceMetrics(ctx *zedrouterContext, key string) *types.Netw
 	if st == nil {
 		return nil
 	}
-	status := cast.CastNetworkInstanceMetrics(st)
+	status, err := cast.CastNetworkInstanceMetrics(st)
+	if err != nil {
+		log.Errorf("lookupNetworkInstanceMetrics: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupNetworkInstanceMetrics key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -1267,7 +1317,11 @@ func publishNetworkInstanceMetricsAll(ctx *zedrouterContext) {
 	}
 	nms := getNetworkMetrics(ctx)
 	for _, ni := range niList {
-		status := cast.CastNetworkInstanceStatus(ni)
+		status, err := cast.CastNetworkInstanceStatus(ni)
+		if err != nil {
+			log.Errorf("publishNetworkInstanceMetricsAll: %s\n", err)
+			continue
+		}
 		netMetrics := createNetworkInstanceMetrics(ctx, &status, &nms)
 		publishNetworkInstanceMetrics(ctx, netMetrics)
 	}
@@ -1494,7 +1548,11 @@ func lispInactivateForNetworkInstance(ctx *zedrouterContext,
 	}
 
 	for _, ans := range items {
-		appNetStatus := cast.CastAppNetworkStatus(ans)
+		appNetStatus, err := cast.CastAppNetworkStatus(ans)
+		if err != nil {
+			log.Errorf("lispInactivateForNetworkInstance: %s\n", err)
+			continue
+		}
 		if len(appNetStatus.OverlayNetworkList) == 0 {
 			continue
 		}
@@ -1547,7 +1605,11 @@ func lookupNetworkInstanceStatusByBridgeName(ctx *zedrouterContext,
 	pub := ctx.pubNetworkInstanceStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("lookupNetworkInstanceStatusByBridgeName: %s\n", err)
+			continue
+		}
 		if status.BridgeName == bridgeName {
 			return &status
 		}
@@ -11,7 +11,6 @@ import (
 	"fmt"
 	"net"
 	"strconv"
-	"time"
 
 	"github.com/eriknordmark/netlink"
 	log "github.com/sirupsen/logrus"
@@ -21,7 +20,11 @@ import (
 
 func handleNetworkObjectModify(ctxArg interface{}, key string, configArg interface{}) {
 	ctx := ctxArg.(*zedrouterContext)
-	config := cast.CastNetworkObjectConfig(configArg)
+	config, err := cast.CastNetworkObjectConfig(configArg)
+	if err != nil {
+		log.Errorf("handleNetworkObjectModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleNetworkObjectModify key/UUID mismatch %s vs %s; ignored %+v\n", key, config.Key(), config)
 		return
@@ -55,8 +58,7 @@ func handleNetworkObjectCreate(ctx *zedrouterContext, key string, config types.N
 	err := doNetworkCreate(ctx, config, &status)
 	if err != nil {
 		log.Errorf("doNetworkCreate(%s) failed: %s\n", key, err)
-		status.Error = err.Error()
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(err.Error())
 		status.PendingAdd = false
 		publishNetworkObjectStatus(ctx, &status)
 		return
@@ -525,7 +527,11 @@ func lookupNetworkObjectConfig(ctx *zedrouterContext, key string) *types.Network
 	if c == nil {
 		return nil
 	}
-	config := cast.CastNetworkObjectConfig(c)
+	config, err := cast.CastNetworkObjectConfig(c)
+	if err != nil {
+		log.Errorf("lookupNetworkObjectConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupNetworkObjectConfig: key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -541,7 +547,11 @@ func lookupNetworkObjectStatus(ctx *zedrouterContext, key string) *types.Network
 	if st == nil {
 		return nil
 	}
-	status := cast.CastNetworkObjectStatus(st)
+	status, err := cast.CastNetworkObjectStatus(st)
+	if err != nil {
+		log.Errorf("lookupNetworkObjectStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupNetworkObjectStatus: key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -555,7 +565,11 @@ func lookupNetworkObjectStatusByBridgeName(ctx *zedrouterContext, bridgeName str
 	pub := ctx.pubNetworkObjectStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastNetworkObjectStatus(st)
+		status, err := cast.CastNetworkObjectStatus(st)
+		if err != nil {
+			log.Errorf("lookupNetworkObjectStatusByBridgeName: %s\n", err)
+			continue
+		}
 		if status.BridgeName == bridgeName {
 			return &status
 		}
@@ -615,8 +629,7 @@ func doNetworkModify(ctx *zedrouterContext, config types.NetworkObjectConfig,
 		errStr := fmt.Sprintf("doNetworkModify NetworkObjectStatus can't change key %s",
 			config.UUID)
 		log.Errorln(errStr)
-		status.Error = errStr
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errStr)
 		return
 	}
 
@@ -631,7 +644,11 @@ func doNetworkModify(ctx *zedrouterContext, config types.NetworkObjectConfig,
 		pub := ctx.pubAppNetworkStatus
 		items := pub.GetAll()
 		for _, ans := range items {
-			appNetStatus := cast.CastAppNetworkStatus(ans)
+			appNetStatus, err := cast.CastAppNetworkStatus(ans)
+			if err != nil {
+				log.Errorf("doNetworkModify: %s\n", err)
+				continue
+			}
 			for _, olStatus := range appNetStatus.OverlayNetworkList {
 				if olStatus.Network != status.UUID {
 					continue
@@ -669,7 +686,11 @@ func doNetworkDelete(ctx *zedrouterContext,
 	pub := ctx.pubAppNetworkStatus
 	items := pub.GetAll()
 	for _, ans := range items {
-		appNetStatus := cast.CastAppNetworkStatus(ans)
+		appNetStatus, err := cast.CastAppNetworkStatus(ans)
+		if err != nil {
+			log.Errorf("doNetworkDelete: %s\n", err)
+			continue
+		}
 		for _, olStatus := range appNetStatus.OverlayNetworkList {
 			if olStatus.Network != status.UUID {
 				continue
@@ -749,7 +770,11 @@ func vifNameToBridgeName(ctx *zedrouterContext, vifName string) string {
 	pub := ctx.pubNetworkInstanceStatus
 	instanceItems := pub.GetAll()
 	for _, st := range instanceItems {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("vifNameToBridgeName: %s\n", err)
+			continue
+		}
 		if status.IsVifInBridge(vifName) {
 			return status.BridgeName
 		}
@@ -758,7 +783,11 @@ func vifNameToBridgeName(ctx *zedrouterContext, vifName string) string {
 	pub = ctx.pubNetworkObjectStatus
 	objectItems := pub.GetAll()
 	for _, st := range objectItems {
-		status := cast.CastNetworkObjectStatus(st)
+		status, err := cast.CastNetworkObjectStatus(st)
+		if err != nil {
+			log.Errorf("vifNameToBridgeName: %s\n", err)
+			continue
+		}
 		if status.IsVifInBridge(vifName) {
 			return status.BridgeName
 		}
@@ -67,7 +67,7 @@ func PbrRouteAddDefault(bridgeName string, port string) error {
 	}
 	log.Infof("PbrRouteAddDefault(%s, %s) adding %v\n",
 		bridgeName, port, myrt)
-	if err := netlink.RouteAdd(&myrt); err != nil {
+	if err := devicenetwork.Netlink.RouteAdd(&myrt); err != nil {
 		errStr := fmt.Sprintf("Failed to add %v to %d: %s",
 			myrt, myrt.Table, err)
 		log.Errorln(errStr)
@@ -110,7 +110,7 @@ func PbrRouteDeleteDefault(bridgeName string, port string) error {
 	}
 	log.Infof("PbrRouteDeleteDefault(%s, %s) deleting %v\n",
 		bridgeName, port, myrt)
-	if err := netlink.RouteDel(&myrt); err != nil {
+	if err := devicenetwork.Netlink.RouteDel(&myrt); err != nil {
 		errStr := fmt.Sprintf("Failed to delete %v from %d: %s",
 			myrt, myrt.Table, err)
 		log.Errorln(errStr)
@@ -199,24 +199,24 @@ func PbrRouteChange(deviceNetworkStatus *types.DeviceNetworkStatus,
 	if change.Type == getRouteUpdateTypeDELROUTE() {
 		log.Debugf("Received route del %v\n", rt)
 		if doFreeTable {
-			if err := netlink.RouteDel(&srt); err != nil {
+			if err := devicenetwork.Netlink.RouteDel(&srt); err != nil {
 				log.Errorf("Failed to remove %v from %d: %s\n",
 					srt, srt.Table, err)
 			}
 		}
-		if err := netlink.RouteDel(&myrt); err != nil {
+		if err := devicenetwork.Netlink.RouteDel(&myrt); err != nil {
 			log.Errorf("Failed to remove %v from %d: %s\n",
 				myrt, myrt.Table, err)
 		}
 	} else if change.Type == getRouteUpdateTypeNEWROUTE() {
 		log.Debugf("Received route add %v\n", rt)
 		if doFreeTable {
-			if err := netlink.RouteAdd(&srt); err != nil {
+			if err := devicenetwork.Netlink.RouteAdd(&srt); err != nil {
 				log.Errorf("Failed to add %v to %d: %s\n",
 					srt, srt.Table, err)
 			}
 		}
-		if err := netlink.RouteAdd(&myrt); err != nil {
+		if err := devicenetwork.Netlink.RouteAdd(&myrt); err != nil {
 			log.Errorf("Failed to add %v to %d: %s\n",
 				myrt, myrt.Table, err)
 		}
@@ -323,7 +323,7 @@ func flushRoutesTable(table int, ifindex int) {
 	if ifindex != 0 {
 		fflags |= netlink.RT_FILTER_OIF
 	}
-	routes, err := netlink.RouteListFiltered(syscall.AF_UNSPEC,
+	routes, err := devicenetwork.Netlink.RouteListFiltered(syscall.AF_UNSPEC,
 		&filter, fflags)
 	if err != nil {
 		log.Fatalf("RouteList failed: %v\n", err)
@@ -339,7 +339,7 @@ func flushRoutesTable(table int, ifindex int) {
 		}
 		log.Debugf("flushRoutesTable(%d, %d) deleting %v\n",
 			table, ifindex, rt)
-		if err := netlink.RouteDel(&rt); err != nil {
+		if err := devicenetwork.Netlink.RouteDel(&rt); err != nil {
 			// XXX was Fatalf
 			log.Errorf("flushRoutesTable - RouteDel %v failed %s\n",
 				rt, err)
@@ -352,7 +352,7 @@ func flushRoutesTable(table int, ifindex int) {
 // Flush the rules we create. If ifindex is non-zero we also compare it
 // Otherwise we flush the FreeTable
 func flushRules(ifindex int) {
-	rules, err := netlink.RuleList(syscall.AF_UNSPEC)
+	rules, err := devicenetwork.Netlink.RuleList(syscall.AF_UNSPEC)
 	if err != nil {
 		log.Fatalf("RuleList failed: %v\n", err)
 	}
@@ -365,7 +365,7 @@ func flushRules(ifindex int) {
 			continue
 		}
 		log.Debugf("flushRules: RuleDel %v\n", r)
-		if err := netlink.RuleDel(&r); err != nil {
+		if err := devicenetwork.Netlink.RuleDel(&r); err != nil {
 			log.Fatalf("flushRules - RuleDel %v failed %s\n",
 				r, err)
 		}
@@ -397,8 +397,8 @@ func addSourceRule(ifindex int, p net.IPNet, bridge bool) {
 	}
 	log.Debugf("addSourceRule: RuleAdd %v\n", r)
 	// Avoid duplicate rules
-	_ = netlink.RuleDel(r)
-	if err := netlink.RuleAdd(r); err != nil {
+	_ = devicenetwork.Netlink.RuleDel(r)
+	if err := devicenetwork.Netlink.RuleAdd(r); err != nil {
 		log.Errorf("RuleAdd %v failed with %s\n", r, err)
 		return
 	}
@@ -428,7 +428,7 @@ func delSourceRule(ifindex int, p net.IPNet, bridge bool) {
 		}
 	}
 	log.Debugf("delSourceRule: RuleDel %v\n", r)
-	if err := netlink.RuleDel(r); err != nil {
+	if err := devicenetwork.Netlink.RuleDel(r); err != nil {
 		log.Errorf("RuleDel %v failed with %s\n", r, err)
 		return
 	}
@@ -450,10 +450,10 @@ func AddOverlayRuleAndRoute(bridgeName string, iifIndex int,
 	}
 
 	// Avoid duplicate rules
-	_ = netlink.RuleDel(r)
+	_ = devicenetwork.Netlink.RuleDel(r)
 
 	// Add rule
-	if err := netlink.RuleAdd(r); err != nil {
+	if err := devicenetwork.Netlink.RuleAdd(r); err != nil {
 		errStr := fmt.Sprintf("AddOverlayRuleAndRoute: RuleAdd %v failed with %s", r, err)
 		log.Errorln(errStr)
 		return errors.New(errStr)
@@ -463,7 +463,7 @@ func AddOverlayRuleAndRoute(bridgeName string, iifIndex int,
 
 	// Setup a route for the current network's subnet to point out of the given oifIndex
 	rt := netlink.Route{Dst: ipnet, LinkIndex: oifIndex, Table: myTable, Flags: 0}
-	if err := netlink.RouteAdd(&rt); err != nil {
+	if err := devicenetwork.Netlink.RouteAdd(&rt); err != nil {
 		errStr := fmt.Sprintf("AddOverlayRuleAndRoute: RouteAdd %s failed: %s",
 			ipnet.String(), err)
 		log.Errorln(errStr)
@@ -16,6 +16,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/devicenetwork"
 	"github.com/zededa/go-provision/types"
+	"golang.org/x/sys/unix"
 )
 
 // Return the first default route for one interface. XXX or return all?
@@ -27,7 +28,7 @@ func getDefaultIPv4Route(ifindex int) *netlink.Route {
 	fflags |= netlink.RT_FILTER_OIF
 	fflags |= netlink.RT_FILTER_DST
 	log.Infof("getDefaultIPv4Route(%d) filter %v\n", ifindex, filter)
-	routes, err := netlink.RouteListFiltered(syscall.AF_INET,
+	routes, err := devicenetwork.Netlink.RouteListFiltered(syscall.AF_INET,
 		&filter, fflags)
 	if err != nil {
 		log.Fatalf("RouteList failed: %v\n", err)
@@ -45,6 +46,35 @@ func getDefaultIPv4Route(ifindex int) *netlink.Route {
 	return nil
 }
 
+// Return the ifindex of the preferred IPv4 default route in the table,
+// skipping routes on links which are down. Zero if none.
+func getTableDefaultRouteIfindex(table int) int {
+	filter := netlink.Route{Table: table, Dst: nil}
+	fflags := netlink.RT_FILTER_TABLE
+	fflags |= netlink.RT_FILTER_DST
+	routes, err := devicenetwork.Netlink.RouteListFiltered(syscall.AF_INET,
+		&filter, fflags)
+	if err != nil {
+		log.Errorf("getTableDefaultRouteIfindex(%d) failed: %v\n",
+			table, err)
+		return 0
+	}
+	var best *netlink.Route
+	for i := range routes {
+		rt := &routes[i]
+		if rt.Table != table || rt.Flags&unix.RTNH_F_LINKDOWN != 0 {
+			continue
+		}
+		if best == nil || rt.Priority < best.Priority {
+			best = rt
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return best.LinkIndex
+}
+
 func getDefaultRouteTable() int {
 	return syscall.RT_TABLE_MAIN
 }
@@ -57,6 +87,10 @@ func getRouteUpdateTypeNEWROUTE() uint16 {
 	return syscall.RTM_NEWROUTE
 }
 
+func getNeighStatePermanent() int {
+	return netlink.NUD_PERMANENT
+}
+
 // Used when FreeMgmtPorts get a link added
 // If ifindex is non-zero we also compare it
 func moveRoutesTable(srcTable int, ifindex int, dstTable int) {
@@ -68,7 +102,7 @@ func moveRoutesTable(srcTable int, ifindex int, dstTable int) {
 	if ifindex != 0 {
 		fflags |= netlink.RT_FILTER_OIF
 	}
-	routes, err := netlink.RouteListFiltered(syscall.AF_UNSPEC,
+	routes, err := devicenetwork.Netlink.RouteListFiltered(syscall.AF_UNSPEC,
 		&filter, fflags)
 	if err != nil {
 		log.Fatalf("RouteList failed: %v\n", err)
@@ -100,7 +134,7 @@ func moveRoutesTable(srcTable int, ifindex int, dstTable int) {
 		}
 		log.Debugf("moveRoutesTable(%d, %d, %d) adding %v\n",
 			srcTable, ifindex, dstTable, art)
-		if err := netlink.RouteAdd(&art); err != nil {
+		if err := devicenetwork.Netlink.RouteAdd(&art); err != nil {
 			log.Errorf("moveRoutesTable failed to add %v to %d: %s\n",
 				art, art.Table, err)
 		}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+	"github.com/zededa/go-provision/types"
+)
+
+// A DeviceNetworkStatus with eth0 as a management port
+func testDeviceNetworkStatus(free bool) *types.DeviceNetworkStatus {
+	return &types.DeviceNetworkStatus{
+		Version: types.DPCIsMgmt,
+		Ports: []types.NetworkPortStatus{
+			{IfName: "eth0", Name: "eth0", IsMgmt: true, Free: free},
+		},
+	}
+}
+
+func TestPbrInit(t *testing.T) {
+	tn := newTestNetns(t)
+	defer tn.close()
+
+	ifindex := tn.addVeth("eth0", "eth0peer", "192.168.99.2/24")
+	tn.addRoute(ifindex, "", "192.168.99.1")
+	// Left over from a previous run
+	stale := netlink.NewRule()
+	stale.Table = FreeTable
+	stale.Family = syscall.AF_INET
+	_, stale.Src, _ = net.ParseCIDR("10.99.0.0/16")
+	if err := netlink.RuleAdd(stale); err != nil {
+		t.Fatalf("RuleAdd failed: %s", err)
+	}
+
+	freeMgmtPortList = nil
+	ctx := &zedrouterContext{deviceNetworkStatus: testDeviceNetworkStatus(true)}
+	PbrInit(ctx)
+	if rules := tn.rules(FreeTable); len(rules) != 0 {
+		t.Errorf("Stale rules not flushed: %v", rules)
+	}
+
+	// No longer free
+	setFreeMgmtPorts(nil)
+	if routes := tn.routes(FreeTable, ifindex); len(routes) != 0 {
+		t.Errorf("Routes left in FreeTable: %v", routes)
+	}
+}
+
+func TestPbrRouteChange(t *testing.T) {
+	tn := newTestNetns(t)
+	defer tn.close()
+
+	ifindex := tn.addVeth("eth0", "eth0peer", "192.168.99.2/24")
+	myTable := FreeTable + ifindex
+	rt := tn.addRoute(ifindex, "10.10.0.0/16", "192.168.99.1")
+
+	status := testDeviceNetworkStatus(true)
+	PbrRouteChange(status, netlink.RouteUpdate{
+		Type: syscall.RTM_NEWROUTE, Route: rt})
+	for _, table := range []int{FreeTable, myTable} {
+		if !hasRoute(tn.routes(table, ifindex), "10.10.0.0/16", "192.168.99.1") {
+			t.Errorf("Route not added to table %d", table)
+		}
+	}
+	PbrRouteChange(status, netlink.RouteUpdate{
+		Type: syscall.RTM_DELROUTE, Route: rt})
+	for _, table := range []int{FreeTable, myTable} {
+		if routes := tn.routes(table, ifindex); len(routes) != 0 {
+			t.Errorf("Routes left in table %d: %v", table, routes)
+		}
+	}
+
+	// Only the ifindex specific table for a non-free port
+	status = testDeviceNetworkStatus(false)
+	PbrRouteChange(status, netlink.RouteUpdate{
+		Type: syscall.RTM_NEWROUTE, Route: rt})
+	if routes := tn.routes(FreeTable, ifindex); len(routes) != 0 {
+		t.Errorf("Non-free port routes in FreeTable: %v", routes)
+	}
+	if !hasRoute(tn.routes(myTable, ifindex), "10.10.0.0/16", "192.168.99.1") {
+		t.Errorf("Route not added to table %d", myTable)
+	}
+
+	// Routes in other tables are ignored
+	other := rt
+	other.Table = 1000
+	PbrRouteChange(status, netlink.RouteUpdate{
+		Type: syscall.RTM_DELROUTE, Route: other})
+	if !hasRoute(tn.routes(myTable, ifindex), "10.10.0.0/16", "192.168.99.1") {
+		t.Errorf("Route removed from table %d", myTable)
+	}
+}
+
+func TestSourceRule(t *testing.T) {
+	tn := newTestNetns(t)
+	defer tn.close()
+
+	ifindex := tn.addVeth("eth0", "eth0peer", "192.168.99.2/24")
+	myTable := FreeTable + ifindex
+	addr := net.IPNet{IP: net.ParseIP("192.168.99.2").To4(),
+		Mask: net.CIDRMask(24, 32)}
+
+	tests := []struct {
+		bridge bool
+		src    string
+	}{
+		{false, "192.168.99.2/32"},
+		{true, "192.168.99.0/24"},
+	}
+	for _, test := range tests {
+		// Twice to check there are no duplicates
+		addSourceRule(ifindex, addr, test.bridge)
+		addSourceRule(ifindex, addr, test.bridge)
+		rules := tn.rules(myTable)
+		if len(rules) != 1 || rules[0].Src == nil {
+			t.Errorf("bridge %t: expected one rule, got %v",
+				test.bridge, rules)
+		} else {
+			ones, _ := rules[0].Src.Mask.Size()
+			src := net.IPNet{IP: rules[0].Src.IP.Mask(rules[0].Src.Mask),
+				Mask: rules[0].Src.Mask}
+			if src.String() != test.src || ones == 0 {
+				t.Errorf("bridge %t: expected src %s, got %v",
+					test.bridge, test.src, rules[0].Src)
+			}
+		}
+		delSourceRule(ifindex, addr, test.bridge)
+		if rules := tn.rules(myTable); len(rules) != 0 {
+			t.Errorf("bridge %t: rules left %v", test.bridge, rules)
+		}
+	}
+}
@@ -17,6 +17,10 @@ func getDefaultIPv4Route(ifindex int) *netlink.Route {
 	return nil
 }
 
+func getTableDefaultRouteIfindex(table int) int {
+	return 0
+}
+
 func getDefaultRouteTable() int {
 	return 0
 }
@@ -29,6 +33,10 @@ func getRouteUpdateTypeNEWROUTE() uint16 {
 	return 0
 }
 
+func getNeighStatePermanent() int {
+	return 0
+}
+
 func moveRoutesTable(srcTable int, ifindex int, dstTable int) {
 	return
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
 	"github.com/zededa/go-provision/wrap"
 )
 
@@ -28,22 +29,48 @@ interface %s {
 	{
 		AdvRoutePreference high;
 		AdvRouteLifetime 1800;
-	};
+	};%s
 };
 `
 
+// The prefix of a network instance. The addresses come from DHCPv6 hence
+// not autonomous. When radvd stops it advertises the prefix with a zero
+// preferred lifetime, which tells the apps their addresses are
+// deprecated e.g., when the uplink changes.
+const radvdPrefixTemplate = `
+	prefix %s
+	{
+		AdvOnLink on;
+		AdvAutonomous off;
+		DeprecatePrefix on;
+	};`
+
 // Create the radvd config file for the overlay
 // Would be more polite to return an error then to Fatal
 //	olIfname - Overlay Interface Name
 func createRadvdConfiglet(cfgPathname string, olIfname string) {
+	createRadvdConfigletWithPrefix(cfgPathname, olIfname, "")
+}
 
-	log.Debugf("createRadvdConfiglet: %s\n", olIfname)
+// Same with the prefix of a network instance unless empty
+func createRadvdConfigletWithPrefix(cfgPathname string, olIfname string,
+	prefix string) {
+
+	log.Debugf("createRadvdConfigletWithPrefix: %s %s\n", olIfname, prefix)
 	file, err := os.Create(cfgPathname)
 	if err != nil {
 		log.Fatal("createRadvdConfiglet failed ", err)
 	}
 	defer file.Close()
-	file.WriteString(fmt.Sprintf(radvdTemplate, olIfname))
+	file.WriteString(radvdConfig(olIfname, prefix))
+}
+
+func radvdConfig(olIfname string, prefix string) string {
+	prefixConfig := ""
+	if prefix != "" {
+		prefixConfig = fmt.Sprintf(radvdPrefixTemplate, prefix)
+	}
+	return fmt.Sprintf(radvdTemplate, olIfname, prefixConfig)
 }
 
 func deleteRadvdConfiglet(cfgPathname string) {
@@ -89,11 +116,20 @@ func stopRadvd(bridgeName string, printOnError bool) {
 	deleteRadvdConfiglet(cfgPathname)
 }
 
-func restartRadvdWithNewConfig(bridgeName string) {
-	cfgFilename, cfgPathname := getBridgeRadvdCfgFileName(bridgeName)
+// The existing radvd deprecates the prefix as it stops
+func restartRadvdWithNewConfig(bridgeName string, prefix string) {
+	_, cfgPathname := getBridgeRadvdCfgFileName(bridgeName)
 
 	// kill existing radvd instance
-	stopRadvd(cfgFilename, false)
-	createRadvdConfiglet(cfgPathname, bridgeName)
+	stopRadvd(bridgeName, false)
+	createRadvdConfigletWithPrefix(cfgPathname, bridgeName, prefix)
 	startRadvd(cfgPathname, bridgeName)
 }
+
+// The subnet of an IPv6 network instance, if any
+func radvdPrefix(status *types.NetworkInstanceStatus) string {
+	if status.Subnet.IP == nil || status.Subnet.IP.To4() != nil {
+		return ""
+	}
+	return status.Subnet.String()
+}
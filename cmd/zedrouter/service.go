@@ -12,7 +12,6 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/eriknordmark/netlink"
 	"github.com/satori/go.uuid"
@@ -25,7 +24,11 @@ import (
 func handleNetworkServiceModify(ctxArg interface{}, key string, configArg interface{}) {
 	ctx := ctxArg.(*zedrouterContext)
 	pub := ctx.pubNetworkServiceStatus
-	config := cast.CastNetworkServiceConfig(configArg)
+	config, err := cast.CastNetworkServiceConfig(configArg)
+	if err != nil {
+		log.Errorf("handleNetworkServiceModify: %s\n", err)
+		return
+	}
 	if config.Key() != key {
 		log.Errorf("handleNetworkServiceModify key/UUID mismatch %s vs %s; ignored %+v\n", key, config.Key(), config)
 		return
@@ -60,8 +63,7 @@ func handleNetworkServiceCreate(ctx *zedrouterContext, key string, config types.
 	err := doServiceCreate(ctx, config, &status)
 	if err != nil {
 		log.Infof("doServiceCreate(%s) failed: %s\n", key, err)
-		status.Error = err.Error()
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(err.Error())
 		status.PendingAdd = false
 		publishNetworkServiceStatus(ctx, &status, true)
 		return
@@ -71,8 +73,7 @@ func handleNetworkServiceCreate(ctx *zedrouterContext, key string, config types.
 		err := doServiceActivate(ctx, config, &status)
 		if err != nil {
 			log.Errorf("doServiceActivate(%s) failed: %s\n", key, err)
-			status.Error = err.Error()
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(err.Error())
 		} else {
 			status.Activated = true
 		}
@@ -143,8 +144,7 @@ func doServiceModify(ctx *zedrouterContext, config types.NetworkServiceConfig,
 		errStr := fmt.Sprintf("doServiceModify NetworkService can't change key %s",
 			config.UUID)
 		log.Errorln(errStr)
-		status.Error = errStr
-		status.ErrorTime = time.Now()
+		status.SetErrorNow(errStr)
 		return
 	}
 
@@ -153,8 +153,7 @@ func doServiceModify(ctx *zedrouterContext, config types.NetworkServiceConfig,
 		if err != nil {
 			log.Errorf("doServiceActivate(%s) failed: %s\n",
 				config.Key(), err)
-			status.Error = err.Error()
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(err.Error())
 		} else {
 			status.Activated = true
 		}
@@ -170,7 +169,11 @@ func maybeUpdateBridgeIPAddr(ctx *zedrouterContext, ifname string) {
 	pub := ctx.pubNetworkServiceStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("maybeUpdateBridgeIPAddr: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("maybeUpdateBridgeIPAddr key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -270,7 +273,11 @@ func checkAndRecreateService(ctx *zedrouterContext, network uuid.UUID) {
 	pub := ctx.pubNetworkServiceStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("checkAndRecreateService: %s\n", err)
+			continue
+		}
 		if !status.MissingNetwork {
 			continue
 		}
@@ -294,15 +301,13 @@ func checkAndRecreateService(ctx *zedrouterContext, network uuid.UUID) {
 		if status.Error != "" {
 			log.Infof("checkAndRecreateService(%s) remove error %s for %s\n",
 				network.String(), status.Error, status.Key())
-			status.Error = ""
-			status.ErrorTime = time.Time{}
+			status.ClearError()
 		}
-		err := doServiceActivate(ctx, *config, &status)
+		err = doServiceActivate(ctx, *config, &status)
 		if err != nil {
 			log.Infof("checkAndRecreateService srv %s failed %s\n",
 				status.Key(), err)
-			status.Error = err.Error()
-			status.ErrorTime = time.Now()
+			status.SetErrorNow(err.Error())
 		} else {
 			status.Activated = true
 			status.MissingNetwork = false
@@ -408,7 +413,11 @@ func lookupNetworkServiceConfig(ctx *zedrouterContext, key string) *types.Networ
 	if c == nil {
 		return nil
 	}
-	config := cast.CastNetworkServiceConfig(c)
+	config, err := cast.CastNetworkServiceConfig(c)
+	if err != nil {
+		log.Errorf("lookupNetworkServiceConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupNetworkServiceConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -424,7 +433,11 @@ func lookupNetworkServiceStatus(ctx *zedrouterContext, key string) *types.Networ
 	if st == nil {
 		return nil
 	}
-	status := cast.CastNetworkServiceStatus(st)
+	status, err := cast.CastNetworkServiceStatus(st)
+	if err != nil {
+		log.Errorf("lookupNetworkServiceStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupNetworkServiceStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -439,7 +452,11 @@ func lookupNetworkServiceMetrics(ctx *zedrouterContext, key string) *types.Netwo
 	if st == nil {
 		return nil
 	}
-	status := cast.CastNetworkServiceMetrics(st)
+	status, err := cast.CastNetworkServiceMetrics(st)
+	if err != nil {
+		log.Errorf("lookupNetworkServiceMetrics: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupNetworkServiceMetrics key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -519,7 +536,11 @@ func lookupAppLink(ctx *zedrouterContext, appLink uuid.UUID) *types.NetworkServi
 	pub := ctx.pubNetworkServiceStatus
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("lookupAppLink: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Infof("lookupAppLink key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
@@ -542,7 +563,11 @@ func publishNetworkServiceStatusAll(ctx *zedrouterContext) {
 		return
 	}
 	for _, st := range stlist {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("publishNetworkServiceStatusAll: %s\n", err)
+			continue
+		}
 		if status.Type == types.NST_LISP {
 			// For Lisp, service info update is triggered when we receive
 			// update from lisp-ztr with changes to its state info.
@@ -635,7 +660,11 @@ func lispActivate(ctx *zedrouterContext,
 	items := pub.GetAll()
 
 	for _, ans := range items {
-		appNetStatus := cast.CastAppNetworkStatus(ans)
+		appNetStatus, err := cast.CastAppNetworkStatus(ans)
+		if err != nil {
+			log.Errorf("lispActivate: %s\n", err)
+			continue
+		}
 		for _, olconfig := range appNetStatus.OverlayNetworkList {
 			if olconfig.Network == status.AppLink {
 				// We are interconnected
@@ -674,7 +703,11 @@ func lispInactivate(ctx *zedrouterContext,
 	}
 
 	for _, ans := range items {
-		appNetStatus := cast.CastAppNetworkStatus(ans)
+		appNetStatus, err := cast.CastAppNetworkStatus(ans)
+		if err != nil {
+			log.Errorf("lispInactivate: %s\n", err)
+			continue
+		}
 		if len(appNetStatus.OverlayNetworkList) == 0 {
 			continue
 		}
@@ -0,0 +1,377 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// DNS and NTP proxying for local network instances. When enabled the apps
+// get the bridge IP as their DNS and NTP server, and we send the queries
+// upstream from the address of the uplink currently used by the network
+// instance, so they follow the app traffic across an uplink failover.
+// dnsmasq relays DNS; NTP is relayed here through a single upstream
+// socket per network instance, with a bounded number of outstanding
+// requests and a rate limit, so that an app can not make us open sockets
+// or goroutines without bound.
+
+package zedrouter
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/cast"
+	"github.com/zededa/go-provision/types"
+)
+
+const (
+	ntpPort            = 123
+	ntpPacketLen       = 48 // Without extension fields
+	ntpRelayTimeout    = 5 * time.Second
+	ntpRelayMaxPending = 64 // Outstanding requests per relay
+	ntpRelayRate       = 10 // Requests per second per relay, and burst
+)
+
+// The upstream for a network instance
+type serviceProxy struct {
+	uplink   string
+	bridgeIP net.IP
+	local    net.IP // IPv4 address of the uplink
+	dns      []net.IP
+	ntp      net.IP    // Nil if no NTP server
+	ntpRelay *ntpRelay // Nil if not relaying
+}
+
+// updateServiceProxies is called when the uplinks or the global config
+// change
+func updateServiceProxies(ctx *zedrouterContext) {
+	for _, status := range ctx.networkInstanceStatusMap {
+		updateServiceProxy(ctx, status)
+	}
+}
+
+// updateServiceProxy restarts dnsmasq and the NTP relay if the upstream
+// changed. Returns true if it did.
+func updateServiceProxy(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus) bool {
+
+	bridgeName := status.BridgeName
+	if bridgeName == "" {
+		return false
+	}
+	proxy := lookupServiceProxy(ctx, status)
+	old := ctx.serviceProxies[bridgeName]
+	if sameServiceProxy(old, proxy) {
+		return false
+	}
+	if proxy == nil {
+		log.Infof("updateServiceProxy(%s) disabled\n", status.DisplayName)
+	} else {
+		log.Infof("updateServiceProxy(%s) via %s DNS %v NTP %v\n",
+			status.DisplayName, proxy.uplink, proxy.dns, proxy.ntp)
+	}
+	hadRelay := old != nil && old.ntpRelay != nil
+	removeServiceProxy(ctx, status)
+	if proxy != nil {
+		if proxy.ntp != nil {
+			startNtpRelay(status, proxy)
+		}
+		ctx.serviceProxies[bridgeName] = proxy
+	}
+	if hadRelay != hasNtpRelay(ctx, bridgeName) {
+		updateServiceProxyACLs(ctx, bridgeName)
+	}
+	if status.BridgeIPAddr != "" {
+		restartDnsmasq(ctx, status)
+	}
+	return true
+}
+
+// removeServiceProxy stops the NTP relay. The caller restarts dnsmasq
+// if needed.
+func removeServiceProxy(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus) {
+
+	proxy := ctx.serviceProxies[status.BridgeName]
+	if proxy == nil {
+		return
+	}
+	if proxy.ntpRelay != nil {
+		proxy.ntpRelay.close()
+	}
+	delete(ctx.serviceProxies, status.BridgeName)
+}
+
+// hasNtpRelay tells whether the apps on the bridge use the bridge IP as
+// their NTP server, hence the ACLs need to allow it
+func hasNtpRelay(ctx *zedrouterContext, bridgeName string) bool {
+	proxy := ctx.serviceProxies[bridgeName]
+	return proxy != nil && proxy.ntpRelay != nil
+}
+
+// updateServiceProxyACLs reapplies the ACLs of the app interfaces on the
+// bridge to add or remove the NTP rules
+func updateServiceProxyACLs(ctx *zedrouterContext, bridgeName string) {
+	for _, st := range ctx.pubAppNetworkStatus.GetAll() {
+		status, err := cast.CastAppNetworkStatus(st)
+		if err != nil {
+			log.Errorf("updateServiceProxyACLs: %s\n", err)
+			continue
+		}
+		for _, ulStatus := range status.UnderlayNetworkList {
+			if ulStatus.Bridge != bridgeName || ulStatus.Vif == "" {
+				continue
+			}
+			err := updateACLConfiglet(ctx, bridgeName, ulStatus.Vif,
+				false, ulStatus.ACLs, ulStatus.ACLs,
+				ulStatus.BridgeIPAddr, ulStatus.AssignedIPAddr)
+			if err != nil {
+				log.Errorf("updateServiceProxyACLs(%s) %s: %s\n",
+					bridgeName, ulStatus.Vif, err)
+			}
+		}
+	}
+}
+
+// Determine the upstream servers; nil if the proxy does not apply
+func lookupServiceProxy(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus) *serviceProxy {
+
+	gc := types.GlobalConfigDefaults
+	if gcp := agentlog.GetGlobalConfig(ctx.subGlobalConfig); gcp != nil {
+		gc = types.ApplyGlobalConfig(*gcp)
+	}
+	if gc.LocalDnsNtpProxy != types.TS_ENABLED ||
+		status.Type != types.NetworkInstanceTypeLocal ||
+		!status.Activated || status.IsIPv6() ||
+		status.CurrentUplink == "" {
+		return nil
+	}
+	proxy := serviceProxy{uplink: status.CurrentUplink,
+		bridgeIP: net.ParseIP(status.BridgeIPAddr)}
+	count := types.CountLocalAddrAnyNoLinkLocalIf(*ctx.deviceNetworkStatus,
+		proxy.uplink)
+	for i := 0; i < count; i++ {
+		addr, err := types.GetLocalAddrAnyNoLinkLocal(*ctx.deviceNetworkStatus,
+			i, proxy.uplink)
+		if err == nil && addr.To4() != nil {
+			proxy.local = addr
+			break
+		}
+	}
+	if proxy.local == nil {
+		log.Warnf("lookupServiceProxy(%s) no IPv4 address on %s\n",
+			status.DisplayName, proxy.uplink)
+		return nil
+	}
+	// Servers configured for the network instance take precedence
+	// over the ones of the uplink
+	dns := status.DnsServers
+	ntp := status.NtpServer
+	port := ctx.deviceNetworkStatus.GetPortByIfName(proxy.uplink)
+	if port != nil {
+		if len(dns) == 0 {
+			dns = port.DnsServers
+		}
+		if ntp == nil || ntp.IsUnspecified() {
+			ntp = port.NtpServer
+		}
+	}
+	for _, ns := range dns {
+		if ns.To4() != nil {
+			proxy.dns = append(proxy.dns, ns)
+		}
+	}
+	if ntp != nil && ntp.To4() != nil && !ntp.IsUnspecified() {
+		proxy.ntp = ntp
+	}
+	return &proxy
+}
+
+func sameServiceProxy(a *serviceProxy, b *serviceProxy) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.uplink != b.uplink || !a.bridgeIP.Equal(b.bridgeIP) ||
+		!a.local.Equal(b.local) || !a.ntp.Equal(b.ntp) ||
+		len(a.dns) != len(b.dns) {
+		return false
+	}
+	for i := range a.dns {
+		if !a.dns[i].Equal(b.dns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen on the bridge IP and relay the requests to the NTP server from
+// the uplink address
+func startNtpRelay(status *types.NetworkInstanceStatus,
+	proxy *serviceProxy) {
+
+	relay, err := newNtpRelay(status.BridgeName,
+		&net.UDPAddr{IP: proxy.bridgeIP, Port: ntpPort}, proxy.local,
+		&net.UDPAddr{IP: proxy.ntp, Port: ntpPort})
+	if err != nil {
+		// Not advertized since ntpRelay is nil
+		log.Errorf("startNtpRelay(%s) failed: %s\n",
+			status.DisplayName, err)
+		return
+	}
+	proxy.ntpRelay = relay
+}
+
+// ntpRelay forwards the requests from the apps on one socket and the
+// replies from the server on another. A reply is matched to the request
+// by its origin timestamp, which the server copies from the transmit
+// timestamp of the request.
+type ntpRelay struct {
+	name     string
+	conn     *net.UDPConn // Listening for the apps
+	upstream *net.UDPConn // Connected to the server
+	done     chan struct{}
+
+	lock       sync.Mutex
+	pending    map[[8]byte]ntpPending
+	tokens     float64
+	lastRefill time.Time
+	dropped    uint64 // Requests over the limits
+}
+
+type ntpPending struct {
+	app     *net.UDPAddr
+	expires time.Time
+}
+
+func newNtpRelay(name string, listen *net.UDPAddr, local net.IP,
+	server *net.UDPAddr) (*ntpRelay, error) {
+
+	conn, err := net.ListenUDP("udp4", listen)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := net.DialUDP("udp4", &net.UDPAddr{IP: local}, server)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	relay := &ntpRelay{
+		name:       name,
+		conn:       conn,
+		upstream:   upstream,
+		done:       make(chan struct{}),
+		pending:    make(map[[8]byte]ntpPending),
+		tokens:     ntpRelayRate,
+		lastRefill: time.Now(),
+	}
+	go relay.fromApps()
+	go relay.fromServer()
+	return relay, nil
+}
+
+func (relay *ntpRelay) close() {
+	close(relay.done)
+	relay.conn.Close()
+	relay.upstream.Close()
+}
+
+func (relay *ntpRelay) fromApps() {
+	buf := make([]byte, 1500)
+	for {
+		n, app, err := relay.conn.ReadFromUDP(buf)
+		if err != nil {
+			// Closed by removeServiceProxy
+			log.Infof("ntpRelay(%s) done: %s\n", relay.name, err)
+			return
+		}
+		if n < ntpPacketLen {
+			continue
+		}
+		var key [8]byte
+		copy(key[:], buf[40:48])
+		if !relay.admit(key, app, time.Now()) {
+			continue
+		}
+		if _, err := relay.upstream.Write(buf[:n]); err != nil {
+			log.Debugf("ntpRelay(%s) to server failed: %s\n",
+				relay.name, err)
+		}
+	}
+}
+
+func (relay *ntpRelay) fromServer() {
+	buf := make([]byte, 1500)
+	for {
+		n, err := relay.upstream.Read(buf)
+		if err != nil {
+			select {
+			case <-relay.done:
+				return
+			default:
+			}
+			// E.g., ICMP port unreachable from the server
+			log.Debugf("ntpRelay(%s) from server failed: %s\n",
+				relay.name, err)
+			continue
+		}
+		if n < ntpPacketLen {
+			continue
+		}
+		var key [8]byte
+		copy(key[:], buf[24:32])
+		app := relay.match(key, time.Now())
+		if app == nil {
+			continue
+		}
+		if _, err := relay.conn.WriteToUDP(buf[:n], app); err != nil {
+			log.Debugf("ntpRelay(%s) to %s failed: %s\n",
+				relay.name, app, err)
+		}
+	}
+}
+
+// admit records the request unless the rate or the number of outstanding
+// requests is exceeded
+func (relay *ntpRelay) admit(key [8]byte, app *net.UDPAddr,
+	now time.Time) bool {
+
+	relay.lock.Lock()
+	defer relay.lock.Unlock()
+	relay.tokens += now.Sub(relay.lastRefill).Seconds() * ntpRelayRate
+	if relay.tokens > ntpRelayRate {
+		relay.tokens = ntpRelayRate
+	}
+	relay.lastRefill = now
+	for k, p := range relay.pending {
+		if now.After(p.expires) {
+			delete(relay.pending, k)
+		}
+	}
+	if relay.tokens < 1 || len(relay.pending) >= ntpRelayMaxPending {
+		relay.dropped++
+		if relay.dropped%100 == 1 {
+			log.Warnf("ntpRelay(%s) dropped %d requests\n",
+				relay.name, relay.dropped)
+		}
+		return false
+	}
+	relay.tokens--
+	relay.pending[key] = ntpPending{app: app,
+		expires: now.Add(ntpRelayTimeout)}
+	return true
+}
+
+// match returns the app which sent the request for the reply, if any
+func (relay *ntpRelay) match(key [8]byte, now time.Time) *net.UDPAddr {
+	relay.lock.Lock()
+	defer relay.lock.Unlock()
+	p, ok := relay.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(relay.pending, key)
+	if now.After(p.expires) {
+		return nil
+	}
+	return p.app
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A server which answers with the transmit timestamp of the request as
+// the origin timestamp
+func startTestNtpServer(t *testing.T) *net.UDPConn {
+	server, err := net.ListenUDP("udp4",
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %s\n", err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := server.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			reply := make([]byte, n)
+			copy(reply[24:32], buf[40:48])
+			server.WriteToUDP(reply, from)
+		}
+	}()
+	return server
+}
+
+func TestNtpRelay(t *testing.T) {
+	server := startTestNtpServer(t)
+	defer server.Close()
+	localhost := net.ParseIP("127.0.0.1")
+	relay, err := newNtpRelay("test", &net.UDPAddr{IP: localhost},
+		localhost, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("newNtpRelay failed: %s\n", err)
+	}
+	defer relay.close()
+
+	app, err := net.DialUDP("udp4", nil,
+		relay.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP failed: %s\n", err)
+	}
+	defer app.Close()
+	app.SetDeadline(time.Now().Add(5 * time.Second))
+	for i := byte(1); i <= 3; i++ {
+		req := make([]byte, ntpPacketLen)
+		req[0] = 0x23 // Version 4, client
+		req[47] = i
+		if _, err := app.Write(req); err != nil {
+			t.Fatalf("Write failed: %s\n", err)
+		}
+		reply := make([]byte, 1500)
+		n, err := app.Read(reply)
+		if err != nil {
+			t.Fatalf("Read failed: %s\n", err)
+		}
+		if n != ntpPacketLen || !bytes.Equal(reply[24:32], req[40:48]) {
+			t.Errorf("Request %d got %v\n", i, reply[:n])
+		}
+	}
+}
+
+func TestNtpRelayLimits(t *testing.T) {
+	now := time.Now()
+	relay := &ntpRelay{name: "test", pending: make(map[[8]byte]ntpPending),
+		tokens: ntpRelayRate, lastRefill: now}
+	app := &net.UDPAddr{IP: net.ParseIP("10.1.0.2"), Port: 1234}
+	key := func(i int) [8]byte {
+		return [8]byte{byte(i >> 8), byte(i)}
+	}
+
+	// A burst is limited to the rate
+	admitted := 0
+	for i := 0; i < 2*ntpRelayRate; i++ {
+		if relay.admit(key(i), app, now) {
+			admitted++
+		}
+	}
+	if admitted != ntpRelayRate || relay.dropped != ntpRelayRate {
+		t.Errorf("Burst admitted %d dropped %d\n", admitted, relay.dropped)
+	}
+	// Refilled after a second
+	now = now.Add(time.Second)
+	if !relay.admit(key(100), app, now) {
+		t.Errorf("Not admitted after refill\n")
+	}
+
+	// The number of outstanding requests is bounded
+	relay.tokens = 1000
+	for i := 0; i < 2*ntpRelayMaxPending; i++ {
+		relay.admit(key(200+i), app, now)
+		relay.tokens = 1000
+	}
+	if len(relay.pending) != ntpRelayMaxPending {
+		t.Errorf("Pending %d\n", len(relay.pending))
+	}
+
+	// A reply matches once, and not after the timeout
+	if relay.match(key(0), now) != app {
+		t.Errorf("Reply not matched\n")
+	}
+	if relay.match(key(0), now) != nil {
+		t.Errorf("Reply matched twice\n")
+	}
+	if relay.match(key(1), now.Add(2*ntpRelayTimeout)) != nil {
+		t.Errorf("Expired reply matched\n")
+	}
+	if relay.match(key(9999), now) != nil {
+		t.Errorf("Unsolicited reply matched\n")
+	}
+	// Expired requests are purged
+	relay.admit(key(9000), app, now.Add(2*ntpRelayTimeout))
+	if len(relay.pending) != 1 {
+		t.Errorf("Pending %d after expiry\n", len(relay.pending))
+	}
+}
+
+// The apps can only reach the relay if the ACLs allow it
+func TestNtpRelayACL(t *testing.T) {
+	hasNtp := func(ntpRelay bool) bool {
+		rules, err := aclToRules("bn1", "nbu1x1", nil, 4, "10.1.0.1",
+			"10.1.0.2", ntpRelay)
+		if err != nil {
+			t.Fatalf("aclToRules failed: %s\n", err)
+		}
+		found := false
+		for _, rule := range rules {
+			str := strings.Join(rule, " ")
+			if strings.Contains(str, "-d 10.1.0.1 -p udp --dport ntp -j ACCEPT") {
+				found = true
+			}
+		}
+		return found
+	}
+	if !hasNtp(true) {
+		t.Errorf("No NTP rule with the relay\n")
+	}
+	if hasNtp(false) {
+		t.Errorf("NTP rule without the relay\n")
+	}
+}
+
+func TestSameServiceProxy(t *testing.T) {
+	a := &serviceProxy{uplink: "eth0", bridgeIP: net.ParseIP("10.1.0.1"),
+		local: net.ParseIP("192.168.1.2"),
+		dns:   []net.IP{net.ParseIP("192.168.1.1")}}
+	b := *a
+	if !sameServiceProxy(a, &b) || !sameServiceProxy(nil, nil) ||
+		sameServiceProxy(a, nil) {
+		t.Errorf("Equal proxies differ\n")
+	}
+	b.bridgeIP = net.ParseIP("10.2.0.1")
+	if sameServiceProxy(a, &b) {
+		t.Errorf("Bridge IP change not detected\n")
+	}
+	b = *a
+	b.ntp = net.ParseIP("192.168.1.1")
+	if sameServiceProxy(a, &b) {
+		t.Errorf("NTP change not detected\n")
+	}
+}
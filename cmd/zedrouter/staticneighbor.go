@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Static ARP/ND entries on the bridge of a network instance for devices
+// which do not answer ARP/ND reliably. The entries are permanent hence
+// never age out, and we put them back if they are flushed or replaced,
+// e.g., when the bridge is recreated.
+
+package zedrouter
+
+import (
+	"github.com/eriknordmark/netlink"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+// applyStaticNeighbors installs the StaticNeighbors of the network
+// instance on its bridge and removes the ones no longer configured
+func applyStaticNeighbors(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus) {
+
+	bridgeName := status.BridgeName
+	if bridgeName == "" {
+		return
+	}
+	for _, old := range ctx.staticNeighbors[bridgeName] {
+		if findStaticNeighbor(status.StaticNeighbors, old) == nil {
+			delStaticNeighbor(bridgeName, old)
+		}
+	}
+	if len(status.StaticNeighbors) == 0 {
+		delete(ctx.staticNeighbors, bridgeName)
+		return
+	}
+	ctx.staticNeighbors[bridgeName] = status.StaticNeighbors
+	reconcileStaticNeighbors(bridgeName, status.StaticNeighbors)
+}
+
+// removeStaticNeighbors is called when the network instance is
+// inactivated
+func removeStaticNeighbors(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus) {
+
+	bridgeName := status.BridgeName
+	for _, n := range ctx.staticNeighbors[bridgeName] {
+		delStaticNeighbor(bridgeName, n)
+	}
+	delete(ctx.staticNeighbors, bridgeName)
+}
+
+// reconcileAllStaticNeighbors is called periodically and on link changes
+func reconcileAllStaticNeighbors(ctx *zedrouterContext) {
+	for bridgeName, neighbors := range ctx.staticNeighbors {
+		reconcileStaticNeighbors(bridgeName, neighbors)
+	}
+}
+
+// Set the entries which are missing or differ from the config
+func reconcileStaticNeighbors(bridgeName string,
+	neighbors []types.StaticNeighbor) {
+
+	ifindex, err := devicenetwork.IfnameToIndex(bridgeName)
+	if err != nil {
+		log.Debugf("reconcileStaticNeighbors(%s): %s\n", bridgeName, err)
+		return
+	}
+	current, err := netlink.NeighList(ifindex, 0)
+	if err != nil {
+		log.Errorf("reconcileStaticNeighbors(%s) NeighList failed: %s\n",
+			bridgeName, err)
+		return
+	}
+	permanent := getNeighStatePermanent()
+	for _, n := range neighbors {
+		present := false
+		for _, c := range current {
+			if c.IP.Equal(n.IP) &&
+				c.HardwareAddr.String() == n.Mac.String() &&
+				c.State&permanent != 0 {
+				present = true
+				break
+			}
+		}
+		if present {
+			continue
+		}
+		log.Infof("reconcileStaticNeighbors(%s) setting %s %s\n",
+			bridgeName, n.IP, n.Mac)
+		neigh := netlink.Neigh{LinkIndex: ifindex, State: permanent,
+			IP: n.IP, HardwareAddr: n.Mac}
+		if err := netlink.NeighSet(&neigh); err != nil {
+			log.Errorf("reconcileStaticNeighbors(%s) NeighSet %s %s failed: %s\n",
+				bridgeName, n.IP, n.Mac, err)
+		}
+	}
+}
+
+func delStaticNeighbor(bridgeName string, n types.StaticNeighbor) {
+	ifindex, err := devicenetwork.IfnameToIndex(bridgeName)
+	if err != nil {
+		// Bridge is gone and so is the entry
+		return
+	}
+	log.Infof("delStaticNeighbor(%s) %s %s\n", bridgeName, n.IP, n.Mac)
+	neigh := netlink.Neigh{LinkIndex: ifindex, IP: n.IP}
+	if err := netlink.NeighDel(&neigh); err != nil {
+		log.Warnf("delStaticNeighbor(%s) %s failed: %s\n",
+			bridgeName, n.IP, err)
+	}
+}
+
+// Returns the entry with the same IP and MAC, if any
+func findStaticNeighbor(neighbors []types.StaticNeighbor,
+	n types.StaticNeighbor) *types.StaticNeighbor {
+
+	for i := range neighbors {
+		if neighbors[i].IP.Equal(n.IP) &&
+			neighbors[i].Mac.String() == n.Mac.String() {
+			return &neighbors[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+	"github.com/zededa/go-provision/types"
+)
+
+// Returns the permanent entries on ifindex as IP to MAC
+func permanentNeighbors(t *testing.T, ifindex int) map[string]string {
+	neighs, err := netlink.NeighList(ifindex, 0)
+	if err != nil {
+		t.Fatalf("NeighList failed: %s", err)
+	}
+	result := make(map[string]string)
+	for _, n := range neighs {
+		if n.State&netlink.NUD_PERMANENT != 0 {
+			result[n.IP.String()] = n.HardwareAddr.String()
+		}
+	}
+	return result
+}
+
+func TestStaticNeighbors(t *testing.T) {
+	tn := newTestNetns(t)
+	defer tn.close()
+
+	ifindex := tn.addVeth("bn1", "bn1peer", "10.1.0.1/24")
+	mac1, _ := net.ParseMAC("00:16:3e:00:01:02")
+	mac2, _ := net.ParseMAC("00:16:3e:00:01:03")
+	plc1 := types.StaticNeighbor{IP: net.ParseIP("10.1.0.20"), Mac: mac1}
+	plc2 := types.StaticNeighbor{IP: net.ParseIP("10.1.0.21"), Mac: mac2}
+
+	ctx := &zedrouterContext{
+		staticNeighbors: make(map[string][]types.StaticNeighbor),
+	}
+	status := &types.NetworkInstanceStatus{}
+	status.BridgeName = "bn1"
+	status.StaticNeighbors = []types.StaticNeighbor{plc1, plc2}
+	applyStaticNeighbors(ctx, status)
+	neighs := permanentNeighbors(t, ifindex)
+	if neighs["10.1.0.20"] != mac1.String() ||
+		neighs["10.1.0.21"] != mac2.String() {
+		t.Errorf("Static neighbors not installed: %v", neighs)
+	}
+
+	// Put back when removed by someone else
+	neigh := netlink.Neigh{LinkIndex: ifindex, IP: plc1.IP}
+	if err := netlink.NeighDel(&neigh); err != nil {
+		t.Fatalf("NeighDel failed: %s", err)
+	}
+	reconcileAllStaticNeighbors(ctx)
+	neighs = permanentNeighbors(t, ifindex)
+	if neighs["10.1.0.20"] != mac1.String() {
+		t.Errorf("Static neighbor not put back: %v", neighs)
+	}
+
+	// Dropped from the config
+	status.StaticNeighbors = []types.StaticNeighbor{plc1}
+	applyStaticNeighbors(ctx, status)
+	neighs = permanentNeighbors(t, ifindex)
+	if _, ok := neighs["10.1.0.21"]; ok {
+		t.Errorf("Static neighbor not removed: %v", neighs)
+	}
+	if neighs["10.1.0.20"] != mac1.String() {
+		t.Errorf("Static neighbor removed: %v", neighs)
+	}
+
+	removeStaticNeighbors(ctx, status)
+	if neighs := permanentNeighbors(t, ifindex); len(neighs) != 0 {
+		t.Errorf("Static neighbors left: %v", neighs)
+	}
+	if len(ctx.staticNeighbors) != 0 {
+		t.Errorf("Static neighbors still tracked: %v", ctx.staticNeighbors)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Track which uplink the NAT traffic of each local network instance uses,
+// i.e., the port with the preferred default route in the table of the
+// bridge, and tell the apps when it changes since their NATed sessions
+// will not survive the move.
+
+package zedrouter
+
+import (
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/agentlog"
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/types"
+)
+
+// Replaced by the tests
+var ifnameToIndex = devicenetwork.IfnameToIndex
+var ifindexToName = devicenetwork.IfindexToName
+var tableDefaultRouteIfindex = getTableDefaultRouteIfindex
+
+// checkNetworkInstanceUplinks is called on route and link changes
+func checkNetworkInstanceUplinks(ctx *zedrouterContext) {
+	for _, status := range ctx.networkInstanceStatusMap {
+		if status.Type != types.NetworkInstanceTypeLocal ||
+			!status.Activated {
+			continue
+		}
+		bridgeIfindex, err := ifnameToIndex(status.BridgeName)
+		if err != nil {
+			continue
+		}
+		uplink := ""
+		ifindex := tableDefaultRouteIfindex(FreeTable + bridgeIfindex)
+		if ifindex != 0 {
+			uplink, _, _ = ifindexToName(ifindex)
+		}
+		if uplink == status.CurrentUplink {
+			continue
+		}
+		oldUplink := status.CurrentUplink
+		status.CurrentUplink = uplink
+		publishNetworkInstanceStatus(ctx, status)
+		if oldUplink == "" || uplink == "" {
+			// Initial or no uplink; nothing to re-establish yet
+			log.Infof("checkNetworkInstanceUplinks(%s) uplink %q to %q\n",
+				status.DisplayName, oldUplink, uplink)
+			continue
+		}
+		log.Warnf("checkNetworkInstanceUplinks(%s) uplink changed from %s to %s\n",
+			status.DisplayName, oldUplink, uplink)
+		notifyUplinkChange(ctx, status, oldUplink)
+	}
+	updateServiceProxies(ctx)
+}
+
+func notifyUplinkChange(ctx *zedrouterContext,
+	status *types.NetworkInstanceStatus, oldUplink string) {
+
+	gc := types.GlobalConfigDefaults
+	if gcp := agentlog.GetGlobalConfig(ctx.subGlobalConfig); gcp != nil {
+		gc = types.ApplyGlobalConfig(*gcp)
+	}
+	switch gc.UplinkChangeNotify {
+	case types.UCN_FORCERENEW:
+		serverIP := net.ParseIP(status.BridgeIPAddr)
+		if serverIP == nil || serverIP.To4() == nil {
+			log.Warnf("notifyUplinkChange(%s) no IPv4 bridge address for FORCERENEW\n",
+				status.DisplayName)
+			return
+		}
+		for _, vif := range status.Vifs {
+			mac, err := net.ParseMAC(vif.MacAddr)
+			if err != nil {
+				continue
+			}
+			appIP, ok := status.IPAssignments[vif.MacAddr]
+			if !ok {
+				continue
+			}
+			key, err := readForceRenewKey(status.BridgeName, vif.MacAddr)
+			if err != nil {
+				log.Errorf("notifyUplinkChange(%s) no FORCERENEW key for %s: %s\n",
+					status.DisplayName, mac, err)
+				continue
+			}
+			err = sendForceRenew(serverIP, appIP, mac, key)
+			if err != nil {
+				log.Errorf("notifyUplinkChange(%s) FORCERENEW to %s failed: %s\n",
+					status.DisplayName, appIP, err)
+			}
+		}
+	case types.UCN_RA:
+		if !status.IsIPv6() {
+			log.Warnf("notifyUplinkChange(%s) not IPv6 hence no RA\n",
+				status.DisplayName)
+			return
+		}
+		// The old radvd deprecates the prefix as it stops, and the
+		// new one advertises it again
+		restartRadvdWithNewConfig(status.BridgeName, radvdPrefix(status))
+	case types.UCN_EVENT:
+		now := time.Now()
+		for _, vif := range status.Vifs {
+			event := types.AppNetworkEvent{
+				AppUUID:         vif.AppID,
+				NetworkInstance: status.UUID,
+				OldUplink:       oldUplink,
+				NewUplink:       status.CurrentUplink,
+				Time:            now,
+			}
+			ctx.pubAppNetworkEvent.Publish(event.Key(), event)
+		}
+	}
+}
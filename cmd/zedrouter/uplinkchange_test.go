@@ -0,0 +1,143 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/zededa/go-provision/devicenetwork"
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+)
+
+// The default route of the table of bridge bn1 (ifindex 10) is on the
+// interface in route
+func fakeUplinkRoutes(route *int) func() {
+	ifnameToIndex = func(ifname string) (int, error) {
+		if ifname != "bn1" {
+			return 0, errors.New("no such interface")
+		}
+		return 10, nil
+	}
+	ifindexToName = func(index int) (string, string, error) {
+		switch index {
+		case 2:
+			return "eth0", "device", nil
+		case 3:
+			return "eth1", "device", nil
+		}
+		return "", "", errors.New("no such index")
+	}
+	tableDefaultRouteIfindex = func(table int) int {
+		if table != FreeTable+10 {
+			return 0
+		}
+		return *route
+	}
+	return func() {
+		ifnameToIndex = devicenetwork.IfnameToIndex
+		ifindexToName = devicenetwork.IfindexToName
+		tableDefaultRouteIfindex = getTableDefaultRouteIfindex
+	}
+}
+
+func TestCheckNetworkInstanceUplinks(t *testing.T) {
+	route := 2
+	defer fakeUplinkRoutes(&route)()
+
+	pubGlobalConfig, err := pubsub.PublishInMemory("uplinktest",
+		types.GlobalConfig{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	gc := types.GlobalConfigDefaults
+	gc.UplinkChangeNotify = types.UCN_EVENT
+	pubGlobalConfig.Publish("global", gc)
+	subGlobalConfig, err := pubsub.SubscribeInMemory("uplinktest",
+		types.GlobalConfig{}, true, nil)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	subGlobalConfig.ProcessPending()
+	pubNetworkInstanceStatus, err := pubsub.PublishInMemory("uplinktest",
+		types.NetworkInstanceStatus{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pubAppNetworkEvent, err := pubsub.PublishInMemory("uplinktest",
+		types.AppNetworkEvent{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+
+	niID, _ := uuid.NewV4()
+	appID, _ := uuid.NewV4()
+	local := &types.NetworkInstanceStatus{}
+	local.UUID = niID
+	local.Type = types.NetworkInstanceTypeLocal
+	local.Activated = true
+	local.BridgeName = "bn1"
+	local.Vifs = []types.VifNameMac{{Name: "nbu1x1",
+		MacAddr: "00:16:3e:00:01:02", AppID: appID}}
+	switched := &types.NetworkInstanceStatus{}
+	switched.UUID, _ = uuid.NewV4()
+	switched.Type = types.NetworkInstanceTypeSwitch
+	switched.Activated = true
+	switched.BridgeName = "bn1"
+	ctx := zedrouterContext{
+		subGlobalConfig:          subGlobalConfig,
+		pubNetworkInstanceStatus: pubNetworkInstanceStatus,
+		pubAppNetworkEvent:       pubAppNetworkEvent,
+		networkInstanceStatusMap: map[uuid.UUID]*types.NetworkInstanceStatus{
+			local.UUID: local, switched.UUID: switched},
+		serviceProxies: make(map[string]*serviceProxy),
+	}
+	events := func() []types.AppNetworkEvent {
+		var events []types.AppNetworkEvent
+		for _, item := range pubAppNetworkEvent.GetAll() {
+			var event types.AppNetworkEvent
+			b, _ := json.Marshal(item)
+			if err := json.Unmarshal(b, &event); err != nil {
+				t.Fatalf("Unmarshal failed: %s\n", err)
+			}
+			events = append(events, event)
+		}
+		return events
+	}
+
+	// The initial uplink is not a change
+	checkNetworkInstanceUplinks(&ctx)
+	if local.CurrentUplink != "eth0" || switched.CurrentUplink != "" {
+		t.Errorf("Got uplinks %q %q\n", local.CurrentUplink,
+			switched.CurrentUplink)
+	}
+	if len(events()) != 0 {
+		t.Errorf("Events for the initial uplink: %v\n", events())
+	}
+	if _, err := pubNetworkInstanceStatus.Get(local.Key()); err != nil {
+		t.Errorf("Status not published: %s\n", err)
+	}
+
+	// Failover
+	route = 3
+	checkNetworkInstanceUplinks(&ctx)
+	got := events()
+	if local.CurrentUplink != "eth1" || len(got) != 1 ||
+		got[0].AppUUID != appID || got[0].NetworkInstance != niID ||
+		got[0].OldUplink != "eth0" || got[0].NewUplink != "eth1" {
+		t.Errorf("Failover got %s events %+v\n", local.CurrentUplink, got)
+	}
+
+	// No route hence no uplink, and no event
+	pubAppNetworkEvent.Unpublish(got[0].Key())
+	route = 0
+	checkNetworkInstanceUplinks(&ctx)
+	if local.CurrentUplink != "" || len(events()) != 0 {
+		t.Errorf("No route got %q events %v\n", local.CurrentUplink,
+			events())
+	}
+}
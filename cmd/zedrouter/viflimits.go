@@ -0,0 +1,153 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Bandwidth and connection limits per vif. The bandwidth is shaped with
+// tc once the vif exists; towards the app with a tbf qdisc and from the
+// app with an ingress policer. The connections are limited with an
+// iptables connlimit rule which counts the flows in the conntrack zone
+// of the bridge.
+
+package zedrouter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/eriknordmark/netlink"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/iptables"
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/wrap"
+)
+
+// Limits for each vif with limits; applied when the vif appears
+var vifLimits = make(map[string]types.VifLimits)
+
+// Allow bursts of this many bytes above the rate
+const vifBurstBytes = 32 * 1024
+
+func vifLimitsOwner(vifName string) string {
+	return "limit-" + vifName
+}
+
+// setVifLimits records and applies the limits; zero limits remove any
+// previous ones
+func setVifLimits(bridgeName string, vifName string,
+	limits types.VifLimits) error {
+
+	log.Infof("setVifLimits(%s, %s, %+v)\n", bridgeName, vifName, limits)
+	if vifName == "" {
+		return nil
+	}
+	if limits == (types.VifLimits{}) {
+		deleteVifLimits(vifName)
+		return nil
+	}
+	vifLimits[vifName] = limits
+	if err := setConnectionLimit(vifName, limits.MaxConnections); err != nil {
+		return err
+	}
+	return applyVifBandwidth(vifName)
+}
+
+func deleteVifLimits(vifName string) {
+	if _, ok := vifLimits[vifName]; !ok {
+		return
+	}
+	log.Infof("deleteVifLimits(%s)\n", vifName)
+	delete(vifLimits, vifName)
+	if err := iptables.DeleteRules(vifLimitsOwner(vifName)); err != nil {
+		log.Errorf("deleteVifLimits(%s) failed: %s\n", vifName, err)
+	}
+	clearVifBandwidth(vifName)
+}
+
+// maybeApplyVifLimits is called when a link appears since the vif is
+// created after the limits are set
+func maybeApplyVifLimits(ifname string) {
+	if _, ok := vifLimits[ifname]; !ok {
+		return
+	}
+	if err := applyVifBandwidth(ifname); err != nil {
+		log.Errorf("maybeApplyVifLimits(%s) failed: %s\n", ifname, err)
+	}
+}
+
+// setConnectionLimit rejects new flows from the app above max
+func setConnectionLimit(vifName string, max uint32) error {
+	set := iptables.RuleSet{Owner: vifLimitsOwner(vifName)}
+	if max != 0 {
+		rule := connectionLimitRule(vifName, max)
+		set.IPv4 = []iptables.Rule{rule}
+		set.IPv6 = []iptables.Rule{rule}
+	}
+	return iptables.SetRules(set)
+}
+
+func connectionLimitRule(vifName string, max uint32) iptables.Rule {
+	// We append a '+' to the vifname as in aclRule. A zero mask
+	// counts all the flows from the vif together.
+	return iptables.Rule{Chain: iptables.EveForwardChain,
+		Args: []string{"-m", "physdev", "--physdev-in", vifName + "+",
+			"-m", "conntrack", "--ctstate", "NEW",
+			"-m", "connlimit", "--connlimit-above",
+			strconv.FormatUint(uint64(max), 10),
+			"--connlimit-mask", "0", "-j", "REJECT"}}
+}
+
+// applyVifBandwidth sets the qdiscs if the vif exists
+func applyVifBandwidth(vifName string) error {
+	if _, err := netlink.LinkByName(vifName); err != nil {
+		log.Infof("applyVifBandwidth(%s): not yet created\n", vifName)
+		return nil
+	}
+	clearVifBandwidth(vifName)
+	for _, args := range vifBandwidthCmds(vifName, vifLimits[vifName]) {
+		if err := tcCmd(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vifBandwidthCmds returns the tc commands for the limits
+func vifBandwidthCmds(vifName string, limits types.VifLimits) [][]string {
+	var cmds [][]string
+	burst := strconv.Itoa(vifBurstBytes)
+	if limits.RxBandwidth != 0 {
+		rate := strconv.FormatUint(limits.RxBandwidth, 10) + "bit"
+		cmds = append(cmds, []string{"qdisc", "replace", "dev", vifName,
+			"root", "tbf", "rate", rate, "burst", burst,
+			"latency", "50ms"})
+	}
+	if limits.TxBandwidth != 0 {
+		rate := strconv.FormatUint(limits.TxBandwidth, 10) + "bit"
+		cmds = append(cmds, []string{"qdisc", "replace", "dev", vifName,
+			"handle", "ffff:", "ingress"})
+		cmds = append(cmds, []string{"filter", "replace", "dev", vifName,
+			"parent", "ffff:", "protocol", "all", "prio", "1",
+			"u32", "match", "u32", "0", "0",
+			"police", "rate", rate, "burst", burst, "drop",
+			"flowid", ":1"})
+	}
+	return cmds
+}
+
+// clearVifBandwidth removes the qdiscs; fails if there are none
+func clearVifBandwidth(vifName string) {
+	tcCmd("qdisc", "del", "dev", vifName, "root")
+	tcCmd("qdisc", "del", "dev", vifName, "ingress")
+}
+
+func tcCmd(args ...string) error {
+	log.Debugf("Calling command tc %v\n", args)
+	out, err := wrap.Command("tc", args...).CombinedOutput()
+	if err != nil {
+		errStr := fmt.Sprintf("tc %v failed: %s: %s",
+			args, err, string(out))
+		log.Debugln(errStr)
+		return errors.New(errStr)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedrouter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestVifBandwidthCmds(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   types.VifLimits
+		expected []string
+	}{
+		{"none", types.VifLimits{MaxConnections: 10}, nil},
+		{"rx", types.VifLimits{RxBandwidth: 1000000}, []string{
+			"qdisc replace dev nbu1x1 root tbf rate 1000000bit burst 32768 latency 50ms",
+		}},
+		{"tx", types.VifLimits{TxBandwidth: 2000000}, []string{
+			"qdisc replace dev nbu1x1 handle ffff: ingress",
+			"filter replace dev nbu1x1 parent ffff: protocol all prio 1 u32 match u32 0 0 police rate 2000000bit burst 32768 drop flowid :1",
+		}},
+		{"both", types.VifLimits{RxBandwidth: 1000000,
+			TxBandwidth: 2000000}, []string{
+			"qdisc replace dev nbu1x1 root tbf rate 1000000bit burst 32768 latency 50ms",
+			"qdisc replace dev nbu1x1 handle ffff: ingress",
+			"filter replace dev nbu1x1 parent ffff: protocol all prio 1 u32 match u32 0 0 police rate 2000000bit burst 32768 drop flowid :1",
+		}},
+	}
+	for _, test := range tests {
+		var cmds []string
+		for _, args := range vifBandwidthCmds("nbu1x1", test.limits) {
+			cmds = append(cmds, strings.Join(args, " "))
+		}
+		if !reflect.DeepEqual(cmds, test.expected) {
+			t.Errorf("%s: got %q\n", test.name, cmds)
+		}
+	}
+}
+
+func TestConnectionLimitRule(t *testing.T) {
+	rule := connectionLimitRule("nbu1x1", 100)
+	expected := "-m physdev --physdev-in nbu1x1+ -m conntrack --ctstate NEW -m connlimit --connlimit-above 100 --connlimit-mask 0 -j REJECT"
+	if args := strings.Join(rule.Args, " "); args != expected {
+		t.Errorf("Got %s\n", args)
+	}
+}
@@ -77,6 +77,14 @@ type zedrouterContext struct {
 	pubNetworkInstanceStatus  *pubsub.Publication
 	pubNetworkInstanceMetrics *pubsub.Publication
 	networkInstanceStatusMap  map[uuid.UUID]*types.NetworkInstanceStatus
+	serviceProxies            map[string]*serviceProxy          // By bridge name
+	staticNeighbors           map[string][]types.StaticNeighbor // Installed, by bridge name
+
+	pubFlowCountMetrics *pubsub.Publication
+	pubConntrackStatus  *pubsub.Publication
+	conntrackStatus     types.ConntrackStatus
+	pubFirewallStatus   *pubsub.Publication
+	pubAppNetworkEvent  *pubsub.Publication
 }
 
 var debug = false
@@ -143,13 +151,15 @@ func Run() {
 	}
 	zedrouterCtx.networkInstanceStatusMap =
 		make(map[uuid.UUID]*types.NetworkInstanceStatus)
+	zedrouterCtx.serviceProxies = make(map[string]*serviceProxy)
+	zedrouterCtx.staticNeighbors = make(map[string][]types.StaticNeighbor)
 
 	subDeviceNetworkStatus, err := pubsub.Subscribe("nim",
 		types.DeviceNetworkStatus{}, false, &zedrouterCtx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	subDeviceNetworkStatus.ModifyHandler = handleDNSModify
+	subDeviceNetworkStatus.ModifyDiffHandler = handleDNSModify
 	subDeviceNetworkStatus.DeleteHandler = handleDNSDelete
 	zedrouterCtx.subDeviceNetworkStatus = subDeviceNetworkStatus
 	subDeviceNetworkStatus.Activate()
@@ -232,6 +242,34 @@ func Run() {
 	}
 	zedrouterCtx.pubNetworkInstanceMetrics = pubNetworkInstanceMetrics
 
+	pubFlowCountMetrics, err := pubsub.Publish(agentName,
+		types.FlowCountMetrics{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedrouterCtx.pubFlowCountMetrics = pubFlowCountMetrics
+
+	pubConntrackStatus, err := pubsub.Publish(agentName,
+		types.ConntrackStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedrouterCtx.pubConntrackStatus = pubConntrackStatus
+
+	pubFirewallStatus, err := pubsub.Publish(agentName,
+		types.FirewallStatus{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedrouterCtx.pubFirewallStatus = pubFirewallStatus
+
+	pubAppNetworkEvent, err := pubsub.Publish(agentName,
+		types.AppNetworkEvent{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	zedrouterCtx.pubAppNetworkEvent = pubAppNetworkEvent
+
 	appNumAllocatorInit(&zedrouterCtx)
 	bridgeNumAllocatorInit(&zedrouterCtx)
 	handleInit(runDirname)
@@ -345,6 +383,13 @@ func Run() {
 	publishTimer := flextimer.NewRangeTicker(time.Duration(min),
 		time.Duration(max))
 
+	// Publish the conntrack flow counts every minute
+	flowInterval := time.Duration(time.Minute)
+	flowMax := float64(flowInterval)
+	flowMin := flowMax * 0.3
+	flowTimer := flextimer.NewRangeTicker(time.Duration(flowMin),
+		time.Duration(flowMax))
+
 	updateLispConfiglets(&zedrouterCtx, zedrouterCtx.legacyDataPlane)
 
 	setFreeMgmtPorts(types.GetMgmtPortsFree(*zedrouterCtx.deviceNetworkStatus, 0))
@@ -420,6 +465,11 @@ func Run() {
 			}
 			ifname := PbrLinkChange(zedrouterCtx.deviceNetworkStatus,
 				change)
+			if ifname != "" {
+				maybeApplyVifLimits(ifname)
+				checkNetworkInstanceUplinks(&zedrouterCtx)
+				reconcileAllStaticNeighbors(&zedrouterCtx)
+			}
 			if ifname != "" &&
 				!types.IsMgmtPort(*zedrouterCtx.deviceNetworkStatus,
 					ifname) {
@@ -437,6 +487,7 @@ func Run() {
 				break
 			}
 			PbrRouteChange(zedrouterCtx.deviceNetworkStatus, change)
+			checkNetworkInstanceUplinks(&zedrouterCtx)
 
 		case <-publishTimer.C:
 			log.Debugln("publishTimer at", time.Now())
@@ -447,6 +498,16 @@ func Run() {
 			}
 			publishNetworkServiceStatusAll(&zedrouterCtx)
 			publishNetworkInstanceMetricsAll(&zedrouterCtx)
+			publishConntrackStatus(&zedrouterCtx)
+			// Restore any of our rules flushed by others
+			iptables.ReconcileAll()
+			reconcileAllStaticNeighbors(&zedrouterCtx)
+			status := iptables.FirewallStatus(agentName)
+			zedrouterCtx.pubFirewallStatus.Publish(status.Key(), status)
+
+		case <-flowTimer.C:
+			log.Debugln("flowTimer at", time.Now())
+			publishFlowCountMetricsAll(&zedrouterCtx)
 
 		case change := <-subNetworkObjectConfig.C:
 			subNetworkObjectConfig.ProcessChange(change)
@@ -663,7 +724,11 @@ func updateLispConfiglets(ctx *zedrouterContext, legacyDataPlane bool) {
 	pub := ctx.pubAppNetworkStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastAppNetworkStatus(st)
+		status, err := cast.CastAppNetworkStatus(st)
+		if err != nil {
+			log.Errorf("updateLispConfiglets: %s\n", err)
+			continue
+		}
 		for i, olStatus := range status.OverlayNetworkList {
 			olNum := i + 1
 			var olIfname string
@@ -708,7 +773,11 @@ func updateLispConfiglets(ctx *zedrouterContext, legacyDataPlane bool) {
 func handleAppNetworkConfigModify(ctxArg interface{}, key string, configArg interface{}) {
 
 	ctx := ctxArg.(*zedrouterContext)
-	config := cast.CastAppNetworkConfig(configArg)
+	config, err := cast.CastAppNetworkConfig(configArg)
+	if err != nil {
+		log.Errorf("handleAppNetworkConfigModify: %s\n", err)
+		return
+	}
 	log.Infof("handleAppNetworkConfigModify(%s-%s)\n", config.DisplayName, key)
 
 	status := lookupAppNetworkStatus(ctx, key)
@@ -766,7 +835,11 @@ func parseAndPublishLispServiceInfo(ctx *zedrouterContext, lispInfo *types.LispI
 	// IID to service status map for Lisp service instances
 	stMap := make(map[uint64]types.NetworkServiceStatus)
 	for _, st := range stList {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("parseAndPublishLispServiceInfo: %s\n", err)
+			continue
+		}
 		if status.Type != types.NST_LISP {
 			continue
 		}
@@ -824,7 +897,11 @@ func parseAndPublishLispInstanceInfo(ctx *zedrouterContext, lispInfo *types.Lisp
 	// IID to instance status map for Lisp network instances
 	stMap := make(map[uint64]types.NetworkInstanceStatus)
 	for _, st := range stList {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("parseAndPublishLispInstanceInfo: %s\n", err)
+			continue
+		}
 		if status.Type != types.NetworkInstanceTypeMesh {
 			continue
 		}
@@ -853,7 +930,11 @@ func parseAndPublishLispInstanceInfo(ctx *zedrouterContext, lispInfo *types.Lisp
 func handleLispInfoModify(ctxArg interface{}, key string, configArg interface{}) {
 	log.Infof("handleLispInfoModify(%s)\n", key)
 	ctx := ctxArg.(*zedrouterContext)
-	lispInfo := cast.CastLispInfoStatus(configArg)
+	lispInfo, err := cast.CastLispInfoStatus(configArg)
+	if err != nil {
+		log.Errorf("handleLispInfoModify: %s\n", err)
+		return
+	}
 
 	if key != "global" {
 		log.Infof("handleLispInfoModify: ignoring %s\n", key)
@@ -914,7 +995,11 @@ func parseAndPublishLispMetricsOLD(ctx *zedrouterContext, lispMetrics *types.Lis
 	// IID to service status map for Lisp service instances
 	stMap := make(map[uint64]types.NetworkServiceStatus)
 	for _, st := range stList {
-		status := cast.CastNetworkServiceStatus(st)
+		status, err := cast.CastNetworkServiceStatus(st)
+		if err != nil {
+			log.Errorf("parseAndPublishLispMetricsOLD: %s\n", err)
+			continue
+		}
 		if status.Type != types.NST_LISP {
 			continue
 		}
@@ -999,7 +1084,11 @@ func parseAndPublishLispMetrics(ctx *zedrouterContext, lispMetrics *types.LispMe
 	// IID to service status map for Lisp service instances
 	stMap := make(map[uint64]types.NetworkInstanceStatus)
 	for _, st := range stList {
-		status := cast.CastNetworkInstanceStatus(st)
+		status, err := cast.CastNetworkInstanceStatus(st)
+		if err != nil {
+			log.Errorf("parseAndPublishLispMetrics: %s\n", err)
+			continue
+		}
 		if status.Type != types.NetworkInstanceTypeMesh {
 			continue
 		}
@@ -1044,7 +1133,11 @@ func parseAndPublishLispMetrics(ctx *zedrouterContext, lispMetrics *types.LispMe
 func handleLispMetricsModify(ctxArg interface{}, key string, configArg interface{}) {
 	log.Debugf("handleLispMetricsModify(%s)\n", key)
 	ctx := ctxArg.(*zedrouterContext)
-	lispMetrics := cast.CastLispMetrics(configArg)
+	lispMetrics, err := cast.CastLispMetrics(configArg)
+	if err != nil {
+		log.Errorf("handleLispMetricsModify: %s\n", err)
+		return
+	}
 
 	if key != "global" {
 		log.Infof("handleLispMetricsModify: ignoring %s\n", key)
@@ -1071,7 +1164,11 @@ func lookupAppNetworkStatus(ctx *zedrouterContext, key string) *types.AppNetwork
 		log.Infof("lookupAppNetworkStatus(%s) not found\n", key)
 		return nil
 	}
-	status := cast.CastAppNetworkStatus(st)
+	status, err := cast.CastAppNetworkStatus(st)
+	if err != nil {
+		log.Errorf("lookupAppNetworkStatus: %s\n", err)
+		return nil
+	}
 	if status.Key() != key {
 		log.Errorf("lookupAppNetworkStatus key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, status.Key(), status)
@@ -1092,7 +1189,11 @@ func lookupAppNetworkConfig(ctx *zedrouterContext, key string) *types.AppNetwork
 			return nil
 		}
 	}
-	config := cast.CastAppNetworkConfig(c)
+	config, err := cast.CastAppNetworkConfig(c)
+	if err != nil {
+		log.Errorf("lookupAppNetworkConfig: %s\n", err)
+		return nil
+	}
 	if config.Key() != key {
 		log.Errorf("lookupAppNetworkConfig key/UUID mismatch %s vs %s; ignored %+v\n",
 			key, config.Key(), config)
@@ -1334,11 +1435,15 @@ func appNetworkDoActivateUnderlayNetworkWithNetworkInstance(
 		appIPAddr)
 
 	// Set up ACLs
-	err = createACLConfiglet(bridgeName, vifName, false,
+	err = createACLConfiglet(ctx, bridgeName, vifName, false,
 		ulConfig.ACLs, bridgeIPAddr, appIPAddr)
 	if err != nil {
 		addError(ctx, status, "createACL", err)
 	}
+	err = setVifLimits(bridgeName, vifName, ulConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	if appIPAddr != "" {
 		// XXX clobber any IPv6 EID entry since same name
@@ -1353,7 +1458,7 @@ func appNetworkDoActivateUnderlayNetworkWithNetworkInstance(
 
 	if restartDnsmasq && ulStatus.BridgeIPAddr != "" {
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			ulStatus.BridgeIPAddr, netInstConfig, hostsDirpath,
 			newIpsets, false)
 		startDnsmasq(bridgeName)
@@ -1458,11 +1563,15 @@ func appNetworkDoActivateUnderlayNetworkWithNetworkObject(
 		appIPAddr)
 
 	// Set up ACLs
-	err = createACLConfiglet(bridgeName, vifName, false,
+	err = createACLConfiglet(ctx, bridgeName, vifName, false,
 		ulConfig.ACLs, bridgeIPAddr, appIPAddr)
 	if err != nil {
 		addError(ctx, status, "createACL", err)
 	}
+	err = setVifLimits(bridgeName, vifName, ulConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	if appIPAddr != "" {
 		// XXX clobber any IPv6 EID entry since same name
@@ -1648,11 +1757,15 @@ func appNetworkDoActivateOverlayNetworkWithNetworkInstance(
 		EID.String())
 
 	// Set up ACLs
-	err = createACLConfiglet(bridgeName, vifName, false,
+	err = createACLConfiglet(ctx, bridgeName, vifName, false,
 		olConfig.ACLs, olStatus.BridgeIPAddr, EID.String())
 	if err != nil {
 		addError(ctx, status, "createACL", err)
 	}
+	err = setVifLimits(bridgeName, vifName, olConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	addhostDnsmasq(bridgeName, appMac, EID.String(),
 		config.UUIDandVersion.UUID.String())
@@ -1663,7 +1776,7 @@ func appNetworkDoActivateOverlayNetworkWithNetworkInstance(
 
 	if restartDnsmasq && olStatus.BridgeIPAddr != "" {
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			olStatus.BridgeIPAddr, netInstConfig, hostsDirpath,
 			newIpsets, netInstStatus.Ipv4Eid)
 		startDnsmasq(bridgeName)
@@ -1812,11 +1925,15 @@ func appNetworkDoActivateOverlayNetworkWithNetworkObject(
 		EID.String())
 
 	// Set up ACLs
-	err = createACLConfiglet(bridgeName, vifName, false,
+	err = createACLConfiglet(ctx, bridgeName, vifName, false,
 		olConfig.ACLs, olStatus.BridgeIPAddr, EID.String())
 	if err != nil {
 		addError(ctx, status, "createACL", err)
 	}
+	err = setVifLimits(bridgeName, vifName, olConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	addhostDnsmasq(bridgeName, appMac, EID.String(),
 		config.UUIDandVersion.UUID.String())
@@ -2104,7 +2221,7 @@ func doActivateAppInstanceWithMgmtLisp(
 		EID.String())
 
 	// Set up ACLs
-	err = createACLConfiglet(olIfname, olIfname, true, olConfig.ACLs,
+	err = createACLConfiglet(ctx, olIfname, olIfname, true, olConfig.ACLs,
 		"", "")
 	if err != nil {
 		addError(ctx, status, "createACL", err)
@@ -2146,7 +2263,11 @@ func checkAndRecreateAppNetwork(
 	pub := ctx.pubAppNetworkStatus
 	items := pub.GetAll()
 	for _, st := range items {
-		status := cast.CastAppNetworkStatus(st)
+		status, err := cast.CastAppNetworkStatus(st)
+		if err != nil {
+			log.Errorf("checkAndRecreateAppNetwork: %s\n", err)
+			continue
+		}
 		if !status.MissingNetwork {
 			continue
 		}
@@ -2171,8 +2292,7 @@ func checkAndRecreateAppNetwork(
 			log.Infof("checkAndRecreateAppNetwork(%s) remove error %s for %s\n",
 				network.String(), status.Error,
 				status.DisplayName)
-			status.Error = ""
-			status.ErrorTime = time.Time{}
+			status.ClearError()
 		}
 		doActivate(ctx, *config, &status)
 		log.Infof("checkAndRecreateAppNetwork done for %s\n",
@@ -2360,8 +2480,7 @@ func addError(ctx *zedrouterContext,
 	status *types.AppNetworkStatus, tag string, err error) {
 
 	log.Infof("%s: %s\n", tag, err.Error())
-	status.Error = appendError(status.Error, tag, err.Error())
-	status.ErrorTime = time.Now()
+	status.SetErrorNow(appendError(status.Error, tag, err.Error()))
 	publishAppNetworkStatus(ctx, status)
 }
 
@@ -2566,12 +2685,16 @@ func doAppNetworkModifyUnderlayNetworkWithNetworkInstance(
 	// XXX could there be a change to AssignedIPAddress?
 	// If so updateNetworkACLConfiglet needs to know old and new
 	// XXX Could ulStatus.Vif not be set? Means we didn't add
-	err := updateACLConfiglet(bridgeName, ulStatus.Vif, false,
+	err := updateACLConfiglet(ctx, bridgeName, ulStatus.Vif, false,
 		ulStatus.ACLs, ulConfig.ACLs, ulStatus.BridgeIPAddr,
 		appIPAddr)
 	if err != nil {
 		addError(ctx, status, "updateACL", err)
 	}
+	err = setVifLimits(bridgeName, ulStatus.Vif, ulConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	newIpsets, staleIpsets, restartDnsmasq := diffIpsets(ipsets,
 		netstatus.BridgeIPSets)
@@ -2579,7 +2702,7 @@ func doAppNetworkModifyUnderlayNetworkWithNetworkInstance(
 	if restartDnsmasq && ulStatus.BridgeIPAddr != "" {
 		hostsDirpath := runDirname + "/hosts." + bridgeName
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			ulStatus.BridgeIPAddr, netconfig, hostsDirpath,
 			newIpsets, false)
 		startDnsmasq(bridgeName)
@@ -2609,12 +2732,16 @@ func doAppNetworkModifyUnderlayNetworkWithNetworkObject(
 	// XXX could there be a change to AssignedIPAddress?
 	// If so updateNetworkACLConfiglet needs to know old and new
 	// XXX Could ulStatus.Vif not be set? Means we didn't add
-	err := updateACLConfiglet(bridgeName, ulStatus.Vif, false,
+	err := updateACLConfiglet(ctx, bridgeName, ulStatus.Vif, false,
 		ulStatus.ACLs, ulConfig.ACLs, ulStatus.BridgeIPAddr,
 		appIPAddr)
 	if err != nil {
 		addError(ctx, status, "updateACL", err)
 	}
+	err = setVifLimits(bridgeName, ulStatus.Vif, ulConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	newIpsets, staleIpsets, restartDnsmasq := diffIpsets(ipsets,
 		netstatus.BridgeIPSets)
@@ -2689,12 +2816,16 @@ func doAppNetworkModifyOverlayNetworkWithNetworkInstance(
 	// XXX could there be a change to AssignedIPv6Address aka EID?
 	// If so updateACLConfiglet needs to know old and new
 	// XXX Could olStatus.Vif not be set? Means we didn't add
-	err := updateACLConfiglet(bridgeName, olStatus.Vif, false,
+	err := updateACLConfiglet(ctx, bridgeName, olStatus.Vif, false,
 		olStatus.ACLs, olConfig.ACLs, olStatus.BridgeIPAddr,
 		olConfig.EID.String())
 	if err != nil {
 		addError(ctx, status, "updateACL", err)
 	}
+	err = setVifLimits(bridgeName, olStatus.Vif, olConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	// Look for added or deleted ipsets
 	newIpsets, staleIpsets, restartDnsmasq := diffIpsets(ipsets,
@@ -2703,7 +2834,7 @@ func doAppNetworkModifyOverlayNetworkWithNetworkInstance(
 	if restartDnsmasq && olStatus.BridgeIPAddr != "" {
 		hostsDirpath := runDirname + "/hosts." + bridgeName
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			olStatus.BridgeIPAddr, netconfig, hostsDirpath,
 			newIpsets, netstatus.Ipv4Eid)
 		startDnsmasq(bridgeName)
@@ -2762,12 +2893,16 @@ func doAppNetworkModifyOverlayNetworkWithNetworkObject(
 	// XXX could there be a change to AssignedIPv6Address aka EID?
 	// If so updateACLConfiglet needs to know old and new
 	// XXX Could olStatus.Vif not be set? Means we didn't add
-	err := updateACLConfiglet(bridgeName, olStatus.Vif, false,
+	err := updateACLConfiglet(ctx, bridgeName, olStatus.Vif, false,
 		olStatus.ACLs, olConfig.ACLs, olStatus.BridgeIPAddr,
 		olConfig.EID.String())
 	if err != nil {
 		addError(ctx, status, "updateACL", err)
 	}
+	err = setVifLimits(bridgeName, olStatus.Vif, olConfig.Limits)
+	if err != nil {
+		addError(ctx, status, "setVifLimits", err)
+	}
 
 	// Look for added or deleted ipsets
 	newIpsets, staleIpsets, restartDnsmasq := diffIpsets(ipsets,
@@ -2824,7 +2959,7 @@ func handleAppNetworkWithMgmtLispModify(ctx *zedrouterContext,
 	// Note: we ignore olConfig.AppMacAddr for IsMgmt
 
 	// Update ACLs
-	err := updateACLConfiglet(olIfname, olIfname, true, olStatus.ACLs,
+	err := updateACLConfiglet(ctx, olIfname, olIfname, true, olStatus.ACLs,
 		olConfig.ACLs, "", "")
 	if err != nil {
 		addError(ctx, status, "updateACL", err)
@@ -2980,6 +3115,7 @@ func appNetworkDoInactivateUnderlayNetworkWithNetworkInstance(
 		if err != nil {
 			addError(ctx, status, "deleteACL", err)
 		}
+		deleteVifLimits(ulStatus.Vif)
 	} else {
 		log.Warnf("doInactivate(%s): no vifName for bridge %s for %s\n",
 			status.UUIDandVersion, bridgeName,
@@ -2996,7 +3132,7 @@ func appNetworkDoInactivateUnderlayNetworkWithNetworkInstance(
 
 	if restartDnsmasq && ulStatus.BridgeIPAddr != "" {
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			ulStatus.BridgeIPAddr, netconfig, hostsDirpath,
 			newIpsets, false)
 		startDnsmasq(bridgeName)
@@ -3061,6 +3197,7 @@ func appNetworkDoInactivateUnderlayNetworkWithNetworkObject(
 		if err != nil {
 			addError(ctx, status, "deleteACL", err)
 		}
+		deleteVifLimits(ulStatus.Vif)
 	} else {
 		log.Warnf("doInactivate(%s): no vifName for bridge %s for %s\n",
 			status.UUIDandVersion, bridgeName,
@@ -3153,6 +3290,7 @@ func appNetworkDoInactivateOverlayNetworkWithNetworkInstance(
 		if err != nil {
 			addError(ctx, status, "deleteACL", err)
 		}
+		deleteVifLimits(olStatus.Vif)
 	} else {
 		log.Warnf("doInactivate(%s): no vifName for bridge %s for %s\n",
 			status.UUIDandVersion, bridgeName,
@@ -3171,7 +3309,7 @@ func appNetworkDoInactivateOverlayNetworkWithNetworkInstance(
 
 	if restartDnsmasq && olStatus.BridgeIPAddr != "" {
 		stopDnsmasq(bridgeName, true, false)
-		createDnsmasqConfigletForNetworkInstance(bridgeName,
+		createDnsmasqConfigletForNetworkInstance(ctx, bridgeName,
 			olStatus.BridgeIPAddr, netconfig, hostsDirpath,
 			newIpsets, netstatus.Ipv4Eid)
 		startDnsmasq(bridgeName)
@@ -3272,6 +3410,7 @@ func appNetworkDoInactivateOverlayNetworkWithNetworkObject(
 		if err != nil {
 			addError(ctx, status, "deleteACL", err)
 		}
+		deleteVifLimits(olStatus.Vif)
 	} else {
 		log.Warnf("doInactivate(%s): no vifName for bridge %s for %s\n",
 			status.UUIDandVersion, bridgeName,
@@ -3448,6 +3587,7 @@ func handleGlobalConfigModify(ctxArg interface{}, key string,
 	log.Infof("handleGlobalConfigModify for %s\n", key)
 	debug, _ = agentlog.HandleGlobalConfig(ctx.subGlobalConfig, agentName,
 		debugOverride)
+	updateServiceProxies(ctx)
 	log.Infof("handleGlobalConfigModify done for %s\n", key)
 }
 
@@ -3469,7 +3609,11 @@ func handleAAModify(ctxArg interface{}, key string,
 	statusArg interface{}) {
 
 	ctx := ctxArg.(*zedrouterContext)
-	status := cast.CastAssignableAdapters(statusArg)
+	status, err := cast.CastAssignableAdapters(statusArg)
+	if err != nil {
+		log.Errorf("handleAAModify: %s\n", err)
+		return
+	}
 	if key != "global" {
 		log.Infof("handleAAModify: ignoring %s\n", key)
 		return
@@ -3492,9 +3636,14 @@ func handleAADelete(ctxArg interface{}, key string,
 	log.Infof("handleAADelete() done\n")
 }
 
-func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
+func handleDNSModify(ctxArg interface{}, key string, statusArg interface{},
+	oldStatusArg interface{}) {
 
-	status := cast.CastDeviceNetworkStatus(statusArg)
+	status, err := cast.CastDeviceNetworkStatus(statusArg)
+	if err != nil {
+		log.Errorf("handleDNSModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*zedrouterContext)
 	if key != "global" {
 		log.Infof("handleDNSModify: ignoring %s\n", key)
@@ -3505,14 +3654,18 @@ func handleDNSModify(ctxArg interface{}, key string, statusArg interface{}) {
 		log.Infof("handleDNSModify ignoring Testing\n")
 		return
 	}
-	if cmp.Equal(ctx.deviceNetworkStatus, status) {
-		log.Infof("handleDNSModify no change\n")
-		return
+	if oldStatusArg != nil {
+		oldStatus, err := cast.CastDeviceNetworkStatus(oldStatusArg)
+		if err != nil {
+			log.Errorf("handleDNSModify: %s\n", err)
+			return
+		}
+		log.Infof("handleDNSModify: changed %v",
+			oldStatus.Diff(status))
 	}
-	log.Infof("handleDNSModify: changed %v",
-		cmp.Diff(ctx.deviceNetworkStatus, status))
 	*ctx.deviceNetworkStatus = status
 	maybeHandleDNS(ctx)
+	updateServiceProxies(ctx)
 	log.Infof("handleDNSModify done for %s\n", key)
 }
 
@@ -0,0 +1,311 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Access to the conntrack table for troubleshooting and metrics
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+// Top level attributes
+const (
+	ctaTupleOrig     = 1
+	ctaTupleReply    = 2
+	ctaStatus        = 3
+	ctaTimeout       = 7
+	ctaMark          = 8
+	ctaCountersOrig  = 9
+	ctaCountersReply = 10
+	ctaID            = 12
+	ctaZone          = 18
+)
+
+// Tuple attributes
+const (
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+	ctaTupleZone  = 3
+)
+
+const (
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+	ctaIPv6Src = 3
+	ctaIPv6Dst = 4
+)
+
+const (
+	ctaProtoNum        = 1
+	ctaProtoSrcPort    = 2
+	ctaProtoDstPort    = 3
+	ctaProtoICMPID     = 4
+	ctaProtoICMPType   = 5
+	ctaProtoICMPCode   = 6
+	ctaProtoICMPv6ID   = 7
+	ctaProtoICMPv6Type = 8
+	ctaProtoICMPv6Code = 9
+)
+
+const (
+	ctaCountersPackets = 1
+	ctaCountersBytes   = 2
+)
+
+// Protocol numbers
+const (
+	ProtoICMP   = 1
+	ProtoTCP    = 6
+	ProtoUDP    = 17
+	ProtoICMPv6 = 58
+)
+
+var protoNames = map[uint8]string{
+	ProtoICMP:   "icmp",
+	ProtoTCP:    "tcp",
+	ProtoUDP:    "udp",
+	ProtoICMPv6: "icmpv6",
+}
+
+// ProtoName returns the name of a protocol number
+func ProtoName(proto uint8) string {
+	if name, ok := protoNames[proto]; ok {
+		return name
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// ParseProto accepts a name or a number
+func ParseProto(name string) (uint8, error) {
+	for proto, n := range protoNames {
+		if strings.EqualFold(name, n) {
+			return proto, nil
+		}
+	}
+	i, err := strconv.ParseUint(name, 10, 8)
+	if err != nil {
+		errStr := fmt.Sprintf("Unknown protocol %s", name)
+		return 0, errors.New(errStr)
+	}
+	return uint8(i), nil
+}
+
+// Tuple is one direction of a flow. The counters are only set if
+// nf_conntrack_acct is enabled.
+type Tuple struct {
+	Src      net.IP
+	Dst      net.IP
+	Protocol uint8
+	SrcPort  uint16 `json:",omitempty"`
+	DstPort  uint16 `json:",omitempty"`
+	ICMPID   uint16 `json:",omitempty"`
+	ICMPType uint8  `json:",omitempty"`
+	ICMPCode uint8  `json:",omitempty"`
+	Packets  uint64
+	Bytes    uint64
+}
+
+// Flow is a conntrack entry
+type Flow struct {
+	Family  uint8 // syscall.AF_INET or AF_INET6
+	Orig    Tuple
+	Reply   Tuple
+	Status  uint32
+	Timeout uint32 // Seconds
+	Mark    uint32
+	Zone    uint16
+	ID      uint32
+}
+
+func (t Tuple) String() string {
+	s := fmt.Sprintf("src=%s dst=%s", t.Src, t.Dst)
+	switch t.Protocol {
+	case ProtoICMP, ProtoICMPv6:
+		s += fmt.Sprintf(" type=%d code=%d id=%d", t.ICMPType,
+			t.ICMPCode, t.ICMPID)
+	default:
+		s += fmt.Sprintf(" sport=%d dport=%d", t.SrcPort, t.DstPort)
+	}
+	return s + fmt.Sprintf(" packets=%d bytes=%d", t.Packets, t.Bytes)
+}
+
+// String is similar to conntrack -L
+func (f Flow) String() string {
+	return fmt.Sprintf("%-8s %d %d %s %s mark=%d zone=%d",
+		ProtoName(f.Orig.Protocol), f.Orig.Protocol, f.Timeout,
+		f.Orig, f.Reply, f.Mark, f.Zone)
+}
+
+func parseTuple(b []byte, t *Tuple) error {
+	attrs, err := nfnetlink.ParseAttributes(b)
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		switch a.Type {
+		case ctaTupleIP:
+			if err := parseTupleIP(a.Value, t); err != nil {
+				return err
+			}
+		case ctaTupleProto:
+			if err := parseTupleProto(a.Value, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseTupleIP(b []byte, t *Tuple) error {
+	attrs, err := nfnetlink.ParseAttributes(b)
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		ip := net.IP(append([]byte{}, a.Value...))
+		switch a.Type {
+		case ctaIPv4Src, ctaIPv6Src:
+			t.Src = ip
+		case ctaIPv4Dst, ctaIPv6Dst:
+			t.Dst = ip
+		}
+	}
+	return nil
+}
+
+func parseTupleProto(b []byte, t *Tuple) error {
+	attrs, err := nfnetlink.ParseAttributes(b)
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		switch a.Type {
+		case ctaProtoNum, ctaProtoICMPType, ctaProtoICMPCode,
+			ctaProtoICMPv6Type, ctaProtoICMPv6Code:
+			if len(a.Value) < 1 {
+				return errors.New("Truncated protocol attribute")
+			}
+		case ctaProtoSrcPort, ctaProtoDstPort, ctaProtoICMPID,
+			ctaProtoICMPv6ID:
+			if len(a.Value) < 2 {
+				return errors.New("Truncated protocol attribute")
+			}
+		}
+		switch a.Type {
+		case ctaProtoNum:
+			t.Protocol = a.Value[0]
+		case ctaProtoSrcPort:
+			t.SrcPort = binary.BigEndian.Uint16(a.Value)
+		case ctaProtoDstPort:
+			t.DstPort = binary.BigEndian.Uint16(a.Value)
+		case ctaProtoICMPID, ctaProtoICMPv6ID:
+			t.ICMPID = binary.BigEndian.Uint16(a.Value)
+		case ctaProtoICMPType, ctaProtoICMPv6Type:
+			t.ICMPType = a.Value[0]
+		case ctaProtoICMPCode, ctaProtoICMPv6Code:
+			t.ICMPCode = a.Value[0]
+		}
+	}
+	return nil
+}
+
+func parseCounters(b []byte, t *Tuple) error {
+	attrs, err := nfnetlink.ParseAttributes(b)
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		if len(a.Value) < 8 {
+			continue
+		}
+		switch a.Type {
+		case ctaCountersPackets:
+			t.Packets = binary.BigEndian.Uint64(a.Value)
+		case ctaCountersBytes:
+			t.Bytes = binary.BigEndian.Uint64(a.Value)
+		}
+	}
+	return nil
+}
+
+// parseFlow parses a message starting with the nfgenmsg header
+func parseFlow(b []byte) (Flow, error) {
+	var f Flow
+	if len(b) < 4 {
+		return f, errors.New("Truncated conntrack message")
+	}
+	f.Family = b[0]
+	attrs, err := nfnetlink.ParseAttributes(b[4:])
+	if err != nil {
+		return f, err
+	}
+	for _, a := range attrs {
+		switch a.Type {
+		case ctaTupleOrig:
+			err = parseTuple(a.Value, &f.Orig)
+		case ctaTupleReply:
+			err = parseTuple(a.Value, &f.Reply)
+		case ctaCountersOrig:
+			err = parseCounters(a.Value, &f.Orig)
+		case ctaCountersReply:
+			err = parseCounters(a.Value, &f.Reply)
+		case ctaStatus, ctaTimeout, ctaMark, ctaID:
+			if len(a.Value) < 4 {
+				return f, errors.New("Truncated conntrack attribute")
+			}
+			v := binary.BigEndian.Uint32(a.Value)
+			switch a.Type {
+			case ctaStatus:
+				f.Status = v
+			case ctaTimeout:
+				f.Timeout = v
+			case ctaMark:
+				f.Mark = v
+			case ctaID:
+				f.ID = v
+			}
+		case ctaZone:
+			if len(a.Value) < 2 {
+				return f, errors.New("Truncated conntrack attribute")
+			}
+			f.Zone = binary.BigEndian.Uint16(a.Value)
+		}
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// List returns the flows for family, or for all families if
+// family is syscall.AF_UNSPEC
+func List(family uint8) ([]Flow, error) {
+	s, err := openSocket(0)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	replies, err := s.request(ipctnlMsgCtGet, syscall.NLM_F_DUMP, family,
+		nil)
+	if err != nil {
+		return nil, err
+	}
+	var flows []Flow
+	for _, b := range replies {
+		f, err := parseFlow(b)
+		if err != nil {
+			return nil, err
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func tupleAttributes(src, dst net.IP, proto uint8, sport,
+	dport uint16) []byte {
+
+	var ip []byte
+	ip = nfnetlink.AppendAttribute(ip, ctaIPv4Src, src.To4())
+	ip = nfnetlink.AppendAttribute(ip, ctaIPv4Dst, dst.To4())
+	var p []byte
+	p = nfnetlink.AppendAttribute(p, ctaProtoNum, []byte{proto})
+	p = nfnetlink.AppendAttribute(p, ctaProtoSrcPort, be16(sport))
+	p = nfnetlink.AppendAttribute(p, ctaProtoDstPort, be16(dport))
+	var b []byte
+	b = nfnetlink.AppendNested(b, ctaTupleIP, ip)
+	b = nfnetlink.AppendNested(b, ctaTupleProto, p)
+	return b
+}
+
+func counterAttributes(packets, bytes uint64) []byte {
+	var b []byte
+	b = nfnetlink.AppendAttribute(b, ctaCountersPackets, be64(packets))
+	b = nfnetlink.AppendAttribute(b, ctaCountersBytes, be64(bytes))
+	return b
+}
+
+// testMessage is a tcp flow from 10.1.0.2:40000 to 192.0.2.1:443 which
+// is source NATed to 172.16.0.5
+func testMessage() []byte {
+	b := []byte{syscall.AF_INET, nfnetlink.NfnetlinkV0, 0, 0}
+	b = nfnetlink.AppendNested(b, ctaTupleOrig, tupleAttributes(
+		net.ParseIP("10.1.0.2"), net.ParseIP("192.0.2.1"), ProtoTCP,
+		40000, 443))
+	b = nfnetlink.AppendNested(b, ctaTupleReply, tupleAttributes(
+		net.ParseIP("192.0.2.1"), net.ParseIP("172.16.0.5"), ProtoTCP,
+		443, 40000))
+	b = nfnetlink.AppendAttribute(b, ctaStatus, be32(0xe))
+	b = nfnetlink.AppendAttribute(b, ctaTimeout, be32(431999))
+	b = nfnetlink.AppendAttribute(b, ctaMark, be32(5))
+	b = nfnetlink.AppendNested(b, ctaCountersOrig, counterAttributes(10, 1000))
+	b = nfnetlink.AppendNested(b, ctaCountersReply, counterAttributes(8, 6000))
+	b = nfnetlink.AppendAttribute(b, ctaZone, be16(3))
+	b = nfnetlink.AppendAttribute(b, ctaID, be32(1234))
+	return b
+}
+
+func TestParseFlow(t *testing.T) {
+	f, err := parseFlow(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Family != syscall.AF_INET || f.Status != 0xe ||
+		f.Timeout != 431999 || f.Mark != 5 || f.Zone != 3 ||
+		f.ID != 1234 {
+		t.Errorf("Got %+v", f)
+	}
+	if !f.Orig.Src.Equal(net.ParseIP("10.1.0.2")) ||
+		!f.Orig.Dst.Equal(net.ParseIP("192.0.2.1")) ||
+		f.Orig.Protocol != ProtoTCP || f.Orig.SrcPort != 40000 ||
+		f.Orig.DstPort != 443 || f.Orig.Packets != 10 ||
+		f.Orig.Bytes != 1000 {
+		t.Errorf("Got orig %+v", f.Orig)
+	}
+	if !f.Reply.Dst.Equal(net.ParseIP("172.16.0.5")) ||
+		f.Reply.Packets != 8 || f.Reply.Bytes != 6000 {
+		t.Errorf("Got reply %+v", f.Reply)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	b := testMessage()
+	// Claim that the first attribute is longer than the message
+	nfnetlink.NativeEndian.PutUint16(b[4:6], uint16(len(b)))
+	if _, err := parseFlow(b); err == nil {
+		t.Errorf("Expected an error for a bad length")
+	}
+	if _, err := parseFlow(b[:2]); err == nil {
+		t.Errorf("Expected an error for a short message")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := parseFlow(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustParse := func(s string) *net.IPNet {
+		n, err := ParseIPNet(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	testMatrix := map[string]struct {
+		filter Filter
+		match  bool
+	}{
+		"Empty":            {filter: Filter{}, match: true},
+		"Protocol":         {filter: Filter{Protocol: ProtoTCP}, match: true},
+		"Other protocol":   {filter: Filter{Protocol: ProtoUDP}, match: false},
+		"Source subnet":    {filter: Filter{Src: mustParse("10.1.0.0/16")}, match: true},
+		"Source address":   {filter: Filter{Src: mustParse("10.1.0.3")}, match: false},
+		"Destination":      {filter: Filter{Dst: mustParse("192.0.2.1")}, match: true},
+		"Source port":      {filter: Filter{Port: 40000}, match: true},
+		"Destination port": {filter: Filter{Port: 443}, match: true},
+		"Other port":       {filter: Filter{Port: 80}, match: false},
+		"Bridge subnet": {filter: Filter{
+			Subnets: []*net.IPNet{mustParse("10.2.0.0/16"),
+				mustParse("10.1.0.0/24")}}, match: true},
+		"Other bridge": {filter: Filter{
+			Subnets: []*net.IPNet{mustParse("10.2.0.0/16")}}, match: false},
+		"Zone":       {filter: Filter{Zone: 3}, match: true},
+		"Other zone": {filter: Filter{Zone: 4}, match: false},
+	}
+	for testname, test := range testMatrix {
+		if test.filter.Match(f) != test.match {
+			t.Errorf("%s: expected match %v", testname, test.match)
+		}
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	for name, expected := range map[string]uint8{"tcp": ProtoTCP,
+		"UDP": ProtoUDP, "icmp": ProtoICMP, "47": 47} {
+		proto, err := ParseProto(name)
+		if err != nil || proto != expected {
+			t.Errorf("%s: got %d %v expected %d", name, proto, err,
+				expected)
+		}
+	}
+	if _, err := ParseProto("bogus"); err == nil {
+		t.Errorf("Expected an error for bogus")
+	}
+}
+
+func TestFlowKey(t *testing.T) {
+	f, err := parseFlow(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append([]byte{f.Family, nfnetlink.NfnetlinkV0, 0, 0}, flowKey(f)...)
+	key, err := parseFlow(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Orig.Src.Equal(f.Orig.Src) || !key.Orig.Dst.Equal(f.Orig.Dst) ||
+		key.Orig.Protocol != f.Orig.Protocol ||
+		key.Orig.SrcPort != f.Orig.SrcPort ||
+		key.Orig.DstPort != f.Orig.DstPort || key.Zone != f.Zone {
+		t.Errorf("Got key %+v for %+v", key, f)
+	}
+}
+
+func TestCountFlows(t *testing.T) {
+	app := Endpoint{IP: net.ParseIP("10.1.0.2"), Zone: 1}
+	flow := func(src, dst, replySrc string, proto uint8, bytes uint64) Flow {
+		return Flow{
+			Zone: 1,
+			Orig: Tuple{Src: net.ParseIP(src), Dst: net.ParseIP(dst),
+				Protocol: proto, Packets: 1, Bytes: bytes},
+			Reply: Tuple{Src: net.ParseIP(replySrc), Packets: 1,
+				Bytes: bytes},
+		}
+	}
+	flows := []Flow{
+		flow("10.1.0.2", "192.0.2.1", "192.0.2.1", ProtoTCP, 100),
+		flow("10.1.0.2", "192.0.2.1", "192.0.2.1", ProtoUDP, 100),
+		flow("10.1.0.2", "192.0.2.2", "192.0.2.2", ProtoTCP, 1000),
+		// Inbound port map to the app
+		flow("198.51.100.7", "172.16.0.5", "10.1.0.2", ProtoTCP, 10),
+		// Another app
+		flow("10.1.0.3", "192.0.2.1", "192.0.2.1", ProtoTCP, 5000),
+	}
+	// Same address in another network instance
+	other := flow("10.1.0.2", "192.0.2.1", "192.0.2.1", ProtoTCP, 5000)
+	other.Zone = 2
+	flows = append(flows, other)
+	counts := CountFlows(flows, []Endpoint{app}, 2)
+	if counts.Flows != 4 || counts.Protocols["tcp"] != 3 ||
+		counts.Protocols["udp"] != 1 {
+		t.Errorf("Got %+v", counts)
+	}
+	if len(counts.TopTalkers) != 2 {
+		t.Fatalf("Got talkers %+v", counts.TopTalkers)
+	}
+	first, second := counts.TopTalkers[0], counts.TopTalkers[1]
+	if !first.Remote.Equal(net.ParseIP("192.0.2.2")) || first.Bytes != 2000 {
+		t.Errorf("Got first %+v", first)
+	}
+	if !second.Remote.Equal(net.ParseIP("192.0.2.1")) ||
+		second.Flows != 2 || second.Packets != 4 {
+		t.Errorf("Got second %+v", second)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conntrack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := sysctlDir
+	sysctlDir = dir
+	defer func() { sysctlDir = saved }()
+
+	if _, err := ReadUsage(); err == nil {
+		t.Errorf("Expected an error for missing files")
+	}
+	for name, value := range map[string]string{
+		"nf_conntrack_count": "6000\n", "nf_conntrack_max": "8000\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name),
+			[]byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := ReadUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Count != 6000 || u.Max != 8000 || u.Percent() != 75 {
+		t.Errorf("Got %+v %d%%", u, u.Percent())
+	}
+	if err := SetMax(16000); err != nil {
+		t.Fatal(err)
+	}
+	u, err = ReadUsage()
+	if err != nil || u.Max != 16000 {
+		t.Errorf("Got %+v %v after SetMax", u, err)
+	}
+	if (Usage{}).Percent() != 0 {
+		t.Errorf("Expected zero percent for an empty Usage")
+	}
+}
+
+func TestIdleMatch(t *testing.T) {
+	match := idleMatch(3600, 600)
+	tcp := Flow{Orig: Tuple{Protocol: ProtoTCP}, Status: statusAssured}
+	tests := map[string]struct {
+		flow  Flow
+		match bool
+	}{
+		"Idle":     {flow: Flow{Orig: tcp.Orig, Status: tcp.Status, Timeout: 2000}, match: true},
+		"Boundary": {flow: Flow{Orig: tcp.Orig, Status: tcp.Status, Timeout: 3000}, match: true},
+		"Active":   {flow: Flow{Orig: tcp.Orig, Status: tcp.Status, Timeout: 3500}, match: false},
+		"Not established": {flow: Flow{Orig: tcp.Orig, Timeout: 60},
+			match: false},
+		"UDP": {flow: Flow{Orig: Tuple{Protocol: ProtoUDP},
+			Status: statusAssured, Timeout: 10}, match: false},
+	}
+	for name, test := range tests {
+		if match(test.flow) != test.match {
+			t.Errorf("%s: expected %v\n", name, test.match)
+		}
+	}
+}
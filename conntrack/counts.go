@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"net"
+	"sort"
+)
+
+// Talker is a remote endpoint and the traffic to and from it
+type Talker struct {
+	Remote  net.IP
+	Flows   int
+	Packets uint64 // Both directions
+	Bytes   uint64 // Both directions
+}
+
+// Endpoint is a local address in a zone. Zone zero matches any zone.
+type Endpoint struct {
+	IP   net.IP
+	Zone uint16
+}
+
+// Counts summarizes the flows of one endpoint, e.g., an app instance
+type Counts struct {
+	Flows      int
+	Protocols  map[string]int // Flows per protocol name
+	TopTalkers []Talker       // Sorted by bytes
+}
+
+// CountFlows aggregates the flows to or from any of the local
+// endpoints. A flow is local if its original source is one of the
+// endpoints, or if its reply source is, e.g., an inbound flow which
+// was destination NATed to the app. At most top talkers are returned.
+func CountFlows(flows []Flow, local []Endpoint, top int) Counts {
+	counts := Counts{Protocols: make(map[string]int)}
+	talkers := make(map[string]*Talker)
+	for _, flow := range flows {
+		var remote net.IP
+		if containsEndpoint(local, flow.Orig.Src, flow.Zone) {
+			remote = flow.Orig.Dst
+		} else if containsEndpoint(local, flow.Reply.Src, flow.Zone) {
+			remote = flow.Orig.Src
+		} else {
+			continue
+		}
+		counts.Flows++
+		counts.Protocols[ProtoName(flow.Orig.Protocol)]++
+		t, ok := talkers[remote.String()]
+		if !ok {
+			t = &Talker{Remote: remote}
+			talkers[remote.String()] = t
+		}
+		t.Flows++
+		t.Packets += flow.Orig.Packets + flow.Reply.Packets
+		t.Bytes += flow.Orig.Bytes + flow.Reply.Bytes
+	}
+	for _, t := range talkers {
+		counts.TopTalkers = append(counts.TopTalkers, *t)
+	}
+	sort.Slice(counts.TopTalkers, func(i, j int) bool {
+		ti, tj := counts.TopTalkers[i], counts.TopTalkers[j]
+		if ti.Bytes != tj.Bytes {
+			return ti.Bytes > tj.Bytes
+		}
+		if ti.Flows != tj.Flows {
+			return ti.Flows > tj.Flows
+		}
+		return ti.Remote.String() < tj.Remote.String()
+	})
+	if len(counts.TopTalkers) > top {
+		counts.TopTalkers = counts.TopTalkers[:top]
+	}
+	return counts
+}
+
+func containsEndpoint(list []Endpoint, ip net.IP, zone uint16) bool {
+	for _, l := range list {
+		if (l.Zone == 0 || l.Zone == zone) && l.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
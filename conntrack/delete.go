@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+// Delete removes the flows which match filter and returns the number
+// removed. Note that the zero Filter matches all flows. Flows which go
+// away before we delete them are not counted and are not errors.
+func Delete(family uint8, filter Filter) (int, error) {
+	return DeleteFunc(family, filter.Match)
+}
+
+// DeleteFunc is Delete for the callers which need more than a Filter
+func DeleteFunc(family uint8, match func(Flow) bool) (int, error) {
+	flows, err := List(family)
+	if err != nil {
+		return 0, err
+	}
+	s, err := openSocket(0)
+	if err != nil {
+		return 0, err
+	}
+	defer s.close()
+	count := 0
+	for _, flow := range flows {
+		if !match(flow) {
+			continue
+		}
+		_, err := s.request(ipctnlMsgCtDelete, syscall.NLM_F_ACK,
+			flow.Family, flowKey(flow))
+		if err == syscall.ENOENT {
+			continue
+		}
+		if err != nil {
+			log.Errorf("Delete %s: %s\n", flow, err)
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// flowKey returns the attributes which identify the flow
+func flowKey(flow Flow) []byte {
+	t := flow.Orig
+	var ip []byte
+	if flow.Family == syscall.AF_INET6 {
+		ip = nfnetlink.AppendAttribute(ip, ctaIPv6Src, t.Src.To16())
+		ip = nfnetlink.AppendAttribute(ip, ctaIPv6Dst, t.Dst.To16())
+	} else {
+		ip = nfnetlink.AppendAttribute(ip, ctaIPv4Src, t.Src.To4())
+		ip = nfnetlink.AppendAttribute(ip, ctaIPv4Dst, t.Dst.To4())
+	}
+	var proto []byte
+	proto = nfnetlink.AppendAttribute(proto, ctaProtoNum, []byte{t.Protocol})
+	switch t.Protocol {
+	case ProtoICMP:
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPID, be16(t.ICMPID))
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPType, []byte{t.ICMPType})
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPCode, []byte{t.ICMPCode})
+	case ProtoICMPv6:
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPv6ID, be16(t.ICMPID))
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPv6Type, []byte{t.ICMPType})
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoICMPv6Code, []byte{t.ICMPCode})
+	default:
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoSrcPort, be16(t.SrcPort))
+		proto = nfnetlink.AppendAttribute(proto, ctaProtoDstPort, be16(t.DstPort))
+	}
+	var tuple []byte
+	tuple = nfnetlink.AppendNested(tuple, ctaTupleIP, ip)
+	tuple = nfnetlink.AppendNested(tuple, ctaTupleProto, proto)
+	var b []byte
+	b = nfnetlink.AppendNested(b, ctaTupleOrig, tuple)
+	if flow.Zone != 0 {
+		b = nfnetlink.AppendAttribute(b, ctaZone, be16(flow.Zone))
+	}
+	return b
+}
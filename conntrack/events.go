@@ -0,0 +1,82 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"syscall"
+)
+
+// EventType is the change to a flow
+type EventType string
+
+const (
+	EventNew     EventType = "new"
+	EventUpdate  EventType = "update"
+	EventDestroy EventType = "destroy"
+)
+
+// Event is a change in the conntrack table
+type Event struct {
+	Type EventType
+	Flow Flow
+}
+
+// Watcher receives the conntrack events
+type Watcher struct {
+	sock *socket
+}
+
+// Watch subscribes to new and destroyed flows, and also to updates
+// if updates is set
+func Watch(updates bool) (*Watcher, error) {
+	groups := uint32(1<<(nfnlgrpConntrackNew-1) |
+		1<<(nfnlgrpConntrackDestroy-1))
+	if updates {
+		groups |= 1 << (nfnlgrpConntrackUpdate - 1)
+	}
+	s, err := openSocket(groups)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{sock: s}, nil
+}
+
+// Receive blocks until there are events. An ENOBUFS error means that
+// events were lost; the caller can continue receiving.
+func (w *Watcher) Receive() ([]Event, error) {
+	msgs, err := w.sock.receive()
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, m := range msgs {
+		if m.Header.Type>>8 != nfnlSubsysCtnetlink {
+			continue
+		}
+		var eventType EventType
+		switch m.Header.Type & 0xff {
+		case ipctnlMsgCtNew:
+			if m.Header.Flags&(syscall.NLM_F_CREATE|syscall.NLM_F_EXCL) != 0 {
+				eventType = EventNew
+			} else {
+				eventType = EventUpdate
+			}
+		case ipctnlMsgCtDelete:
+			eventType = EventDestroy
+		default:
+			continue
+		}
+		flow, err := parseFlow(m.Data)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, Event{Type: eventType, Flow: flow})
+	}
+	return events, nil
+}
+
+// Close stops the events
+func (w *Watcher) Close() error {
+	return w.sock.close()
+}
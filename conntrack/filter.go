@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"net"
+)
+
+// Filter selects flows based on the original direction. The zero value
+// matches all flows.
+type Filter struct {
+	Protocol uint8      // Zero matches any
+	Src      *net.IPNet // Source address
+	Dst      *net.IPNet // Destination address
+	Port     uint16     // Source or destination port
+	// Either address in one of the subnets, e.g., those of an app bridge
+	Subnets []*net.IPNet
+	Zone    uint16 // Zero matches any
+}
+
+// Match returns true if the flow passes the filter
+func (f Filter) Match(flow Flow) bool {
+	t := flow.Orig
+	if f.Zone != 0 && flow.Zone != f.Zone {
+		return false
+	}
+	if f.Protocol != 0 && t.Protocol != f.Protocol {
+		return false
+	}
+	if f.Src != nil && !f.Src.Contains(t.Src) {
+		return false
+	}
+	if f.Dst != nil && !f.Dst.Contains(t.Dst) {
+		return false
+	}
+	if f.Port != 0 && t.SrcPort != f.Port && t.DstPort != f.Port {
+		return false
+	}
+	if len(f.Subnets) != 0 {
+		found := false
+		for _, subnet := range f.Subnets {
+			if subnet.Contains(t.Src) || subnet.Contains(t.Dst) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true for the zero Filter, which matches all flows
+func (f Filter) Empty() bool {
+	return f.Protocol == 0 && f.Src == nil && f.Dst == nil &&
+		f.Port == 0 && len(f.Subnets) == 0 && f.Zone == 0
+}
+
+// ParseIPNet accepts an address or a subnet in CIDR notation
+func ParseIPNet(s string) (*net.IPNet, error) {
+	if _, subnet, err := net.ParseCIDR(s); err == nil {
+		return subnet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: s}
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// InterfaceSubnets returns the subnets of the addresses on an interface,
+// e.g., an app bridge
+func InterfaceSubnets(ifname string) ([]*net.IPNet, error) {
+	intf, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := intf.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var subnets []*net.IPNet
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		subnets = append(subnets, &net.IPNet{
+			IP:   ipnet.IP.Mask(ipnet.Mask),
+			Mask: ipnet.Mask,
+		})
+	}
+	return subnets, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Minimal ctnetlink client. The attributes are parsed by package
+// nfnetlink since we need the zone and the events.
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"syscall"
+
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+const (
+	nfnlSubsysCtnetlink = 1
+	receiveBufferSize   = 65536
+)
+
+// Message types in the ctnetlink subsystem
+const (
+	ipctnlMsgCtNew    = 0
+	ipctnlMsgCtGet    = 1
+	ipctnlMsgCtDelete = 2
+)
+
+// Multicast groups for events
+const (
+	nfnlgrpConntrackNew     = 1
+	nfnlgrpConntrackUpdate  = 2
+	nfnlgrpConntrackDestroy = 3
+)
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+type socket struct {
+	fd  int
+	seq uint32
+}
+
+// openSocket subscribes to groups if not zero
+func openSocket(groups uint32) (*socket, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, nfnetlink.NetlinkNetfilter)
+	if err != nil {
+		return nil, err
+	}
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK,
+		Groups: groups}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &socket{fd: fd}, nil
+}
+
+func (s *socket) close() error {
+	return syscall.Close(s.fd)
+}
+
+func (s *socket) receive() ([]syscall.NetlinkMessage, error) {
+	buf := make([]byte, receiveBufferSize)
+	n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	return syscall.ParseNetlinkMessage(buf[:n])
+}
+
+// request returns the data of the replies, each starting with the
+// nfgenmsg header
+func (s *socket) request(msgType uint8, flags uint16, family uint8,
+	attrs []byte) ([][]byte, error) {
+
+	s.seq++
+	b := nfnetlink.NewRequest(nfnlSubsysCtnetlink, msgType, flags, s.seq,
+		family, 0, attrs)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Sendto(s.fd, b, 0, sa); err != nil {
+		return nil, err
+	}
+	var replies [][]byte
+	for {
+		msgs, err := s.receive()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != s.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return replies, nil
+			case syscall.NLMSG_ERROR:
+				if err := nfnetlink.ParseError(m.Data); err != nil {
+					return nil, err
+				}
+				return replies, nil
+			}
+			replies = append(replies, m.Data)
+			if m.Header.Flags&syscall.NLM_F_MULTI == 0 &&
+				flags&syscall.NLM_F_ACK == 0 {
+				return replies, nil
+			}
+		}
+	}
+}
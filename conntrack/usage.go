@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Where the kernel exposes the conntrack table size and timeouts
+var sysctlDir = "/proc/sys/net/netfilter"
+
+// Usage is the number of flows and the size of the table
+type Usage struct {
+	Count int
+	Max   int
+}
+
+// Percent of the table in use
+func (u Usage) Percent() int {
+	if u.Max <= 0 {
+		return 0
+	}
+	return u.Count * 100 / u.Max
+}
+
+// ReadUsage returns the number of flows and the size of the table
+func ReadUsage() (Usage, error) {
+	var u Usage
+	var err error
+	u.Count, err = readSysctl("nf_conntrack_count")
+	if err != nil {
+		return u, err
+	}
+	u.Max, err = readSysctl("nf_conntrack_max")
+	return u, err
+}
+
+// SetMax changes the size of the table
+func SetMax(max int) error {
+	return writeSysctl("nf_conntrack_max", max)
+}
+
+// EstablishedTimeout returns the seconds an idle established TCP flow is
+// kept
+func EstablishedTimeout() (int, error) {
+	return readSysctl("nf_conntrack_tcp_timeout_established")
+}
+
+// The kernel sets this status bit once it has seen traffic in both
+// directions, i.e., for TCP once the flow is established
+const statusAssured = 1 << 2
+
+// EvictIdle deletes the established TCP flows which have been idle for
+// at least idleSeconds, leaving the others and the sysctls alone.
+// Returns the number deleted.
+func EvictIdle(idleSeconds int) (int, error) {
+	established, err := EstablishedTimeout()
+	if err != nil {
+		return 0, err
+	}
+	return DeleteFunc(syscall.AF_UNSPEC, idleMatch(established, idleSeconds))
+}
+
+// idleMatch determines the idle time from the remaining timeout, which the
+// kernel resets to the established timeout on every packet. Flows which
+// are closing have shorter timeouts hence also match; they are going away
+// anyway.
+func idleMatch(established int, idleSeconds int) func(Flow) bool {
+	return func(flow Flow) bool {
+		if flow.Orig.Protocol != ProtoTCP ||
+			flow.Status&statusAssured == 0 {
+			return false
+		}
+		return int(flow.Timeout) <= established-idleSeconds
+	}
+}
+
+func readSysctl(name string) (int, error) {
+	filename := sysctlDir + "/" + name
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		errStr := fmt.Sprintf("Bad value in %s: %s", filename, err)
+		return 0, errors.New(errStr)
+	}
+	return i, nil
+}
+
+func writeSysctl(name string, value int) error {
+	filename := sysctlDir + "/" + name
+	return ioutil.WriteFile(filename, []byte(strconv.Itoa(value)), 0644)
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// IPv4 address conflict detection (RFC 5227). A static address is probed
+// before it is applied and not used if another host answers; we probe
+// again every acdRetryInterval until it is free. The probe takes a few
+// seconds hence runs in the background, and the result is handled in
+// nim's main loop since that is where the port config changes. An address from DHCP is
+// probed once it appears. A conflict is reported in the NetworkPortStatus.
+
+package devicenetwork
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+// Per RFC 5227 section 1.1
+const (
+	acdProbeWait     = 1 * time.Second
+	acdProbeNum      = 3
+	acdProbeMin      = 1 * time.Second
+	acdProbeMax      = 2 * time.Second
+	acdAnnounceWait  = 2 * time.Second
+	acdRetryInterval = 60 * time.Second
+)
+
+const (
+	etherTypeARP = 0x0806
+	arpRequest   = 1
+	arpReply     = 2
+	arpFrameLen  = 14 + 28
+)
+
+// Raw socket for the ARP frames on one interface
+type arpConn interface {
+	Send(frame []byte) error
+	Recv(buf []byte, deadline time.Time) (int, error)
+	Close() error
+}
+
+// AddrConflictChanges is signalled with the ifname when a conflict is
+// found or cleared; the caller redoes the DeviceNetworkStatus
+var AddrConflictChanges = make(chan string, 10)
+
+// StaticAddrProbes is sent the result of the probe of a static address,
+// and the retry once the interval for a conflicting address has passed.
+// The main loop passes them to HandleStaticAddrProbe.
+var StaticAddrProbes = make(chan StaticAddrProbe, 10)
+
+// StaticAddrProbe is the result of a probe or a retry which is due
+type StaticAddrProbe struct {
+	port  types.NetworkPortConfig
+	seq   uint64
+	retry bool
+	mac   net.HardwareAddr // Of the host using the address
+	err   error
+}
+
+type acdState struct {
+	conflict *types.AddrConflict
+	checked  map[string]bool // DHCP addresses probed
+	port     types.NetworkPortConfig
+	probeSeq uint64      // Of the last static address probe
+	retry    *time.Timer // For a conflicting static address
+}
+
+// Accessed from the probe goroutines and timers hence the lock
+var acd = struct {
+	sync.Mutex
+	ports map[string]*acdState
+	seq   uint64
+}{ports: make(map[string]*acdState)}
+
+func lookupAcdState(ifname string) *acdState {
+	state, ok := acd.ports[ifname]
+	if !ok {
+		state = &acdState{checked: make(map[string]bool)}
+		acd.ports[ifname] = state
+	}
+	return state
+}
+
+// GetAddrConflict returns the current conflict for the port, if any
+func GetAddrConflict(ifname string) *types.AddrConflict {
+	acd.Lock()
+	defer acd.Unlock()
+	state, ok := acd.ports[ifname]
+	if !ok || state.conflict == nil {
+		return nil
+	}
+	conflict := *state.conflict
+	return &conflict
+}
+
+func setAddrConflict(ifname string, conflict *types.AddrConflict) {
+	acd.Lock()
+	state := lookupAcdState(ifname)
+	changed := (state.conflict == nil) != (conflict == nil)
+	state.conflict = conflict
+	acd.Unlock()
+	if !changed {
+		return
+	}
+	if conflict != nil {
+		log.Errorf("setAddrConflict(%s): %s\n", ifname, conflict.String())
+	} else {
+		log.Infof("setAddrConflict(%s): cleared\n", ifname)
+	}
+	select {
+	case AddrConflictChanges <- ifname:
+	default:
+		log.Warnf("setAddrConflict(%s): channel full\n", ifname)
+	}
+}
+
+// stopAddrConflict forgets the port when its config is removed
+func stopAddrConflict(ifname string) {
+	acd.Lock()
+	state, ok := acd.ports[ifname]
+	if ok && state.retry != nil {
+		state.retry.Stop()
+	}
+	delete(acd.ports, ifname)
+	acd.Unlock()
+	if ok && state.conflict != nil {
+		select {
+		case AddrConflictChanges <- ifname:
+		default:
+		}
+	}
+}
+
+// startStaticAddrProbe probes the static address of the port in the
+// background. The result is sent on StaticAddrProbes.
+func startStaticAddrProbe(nuc types.NetworkPortConfig, ip net.IP) {
+	acd.Lock()
+	state := lookupAcdState(nuc.IfName)
+	if state.retry != nil {
+		state.retry.Stop()
+		state.retry = nil
+	}
+	acd.seq++
+	state.probeSeq = acd.seq
+	state.port = nuc
+	seq := state.probeSeq
+	acd.Unlock()
+	go func() {
+		mac, err := probeAddr(nuc.IfName, ip)
+		StaticAddrProbes <- StaticAddrProbe{port: nuc, seq: seq,
+			mac: mac, err: err}
+	}()
+}
+
+// HandleStaticAddrProbe is called from the main loop with what arrives
+// on StaticAddrProbes. Applies the address if it is free, otherwise
+// arranges to probe again. Ignored if the port config changed since the
+// probe was started.
+func HandleStaticAddrProbe(probe StaticAddrProbe) {
+	ifname := probe.port.IfName
+	if !currentStaticAddrProbe(probe) {
+		log.Infof("HandleStaticAddrProbe(%s) config changed; ignored\n",
+			ifname)
+		return
+	}
+	ip, _, err := net.ParseCIDR(probe.port.AddrSubnet)
+	if err != nil {
+		log.Errorf("HandleStaticAddrProbe(%s) failed to parse %s: %s\n",
+			ifname, probe.port.AddrSubnet, err)
+		return
+	}
+	if probe.retry {
+		log.Infof("HandleStaticAddrProbe(%s) retrying %s\n", ifname, ip)
+		startStaticAddrProbe(probe.port, ip)
+		return
+	}
+	if probe.err != nil {
+		// Can not tell hence use it
+		log.Warnf("HandleStaticAddrProbe(%s) %s: %s\n",
+			ifname, ip, probe.err)
+	} else if probe.mac != nil {
+		setAddrConflict(ifname, &types.AddrConflict{Addr: ip,
+			Mac: probe.mac.String(), Time: time.Now()})
+		log.Errorf("HandleStaticAddrProbe(%s) %s in use; not applied\n",
+			ifname, ip)
+		acd.Lock()
+		state := lookupAcdState(ifname)
+		state.retry = time.AfterFunc(acdRetryInterval, func() {
+			StaticAddrProbes <- StaticAddrProbe{port: probe.port,
+				seq: probe.seq, retry: true}
+		})
+		acd.Unlock()
+		return
+	} else {
+		setAddrConflict(ifname, nil)
+	}
+	applyStaticAddr(probe.port)
+}
+
+// currentStaticAddrProbe checks that the probe is the last one started
+// for the port and that the port has not been inactivated since
+func currentStaticAddrProbe(probe StaticAddrProbe) bool {
+	acd.Lock()
+	defer acd.Unlock()
+	state, ok := acd.ports[probe.port.IfName]
+	return ok && state.probeSeq == probe.seq &&
+		reflect.DeepEqual(state.port, probe.port)
+}
+
+// checkDhcpAddrs probes the IPv4 addresses from DHCP which have not
+// yet been probed. Called when the addresses are determined.
+func checkDhcpAddrs(ifname string, addrs []net.IPNet) {
+	acd.Lock()
+	state := lookupAcdState(ifname)
+	present := make(map[string]bool)
+	var probe []net.IP
+	for _, addr := range addrs {
+		ip := addr.IP.To4()
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		present[ip.String()] = true
+		if !state.checked[ip.String()] {
+			state.checked[ip.String()] = true
+			probe = append(probe, ip)
+		}
+	}
+	for addr := range state.checked {
+		if !present[addr] {
+			delete(state.checked, addr)
+		}
+	}
+	// A conflicting address which DHCP replaced is no longer a problem
+	cleared := state.conflict != nil &&
+		!present[state.conflict.Addr.String()]
+	acd.Unlock()
+	if cleared {
+		setAddrConflict(ifname, nil)
+	}
+	for _, ip := range probe {
+		go func(ip net.IP) {
+			mac, err := probeAddr(ifname, ip)
+			if err != nil {
+				log.Warnf("checkDhcpAddrs(%s) %s: %s\n",
+					ifname, ip, err)
+				return
+			}
+			if mac != nil {
+				setAddrConflict(ifname, &types.AddrConflict{
+					Addr: ip, Mac: mac.String(), Time: time.Now()})
+			}
+		}(ip)
+	}
+}
+
+// probeAddr sends the probes for ip and returns the MAC address of the
+// host which uses it, or nil if none
+func probeAddr(ifname string, ip net.IP) (net.HardwareAddr, error) {
+	intf, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	ourMac := intf.HardwareAddr
+	conn, err := openArpConn(intf.Index)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	log.Infof("probeAddr(%s) %s\n", ifname, ip)
+	probe := packArpProbe(ourMac, ip)
+	wait := randDuration(0, acdProbeWait)
+	for i := 0; i < acdProbeNum; i++ {
+		if mac := listenArp(conn, time.Now().Add(wait), ip, ourMac); mac != nil {
+			return mac, nil
+		}
+		if err := conn.Send(probe); err != nil {
+			return nil, err
+		}
+		wait = randDuration(acdProbeMin, acdProbeMax)
+	}
+	return listenArp(conn, time.Now().Add(acdAnnounceWait), ip, ourMac), nil
+}
+
+func randDuration(min time.Duration, max time.Duration) time.Duration {
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
+
+// Returns the MAC of a conflicting host seen before the deadline
+func listenArp(conn arpConn, deadline time.Time, ip net.IP,
+	ourMac net.HardwareAddr) net.HardwareAddr {
+
+	buf := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		n, err := conn.Recv(buf, deadline)
+		if err != nil {
+			// Timeout or error; nothing more to read
+			return nil
+		}
+		if mac := arpConflict(buf[:n], ip, ourMac); mac != nil {
+			return mac
+		}
+	}
+	return nil
+}
+
+// packArpProbe returns the Ethernet frame with an ARP request for ip
+// with a zero sender IP address
+func packArpProbe(ourMac net.HardwareAddr, ip net.IP) []byte {
+	frame := make([]byte, arpFrameLen)
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], ourMac)
+	binary.BigEndian.PutUint16(frame[12:], etherTypeARP)
+	arp := frame[14:]
+	binary.BigEndian.PutUint16(arp[0:], 1)      // Ethernet
+	binary.BigEndian.PutUint16(arp[2:], 0x0800) // IPv4
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:], arpRequest)
+	copy(arp[8:14], ourMac)
+	// Sender IP arp[14:18] is zero; target MAC arp[18:24] is zero
+	copy(arp[24:28], ip.To4())
+	return frame
+}
+
+// arpConflict returns the sender MAC if the frame shows another host
+// using ip; either as the sender IP, or probing for it (RFC 5227 2.1.1)
+func arpConflict(frame []byte, ip net.IP, ourMac net.HardwareAddr) net.HardwareAddr {
+	if len(frame) < arpFrameLen ||
+		binary.BigEndian.Uint16(frame[12:]) != etherTypeARP {
+		return nil
+	}
+	arp := frame[14:]
+	op := binary.BigEndian.Uint16(arp[6:])
+	if arp[4] != 6 || arp[5] != 4 || (op != arpRequest && op != arpReply) {
+		return nil
+	}
+	senderMac := net.HardwareAddr(arp[8:14])
+	if bytes.Equal(senderMac, ourMac) {
+		return nil
+	}
+	senderIP := net.IP(arp[14:18])
+	targetIP := net.IP(arp[24:28])
+	if senderIP.Equal(ip) ||
+		(op == arpRequest && senderIP.Equal(net.IPv4zero) &&
+			targetIP.Equal(ip)) {
+		mac := make(net.HardwareAddr, 6)
+		copy(mac, senderMac)
+		return mac
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Raw ARP socket for address conflict detection
+
+// This file is built only for linux
+// +build linux
+
+package devicenetwork
+
+import (
+	"syscall"
+	"time"
+)
+
+type packetConn struct {
+	fd      int
+	ifindex int
+}
+
+func htons(i uint16) uint16 {
+	return (i << 8) | (i >> 8)
+}
+
+func openArpConn(ifindex int) (arpConn, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW,
+		int(htons(etherTypeARP)))
+	if err != nil {
+		return nil, err
+	}
+	sa := syscall.SockaddrLinklayer{Protocol: htons(etherTypeARP),
+		Ifindex: ifindex}
+	if err := syscall.Bind(fd, &sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &packetConn{fd: fd, ifindex: ifindex}, nil
+}
+
+func (conn *packetConn) Send(frame []byte) error {
+	sa := syscall.SockaddrLinklayer{Protocol: htons(etherTypeARP),
+		Ifindex: conn.ifindex, Halen: 6}
+	copy(sa.Addr[:], frame[0:6])
+	return syscall.Sendto(conn.fd, frame, 0, &sa)
+}
+
+func (conn *packetConn) Recv(buf []byte, deadline time.Time) (int, error) {
+	timeout := deadline.Sub(time.Now())
+	if timeout <= 0 {
+		return 0, syscall.EAGAIN
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(conn.fd, syscall.SOL_SOCKET,
+		syscall.SO_RCVTIMEO, &tv); err != nil {
+		return 0, err
+	}
+	n, _, err := syscall.Recvfrom(conn.fd, buf, 0)
+	return n, err
+}
+
+func (conn *packetConn) Close() error {
+	return syscall.Close(conn.fd)
+}
@@ -0,0 +1,17 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//
+// Stub file to allow compilation of acd.go to go thru on macos.
+// We don't need the actual functionality to work
+// +build darwin
+
+package devicenetwork
+
+import (
+	"errors"
+)
+
+func openArpConn(ifindex int) (arpConn, error) {
+	return nil, errors.New("ARP probes not supported")
+}
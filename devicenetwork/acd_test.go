@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+// Returns the frames in turn and then times out
+type fakeArpConn struct {
+	frames [][]byte
+}
+
+func (conn *fakeArpConn) Send(frame []byte) error {
+	return nil
+}
+
+func (conn *fakeArpConn) Recv(buf []byte, deadline time.Time) (int, error) {
+	if len(conn.frames) == 0 {
+		return 0, errors.New("timeout")
+	}
+	n := copy(buf, conn.frames[0])
+	conn.frames = conn.frames[1:]
+	return n, nil
+}
+
+func (conn *fakeArpConn) Close() error {
+	return nil
+}
+
+// An ARP frame from mac with the sender and target IP
+func arpFrame(op byte, mac net.HardwareAddr, sender net.IP,
+	target net.IP) []byte {
+
+	frame := packArpProbe(mac, target)
+	frame[14+7] = op
+	copy(frame[14+14:14+18], sender.To4())
+	return frame
+}
+
+func TestArpConflict(t *testing.T) {
+	ourMac, _ := net.ParseMAC("00:16:3e:00:00:01")
+	otherMac, _ := net.ParseMAC("00:16:3e:00:00:02")
+	ip := net.ParseIP("192.168.1.44")
+	otherIP := net.ParseIP("192.168.1.45")
+
+	probe := packArpProbe(ourMac, ip)
+	if len(probe) != arpFrameLen {
+		t.Fatalf("probe length %d", len(probe))
+	}
+	tests := []struct {
+		name     string
+		frame    []byte
+		conflict bool
+	}{
+		{"our probe", probe, false},
+		{"reply from other", arpFrame(arpReply, otherMac, ip, otherIP), true},
+		{"request from other", arpFrame(arpRequest, otherMac, ip, otherIP), true},
+		{"probe from other", arpFrame(arpRequest, otherMac, net.IPv4zero, ip), true},
+		{"unrelated request", arpFrame(arpRequest, otherMac, otherIP, ip), false},
+		{"our reply", arpFrame(arpReply, ourMac, ip, otherIP), false},
+		{"short", probe[:20], false},
+	}
+	for _, test := range tests {
+		mac := arpConflict(test.frame, ip, ourMac)
+		if test.conflict && mac.String() != otherMac.String() {
+			t.Errorf("%s: expected conflict, got %v", test.name, mac)
+		} else if !test.conflict && mac != nil {
+			t.Errorf("%s: unexpected conflict with %v", test.name, mac)
+		}
+	}
+
+	conn := &fakeArpConn{frames: [][]byte{probe,
+		arpFrame(arpReply, otherMac, ip, otherIP)}}
+	deadline := time.Now().Add(time.Second)
+	if mac := listenArp(conn, deadline, ip, ourMac); mac.String() != otherMac.String() {
+		t.Errorf("listenArp returned %v", mac)
+	}
+	if mac := listenArp(conn, deadline, ip, ourMac); mac != nil {
+		t.Errorf("listenArp returned %v after timeout", mac)
+	}
+}
+
+// The result of a probe is ignored once the port config changed
+func TestStaticAddrProbe(t *testing.T) {
+	nuc := types.NetworkPortConfig{IfName: "nonexistent0",
+		DhcpConfig: types.DhcpConfig{Dhcp: types.DT_STATIC,
+			AddrSubnet: "192.168.1.44/24"}}
+	ip := net.ParseIP("192.168.1.44")
+	defer stopAddrConflict(nuc.IfName)
+
+	// The probe runs in the background
+	startStaticAddrProbe(nuc, ip)
+	var probe StaticAddrProbe
+	select {
+	case probe = <-StaticAddrProbes:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("No probe result\n")
+	}
+	if probe.err == nil || !currentStaticAddrProbe(probe) {
+		t.Errorf("Unexpected probe %+v\n", probe)
+	}
+
+	// Restarted with a different address
+	changed := nuc
+	changed.AddrSubnet = "192.168.1.45/24"
+	startStaticAddrProbe(changed, net.ParseIP("192.168.1.45"))
+	if currentStaticAddrProbe(probe) {
+		t.Errorf("Probe current after a change\n")
+	}
+	probe2 := <-StaticAddrProbes
+	if !currentStaticAddrProbe(probe2) {
+		t.Errorf("Probe not current\n")
+	}
+
+	// A conflict arranges a retry, which is cancelled with the port
+	otherMac, _ := net.ParseMAC("00:16:3e:00:00:02")
+	probe2.err = nil
+	probe2.mac = otherMac
+	HandleStaticAddrProbe(probe2)
+	if conflict := GetAddrConflict(nuc.IfName); conflict == nil ||
+		conflict.Mac != otherMac.String() {
+		t.Errorf("Conflict not recorded: %v\n", conflict)
+	}
+	<-AddrConflictChanges
+	acd.Lock()
+	retry := acd.ports[nuc.IfName].retry
+	acd.Unlock()
+	if retry == nil {
+		t.Fatalf("No retry\n")
+	}
+	stopAddrConflict(nuc.IfName)
+	if retry.Stop() {
+		t.Errorf("Retry not stopped\n")
+	}
+	if currentStaticAddrProbe(probe2) {
+		t.Errorf("Probe current after inactivate\n")
+	}
+	<-AddrConflictChanges
+}
@@ -131,13 +131,16 @@ func checkIfAllDNSPortsHaveIPAddrs(status types.DeviceNetworkStatus) bool {
 
 func HandleAddressChange(ctx *DeviceNetworkContext) {
 
+	// Remove fallback addresses once DHCP has provided an address
+	UpdateDhcpFallback()
+
 	// Check if we have more or less addresses
 	var dnStatus types.DeviceNetworkStatus
 
 	if !ctx.Pending.Inprogress {
 		dnStatus = *ctx.DeviceNetworkStatus
 		status, _ := MakeDeviceNetworkStatus(*ctx.DevicePortConfig,
-			dnStatus)
+			dnStatus, ctx.AssignableAdapters)
 
 		if !reflect.DeepEqual(*ctx.DeviceNetworkStatus, status) {
 			log.Debugf("HandleAddressChange: change from %v to %v\n",
@@ -150,7 +153,7 @@ func HandleAddressChange(ctx *DeviceNetworkContext) {
 	} else {
 		dnStatus = ctx.Pending.PendDNS
 		dnStatus, _ = MakeDeviceNetworkStatus(*ctx.DevicePortConfig,
-			dnStatus)
+			dnStatus, ctx.AssignableAdapters)
 
 		if !reflect.DeepEqual(ctx.Pending.PendDNS, dnStatus) {
 			log.Debugf("HandleAddressChange pending: change from %v to %v\n",
@@ -49,13 +49,13 @@ func LinkChange(change netlink.LinkUpdate) bool {
 // Set up to be able to see LOWER-UP and NO-CARRIER in operStatus later
 func setLinkUp(ifname string) {
 	log.Infof("setLinkUp(%s)", ifname)
-	link, err := netlink.LinkByName(ifname)
+	link, err := Netlink.LinkByName(ifname)
 	if link == nil {
 		log.Warnf("Can't find link %s: %s\n", ifname, err)
 		return
 	}
 	//    ip link set ${ifname} up
-	if err := netlink.LinkSetUp(link); err != nil {
+	if err := Netlink.LinkSetUp(link); err != nil {
 		log.Errorf("LinkSetUp on %s failed: %s", ifname, err)
 		return
 	}
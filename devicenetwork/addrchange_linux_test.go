@@ -0,0 +1,94 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func linkUpdate(msgType uint16, link netlink.Link) netlink.LinkUpdate {
+	return netlink.LinkUpdate{Header: unix.NlMsghdr{Type: msgType},
+		Link: link}
+}
+
+func TestLinkChangeLastResort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "addrchange_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"eth0/device/vendor":   "0x8086\n",
+		"eth0/type":            "1\n",
+		"br0/type":             "1\n",
+		"br0/bridge/stp_state": "0\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldSysfsNetDir := sysfsNetDir
+	sysfsNetDir = dir
+	defer func() { sysfsNetDir = oldSysfsNetDir }()
+	fake := NewFakeNetlink()
+	oldNetlink := Netlink
+	Netlink = fake
+	defer func() { Netlink = oldNetlink }()
+
+	eth0 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 2,
+		Name: "eth0", OperState: netlink.OperDown}}
+	br0 := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Index: 3,
+		Name: "br0", OperState: netlink.OperUp}}
+	fake.AddLink(eth0)
+	fake.AddLink(br0)
+
+	if !LinkChange(linkUpdate(syscall.RTM_NEWLINK, eth0)) {
+		t.Errorf("NEWLINK eth0 not a change")
+	}
+	// Brought up since relevant
+	if eth0.OperState != netlink.OperUp {
+		t.Errorf("eth0 not set up: %v", eth0.OperState)
+	}
+	if up, ok := IfindexGetLastResortMap()["eth0"]; !ok || up {
+		t.Errorf("Expected eth0 down in last resort map: %v",
+			IfindexGetLastResortMap())
+	}
+	// Notified of the link going up
+	if !LinkChange(linkUpdate(syscall.RTM_NEWLINK, eth0)) {
+		t.Errorf("NEWLINK eth0 up not a change")
+	}
+	if LinkChange(linkUpdate(syscall.RTM_NEWLINK, eth0)) {
+		t.Errorf("NEWLINK eth0 unchanged is a change")
+	}
+	LinkChange(linkUpdate(syscall.RTM_NEWLINK, br0))
+	lastResort := IfindexGetLastResortMap()
+	if len(lastResort) != 1 || !lastResort["eth0"] {
+		t.Errorf("Expected only eth0 up in last resort map: %v",
+			lastResort)
+	}
+	if index, err := IfnameToIndex("br0"); err != nil || index != 3 {
+		t.Errorf("IfnameToIndex(br0) %d, %v", index, err)
+	}
+
+	for _, link := range []netlink.Link{eth0, br0} {
+		if !LinkChange(linkUpdate(syscall.RTM_DELLINK, link)) {
+			t.Errorf("DELLINK %s not a change", link.Attrs().Name)
+		}
+	}
+	if lastResort := IfindexGetLastResortMap(); len(lastResort) != 0 {
+		t.Errorf("Expected empty last resort map: %v", lastResort)
+	}
+}
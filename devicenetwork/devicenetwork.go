@@ -4,7 +4,9 @@
 package devicenetwork
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/eriknordmark/ipinfo"
@@ -12,8 +14,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/types"
 	"github.com/zededa/go-provision/zedcloud"
-	"io/ioutil"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -28,9 +30,17 @@ func MakeDevicePortConfig(globalConfig types.DeviceNetworkConfig) types.DevicePo
 	return config
 }
 
+// LastResortDevicePortConfig uses all the ports as management ports. All
+// but the cellular modems are assumed to be free.
 func LastResortDevicePortConfig(ports []string) types.DevicePortConfig {
 
-	config := makeDevicePortConfig(ports, ports)
+	var free []string
+	for _, port := range ports {
+		if ClassifyPort(port) != PortClassWwan {
+			free = append(free, port)
+		}
+	}
+	config := makeDevicePortConfig(ports, free)
 	// Set to higher than all zero but lower than the hardware model derived one above
 	config.TimePriority = time.Unix(0, 0)
 	return config
@@ -68,22 +78,27 @@ func IsProxyConfigEmpty(proxyConfig types.ProxyConfig) bool {
 }
 
 // Check if device can talk to outside world via atleast one of the free uplinks
-func VerifyDeviceNetworkStatus(status types.DeviceNetworkStatus,
-	retryCount int) error {
+// Cancelling reqCtx aborts the test. Zero timeouts use the defaults.
+func VerifyDeviceNetworkStatus(reqCtx context.Context,
+	status types.DeviceNetworkStatus, retryCount int,
+	timeouts zedcloud.Timeouts, ocspPolicy types.OCSPPolicy) error {
 
 	log.Infof("VerifyDeviceNetworkStatus() %d\n", retryCount)
 
-	serverFileName := "/config/server"
-	server, err := ioutil.ReadFile(serverFileName)
+	// Any of the controllers will do
+	servers, err := zedcloud.NewServerList()
 	if err != nil {
 		log.Fatal(err)
 	}
-	serverNameAndPort := strings.TrimSpace(string(server))
-	serverName := strings.Split(serverNameAndPort, ":")[0]
+	serverNameAndPort := servers.Current()
+	serverName := servers.CurrentHost()
 	testUrl := serverNameAndPort + "/api/v1/edgedevice/ping"
 
 	zedcloudCtx := zedcloud.ZedCloudContext{
 		DeviceNetworkStatus: &status,
+		Servers:             servers,
+		Timeouts:            timeouts,
+		OCSPPolicy:          ocspPolicy,
 	}
 	tlsConfig, err := zedcloud.GetTlsConfig(serverName, nil)
 	if err != nil {
@@ -118,12 +133,21 @@ func VerifyDeviceNetworkStatus(status types.DeviceNetworkStatus,
 			return errors.New(errStr)
 		}
 	}
-	cloudReachable, err := zedcloud.VerifyAllIntf(zedcloudCtx, testUrl, retryCount, 1)
+	proxyErrs, err := checkProxies(reqCtx, &status, testUrl)
 	if err != nil {
-		log.Errorf("VerifyDeviceNetworkStatus: VerifyAllIntf failed %s\n",
-			err)
+		log.Errorf("VerifyDeviceNetworkStatus: %s\n", err)
 		return err
 	}
+	cloudReachable, err := zedcloud.VerifyAllIntf(reqCtx, zedcloudCtx,
+		testUrl, retryCount, 1)
+	if err != nil {
+		errStr := fmt.Sprintf("Controller unreachable: %s", err)
+		if len(proxyErrs) != 0 {
+			errStr += fmt.Sprintf("; %s", strings.Join(proxyErrs, "; "))
+		}
+		log.Errorf("VerifyDeviceNetworkStatus: %s\n", errStr)
+		return errors.New(errStr)
+	}
 
 	if cloudReachable {
 		log.Infof("Uplink test SUCCESS to URL: %s", testUrl)
@@ -134,13 +158,51 @@ func VerifyDeviceNetworkStatus(status types.DeviceNetworkStatus,
 	return errors.New(errStr)
 }
 
+// proxyCheckTimeout is for connecting to each proxy
+const proxyCheckTimeout = 15 * time.Second
+
+// checkProxies checks the proxies on the management ports. Returns an
+// error if all of them failed and no port can get out without a proxy,
+// otherwise the failures for the ports which had one.
+func checkProxies(reqCtx context.Context, status *types.DeviceNetworkStatus,
+	testUrl string) ([]string, error) {
+
+	var failures []string
+	ports := types.GetMgmtPortsAny(*status, 0)
+	for _, ifname := range ports {
+		err := zedcloud.CheckProxy(reqCtx, status, ifname, testUrl,
+			proxyCheckTimeout)
+		if err == nil {
+			continue
+		}
+		if reqCtx.Err() != nil {
+			return failures, reqCtx.Err()
+		}
+		if _, ok := err.(*zedcloud.ProxyError); !ok {
+			// Lookup problem; leave it to the controller test
+			log.Warnf("checkProxies: %s: %s\n", ifname, err)
+			continue
+		}
+		log.Errorf("checkProxies: %s\n", err)
+		failures = append(failures, err.Error())
+	}
+	if len(ports) != 0 && len(failures) == len(ports) {
+		errStr := fmt.Sprintf("Proxy unreachable: %s",
+			strings.Join(failures, "; "))
+		return failures, errors.New(errStr)
+	}
+	return failures, nil
+}
+
 // Calculate local IP addresses to make a types.DeviceNetworkStatus
-func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus types.DeviceNetworkStatus) (types.DeviceNetworkStatus, error) {
+// The ports whose adapter is in pciback per aa are reported as such.
+func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus types.DeviceNetworkStatus,
+	aa *types.AssignableAdapters) (types.DeviceNetworkStatus, error) {
 	var globalStatus types.DeviceNetworkStatus
 	var err error = nil
 
 	log.Infof("MakeDeviceNetworkStatus()\n")
-	globalStatus.Version = globalConfig.Version
+	globalStatus.SetDPC(globalConfig)
 	globalStatus.Ports = make([]types.NetworkPortStatus,
 		len(globalConfig.Ports))
 	for ix, u := range globalConfig.Ports {
@@ -159,14 +221,33 @@ func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus type
 		globalStatus.Ports[ix].DomainName = u.DomainName
 		globalStatus.Ports[ix].NtpServer = u.NtpServer
 		globalStatus.Ports[ix].DnsServers = u.DnsServers
+		globalStatus.Ports[ix].DhcpFallback = IsDhcpFallback(u.IfName)
+		if errStr := portAssignedError(aa, u.IfName); errStr != "" {
+			log.Errorf("MakeDeviceNetworkStatus: %s\n", errStr)
+			globalStatus.Ports[ix].SetErrorDescription(
+				types.ErrorDescription{
+					Error:         errStr,
+					ErrorTime:     time.Now(),
+					ErrorSeverity: types.ErrorSeverityError,
+					ErrorCode:     types.PortErrorAssigned,
+				})
+			continue
+		}
 		ifindex, err := IfnameToIndex(u.IfName)
 		if err != nil {
 			errStr := fmt.Sprintf("Port %s does not exist - ignored",
 				u.IfName)
 			log.Errorf("MakeDeviceNetworkStatus: %s\n", errStr)
-			err = errors.New(errStr)
+			globalStatus.Ports[ix].SetErrorDescription(
+				types.ErrorDescription{
+					Error:         errStr,
+					ErrorTime:     time.Now(),
+					ErrorSeverity: types.ErrorSeverityError,
+					ErrorCode:     types.PortErrorMissing,
+				})
 			continue
 		}
+		globalStatus.Ports[ix].Wireless = GetWirelessStatus(u.IfName)
 		addrs, err := getAddrs(ifindex)
 		if err != nil {
 			log.Warnf("MakeDeviceNetworkStatus addrs not found %s index %d: %s\n",
@@ -184,12 +265,14 @@ func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus type
 				u.IfName, v, addr.IP)
 			globalStatus.Ports[ix].AddrInfoList[i].Addr = addr.IP
 		}
+		if u.Dhcp == types.DT_CLIENT {
+			checkDhcpAddrs(u.IfName, addrs)
+		}
 		// Get DNS etc info from dhcpcd. Updates DomainName and DnsServers
 		err = GetDhcpInfo(&globalStatus.Ports[ix])
 		if err != nil {
 			errStr := fmt.Sprintf("GetDhcpInfo failed %s", err)
-			globalStatus.Ports[ix].Error = errStr
-			globalStatus.Ports[ix].ErrorTime = time.Now()
+			globalStatus.Ports[ix].SetErrorNow(errStr)
 		}
 
 		// Attempt to get a wpad.dat file if so configured
@@ -200,8 +283,16 @@ func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus type
 			&globalStatus.Ports[ix])
 		if err != nil {
 			errStr := fmt.Sprintf("GetNetworkProxy failed %s", err)
-			globalStatus.Ports[ix].Error = errStr
-			globalStatus.Ports[ix].ErrorTime = time.Now()
+			globalStatus.Ports[ix].SetErrorNow(errStr)
+		}
+		if conflict := GetAddrConflict(u.IfName); conflict != nil {
+			globalStatus.Ports[ix].AddrConflict = conflict
+			globalStatus.Ports[ix].SetErrorDescription(
+				types.ErrorDescription{
+					Error:     conflict.String(),
+					ErrorTime: conflict.Time,
+					ErrorCode: types.PortErrorAddrConflict,
+				})
 		}
 	}
 	// Preserve geo info for existing interface and IP address
@@ -225,6 +316,24 @@ func MakeDeviceNetworkStatus(globalConfig types.DevicePortConfig, oldStatus type
 	return globalStatus, err
 }
 
+// portAssignedError returns why the port can not be used by the device
+// since its adapter is in pciback, or "" if it can be used
+func portAssignedError(aa *types.AssignableAdapters, ifname string) string {
+	if aa == nil {
+		return ""
+	}
+	ib := aa.LookupIoBundleForMember(types.IoEth, ifname)
+	if ib == nil || !ib.IsPCIBack {
+		return ""
+	}
+	if ib.UsedByUUID != nilUUID {
+		return fmt.Sprintf("Port %s assigned to application %s, cannot use for management",
+			ifname, ib.UsedByUUID.String())
+	}
+	return fmt.Sprintf("Port %s in pciback, cannot use for management",
+		ifname)
+}
+
 // Return all IP addresses for an ifindex
 // Leaves mask uninitialized
 // Also replaces what is in the Ifindex cache since AddrChange callbacks
@@ -235,18 +344,18 @@ func getAddrs(ifindex int) ([]net.IPNet, error) {
 
 	var addrs []net.IPNet
 
-	link, err := netlink.LinkByIndex(ifindex)
+	link, err := Netlink.LinkByIndex(ifindex)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Port in config/global does not exist: %d",
 			ifindex))
 		return addrs, err
 	}
-	addrs4, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	addrs4, err := Netlink.AddrList(link, netlink.FAMILY_V4)
 	if err != nil {
 		log.Warnf("netlink.AddrList %d V4 failed: %s", ifindex, err)
 		addrs4 = nil
 	}
-	addrs6, err := netlink.AddrList(link, netlink.FAMILY_V6)
+	addrs6, err := Netlink.AddrList(link, netlink.FAMILY_V6)
 	if err != nil {
 		log.Warnf("netlink.AddrList %d V4 failed: %s", ifindex, err)
 		addrs6 = nil
@@ -303,14 +412,10 @@ func UpdateDeviceNetworkGeo(timelimit time.Duration, globalStatus *types.DeviceN
 				continue
 			}
 			// geoloc with short timeout
-			opt := ipinfo.Options{
-				Timeout:  5 * time.Second,
-				SourceIp: ai.Addr,
-			}
-			info, err := ipinfo.MyIPWithOptions(opt)
+			info, err := getGeo(ai.Addr, u.DnsServers)
 			if err != nil {
 				// Ignore error
-				log.Infof("UpdateDeviceNetworkGeo MyIPInfo failed %s\n", err)
+				log.Infof("UpdateDeviceNetworkGeo getGeo failed %s\n", err)
 				continue
 			}
 			// Note that if the global IP is unchanged we don't
@@ -328,6 +433,31 @@ func UpdateDeviceNetworkGeo(timelimit time.Duration, globalStatus *types.DeviceN
 	return change
 }
 
+const (
+	geoURL     = "http://ipinfo.io/json"
+	geoTimeout = 5 * time.Second
+)
+
+// getGeo asks ipinfo.io about the public address seen for localAddr
+func getGeo(localAddr net.IP, dnsServers []net.IP) (*ipinfo.IPInfo, error) {
+	client := NewSourceHTTPClient(localAddr, dnsServers, geoTimeout)
+	resp, err := client.Get(geoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errStr := fmt.Sprintf("%s got statuscode %d %s", geoURL,
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+		return nil, errors.New(errStr)
+	}
+	var info ipinfo.IPInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
 func lookupOnIfname(config types.DevicePortConfig, ifname string) *types.NetworkPortConfig {
 	for _, c := range config.Ports {
 		if c.IfName == ifname {
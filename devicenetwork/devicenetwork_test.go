@@ -0,0 +1,42 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/zededa/go-provision/types"
+)
+
+func TestPortAssignedError(t *testing.T) {
+	appUUID, _ := uuid.FromString("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	aa := &types.AssignableAdapters{
+		Initialized: true,
+		IoBundleList: []types.IoBundle{
+			{Type: types.IoEth, Name: "eth0", Members: []string{"eth0"}},
+			{Type: types.IoEth, Name: "eth1", Members: []string{"eth1"},
+				IsPCIBack: true, UsedByUUID: appUUID},
+			{Type: types.IoEth, Name: "eth2", Members: []string{"eth2"},
+				IsPCIBack: true},
+		},
+	}
+	if errStr := portAssignedError(nil, "eth1"); errStr != "" {
+		t.Errorf("nil AssignableAdapters: %s", errStr)
+	}
+	for _, ifname := range []string{"eth0", "eth3"} {
+		if errStr := portAssignedError(aa, ifname); errStr != "" {
+			t.Errorf("%s: %s", ifname, errStr)
+		}
+	}
+	errStr := portAssignedError(aa, "eth1")
+	if !strings.Contains(errStr, "assigned to application "+appUUID.String()) {
+		t.Errorf("eth1: %s", errStr)
+	}
+	errStr = portAssignedError(aa, "eth2")
+	if !strings.Contains(errStr, "in pciback") {
+		t.Errorf("eth2: %s", errStr)
+	}
+}
@@ -115,6 +115,7 @@ func doDhcpClientActivate(nuc types.NetworkPortConfig) {
 		if !failed {
 			log.Infof("dhcpcd %s is running", nuc.IfName)
 		}
+		startDhcpFallback(nuc)
 
 	case types.DT_STATIC:
 		if nuc.AddrSubnet == "" {
@@ -124,64 +125,77 @@ func doDhcpClientActivate(nuc types.NetworkPortConfig) {
 			return
 		}
 		// Check that we can parse it
-		_, _, err := net.ParseCIDR(nuc.AddrSubnet)
+		ip, _, err := net.ParseCIDR(nuc.AddrSubnet)
 		if err != nil {
 			log.Errorf("doDhcpClientActivate: failed to parse %s for %s: %s\n",
 				nuc.AddrSubnet, nuc.IfName, err)
 			// XXX return error?
 			return
 		}
-		for dhcpcdExists(nuc.IfName) {
-			log.Warnf("dhcpcd %s already exists", nuc.IfName)
-			time.Sleep(10 * time.Second)
-		}
-		log.Infof("dhcpcd %s not running", nuc.IfName)
-		args := []string{fmt.Sprintf("ip_address=%s", nuc.AddrSubnet)}
-
-		extras := []string{"-f", "/dhcpcd.conf", "--nobackground",
-			"-d"}
-		if nuc.Gateway == nil || nuc.Gateway.String() == "0.0.0.0" {
-			extras = append(extras, "--nogateway")
-		} else if nuc.Gateway.String() != "" {
-			args = append(args, "--static",
-				fmt.Sprintf("routers=%s", nuc.Gateway.String()))
-		}
-		// XXX do we need to calculate a list for option?
-		for _, dns := range nuc.DnsServers {
-			args = append(args, "--static",
-				fmt.Sprintf("domain_name_servers=%s", dns.String()))
-		}
-		if nuc.DomainName != "" {
-			args = append(args, "--static",
-				fmt.Sprintf("domain_name=%s", nuc.DomainName))
-		}
-		if nuc.NtpServer != nil && !nuc.NtpServer.IsUnspecified() {
-			args = append(args, "--static",
-				fmt.Sprintf("ntp_servers=%s",
-					nuc.NtpServer.String()))
-		}
-
-		args = append(args, extras...)
-		if !dhcpcdCmd("--static", args, nuc.IfName, true) {
-			log.Errorf("doDhcpClientActivate: request failed for %s\n",
-				nuc.IfName)
-		}
-		for !dhcpcdExists(nuc.IfName) {
-			log.Warnf("dhcpcd %s not yet running", nuc.IfName)
-			time.Sleep(10 * time.Second)
+		if ip.To4() != nil {
+			// Applied by HandleStaticAddrProbe unless in use
+			startStaticAddrProbe(nuc, ip)
+			return
 		}
-		log.Infof("dhcpcd %s is running", nuc.IfName)
+		applyStaticAddr(nuc)
 	default:
 		log.Errorf("doDhcpClientActivate: unsupported dhcp %v\n",
 			nuc.Dhcp)
 	}
 }
 
+// applyStaticAddr starts dhcpcd with the static address
+func applyStaticAddr(nuc types.NetworkPortConfig) {
+
+	for dhcpcdExists(nuc.IfName) {
+		log.Warnf("dhcpcd %s already exists", nuc.IfName)
+		time.Sleep(10 * time.Second)
+	}
+	log.Infof("dhcpcd %s not running", nuc.IfName)
+	args := []string{fmt.Sprintf("ip_address=%s", nuc.AddrSubnet)}
+
+	extras := []string{"-f", "/dhcpcd.conf", "--nobackground",
+		"-d"}
+	if nuc.Gateway == nil || nuc.Gateway.String() == "0.0.0.0" {
+		extras = append(extras, "--nogateway")
+	} else if nuc.Gateway.String() != "" {
+		args = append(args, "--static",
+			fmt.Sprintf("routers=%s", nuc.Gateway.String()))
+	}
+	// XXX do we need to calculate a list for option?
+	for _, dns := range nuc.DnsServers {
+		args = append(args, "--static",
+			fmt.Sprintf("domain_name_servers=%s", dns.String()))
+	}
+	if nuc.DomainName != "" {
+		args = append(args, "--static",
+			fmt.Sprintf("domain_name=%s", nuc.DomainName))
+	}
+	if nuc.NtpServer != nil && !nuc.NtpServer.IsUnspecified() {
+		args = append(args, "--static",
+			fmt.Sprintf("ntp_servers=%s",
+				nuc.NtpServer.String()))
+	}
+
+	args = append(args, extras...)
+	if !dhcpcdCmd("--static", args, nuc.IfName, true) {
+		log.Errorf("applyStaticAddr: request failed for %s\n",
+			nuc.IfName)
+	}
+	for !dhcpcdExists(nuc.IfName) {
+		log.Warnf("dhcpcd %s not yet running", nuc.IfName)
+		time.Sleep(10 * time.Second)
+	}
+	log.Infof("dhcpcd %s is running", nuc.IfName)
+}
+
 func doDhcpClientInactivate(nuc types.NetworkPortConfig) {
 
 	log.Infof("doDhcpClientInactivate(%s) dhcp %v addr %s gateway %s\n",
 		nuc.IfName, nuc.Dhcp, nuc.AddrSubnet,
 		nuc.Gateway.String())
+	stopDhcpFallback(nuc.IfName)
+	stopAddrConflict(nuc.IfName)
 	// XXX skipping wwan0
 	if nuc.IfName == "wwan0" {
 		log.Infof("doDhcpClientInactivate: skipping %s\n",
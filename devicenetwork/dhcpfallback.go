@@ -0,0 +1,216 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Fallback static address for DT_CLIENT ports where DHCP does not provide
+// an address within DhcpTimeout. dhcpcd keeps on trying; once it gets an
+// address the fallback address and route are removed.
+
+package devicenetwork
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eriknordmark/netlink"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+// Higher than the routes from dhcpcd
+const fallbackRoutePriority = 10000
+
+type dhcpFallbackState struct {
+	config  types.NetworkPortConfig
+	timer   *time.Timer
+	applied bool
+}
+
+// Accessed from the timer functions hence the lock
+var dhcpFallback = struct {
+	sync.Mutex
+	ports map[string]*dhcpFallbackState
+}{ports: make(map[string]*dhcpFallbackState)}
+
+// startDhcpFallback arms the timer if the port has a fallback
+func startDhcpFallback(nuc types.NetworkPortConfig) {
+	if nuc.Dhcp != types.DT_CLIENT || nuc.DhcpTimeout == 0 ||
+		nuc.FallbackAddrSubnet == "" {
+		return
+	}
+	if _, err := netlink.ParseAddr(nuc.FallbackAddrSubnet); err != nil {
+		log.Errorf("startDhcpFallback(%s) bad FallbackAddrSubnet %s: %s\n",
+			nuc.IfName, nuc.FallbackAddrSubnet, err)
+		return
+	}
+	stopDhcpFallback(nuc.IfName)
+	ifname := nuc.IfName
+	timeout := time.Duration(nuc.DhcpTimeout) * time.Second
+	log.Infof("startDhcpFallback(%s) to %s after %v\n",
+		ifname, nuc.FallbackAddrSubnet, timeout)
+	state := &dhcpFallbackState{config: nuc}
+	state.timer = time.AfterFunc(timeout, func() {
+		checkDhcpFallback(ifname)
+	})
+	dhcpFallback.Lock()
+	dhcpFallback.ports[ifname] = state
+	dhcpFallback.Unlock()
+}
+
+// stopDhcpFallback stops the timer and removes any applied fallback
+func stopDhcpFallback(ifname string) {
+	dhcpFallback.Lock()
+	defer dhcpFallback.Unlock()
+	state, ok := dhcpFallback.ports[ifname]
+	if !ok {
+		return
+	}
+	log.Infof("stopDhcpFallback(%s)\n", ifname)
+	state.timer.Stop()
+	if state.applied {
+		if err := removeFallback(state.config); err != nil {
+			log.Errorf("stopDhcpFallback(%s): %s\n", ifname, err)
+		}
+	}
+	delete(dhcpFallback.ports, ifname)
+}
+
+// IsDhcpFallback returns true if the port is using its fallback address
+func IsDhcpFallback(ifname string) bool {
+	dhcpFallback.Lock()
+	defer dhcpFallback.Unlock()
+	state, ok := dhcpFallback.ports[ifname]
+	return ok && state.applied
+}
+
+// checkDhcpFallback runs when the timer fires
+func checkDhcpFallback(ifname string) {
+	dhcpFallback.Lock()
+	defer dhcpFallback.Unlock()
+	state, ok := dhcpFallback.ports[ifname]
+	if !ok || state.applied {
+		return
+	}
+	has, err := hasDhcpAddr(state.config)
+	if err != nil {
+		log.Errorf("checkDhcpFallback(%s): %s\n", ifname, err)
+		return
+	}
+	if has {
+		log.Infof("checkDhcpFallback(%s): DHCP address present\n",
+			ifname)
+		return
+	}
+	log.Warnf("checkDhcpFallback(%s): no DHCP address after %d seconds; using %s\n",
+		ifname, state.config.DhcpTimeout, state.config.FallbackAddrSubnet)
+	if err := applyFallback(state.config); err != nil {
+		log.Errorf("checkDhcpFallback(%s): %s\n", ifname, err)
+		return
+	}
+	state.applied = true
+}
+
+// UpdateDhcpFallback removes the fallback from the ports which now have
+// an address from DHCP. Called when addresses change.
+func UpdateDhcpFallback() {
+	dhcpFallback.Lock()
+	defer dhcpFallback.Unlock()
+	for ifname, state := range dhcpFallback.ports {
+		if !state.applied {
+			continue
+		}
+		has, err := hasDhcpAddr(state.config)
+		if err != nil || !has {
+			continue
+		}
+		log.Infof("UpdateDhcpFallback(%s): DHCP address present; removing %s\n",
+			ifname, state.config.FallbackAddrSubnet)
+		if err := removeFallback(state.config); err != nil {
+			log.Errorf("UpdateDhcpFallback(%s): %s\n", ifname, err)
+			continue
+		}
+		state.applied = false
+	}
+}
+
+// hasDhcpAddr returns true if the port has an IPv4 address other than
+// link-local and the fallback
+func hasDhcpAddr(nuc types.NetworkPortConfig) (bool, error) {
+	link, err := Netlink.LinkByName(nuc.IfName)
+	if err != nil {
+		return false, err
+	}
+	addrs, err := Netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return false, err
+	}
+	fallback, _ := netlink.ParseAddr(nuc.FallbackAddrSubnet)
+	for _, addr := range addrs {
+		if addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if fallback != nil && addr.IP.Equal(fallback.IP) {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func fallbackRoute(link netlink.Link, gateway net.IP) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Gw:        gateway,
+		Priority:  fallbackRoutePriority,
+	}
+}
+
+func applyFallback(nuc types.NetworkPortConfig) error {
+	link, err := Netlink.LinkByName(nuc.IfName)
+	if err != nil {
+		return err
+	}
+	addr, err := netlink.ParseAddr(nuc.FallbackAddrSubnet)
+	if err != nil {
+		return err
+	}
+	if err := Netlink.AddrAdd(link, addr); err != nil {
+		errStr := fmt.Sprintf("AddrAdd %s: %s", addr, err)
+		return errors.New(errStr)
+	}
+	if nuc.FallbackGateway == nil || nuc.FallbackGateway.IsUnspecified() {
+		return nil
+	}
+	route := fallbackRoute(link, nuc.FallbackGateway)
+	if err := Netlink.RouteAdd(route); err != nil {
+		errStr := fmt.Sprintf("RouteAdd via %s: %s",
+			nuc.FallbackGateway, err)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+func removeFallback(nuc types.NetworkPortConfig) error {
+	link, err := Netlink.LinkByName(nuc.IfName)
+	if err != nil {
+		return err
+	}
+	if nuc.FallbackGateway != nil && !nuc.FallbackGateway.IsUnspecified() {
+		route := fallbackRoute(link, nuc.FallbackGateway)
+		if err := Netlink.RouteDel(route); err != nil {
+			log.Warnf("removeFallback(%s) RouteDel: %s\n",
+				nuc.IfName, err)
+		}
+	}
+	addr, err := netlink.ParseAddr(nuc.FallbackAddrSubnet)
+	if err != nil {
+		return err
+	}
+	if err := Netlink.AddrDel(link, addr); err != nil {
+		errStr := fmt.Sprintf("AddrDel %s: %s", addr, err)
+		return errors.New(errStr)
+	}
+	return nil
+}
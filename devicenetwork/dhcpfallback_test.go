@@ -0,0 +1,143 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+	"github.com/zededa/go-provision/types"
+)
+
+func TestFallbackAddr(t *testing.T) {
+	fake, eth1, restore := useFakeNetlink()
+	defer restore()
+
+	nuc := types.NetworkPortConfig{IfName: "eth1"}
+	nuc.FallbackAddrSubnet = "192.168.1.99/24"
+	nuc.FallbackGateway = net.ParseIP("192.168.1.1")
+	if err := applyFallback(nuc); err != nil {
+		t.Fatalf("applyFallback failed: %s", err)
+	}
+	routes := fake.Routes()
+	if len(routes) != 1 || routes[0].Priority != fallbackRoutePriority ||
+		!routes[0].Gw.Equal(nuc.FallbackGateway) {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+	if err := applyFallback(nuc); err == nil {
+		t.Errorf("applyFallback twice succeeded")
+	}
+	if has, err := hasDhcpAddr(nuc); err != nil || has {
+		t.Errorf("hasDhcpAddr with only the fallback: %t, %v", has, err)
+	}
+	addr, _ := netlink.ParseAddr("192.168.1.10/24")
+	fake.AddrAdd(eth1, addr)
+	if has, err := hasDhcpAddr(nuc); err != nil || !has {
+		t.Errorf("hasDhcpAddr with a DHCP address: %t, %v", has, err)
+	}
+	if err := removeFallback(nuc); err != nil {
+		t.Fatalf("removeFallback failed: %s", err)
+	}
+	if routes := fake.Routes(); len(routes) != 0 {
+		t.Errorf("Routes left %v", routes)
+	}
+	addrs, _ := fake.AddrList(eth1, netlink.FAMILY_V4)
+	if len(addrs) != 1 || !addrs[0].IP.Equal(addr.IP) {
+		t.Errorf("Unexpected addresses %v", addrs)
+	}
+}
+
+func TestDhcpFallback(t *testing.T) {
+	fake, eth1, restore := useFakeNetlink()
+	defer restore()
+
+	nuc := types.NetworkPortConfig{IfName: "eth1"}
+	nuc.Dhcp = types.DT_CLIENT
+	nuc.DhcpTimeout = 3600
+	nuc.FallbackAddrSubnet = "192.168.1.99/24"
+	nuc.FallbackGateway = net.ParseIP("192.168.1.1")
+	fallback, _ := netlink.ParseAddr(nuc.FallbackAddrSubnet)
+	hasFallback := func() bool {
+		addrs, _ := fake.AddrList(eth1, netlink.FAMILY_V4)
+		for _, addr := range addrs {
+			if addr.IP.Equal(fallback.IP) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Not armed unless DHCP with a timeout and a valid fallback
+	for _, bad := range []func(*types.NetworkPortConfig){
+		func(c *types.NetworkPortConfig) { c.Dhcp = types.DT_STATIC },
+		func(c *types.NetworkPortConfig) { c.DhcpTimeout = 0 },
+		func(c *types.NetworkPortConfig) { c.FallbackAddrSubnet = "" },
+		func(c *types.NetworkPortConfig) { c.FallbackAddrSubnet = "garbage" },
+	} {
+		c := nuc
+		bad(&c)
+		startDhcpFallback(c)
+		checkDhcpFallback(c.IfName)
+		if IsDhcpFallback(c.IfName) || hasFallback() {
+			t.Errorf("Fallback applied for %+v\n", c)
+		}
+	}
+
+	// The timer fires without a DHCP address
+	startDhcpFallback(nuc)
+	defer stopDhcpFallback(nuc.IfName)
+	if IsDhcpFallback(nuc.IfName) {
+		t.Errorf("Fallback before the timeout\n")
+	}
+	checkDhcpFallback(nuc.IfName)
+	if !IsDhcpFallback(nuc.IfName) || !hasFallback() {
+		t.Errorf("Fallback not applied\n")
+	}
+	if routes := fake.Routes(); len(routes) != 1 {
+		t.Errorf("Unexpected routes %v\n", routes)
+	}
+	// Firing again does not add it twice
+	checkDhcpFallback(nuc.IfName)
+	if !IsDhcpFallback(nuc.IfName) {
+		t.Errorf("Fallback lost\n")
+	}
+
+	// Nothing changes until DHCP provides an address
+	UpdateDhcpFallback()
+	if !IsDhcpFallback(nuc.IfName) {
+		t.Errorf("Fallback removed without a DHCP address\n")
+	}
+	addr, _ := netlink.ParseAddr("192.168.1.10/24")
+	fake.AddrAdd(eth1, addr)
+	UpdateDhcpFallback()
+	if IsDhcpFallback(nuc.IfName) || hasFallback() {
+		t.Errorf("Fallback not removed with a DHCP address\n")
+	}
+	if routes := fake.Routes(); len(routes) != 0 {
+		t.Errorf("Routes left %v\n", routes)
+	}
+
+	// The timer does not apply it when DHCP was in time
+	startDhcpFallback(nuc)
+	checkDhcpFallback(nuc.IfName)
+	if IsDhcpFallback(nuc.IfName) || hasFallback() {
+		t.Errorf("Fallback applied with a DHCP address\n")
+	}
+
+	// Stopping removes an applied fallback
+	fake.AddrDel(eth1, addr)
+	startDhcpFallback(nuc)
+	checkDhcpFallback(nuc.IfName)
+	if !IsDhcpFallback(nuc.IfName) {
+		t.Errorf("Fallback not applied\n")
+	}
+	stopDhcpFallback(nuc.IfName)
+	if IsDhcpFallback(nuc.IfName) || hasFallback() {
+		t.Errorf("Fallback left after stop\n")
+	}
+	if routes := fake.Routes(); len(routes) != 0 {
+		t.Errorf("Routes left %v\n", routes)
+	}
+}
@@ -4,6 +4,7 @@
 package devicenetwork
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/zededa/go-provision/cast"
 	"github.com/zededa/go-provision/pubsub"
 	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
 )
 
 const (
@@ -62,17 +64,24 @@ type DeviceNetworkContext struct {
 	NetworkTestBetterTimer *time.Timer
 	NextDPCIndex           int
 	CloudConnectivityWorks bool
-	DNCInitialized         bool
+	verifyCancel           context.CancelFunc // Of the last network test
 
 	// Timers in seconds
 	DPCTestDuration           uint32 // Wait for DHCP address
 	NetworkTestInterval       uint32 // Test interval in minutes.
 	NetworkTestBetterInterval uint32 // Look for lower/better index
+
+	Timeouts   zedcloud.Timeouts // For the tests of the controller connectivity
+	OCSPPolicy types.OCSPPolicy  // Ditto
 }
 
 func HandleDNCModify(ctxArg interface{}, key string, configArg interface{}) {
 
-	config := cast.CastDeviceNetworkConfig(configArg)
+	config, err := cast.CastDeviceNetworkConfig(configArg)
+	if err != nil {
+		log.Errorf("HandleDNCModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DeviceNetworkContext)
 	if key != ctx.ManufacturerModel {
 		log.Debugf("HandleDNCModify: ignoring %s - expecting %s\n",
@@ -84,7 +93,12 @@ func HandleDNCModify(ctxArg interface{}, key string, configArg interface{}) {
 	var oldConfig types.DevicePortConfig
 	c, _ := ctx.PubDevicePortConfig.Get("global")
 	if c != nil {
-		oldConfig = cast.CastDevicePortConfig(c)
+		var err error
+		oldConfig, err = cast.CastDevicePortConfig(c)
+		if err != nil {
+			log.Errorf("HandleDNCModify: %s\n", err)
+			oldConfig = types.DevicePortConfig{}
+		}
 	} else {
 		oldConfig = types.DevicePortConfig{}
 	}
@@ -96,7 +110,6 @@ func HandleDNCModify(ctxArg interface{}, key string, configArg interface{}) {
 			oldConfig, portConfig)
 		ctx.PubDevicePortConfig.Publish("global", portConfig)
 	}
-	ctx.DNCInitialized = true
 	log.Infof("HandleDNCModify done for %s\n", key)
 }
 
@@ -112,7 +125,12 @@ func HandleDNCDelete(ctxArg interface{}, key string, configArg interface{}) {
 	var oldConfig types.DevicePortConfig
 	c, _ := ctx.PubDevicePortConfig.Get("global")
 	if c != nil {
-		oldConfig = cast.CastDevicePortConfig(c)
+		var err error
+		oldConfig, err = cast.CastDevicePortConfig(c)
+		if err != nil {
+			log.Errorf("HandleDNCDelete: %s\n", err)
+			oldConfig = types.DevicePortConfig{}
+		}
 	} else {
 		oldConfig = types.DevicePortConfig{}
 	}
@@ -151,13 +169,73 @@ func SetupVerify(ctx *DeviceNetworkContext, index int) {
 	pending := &ctx.Pending
 	pending.Inprogress = true
 	pending.PendDPC = ctx.DevicePortConfigList.PortConfigList[ctx.NextDPCIndex]
-	pending.PendDNS, _ = MakeDeviceNetworkStatus(pending.PendDPC, pending.PendDNS)
+	pending.PendDNS, _ = MakeDeviceNetworkStatus(pending.PendDPC, pending.PendDNS,
+		ctx.AssignableAdapters)
 	pending.TestCount = 0
 	log.Infof("SetupVerify: Started testing DPC (index %d): %v",
 		ctx.NextDPCIndex,
 		ctx.DevicePortConfigList.PortConfigList[ctx.NextDPCIndex])
 }
 
+// VerifyContext aborts any probes left over from the previous network
+// test and returns the context for the next one
+func VerifyContext(ctx *DeviceNetworkContext) context.Context {
+	CancelVerify(ctx)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	ctx.verifyCancel = cancel
+	return reqCtx
+}
+
+// CancelVerify aborts any probes still in progress from the last network
+// test, e.g., since the port configuration changed
+func CancelVerify(ctx *DeviceNetworkContext) {
+	if ctx.verifyCancel != nil {
+		ctx.verifyCancel()
+		ctx.verifyCancel = nil
+	}
+}
+
+// RunVerify runs verify on a worker goroutine while we wait for it or
+// for a DevicePortConfig change. A change cancels verify, which is
+// waited for, and is then processed. Returns false if verify was
+// aborted that way; the caller should then discard its result.
+func RunVerify(ctx *DeviceNetworkContext,
+	verify func(reqCtx context.Context)) bool {
+
+	reqCtx := VerifyContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		verify(reqCtx)
+		close(done)
+	}()
+	var sub *pubsub.Subscription
+	var change string
+	select {
+	case <-done:
+		CancelVerify(ctx)
+		return true
+	case change = <-subChan(ctx.SubDevicePortConfigA):
+		sub = ctx.SubDevicePortConfigA
+	case change = <-subChan(ctx.SubDevicePortConfigO):
+		sub = ctx.SubDevicePortConfigO
+	case change = <-subChan(ctx.SubDevicePortConfigS):
+		sub = ctx.SubDevicePortConfigS
+	}
+	log.Infof("RunVerify: DevicePortConfig change; aborting the test\n")
+	CancelVerify(ctx)
+	<-done
+	sub.ProcessChange(change)
+	return false
+}
+
+// A nil channel blocks forever hence is skipped by select
+func subChan(sub *pubsub.Subscription) <-chan string {
+	if sub == nil {
+		return nil
+	}
+	return sub.C
+}
+
 func RestartVerify(ctx *DeviceNetworkContext, caller string) {
 	log.Infof("RestartVerify: Caller %s initialized DPC list verify at %v",
 		caller, time.Now())
@@ -235,8 +313,9 @@ func compressDPCL(dpcl *types.DevicePortConfigList) types.DevicePortConfigList {
 
 var nilUUID = uuid.UUID{} // Really a const
 
-func VerifyPending(pending *DPCPending,
-	aa *types.AssignableAdapters) PendDNSStatus {
+func VerifyPending(reqCtx context.Context, pending *DPCPending,
+	aa *types.AssignableAdapters, timeouts zedcloud.Timeouts,
+	ocspPolicy types.OCSPPolicy) PendDNSStatus {
 
 	log.Infof("VerifyPending()\n")
 	// Stop pending timer if its running.
@@ -248,11 +327,13 @@ func VerifyPending(pending *DPCPending,
 	portInPciBack, portName, usedByUUID := pending.PendDPC.IsAnyPortInPciBack(aa)
 	if portInPciBack {
 		if usedByUUID != nilUUID {
-			errStr := fmt.Sprintf("port %s in PCIBack "+
-				"used by %s", portName, usedByUUID.String())
+			errStr := portAssignedError(aa, portName)
 			log.Errorf("VerifyPending: %s\n", errStr)
 			pending.PendDPC.LastError = errStr
 			pending.PendDPC.LastFailed = time.Now()
+			// Report the error for the port
+			pending.PendDNS, _ = MakeDeviceNetworkStatus(pending.PendDPC,
+				pending.PendDNS, aa)
 			return DPC_FAIL
 		}
 		log.Infof("VerifyPending: port %s still in PCIBack. "+
@@ -269,7 +350,7 @@ func VerifyPending(pending *DPCPending,
 		pending.OldDPC = pending.PendDPC
 	}
 	pending.PendDNS, _ = MakeDeviceNetworkStatus(pending.PendDPC,
-		pending.PendDNS)
+		pending.PendDNS, aa)
 	// XXX assume we're doing at least IPv4, so count only those to check if DHCP done
 	numUsableAddrs := types.CountLocalIPv4AddrAnyNoLinkLocal(pending.PendDNS)
 	if numUsableAddrs == 0 {
@@ -298,7 +379,8 @@ func VerifyPending(pending *DPCPending,
 	pending.TestCount = MaxDPCRetestCount
 
 	// We want connectivity to zedcloud via atleast one Management port.
-	err := VerifyDeviceNetworkStatus(pending.PendDNS, 1)
+	err := VerifyDeviceNetworkStatus(reqCtx, pending.PendDNS, 1, timeouts,
+		ocspPolicy)
 	status := DPC_FAIL
 	if err == nil {
 		pending.PendDPC.LastSucceeded = time.Now()
@@ -331,7 +413,18 @@ func VerifyDevicePortConfig(ctx *DeviceNetworkContext) {
 
 	passed := false
 	for !passed {
-		res := VerifyPending(&ctx.Pending, ctx.AssignableAdapters)
+		var res PendDNSStatus
+		if !RunVerify(ctx, func(reqCtx context.Context) {
+			res = VerifyPending(reqCtx, &ctx.Pending,
+				ctx.AssignableAdapters, ctx.Timeouts, ctx.OCSPPolicy)
+		}) {
+			// The handler could not restart since we are
+			// Inprogress; start over with the new list
+			SetupVerify(ctx, getNextTestableDPCIndex(ctx, 0))
+			continue
+		}
+		// Pick up the test result
+		ctx.Pending.PendDNS.SetDPC(ctx.Pending.PendDPC)
 		if ctx.PubDeviceNetworkStatus != nil {
 			log.Infof("PublishDeviceNetworkStatus: pending %+v\n",
 				ctx.Pending.PendDNS)
@@ -369,6 +462,7 @@ func VerifyDevicePortConfig(ctx *DeviceNetworkContext) {
 					pending.PendDPC.Key)
 			}
 			compressAndPublishDevicePortConfigList(ctx)
+			dumpNetworkState(pending.PendDPC)
 			if ctx.DevicePortConfigList.PortConfigList[0].IsDPCUntested() {
 				log.Warn("VerifyDevicePortConfig DPC_FAIL: New DPC arrived while network testing " +
 					"was in progress. Restarting DPC verification.")
@@ -486,13 +580,21 @@ func getCurrentDPC(ctx *DeviceNetworkContext) *types.DevicePortConfig {
 // We determine the priority from TimePriority in the config.
 func HandleDPCModify(ctxArg interface{}, key string, configArg interface{}) {
 
-	portConfig := cast.CastDevicePortConfig(configArg)
+	portConfig, err := cast.CastDevicePortConfig(configArg)
+	if err != nil {
+		log.Errorf("HandleDPCModify: %s\n", err)
+		return
+	}
 	ctx := ctxArg.(*DeviceNetworkContext)
 
 	log.Infof("HandleDPCModify: Current Config: %+v, portConfig: %+v\n",
 		ctx.DevicePortConfig, portConfig)
 
 	portConfig.DoSanitize(true, true, key, true)
+	if err := portConfig.Validate(); err != nil {
+		log.Errorf("HandleDPCModify: ignoring %s: %s\n", key, err)
+		return
+	}
 
 	configChanged := ctx.doUpdatePortConfigListAndPublish(&portConfig, false)
 	// We could have just booted up and not run RestartVerify even once.
@@ -517,7 +619,11 @@ func HandleDPCDelete(ctxArg interface{}, key string, configArg interface{}) {
 
 	log.Infof("HandleDPCDelete for %s\n", key)
 	ctx := ctxArg.(*DeviceNetworkContext)
-	portConfig := cast.CastDevicePortConfig(configArg)
+	portConfig, err := cast.CastDevicePortConfig(configArg)
+	if err != nil {
+		log.Errorf("HandleDPCDelete: %s\n", err)
+		return
+	}
 
 	log.Infof("HandleDPCDelete for %s current time %v deleted time %v\n",
 		key, ctx.DevicePortConfig.TimePriority, portConfig.TimePriority)
@@ -543,7 +649,11 @@ func HandleAssignableAdaptersModify(ctxArg interface{}, key string,
 		return
 	}
 	ctx := ctxArg.(*DeviceNetworkContext)
-	newAssignableAdapters := cast.CastAssignableAdapters(statusArg)
+	newAssignableAdapters, err := cast.CastAssignableAdapters(statusArg)
+	if err != nil {
+		log.Errorf("HandleAssignableAdaptersModify: %s\n", err)
+		return
+	}
 	log.Infof("HandleAssignableAdaptersModify() %+v\n", newAssignableAdapters)
 
 	// ctxArg is DeviceNetworkContext
@@ -656,7 +766,7 @@ func (ctx *DeviceNetworkContext) doPublishDNSForPortConfig(
 	portConfig *types.DevicePortConfig) {
 
 	dnStatus, _ := MakeDeviceNetworkStatus(*portConfig,
-		*ctx.DeviceNetworkStatus)
+		*ctx.DeviceNetworkStatus, ctx.AssignableAdapters)
 	if !reflect.DeepEqual(*ctx.DeviceNetworkStatus, dnStatus) {
 		log.Infof("doPublishDNSForPortConfig: DeviceNetworkStatus change from %v to %v\n",
 			*ctx.DeviceNetworkStatus, dnStatus)
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/pubsub"
+	"github.com/zededa/go-provision/types"
+)
+
+// A DevicePortConfig change cancels a probe which is blocked
+func TestRunVerifyCancel(t *testing.T) {
+	pub, err := pubsub.PublishInMemory("dnctest", types.DevicePortConfig{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	sub, err := pubsub.SubscribeInMemory("dnctest", types.DevicePortConfig{},
+		true, nil)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	sub.ProcessPending()
+	modified := 0
+	sub.ModifyHandler = func(ctxArg interface{}, key string, val interface{}) {
+		modified++
+	}
+	ctx := DeviceNetworkContext{SubDevicePortConfigA: sub}
+
+	// Not aborted
+	ran := false
+	if !RunVerify(&ctx, func(reqCtx context.Context) { ran = true }) {
+		t.Errorf("Aborted without a change\n")
+	}
+	if !ran {
+		t.Errorf("Did not run\n")
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() {
+		pub.Publish("global", types.DevicePortConfig{Key: "test"})
+	})
+	cancelled := false
+	start := time.Now()
+	ok := RunVerify(&ctx, func(reqCtx context.Context) {
+		select {
+		case <-reqCtx.Done():
+			cancelled = true
+		case <-time.After(10 * time.Second):
+		}
+	})
+	if ok {
+		t.Errorf("Not aborted by the change\n")
+	}
+	if !cancelled || time.Since(start) > 5*time.Second {
+		t.Errorf("Probe not cancelled after %v\n", time.Since(start))
+	}
+	if modified != 1 {
+		t.Errorf("Change processed %d times\n", modified)
+	}
+}
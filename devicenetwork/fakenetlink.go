@@ -0,0 +1,257 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// In-memory implementation of NetlinkAPI for tests. It keeps the links,
+// addresses, routes, and rules and returns the errors the kernel would
+// for duplicates and missing entries, but does not check much else.
+
+package devicenetwork
+
+import (
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/eriknordmark/netlink"
+)
+
+// FakeNetlink is a NetlinkAPI for tests; set Netlink to it
+type FakeNetlink struct {
+	sync.Mutex
+	links  map[int]netlink.Link
+	addrs  map[int][]netlink.Addr
+	routes []netlink.Route
+	rules  []netlink.Rule
+}
+
+func NewFakeNetlink() *FakeNetlink {
+	return &FakeNetlink{
+		links: make(map[int]netlink.Link),
+		addrs: make(map[int][]netlink.Addr),
+	}
+}
+
+// AddLink adds or replaces the link with the same index
+func (f *FakeNetlink) AddLink(link netlink.Link) {
+	f.Lock()
+	defer f.Unlock()
+	f.links[link.Attrs().Index] = link
+}
+
+// Routes returns all the routes
+func (f *FakeNetlink) Routes() []netlink.Route {
+	f.Lock()
+	defer f.Unlock()
+	return append([]netlink.Route{}, f.routes...)
+}
+
+// Rules returns all the rules
+func (f *FakeNetlink) Rules() []netlink.Rule {
+	f.Lock()
+	defer f.Unlock()
+	return append([]netlink.Rule{}, f.rules...)
+}
+
+func (f *FakeNetlink) LinkByName(name string) (netlink.Link, error) {
+	f.Lock()
+	defer f.Unlock()
+	for _, link := range f.links {
+		if link.Attrs().Name == name {
+			return link, nil
+		}
+	}
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (f *FakeNetlink) LinkByIndex(index int) (netlink.Link, error) {
+	f.Lock()
+	defer f.Unlock()
+	link, ok := f.links[index]
+	if !ok {
+		return nil, netlink.LinkNotFoundError{}
+	}
+	return link, nil
+}
+
+func (f *FakeNetlink) LinkSetUp(link netlink.Link) error {
+	f.Lock()
+	defer f.Unlock()
+	found, ok := f.links[link.Attrs().Index]
+	if !ok {
+		return syscall.ENODEV
+	}
+	found.Attrs().Flags |= net.FlagUp
+	found.Attrs().OperState = netlink.OperUp
+	return nil
+}
+
+func (f *FakeNetlink) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	f.Lock()
+	defer f.Unlock()
+	var result []netlink.Addr
+	for index, addrs := range f.addrs {
+		if link != nil && index != link.Attrs().Index {
+			continue
+		}
+		for _, addr := range addrs {
+			if familyMatch(family, addr.IP) {
+				result = append(result, addr)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeNetlink) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	f.Lock()
+	defer f.Unlock()
+	index := link.Attrs().Index
+	if _, ok := f.links[index]; !ok {
+		return syscall.ENODEV
+	}
+	for _, a := range f.addrs[index] {
+		if a.IP.Equal(addr.IP) {
+			return syscall.EEXIST
+		}
+	}
+	f.addrs[index] = append(f.addrs[index], *addr)
+	return nil
+}
+
+func (f *FakeNetlink) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	f.Lock()
+	defer f.Unlock()
+	index := link.Attrs().Index
+	addrs := f.addrs[index]
+	for i, a := range addrs {
+		if a.IP.Equal(addr.IP) {
+			f.addrs[index] = append(addrs[:i], addrs[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.EADDRNOTAVAIL
+}
+
+func (f *FakeNetlink) RouteListFiltered(family int, filter *netlink.Route,
+	filterMask uint64) ([]netlink.Route, error) {
+
+	f.Lock()
+	defer f.Unlock()
+	var result []netlink.Route
+	for _, rt := range f.routes {
+		dst := net.IP(nil)
+		if rt.Dst != nil {
+			dst = rt.Dst.IP
+		} else if rt.Gw != nil {
+			dst = rt.Gw
+		}
+		if dst != nil && !familyMatch(family, dst) {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_TABLE != 0 &&
+			routeTable(rt) != routeTable(*filter) {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_OIF != 0 &&
+			rt.LinkIndex != filter.LinkIndex {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_DST != 0 &&
+			!ipNetEqual(rt.Dst, filter.Dst) {
+			continue
+		}
+		result = append(result, rt)
+	}
+	return result, nil
+}
+
+func (f *FakeNetlink) RouteAdd(route *netlink.Route) error {
+	f.Lock()
+	defer f.Unlock()
+	for _, rt := range f.routes {
+		if routeEqual(rt, *route) {
+			return syscall.EEXIST
+		}
+	}
+	rt := *route
+	rt.Table = routeTable(rt)
+	f.routes = append(f.routes, rt)
+	return nil
+}
+
+func (f *FakeNetlink) RouteDel(route *netlink.Route) error {
+	f.Lock()
+	defer f.Unlock()
+	for i, rt := range f.routes {
+		if routeEqual(rt, *route) {
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.ESRCH
+}
+
+func (f *FakeNetlink) RuleList(family int) ([]netlink.Rule, error) {
+	f.Lock()
+	defer f.Unlock()
+	var result []netlink.Rule
+	for _, r := range f.rules {
+		if family == netlink.FAMILY_ALL || r.Family == family {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeNetlink) RuleAdd(rule *netlink.Rule) error {
+	f.Lock()
+	defer f.Unlock()
+	f.rules = append(f.rules, *rule)
+	return nil
+}
+
+// Removes the first match like the kernel
+func (f *FakeNetlink) RuleDel(rule *netlink.Rule) error {
+	f.Lock()
+	defer f.Unlock()
+	for i, r := range f.rules {
+		if r.Table == rule.Table && r.Family == rule.Family &&
+			ipNetEqual(r.Src, rule.Src) && ipNetEqual(r.Dst, rule.Dst) {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.ENOENT
+}
+
+func familyMatch(family int, ip net.IP) bool {
+	switch family {
+	case netlink.FAMILY_V4:
+		return ip.To4() != nil
+	case netlink.FAMILY_V6:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// Zero means the main table
+func routeTable(rt netlink.Route) int {
+	if rt.Table == 0 {
+		return syscall.RT_TABLE_MAIN
+	}
+	return rt.Table
+}
+
+func routeEqual(rt1 netlink.Route, rt2 netlink.Route) bool {
+	return routeTable(rt1) == routeTable(rt2) &&
+		rt1.LinkIndex == rt2.LinkIndex &&
+		rt1.Priority == rt2.Priority &&
+		ipNetEqual(rt1.Dst, rt2.Dst) && rt1.Gw.Equal(rt2.Gw)
+}
+
+func ipNetEqual(n1 *net.IPNet, n2 *net.IPNet) bool {
+	if n1 == nil || n2 == nil {
+		return n1 == n2
+	}
+	return n1.String() == n2.String()
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eriknordmark/netlink"
+)
+
+// Use a FakeNetlink with eth1 as ifindex 4 until the returned function
+// is called
+func useFakeNetlink() (*FakeNetlink, *netlink.Device, func()) {
+	fake := NewFakeNetlink()
+	eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 4,
+		Name: "eth1", OperState: netlink.OperUp}}
+	fake.AddLink(eth1)
+	oldNetlink := Netlink
+	Netlink = fake
+	return fake, eth1, func() { Netlink = oldNetlink }
+}
+
+func TestAddrChange(t *testing.T) {
+	fake, eth1, restore := useFakeNetlink()
+	defer restore()
+
+	for _, addrSubnet := range []string{"192.168.1.10/24", "fe80::1/64"} {
+		addr, _ := netlink.ParseAddr(addrSubnet)
+		if err := fake.AddrAdd(eth1, addr); err != nil {
+			t.Fatalf("AddrAdd %s failed: %s", addrSubnet, err)
+		}
+	}
+	addrs, err := getAddrs(4)
+	if err != nil || len(addrs) != 2 {
+		t.Fatalf("getAddrs returned %v, %v", addrs, err)
+	}
+	if cached, _ := IfindexToAddrs(4); len(cached) != 2 {
+		t.Errorf("Expected two cached addresses, got %v", cached)
+	}
+	if _, err := getAddrs(5); err == nil {
+		t.Errorf("getAddrs succeeded for unknown ifindex")
+	}
+
+	IfindexToAddrsFlush(4)
+
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	change := netlink.AddrUpdate{LinkIndex: 4, NewAddr: true,
+		LinkAddress: net.IPNet{IP: net.ParseIP("192.168.1.10"),
+			Mask: subnet.Mask}}
+	if !AddrChange(change) {
+		t.Errorf("AddrChange new not a change")
+	}
+	if AddrChange(change) {
+		t.Errorf("AddrChange new again is a change")
+	}
+	change.NewAddr = false
+	if !AddrChange(change) {
+		t.Errorf("AddrChange del not a change")
+	}
+	if cached, _ := IfindexToAddrs(4); len(cached) != 0 {
+		t.Errorf("Expected no cached addresses, got %v", cached)
+	}
+}
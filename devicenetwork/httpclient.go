@@ -0,0 +1,82 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// http.Clients which send from the addresses of a particular port and
+// resolve names using that port's DNS servers, so that requests for that
+// port do not go out whichever port has the default route.
+
+package devicenetwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+// NewPortHTTPClient returns a client using the first usable address of
+// the port. Fails if the port does not have one.
+func NewPortHTTPClient(port types.NetworkPortStatus,
+	timeout time.Duration) (*http.Client, error) {
+
+	for _, ai := range port.AddrInfoList {
+		if ai.Addr.IsLinkLocalUnicast() {
+			continue
+		}
+		return NewSourceHTTPClient(ai.Addr, port.DnsServers, timeout), nil
+	}
+	errStr := fmt.Sprintf("No usable address on %s", port.IfName)
+	return nil, errors.New(errStr)
+}
+
+// NewSourceHTTPClient returns a client which sends from localAddr and
+// uses dnsServers if set. Proxies are not used. The clients are for one
+// off requests hence connections are not kept for reuse; otherwise each
+// discarded client would leak its idle connections.
+func NewSourceHTTPClient(localAddr net.IP, dnsServers []net.IP,
+	timeout time.Duration) *http.Client {
+
+	d := net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: localAddr},
+		Timeout:   timeout,
+		Resolver:  newSourceResolver(localAddr, dnsServers, timeout),
+	}
+	transport := &http.Transport{
+		Dial:                d.Dial,
+		TLSHandshakeTimeout: timeout,
+		DisableKeepAlives:   true,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// newSourceResolver returns nil, meaning the default resolver, if there
+// are no dnsServers. Otherwise the queries are sent to them in turn.
+func newSourceResolver(localAddr net.IP, dnsServers []net.IP,
+	timeout time.Duration) *net.Resolver {
+
+	if len(dnsServers) == 0 {
+		return nil
+	}
+	var next uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			i := atomic.AddUint32(&next, 1) - 1
+			server := dnsServers[int(i)%len(dnsServers)]
+			d := net.Dialer{Timeout: timeout}
+			switch network {
+			case "udp", "udp4", "udp6":
+				d.LocalAddr = &net.UDPAddr{IP: localAddr}
+			default:
+				d.LocalAddr = &net.TCPAddr{IP: localAddr}
+			}
+			return d.DialContext(ctx, network,
+				net.JoinHostPort(server.String(), "53"))
+		},
+	}
+}
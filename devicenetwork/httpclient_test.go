@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+	"github.com/zededa/go-provision/zedcloud"
+)
+
+func TestPortHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s", r.RemoteAddr)
+		}))
+	defer server.Close()
+
+	port := types.NetworkPortStatus{
+		IfName: "lo",
+		AddrInfoList: []types.AddrInfo{
+			{Addr: net.ParseIP("fe80::1")},
+			{Addr: net.ParseIP("127.0.0.1")},
+		},
+	}
+	client, err := NewPortHTTPClient(port, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _, err := net.SplitHostPort(string(body))
+	if err != nil || host != "127.0.0.1" {
+		t.Errorf("got remote %s: %v", body, err)
+	}
+
+	// One off clients must not keep idle connections
+	if !client.Transport.(*http.Transport).DisableKeepAlives {
+		t.Errorf("keep-alives enabled")
+	}
+
+	port.AddrInfoList = port.AddrInfoList[:1]
+	if _, err := NewPortHTTPClient(port, time.Second); err == nil {
+		t.Errorf("no error with only link-local")
+	}
+}
+
+func TestSourceResolver(t *testing.T) {
+	if r := newSourceResolver(nil, nil, time.Second); r != nil {
+		t.Errorf("resolver without DNS servers")
+	}
+	r := newSourceResolver(net.ParseIP("127.0.0.1"),
+		[]net.IP{net.ParseIP("127.0.0.1")}, time.Second)
+	if r == nil || !r.PreferGo || r.Dial == nil {
+		t.Errorf("got %+v", r)
+	}
+}
+
+// The wpad.dat fetch is accounted in the zedcloud metrics
+func TestPacFileMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type",
+				"application/x-ns-proxy-autoconfig")
+			fmt.Fprintf(w, "function FindProxyForURL(url, host) { return \"DIRECT\"; }")
+		}))
+	defer server.Close()
+
+	port := types.NetworkPortStatus{
+		IfName: "lo",
+		AddrInfoList: []types.AddrInfo{
+			{Addr: net.ParseIP("127.0.0.1")},
+		},
+	}
+	before := zedcloud.GetCloudMetrics()["lo"]
+	url := server.URL + "/wpad.dat"
+	if _, err := getPacFile(&port, url); err != nil {
+		t.Fatal(err)
+	}
+	after := zedcloud.GetCloudMetrics()["lo"]
+	if after.SuccessCount != before.SuccessCount+1 ||
+		after.LatencyCount != before.LatencyCount+1 {
+		t.Errorf("not accounted: before %+v after %+v", before, after)
+	}
+	if after.UrlCounters[url].RecvMsgCount != 1 {
+		t.Errorf("url not accounted: %+v", after.UrlCounters[url])
+	}
+}
@@ -98,7 +98,7 @@ func IfindexToName(index int) (string, string, error) {
 		return n.linkName, n.linkType, nil
 	}
 	// Try a lookup to handle race
-	link, err := netlink.LinkByIndex(index)
+	link, err := Netlink.LinkByIndex(index)
 	if err != nil {
 		return "", "", errors.New(fmt.Sprintf("Unknown ifindex %d", index))
 	}
@@ -118,7 +118,7 @@ func IfnameToIndex(ifname string) (int, error) {
 		}
 	}
 	// Try a lookup to handle race
-	link, err := netlink.LinkByName(ifname)
+	link, err := Netlink.LinkByName(ifname)
 	if err != nil {
 		return -1, errors.New(fmt.Sprintf("Unknown ifname %s", ifname))
 	}
@@ -131,9 +131,11 @@ func IfnameToIndex(ifname string) (int, error) {
 	return index, nil
 }
 
-// We skip things not considered to be device links, loopback, non-broadcast,
-// and children of a bridge master.
+// We skip things not considered to be device links, loopback, and
+// children of a bridge master.
 // Match "vif.*" and "nbu.*" for name and skip those as well.
+// Beyond that the interface must be Ethernet, WiFi, or a cellular modem
+// according to sysfs; the modems are typically not broadcast.
 // Returns (relevant, up)
 func RelevantLastResort(link netlink.Link) (bool, bool) {
 	attrs := link.Attrs()
@@ -141,18 +143,21 @@ func RelevantLastResort(link netlink.Link) (bool, bool) {
 	linkType := link.Type()
 	linkFlags := attrs.Flags
 	loopbackFlag := (linkFlags & net.FlagLoopback) != 0
-	broadcastFlag := (linkFlags & net.FlagBroadcast) != 0
 	upFlag := (attrs.OperState == netlink.OperUp)
 	isVif := strings.HasPrefix(ifname, "vif") || strings.HasPrefix(ifname, "nbu")
-	if linkType == "device" && !loopbackFlag && broadcastFlag &&
-		attrs.MasterIndex == 0 && !isVif {
-
-		log.Infof("Relevant %s up %t operState %s\n",
-			ifname, upFlag, attrs.OperState.String())
-		return true, upFlag
-	} else {
+	if linkType != "device" || loopbackFlag || attrs.MasterIndex != 0 ||
+		isVif {
+		return false, false
+	}
+	class := ClassifyPort(ifname)
+	if class == PortClassNone {
+		log.Debugf("Not relevant %s: no Ethernet, WiFi, or modem\n",
+			ifname)
 		return false, false
 	}
+	log.Infof("Relevant %s %s up %t operState %s\n",
+		ifname, class, upFlag, attrs.OperState.String())
+	return true, upFlag
 }
 
 // Return map[string] bool up
@@ -0,0 +1,167 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Snapshot of the kernel network state when a DevicePortConfig fails its
+// test, for post-mortem by support. Each snapshot is a directory under
+// netdumpDir named by the UTC time; the oldest are removed so there are at
+// most netdumpMaxCount, and we take at most one per netdumpMinInterval.
+
+package devicenetwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+const (
+	netdumpDir         = "/persist/netdump"
+	netdumpMaxCount    = 10
+	netdumpMinInterval = 10 * time.Minute
+	dmesgTailLines     = 200
+)
+
+// The commands whose output is saved; the file name is the arguments
+// joined by dashes
+var netdumpCommands = [][]string{
+	{"ip", "addr", "show"},
+	{"ip", "-s", "link", "show"},
+	{"ip", "rule", "show"},
+	{"ip", "route", "show", "table", "all"},
+	{"ip", "-6", "route", "show", "table", "all"},
+	{"ip", "neigh", "show"},
+}
+
+var netdump struct {
+	sync.Mutex
+	last time.Time
+}
+
+// dumpNetworkState saves the snapshot in the background unless one was
+// taken recently
+func dumpNetworkState(dpc types.DevicePortConfig) {
+	netdump.Lock()
+	defer netdump.Unlock()
+	now := time.Now()
+	if !netdump.last.IsZero() && now.Sub(netdump.last) < netdumpMinInterval {
+		log.Debugf("dumpNetworkState: skipped since last at %v\n",
+			netdump.last)
+		return
+	}
+	netdump.last = now
+	go func() {
+		dirName := fmt.Sprintf("%s/%s", netdumpDir,
+			now.UTC().Format("20060102T150405Z"))
+		if err := writeNetdump(dirName, dpc); err != nil {
+			log.Errorf("dumpNetworkState(%s) failed: %s\n", dirName, err)
+			return
+		}
+		log.Infof("dumpNetworkState saved %s\n", dirName)
+		pruneNetdumps(netdumpDir, netdumpMaxCount)
+	}()
+}
+
+func writeNetdump(dirName string, dpc types.DevicePortConfig) error {
+	if err := os.MkdirAll(dirName, 0700); err != nil {
+		return err
+	}
+	// Not to be saved
+	dpc.Ports = append([]types.NetworkPortConfig{}, dpc.Ports...)
+	for i := range dpc.Ports {
+		port := &dpc.Ports[i]
+		port.Proxies = append([]types.ProxyEntry{}, port.Proxies...)
+		for j := range port.Proxies {
+			if port.Proxies[j].Password != "" {
+				port.Proxies[j].Password = "<redacted>"
+			}
+		}
+	}
+	b, err := json.MarshalIndent(dpc, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dirName+"/dpc.json", b, 0600); err != nil {
+		return err
+	}
+	for _, args := range netdumpCommands {
+		// Include the error in the file
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			out = append(out, []byte(fmt.Sprintf("\n%s failed: %s\n",
+				args[0], err))...)
+		}
+		filename := fmt.Sprintf("%s/%s.txt", dirName,
+			strings.Join(args, "-"))
+		if err := ioutil.WriteFile(filename, out, 0600); err != nil {
+			return err
+		}
+	}
+	out, err := exec.Command("dmesg").Output()
+	if err != nil {
+		log.Warnf("writeNetdump: dmesg failed: %s\n", err)
+	}
+	lines := filterDmesg(strings.Split(string(out), "\n"),
+		dmesgPatterns(dpc), dmesgTailLines)
+	return ioutil.WriteFile(dirName+"/dmesg.txt",
+		[]byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// dmesgPatterns returns the names of the ports and their drivers
+func dmesgPatterns(dpc types.DevicePortConfig) []string {
+	var patterns []string
+	for _, port := range dpc.Ports {
+		patterns = append(patterns, port.IfName)
+		link, err := os.Readlink(fmt.Sprintf("/sys/class/net/%s/device/driver",
+			port.IfName))
+		if err == nil {
+			patterns = append(patterns, path.Base(link))
+		}
+	}
+	return patterns
+}
+
+// filterDmesg returns the last max lines containing any of the patterns
+func filterDmesg(lines []string, patterns []string, max int) []string {
+	var result []string
+	for _, line := range lines {
+		for _, pattern := range patterns {
+			if pattern != "" && strings.Contains(line, pattern) {
+				result = append(result, line)
+				break
+			}
+		}
+	}
+	if len(result) > max {
+		result = result[len(result)-max:]
+	}
+	return result
+}
+
+// pruneNetdumps removes the oldest snapshots so at most max remain
+func pruneNetdumps(dirName string, max int) {
+	dirs, err := filepath.Glob(dirName + "/*")
+	if err != nil {
+		log.Errorf("pruneNetdumps: %s\n", err)
+		return
+	}
+	// Names sort by time
+	sort.Strings(dirs)
+	for len(dirs) > max {
+		log.Infof("pruneNetdumps removing %s\n", dirs[0])
+		if err := os.RemoveAll(dirs[0]); err != nil {
+			log.Errorf("pruneNetdumps: %s\n", err)
+		}
+		dirs = dirs[1:]
+	}
+}
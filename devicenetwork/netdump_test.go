@@ -0,0 +1,48 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterDmesg(t *testing.T) {
+	lines := []string{
+		"[    1.0] e1000e 0000:00:19.0 eth0: NIC Link is Up",
+		"[    2.0] usb 1-1: new high-speed USB device",
+		"[    3.0] e1000e 0000:00:19.0 eth0: NIC Link is Down",
+		"[    4.0] wlan0: authenticated",
+		"[    5.0] igb 0000:03:00.0: reset",
+	}
+	result := filterDmesg(lines, []string{"eth0", "", "igb"}, 2)
+	if len(result) != 2 || result[0] != lines[2] || result[1] != lines[4] {
+		t.Errorf("Unexpected filterDmesg %v", result)
+	}
+	if result := filterDmesg(lines, nil, 10); len(result) != 0 {
+		t.Errorf("Unexpected filterDmesg without patterns %v", result)
+	}
+}
+
+func TestPruneNetdumps(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "netdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dirName)
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("%s/20190601T12000%dZ", dirName, i)
+		if err := os.Mkdir(name, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pruneNetdumps(dirName, 3)
+	dirs, _ := filepath.Glob(dirName + "/*")
+	if len(dirs) != 3 || filepath.Base(dirs[0]) != "20190601T120003Z" {
+		t.Errorf("Unexpected after prune %v", dirs)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// The netlink calls used to query and change the links, addresses,
+// routes, and rules go through Netlink so that tests can replace it with
+// a FakeNetlink and run without root privileges. The subscriptions in
+// addrchange.go are not included; tests feed the updates directly.
+
+package devicenetwork
+
+import (
+	"github.com/eriknordmark/netlink"
+)
+
+// NetlinkAPI is the subset of the netlink package we use
+type NetlinkAPI interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkByIndex(index int) (netlink.Link, error)
+	LinkSetUp(link netlink.Link) error
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+	AddrAdd(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	RouteListFiltered(family int, filter *netlink.Route,
+		filterMask uint64) ([]netlink.Route, error)
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+	RuleList(family int) ([]netlink.Rule, error)
+	RuleAdd(rule *netlink.Rule) error
+	RuleDel(rule *netlink.Rule) error
+}
+
+// Netlink is used by devicenetwork and the PBR code in zedrouter
+var Netlink NetlinkAPI = realNetlink{}
+
+// Calls the netlink package
+type realNetlink struct{}
+
+func (realNetlink) LinkByName(name string) (netlink.Link, error) {
+	return netlink.LinkByName(name)
+}
+
+func (realNetlink) LinkByIndex(index int) (netlink.Link, error) {
+	return netlink.LinkByIndex(index)
+}
+
+func (realNetlink) LinkSetUp(link netlink.Link) error {
+	return netlink.LinkSetUp(link)
+}
+
+func (realNetlink) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	return netlink.AddrList(link, family)
+}
+
+func (realNetlink) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	return netlink.AddrAdd(link, addr)
+}
+
+func (realNetlink) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	return netlink.AddrDel(link, addr)
+}
+
+func (realNetlink) RouteListFiltered(family int, filter *netlink.Route,
+	filterMask uint64) ([]netlink.Route, error) {
+	return netlink.RouteListFiltered(family, filter, filterMask)
+}
+
+func (realNetlink) RouteAdd(route *netlink.Route) error {
+	return netlink.RouteAdd(route)
+}
+
+func (realNetlink) RouteDel(route *netlink.Route) error {
+	return netlink.RouteDel(route)
+}
+
+func (realNetlink) RuleList(family int) ([]netlink.Rule, error) {
+	return netlink.RuleList(family)
+}
+
+func (realNetlink) RuleAdd(rule *netlink.Rule) error {
+	return netlink.RuleAdd(rule)
+}
+
+func (realNetlink) RuleDel(rule *netlink.Rule) error {
+	return netlink.RuleDel(rule)
+}
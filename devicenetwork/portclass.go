@@ -0,0 +1,83 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Classify the network interfaces present on the system based on sysfs so
+// that the last resort DevicePortConfig includes Ethernet, WiFi, and
+// cellular modems but not bridges, vifs, and other virtual interfaces.
+
+package devicenetwork
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PortClass is the kind of hardware behind an interface
+type PortClass uint8
+
+const (
+	PortClassNone PortClass = iota // Virtual or unknown
+	PortClassEthernet
+	PortClassWlan
+	PortClassWwan
+)
+
+func (class PortClass) String() string {
+	switch class {
+	case PortClassNone:
+		return "none"
+	case PortClassEthernet:
+		return "ethernet"
+	case PortClassWlan:
+		return "wlan"
+	case PortClassWwan:
+		return "wwan"
+	default:
+		return fmt.Sprintf("Unknown PortClass %d", class)
+	}
+}
+
+const arphrdEther = "1"
+
+// Replaced by tests
+var sysfsNetDir = "/sys/class/net"
+
+// ClassifyPort returns the class for the interface name
+func ClassifyPort(ifname string) PortClass {
+	return classifyPort(sysfsNetDir, ifname)
+}
+
+func classifyPort(netDir string, ifname string) PortClass {
+	dir := filepath.Join(netDir, ifname)
+	// Only interfaces backed by a device; excludes bridges, vifs, etc
+	if !pathExists(filepath.Join(dir, "device")) {
+		return PortClassNone
+	}
+	if pathExists(filepath.Join(dir, "bridge")) {
+		return PortClassNone
+	}
+	if pathExists(filepath.Join(dir, "wireless")) ||
+		pathExists(filepath.Join(dir, "phy80211")) {
+		return PortClassWlan
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "uevent")); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if line == "DEVTYPE=wwan" {
+				return PortClassWwan
+			}
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "type"))
+	if err == nil && strings.TrimSpace(string(b)) == arphrdEther {
+		return PortClassEthernet
+	}
+	return PortClassNone
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portclass_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"eth0/device/vendor":   "0x8086\n",
+		"eth0/type":            "1\n",
+		"eth0/uevent":          "INTERFACE=eth0\nIFINDEX=2\n",
+		"wlan0/device/vendor":  "0x8086\n",
+		"wlan0/type":           "1\n",
+		"wlan0/phy80211/name":  "phy0\n",
+		"wwan0/device/vendor":  "\n",
+		"wwan0/type":           "65534\n",
+		"wwan0/uevent":         "DEVTYPE=wwan\nINTERFACE=wwan0\n",
+		"br0/type":             "1\n",
+		"br0/bridge/stp_state": "0\n",
+		"vif1.0/type":          "1\n",
+		"can0/device/vendor":   "\n",
+		"can0/type":            "280\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]PortClass{
+		"eth0":   PortClassEthernet,
+		"wlan0":  PortClassWlan,
+		"wwan0":  PortClassWwan,
+		"br0":    PortClassNone,
+		"vif1.0": PortClassNone,
+		"can0":   PortClassNone,
+		"eth9":   PortClassNone,
+	}
+	for ifname, class := range expected {
+		if got := classifyPort(dir, ifname); got != class {
+			t.Errorf("%s: got %s expected %s", ifname, got, class)
+		}
+	}
+}
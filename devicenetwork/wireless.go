@@ -0,0 +1,108 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Wireless details of a port for NetworkPortStatus. The wifi signal and
+// the counters come from the kernel. The cellular signal and serving
+// system come from the files written by the wwan service, which are also
+// reported as metrics by zedagent.
+
+package devicenetwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+// Replaced by tests
+var procNetWireless = "/proc/net/wireless"
+var wwanSignalFile = "/run/wwan/signal-info.json"
+var wwanServingFile = "/run/wwan/serving-system.json"
+
+// GetWirelessStatus returns nil for wired ports
+func GetWirelessStatus(ifname string) *types.WirelessStatus {
+	return getWirelessStatus(sysfsNetDir, ifname)
+}
+
+func getWirelessStatus(netDir string, ifname string) *types.WirelessStatus {
+	var ws types.WirelessStatus
+	switch classifyPort(netDir, ifname) {
+	case PortClassWlan:
+		ws.Type = types.WirelessTypeWifi
+		ws.SignalStrength = wifiSignal(procNetWireless, ifname)
+	case PortClassWwan:
+		ws.Type = types.WirelessTypeCellular
+		if m := readWwanFile(wwanSignalFile); m != nil {
+			if rssi, ok := m["rssi"].(float64); ok {
+				ws.SignalStrength = int(rssi)
+			}
+		}
+		// The operator as MCC-MNC
+		if m := readWwanFile(wwanServingFile); m != nil {
+			mcc, mnc := m["mcc"], m["mnc"]
+			if mcc != nil && mnc != nil {
+				ws.Operator = fmt.Sprintf("%v-%v", mcc, mnc)
+			}
+		}
+	default:
+		return nil
+	}
+	statsDir := filepath.Join(netDir, ifname, "statistics")
+	ws.RxBytes = readCounter(filepath.Join(statsDir, "rx_bytes"))
+	ws.TxBytes = readCounter(filepath.Join(statsDir, "tx_bytes"))
+	return &ws
+}
+
+// wifiSignal returns the level in dBm from /proc/net/wireless, where
+// the lines after the two header lines look like
+// wlan0: 0000   54.  -56.  -256        0      0      0      0      0        0
+func wifiSignal(filename string, ifname string) int {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Debugf("wifiSignal: %s\n", err)
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != ifname+":" {
+			continue
+		}
+		level, err := strconv.ParseFloat(strings.TrimSuffix(fields[3], "."),
+			64)
+		if err != nil {
+			log.Warnf("wifiSignal: bad level in %s: %s\n", filename, line)
+			return 0
+		}
+		return int(level)
+	}
+	return 0
+}
+
+func readWwanFile(filename string) map[string]interface{} {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Debugf("readWwanFile: %s\n", err)
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		log.Errorf("readWwanFile(%s): %s\n", filename, err)
+		return nil
+	}
+	return m
+}
+
+func readCounter(filename string) uint64 {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+	u, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return u
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicenetwork
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestGetWirelessStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wireless_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"net/eth0/device/vendor":        "0x8086\n",
+		"net/eth0/type":                 "1\n",
+		"net/wlan0/device/vendor":       "0x8086\n",
+		"net/wlan0/type":                "1\n",
+		"net/wlan0/wireless/status":     "\n",
+		"net/wlan0/statistics/rx_bytes": "1000\n",
+		"net/wlan0/statistics/tx_bytes": "2000\n",
+		"net/wwan0/device/vendor":       "\n",
+		"net/wwan0/type":                "65534\n",
+		"net/wwan0/uevent":              "DEVTYPE=wwan\nINTERFACE=wwan0\n",
+		"net/wwan0/statistics/rx_bytes": "3000\n",
+		"proc/wireless": "Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE\n" +
+			" face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22\n" +
+			"wlan0: 0000   54.  -56.  -256        0      0      0      0      0        0\n",
+		"wwan/signal-info.json":    `{"rssi": -71, "rsrq": -9}`,
+		"wwan/serving-system.json": `{"rat": "lte", "mcc": 310, "mnc": 410}`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	savedProc, savedSignal, savedServing := procNetWireless, wwanSignalFile,
+		wwanServingFile
+	procNetWireless = filepath.Join(dir, "proc/wireless")
+	wwanSignalFile = filepath.Join(dir, "wwan/signal-info.json")
+	wwanServingFile = filepath.Join(dir, "wwan/serving-system.json")
+	defer func() {
+		procNetWireless, wwanSignalFile, wwanServingFile = savedProc,
+			savedSignal, savedServing
+	}()
+	netDir := filepath.Join(dir, "net")
+
+	if ws := getWirelessStatus(netDir, "eth0"); ws != nil {
+		t.Errorf("eth0 got %+v\n", ws)
+	}
+	ws := getWirelessStatus(netDir, "wlan0")
+	if ws == nil || ws.Type != types.WirelessTypeWifi ||
+		ws.SignalStrength != -56 || ws.RxBytes != 1000 ||
+		ws.TxBytes != 2000 {
+		t.Errorf("wlan0 got %+v\n", ws)
+	}
+	ws = getWirelessStatus(netDir, "wwan0")
+	if ws == nil || ws.Type != types.WirelessTypeCellular ||
+		ws.SignalStrength != -71 || ws.Operator != "310-410" ||
+		ws.RxBytes != 3000 || ws.TxBytes != 0 {
+		t.Errorf("wwan0 got %+v\n", ws)
+	}
+}
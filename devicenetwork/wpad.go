@@ -10,8 +10,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/types"
 	"github.com/zededa/go-provision/zedcloud"
+	"io/ioutil"
 	"mime"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // Download a wpad file if so configured
@@ -36,8 +39,7 @@ func CheckAndGetNetworkProxy(deviceNetworkStatus *types.DeviceNetworkStatus,
 		return nil
 	}
 	if proxyConfig.NetworkProxyURL != "" {
-		pac, err := getPacFile(deviceNetworkStatus,
-			proxyConfig.NetworkProxyURL, ifname)
+		pac, err := getPacFile(status, proxyConfig.NetworkProxyURL)
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to fetch %s for %s: %s",
 				proxyConfig.NetworkProxyURL, ifname, err)
@@ -60,7 +62,7 @@ func CheckAndGetNetworkProxy(deviceNetworkStatus *types.DeviceNetworkStatus,
 	// in DomainName until we succeed
 	for {
 		url := fmt.Sprintf("http://wpad.%s/wpad.dat", dn)
-		pac, err := getPacFile(deviceNetworkStatus, url, ifname)
+		pac, err := getPacFile(status, url)
 		if err == nil {
 			proxyConfig.Pacfile = pac
 			proxyConfig.WpadURL = url
@@ -90,22 +92,26 @@ func CheckAndGetNetworkProxy(deviceNetworkStatus *types.DeviceNetworkStatus,
 	}
 }
 
-var ctx = zedcloud.ZedCloudContext{
-	FailureFunc: zedcloud.ZedCloudFailure,
-	SuccessFunc: zedcloud.ZedCloudSuccess,
-}
+// Timeout for fetching the wpad.dat
+const pacFileTimeout = 15 * time.Second
 
-func getPacFile(status *types.DeviceNetworkStatus, url string,
-	ifname string) (string, error) {
+func getPacFile(status *types.NetworkPortStatus, url string) (string, error) {
 
-	ctx.DeviceNetworkStatus = status
-	// Avoid using a proxy to fetch the wpad.dat; 15 second timeout
-	const allowProxy = false
-	resp, contents, err := zedcloud.SendOnIntf(ctx, url, ifname, 0, nil,
-		allowProxy, 15)
+	ifname := status.IfName
+	// Avoid using a proxy to fetch the wpad.dat
+	client, err := NewPortHTTPClient(*status, pacFileTimeout)
+	if err != nil {
+		return "", err
+	}
+	resp, contents, err := fetchWithMetrics(client, ifname, url)
 	if err != nil {
 		return "", err
 	}
+	if resp.StatusCode != http.StatusOK {
+		errStr := fmt.Sprintf("%s got statuscode %d %s", url,
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+		return "", errors.New(errStr)
+	}
 	contentType := resp.Header.Get("Content-Type")
 	if contentType == "" {
 		errStr := fmt.Sprintf("%s no content-type\n", url)
@@ -128,3 +134,32 @@ func getPacFile(status *types.DeviceNetworkStatus, url string,
 		return "", errors.New(errStr)
 	}
 }
+
+// fetchWithMetrics does a GET and records it in the zedcloud metrics and
+// bandwidth for ifname like SendOnIntf does
+func fetchWithMetrics(client *http.Client, ifname string,
+	url string) (*http.Response, []byte, error) {
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	var contents []byte
+	if err == nil {
+		contents, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	zedcloud.ZedCloudMetricsHook(req, ifname, resp, contents, err,
+		time.Since(start))
+	if err != nil {
+		zedcloud.ZedCloudFailure(ifname, url, 0, 0)
+		return nil, nil, err
+	}
+	// Any response means the port works
+	resplen := int64(len(contents))
+	zedcloud.ZedCloudSuccess(ifname, url, 0, resplen)
+	zedcloud.AddBandwidth(ifname, zedcloud.CategoryOther, 0, resplen)
+	return resp, contents, nil
+}
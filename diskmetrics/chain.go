@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Backing file chains of qcow2 images
+
+package diskmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest backing file chain we follow
+const maxChainDepth = 16
+
+// GetImgChain returns the image followed by its backing files, the base
+// image last. Uses qemu-img if installed, otherwise it parses the headers.
+func GetImgChain(diskfile string) ([]ImgInfo, error) {
+	if _, err := os.Stat(diskfile); err != nil {
+		return nil, err
+	}
+	path, err := qemuImg()
+	if err != nil {
+		log.Debugf("GetImgChain(%s): %s; parsing headers\n", diskfile, err)
+		return parseImgChain(diskfile)
+	}
+	output, err := exec.Command(path, "info", "-U", "--backing-chain",
+		"--output=json", diskfile).CombinedOutput()
+	if err != nil {
+		errStr := fmt.Sprintf("qemu-img failed: %s, %s\n",
+			err, output)
+		return nil, errors.New(errStr)
+	}
+	var chain []ImgInfo
+	if err := json.Unmarshal(output, &chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// parseImgChain follows the backing files using parseImgInfo
+func parseImgChain(diskfile string) ([]ImgInfo, error) {
+	var chain []ImgInfo
+	seen := make(map[string]bool)
+	filename := diskfile
+	for {
+		if seen[filename] {
+			errStr := fmt.Sprintf("Backing file loop at %s in %s",
+				filename, diskfile)
+			return chain, errors.New(errStr)
+		}
+		if len(chain) == maxChainDepth {
+			errStr := fmt.Sprintf("Backing chain of %s longer than %d",
+				diskfile, maxChainDepth)
+			return chain, errors.New(errStr)
+		}
+		seen[filename] = true
+		imgInfo, err := parseImgInfo(filename)
+		if err != nil {
+			return chain, err
+		}
+		if imgInfo.BackingFilename != "" {
+			imgInfo.FullBackingFilename = backingPath(filename,
+				imgInfo.BackingFilename)
+		}
+		chain = append(chain, *imgInfo)
+		if imgInfo.FullBackingFilename == "" {
+			return chain, nil
+		}
+		filename = imgInfo.FullBackingFilename
+	}
+}
+
+// backingPath resolves a relative backing file name against the
+// directory of the image
+func backingPath(filename string, backing string) string {
+	if filepath.IsAbs(backing) {
+		return filepath.Clean(backing)
+	}
+	return filepath.Join(filepath.Dir(filename), backing)
+}
+
+// ValidateImgChain checks that all backing files of the image exist and
+// have the format recorded in the image referring to them
+func ValidateImgChain(diskfile string) error {
+	chain, err := GetImgChain(diskfile)
+	if err != nil {
+		return err
+	}
+	return checkImgChain(diskfile, chain)
+}
+
+func checkImgChain(diskfile string, chain []ImgInfo) error {
+	if len(chain) == 0 {
+		errStr := fmt.Sprintf("No image info for %s", diskfile)
+		return errors.New(errStr)
+	}
+	for i, imgInfo := range chain {
+		if imgInfo.BackingFilename == "" {
+			if i != len(chain)-1 {
+				errStr := fmt.Sprintf("Chain of %s continues after base %s",
+					diskfile, imgInfo.Filename)
+				return errors.New(errStr)
+			}
+			return nil
+		}
+		if i == len(chain)-1 {
+			errStr := fmt.Sprintf("Missing backing file %s of %s",
+				imgInfo.BackingFilename, imgInfo.Filename)
+			return errors.New(errStr)
+		}
+		next := chain[i+1]
+		if imgInfo.BackingFormat != "" &&
+			imgInfo.BackingFormat != next.Format {
+			errStr := fmt.Sprintf("Backing file %s of %s is %s not %s",
+				next.Filename, imgInfo.Filename, next.Format,
+				imgInfo.BackingFormat)
+			return errors.New(errStr)
+		}
+	}
+	return nil
+}
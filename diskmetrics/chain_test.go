@@ -0,0 +1,108 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeQcow2 writes a v3 qcow2 header with an optional backing file and
+// one snapshot named snapName if set
+func writeQcow2(t *testing.T, filename string, backing string,
+	backingFormat string, snapName string) {
+
+	img := make([]byte, 2048)
+	copy(img, qcow2Magic)
+	binary.BigEndian.PutUint32(img[4:8], 3)
+	binary.BigEndian.PutUint32(img[20:24], 16)
+	binary.BigEndian.PutUint64(img[24:32], 1<<30)
+	binary.BigEndian.PutUint32(img[100:104], 104)
+	ext := 104
+	if backingFormat != "" {
+		binary.BigEndian.PutUint32(img[ext:ext+4], qcow2ExtBackingFormat)
+		binary.BigEndian.PutUint32(img[ext+4:ext+8], uint32(len(backingFormat)))
+		copy(img[ext+8:], backingFormat)
+	}
+	if backing != "" {
+		binary.BigEndian.PutUint64(img[8:16], 512)
+		binary.BigEndian.PutUint32(img[16:20], uint32(len(backing)))
+		copy(img[512:], backing)
+	}
+	if snapName != "" {
+		binary.BigEndian.PutUint32(img[60:64], 1)
+		binary.BigEndian.PutUint64(img[64:72], 1024)
+		snap := img[1024:]
+		binary.BigEndian.PutUint16(snap[12:14], 1)
+		binary.BigEndian.PutUint16(snap[14:16], uint16(len(snapName)))
+		binary.BigEndian.PutUint32(snap[16:20], 1500000000)
+		binary.BigEndian.PutUint64(snap[24:32], 2500000000)
+		binary.BigEndian.PutUint32(snap[36:40], 16)
+		copy(snap[56:], "1"+snapName)
+	}
+	if err := ioutil.WriteFile(filename, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseImgChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskmetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base.img")
+	if err := ioutil.WriteFile(base, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	top := filepath.Join(dir, "top.qcow2")
+	writeQcow2(t, top, "base.img", "raw", "before-upgrade")
+
+	chain, err := parseImgChain(top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain[0].FullBackingFilename != base ||
+		chain[0].BackingFormat != "raw" || chain[1].Format != "raw" {
+		t.Fatalf("Got %+v", chain)
+	}
+	snaps := chain[0].Snapshots
+	if len(snaps) != 1 || snaps[0].ID != "1" ||
+		snaps[0].Name != "before-upgrade" ||
+		snaps[0].DateSec != 1500000000 || snaps[0].VMClockSec != 2 ||
+		snaps[0].VMClockNsec != 500000000 {
+		t.Errorf("Got %+v", snaps)
+	}
+	if err := checkImgChain(top, chain); err != nil {
+		t.Errorf("Unexpected %s", err)
+	}
+
+	// Recorded format does not match
+	writeQcow2(t, top, "base.img", "qcow2", "")
+	chain, _ = parseImgChain(top)
+	if err := checkImgChain(top, chain); err == nil {
+		t.Errorf("Expected format mismatch for %+v", chain)
+	}
+
+	// Missing backing file
+	writeQcow2(t, top, "gone.img", "", "")
+	if _, err := parseImgChain(top); err == nil {
+		t.Errorf("Expected error for missing backing file")
+	}
+	chain = []ImgInfo{{Filename: top, Format: "qcow2",
+		BackingFilename: "gone.img"}}
+	if err := checkImgChain(top, chain); err == nil {
+		t.Errorf("Expected error for incomplete chain")
+	}
+
+	// Loop
+	writeQcow2(t, top, "top.qcow2", "qcow2", "")
+	if _, err := parseImgChain(top); err == nil {
+		t.Errorf("Expected error for loop")
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DirImgInfo returns the info of the image files in the directory tree.
+// Files which can not be read are skipped.
+func DirImgInfo(dirname string) []ImgInfo {
+	var infos []ImgInfo
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Errorf("DirImgInfo(%s): %s\n", path, err)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		imgInfo, err := GetImgInfo(path)
+		if err != nil {
+			log.Errorf("DirImgInfo(%s): %s\n", path, err)
+			return nil
+		}
+		infos = append(infos, *imgInfo)
+		return nil
+	}
+	filepath.Walk(dirname, walkFn)
+	return infos
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Image conversion and resize with progress. The context bounds how long
+// they can run and cancels them.
+
+package diskmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ProgressFunc is called with the percent done
+type ProgressFunc func(percent float64)
+
+// Chunk size when copying raw images without qemu-img
+const copyChunkSize = 1024 * 1024
+
+// ConvertImage writes src to dst in the format, e.g. "qcow2" or "raw".
+// progress can be nil. Without qemu-img only raw to raw is supported.
+// A partial dst is removed on failure.
+func ConvertImage(ctx context.Context, src string, dst string,
+	format string, progress ProgressFunc) error {
+
+	log.Infof("ConvertImage(%s, %s, %s)\n", src, dst, format)
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	var err error
+	path, lookErr := qemuImg()
+	if lookErr == nil {
+		err = runQemuImg(ctx, path, progress, "convert", "-p",
+			"-O", format, src, dst)
+	} else {
+		err = convertRaw(ctx, src, dst, format, progress)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	log.Infof("ConvertImage(%s, %s, %s) done\n", src, dst, format)
+	return nil
+}
+
+// ResizeImage sets the virtual size of the image. Without qemu-img only
+// raw images can be grown.
+func ResizeImage(ctx context.Context, diskfile string, newsize uint64) error {
+
+	log.Infof("ResizeImage(%s, %d)\n", diskfile, newsize)
+	if _, err := os.Stat(diskfile); err != nil {
+		return err
+	}
+	path, err := qemuImg()
+	if err != nil {
+		return resizeRaw(diskfile, newsize)
+	}
+	return runQemuImg(ctx, path, nil, "resize", diskfile,
+		strconv.FormatUint(newsize, 10))
+}
+
+// runQemuImg passes the progress lines in the output to progress
+func runQemuImg(ctx context.Context, path string, progress ProgressFunc,
+	args ...string) error {
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanProgress)
+	for scanner.Scan() {
+		percent, ok := parseProgress(scanner.Text())
+		if ok && progress != nil {
+			progress(percent)
+		}
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		errStr := fmt.Sprintf("qemu-img %s: %s", args[0], ctx.Err())
+		return errors.New(errStr)
+	}
+	if err != nil {
+		errStr := fmt.Sprintf("qemu-img %s failed: %s, %s",
+			args[0], err, stderr.String())
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// scanProgress splits on carriage returns as well as newlines since
+// qemu-img rewrites the progress line in place
+func scanProgress(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) != 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// parseProgress parses "(12.34/100%)"
+func parseProgress(line string) (float64, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "(") || !strings.HasSuffix(line, "/100%)") {
+		return 0, false
+	}
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "("), "/100%)")
+	percent, err := strconv.ParseFloat(line, 64)
+	if err != nil {
+		return 0, false
+	}
+	return percent, true
+}
+
+// convertRaw copies a raw image in chunks checking for cancellation
+func convertRaw(ctx context.Context, src string, dst string,
+	format string, progress ProgressFunc) error {
+
+	imgInfo, err := parseImgInfo(src)
+	if err != nil {
+		return err
+	}
+	if imgInfo.Format != "raw" || format != "raw" {
+		errStr := fmt.Sprintf("Can not convert %s image %s to %s without qemu-img",
+			imgInfo.Format, src, format)
+		return errors.New(errStr)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	total := imgInfo.VirtualSize
+	var done uint64
+	buf := make([]byte, copyChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			errStr := fmt.Sprintf("convert %s: %s", src, err)
+			return errors.New(errStr)
+		}
+		n, err := in.Read(buf)
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			done += uint64(n)
+			if progress != nil && total != 0 {
+				progress(float64(done) * 100 / float64(total))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if progress != nil && total == 0 {
+		progress(100)
+	}
+	return out.Sync()
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgress(t *testing.T) {
+	out := "    (0.00/100%)\r    (50.50/100%)\r    (100.00/100%)\r\nnot progress\n(x/100%)"
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Split(scanProgress)
+	var got []float64
+	for scanner.Scan() {
+		if percent, ok := parseProgress(scanner.Text()); ok {
+			got = append(got, percent)
+		}
+	}
+	expected := []float64{0, 50.5, 100}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v expected %v", got, expected)
+	}
+}
+
+func TestRunQemuImg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskmetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for qemu-img
+	script := filepath.Join(dir, "qemu-img")
+	content := `#!/bin/sh
+printf '    (0.00/100%%)\r    (42.00/100%%)\r'
+[ "$1" = "sleep" ] && exec sleep 10
+[ "$1" = "fail" ] && echo "bad image" >&2 && exit 1
+printf '    (100.00/100%%)\r\n'
+`
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	progress := func(percent float64) { got = append(got, percent) }
+
+	if err := runQemuImg(context.Background(), script, progress,
+		"convert"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []float64{0, 42, 100}) {
+		t.Errorf("Got progress %v", got)
+	}
+
+	err = runQemuImg(context.Background(), script, nil, "fail")
+	if err == nil || !strings.Contains(err.Error(), "bad image") {
+		t.Errorf("Expected failure got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = runQemuImg(ctx, script, nil, "sleep")
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("Expected timeout got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Timeout did not stop qemu-img")
+	}
+}
+
+func TestConvertRaw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskmetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src.img")
+	data := make([]byte, 3*copyChunkSize/2)
+	data[len(data)-1] = 1
+	if err := ioutil.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst.img")
+	var got []float64
+	progress := func(percent float64) { got = append(got, percent) }
+	if err := convertRaw(context.Background(), src, dst, "raw",
+		progress); err != nil {
+		t.Fatal(err)
+	}
+	if copied, _ := ioutil.ReadFile(dst); !reflect.DeepEqual(copied, data) {
+		t.Errorf("Copy differs")
+	}
+	if len(got) != 2 || got[1] != 100 {
+		t.Errorf("Got progress %v", got)
+	}
+
+	if err := convertRaw(context.Background(), src, dst, "qcow2",
+		nil); err == nil {
+		t.Errorf("Expected error converting to qcow2")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := convertRaw(ctx, src, dst, "raw", nil); err == nil {
+		t.Errorf("Expected error when cancelled")
+	}
+}
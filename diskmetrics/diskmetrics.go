@@ -9,25 +9,70 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// Where qemu-img is installed if not in PATH; the first is from the Xen
+// toolstack
+var qemuImgPaths = []string{
+	"/usr/lib/xen/bin/qemu-img",
+	"/usr/bin/qemu-img",
+	"/usr/local/bin/qemu-img",
+}
+
 // Matches the json output of qemu-img info
 type ImgInfo struct {
-	VirtualSize uint64 `json:"virtual-size"`
-	Filename    string `json:"filename"`
-	ClusterSize uint64 `json:"cluster-size"`
-	Format      string `json:"format"`
-	ActualSize  uint64 `json:"actual-size"`
-	DirtyFlag   bool   `json:"dirty-flag"`
+	VirtualSize         uint64        `json:"virtual-size"`
+	Filename            string        `json:"filename"`
+	ClusterSize         uint64        `json:"cluster-size"`
+	Format              string        `json:"format"`
+	ActualSize          uint64        `json:"actual-size"`
+	DirtyFlag           bool          `json:"dirty-flag"`
+	BackingFilename     string        `json:"backing-filename,omitempty"`
+	FullBackingFilename string        `json:"full-backing-filename,omitempty"`
+	BackingFormat       string        `json:"backing-filename-format,omitempty"`
+	Snapshots           []ImgSnapshot `json:"snapshots,omitempty"`
+}
+
+// ImgSnapshot is an internal snapshot in a qcow2 image
+type ImgSnapshot struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	VMStateSize uint64 `json:"vm-state-size"`
+	DateSec     int64  `json:"date-sec"`
+	DateNsec    int64  `json:"date-nsec"`
+	VMClockSec  int64  `json:"vm-clock-sec"`
+	VMClockNsec int64  `json:"vm-clock-nsec"`
 }
 
+// qemuImg returns the path of qemu-img
+func qemuImg() (string, error) {
+	if path, err := exec.LookPath("qemu-img"); err == nil {
+		return path, nil
+	}
+	for _, path := range qemuImgPaths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", errors.New("qemu-img not found")
+}
+
+// GetImgInfo uses qemu-img if installed, otherwise it parses the header
+// of qcow2 and raw images
 func GetImgInfo(diskfile string) (*ImgInfo, error) {
 	var imgInfo ImgInfo
 
 	if _, err := os.Stat(diskfile); err != nil {
 		return nil, err
 	}
-	output, err := exec.Command("/usr/lib/xen/bin/qemu-img",
+	path, err := qemuImg()
+	if err != nil {
+		log.Debugf("GetImgInfo(%s): %s; parsing header\n", diskfile, err)
+		return parseImgInfo(diskfile)
+	}
+	output, err := exec.Command(path,
 		"info", "-U", "--output=json", diskfile).CombinedOutput()
 	if err != nil {
 		errStr := fmt.Sprintf("qemu-img failed: %s, %s\n",
@@ -39,18 +84,3 @@ func GetImgInfo(diskfile string) (*ImgInfo, error) {
 	}
 	return &imgInfo, nil
 }
-
-func ResizeImg(diskfile string, newsize uint64) error {
-
-	if _, err := os.Stat(diskfile); err != nil {
-		return err
-	}
-	output, err := exec.Command("/usr/lib/xen/bin/qemu-img",
-		"resize", diskfile, fmt.Sprintf("%d", newsize)).CombinedOutput()
-	if err != nil {
-		errStr := fmt.Sprintf("qemu-img failed: %s, %s\n",
-			err, output)
-		return errors.New(errStr)
-	}
-	return nil
-}
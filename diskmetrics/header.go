@@ -0,0 +1,194 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Image info from the qcow2 header, or the file size for raw images,
+// for when qemu-img is not installed.
+
+package diskmetrics
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	qcow2Magic      = "QFI\xfb"
+	qcow2HeaderSize = 72   // Version 2 header
+	qcow2ReadSize   = 4096 // Header and extensions
+	qcow2MaxSnaps   = 65536
+	qcow2MaxName    = 1023 // Backing file name
+
+	// Header extension types
+	qcow2ExtEnd           = 0
+	qcow2ExtBackingFormat = 0xe2792aca
+)
+
+func parseImgInfo(diskfile string) (*ImgInfo, error) {
+	f, err := os.Open(diskfile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	imgInfo := ImgInfo{
+		Filename:    diskfile,
+		Format:      "raw",
+		VirtualSize: uint64(fi.Size()),
+		ActualSize:  uint64(fi.Size()),
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		// Sparse files use less
+		imgInfo.ActualSize = uint64(st.Blocks) * 512
+	}
+	hdr := make([]byte, qcow2ReadSize)
+	n, err := io.ReadFull(f, hdr)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if err := parseQcow2Header(hdr[:n], &imgInfo); err != nil {
+		return nil, err
+	}
+	if imgInfo.Format == "qcow2" {
+		if err := readQcow2Tables(f, hdr[:n], &imgInfo); err != nil {
+			return nil, err
+		}
+	}
+	return &imgInfo, nil
+}
+
+// parseQcow2Header sets the format, virtual size, cluster size and
+// backing format if the header is qcow2; otherwise it leaves imgInfo as is
+func parseQcow2Header(hdr []byte, imgInfo *ImgInfo) error {
+	if len(hdr) < len(qcow2Magic) || string(hdr[0:4]) != qcow2Magic {
+		return nil
+	}
+	if len(hdr) < qcow2HeaderSize {
+		errStr := fmt.Sprintf("Truncated qcow2 header in %s",
+			imgInfo.Filename)
+		return errors.New(errStr)
+	}
+	version := binary.BigEndian.Uint32(hdr[4:8])
+	if version < 2 {
+		errStr := fmt.Sprintf("Unsupported qcow version %d in %s",
+			version, imgInfo.Filename)
+		return errors.New(errStr)
+	}
+	clusterBits := binary.BigEndian.Uint32(hdr[20:24])
+	imgInfo.Format = "qcow2"
+	imgInfo.ClusterSize = 1 << clusterBits
+	imgInfo.VirtualSize = binary.BigEndian.Uint64(hdr[24:32])
+
+	// Header extensions follow the header
+	extOffset := qcow2HeaderSize
+	if version >= 3 && len(hdr) >= 104 {
+		hdrLen := int(binary.BigEndian.Uint32(hdr[100:104]))
+		if hdrLen > extOffset {
+			extOffset = hdrLen
+		}
+	}
+	for extOffset+8 <= len(hdr) {
+		extType := binary.BigEndian.Uint32(hdr[extOffset : extOffset+4])
+		extLen := int(binary.BigEndian.Uint32(hdr[extOffset+4 : extOffset+8]))
+		data := extOffset + 8
+		if extType == qcow2ExtEnd || data+extLen > len(hdr) {
+			break
+		}
+		if extType == qcow2ExtBackingFormat {
+			imgInfo.BackingFormat = string(hdr[data : data+extLen])
+		}
+		extOffset = data + (extLen+7)&^7
+	}
+	return nil
+}
+
+// readQcow2Tables reads the backing file name and the snapshot table
+func readQcow2Tables(f io.ReaderAt, hdr []byte, imgInfo *ImgInfo) error {
+	backingOffset := int64(binary.BigEndian.Uint64(hdr[8:16]))
+	backingSize := binary.BigEndian.Uint32(hdr[16:20])
+	if backingOffset != 0 && backingSize != 0 {
+		if backingSize > qcow2MaxName {
+			errStr := fmt.Sprintf("Bad backing file name size %d in %s",
+				backingSize, imgInfo.Filename)
+			return errors.New(errStr)
+		}
+		name := make([]byte, backingSize)
+		if _, err := f.ReadAt(name, backingOffset); err != nil {
+			errStr := fmt.Sprintf("Reading backing file name in %s: %s",
+				imgInfo.Filename, err)
+			return errors.New(errStr)
+		}
+		imgInfo.BackingFilename = string(name)
+	}
+
+	nbSnapshots := binary.BigEndian.Uint32(hdr[60:64])
+	offset := int64(binary.BigEndian.Uint64(hdr[64:72]))
+	if nbSnapshots > qcow2MaxSnaps {
+		errStr := fmt.Sprintf("Bad snapshot count %d in %s",
+			nbSnapshots, imgInfo.Filename)
+		return errors.New(errStr)
+	}
+	for i := uint32(0); i < nbSnapshots; i++ {
+		snap, size, err := readQcow2Snapshot(f, offset)
+		if err != nil {
+			errStr := fmt.Sprintf("Reading snapshot %d in %s: %s",
+				i, imgInfo.Filename, err)
+			return errors.New(errStr)
+		}
+		imgInfo.Snapshots = append(imgInfo.Snapshots, snap)
+		offset += size
+	}
+	return nil
+}
+
+// readQcow2Snapshot returns the snapshot table entry at offset and its
+// size including the padding
+func readQcow2Snapshot(f io.ReaderAt, offset int64) (ImgSnapshot, int64, error) {
+	var snap ImgSnapshot
+	fixed := make([]byte, 40)
+	if _, err := f.ReadAt(fixed, offset); err != nil {
+		return snap, 0, err
+	}
+	idSize := int64(binary.BigEndian.Uint16(fixed[12:14]))
+	nameSize := int64(binary.BigEndian.Uint16(fixed[14:16]))
+	extraSize := int64(binary.BigEndian.Uint32(fixed[36:40]))
+	strs := make([]byte, idSize+nameSize)
+	if _, err := f.ReadAt(strs, offset+40+extraSize); err != nil {
+		return snap, 0, err
+	}
+	vmClock := binary.BigEndian.Uint64(fixed[24:32])
+	snap.ID = string(strs[:idSize])
+	snap.Name = string(strs[idSize:])
+	snap.DateSec = int64(binary.BigEndian.Uint32(fixed[16:20]))
+	snap.DateNsec = int64(binary.BigEndian.Uint32(fixed[20:24]))
+	snap.VMClockSec = int64(vmClock / 1000000000)
+	snap.VMClockNsec = int64(vmClock % 1000000000)
+	snap.VMStateSize = uint64(binary.BigEndian.Uint32(fixed[32:36]))
+	size := (40 + extraSize + idSize + nameSize + 7) &^ 7
+	return snap, size, nil
+}
+
+// resizeRaw grows a raw image
+func resizeRaw(diskfile string, newsize uint64) error {
+	imgInfo, err := parseImgInfo(diskfile)
+	if err != nil {
+		return err
+	}
+	if imgInfo.Format != "raw" {
+		errStr := fmt.Sprintf("Can not resize %s image %s without qemu-img",
+			imgInfo.Format, diskfile)
+		return errors.New(errStr)
+	}
+	if newsize < imgInfo.VirtualSize {
+		errStr := fmt.Sprintf("Can not shrink %s from %d to %d",
+			diskfile, imgInfo.VirtualSize, newsize)
+		return errors.New(errStr)
+	}
+	return os.Truncate(diskfile, int64(newsize))
+}
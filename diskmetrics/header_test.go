@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseImgInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskmetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// qcow2 v3 with 64k clusters and 10 GiB virtual size
+	hdr := make([]byte, 512)
+	copy(hdr, qcow2Magic)
+	binary.BigEndian.PutUint32(hdr[4:8], 3)
+	binary.BigEndian.PutUint32(hdr[20:24], 16)
+	binary.BigEndian.PutUint64(hdr[24:32], 10<<30)
+	qcow2 := filepath.Join(dir, "disk.qcow2")
+	if err := ioutil.WriteFile(qcow2, hdr, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := parseImgInfo(qcow2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "qcow2" || info.VirtualSize != 10<<30 ||
+		info.ClusterSize != 65536 {
+		t.Errorf("Got %+v", info)
+	}
+	if err := resizeRaw(qcow2, 20<<30); err == nil {
+		t.Errorf("Expected error resizing qcow2")
+	}
+
+	raw := filepath.Join(dir, "disk.img")
+	if err := ioutil.WriteFile(raw, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = parseImgInfo(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "raw" || info.VirtualSize != 4096 {
+		t.Errorf("Got %+v", info)
+	}
+	if err := resizeRaw(raw, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := parseImgInfo(raw); info.VirtualSize != 1<<20 {
+		t.Errorf("Got %+v after resize", info)
+	}
+	if err := resizeRaw(raw, 4096); err == nil {
+		t.Errorf("Expected error shrinking")
+	}
+
+	// Truncated qcow2 header
+	if err := ioutil.WriteFile(qcow2, hdr[:8], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseImgInfo(qcow2); err == nil {
+		t.Errorf("Expected error for truncated header")
+	}
+}
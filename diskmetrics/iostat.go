@@ -0,0 +1,121 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// I/O counters of the block devices from /proc/diskstats
+
+package diskmetrics
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+var diskstatsFile = "/proc/diskstats"
+
+// Block devices not backed by storage
+var noIOStatsPrefixes = []string{"loop", "ram", "zram"}
+
+// /proc/diskstats always counts 512 byte sectors
+const diskstatsSectorSize = 512
+
+// ReadDiskIOStats returns the counters of the disks in /sys/block.
+// Partitions and virtual devices are skipped.
+func ReadDiskIOStats() ([]types.DiskIOStats, error) {
+	b, err := ioutil.ReadFile(diskstatsFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiskstats(string(b), time.Now())
+}
+
+func parseDiskstats(content string, now time.Time) ([]types.DiskIOStats, error) {
+	var stats []types.DiskIOStats
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 14 {
+			errStr := fmt.Sprintf("Bad line in %s: %s",
+				diskstatsFile, line)
+			return nil, errors.New(errStr)
+		}
+		name := fields[2]
+		if !isIOStatsDisk(name) {
+			continue
+		}
+		var counters [11]uint64
+		for i := range counters {
+			u, err := strconv.ParseUint(fields[3+i], 10, 64)
+			if err != nil {
+				errStr := fmt.Sprintf("Bad counter in %s: %s",
+					diskstatsFile, line)
+				return nil, errors.New(errStr)
+			}
+			counters[i] = u
+		}
+		stats = append(stats, types.DiskIOStats{
+			DevName:     name,
+			SampleTime:  now,
+			ReadCount:   counters[0],
+			ReadBytes:   counters[2] * diskstatsSectorSize,
+			ReadTimeMs:  counters[3],
+			WriteCount:  counters[4],
+			WriteBytes:  counters[6] * diskstatsSectorSize,
+			WriteTimeMs: counters[7],
+			InFlight:    counters[8],
+			IOTimeMs:    counters[9],
+			QueueTimeMs: counters[10],
+		})
+	}
+	return stats, nil
+}
+
+// isIOStatsDisk is true for the whole disks backed by storage
+func isIOStatsDisk(name string) bool {
+	for _, prefix := range noIOStatsPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	_, err := os.Stat(sysBlockDir + "/" + name)
+	return err == nil
+}
+
+// SetDiskIORates fills in the rates in stats from the previous sample of
+// the same device. Counters which went backwards give no rates.
+func SetDiskIORates(stats []types.DiskIOStats, prev []types.DiskIOStats) {
+	prevByName := make(map[string]types.DiskIOStats)
+	for _, p := range prev {
+		prevByName[p.DevName] = p
+	}
+	for i := range stats {
+		s := &stats[i]
+		p, ok := prevByName[s.DevName]
+		if !ok {
+			continue
+		}
+		interval := s.SampleTime.Sub(p.SampleTime)
+		if interval <= 0 || s.ReadCount < p.ReadCount ||
+			s.WriteCount < p.WriteCount || s.IOTimeMs < p.IOTimeMs {
+			continue
+		}
+		secs := interval.Seconds()
+		s.ReadsPerSec = float64(s.ReadCount-p.ReadCount) / secs
+		s.WritesPerSec = float64(s.WriteCount-p.WriteCount) / secs
+		s.ReadBytesPerSec = float64(s.ReadBytes-p.ReadBytes) / secs
+		s.WriteBytesPerSec = float64(s.WriteBytes-p.WriteBytes) / secs
+		ms := float64(interval / time.Millisecond)
+		s.UtilPercent = float64(s.IOTimeMs-p.IOTimeMs) * 100 / ms
+		if s.UtilPercent > 100 {
+			s.UtilPercent = 100
+		}
+	}
+}
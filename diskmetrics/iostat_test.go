@@ -0,0 +1,67 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskIOStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskmetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedDir := sysBlockDir
+	defer func() { sysBlockDir = savedDir }()
+	sysBlockDir = dir
+	for _, name := range []string{"mmcblk0", "loop0"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	first := `   7       0 loop0 10 0 20 0 0 0 0 0 0 0 0
+ 179       0 mmcblk0 100 5 2000 300 50 2 800 400 0 600 700
+ 179       1 mmcblk0p1 90 5 1800 280 40 2 700 380 0 550 650
+`
+	prev, err := parseDiskstats(first, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prev) != 1 || prev[0].DevName != "mmcblk0" ||
+		prev[0].ReadBytes != 2000*512 || prev[0].WriteCount != 50 ||
+		prev[0].QueueTimeMs != 700 {
+		t.Fatalf("Got %+v", prev)
+	}
+
+	second := " 179       0 mmcblk0 200 5 4000 300 150 2 2800 400 1 5600 700 0 0 0 0\n"
+	stats, err := parseDiskstats(second, now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDiskIORates(stats, prev)
+	s := stats[0]
+	if s.ReadsPerSec != 10 || s.WritesPerSec != 10 ||
+		s.ReadBytesPerSec != 2000*512/10 ||
+		s.WriteBytesPerSec != 2000*512/10 || s.UtilPercent != 50 ||
+		s.InFlight != 1 {
+		t.Errorf("Got %+v", s)
+	}
+
+	// Counters reset
+	SetDiskIORates(prev, stats)
+	if prev[0].ReadsPerSec != 0 {
+		t.Errorf("Got %+v", prev[0])
+	}
+
+	if _, err := parseDiskstats(" 179 0 mmcblk0 1 2\n", now); err == nil {
+		t.Errorf("Expected error for short line")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// SMART health of the disks using smartctl
+
+package diskmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+var sysBlockDir = "/sys/block"
+
+// Virtual and other block devices without SMART data
+var noSmartPrefixes = []string{"loop", "ram", "zram", "dm-", "sr", "nbd",
+	"md"}
+
+// ATA attributes
+const (
+	ataReallocatedSectors = 5
+	ataWearLevelingCount  = 177
+	ataPendingSectors     = 197
+	ataLifetimeRemaining  = 202
+	ataSSDLifeLeft        = 231
+	ataMediaWearout       = 233
+)
+
+// Matches the part of the json output of smartctl -a we use
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours uint64 `json:"hours"`
+	} `json:"power_on_time"`
+	AtaSmartAttributes struct {
+		Table []struct {
+			ID    int `json:"id"`
+			Value int `json:"value"`
+			Raw   struct {
+				Value uint64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NvmeSmartHealth *struct {
+		PercentageUsed int    `json:"percentage_used"`
+		MediaErrors    uint64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// ListDisks returns the names of the block devices which might have
+// SMART data
+func ListDisks() []string {
+	var disks []string
+	locations, err := ioutil.ReadDir(sysBlockDir)
+	if err != nil {
+		return nil
+	}
+	for _, location := range locations {
+		name := location.Name()
+		skip := false
+		for _, prefix := range noSmartPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			disks = append(disks, name)
+		}
+	}
+	return disks
+}
+
+// GetStorageHealth runs smartctl for the disk. Supported is false with
+// the error set if it fails.
+func GetStorageHealth(devName string) types.StorageHealthStatus {
+	status := types.StorageHealthStatus{DevName: devName, WearPercent: -1,
+		UpdateTime: time.Now()}
+	output, err := exec.Command("smartctl", "--json", "-a",
+		"/dev/"+devName).Output()
+	if err != nil {
+		// The low two bits of the exit status are fatal; the others
+		// report the disk state
+		ee, ok := err.(*exec.ExitError)
+		if !ok {
+			status.SetErrorNow(fmt.Sprintf("smartctl failed: %s", err))
+			return status
+		}
+		ws, ok := ee.Sys().(syscall.WaitStatus)
+		if !ok || ws.ExitStatus()&0x3 != 0 {
+			status.SetErrorNow(fmt.Sprintf("smartctl failed: %s %s",
+				err, smartctlMessages(output)))
+			return status
+		}
+	}
+	if err := parseSmartctl(output, &status); err != nil {
+		status.SetErrorNow(err.Error())
+		return status
+	}
+	return status
+}
+
+func smartctlMessages(output []byte) string {
+	var out smartctlOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return ""
+	}
+	var msgs []string
+	for _, m := range out.Smartctl.Messages {
+		msgs = append(msgs, m.String)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// parseSmartctl fills in the status from the json output
+func parseSmartctl(output []byte, status *types.StorageHealthStatus) error {
+	var out smartctlOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		errStr := fmt.Sprintf("Bad smartctl output: %s", err)
+		return errors.New(errStr)
+	}
+	if out.SmartStatus == nil {
+		errStr := fmt.Sprintf("No SMART status: %s",
+			smartctlMessages(output))
+		return errors.New(errStr)
+	}
+	status.Supported = true
+	status.Passed = out.SmartStatus.Passed
+	status.Model = out.ModelName
+	status.SerialNumber = out.SerialNumber
+	status.Temperature = out.Temperature.Current
+	status.PowerOnHours = out.PowerOnTime.Hours
+	for _, attr := range out.AtaSmartAttributes.Table {
+		switch attr.ID {
+		case ataReallocatedSectors:
+			status.ReallocatedSectors = attr.Raw.Value
+		case ataPendingSectors:
+			status.PendingSectors = attr.Raw.Value
+		case ataWearLevelingCount, ataLifetimeRemaining, ataSSDLifeLeft,
+			ataMediaWearout:
+			// Normalized value counts down from 100
+			if attr.Value <= 100 {
+				status.WearPercent = 100 - attr.Value
+			}
+		}
+	}
+	if out.NvmeSmartHealth != nil {
+		status.WearPercent = out.NvmeSmartHealth.PercentageUsed
+		status.MediaErrors = out.NvmeSmartHealth.MediaErrors
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package diskmetrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestParseSmartctl(t *testing.T) {
+	ata := `{
+  "smartctl": {"exit_status": 0},
+  "model_name": "SSD 64GB",
+  "serial_number": "S123",
+  "smart_status": {"passed": true},
+  "temperature": {"current": 41},
+  "power_on_time": {"hours": 9000},
+  "ata_smart_attributes": {"table": [
+    {"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "raw": {"value": 3}},
+    {"id": 177, "name": "Wear_Leveling_Count", "value": 12, "raw": {"value": 2900}},
+    {"id": 197, "name": "Current_Pending_Sector", "value": 100, "raw": {"value": 1}}
+  ]}
+}`
+	status := types.StorageHealthStatus{DevName: "sda", WearPercent: -1}
+	if err := parseSmartctl([]byte(ata), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Supported || !status.Passed || status.Model != "SSD 64GB" ||
+		status.Temperature != 41 || status.PowerOnHours != 9000 ||
+		status.WearPercent != 88 || status.ReallocatedSectors != 3 ||
+		status.PendingSectors != 1 {
+		t.Errorf("Got %+v", status)
+	}
+
+	nvme := `{
+  "smart_status": {"passed": false},
+  "temperature": {"current": 50},
+  "nvme_smart_health_information_log": {"percentage_used": 7, "media_errors": 2}
+}`
+	status = types.StorageHealthStatus{DevName: "nvme0n1", WearPercent: -1}
+	if err := parseSmartctl([]byte(nvme), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Passed || status.WearPercent != 7 || status.MediaErrors != 2 {
+		t.Errorf("Got %+v", status)
+	}
+
+	unsupported := `{"smartctl": {"exit_status": 4, "messages": [{"string": "SMART support is: Unavailable"}]}}`
+	status = types.StorageHealthStatus{DevName: "mmcblk0", WearPercent: -1}
+	if err := parseSmartctl([]byte(unsupported), &status); err == nil ||
+		status.Supported {
+		t.Errorf("Expected error got %+v", status)
+	}
+}
+
+func TestListDisks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"sda", "nvme0n1", "mmcblk0", "loop0",
+		"dm-0", "sr0", "zram0"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := sysBlockDir
+	defer func() { sysBlockDir = saved }()
+	sysBlockDir = dir
+
+	expected := []string{"mmcblk0", "nvme0n1", "sda"}
+	if disks := ListDisks(); !reflect.DeepEqual(disks, expected) {
+		t.Errorf("Got %v expected %v", disks, expected)
+	}
+}
@@ -7,12 +7,15 @@
 //  ticker := NewRangeTicker(min, max)
 //  select ticker.C
 //  ticker.UpdateRangeTicker(newmin, newmix)
+//  ticker.Pause(); ticker.Resume()
+//  ticker.SetCatchUp(true)
 //  ticker.StopTicker()
 // Usage:
 //  ticker := NewExpTicker(start, max, randomFactor)
 //  select ticker.C
 //  ticker.UpdateRangeTicker(newstart, newmax, newRandomFactor)
 //  ticker.StopTicker()
+// See schedule.go for tickers at wall-clock times.
 
 package flextimer
 
@@ -43,8 +46,22 @@ type flexTickerConfig struct {
 	minTime      time.Duration
 	maxTime      time.Duration
 	randomFactor float64
+	schedule     *Schedule
+	jitter       time.Duration // Random delay after schedule
+	pause        bool          // Not parameters; pause the ticks
+	resume       bool          // Not parameters; resume the ticks
+	setCatchUp   bool          // Not parameters; set catchUp
+	catchUp      bool          // Tick when the clock jumps forward
 }
 
+// While waiting we check this often whether the wall-clock time jumped
+// relative to the monotonic time. That happens when NTP steps the clock
+// and when resuming from suspend since the monotonic time then stops.
+const (
+	clockCheckInterval = time.Minute
+	clockJumpThreshold = 10 * time.Second
+)
+
 func NewRangeTicker(minTime time.Duration, maxTime time.Duration) FlexTickerHandle {
 	initialConfig := flexTickerConfig{minTime: minTime,
 		maxTime: maxTime}
@@ -64,6 +81,21 @@ func NewExpTicker(minTime time.Duration, maxTime time.Duration, randomFactor flo
 	return FlexTickerHandle{C: tickChan, configChan: configChan}
 }
 
+// NewScheduleTicker ticks at the times in the schedule plus a random
+// delay up to jitter so that devices with the same schedule spread out
+func NewScheduleTicker(schedule Schedule, jitter time.Duration) FlexTickerHandle {
+	initialConfig := flexTickerConfig{schedule: &schedule, jitter: jitter}
+	configChan := make(chan flexTickerConfig, 1)
+	tickChan := newFlexTicker(configChan)
+	configChan <- initialConfig
+	return FlexTickerHandle{C: tickChan, privateChan: tickChan, configChan: configChan}
+}
+
+func (f FlexTickerHandle) UpdateScheduleTicker(schedule Schedule, jitter time.Duration) {
+	config := flexTickerConfig{schedule: &schedule, jitter: jitter}
+	f.configChan <- config
+}
+
 func (f FlexTickerHandle) UpdateRangeTicker(minTime time.Duration, maxTime time.Duration) {
 	config := flexTickerConfig{minTime: minTime,
 		maxTime: maxTime}
@@ -110,6 +142,23 @@ func (f FlexTickerHandle) StopTicker() {
 	f.configChan <- flexTickerConfig{}
 }
 
+// Pause stops the ticks until Resume without closing C. Updates while
+// paused take effect at Resume.
+func (f FlexTickerHandle) Pause() {
+	f.configChan <- flexTickerConfig{pause: true}
+}
+
+// Resume restarts the ticks with a full interval before the first one
+func (f FlexTickerHandle) Resume() {
+	f.configChan <- flexTickerConfig{resume: true}
+}
+
+// SetCatchUp makes the ticker tick right away when the clock jumps
+// forward instead of only restarting the interval
+func (f FlexTickerHandle) SetCatchUp(enable bool) {
+	f.configChan <- flexTickerConfig{setCatchUp: true, catchUp: enable}
+}
+
 // Implementation functions
 
 func newFlexTicker(config <-chan flexTickerConfig) chan time.Time {
@@ -124,9 +173,22 @@ func flexTicker(config <-chan flexTickerConfig, tick chan<- time.Time) {
 	// Wait for initial config
 	c := <-config
 	expFactor := 1
+	var target time.Time // Next tick for a schedule
 	for {
 		var d time.Duration
-		if c.exponential {
+		if c.schedule != nil {
+			now := time.Now()
+			if target.IsZero() {
+				target = c.schedule.Next(now)
+				if target.IsZero() {
+					// Never matches; wait for new config
+					target = now.AddDate(scheduleMaxYears, 0, 0)
+				} else if c.jitter > 0 {
+					target = target.Add(time.Duration(r1.Int63n(int64(c.jitter))))
+				}
+			}
+			d = target.Sub(now)
+		} else if c.exponential {
 			rf := c.randomFactor
 			if rf == 0 {
 				rf = 1.0
@@ -149,19 +211,106 @@ func flexTicker(config <-chan flexTickerConfig, tick chan<- time.Time) {
 			r := r1.Int63n(int64(c.maxTime-c.minTime)) + int64(c.minTime)
 			d = time.Duration(r)
 		}
-		timer := time.NewTimer(d)
-		select {
-		case <-timer.C:
+		jump, newc, gotConfig := waitTick(config, d)
+		switch {
+		case jump != 0:
+			// Start over since the interval or schedule is in
+			// terms of the old clock
+			now := time.Now()
+			catchUp := c.catchUp && jump > 0 &&
+				(c.schedule == nil || !now.Before(target))
+			target = time.Time{}
+			if catchUp {
+				tick <- now
+			}
+		case !gotConfig:
+			if c.schedule != nil {
+				if time.Now().Before(target) {
+					continue
+				}
+				target = time.Time{}
+			}
 			tick <- time.Now()
-		case c = <-config:
+		default:
 			// Replace current parameters without
 			// looking at when current timer would fire
-			timer.Stop()
 			expFactor = 1
-			if c.maxTime == 0 && c.minTime == 0 {
+			target = time.Time{}
+			var stop bool
+			c, stop = applyConfig(config, c, newc)
+			if stop {
 				close(tick)
 				return
 			}
 		}
 	}
 }
+
+// applyConfig returns the parameters to use, waiting for a resume if
+// paused, and whether to stop
+func applyConfig(config <-chan flexTickerConfig, c flexTickerConfig,
+	newc flexTickerConfig) (flexTickerConfig, bool) {
+
+	paused := false
+	for {
+		switch {
+		case newc.pause:
+			paused = true
+		case newc.resume:
+			paused = false
+		case newc.setCatchUp:
+			c.catchUp = newc.catchUp
+		case newc.maxTime == 0 && newc.minTime == 0 && newc.schedule == nil:
+			return c, true
+		default:
+			newc.catchUp = c.catchUp
+			c = newc
+		}
+		if !paused {
+			return c, false
+		}
+		newc = <-config
+	}
+}
+
+// waitTick waits for d unless there is new config or the wall-clock time
+// jumps. Returns the jump or the new config.
+func waitTick(config <-chan flexTickerConfig,
+	d time.Duration) (time.Duration, flexTickerConfig, bool) {
+
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= d {
+			return 0, flexTickerConfig{}, false
+		}
+		step := d - elapsed
+		if step > clockCheckInterval {
+			step = clockCheckInterval
+		}
+		timer := time.NewTimer(step)
+		select {
+		case <-timer.C:
+			if jump := clockJump(start, time.Now()); jump != 0 {
+				return jump, flexTickerConfig{}, false
+			}
+		case newc := <-config:
+			timer.Stop()
+			return 0, newc, true
+		}
+	}
+}
+
+// clockJump returns how much more the wall-clock time than the monotonic
+// time has advanced from start to now. Returns zero if below the threshold.
+func clockJump(start time.Time, now time.Time) time.Duration {
+	return elapsedJump(now.Round(0).Sub(start.Round(0)), now.Sub(start))
+}
+
+func elapsedJump(wall time.Duration, monotonic time.Duration) time.Duration {
+	jump := wall - monotonic
+	if jump < clockJumpThreshold && jump > -clockJumpThreshold {
+		return 0
+	}
+	return jump
+}
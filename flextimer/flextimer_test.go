@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package flextimer
+
+import (
+	"testing"
+	"time"
+)
+
+// drain reads ticks for the duration and returns the count
+func drain(ticker FlexTickerHandle, d time.Duration) int {
+	count := 0
+	timer := time.NewTimer(d)
+	for {
+		select {
+		case <-ticker.C:
+			count++
+		case <-timer.C:
+			return count
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	ticker := NewRangeTicker(5*time.Millisecond, 10*time.Millisecond)
+	defer ticker.StopTicker()
+	if count := drain(ticker, 100*time.Millisecond); count == 0 {
+		t.Errorf("no ticks before pause")
+	}
+	ticker.Pause()
+	// Ticks which were already queued
+	drain(ticker, 50*time.Millisecond)
+	// Update while paused is not applied until Resume
+	ticker.UpdateRangeTicker(time.Millisecond, 2*time.Millisecond)
+	if count := drain(ticker, 100*time.Millisecond); count != 0 {
+		t.Errorf("got %d ticks while paused", count)
+	}
+	ticker.Resume()
+	if count := drain(ticker, 100*time.Millisecond); count == 0 {
+		t.Errorf("no ticks after resume")
+	}
+}
+
+func TestStopWhilePaused(t *testing.T) {
+	ticker := NewRangeTicker(time.Hour, 2*time.Hour)
+	ticker.Pause()
+	ticker.StopTicker()
+	select {
+	case _, ok := <-ticker.C:
+		if ok {
+			t.Errorf("got tick after stop")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("C not closed")
+	}
+}
+
+func TestElapsedJump(t *testing.T) {
+	testMatrix := map[string]struct {
+		wall      time.Duration
+		monotonic time.Duration
+		expected  time.Duration
+	}{
+		"No jump":    {time.Minute, time.Minute, 0},
+		"NTP slew":   {time.Minute + time.Second, time.Minute, 0},
+		"Suspend":    {2 * time.Hour, time.Minute, 2*time.Hour - time.Minute},
+		"Step back":  {-time.Hour, time.Minute, -time.Hour - time.Minute},
+		"Step ahead": {time.Minute + time.Hour, time.Minute, time.Hour},
+	}
+	for testname, test := range testMatrix {
+		jump := elapsedJump(test.wall, test.monotonic)
+		if jump != test.expected {
+			t.Errorf("%s: got %v expected %v", testname, jump,
+				test.expected)
+		}
+	}
+	now := time.Now()
+	if jump := clockJump(now, now.Add(time.Hour)); jump != 0 {
+		t.Errorf("clockJump got %v", jump)
+	}
+}
+
+func TestCatchUpKept(t *testing.T) {
+	config := make(chan flexTickerConfig, 1)
+	c := flexTickerConfig{minTime: time.Second, maxTime: 2 * time.Second}
+	c, stop := applyConfig(config, c,
+		flexTickerConfig{setCatchUp: true, catchUp: true})
+	if stop || !c.catchUp || c.minTime != time.Second {
+		t.Errorf("after SetCatchUp got %+v %v", c, stop)
+	}
+	c, stop = applyConfig(config, c,
+		flexTickerConfig{minTime: time.Minute, maxTime: time.Hour})
+	if stop || !c.catchUp || c.minTime != time.Minute {
+		t.Errorf("after update got %+v %v", c, stop)
+	}
+}
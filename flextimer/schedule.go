@@ -0,0 +1,193 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Wall-clock schedules in crontab(5) format; minute hour day-of-month
+// month day-of-week. Each field is *, a number, a range a-b, a step */n or
+// a-b/n, or a comma separated list of those. As in cron when both
+// day-of-month and day-of-week are restricted either one matches.
+// Usage:
+//  schedule, err := ParseSchedule("30 2 * * *")
+//  ticker := NewScheduleTicker(schedule, jitter)
+//  select ticker.C
+//  ticker.UpdateScheduleTicker(newschedule, newjitter)
+//  ticker.StopTicker()
+
+package flextimer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed crontab(5) time specification
+type Schedule struct {
+	spec        string
+	minute      uint64 // Bit per allowed value
+	hour        uint64
+	dayOfMonth  uint64
+	month       uint64
+	dayOfWeek   uint64
+	anyDayMonth bool // Day-of-month is *
+	anyDayWeek  bool // Day-of-week is *
+}
+
+type fieldRange struct {
+	name string
+	min  int
+	max  int
+}
+
+var scheduleFields = []fieldRange{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day-of-month", 1, 31},
+	{"month", 1, 12},
+	{"day-of-week", 0, 7}, // 7 is also Sunday
+}
+
+// Never look further than this for the next time
+const scheduleMaxYears = 5
+
+// ParseSchedule parses the five crontab fields
+func ParseSchedule(spec string) (Schedule, error) {
+	var schedule Schedule
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		errStr := fmt.Sprintf("schedule %q: expected %d fields",
+			spec, len(scheduleFields))
+		return schedule, errors.New(errStr)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			errStr := fmt.Sprintf("schedule %q: %s", spec, err)
+			return schedule, errors.New(errStr)
+		}
+		bits[i] = b
+	}
+	schedule.spec = spec
+	schedule.minute = bits[0]
+	schedule.hour = bits[1]
+	schedule.dayOfMonth = bits[2]
+	schedule.month = bits[3]
+	schedule.dayOfWeek = bits[4]
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+	schedule.anyDayMonth = fields[2] == "*"
+	schedule.anyDayWeek = fields[4] == "*"
+	return schedule, nil
+}
+
+// DailySchedule runs every day at hour:minute
+func DailySchedule(hour int, minute int) (Schedule, error) {
+	return ParseSchedule(fmt.Sprintf("%d %d * * *", minute, hour))
+}
+
+func (schedule Schedule) String() string {
+	return schedule.spec
+}
+
+func parseScheduleField(field string, fr fieldRange) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				errStr := fmt.Sprintf("%s: bad step in %s",
+					fr.name, part)
+				return 0, errors.New(errStr)
+			}
+			step = s
+			part = part[:i]
+		}
+		low, high := fr.min, fr.max
+		if part != "*" {
+			var err error
+			if i := strings.Index(part, "-"); i != -1 {
+				low, err = parseScheduleValue(part[:i], fr)
+				if err == nil {
+					high, err = parseScheduleValue(part[i+1:], fr)
+				}
+			} else {
+				low, err = parseScheduleValue(part, fr)
+				if step == 1 {
+					high = low
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+			if low > high {
+				errStr := fmt.Sprintf("%s: bad range %s",
+					fr.name, part)
+				return 0, errors.New(errStr)
+			}
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseScheduleValue(str string, fr fieldRange) (int, error) {
+	v, err := strconv.Atoi(str)
+	if err != nil || v < fr.min || v > fr.max {
+		errStr := fmt.Sprintf("%s: %s not in %d-%d",
+			fr.name, str, fr.min, fr.max)
+		return 0, errors.New(errStr)
+	}
+	return v, nil
+}
+
+func (schedule Schedule) dayMatches(t time.Time) bool {
+	domMatch := schedule.dayOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := schedule.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	switch {
+	case schedule.anyDayMonth && schedule.anyDayWeek:
+		return true
+	case schedule.anyDayMonth:
+		return dowMatch
+	case schedule.anyDayWeek:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// Next returns the first time after t which matches the schedule, in t's
+// location. Returns the zero time if there is none e.g. for February 30.
+func (schedule Schedule) Next(t time.Time) time.Time {
+	if schedule.spec == "" {
+		return time.Time{}
+	}
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(scheduleMaxYears, 0, 0)
+	for t.Before(end) {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !schedule.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
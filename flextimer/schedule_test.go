@@ -0,0 +1,92 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package flextimer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2019, 5, 15, 10, 20, 30, 0, time.UTC)
+	testMatrix := map[string]struct {
+		spec     string
+		expected time.Time
+	}{
+		"Every minute": {
+			spec:     "* * * * *",
+			expected: time.Date(2019, 5, 15, 10, 21, 0, 0, time.UTC),
+		},
+		"Nightly": {
+			spec:     "30 2 * * *",
+			expected: time.Date(2019, 5, 16, 2, 30, 0, 0, time.UTC),
+		},
+		"Later today": {
+			spec:     "0 12,18 * * *",
+			expected: time.Date(2019, 5, 15, 12, 0, 0, 0, time.UTC),
+		},
+		"Step": {
+			spec:     "*/15 * * * *",
+			expected: time.Date(2019, 5, 15, 10, 30, 0, 0, time.UTC),
+		},
+		"Sunday as 7": {
+			spec:     "0 3 * * 7",
+			expected: time.Date(2019, 5, 19, 3, 0, 0, 0, time.UTC),
+		},
+		"Weekdays range": {
+			spec:     "0 1 * * 1-5",
+			expected: time.Date(2019, 5, 16, 1, 0, 0, 0, time.UTC),
+		},
+		"Day of month or week": {
+			spec:     "0 0 1 * 6",
+			expected: time.Date(2019, 5, 18, 0, 0, 0, 0, time.UTC),
+		},
+		"Next year": {
+			spec:     "0 0 1 1 *",
+			expected: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"Leap day": {
+			spec:     "0 0 29 2 *",
+			expected: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"Never": {
+			spec: "0 0 30 2 *",
+		},
+	}
+	for testname, test := range testMatrix {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: %s", testname, err)
+			continue
+		}
+		next := schedule.Next(now)
+		if !next.Equal(test.expected) {
+			t.Errorf("%s: got %v expected %v", testname, next,
+				test.expected)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *",
+		"* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *",
+		"a * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: no error", spec)
+		}
+	}
+}
+
+func TestDailySchedule(t *testing.T) {
+	schedule, err := DailySchedule(23, 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 5, 15, 23, 45, 0, 0, time.UTC)
+	expected := now.AddDate(0, 0, 1)
+	if next := schedule.Next(now); !next.Equal(expected) {
+		t.Errorf("got %v expected %v", next, expected)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Inventory of the CPU, memory, disks and TPM from /proc and /sys
+
+package hardware
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/diskmetrics"
+	"github.com/zededa/go-provision/tpm"
+	"github.com/zededa/go-provision/types"
+)
+
+const (
+	cpuInfoFile = "/proc/cpuinfo"
+	memInfoFile = "/proc/meminfo"
+	sysBlockDir = "/sys/block"
+)
+
+// GetHardwareInventory is expensive hence it is done once at boot
+func GetHardwareInventory() types.HardwareInventory {
+	modelInfo := GetHardwareModelInfo()
+	inv := types.HardwareInventory{
+		HardwareModel: modelInfo.Model,
+		Vendor:        modelInfo.Vendor,
+		Product:       modelInfo.Product,
+		Serial:        modelInfo.Serial,
+		ModelSource:   modelInfo.Source.String(),
+		TPMPresent:    tpm.IsAvailable(),
+	}
+	if b, err := ioutil.ReadFile(cpuInfoFile); err != nil {
+		log.Errorf("GetHardwareInventory: %s\n", err)
+	} else {
+		inv.CPU = parseCPUInfo(string(b))
+	}
+	if b, err := ioutil.ReadFile(memInfoFile); err != nil {
+		log.Errorf("GetHardwareInventory: %s\n", err)
+	} else {
+		inv.TotalMemory = parseMemTotal(string(b))
+	}
+	for _, devName := range diskmetrics.ListDisks() {
+		inv.Disks = append(inv.Disks, readDiskInventory(sysBlockDir,
+			devName))
+	}
+	return inv
+}
+
+// parseCPUInfo handles the x86 and ARM formats. On ARM there is no
+// model name, nor physical and core ids, hence each processor is a core.
+func parseCPUInfo(content string) types.CPUInventory {
+	var cpu types.CPUInventory
+	sockets := make(map[string]bool)
+	cores := make(map[string]bool)
+	physicalId := ""
+	hardware := ""
+	for _, line := range strings.Split(content, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+		switch key {
+		case "processor":
+			cpu.Threads++
+		case "model name":
+			if cpu.Model == "" {
+				cpu.Model = value
+			}
+		case "Hardware":
+			hardware = value
+		case "physical id":
+			physicalId = value
+			sockets[value] = true
+		case "core id":
+			cores[physicalId+"/"+value] = true
+		case "flags", "Features":
+			if cpu.Flags == nil {
+				cpu.Flags = strings.Fields(value)
+			}
+		}
+	}
+	if cpu.Model == "" {
+		cpu.Model = hardware
+	}
+	cpu.Sockets = len(sockets)
+	if cpu.Sockets == 0 && cpu.Threads != 0 {
+		cpu.Sockets = 1
+	}
+	cpu.Cores = len(cores)
+	if cpu.Cores == 0 {
+		cpu.Cores = cpu.Threads
+	}
+	return cpu
+}
+
+// parseMemTotal returns the MemTotal in bytes
+func parseMemTotal(content string) uint64 {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			log.Errorf("parseMemTotal: %s\n", err)
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// readDiskInventory reads the attributes we need from sysfs. The serial
+// is only in sysfs for NVMe and some SCSI disks.
+func readDiskInventory(blockDir string, devName string) types.DiskInventory {
+	dir := filepath.Join(blockDir, devName)
+	disk := types.DiskInventory{
+		DevName:    devName,
+		Model:      readSysfsString(filepath.Join(dir, "device/model")),
+		Serial:     readSysfsString(filepath.Join(dir, "device/serial")),
+		Rotational: readSysfsString(filepath.Join(dir, "queue/rotational")) == "1",
+		Removable:  readSysfsString(filepath.Join(dir, "removable")) == "1",
+	}
+	// The size is in 512 byte sectors independent of the block size
+	sectors, err := strconv.ParseUint(readSysfsString(filepath.Join(dir, "size")),
+		10, 64)
+	if err == nil {
+		disk.Size = sectors * 512
+	}
+	return disk
+}
+
+func readSysfsString(filename string) string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
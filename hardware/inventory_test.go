@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hardware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const x86CPUInfo = `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz
+physical id	: 0
+core id		: 0
+cpu cores	: 2
+flags		: fpu vme de pse vmx aes
+
+processor	: 1
+model name	: Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz
+physical id	: 0
+core id		: 1
+flags		: fpu vme de pse vmx aes
+
+processor	: 2
+model name	: Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz
+physical id	: 0
+core id		: 0
+flags		: fpu vme de pse vmx aes
+
+processor	: 3
+model name	: Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz
+physical id	: 0
+core id		: 1
+flags		: fpu vme de pse vmx aes
+`
+
+const armCPUInfo = `processor	: 0
+BogoMIPS	: 38.40
+Features	: fp asimd evtstrm crc32 cpuid
+CPU implementer	: 0x41
+
+processor	: 1
+BogoMIPS	: 38.40
+Features	: fp asimd evtstrm crc32 cpuid
+CPU implementer	: 0x41
+
+Hardware	: BCM2835
+Serial		: 00000000abcdef
+`
+
+func TestParseCPUInfo(t *testing.T) {
+	cpu := parseCPUInfo(x86CPUInfo)
+	if cpu.Model != "Intel(R) Core(TM) i5-7300U CPU @ 2.60GHz" ||
+		cpu.Sockets != 1 || cpu.Cores != 2 || cpu.Threads != 4 ||
+		len(cpu.Flags) != 6 || cpu.Flags[4] != "vmx" {
+		t.Errorf("x86 got %+v", cpu)
+	}
+	cpu = parseCPUInfo(armCPUInfo)
+	if cpu.Model != "BCM2835" || cpu.Sockets != 1 || cpu.Cores != 2 ||
+		cpu.Threads != 2 || len(cpu.Flags) != 5 {
+		t.Errorf("ARM got %+v", cpu)
+	}
+}
+
+func TestParseMemTotal(t *testing.T) {
+	content := "MemTotal:       16318412 kB\nMemFree:         1234 kB\n"
+	if total := parseMemTotal(content); total != 16318412*1024 {
+		t.Errorf("got %d", total)
+	}
+	if total := parseMemTotal("MemFree: 1234 kB\n"); total != 0 {
+		t.Errorf("got %d without MemTotal", total)
+	}
+}
+
+func TestReadDiskInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"nvme0n1/size":             "1000215216\n",
+		"nvme0n1/device/model":     "Samsung SSD 970 EVO Plus 500GB  \n",
+		"nvme0n1/device/serial":    "S4EVNF0M123456\n",
+		"nvme0n1/queue/rotational": "0\n",
+		"nvme0n1/removable":        "0\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disk := readDiskInventory(dir, "nvme0n1")
+	if disk.DevName != "nvme0n1" || disk.Size != 1000215216*512 ||
+		disk.Model != "Samsung SSD 970 EVO Plus 500GB" ||
+		disk.Serial != "S4EVNF0M123456" || disk.Rotational ||
+		disk.Removable {
+		t.Errorf("got %+v", disk)
+	}
+	disk = readDiskInventory(dir, "sda")
+	if disk.DevName != "sda" || disk.Size != 0 || disk.Model != "" {
+		t.Errorf("missing disk got %+v", disk)
+	}
+}
@@ -16,7 +16,6 @@
 package hardware
 
 import (
-	"bytes"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
@@ -44,25 +43,7 @@ func GetHardwareModelOverride() string {
 }
 
 func GetHardwareModelNoOverride() string {
-	product := ""
-	manufacturer := ""
-
-	cmd := exec.Command("dmidecode", "-s", "system-product-name")
-	pname, err := cmd.Output()
-	if err != nil {
-		log.Errorln("dmidecode system-product-name:", err)
-	} else {
-		product = string(pname)
-	}
-	cmd = exec.Command("dmidecode", "-s", "system-manufacturer")
-	manu, err := cmd.Output()
-	if err != nil {
-		log.Errorln("dmidecode system-manufacturer:", err)
-	} else {
-		manufacturer = string(manu)
-	}
-	compatible := GetCompatible()
-	return FormatModel(manufacturer, product, compatible)
+	return GetHardwareModelInfoNoOverride().Model
 }
 
 func FormatModel(manufacturer, product, compatible string) string {
@@ -113,32 +94,12 @@ func GetCompatible() string {
 			log.Errorf("GetCompatible(%s) failed %s\n",
 				compatibleFile, err)
 		} else {
-			contents = bytes.Replace(contents, []byte("\x00"),
-				[]byte("."), -1)
-			filter := func(r rune) rune {
-				if strings.IndexRune(controlChars, r) < 0 {
-					return r
-				}
-				return -1
-			}
-			contents = bytes.Map(filter, contents)
-			compatible = string(contents)
+			compatible = formatCompatible(contents)
 		}
 	}
 	return compatible
 }
 
-func GetProductSerial() string {
-	cmd := exec.Command("dmidecode", "-s", "system-serial-number")
-	serial, err := cmd.Output()
-	if err != nil {
-		log.Errorf("GetProductSerial system-serial-number failed %s\n",
-			err)
-		serial = []byte{}
-	}
-	return string(serial)
-}
-
 // Returns productManufacturer, productName, productVersion, productSerial, productUuid
 func GetDeviceManufacturerInfo() (string, string, string, string, string) {
 	cmd := exec.Command("dmidecode", "-s", "system-product-name")
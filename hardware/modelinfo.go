@@ -0,0 +1,215 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// GetHardwareModelInfo determines the model from several sources so that
+// boards without DMI, such as most ARM boards, are handled as well as PCs.
+// The precedence is
+//  1. the /config/hardwaremodel override
+//  2. SMBIOS OEM strings with a product= entry
+//  3. DMI system-manufacturer and system-product-name
+//  4. the device-tree compatible and serial-number
+// The Model string is formatted as before hence existing model files
+// continue to match.
+
+package hardware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	dtSerialFile = "/proc/device-tree/serial-number"
+)
+
+// ModelSource is where the model was determined from
+type ModelSource uint8
+
+const (
+	ModelSourceNone ModelSource = iota
+	ModelSourceOverride
+	ModelSourceOEMStrings
+	ModelSourceDMI
+	ModelSourceDeviceTree
+)
+
+func (ms ModelSource) String() string {
+	switch ms {
+	case ModelSourceNone:
+		return "none"
+	case ModelSourceOverride:
+		return "override"
+	case ModelSourceOEMStrings:
+		return "smbios-oem"
+	case ModelSourceDMI:
+		return "dmi"
+	case ModelSourceDeviceTree:
+		return "device-tree"
+	default:
+		return "unknown"
+	}
+}
+
+// HardwareModelInfo has the Model used to find the model files and what
+// we know about the vendor, product and serial.
+type HardwareModelInfo struct {
+	Model   string
+	Vendor  string
+	Product string
+	Serial  string
+	Source  ModelSource
+}
+
+// GetHardwareModelInfo applies the override on top of the detected info
+func GetHardwareModelInfo() HardwareModelInfo {
+	info := GetHardwareModelInfoNoOverride()
+	return applyOverride(info, getOverride(overrideFile))
+}
+
+// GetHardwareModelInfoNoOverride looks at the SMBIOS OEM strings, DMI and
+// device tree in that order
+func GetHardwareModelInfoNoOverride() HardwareModelInfo {
+	compatibleRaw := readCompatible()
+	oem := parseOEMStrings(dmidecodeOutput("-t", "11"))
+	dmi := HardwareModelInfo{
+		Vendor:  dmidecodeOutput("-s", "system-manufacturer"),
+		Product: dmidecodeOutput("-s", "system-product-name"),
+		Serial:  dmidecodeOutput("-s", "system-serial-number"),
+	}
+	dt := HardwareModelInfo{
+		Serial: readDeviceTreeString(dtSerialFile),
+	}
+	dt.Vendor, dt.Product = parseCompatible(compatibleRaw)
+	return selectModelInfo(oem, dmi, dt, formatCompatible(compatibleRaw))
+}
+
+func applyOverride(info HardwareModelInfo, override string) HardwareModelInfo {
+	if override != "" {
+		info.Model = override
+		info.Source = ModelSourceOverride
+	}
+	return info
+}
+
+// selectModelInfo picks the first source with a product. The model
+// includes the compatible string as FormatModel always did.
+func selectModelInfo(oem, dmi, dt HardwareModelInfo,
+	compatible string) HardwareModelInfo {
+
+	var info HardwareModelInfo
+	switch {
+	case oem.Product != "":
+		info = oem
+		info.Source = ModelSourceOEMStrings
+		info.Model = FormatModel(oem.Vendor, oem.Product, compatible)
+	case dmi.Vendor != "" || dmi.Product != "":
+		info = dmi
+		info.Source = ModelSourceDMI
+		info.Model = FormatModel(dmi.Vendor, dmi.Product, compatible)
+	case compatible != "":
+		info = dt
+		info.Source = ModelSourceDeviceTree
+		info.Model = FormatModel("", "", compatible)
+	default:
+		info.Source = ModelSourceNone
+		info.Model = FormatModel("", "", "")
+	}
+	// Fill in a serial from the other sources if need be
+	for _, other := range []HardwareModelInfo{oem, dmi, dt} {
+		if info.Serial != "" {
+			break
+		}
+		info.Serial = other.Serial
+	}
+	return info
+}
+
+// dmidecodeOutput returns "" if there is no dmidecode or no DMI, which is
+// normal on ARM hence this does not log an error
+func dmidecodeOutput(args ...string) string {
+	out, err := exec.Command("dmidecode", args...).Output()
+	if err != nil {
+		log.Debugf("dmidecode %v failed: %s\n", args, err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// parseOEMStrings looks for vendor=, product= and serial= entries in
+// the "String N: " lines in the output of "dmidecode -t 11"
+func parseOEMStrings(out string) HardwareModelInfo {
+	var info HardwareModelInfo
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "String ") {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(line[colon+1:]), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "vendor":
+			info.Vendor = value
+		case "product":
+			info.Product = value
+		case "serial":
+			info.Serial = value
+		}
+	}
+	return info
+}
+
+func readCompatible() []byte {
+	contents, err := ioutil.ReadFile(compatibleFile)
+	if err != nil {
+		return nil
+	}
+	return contents
+}
+
+// parseCompatible returns the vendor and product from the first, most
+// specific, entry of the nul separated compatible list e.g.,
+// "raspberrypi,3-model-b"
+func parseCompatible(contents []byte) (string, string) {
+	first := string(bytes.SplitN(contents, []byte("\x00"), 2)[0])
+	first = strings.TrimSpace(first)
+	if first == "" {
+		return "", ""
+	}
+	vp := strings.SplitN(first, ",", 2)
+	if len(vp) != 2 {
+		return "", first
+	}
+	return vp[0], vp[1]
+}
+
+// formatCompatible replaces the nuls with '.' and drops control characters
+func formatCompatible(contents []byte) string {
+	contents = bytes.Replace(contents, []byte("\x00"), []byte("."), -1)
+	filter := func(r rune) rune {
+		if strings.IndexRune(controlChars, r) < 0 {
+			return r
+		}
+		return -1
+	}
+	return string(bytes.Map(filter, contents))
+}
+
+// readDeviceTreeString returns the nul terminated string in the file
+func readDeviceTreeString(filename string) string {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(contents), "\x00"))
+}
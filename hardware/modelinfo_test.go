@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hardware
+
+import (
+	"testing"
+)
+
+func TestParseOEMStrings(t *testing.T) {
+	out := `# dmidecode 3.1
+Handle 0x0011, DMI type 11, 5 bytes
+OEM Strings
+	String 1: vendor=Acme
+	String 2: product=Gateway 5000
+	String 3: 5[0000]
+	String 4: serial=ABC123
+`
+	info := parseOEMStrings(out)
+	expected := HardwareModelInfo{Vendor: "Acme", Product: "Gateway 5000",
+		Serial: "ABC123"}
+	if info != expected {
+		t.Errorf("got %+v expected %+v", info, expected)
+	}
+	if info := parseOEMStrings(""); info != (HardwareModelInfo{}) {
+		t.Errorf("got %+v from empty output", info)
+	}
+}
+
+func TestParseCompatible(t *testing.T) {
+	testMatrix := map[string]struct {
+		contents string
+		vendor   string
+		product  string
+	}{
+		"Raspberry Pi": {
+			contents: "raspberrypi,3-model-b\x00brcm,bcm2837\x00",
+			vendor:   "raspberrypi",
+			product:  "3-model-b",
+		},
+		"No vendor": {
+			contents: "myboard\x00",
+			product:  "myboard",
+		},
+		"Empty": {},
+	}
+	for testname, test := range testMatrix {
+		vendor, product := parseCompatible([]byte(test.contents))
+		if vendor != test.vendor || product != test.product {
+			t.Errorf("%s: got %s/%s expected %s/%s", testname,
+				vendor, product, test.vendor, test.product)
+		}
+	}
+}
+
+func TestSelectModelInfo(t *testing.T) {
+	oem := HardwareModelInfo{Vendor: "Acme", Product: "Gateway"}
+	dmi := HardwareModelInfo{Vendor: "Supermicro", Product: "SYS-E100",
+		Serial: "S1"}
+	dt := HardwareModelInfo{Vendor: "raspberrypi", Product: "3-model-b",
+		Serial: "00000000abcdef"}
+	compatible := "raspberrypi,3-model-b.brcm,bcm2837."
+
+	testMatrix := map[string]struct {
+		oem        HardwareModelInfo
+		dmi        HardwareModelInfo
+		dt         HardwareModelInfo
+		compatible string
+		expected   HardwareModelInfo
+	}{
+		"OEM strings first": {
+			oem: oem,
+			dmi: dmi,
+			expected: HardwareModelInfo{Model: "Acme.Gateway",
+				Vendor: "Acme", Product: "Gateway", Serial: "S1",
+				Source: ModelSourceOEMStrings},
+		},
+		"DMI": {
+			dmi: dmi,
+			expected: HardwareModelInfo{Model: "Supermicro.SYS-E100",
+				Vendor: "Supermicro", Product: "SYS-E100",
+				Serial: "S1", Source: ModelSourceDMI},
+		},
+		"Device tree": {
+			dt:         dt,
+			compatible: compatible,
+			expected: HardwareModelInfo{Model: compatible,
+				Vendor: "raspberrypi", Product: "3-model-b",
+				Serial: "00000000abcdef",
+				Source: ModelSourceDeviceTree},
+		},
+		"Nothing": {
+			expected: HardwareModelInfo{Model: "default",
+				Source: ModelSourceNone},
+		},
+	}
+	for testname, test := range testMatrix {
+		info := selectModelInfo(test.oem, test.dmi, test.dt,
+			test.compatible)
+		if info != test.expected {
+			t.Errorf("%s: got %+v expected %+v", testname, info,
+				test.expected)
+		}
+	}
+}
+
+func TestApplyOverride(t *testing.T) {
+	info := HardwareModelInfo{Model: "Supermicro.SYS-E100",
+		Vendor: "Supermicro", Source: ModelSourceDMI}
+	if got := applyOverride(info, ""); got != info {
+		t.Errorf("empty override changed %+v to %+v", info, got)
+	}
+	got := applyOverride(info, "mymodel")
+	if got.Model != "mymodel" || got.Source != ModelSourceOverride ||
+		got.Vendor != "Supermicro" {
+		t.Errorf("override got %+v", got)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Serial number and asset tag of the device. They do not change while
+// running hence they are determined once. A file in /config overrides
+// what DMI or the device tree reports, for hardware where those are
+// missing or not unique.
+
+package hardware
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	serialOverrideFile   = "/config/serial"
+	assetTagOverrideFile = "/config/assettag"
+)
+
+var (
+	serialOnce     sync.Once
+	serialNumber   string
+	assetTagOnce   sync.Once
+	assetTagString string
+)
+
+// Values which vendors leave in DMI and which do not identify anything
+var placeholderIdentifiers = []string{
+	"To be filled by O.E.M.",
+	"Default string",
+	"Not Specified",
+	"Not Applicable",
+	"No Asset Tag",
+	"None",
+	"0123456789",
+	"System Serial Number",
+	"Chassis Serial Number",
+	"Asset-1234567890",
+}
+
+// GetSerialNumber returns the override, the DMI system serial number or
+// the device-tree serial-number in that order
+func GetSerialNumber() string {
+	serialOnce.Do(func() {
+		serialNumber = selectIdentifier(getOverride(serialOverrideFile),
+			dmidecodeOutput("-s", "system-serial-number"),
+			readDeviceTreeString(dtSerialFile))
+	})
+	return serialNumber
+}
+
+// GetAssetTag returns the override or the DMI chassis asset tag. The
+// device tree has no asset tag.
+func GetAssetTag() string {
+	assetTagOnce.Do(func() {
+		assetTagString = selectIdentifier(getOverride(assetTagOverrideFile),
+			dmidecodeOutput("-s", "chassis-asset-tag"))
+	})
+	return assetTagString
+}
+
+// selectIdentifier returns the first value which is not a placeholder
+func selectIdentifier(values ...string) string {
+	for _, value := range values {
+		value = cleanIdentifier(value)
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func cleanIdentifier(value string) string {
+	value = strings.TrimSpace(value)
+	for _, p := range placeholderIdentifiers {
+		if strings.EqualFold(value, p) {
+			return ""
+		}
+	}
+	return value
+}
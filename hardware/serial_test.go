@@ -0,0 +1,43 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hardware
+
+import (
+	"testing"
+)
+
+func TestSelectIdentifier(t *testing.T) {
+	testMatrix := map[string]struct {
+		values   []string
+		expected string
+	}{
+		"Override first": {
+			values:   []string{"override", "dmi", "dt"},
+			expected: "override",
+		},
+		"DMI": {
+			values:   []string{"", " ABC123\n", "dt"},
+			expected: "ABC123",
+		},
+		"Placeholder in DMI": {
+			values:   []string{"", "To be filled by O.E.M.", "00000000abcdef"},
+			expected: "00000000abcdef",
+		},
+		"Placeholder any case": {
+			values:   []string{"default STRING"},
+			expected: "",
+		},
+		"Nothing": {
+			values:   []string{"", "", ""},
+			expected: "",
+		},
+	}
+	for testname, test := range testMatrix {
+		got := selectIdentifier(test.values...)
+		if got != test.expected {
+			t.Errorf("%s: got %q expected %q", testname, got,
+				test.expected)
+		}
+	}
+}
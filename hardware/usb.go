@@ -0,0 +1,181 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// USB devices from sysfs and the kernel uevents for when they are
+// attached and detached
+
+package hardware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+const usbDevicesDir = "/sys/bus/usb/devices"
+
+// UsbChange is a USB device which was attached or detached
+type UsbChange struct {
+	Attached bool
+	BusPath  string
+}
+
+// UsbChangeInit returns a channel for the USB device changes, which the
+// caller reads in its select loop
+func UsbChangeInit() chan UsbChange {
+
+	log.Debugf("UsbChangeInit()\n")
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC,
+		syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The kernel sends the uevents to group 1
+	addr := syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}
+	if err := syscall.Bind(fd, &addr); err != nil {
+		log.Fatal(err)
+	}
+	usbchan := make(chan UsbChange)
+	go readUevents(fd, usbchan)
+	return usbchan
+}
+
+func readUevents(fd int, usbchan chan UsbChange) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			// ENOBUFS means we lost some; nothing to do about it
+			log.Errorf("readUevents: %s\n", err)
+			continue
+		}
+		action, devPath, env, err := parseUevent(buf[:n])
+		if err != nil {
+			log.Debugf("readUevents: %s\n", err)
+			continue
+		}
+		if change, ok := usbChangeFromUevent(action, devPath, env); ok {
+			usbchan <- change
+		}
+	}
+}
+
+// parseUevent handles the kernel format which is "action@devpath"
+// followed by KEY=value, all nul terminated
+func parseUevent(b []byte) (string, string, map[string]string, error) {
+	fields := bytes.Split(b, []byte("\x00"))
+	header := strings.SplitN(string(fields[0]), "@", 2)
+	if len(header) != 2 {
+		// E.g., from udevd which starts with "libudev"
+		errStr := fmt.Sprintf("Not a kernel uevent: %q", string(fields[0]))
+		return "", "", nil, errors.New(errStr)
+	}
+	env := make(map[string]string)
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(string(field), "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return header[0], header[1], env, nil
+}
+
+// usbChangeFromUevent ignores the events for the USB interfaces and the
+// root hubs
+func usbChangeFromUevent(action string, devPath string,
+	env map[string]string) (UsbChange, bool) {
+
+	if env["SUBSYSTEM"] != "usb" || env["DEVTYPE"] != "usb_device" {
+		return UsbChange{}, false
+	}
+	busPath := path.Base(devPath)
+	if !isUsbDeviceName(busPath) {
+		return UsbChange{}, false
+	}
+	switch action {
+	case "add":
+		return UsbChange{Attached: true, BusPath: busPath}, true
+	case "remove":
+		return UsbChange{Attached: false, BusPath: busPath}, true
+	default:
+		return UsbChange{}, false
+	}
+}
+
+// The interfaces are e.g., "1-1.2:1.0" and the root hubs "usb1"
+func isUsbDeviceName(name string) bool {
+	return !strings.Contains(name, ":") && !strings.HasPrefix(name, "usb")
+}
+
+// ListUsbDevices returns the bus paths of the attached devices
+func ListUsbDevices() []string {
+	var busPaths []string
+	locations, err := ioutil.ReadDir(usbDevicesDir)
+	if err != nil {
+		return nil
+	}
+	for _, location := range locations {
+		if isUsbDeviceName(location.Name()) {
+			busPaths = append(busPaths, location.Name())
+		}
+	}
+	return busPaths
+}
+
+// GetUsbDevice reads the device and interface attributes from sysfs
+func GetUsbDevice(busPath string) (types.UsbDeviceStatus, error) {
+	return readUsbDevice(usbDevicesDir, busPath)
+}
+
+func readUsbDevice(devicesDir string, busPath string) (types.UsbDeviceStatus, error) {
+	dir := filepath.Join(devicesDir, busPath)
+	status := types.UsbDeviceStatus{
+		BusPath:      busPath,
+		Manufacturer: readSysfsString(filepath.Join(dir, "manufacturer")),
+		Product:      readSysfsString(filepath.Join(dir, "product")),
+		Serial:       readSysfsString(filepath.Join(dir, "serial")),
+	}
+	vendorID, err := readSysfsHex(filepath.Join(dir, "idVendor"), 16)
+	if err != nil {
+		return status, err
+	}
+	status.VendorID = uint16(vendorID)
+	productID, err := readSysfsHex(filepath.Join(dir, "idProduct"), 16)
+	if err != nil {
+		return status, err
+	}
+	status.ProductID = uint16(productID)
+	if class, err := readSysfsHex(filepath.Join(dir, "bDeviceClass"), 8); err == nil {
+		status.DeviceClass = uint8(class)
+	}
+	classFiles, _ := filepath.Glob(filepath.Join(dir, busPath+":*",
+		"bInterfaceClass"))
+	sort.Strings(classFiles)
+	for _, filename := range classFiles {
+		if class, err := readSysfsHex(filename, 8); err == nil {
+			status.InterfaceClasses = append(status.InterfaceClasses,
+				uint8(class))
+		}
+	}
+	return status, nil
+}
+
+func readSysfsHex(filename string, bitSize int) (uint64, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 16, bitSize)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hardware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestUsbChangeFromUevent(t *testing.T) {
+	testMatrix := map[string]struct {
+		msg      string
+		expected UsbChange
+		ok       bool
+	}{
+		"Attach": {
+			msg:      "add@/devices/pci0000:00/0000:00:14.0/usb1/1-1\x00ACTION=add\x00DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-1\x00SUBSYSTEM=usb\x00DEVTYPE=usb_device\x00PRODUCT=1199/9071/6\x00",
+			expected: UsbChange{Attached: true, BusPath: "1-1"},
+			ok:       true,
+		},
+		"Detach": {
+			msg:      "remove@/devices/pci0000:00/0000:00:14.0/usb1/1-1/1-1.2\x00ACTION=remove\x00SUBSYSTEM=usb\x00DEVTYPE=usb_device\x00",
+			expected: UsbChange{Attached: false, BusPath: "1-1.2"},
+			ok:       true,
+		},
+		"Interface": {
+			msg: "add@/devices/pci0000:00/0000:00:14.0/usb1/1-1/1-1:1.0\x00ACTION=add\x00SUBSYSTEM=usb\x00DEVTYPE=usb_interface\x00",
+		},
+		"Root hub": {
+			msg: "add@/devices/pci0000:00/0000:00:14.0/usb1\x00ACTION=add\x00SUBSYSTEM=usb\x00DEVTYPE=usb_device\x00",
+		},
+		"Network": {
+			msg: "add@/devices/virtual/net/wwan0\x00ACTION=add\x00SUBSYSTEM=net\x00",
+		},
+		"Bind": {
+			msg: "bind@/devices/pci0000:00/0000:00:14.0/usb1/1-1\x00ACTION=bind\x00SUBSYSTEM=usb\x00DEVTYPE=usb_device\x00",
+		},
+	}
+	for testname, test := range testMatrix {
+		action, devPath, env, err := parseUevent([]byte(test.msg))
+		if err != nil {
+			t.Errorf("%s: %s", testname, err)
+			continue
+		}
+		change, ok := usbChangeFromUevent(action, devPath, env)
+		if ok != test.ok || change != test.expected {
+			t.Errorf("%s: got %+v %v expected %+v %v", testname,
+				change, ok, test.expected, test.ok)
+		}
+	}
+	if _, _, _, err := parseUevent([]byte("libudev\x00\xfe\xed")); err == nil {
+		t.Errorf("libudev message accepted")
+	}
+}
+
+func TestReadUsbDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"1-1.2/idVendor":                   "1199\n",
+		"1-1.2/idProduct":                  "9071\n",
+		"1-1.2/manufacturer":               "Sierra Wireless, Incorporated\n",
+		"1-1.2/product":                    "EM7455\n",
+		"1-1.2/bDeviceClass":               "00\n",
+		"1-1.2/1-1.2:1.0/bInterfaceClass":  "ff\n",
+		"1-1.2/1-1.2:1.12/bInterfaceClass": "02\n",
+		"1-1.2/1-1.2:1.13/bInterfaceClass": "0a\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, err := readUsbDevice(dir, "1-1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.UsbDeviceStatus{
+		BusPath:          "1-1.2",
+		VendorID:         0x1199,
+		ProductID:        0x9071,
+		Manufacturer:     "Sierra Wireless, Incorporated",
+		Product:          "EM7455",
+		InterfaceClasses: []uint8{0xff, 0x02, 0x0a},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("got %+v expected %+v", status, expected)
+	}
+	if status.VendorProduct() != "1199:9071" || !status.MaybeNetwork() {
+		t.Errorf("got %s network %v", status.VendorProduct(),
+			status.MaybeNetwork())
+	}
+	if _, err := readUsbDevice(dir, "1-1.3"); err == nil {
+		t.Errorf("no error for missing device")
+	}
+}
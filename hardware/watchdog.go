@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Driver for the Linux hardware watchdog device. Once opened the device
+// resets the system unless it is pinged within the timeout. Closing the
+// device without Disarm leaves it running hence a crashed or killed
+// process also results in a reset.
+
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WatchdogDevice is the default device
+const WatchdogDevice = "/dev/watchdog"
+
+// From linux/watchdog.h
+const (
+	wdiocSetOptions = 0x80045704
+	wdiocKeepAlive  = 0x80045705
+	wdiocSetTimeout = 0xC0045706
+	wdiocGetTimeout = 0x80045707
+
+	wdiosDisableCard = 0x0001
+)
+
+// Watchdog is an open watchdog device
+type Watchdog struct {
+	device  string
+	file    *os.File
+	Timeout time.Duration // What the device accepted
+}
+
+// OpenWatchdog opens and thereby starts the watchdog. The device might
+// round the timeout or not support setting it; Timeout has the result.
+func OpenWatchdog(device string, timeout time.Duration) (*Watchdog, error) {
+	file, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	wd := &Watchdog{device: device, file: file}
+	secs := int32(timeout / time.Second)
+	if secs > 0 {
+		if err := wd.ioctl(wdiocSetTimeout, &secs); err != nil {
+			log.Warnf("OpenWatchdog(%s) set timeout %d failed: %s\n",
+				device, secs, err)
+		}
+	}
+	if err := wd.ioctl(wdiocGetTimeout, &secs); err != nil {
+		log.Warnf("OpenWatchdog(%s) get timeout failed: %s\n",
+			device, err)
+	} else {
+		wd.Timeout = time.Duration(secs) * time.Second
+	}
+	log.Infof("OpenWatchdog(%s) timeout %v\n", device, wd.Timeout)
+	return wd, nil
+}
+
+// Ping defers the reset by another Timeout
+func (wd *Watchdog) Ping() error {
+	var dummy int32
+	return wd.ioctl(wdiocKeepAlive, &dummy)
+}
+
+// Disarm stops the watchdog if the driver allows it i.e., unless the
+// kernel has nowayout set, and closes the device
+func (wd *Watchdog) Disarm() error {
+	options := int32(wdiosDisableCard)
+	if err := wd.ioctl(wdiocSetOptions, &options); err != nil {
+		log.Warnf("Disarm(%s) disable failed: %s\n", wd.device, err)
+	}
+	// The magic close character
+	if _, err := wd.file.Write([]byte("V")); err != nil {
+		wd.file.Close()
+		return err
+	}
+	return wd.file.Close()
+}
+
+// Close leaves the watchdog running
+func (wd *Watchdog) Close() error {
+	return wd.file.Close()
+}
+
+func (wd *Watchdog) ioctl(request uintptr, arg *int32) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, wd.file.Fd(),
+		request, uintptr(unsafe.Pointer(arg)))
+	if errno != 0 {
+		errStr := fmt.Sprintf("ioctl 0x%x on %s: %s", request,
+			wd.device, errno)
+		return errors.New(errStr)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package hardware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A regular file does not take the ioctls but shows what we write
+func TestWatchdogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	device := filepath.Join(dir, "watchdog")
+
+	if _, err := OpenWatchdog(device, time.Minute); err == nil {
+		t.Errorf("Opened a missing device\n")
+	}
+	if err := ioutil.WriteFile(device, nil, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+	wd, err := OpenWatchdog(device, time.Minute)
+	if err != nil {
+		t.Fatalf("OpenWatchdog failed: %s\n", err)
+	}
+	if wd.Timeout != 0 {
+		t.Errorf("Timeout %v without the ioctl\n", wd.Timeout)
+	}
+	if err := wd.Ping(); err == nil {
+		t.Errorf("Ping succeeded without the ioctl\n")
+	}
+	if err := wd.Disarm(); err != nil {
+		t.Errorf("Disarm failed: %s\n", err)
+	}
+	b, err := ioutil.ReadFile(device)
+	if err != nil || string(b) != "V" {
+		t.Errorf("Expected the magic close, got %q %v\n", b, err)
+	}
+}
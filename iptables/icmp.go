@@ -0,0 +1,80 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// ICMP echo and ICMPv6 router advertisements to the device can be
+// blocked separately on the app bridges and on the other (uplink)
+// interfaces. ICMPv6 neighbor discovery is always accepted since IPv6
+// does not work without it.
+
+package iptables
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Bridges for the app network instances are named bn<N>
+const appBridges = "bn+"
+
+// IcmpPolicy is what is accepted on a class of interfaces
+type IcmpPolicy struct {
+	Echo         bool // ICMP and ICMPv6 echo requests
+	RouterAdvert bool // ICMPv6 router advertisements
+}
+
+// IcmpAllowAll is the kernel default
+var IcmpAllowAll = IcmpPolicy{Echo: true, RouterAdvert: true}
+
+// UpdateIcmpAccess sets the policy for the uplinks and the app bridges
+func UpdateIcmpAccess(mgmt IcmpPolicy, app IcmpPolicy) {
+
+	log.Infof("updateIcmpAccess(mgmt %+v app %+v)\n", mgmt, app)
+
+	if err := SetRules(icmpRules(mgmt, app)); err != nil {
+		log.Errorf("updateIcmpAccess failed: %s\n", err)
+	}
+}
+
+func icmpRules(mgmt IcmpPolicy, app IcmpPolicy) RuleSet {
+	set := RuleSet{Owner: "icmp"}
+	if mgmt == IcmpAllowAll && app == IcmpAllowAll {
+		return set
+	}
+	// iptables -A eve-input -i lo -p icmp -j ACCEPT
+	set.IPv4 = append(set.IPv4, Rule{Chain: EveInputChain,
+		Args: []string{"-i", "lo", "-p", "icmp", "-j", "ACCEPT"}})
+	set.IPv6 = append(set.IPv6, Rule{Chain: EveInputChain,
+		Args: []string{"-i", "lo", "-p", "ipv6-icmp", "-j", "ACCEPT"}})
+	// ip6tables -A eve-input -p ipv6-icmp --icmpv6-type neighbour-solicitation -j ACCEPT
+	for _, icmpType := range []string{"neighbour-solicitation",
+		"neighbour-advertisement", "router-solicitation"} {
+
+		set.IPv6 = append(set.IPv6, Rule{Chain: EveInputChain,
+			Args: []string{"-p", "ipv6-icmp", "--icmpv6-type", icmpType,
+				"-j", "ACCEPT"}})
+	}
+	addIcmpDrops(&set, []string{"!", "-i", appBridges}, mgmt)
+	addIcmpDrops(&set, []string{"-i", appBridges}, app)
+	return set
+}
+
+// addIcmpDrops drops what the policy does not accept on the interfaces
+// matched by ifMatch
+func addIcmpDrops(set *RuleSet, ifMatch []string, policy IcmpPolicy) {
+	// iptables -A eve-input ! -i bn+ -p icmp --icmp-type echo-request -j DROP
+	if !policy.Echo {
+		args := append([]string{}, ifMatch...)
+		args = append(args, "-p", "icmp", "--icmp-type", "echo-request",
+			"-j", "DROP")
+		set.IPv4 = append(set.IPv4, Rule{Chain: EveInputChain, Args: args})
+		args = append([]string{}, ifMatch...)
+		args = append(args, "-p", "ipv6-icmp", "--icmpv6-type",
+			"echo-request", "-j", "DROP")
+		set.IPv6 = append(set.IPv6, Rule{Chain: EveInputChain, Args: args})
+	}
+	if !policy.RouterAdvert {
+		args := append([]string{}, ifMatch...)
+		args = append(args, "-p", "ipv6-icmp", "--icmpv6-type",
+			"router-advertisement", "-j", "DROP")
+		set.IPv6 = append(set.IPv6, Rule{Chain: EveInputChain, Args: args})
+	}
+}
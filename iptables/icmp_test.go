@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIcmpRules(t *testing.T) {
+	set := icmpRules(IcmpAllowAll, IcmpAllowAll)
+	if len(set.IPv4) != 0 || len(set.IPv6) != 0 {
+		t.Errorf("Expected no rules got %+v", set)
+	}
+
+	// No ping on the uplinks; no router advertisements from apps
+	set = icmpRules(IcmpPolicy{RouterAdvert: true}, IcmpPolicy{Echo: true})
+	var v4, v6 []string
+	for _, rule := range set.IPv4 {
+		v4 = append(v4, strings.Join(rule.Args, " "))
+	}
+	for _, rule := range set.IPv6 {
+		v6 = append(v6, strings.Join(rule.Args, " "))
+	}
+	expected4 := []string{
+		"-i lo -p icmp -j ACCEPT",
+		"! -i bn+ -p icmp --icmp-type echo-request -j DROP",
+	}
+	expected6 := []string{
+		"-i lo -p ipv6-icmp -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type neighbour-solicitation -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type neighbour-advertisement -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type router-solicitation -j ACCEPT",
+		"! -i bn+ -p ipv6-icmp --icmpv6-type echo-request -j DROP",
+		"-i bn+ -p ipv6-icmp --icmpv6-type router-advertisement -j DROP",
+	}
+	if strings.Join(v4, "\n") != strings.Join(expected4, "\n") {
+		t.Errorf("Got IPv4 %q expected %q", v4, expected4)
+	}
+	if strings.Join(v6, "\n") != strings.Join(expected6, "\n") {
+		t.Errorf("Got IPv6 %q expected %q", v6, expected6)
+	}
+}
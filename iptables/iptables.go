@@ -6,13 +6,13 @@
 package iptables
 
 import (
-	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/wrap"
 	"os/exec"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 func IptableCmdOut(dolog bool, args ...string) (string, error) {
@@ -31,10 +31,9 @@ func IptableCmdOut(dolog bool, args ...string) (string, error) {
 		out, err = exec.Command(cmd, args...).Output()
 	}
 	if err != nil {
-		errStr := fmt.Sprintf("iptables command %s failed %s output %s",
-			args, err, out)
-		log.Errorln(errStr)
-		return "", errors.New(errStr)
+		cerr := newCmdError(cmd, args, err, out)
+		log.Errorln(cerr)
+		return "", cerr
 	}
 	return string(out), nil
 }
@@ -60,20 +59,68 @@ func Ip6tableCmdOut(dolog bool, args ...string) (string, error) {
 		out, err = exec.Command(cmd, args...).Output()
 	}
 	if err != nil {
-		errStr := fmt.Sprintf("ip6tables command %s failed %s output %s",
-			args, err, out)
-		log.Errorln(errStr)
-		return "", errors.New(errStr)
+		cerr := newCmdError(cmd, args, err, out)
+		log.Errorln(cerr)
+		return "", cerr
 	}
 	return string(out), nil
 }
 
+// CmdError is returned when iptables or ip6tables fails
+type CmdError struct {
+	Cmd      string
+	Args     []string
+	ExitCode int // -1 if it did not run or was killed
+	Output   string
+}
+
+func (e *CmdError) Error() string {
+	return fmt.Sprintf("%s command %s failed exit %d output %s",
+		e.Cmd, e.Args, e.ExitCode, e.Output)
+}
+
+func newCmdError(cmd string, args []string, err error, out []byte) *CmdError {
+	cerr := CmdError{Cmd: cmd, Args: args, ExitCode: -1,
+		Output: strings.TrimSpace(string(out))}
+	if ee, ok := err.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Exited() {
+			cerr.ExitCode = ws.ExitStatus()
+		}
+		if cerr.Output == "" {
+			cerr.Output = strings.TrimSpace(string(ee.Stderr))
+		}
+	} else {
+		cerr.Output = err.Error()
+	}
+	return &cerr
+}
+
+// RuleMissingError is returned when a rule was added without error but
+// the check with -C does not find it
+type RuleMissingError struct {
+	IPVer int
+	Args  []string // As for -C
+}
+
+func (e *RuleMissingError) Error() string {
+	return fmt.Sprintf("IPv%d rule missing after apply: %s", e.IPVer,
+		strings.Join(e.Args, " "))
+}
+
 func Ip6tableCmd(args ...string) error {
 	_, err := Ip6tableCmdOut(true, args...)
 	return err
 }
 
 func IptablesInit() {
+	// Our chains for the ACL and port rules
+	if err := ensureChains(4); err != nil {
+		log.Errorf("IptablesInit: %s\n", err)
+	}
+	if err := ensureChains(6); err != nil {
+		log.Errorf("IptablesInit: %s\n", err)
+	}
+
 	// Avoid adding nat rule multiple times as we restart by flushing first
 	IptableCmd("-t", "nat", "-F", "POSTROUTING")
 
@@ -98,7 +145,7 @@ func IptablesInit() {
 func FetchIprulesCounters() []AclCounters {
 	var counters []AclCounters
 	// get for IPv4 filter, IPv6 filter, and IPv6 raw
-	out, err := IptableCmdOut(false, "-t", "filter", "-S", "FORWARD", "-v")
+	out, err := IptableCmdOut(false, "-t", "filter", "-S", EveForwardChain, "-v")
 	if err != nil {
 		log.Errorf("FetchIprulesCounters: iptables -S failed %s\n", err)
 	} else {
@@ -128,7 +175,7 @@ func FetchIprulesCounters() []AclCounters {
 			counters = append(counters, c...)
 		}
 	}
-	out, err = Ip6tableCmdOut(false, "-t", "filter", "-S", "FORWARD", "-v")
+	out, err = Ip6tableCmdOut(false, "-t", "filter", "-S", EveForwardChain, "-v")
 	if err != nil {
 		log.Errorf("FetchIprulesCounters: ip6tables failed %s\n", err)
 	} else {
@@ -264,7 +311,7 @@ func parseline(line string, table string, ipVer int) *AclCounters {
 	if items[0] != "-A" {
 		return nil
 	}
-	forward := items[1] == "FORWARD"
+	forward := items[1] == "FORWARD" || items[1] == EveForwardChain
 	ac := AclCounters{Table: table, Chain: items[1], IpVer: ipVer}
 	i := 2
 	for i < len(items) {
@@ -292,6 +339,15 @@ func parseline(line string, table string, ipVer int) *AclCounters {
 			i += 2
 			continue
 		}
+		// Ignore the comment with the owner of the rule
+		if items[i] == "-m" && items[i+1] == "comment" {
+			i += 2
+			continue
+		}
+		if items[i] == "--comment" {
+			i += 2
+			continue
+		}
 		// Ignore any log-prefix and log-level if present
 		if items[i] == "--log-prefix" || items[i] == "--log-level" {
 			i += 2
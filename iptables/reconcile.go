@@ -0,0 +1,575 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Declarative rules. Each owner, e.g., "ssh" or the ACLs of an app
+// interface, sets the complete ordered list of its rules. Each rule is
+// tagged with a comment naming the owner, and we compare with the
+// iptables-save output to add and delete only what differs. Since the
+// comparison is against the kernel state, duplicate rules are removed,
+// rules out of order are re-added in order, and reconciling again
+// restores rules which were flushed by someone else.
+
+package iptables
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+)
+
+// Rule is placed in Chain in Table; Args are the matches and target
+// as for -A
+type Rule struct {
+	Table string // "filter" if empty
+	Chain string
+	Args  []string
+}
+
+// RuleSet is the complete ordered list of the rules of an owner. The
+// owner name can not contain a ':' or white space.
+type RuleSet struct {
+	Owner string
+	IPv4  []Rule
+	IPv6  []Rule
+}
+
+// Chains in the filter table for our rules, jumped to from the start of
+// the built-in chains. Rules in other chains are placed as is.
+const (
+	EveInputChain   = "eve-input"
+	EveForwardChain = "eve-forward"
+)
+
+var eveChains = map[string]string{
+	EveInputChain:   "INPUT",
+	EveForwardChain: "FORWARD",
+}
+
+// The last RuleSet per owner for ReconcileAll
+var ruleSets = make(map[string]RuleSet)
+
+// The last failure per owner for FirewallStatus
+type ownerError struct {
+	err     error
+	errTime time.Time
+}
+
+var ownerErrors = make(map[string]ownerError)
+
+// SetRules replaces the rules of the owner
+func SetRules(set RuleSet) error {
+	log.Infof("SetRules(%s) %d IPv4 %d IPv6 rules\n", set.Owner,
+		len(set.IPv4), len(set.IPv6))
+	ruleSets[set.Owner] = set
+	err := reconcile(set)
+	recordResult(set.Owner, err)
+	return err
+}
+
+// DeleteRules removes all the rules of the owner
+func DeleteRules(owner string) error {
+	log.Infof("DeleteRules(%s)\n", owner)
+	delete(ruleSets, owner)
+	err := reconcile(RuleSet{Owner: owner})
+	recordResult(owner, err)
+	return err
+}
+
+// ReconcileAll re-applies the rules of all owners set in this process,
+// e.g., after an external flush. iptables-save is run once per family
+// and its output is updated with the changes made for each owner.
+func ReconcileAll() {
+	snapshots := make(map[int]map[chainKey][]savedRule)
+	for _, set := range ruleSets {
+		err := reconcileSnapshot(4, set.Owner, set.IPv4, snapshots)
+		if err == nil {
+			err = reconcileSnapshot(6, set.Owner, set.IPv6, snapshots)
+		}
+		if err != nil {
+			log.Errorf("ReconcileAll(%s) failed: %s\n", set.Owner, err)
+		}
+		recordResult(set.Owner, err)
+	}
+}
+
+// recordResult keeps the failure until the owner is applied without one
+func recordResult(owner string, err error) {
+	if err == nil {
+		delete(ownerErrors, owner)
+		return
+	}
+	ownerErrors[owner] = ownerError{err: err, errTime: time.Now()}
+}
+
+// FirewallStatus returns the rules and failures of all owners set in
+// this process
+func FirewallStatus(agentName string) types.FirewallStatus {
+	status := types.FirewallStatus{AgentName: agentName}
+	owners := make(map[string]bool)
+	for owner := range ruleSets {
+		owners[owner] = true
+	}
+	for owner := range ownerErrors {
+		owners[owner] = true
+	}
+	var names []string
+	for owner := range owners {
+		names = append(names, owner)
+	}
+	sort.Strings(names)
+	for _, owner := range names {
+		ownerStatus := types.FirewallOwnerStatus{Owner: owner}
+		set := ruleSets[owner]
+		for _, rule := range set.IPv4 {
+			ownerStatus.IPv4Rules = append(ownerStatus.IPv4Rules, ruleString(rule))
+		}
+		for _, rule := range set.IPv6 {
+			ownerStatus.IPv6Rules = append(ownerStatus.IPv6Rules, ruleString(rule))
+		}
+		if oe, ok := ownerErrors[owner]; ok {
+			ownerStatus.SetError(oe.err.Error(), oe.errTime)
+		}
+		status.Owners = append(status.Owners, ownerStatus)
+	}
+	return status
+}
+
+func ruleString(rule Rule) string {
+	table := rule.Table
+	if table == "" {
+		table = "filter"
+	}
+	return fmt.Sprintf("-t %s -A %s %s", table, rule.Chain,
+		strings.Join(rule.Args, " "))
+}
+
+func reconcile(set RuleSet) error {
+	if err := reconcileFamily(4, set.Owner, set.IPv4); err != nil {
+		return err
+	}
+	return reconcileFamily(6, set.Owner, set.IPv6)
+}
+
+func reconcileFamily(ipVer int, owner string, rules []Rule) error {
+	snapshots := make(map[int]map[chainKey][]savedRule)
+	return reconcileSnapshot(ipVer, owner, rules, snapshots)
+}
+
+// reconcileSnapshot plans against the iptables-save output in snapshots,
+// running iptables-save if there is none, and updates it with the
+// applied changes. After a failure the output is dropped since we do not
+// know which changes were applied.
+func reconcileSnapshot(ipVer int, owner string, rules []Rule,
+	snapshots map[int]map[chainKey][]savedRule) error {
+
+	saved, ok := snapshots[ipVer]
+	if !ok {
+		var err error
+		saved, err = saveRules(ipVer)
+		if err != nil {
+			return err
+		}
+	}
+	ops := append(planChains(saved), planRules(saved, owner, rules)...)
+	if len(ops) != 0 {
+		log.Infof("reconcile(%s) IPv%d: %d changes\n", owner, ipVer,
+			len(ops))
+	}
+	if err := applyOps(ipVer, ops); err != nil {
+		delete(snapshots, ipVer)
+		return err
+	}
+	for _, op := range ops {
+		updateSaved(saved, op)
+	}
+	snapshots[ipVer] = saved
+	return nil
+}
+
+// ensureChains creates our chains and the jumps to them if missing
+func ensureChains(ipVer int) error {
+	saved, err := saveRules(ipVer)
+	if err != nil {
+		return err
+	}
+	return applyOps(ipVer, planChains(saved))
+}
+
+func saveRules(ipVer int) (map[chainKey][]savedRule, error) {
+	saveCmd := "iptables-save"
+	if ipVer == 6 {
+		saveCmd = "ip6tables-save"
+	}
+	out, err := exec.Command(saveCmd).Output()
+	if err != nil {
+		errStr := fmt.Sprintf("%s failed %s", saveCmd, err)
+		return nil, errors.New(errStr)
+	}
+	return parseSave(string(out)), nil
+}
+
+// applyOps runs the commands and checks that added rules are present
+func applyOps(ipVer int, ops [][]string) error {
+	cmd := IptableCmd
+	cmdOut := IptableCmdOut
+	if ipVer == 6 {
+		cmd = Ip6tableCmd
+		cmdOut = Ip6tableCmdOut
+	}
+	for _, op := range ops {
+		if err := cmd(op...); err != nil {
+			return err
+		}
+		check := checkOp(op)
+		if check == nil {
+			continue
+		}
+		if _, err := cmdOut(false, check...); err != nil {
+			// -C exits with 1 if the rule does not exist
+			if cerr, ok := err.(*CmdError); ok && cerr.ExitCode == 1 {
+				return &RuleMissingError{IPVer: ipVer, Args: check}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOp returns the -C command for an op which adds a rule, or nil
+func checkOp(op []string) []string {
+	if len(op) < 4 || op[0] != "-t" {
+		return nil
+	}
+	var args []string
+	switch op[2] {
+	case "-A":
+		args = op[4:]
+	case "-I":
+		if len(op) < 5 {
+			return nil
+		}
+		args = op[4:]
+		if _, err := strconv.Atoi(op[4]); err == nil {
+			args = op[5:]
+		}
+	default:
+		return nil
+	}
+	check := []string{"-t", op[1], "-C", op[3]}
+	return append(check, args...)
+}
+
+// chainKey is a chain in a table
+type chainKey struct {
+	table string
+	chain string
+}
+
+// savedRule is a rule from the iptables-save output
+type savedRule struct {
+	args []string // After "-A <chain>"
+	tag  string   // The comment if any
+}
+
+// parseSave returns the rules of each chain in order
+func parseSave(out string) map[chainKey][]savedRule {
+	chains := make(map[chainKey][]savedRule)
+	table := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "*") {
+			table = line[1:]
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Chain declaration e.g., ":INPUT ACCEPT [0:0]"
+			fields := strings.Fields(line[1:])
+			if len(fields) > 0 {
+				key := chainKey{table: table, chain: fields[0]}
+				chains[key] = chains[key]
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		items := splitQuoted(line)
+		if len(items) < 2 {
+			continue
+		}
+		key := chainKey{table: table, chain: items[1]}
+		chains[key] = append(chains[key], newSavedRule(items[2:]))
+	}
+	return chains
+}
+
+func newSavedRule(args []string) savedRule {
+	rule := savedRule{args: args}
+	for i := range args {
+		if args[i] == "--comment" && i+1 < len(args) {
+			rule.tag = args[i+1]
+			break
+		}
+	}
+	return rule
+}
+
+// updateSaved changes the saved rules as iptables did for the op from
+// planChains or planRules
+func updateSaved(saved map[chainKey][]savedRule, op []string) {
+	if len(op) < 4 || op[0] != "-t" {
+		return
+	}
+	key := chainKey{table: op[1], chain: op[3]}
+	rules := saved[key]
+	switch op[2] {
+	case "-N":
+		saved[key] = rules
+	case "-A":
+		saved[key] = append(rules, newSavedRule(op[4:]))
+	case "-I":
+		pos := 0
+		args := op[4:]
+		if len(op) > 4 {
+			if n, err := strconv.Atoi(op[4]); err == nil {
+				pos = n - 1
+				args = op[5:]
+			}
+		}
+		if pos < 0 || pos > len(rules) {
+			pos = len(rules)
+		}
+		rules = append(rules, savedRule{})
+		copy(rules[pos+1:], rules[pos:])
+		rules[pos] = newSavedRule(args)
+		saved[key] = rules
+	case "-D":
+		for i, r := range rules {
+			if reflect.DeepEqual(r.args, op[4:]) {
+				saved[key] = append(rules[:i], rules[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// splitQuoted splits at white space except inside double quotes, as
+// used by iptables-save e.g., for --log-prefix and --comment
+func splitQuoted(line string) []string {
+	var items []string
+	var item bytes.Buffer
+	inItem := false
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line):
+			i++
+			item.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inItem = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inItem {
+				items = append(items, item.String())
+				item.Reset()
+				inItem = false
+			}
+		default:
+			item.WriteByte(c)
+			inItem = true
+		}
+	}
+	if inItem {
+		items = append(items, item.String())
+	}
+	return items
+}
+
+// planChains returns the commands to create our chains and the jumps to
+// them if missing
+func planChains(saved map[chainKey][]savedRule) [][]string {
+	var ops [][]string
+	var names []string
+	for name := range eveChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parent := eveChains[name]
+		key := chainKey{table: "filter", chain: name}
+		if _, ok := saved[key]; !ok {
+			ops = append(ops, []string{"-t", "filter", "-N", name})
+		}
+		found := false
+		for _, r := range saved[chainKey{table: "filter", chain: parent}] {
+			if len(r.args) == 2 && r.args[0] == "-j" &&
+				r.args[1] == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ops = append(ops, []string{"-t", "filter", "-I", parent,
+				"1", "-j", name})
+		}
+	}
+	return ops
+}
+
+// ruleTag identifies the rule of the owner. The count makes identical
+// rules distinct.
+func ruleTag(owner string, rule Rule, count int) string {
+	h := fnv.New32a()
+	h.Write([]byte(rule.Table + " " + rule.Chain + " " +
+		strings.Join(rule.Args, " ") + " " + strconv.Itoa(count)))
+	return fmt.Sprintf("%s:%08x", owner, h.Sum32())
+}
+
+// wantedRule is a rule with its tag and position in the chain order
+type wantedRule struct {
+	rule  Rule
+	tag   string
+	index int
+}
+
+// planRules returns the iptables commands which change the saved rules
+// of the owner to the wanted rules. Deletes come first. Inserts are
+// positioned relative to the rules of the owner which are kept.
+func planRules(saved map[chainKey][]savedRule, owner string,
+	rules []Rule) [][]string {
+
+	wanted := make(map[chainKey][]wantedRule)
+	counts := make(map[string]int)
+	for _, rule := range rules {
+		if rule.Table == "" {
+			rule.Table = "filter"
+		}
+		key := chainKey{table: rule.Table, chain: rule.Chain}
+		id := rule.Table + " " + rule.Chain + " " +
+			strings.Join(rule.Args, " ")
+		tag := ruleTag(owner, rule, counts[id])
+		counts[id]++
+		wanted[key] = append(wanted[key],
+			wantedRule{rule: rule, tag: tag, index: len(wanted[key])})
+	}
+	var ops [][]string
+	prefix := owner + ":"
+	for _, key := range sortedKeys(saved) {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		for _, r := range saved[key] {
+			if strings.HasPrefix(r.tag, prefix) {
+				ops = append(ops, deleteOp(key, r))
+			}
+		}
+	}
+	var inserts [][]string
+	var wantedKeys []chainKey
+	for key := range wanted {
+		wantedKeys = append(wantedKeys, key)
+	}
+	sortChainKeys(wantedKeys)
+	for _, key := range wantedKeys {
+		want := wanted[key]
+		index := make(map[string]int)
+		for _, w := range want {
+			index[w.tag] = w.index
+		}
+		// Keep the rules of the owner which are wanted and in order.
+		// model has the tags of all rules left in the chain.
+		var model []string
+		last := -1
+		for _, r := range saved[key] {
+			if strings.HasPrefix(r.tag, prefix) {
+				i, ok := index[r.tag]
+				if !ok || i <= last {
+					ops = append(ops, deleteOp(key, r))
+					continue
+				}
+				last = i
+			}
+			model = append(model, r.tag)
+		}
+		present := make(map[string]bool)
+		for _, tag := range model {
+			present[tag] = true
+		}
+		for _, w := range want {
+			if present[w.tag] {
+				continue
+			}
+			pos := insertPosition(model, index, prefix, w.index)
+			args := []string{"-t", key.table}
+			if pos == len(model) {
+				args = append(args, "-A", key.chain)
+			} else {
+				args = append(args, "-I", key.chain,
+					strconv.Itoa(pos+1))
+			}
+			args = append(args, w.rule.Args...)
+			args = append(args, "-m", "comment", "--comment", w.tag)
+			inserts = append(inserts, args)
+			model = append(model, "")
+			copy(model[pos+1:], model[pos:])
+			model[pos] = w.tag
+		}
+	}
+	return append(ops, inserts...)
+}
+
+// insertPosition returns the index in model before the first rule of the
+// owner which comes later than wantIndex, otherwise after the last rule
+// of the owner, otherwise at the end
+func insertPosition(model []string, index map[string]int, prefix string,
+	wantIndex int) int {
+
+	lastOwned := -1
+	for j, tag := range model {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		if index[tag] > wantIndex {
+			return j
+		}
+		lastOwned = j
+	}
+	if lastOwned >= 0 {
+		return lastOwned + 1
+	}
+	return len(model)
+}
+
+func sortedKeys(saved map[chainKey][]savedRule) []chainKey {
+	var keys []chainKey
+	for key := range saved {
+		keys = append(keys, key)
+	}
+	sortChainKeys(keys)
+	return keys
+}
+
+func sortChainKeys(keys []chainKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].chain < keys[j].chain
+	})
+}
+
+func deleteOp(key chainKey, r savedRule) []string {
+	args := []string{"-t", key.table, "-D", key.chain}
+	return append(args, r.args...)
+}
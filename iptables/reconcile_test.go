@@ -0,0 +1,253 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package iptables
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	line := `-A FORWARD -o bn1 -m comment --comment "acl-bn1:1" -j LOG --log-prefix "FORWARD:TO: \"x\"" --log-level 3`
+	expected := []string{"-A", "FORWARD", "-o", "bn1", "-m", "comment",
+		"--comment", "acl-bn1:1", "-j", "LOG", "--log-prefix",
+		`FORWARD:TO: "x"`, "--log-level", "3"}
+	if got := splitQuoted(line); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %q expected %q", got, expected)
+	}
+}
+
+func TestParseSave(t *testing.T) {
+	out := `# Generated by iptables-save
+*raw
+:PREROUTING ACCEPT [0:0]
+-A PREROUTING -i bn1 -j CT --zone-orig 1
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment ssh:0000abcd -j REJECT --reject-with tcp-reset
+-A INPUT -p tcp -m tcp --dport 8080 -j REJECT --reject-with tcp-reset
+COMMIT
+`
+	saved := parseSave(out)
+	raw := saved[chainKey{table: "raw", chain: "PREROUTING"}]
+	if len(raw) != 1 || raw[0].tag != "" {
+		t.Errorf("Got raw %+v", raw)
+	}
+	input := saved[chainKey{table: "filter", chain: "INPUT"}]
+	if len(input) != 2 || input[0].tag != "ssh:0000abcd" ||
+		input[0].args[0] != "-p" || input[1].tag != "" {
+		t.Errorf("Got input %+v", input)
+	}
+}
+
+// saveLine returns what iptables-save shows after the insert op
+func saveLine(op []string) string {
+	// Skip "-t table -A|-I chain [pos]"
+	args := op[4:]
+	if op[2] == "-I" {
+		args = op[5:]
+	}
+	return "-A " + op[3] + " " + strings.Join(args, " ")
+}
+
+func TestPlanRules(t *testing.T) {
+	rule := func(port string) Rule {
+		return Rule{Chain: "INPUT",
+			Args: []string{"-p", "tcp", "--dport", port, "-j", "REJECT"}}
+	}
+	rules := []Rule{rule("22"), rule("80"), rule("443")}
+
+	// From nothing all are appended in order
+	ops := planRules(parseSave("*filter\n"), "ssh", rules)
+	if len(ops) != 3 {
+		t.Fatalf("Got %q", ops)
+	}
+	var lines []string
+	for i, op := range ops {
+		if op[2] != "-A" || op[3] != "INPUT" || op[7] != rules[i].Args[3] {
+			t.Errorf("Got %q", op)
+		}
+		lines = append(lines, saveLine(op))
+	}
+
+	// In sync
+	all := "*filter\n-A INPUT -j ACCEPT\n" + strings.Join(lines, "\n")
+	if ops := planRules(parseSave(all), "ssh", rules); len(ops) != 0 {
+		t.Errorf("Expected no changes got %q", ops)
+	}
+	// Another owner is not affected
+	if ops := planRules(parseSave(all), "vnc", nil); len(ops) != 0 {
+		t.Errorf("Expected no changes for vnc got %q", ops)
+	}
+
+	// Missing middle rule is inserted before the third
+	missing := "*filter\n-A INPUT -j ACCEPT\n" + lines[0] + "\n" + lines[2]
+	ops = planRules(parseSave(missing), "ssh", rules)
+	if len(ops) != 1 || ops[0][2] != "-I" || ops[0][4] != "3" ||
+		ops[0][8] != "80" {
+		t.Errorf("Got %q", ops)
+	}
+
+	// Duplicate and stale rules are deleted
+	stale := "-A INPUT -p tcp --dport 23 -m comment --comment ssh:00000001 -j REJECT"
+	dup := all + "\n" + lines[1] + "\n" + stale
+	ops = planRules(parseSave(dup), "ssh", rules)
+	if len(ops) != 2 || ops[0][2] != "-D" || ops[0][7] != "80" ||
+		ops[1][2] != "-D" || ops[1][7] != "23" {
+		t.Errorf("Got %q", ops)
+	}
+
+	// Out of order; the first is deleted and inserted before the others
+	reordered := "*filter\n" + lines[1] + "\n" + lines[2] + "\n" + lines[0]
+	ops = planRules(parseSave(reordered), "ssh", rules)
+	if len(ops) != 2 || ops[0][2] != "-D" || ops[0][7] != "22" ||
+		ops[1][2] != "-I" || ops[1][4] != "1" || ops[1][8] != "22" {
+		t.Errorf("Got %q", ops)
+	}
+
+	// Removing the owner deletes all
+	ops = planRules(parseSave(all), "ssh", nil)
+	if len(ops) != 3 {
+		t.Errorf("Got %q", ops)
+	}
+	for _, op := range ops {
+		if op[2] != "-D" {
+			t.Errorf("Got %q", op)
+		}
+	}
+}
+
+func TestPlanChains(t *testing.T) {
+	out := `*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:eve-input - [0:0]
+-A INPUT -j eve-input
+COMMIT
+`
+	saved := parseSave(out)
+	if _, ok := saved[chainKey{table: "filter", chain: EveInputChain}]; !ok {
+		t.Errorf("Missing declared chain in %+v", saved)
+	}
+	expected := [][]string{
+		{"-t", "filter", "-N", EveForwardChain},
+		{"-t", "filter", "-I", "FORWARD", "1", "-j", EveForwardChain},
+	}
+	if ops := planChains(saved); !reflect.DeepEqual(ops, expected) {
+		t.Errorf("Got %q expected %q", ops, expected)
+	}
+	out = strings.Replace(out, "COMMIT",
+		":eve-forward - [0:0]\n-A FORWARD -j eve-forward\nCOMMIT", 1)
+	if ops := planChains(parseSave(out)); len(ops) != 0 {
+		t.Errorf("Expected no changes got %q", ops)
+	}
+}
+
+func TestUpdateSaved(t *testing.T) {
+	rule := func(port string) Rule {
+		return Rule{Chain: EveInputChain,
+			Args: []string{"-p", "tcp", "--dport", port, "-j", "REJECT"}}
+	}
+	out := `*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+-A INPUT -j ACCEPT
+COMMIT
+`
+	saved := parseSave(out)
+	apply := func(ops [][]string) {
+		for _, op := range ops {
+			updateSaved(saved, op)
+		}
+	}
+	sshRules := []Rule{rule("22"), rule("2222")}
+	apply(planChains(saved))
+	apply(planRules(saved, "ssh", sshRules))
+	if ops := planChains(saved); len(ops) != 0 {
+		t.Errorf("Expected no chain changes got %q", ops)
+	}
+	input := saved[chainKey{table: "filter", chain: "INPUT"}]
+	if len(input) != 2 || input[0].args[1] != EveInputChain {
+		t.Errorf("Got input %+v", input)
+	}
+
+	// Another owner is placed with the rules of the first
+	vncRules := []Rule{rule("5900")}
+	apply(planRules(saved, "vnc", vncRules))
+	if ops := planRules(saved, "ssh", sshRules); len(ops) != 0 {
+		t.Errorf("Expected no changes for ssh got %q", ops)
+	}
+	if ops := planRules(saved, "vnc", vncRules); len(ops) != 0 {
+		t.Errorf("Expected no changes for vnc got %q", ops)
+	}
+
+	// Reordering and deleting
+	sshRules = []Rule{rule("2222"), rule("22")}
+	apply(planRules(saved, "ssh", sshRules))
+	if ops := planRules(saved, "ssh", sshRules); len(ops) != 0 {
+		t.Errorf("Expected no changes after reorder got %q", ops)
+	}
+	apply(planRules(saved, "ssh", nil))
+	eveInput := saved[chainKey{table: "filter", chain: EveInputChain}]
+	if len(eveInput) != 1 || !strings.HasPrefix(eveInput[0].tag, "vnc:") {
+		t.Errorf("Got %+v", eveInput)
+	}
+}
+
+func TestCheckOp(t *testing.T) {
+	tests := []struct {
+		op       []string
+		expected []string
+	}{
+		{[]string{"-t", "filter", "-A", "INPUT", "-j", "ACCEPT"},
+			[]string{"-t", "filter", "-C", "INPUT", "-j", "ACCEPT"}},
+		{[]string{"-t", "filter", "-I", "INPUT", "3", "-j", "ACCEPT"},
+			[]string{"-t", "filter", "-C", "INPUT", "-j", "ACCEPT"}},
+		{[]string{"-t", "filter", "-I", "FORWARD", "-j", "eve-forward"},
+			[]string{"-t", "filter", "-C", "FORWARD", "-j", "eve-forward"}},
+		{[]string{"-t", "filter", "-D", "INPUT", "-j", "ACCEPT"}, nil},
+		{[]string{"-t", "filter", "-N", "eve-input"}, nil},
+	}
+	for _, test := range tests {
+		if got := checkOp(test.op); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q: got %q expected %q", test.op, got, test.expected)
+		}
+	}
+}
+
+func TestFirewallStatus(t *testing.T) {
+	savedSets, savedErrors := ruleSets, ownerErrors
+	defer func() { ruleSets, ownerErrors = savedSets, savedErrors }()
+	ruleSets = make(map[string]RuleSet)
+	ownerErrors = make(map[string]ownerError)
+
+	ruleSets["vnc"] = RuleSet{Owner: "vnc",
+		IPv4: []Rule{{Chain: EveInputChain, Args: []string{"-j", "DROP"}}}}
+	recordResult("vnc", nil)
+	recordResult("acl-bn1-nbu1x1", &RuleMissingError{IPVer: 4,
+		Args: []string{"-t", "filter", "-C", EveForwardChain}})
+
+	status := FirewallStatus("zedrouter")
+	if status.Key() != "zedrouter" || len(status.Owners) != 2 {
+		t.Fatalf("Got %+v", status)
+	}
+	acl, vnc := status.Owners[0], status.Owners[1]
+	if acl.Owner != "acl-bn1-nbu1x1" || acl.Error == "" ||
+		acl.ErrorTime.IsZero() {
+		t.Errorf("Got %+v", acl)
+	}
+	if vnc.Owner != "vnc" || vnc.Error != "" ||
+		len(vnc.IPv4Rules) != 1 ||
+		vnc.IPv4Rules[0] != "-t filter -A eve-input -j DROP" {
+		t.Errorf("Got %+v", vnc)
+	}
+
+	// Success clears the failure
+	recordResult("acl-bn1-nbu1x1", nil)
+	if status := FirewallStatus("zedrouter"); len(status.Owners) != 1 {
+		t.Errorf("Got %+v", status)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Optionally log the packets rejected on the uplinks to an NFLOG group
+// for security monitoring. The logging is rate limited per reject rule.
+
+package iptables
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NFLOG group and prefix of the rejected packets
+const (
+	RejectLogGroup  = 1
+	RejectLogPrefix = "eve-reject"
+)
+
+// Logged packets per minute per reject rule; zero means no logging
+var rejectLogRate uint32
+
+// SetRejectLogRate takes effect for the reject rules added after it is
+// called hence the caller needs to update the ssh and VNC access
+func SetRejectLogRate(perMinute uint32) {
+	log.Infof("SetRejectLogRate(%d)\n", perMinute)
+	rejectLogRate = perMinute
+}
+
+// addRejectLog logs the packets from the uplinks which match the rule
+// before it rejects them
+func addRejectLog(set *RuleSet, rule Rule) {
+	if rejectLogRate == 0 {
+		return
+	}
+	// iptables -A eve-input -p tcp --dport 22 ! -i bn+
+	//   -m limit --limit 10/minute --limit-burst 10
+	//   -j NFLOG --nflog-group 1 --nflog-prefix eve-reject
+	var args []string
+	for i, arg := range rule.Args {
+		if arg == "-j" {
+			args = append(args, rule.Args[:i]...)
+			break
+		}
+	}
+	rate := strconv.Itoa(int(rejectLogRate))
+	args = append(args, "!", "-i", appBridges,
+		"-m", "limit", "--limit", rate+"/minute", "--limit-burst", rate,
+		"-j", "NFLOG", "--nflog-group", strconv.Itoa(RejectLogGroup),
+		"--nflog-prefix", RejectLogPrefix)
+	logRule := Rule{Table: rule.Table, Chain: rule.Chain, Args: args}
+	set.IPv4 = append(set.IPv4, logRule)
+	set.IPv6 = append(set.IPv6, logRule)
+}
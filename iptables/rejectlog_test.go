@@ -0,0 +1,35 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRejectLog(t *testing.T) {
+	saved := rejectLogRate
+	defer func() { rejectLogRate = saved }()
+
+	rejectLogRate = 0
+	set := RuleSet{Owner: "vnc"}
+	addDropPortRange(&set, 5900, 5999)
+	if len(set.IPv4) != 1 || len(set.IPv6) != 1 {
+		t.Fatalf("Got %+v", set)
+	}
+
+	rejectLogRate = 10
+	set = RuleSet{Owner: "vnc"}
+	addDropPortRange(&set, 5900, 5999)
+	if len(set.IPv4) != 2 || len(set.IPv6) != 2 {
+		t.Fatalf("Got %+v", set)
+	}
+	expected := "-p tcp --dport 5900:5999 ! -i bn+ -m limit --limit 10/minute --limit-burst 10 -j NFLOG --nflog-group 1 --nflog-prefix eve-reject"
+	if got := strings.Join(set.IPv4[0].Args, " "); got != expected {
+		t.Errorf("Got %s expected %s", got, expected)
+	}
+	if set.IPv4[1].Args[len(set.IPv4[1].Args)-1] != "tcp-reset" {
+		t.Errorf("Got reject %v", set.IPv4[1].Args)
+	}
+}
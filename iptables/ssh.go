@@ -1,98 +1,180 @@
 // Copyright (c) 2018 Zededa, Inc.
 // SPDX-License-Identifier: Apache-2.0
 
-// Also blocks the VNC ports (5900...) if ssh is blocked
-// Always blocks 4822
+// Also blocks the VNC ports (5900...) if VNC is not allowed
+// Always blocks 4822 except from localhost
 // Also always blocks port 8080
+// If allowed prefixes are set, ssh and VNC are only allowed from those
+// If rateLimit is set, each source can only open that many new ssh
+// connections per minute
 
 package iptables
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func UpdateSshAccess(enable bool, first bool) {
+// Name of the hashlimit table for the ssh rate limit
+const sshHashlimitName = "eve-ssh"
 
-	log.Infof("updateSshAccess(enable %v first %v)\n",
-		enable, first)
+func UpdateSshAccess(enable bool, prefixes []string, rateLimit uint32) {
 
-	if first {
-		// Always blocked
-		dropPortRange(8080, 8080)
-		allowLocalPortRange(4822, 4822)
-		allowLocalPortRange(5900, 5999)
+	log.Infof("updateSshAccess(enable %v prefixes %v rateLimit %d)\n",
+		enable, prefixes, rateLimit)
+
+	// Always blocked
+	set := RuleSet{Owner: "ssh"}
+	addDropPortRange(&set, 8080, 8080)
+	addAllowLocalPortRange(&set, 4822, 4822)
+	addDropPortRange(&set, 4822, 4822)
+	if enable && rateLimit != 0 {
+		addRateLimit(&set, 22, rateLimit)
 	}
 	if enable {
-		allowPortRange(22, 22)
-	} else {
-		dropPortRange(22, 22)
+		addAllowPrefixes(&set, 22, 22, prefixes)
+	}
+	if !enable || len(prefixes) != 0 {
+		addDropPortRange(&set, 22, 22)
+	}
+	if err := SetRules(set); err != nil {
+		log.Errorf("updateSshAccess failed: %s\n", err)
 	}
 }
 
-func UpdateVncAccess(enable bool) {
+func UpdateVncAccess(enable bool, prefixes []string) {
 
-	log.Infof("updateVncAccess(enable %v\n", enable)
+	log.Infof("updateVncAccess(enable %v prefixes %v)\n", enable, prefixes)
 
+	set := RuleSet{Owner: "vnc"}
+	addAllowLocalPortRange(&set, 5900, 5999)
 	if enable {
-		allowPortRange(5900, 5999)
-	} else {
-		dropPortRange(5900, 5999)
+		addAllowPrefixes(&set, 5900, 5999, prefixes)
+	}
+	if !enable || len(prefixes) != 0 {
+		addDropPortRange(&set, 5900, 5999)
+	}
+	if err := SetRules(set); err != nil {
+		log.Errorf("updateVncAccess failed: %s\n", err)
 	}
 }
 
-func allowPortRange(startPort int, endPort int) {
-	log.Infof("allowPortRange(%d, %d)\n", startPort, endPort)
-	// Delete these rules
-	// iptables -D INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	// ip6tables -D INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	var portStr string
+func portRangeStr(startPort int, endPort int) string {
 	if startPort == endPort {
-		portStr = fmt.Sprintf("%d", startPort)
-	} else {
-		portStr = fmt.Sprintf("%d:%d", startPort, endPort)
+		return fmt.Sprintf("%d", startPort)
 	}
-	IptableCmd("-D", "INPUT", "-p", "tcp", "--dport", portStr, "-j", "REJECT", "--reject-with", "tcp-reset")
-	Ip6tableCmd("-D", "INPUT", "-p", "tcp", "--dport", portStr, "-j", "REJECT", "--reject-with", "tcp-reset")
+	return fmt.Sprintf("%d:%d", startPort, endPort)
 }
 
-// Like above but allow for 127.0.0.1 to 127.0.0.1 and block for other IPs
-func allowLocalPortRange(startPort int, endPort int) {
-	log.Infof("allowPortRange(%d, %d)\n", startPort, endPort)
-	// Add these rules
-	// XXX note no OUTPUT allow with sport
-	// iptables -A INPUT -p tcp -s 127.0.0.1 -d 127.0.0.1 --dport 22 -j ACCEPT
-	// iptables -A INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	// iptables -A INPUT -p tcp -s ::1 -d ::1 --dport 22 -j ACCEPT
-	// ip6tables -A INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	var portStr string
-	if startPort == endPort {
-		portStr = fmt.Sprintf("%d", startPort)
-	} else {
-		portStr = fmt.Sprintf("%d:%d", startPort, endPort)
+// Allow for 127.0.0.1 to 127.0.0.1; the caller blocks other IPs
+// XXX note no OUTPUT allow with sport
+func addAllowLocalPortRange(set *RuleSet, startPort int, endPort int) {
+	// iptables -A eve-input -p tcp -s 127.0.0.1 -d 127.0.0.1 --dport 22 -j ACCEPT
+	// ip6tables -A eve-input -p tcp -s ::1 -d ::1 --dport 22 -j ACCEPT
+	portStr := portRangeStr(startPort, endPort)
+	set.IPv4 = append(set.IPv4, Rule{Chain: EveInputChain,
+		Args: []string{"-p", "tcp", "--dport", portStr,
+			"-s", "127.0.0.1", "-d", "127.0.0.1", "-j", "ACCEPT"}})
+	set.IPv6 = append(set.IPv6, Rule{Chain: EveInputChain,
+		Args: []string{"-p", "tcp", "--dport", portStr,
+			"-s", "::1", "-d", "::1", "-j", "ACCEPT"}})
+}
+
+// Allow from the prefixes of the matching IP version; the caller blocks
+// other IPs
+func addAllowPrefixes(set *RuleSet, startPort int, endPort int,
+	prefixes []string) {
+
+	// iptables -A eve-input -p tcp --dport 22 -s 10.1.0.0/16 -j ACCEPT
+	portStr := portRangeStr(startPort, endPort)
+	for _, prefix := range prefixes {
+		ip, ipnet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			log.Errorf("addAllowPrefixes: ignoring %s\n", err)
+			continue
+		}
+		rule := Rule{Chain: EveInputChain,
+			Args: []string{"-p", "tcp", "--dport", portStr,
+				"-s", ipnet.String(), "-j", "ACCEPT"}}
+		if ip.To4() != nil {
+			set.IPv4 = append(set.IPv4, rule)
+		} else {
+			set.IPv6 = append(set.IPv6, rule)
+		}
 	}
-	IptableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr,
-		"-s", "127.0.0.1", "-d", "127.0.0.1", "-j", "ACCEPT")
-	IptableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr,
-		"-j", "REJECT", "--reject-with", "tcp-reset")
-	Ip6tableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr,
-		"-s", "::1", "-d", "::1", "-j", "ACCEPT")
-	Ip6tableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr,
-		"-j", "REJECT", "--reject-with", "tcp-reset")
 }
 
-func dropPortRange(startPort int, endPort int) {
-	log.Infof("dropPortRange(%d, %d)\n", startPort, endPort)
-	// Add these rules
-	// iptables -A INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	// ip6tables -A INPUT -p tcp --dport 22 -j REJECT --reject-with tcp-reset
-	var portStr string
-	if startPort == endPort {
-		portStr = fmt.Sprintf("%d", startPort)
-	} else {
-		portStr = fmt.Sprintf("%d:%d", startPort, endPort)
+// Reject new connections above the per source rate
+func addRateLimit(set *RuleSet, port int, perMinute uint32) {
+	// iptables -A eve-input -p tcp --dport 22 -m conntrack --ctstate NEW
+	//   -m hashlimit --hashlimit-above 6/minute --hashlimit-burst 6
+	//   --hashlimit-mode srcip --hashlimit-name eve-ssh
+	//   -j REJECT --reject-with tcp-reset
+	rate := strconv.Itoa(int(perMinute))
+	rule := Rule{Chain: EveInputChain,
+		Args: []string{"-p", "tcp", "--dport", strconv.Itoa(port),
+			"-m", "conntrack", "--ctstate", "NEW",
+			"-m", "hashlimit", "--hashlimit-above", rate + "/minute",
+			"--hashlimit-burst", rate, "--hashlimit-mode", "srcip",
+			"--hashlimit-name", sshHashlimitName,
+			"-j", "REJECT", "--reject-with", "tcp-reset"}}
+	set.IPv4 = append(set.IPv4, rule)
+	set.IPv6 = append(set.IPv6, rule)
+}
+
+// SshRateLimitDrops returns the number of ssh connections rejected by
+// the rate limit since the rules were added
+func SshRateLimitDrops() (uint64, error) {
+	out, err := IptableCmdOut(false, "-t", "filter", "-S", EveInputChain, "-v")
+	if err != nil {
+		return 0, err
 	}
-	IptableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr, "-j", "REJECT", "--reject-with", "tcp-reset")
-	Ip6tableCmd("-A", "INPUT", "-p", "tcp", "--dport", portStr, "-j", "REJECT", "--reject-with", "tcp-reset")
+	drops := hashlimitPackets(out, sshHashlimitName)
+	out, err = Ip6tableCmdOut(false, "-t", "filter", "-S", EveInputChain, "-v")
+	if err != nil {
+		return drops, err
+	}
+	return drops + hashlimitPackets(out, sshHashlimitName), nil
+}
+
+// hashlimitPackets sums the packet counters of the rules with the
+// hashlimit name in the output of iptables -S -v
+func hashlimitPackets(out string, name string) uint64 {
+	var total uint64
+	for _, line := range strings.Split(out, "\n") {
+		items := strings.Fields(line)
+		found := false
+		var pkts uint64
+		for i := 0; i+1 < len(items); i++ {
+			switch items[i] {
+			case "--hashlimit-name":
+				found = items[i+1] == name
+			case "-c":
+				u, err := strconv.ParseUint(items[i+1], 10, 64)
+				if err == nil {
+					pkts = u
+				}
+			}
+		}
+		if found {
+			total += pkts
+		}
+	}
+	return total
+}
+
+func addDropPortRange(set *RuleSet, startPort int, endPort int) {
+	// iptables -A eve-input -p tcp --dport 22 -j REJECT --reject-with tcp-reset
+	// ip6tables -A eve-input -p tcp --dport 22 -j REJECT --reject-with tcp-reset
+	rule := Rule{Chain: EveInputChain,
+		Args: []string{"-p", "tcp", "--dport",
+			portRangeStr(startPort, endPort),
+			"-j", "REJECT", "--reject-with", "tcp-reset"}}
+	addRejectLog(set, rule)
+	set.IPv4 = append(set.IPv4, rule)
+	set.IPv6 = append(set.IPv6, rule)
 }
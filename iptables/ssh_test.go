@@ -0,0 +1,42 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package iptables
+
+import (
+	"testing"
+)
+
+func TestHashlimitPackets(t *testing.T) {
+	out := `-P INPUT ACCEPT -c 0 0
+-N eve-input
+-A eve-input -p tcp -m tcp --dport 22 -m conntrack --ctstate NEW -m hashlimit --hashlimit-above 6/min --hashlimit-burst 6 --hashlimit-mode srcip --hashlimit-name eve-ssh -m comment --comment ssh:0badcafe -c 12 720 -j REJECT --reject-with tcp-reset
+-A eve-input -p tcp -m tcp --dport 80 -m hashlimit --hashlimit-above 1/sec --hashlimit-name other -c 99 5940 -j DROP
+-A eve-input -p tcp -m tcp --dport 8080 -c 3 180 -j REJECT --reject-with tcp-reset
+`
+	if pkts := hashlimitPackets(out, sshHashlimitName); pkts != 12 {
+		t.Errorf("Got %d expected 12", pkts)
+	}
+	if pkts := hashlimitPackets("", sshHashlimitName); pkts != 0 {
+		t.Errorf("Got %d for no rules", pkts)
+	}
+}
+
+func TestSshRules(t *testing.T) {
+	set := RuleSet{Owner: "ssh"}
+	addRateLimit(&set, 22, 6)
+	addAllowPrefixes(&set, 22, 22, []string{"10.1.0.0/16", "fd00::/8",
+		"bogus"})
+	addDropPortRange(&set, 22, 22)
+	if len(set.IPv4) != 3 || len(set.IPv6) != 3 {
+		t.Fatalf("Got %+v", set)
+	}
+	if set.IPv4[1].Args[5] != "10.1.0.0/16" ||
+		set.IPv6[1].Args[5] != "fd00::/8" {
+		t.Errorf("Got prefixes %v and %v", set.IPv4[1].Args,
+			set.IPv6[1].Args)
+	}
+	if set.IPv4[2].Args[len(set.IPv4[2].Args)-1] != "tcp-reset" {
+		t.Errorf("Got drop %v", set.IPv4[2].Args)
+	}
+}
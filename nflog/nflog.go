@@ -0,0 +1,226 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Minimal reader of the packets sent by iptables -j NFLOG to a group.
+// Only the start of each packet is copied, which is enough to get the
+// addresses and ports.
+
+package nflog
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+const (
+	nfnlSubsysUlog    = 4
+	receiveBufferSize = 65536
+)
+
+// Message types in the ulog subsystem
+const (
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+)
+
+// Config attributes and commands
+const (
+	nfulaCfgCmd        = 1
+	nfulaCfgMode       = 2
+	nfulnlCfgCmdBind   = 1
+	nfulnlCopyPacket   = 2
+	defaultCopyRange   = 128
+	ipv4HeaderMinLen   = 20
+	ipv6HeaderLen      = 40
+	transportHeaderLen = 4 // Enough for the ports
+)
+
+// Packet attributes
+const (
+	nfulaIfindexIndev = 4
+	nfulaPayload      = 9
+	nfulaPrefix       = 10
+)
+
+// Packet is the start of a logged packet
+type Packet struct {
+	Prefix   string // From --nflog-prefix
+	InIfName string // Empty if unknown
+	Family   uint8  // syscall.AF_INET or AF_INET6
+	Protocol uint8
+	Src      net.IP
+	Dst      net.IP
+	SrcPort  uint16 // Only for TCP and UDP
+	DstPort  uint16
+}
+
+// Reader receives the packets logged to a group
+type Reader struct {
+	fd int
+}
+
+// Open binds to the NFLOG group
+func Open(group uint16) (*Reader, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, nfnetlink.NetlinkNetfilter)
+	if err != nil {
+		return nil, err
+	}
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	r := &Reader{fd: fd}
+	if err := r.config(group, nfnetlink.AppendAttribute(nil, nfulaCfgCmd,
+		[]byte{nfulnlCfgCmdBind})); err != nil {
+		r.Close()
+		return nil, err
+	}
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode[0:4], defaultCopyRange)
+	mode[4] = nfulnlCopyPacket
+	if err := r.config(group, nfnetlink.AppendAttribute(nil, nfulaCfgMode,
+		mode)); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close stops receiving
+func (r *Reader) Close() error {
+	return syscall.Close(r.fd)
+}
+
+// config sends a config request and waits for the ack
+func (r *Reader) config(group uint16, attrs []byte) error {
+	b := nfnetlink.NewRequest(nfnlSubsysUlog, nfulnlMsgConfig,
+		syscall.NLM_F_ACK, 0, syscall.AF_UNSPEC, group, attrs)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Sendto(r.fd, b, 0, sa); err != nil {
+		return err
+	}
+	msgs, err := r.receive()
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.NLMSG_ERROR {
+			continue
+		}
+		return nfnetlink.ParseError(m.Data)
+	}
+	return errors.New("No ack for NFLOG config")
+}
+
+func (r *Reader) receive() ([]syscall.NetlinkMessage, error) {
+	buf := make([]byte, receiveBufferSize)
+	n, _, err := syscall.Recvfrom(r.fd, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	return syscall.ParseNetlinkMessage(buf[:n])
+}
+
+// Receive blocks until there are packets. An ENOBUFS error means that
+// packets were lost; the caller can continue receiving.
+func (r *Reader) Receive() ([]Packet, error) {
+	msgs, err := r.receive()
+	if err != nil {
+		return nil, err
+	}
+	var packets []Packet
+	for _, m := range msgs {
+		if m.Header.Type != nfnlSubsysUlog<<8|nfulnlMsgPacket {
+			continue
+		}
+		p, err := parsePacket(m.Data)
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
+
+// parsePacket parses the nfgenmsg header and the attributes
+func parsePacket(b []byte) (Packet, error) {
+	var p Packet
+	if len(b) < nfnetlink.NfgenmsgLen {
+		return p, errors.New("Truncated NFLOG message")
+	}
+	p.Family = b[0]
+	attrs, err := nfnetlink.ParseAttributes(b[nfnetlink.NfgenmsgLen:])
+	if err != nil {
+		return p, err
+	}
+	for _, a := range attrs {
+		value := a.Value
+		switch a.Type {
+		case nfulaPrefix:
+			// NUL terminated
+			for i, c := range value {
+				if c == 0 {
+					value = value[:i]
+					break
+				}
+			}
+			p.Prefix = string(value)
+		case nfulaIfindexIndev:
+			if len(value) >= 4 {
+				index := int(binary.BigEndian.Uint32(value))
+				if intf, err := net.InterfaceByIndex(index); err == nil {
+					p.InIfName = intf.Name
+				}
+			}
+		case nfulaPayload:
+			parsePayload(value, &p)
+		}
+	}
+	return p, nil
+}
+
+// parsePayload gets the addresses and ports from the IP header. IPv6
+// extension headers are not followed.
+func parsePayload(b []byte, p *Packet) {
+	if len(b) < 1 {
+		return
+	}
+	var transport []byte
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0xf) * 4
+		if len(b) < ipv4HeaderMinLen || ihl < ipv4HeaderMinLen {
+			return
+		}
+		p.Family = syscall.AF_INET
+		p.Protocol = b[9]
+		p.Src = net.IP(append([]byte{}, b[12:16]...))
+		p.Dst = net.IP(append([]byte{}, b[16:20]...))
+		if len(b) >= ihl {
+			transport = b[ihl:]
+		}
+	case 6:
+		if len(b) < ipv6HeaderLen {
+			return
+		}
+		p.Family = syscall.AF_INET6
+		p.Protocol = b[6]
+		p.Src = net.IP(append([]byte{}, b[8:24]...))
+		p.Dst = net.IP(append([]byte{}, b[24:40]...))
+		transport = b[ipv6HeaderLen:]
+	default:
+		return
+	}
+	if (p.Protocol == syscall.IPPROTO_TCP ||
+		p.Protocol == syscall.IPPROTO_UDP) &&
+		len(transport) >= transportHeaderLen {
+		p.SrcPort = binary.BigEndian.Uint16(transport[0:2])
+		p.DstPort = binary.BigEndian.Uint16(transport[2:4])
+	}
+}
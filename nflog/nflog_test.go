@@ -0,0 +1,59 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package nflog
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/zededa/go-provision/nfnetlink"
+)
+
+func TestParsePacket(t *testing.T) {
+	// TCP SYN from 192.0.2.7:40000 to 10.0.0.5:22
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[9] = syscall.IPPROTO_TCP
+	copy(ip[12:16], net.ParseIP("192.0.2.7").To4())
+	copy(ip[16:20], net.ParseIP("10.0.0.5").To4())
+	payload := append(ip, 0x9c, 0x40, 0x00, 0x16)
+
+	b := []byte{syscall.AF_INET, nfnetlink.NfnetlinkV0, 0, 1}
+	b = nfnetlink.AppendAttribute(b, nfulaPrefix, []byte("eve-reject\x00"))
+	b = nfnetlink.AppendAttribute(b, nfulaPayload, payload)
+	p, err := parsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Prefix != "eve-reject" || p.Family != syscall.AF_INET ||
+		p.Protocol != syscall.IPPROTO_TCP ||
+		!p.Src.Equal(net.ParseIP("192.0.2.7")) ||
+		!p.Dst.Equal(net.ParseIP("10.0.0.5")) ||
+		p.SrcPort != 40000 || p.DstPort != 22 {
+		t.Errorf("Got %+v", p)
+	}
+
+	// IPv6 with the transport header cut off
+	ip6 := make([]byte, 40)
+	ip6[0] = 0x60
+	ip6[6] = syscall.IPPROTO_TCP
+	copy(ip6[8:24], net.ParseIP("fd00::7"))
+	copy(ip6[24:40], net.ParseIP("fd00::5"))
+	b = []byte{syscall.AF_INET6, nfnetlink.NfnetlinkV0, 0, 1}
+	b = nfnetlink.AppendAttribute(b, nfulaPayload, ip6)
+	p, err = parsePacket(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Family != syscall.AF_INET6 || !p.Src.Equal(net.ParseIP("fd00::7")) ||
+		p.DstPort != 0 {
+		t.Errorf("Got %+v", p)
+	}
+
+	if _, err := parsePacket([]byte{syscall.AF_INET, 0, 0, 1, 0xff, 0,
+		0, 0}); err == nil {
+		t.Errorf("Expected error for bad attribute length")
+	}
+}
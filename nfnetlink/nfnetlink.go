@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Message and attribute encoding shared by the netfilter netlink clients
+// in conntrack and nflog. We do our own parsing of the attributes since
+// the parser in the netlink package assumes a fixed layout.
+
+package nfnetlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	NetlinkNetfilter = 12
+	NfnetlinkV0      = 0
+	NfgenmsgLen      = 4
+)
+
+// Attribute type flags
+const (
+	NlaFNested       = 0x8000
+	NlaFNetByteorder = 0x4000
+	NlaTypeMask      = ^uint16(NlaFNested | NlaFNetByteorder)
+)
+
+// NativeEndian is the byte order of the netlink headers and attribute
+// headers. The attribute values are in network byte order.
+var NativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Attribute is one parsed netlink attribute
+type Attribute struct {
+	Type   uint16 // Without the flags
+	Nested bool
+	Value  []byte
+}
+
+// ParseAttributes returns the attributes at one level. Parse Value again
+// for nested attributes.
+func ParseAttributes(b []byte) ([]Attribute, error) {
+	var attrs []Attribute
+	for len(b) >= 4 {
+		l := int(NativeEndian.Uint16(b[0:2]))
+		t := NativeEndian.Uint16(b[2:4])
+		if l < 4 || l > len(b) {
+			errStr := fmt.Sprintf("Bad netlink attribute length %d", l)
+			return nil, errors.New(errStr)
+		}
+		attrs = append(attrs, Attribute{Type: t & NlaTypeMask,
+			Nested: t&NlaFNested != 0, Value: b[4:l]})
+		l = (l + 3) &^ 3
+		if l > len(b) {
+			l = len(b)
+		}
+		b = b[l:]
+	}
+	return attrs, nil
+}
+
+// AppendAttribute appends the attribute padded to four bytes
+func AppendAttribute(b []byte, typ uint16, value []byte) []byte {
+	var hdr [4]byte
+	NativeEndian.PutUint16(hdr[0:2], uint16(4+len(value)))
+	NativeEndian.PutUint16(hdr[2:4], typ)
+	b = append(b, hdr[:]...)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// AppendNested appends the already encoded nested attributes
+func AppendNested(b []byte, typ uint16, nested []byte) []byte {
+	return AppendAttribute(b, typ|NlaFNested, nested)
+}
+
+// NewRequest returns the netlink header and the nfgenmsg header followed
+// by attrs. NLM_F_REQUEST is added to flags. resID is the nfgenmsg
+// res_id e.g., the NFLOG group.
+func NewRequest(subsys uint8, msgType uint8, flags uint16, seq uint32,
+	family uint8, resID uint16, attrs []byte) []byte {
+
+	b := make([]byte, syscall.NLMSG_HDRLEN+NfgenmsgLen,
+		syscall.NLMSG_HDRLEN+NfgenmsgLen+len(attrs))
+	b = append(b, attrs...)
+	NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	NativeEndian.PutUint16(b[4:6], uint16(subsys)<<8|uint16(msgType))
+	NativeEndian.PutUint16(b[6:8], syscall.NLM_F_REQUEST|flags)
+	NativeEndian.PutUint32(b[8:12], seq)
+	b[16] = family
+	b[17] = NfnetlinkV0
+	binary.BigEndian.PutUint16(b[18:20], resID)
+	return b
+}
+
+// ParseError returns nil for an ack, otherwise the error in the
+// NLMSG_ERROR data
+func ParseError(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("Truncated netlink error")
+	}
+	errno := int32(NativeEndian.Uint32(data[0:4]))
+	if errno != 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
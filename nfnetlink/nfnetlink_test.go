@@ -0,0 +1,78 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package nfnetlink
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	nested := AppendAttribute(nil, 2, []byte{1, 2})
+	b := AppendAttribute(nil, 1|NlaFNetByteorder, []byte("abcde"))
+	b = AppendNested(b, 3, nested)
+	if len(b)%4 != 0 {
+		t.Errorf("Not padded: %d\n", len(b))
+	}
+	attrs, err := ParseAttributes(b)
+	if err != nil {
+		t.Fatalf("ParseAttributes failed: %s\n", err)
+	}
+	if len(attrs) != 2 {
+		t.Fatalf("Expected 2 attributes got %d\n", len(attrs))
+	}
+	if attrs[0].Type != 1 || attrs[0].Nested ||
+		string(attrs[0].Value) != "abcde" {
+		t.Errorf("Unexpected attribute %+v\n", attrs[0])
+	}
+	if attrs[1].Type != 3 || !attrs[1].Nested ||
+		!bytes.Equal(attrs[1].Value, nested) {
+		t.Errorf("Unexpected attribute %+v\n", attrs[1])
+	}
+	inner, err := ParseAttributes(attrs[1].Value)
+	if err != nil || len(inner) != 1 || inner[0].Type != 2 ||
+		!bytes.Equal(inner[0].Value, []byte{1, 2}) {
+		t.Errorf("Unexpected nested attributes %+v, %v\n", inner, err)
+	}
+
+	// Claim that the first attribute is longer than the message
+	NativeEndian.PutUint16(b[0:2], uint16(len(b)+4))
+	if _, err := ParseAttributes(b); err == nil {
+		t.Errorf("No error for bad length\n")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	attrs := AppendAttribute(nil, 1, []byte{1})
+	b := NewRequest(4, 1, syscall.NLM_F_ACK, 7, syscall.AF_INET, 0x102, attrs)
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ParseNetlinkMessage: %v, %v\n", msgs, err)
+	}
+	h := msgs[0].Header
+	if h.Type != 4<<8|1 || h.Seq != 7 ||
+		h.Flags != syscall.NLM_F_REQUEST|syscall.NLM_F_ACK {
+		t.Errorf("Unexpected header %+v\n", h)
+	}
+	expected := append([]byte{syscall.AF_INET, NfnetlinkV0, 1, 2}, attrs...)
+	if !bytes.Equal(msgs[0].Data, expected) {
+		t.Errorf("Expected %v got %v\n", expected, msgs[0].Data)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	data := make([]byte, 4)
+	if err := ParseError(data); err != nil {
+		t.Errorf("Error for an ack: %s\n", err)
+	}
+	errno := -int32(syscall.ENOENT)
+	NativeEndian.PutUint32(data, uint32(errno))
+	if err := ParseError(data); err != syscall.ENOENT {
+		t.Errorf("Expected ENOENT got %v\n", err)
+	}
+	if err := ParseError(nil); err == nil {
+		t.Errorf("No error for truncated data\n")
+	}
+}
@@ -27,7 +27,7 @@ func writeMyPid(filename string) error {
 }
 
 func CheckAndCreatePidfile(agentName string) error {
-	filename := fmt.Sprintf("%s/%s.pid", rundir, agentName)
+	filename := Filename(agentName)
 	if _, err := os.Stat(filename); err != nil {
 		// Assume file does not exist; Create file
 		if err := writeMyPid(filename); err != nil {
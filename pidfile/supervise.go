@@ -0,0 +1,163 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Find, signal and wait for the agents using their pidfiles
+
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How often WaitForExit checks
+const waitInterval = 100 * time.Millisecond
+
+// Filename returns the pidfile for the agent
+func Filename(agentName string) string {
+	return pidfileName(rundir, agentName)
+}
+
+func pidfileName(dirname string, agentName string) string {
+	return fmt.Sprintf("%s/%s.pid", dirname, agentName)
+}
+
+// ReadPid returns the pid from the agent's pidfile
+func ReadPid(agentName string) (int, error) {
+	return readPid(pidfileName(rundir, agentName))
+}
+
+func readPid(filename string) (int, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		errStr := fmt.Sprintf("bad pid in %s: %s", filename, err)
+		return 0, errors.New(errStr)
+	}
+	if pid <= 0 {
+		errStr := fmt.Sprintf("bad pid %d in %s", pid, filename)
+		return 0, errors.New(errStr)
+	}
+	return pid, nil
+}
+
+// pidRunning checks whether the process exists. EPERM means it exists but
+// is not ours.
+func pidRunning(pid int) bool {
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// IsRunning returns true if the agent's pidfile names a running process
+func IsRunning(agentName string) bool {
+	pid, err := ReadPid(agentName)
+	if err != nil {
+		return false
+	}
+	return pidRunning(pid)
+}
+
+// ListRunning returns the names of the agents, or other daemons, which
+// have a pidfile for a running process. Sorted by name.
+func ListRunning() ([]string, error) {
+	running, err := listRunning(rundir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func listRunning(dirname string) (map[string]int, error) {
+	filenames, err := filepath.Glob(pidfileName(dirname, "*"))
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]int)
+	for _, filename := range filenames {
+		pid, err := readPid(filename)
+		if err != nil {
+			log.Debugf("listRunning: %s\n", err)
+			continue
+		}
+		if !pidRunning(pid) {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(filename), ".pid")
+		running[name] = pid
+	}
+	return running, nil
+}
+
+// SignalAgent sends the signal to the agent's process
+func SignalAgent(agentName string, sig syscall.Signal) error {
+	pid, err := ReadPid(agentName)
+	if err != nil {
+		return err
+	}
+	log.Infof("SignalAgent(%s) pid %d signal %s\n", agentName, pid, sig)
+	if err := syscall.Kill(pid, sig); err != nil {
+		errStr := fmt.Sprintf("SignalAgent(%s) pid %d: %s",
+			agentName, pid, err)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// WaitForExit waits until the process in the agent's pidfile is gone.
+// Returns immediately if there is no pidfile.
+func WaitForExit(agentName string, timeout time.Duration) error {
+	pid, err := ReadPid(agentName)
+	if err != nil {
+		return nil
+	}
+	return waitForPid(pid, timeout)
+}
+
+func waitForPid(pid int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for pidRunning(pid) {
+		if time.Now().After(deadline) {
+			errStr := fmt.Sprintf("pid %d still running after %v",
+				pid, timeout)
+			return errors.New(errStr)
+		}
+		time.Sleep(waitInterval)
+	}
+	return nil
+}
+
+// StopAgent sends SIGTERM and waits for the agent to exit; if it does
+// not exit within timeout it is sent SIGKILL
+func StopAgent(agentName string, timeout time.Duration) error {
+	if !IsRunning(agentName) {
+		return nil
+	}
+	if err := SignalAgent(agentName, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if err := WaitForExit(agentName, timeout); err == nil {
+		return nil
+	}
+	log.Warnf("StopAgent(%s) did not exit; killing\n", agentName)
+	if err := SignalAgent(agentName, syscall.SIGKILL); err != nil {
+		return err
+	}
+	return WaitForExit(agentName, timeout)
+}
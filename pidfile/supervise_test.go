@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package pidfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestListRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A child which has exited gives us a pid which is not running
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"running": fmt.Sprintf("%d\n", os.Getpid()),
+		"exited":  fmt.Sprintf("%d", cmd.Process.Pid),
+		"garbage": "abc",
+		"zero":    "0",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(pidfileName(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	running, err := listRunning(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || running["running"] != os.Getpid() {
+		t.Errorf("got %v", running)
+	}
+}
+
+func TestWaitForPid(t *testing.T) {
+	cmd := exec.Command("sleep", "0.2")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go cmd.Wait()
+	if err := waitForPid(cmd.Process.Pid, 10*time.Millisecond); err == nil {
+		t.Errorf("no timeout for running pid")
+	}
+	if err := waitForPid(cmd.Process.Pid, 5*time.Second); err != nil {
+		t.Errorf("waitForPid: %s", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2018 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// In-process pubsub for unit testing agent logic without /var/run,
+// sockets, or file watching.
+// The changes are queued on sub.C synchronously by Publish/Unpublish
+// hence a test can call ProcessPending right after a Publish.
+// Publish does not block when the queue is full; the change is dropped
+// and counted, and the next ProcessPending resynchronizes the
+// subscription with the publication.
+//
+// Usage:
+//  p1, err := pubsub.PublishInMemory("foo", fooStruct{})
+//  s1, err := pubsub.SubscribeInMemory("foo", fooStruct{}, true, &myctx)
+//  s1.ModifyHandler = func(...)
+//  p1.Publish(key, item)
+//  s1.ProcessPending()
+
+package pubsub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Maximum number of changes queued for an in-memory subscriber which
+// has not called ProcessChange/ProcessPending
+const inMemoryQueueLen = 1024
+
+// Changes dropped since the queue was full. Protected by broker.lock
+type memDrops struct {
+	count  uint64 // Total
+	resync bool   // Until ProcessPending resynchronizes
+}
+
+type memTopic struct {
+	pub  *Publication
+	subs []*Subscription
+}
+
+type memBroker struct {
+	lock   sync.Mutex
+	topics map[string]*memTopic
+}
+
+var broker = memBroker{topics: make(map[string]*memTopic)}
+
+func (b *memBroker) lookup(name string) *memTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memTopic{}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// PublishInMemory returns a Publication which only delivers to
+// subscriptions created by SubscribeInMemory in the same process.
+func PublishInMemory(agentName string, topicType interface{}) (*Publication, error) {
+	pub := new(Publication)
+	pub.topicType = topicType
+	pub.agentName = agentName
+	pub.topic = TypeToName(topicType)
+	pub.km = keyMap{key: NewLockedStringMap()}
+	pub.inMemory = true
+	name := pub.nameString()
+	log.Infof("PublishInMemory(%s)\n", name)
+
+	broker.lock.Lock()
+	t := broker.lookup(name)
+	if t.pub != nil {
+		log.Warnf("PublishInMemory(%s) replacing previous publication\n",
+			name)
+	}
+	t.pub = pub
+	for _, sub := range t.subs {
+		sub.memSendInitial(pub)
+	}
+	broker.lock.Unlock()
+	return pub, nil
+}
+
+// SubscribeInMemory returns a Subscription fed by PublishInMemory.
+func SubscribeInMemory(agentName string, topicType interface{}, activate bool,
+	ctx interface{}) (*Subscription, error) {
+
+	changes := make(chan string, inMemoryQueueLen)
+	sub := new(Subscription)
+	sub.C = changes
+	sub.sendChan = changes
+	sub.topicType = topicType
+	sub.agentName = agentName
+	sub.topic = TypeToName(topicType)
+	sub.userCtx = ctx
+	sub.km = keyMap{key: NewLockedStringMap()}
+	sub.inMemory = true
+	log.Infof("SubscribeInMemory(%s)\n", sub.nameString())
+	if activate {
+		if err := sub.Activate(); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// Register with the broker and queue the current content of the
+// publication, if any.
+func (sub *Subscription) memActivate() {
+	name := sub.nameString()
+	broker.lock.Lock()
+	t := broker.lookup(name)
+	t.subs = append(t.subs, sub)
+	if t.pub != nil {
+		sub.memSendInitial(t.pub)
+	}
+	broker.lock.Unlock()
+}
+
+// ProcessPending calls ProcessChange for all the queued changes and
+// returns the number processed. Only useful for in-memory subscriptions
+// since the socket and directory ones are fed asynchronously.
+func (sub *Subscription) ProcessPending() int {
+	count := 0
+	for {
+		select {
+		case change := <-sub.C:
+			sub.ProcessChange(change)
+			count++
+		default:
+			resync := sub.memResync()
+			if len(resync) == 0 {
+				return count
+			}
+			for _, change := range resync {
+				sub.ProcessChange(change)
+				count++
+			}
+		}
+	}
+}
+
+// MemDropped returns the number of changes dropped since the queue of the
+// in-memory subscription was full
+func (sub *Subscription) MemDropped() uint64 {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	return sub.memDrops.count
+}
+
+// After changes were dropped, returns the changes which bring the
+// subscription in sync with the publication. They are not queued since
+// they might not fit.
+func (sub *Subscription) memResync() []string {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	if !sub.memDrops.resync {
+		return nil
+	}
+	sub.memDrops.resync = false
+	t := broker.lookup(sub.nameString())
+	if t.pub == nil {
+		return nil
+	}
+	log.Warnf("memResync(%s) after %d dropped changes\n",
+		sub.nameString(), sub.memDrops.count)
+	var changes []string
+	items := t.pub.GetAll()
+	for key := range sub.GetAll() {
+		if _, ok := items[key]; !ok {
+			changes = append(changes, memDelete(key))
+		}
+	}
+	for key, val := range items {
+		changes = append(changes, memUpdate(key, val))
+	}
+	if !sub.synchronized {
+		changes = append(changes, "C done")
+	}
+	if t.pub.km.restarted && !sub.km.restarted {
+		changes = append(changes, "R done")
+	}
+	return changes
+}
+
+// Caller holds broker.lock
+func (sub *Subscription) memSendInitial(pub *Publication) {
+	for key, val := range pub.GetAll() {
+		sub.memSend(memUpdate(key, val))
+	}
+	sub.memSend("C done")
+	if pub.km.restarted {
+		sub.memSend("R done")
+	}
+}
+
+// Caller holds broker.lock
+func (sub *Subscription) memSend(change string) {
+	select {
+	case sub.sendChan <- change:
+	default:
+		if !sub.memDrops.resync {
+			log.Errorf("memSend(%s): queue full; missing ProcessPending?\n",
+				sub.nameString())
+		}
+		sub.memDrops.count++
+		sub.memDrops.resync = true
+	}
+}
+
+// Uses the same format as watchSock so ProcessChange can be shared
+func memUpdate(key string, val interface{}) string {
+	b, err := json.Marshal(val)
+	if err != nil {
+		log.Fatal("json Marshal in memUpdate", err)
+	}
+	return "M " + base64.StdEncoding.EncodeToString([]byte(key)) + " " +
+		base64.StdEncoding.EncodeToString(b)
+}
+
+func memDelete(key string) string {
+	return "D " + base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// Deliver a change to all the in-memory subscribers of the publication
+func (pub *Publication) memNotify(change string) {
+	broker.lock.Lock()
+	t := broker.lookup(pub.nameString())
+	if t.pub == pub {
+		for _, sub := range t.subs {
+			sub.memSend(change)
+		}
+	}
+	broker.lock.Unlock()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type memTestItem struct {
+	Name  string
+	Count int
+}
+
+type memTestCtx struct {
+	modified     map[string]int
+	deleted      []string
+	synchronized bool
+	restarted    bool
+}
+
+func TestInMemory(t *testing.T) {
+	log.Infof("TestInMemory: START\n")
+
+	ctx := memTestCtx{modified: make(map[string]int)}
+	pub, err := PublishInMemory("memtest", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	// Published before the subscriber exists
+	pub.Publish("a", memTestItem{Name: "a", Count: 1})
+
+	sub, err := SubscribeInMemory("memtest", memTestItem{}, false, &ctx)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	sub.ModifyHandler = func(ctxArg interface{}, key string, val interface{}) {
+		c := ctxArg.(*memTestCtx)
+		c.modified[key]++
+	}
+	sub.DeleteHandler = func(ctxArg interface{}, key string, val interface{}) {
+		c := ctxArg.(*memTestCtx)
+		c.deleted = append(c.deleted, key)
+	}
+	sub.SynchronizedHandler = func(ctxArg interface{}, done bool) {
+		ctxArg.(*memTestCtx).synchronized = done
+	}
+	sub.RestartHandler = func(ctxArg interface{}, done bool) {
+		ctxArg.(*memTestCtx).restarted = done
+	}
+	sub.Activate()
+	if count := sub.ProcessPending(); count != 2 {
+		t.Errorf("Expected 2 initial changes, got %d\n", count)
+	}
+	if !ctx.synchronized || ctx.modified["a"] != 1 {
+		t.Errorf("Initial state not delivered: %+v\n", ctx)
+	}
+
+	pub.Publish("b", memTestItem{Name: "b", Count: 2})
+	// Unchanged hence no notification
+	pub.Publish("a", memTestItem{Name: "a", Count: 1})
+	pub.Unpublish("a")
+	pub.SignalRestarted()
+	if count := sub.ProcessPending(); count != 3 {
+		t.Errorf("Expected 3 changes, got %d\n", count)
+	}
+	if ctx.modified["b"] != 1 || ctx.modified["a"] != 1 {
+		t.Errorf("Unexpected modify counts: %v\n", ctx.modified)
+	}
+	if len(ctx.deleted) != 1 || ctx.deleted[0] != "a" {
+		t.Errorf("Unexpected deletes: %v\n", ctx.deleted)
+	}
+	if !ctx.restarted || !sub.Restarted() {
+		t.Errorf("Restarted not delivered\n")
+	}
+	if _, err := sub.Get("a"); err == nil {
+		t.Errorf("Deleted key still present\n")
+	}
+	if _, err := sub.Get("b"); err != nil {
+		t.Errorf("Get failed: %s\n", err)
+	}
+	log.Infof("TestInMemory: DONE\n")
+}
+
+type initialStateCtx struct {
+	calls    int
+	count    int
+	timedOut bool
+}
+
+func handleInitialStateTest(ctxArg interface{}, count int, timedOut bool) {
+	c := ctxArg.(*initialStateCtx)
+	c.calls++
+	c.count = count
+	c.timedOut = timedOut
+}
+
+func TestInitialState(t *testing.T) {
+	pub, err := PublishInMemory("initialtest", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pub.Publish("a", memTestItem{Name: "a", Count: 1})
+	pub.Publish("b", memTestItem{Name: "b", Count: 2})
+
+	ctx := initialStateCtx{}
+	sub, err := SubscribeInMemory("initialtest", memTestItem{}, false, &ctx)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	sub.InitialStateHandler = handleInitialStateTest
+	sub.InitialStateTimeout = 10 * time.Millisecond
+	sub.Activate()
+	sub.ProcessPending()
+	if ctx.calls != 1 || ctx.count != 2 || ctx.timedOut {
+		t.Errorf("Unexpected initial state: %+v\n", ctx)
+	}
+	// The stopped timer does not report again
+	time.Sleep(50 * time.Millisecond)
+	pub.Publish("c", memTestItem{Name: "c", Count: 3})
+	sub.ProcessPending()
+	if ctx.calls != 1 || !sub.InitialStateDone() {
+		t.Errorf("Initial state reported again: %+v\n", ctx)
+	}
+
+	// No publisher hence the timeout
+	ctx2 := initialStateCtx{}
+	sub2, err := SubscribeInMemory("initialtest2", memTestItem{}, false,
+		&ctx2)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	sub2.InitialStateHandler = handleInitialStateTest
+	sub2.InitialStateTimeout = 10 * time.Millisecond
+	sub2.Activate()
+	if sub2.ProcessPending() != 0 || sub2.InitialStateDone() {
+		t.Errorf("Initial state before timeout: %+v\n", ctx2)
+	}
+	time.Sleep(50 * time.Millisecond)
+	sub2.ProcessPending()
+	if ctx2.calls != 1 || ctx2.count != 0 || !ctx2.timedOut {
+		t.Errorf("Unexpected timeout: %+v\n", ctx2)
+	}
+}
+
+func TestObjectEventHook(t *testing.T) {
+	var events []string
+	var hashes []string
+	ObjectEventHook = func(op string, objType string, key string,
+		oldHash string, newHash string) {
+		events = append(events, op+" "+objType+" "+key)
+		hashes = append(hashes, oldHash, newHash)
+	}
+	defer func() { ObjectEventHook = nil }()
+
+	pub, err := PublishInMemory("eventtest", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pub.Publish("a", memTestItem{Name: "a", Count: 1})
+	pub.Publish("a", memTestItem{Name: "a", Count: 1})
+	pub.Publish("a", memTestItem{Name: "a", Count: 2})
+	pub.Unpublish("a")
+	expected := []string{
+		"publish eventtest/memTestItem a",
+		"modify eventtest/memTestItem a",
+		"delete eventtest/memTestItem a",
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %v, got %v\n", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected %s, got %s\n", expected[i], events[i])
+		}
+	}
+	// publish: "", h1; modify: h1, h2; delete: h2, ""
+	if hashes[0] != "" || hashes[1] == "" || hashes[2] != hashes[1] ||
+		hashes[3] == hashes[2] || hashes[4] != hashes[3] ||
+		hashes[5] != "" {
+		t.Errorf("Unexpected hashes %v\n", hashes)
+	}
+}
+
+func TestInMemoryQueueFull(t *testing.T) {
+	ctx := memTestCtx{modified: make(map[string]int)}
+	pub, err := PublishInMemory("fulltest", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInMemory failed: %s\n", err)
+	}
+	pub.Publish("gone", memTestItem{Name: "gone"})
+	sub, err := SubscribeInMemory("fulltest", memTestItem{}, true, &ctx)
+	if err != nil {
+		t.Fatalf("SubscribeInMemory failed: %s\n", err)
+	}
+	sub.DeleteHandler = func(ctxArg interface{}, key string, val interface{}) {
+		c := ctxArg.(*memTestCtx)
+		c.deleted = append(c.deleted, key)
+	}
+	sub.ProcessPending()
+
+	// Overflow the queue without processing
+	for i := 0; i < inMemoryQueueLen+10; i++ {
+		pub.Publish(fmt.Sprintf("k%d", i), memTestItem{Count: i})
+	}
+	pub.Unpublish("gone")
+	if sub.MemDropped() == 0 {
+		t.Fatalf("Nothing dropped\n")
+	}
+	sub.ProcessPending()
+	items := sub.GetAll()
+	if len(items) != inMemoryQueueLen+10 {
+		t.Errorf("Expected %d items after resync, got %d\n",
+			inMemoryQueueLen+10, len(items))
+	}
+	if _, err := sub.Get("gone"); err == nil {
+		t.Errorf("Deleted key still present after resync\n")
+	}
+	if len(ctx.deleted) != 1 || ctx.deleted[0] != "gone" {
+		t.Errorf("Unexpected deletes: %v\n", ctx.deleted)
+	}
+
+	// Back to normal
+	dropped := sub.MemDropped()
+	pub.Publish("k0", memTestItem{Count: 100})
+	if count := sub.ProcessPending(); count != 1 {
+		t.Errorf("Expected 1 change, got %d\n", count)
+	}
+	if sub.MemDropped() != dropped {
+		t.Errorf("Dropped %d after resync\n", sub.MemDropped()-dropped)
+	}
+}
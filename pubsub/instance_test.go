@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package pubsub
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Use a temporary directory for the sockets and checkpoints
+func setTestRunDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "pubsubtest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	saved := runDir
+	runDir = dir
+	return func() {
+		runDir = saved
+		os.RemoveAll(dir)
+	}
+}
+
+// Process changes until cond is true or we time out
+func waitForSub(t *testing.T, sub *Subscription, what string,
+	cond func() bool) {
+
+	timer := time.NewTimer(10 * time.Second)
+	defer timer.Stop()
+	for !cond() {
+		select {
+		case change := <-sub.C:
+			sub.ProcessChange(change)
+		case <-timer.C:
+			t.Fatalf("Timed out waiting for %s; have %v\n",
+				what, sub.GetAll())
+		}
+	}
+}
+
+func hasKeys(sub *Subscription, keys ...string) func() bool {
+	return func() bool {
+		items := sub.GetAll()
+		if len(items) != len(keys) {
+			return false
+		}
+		for _, key := range keys {
+			if _, ok := items[key]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestInstanceNames(t *testing.T) {
+	for _, instance := range []string{"", WildcardInstance, "a/b"} {
+		if _, err := PublishInstance("insttest", instance,
+			memTestItem{}); err == nil {
+			t.Errorf("PublishInstance accepted <%s>\n", instance)
+		}
+	}
+	for _, instance := range []string{"", "a/b"} {
+		if _, err := SubscribeInstance("insttest", instance,
+			memTestItem{}, false, nil); err == nil {
+			t.Errorf("SubscribeInstance accepted <%s>\n", instance)
+		}
+	}
+	if _, err := SubscribeInstance("", WildcardInstance,
+		memTestItem{}, false, nil); err == nil {
+		t.Errorf("SubscribeInstance accepted empty agentName\n")
+	}
+}
+
+func TestInstanceAddRemove(t *testing.T) {
+	defer setTestRunDir(t)()
+
+	wildcard, err := SubscribeInstance("insttest", WildcardInstance,
+		memTestItem{}, true, nil)
+	if err != nil {
+		t.Fatalf("SubscribeInstance failed: %s\n", err)
+	}
+	pub1, err := PublishInstance("insttest", "one", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInstance failed: %s\n", err)
+	}
+	pub1.Publish("a", memTestItem{Name: "a", Count: 1})
+	waitForSub(t, wildcard, "instance one", hasKeys(wildcard, "a"))
+
+	pub2, err := PublishInstance("insttest", "two", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInstance failed: %s\n", err)
+	}
+	defer pub2.Close()
+	pub2.Publish("b", memTestItem{Name: "b", Count: 2})
+	pub2.Publish("c", memTestItem{Name: "c", Count: 3})
+	waitForSub(t, wildcard, "instance two",
+		hasKeys(wildcard, "a", "b", "c"))
+
+	// A single instance only sees its own keys
+	single, err := SubscribeInstance("insttest", "two", memTestItem{},
+		true, nil)
+	if err != nil {
+		t.Fatalf("SubscribeInstance failed: %s\n", err)
+	}
+	waitForSub(t, single, "single instance", hasKeys(single, "b", "c"))
+
+	// Removing an instance deletes its keys
+	pub1.Close()
+	waitForSub(t, wildcard, "instance one removal",
+		hasKeys(wildcard, "b", "c"))
+	pub2.Unpublish("c")
+	waitForSub(t, wildcard, "unpublish", hasKeys(wildcard, "b"))
+
+	// And it can come back
+	pub1, err = PublishInstance("insttest", "one", memTestItem{})
+	if err != nil {
+		t.Fatalf("PublishInstance failed: %s\n", err)
+	}
+	defer pub1.Close()
+	pub1.Publish("d", memTestItem{Name: "d", Count: 4})
+	// The checkpointed "a" is published again
+	waitForSub(t, wildcard, "instance one again",
+		hasKeys(wildcard, "a", "b", "d"))
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Single writer per topic. The Publish* constructor takes an exclusive
+// flock on a file next to the socket and holds it until Close or exit,
+// hence the kernel releases it when the agent dies and there is no PID
+// to go stale. A second writer is fatal, or only logged if
+// WarnOnlyOwnership is set. The file records the agent and PID which
+// holds the lock so that the conflict can be reported.
+
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WarnOnlyOwnership makes a second writer log a warning instead of
+// being fatal. Set before calling Publish*.
+var WarnOnlyOwnership = false
+
+// The owner of a topic
+type topicOwner struct {
+	AgentName string
+	Pid       int
+	Time      time.Time
+}
+
+func ownerFileName(sockName string) string {
+	return strings.TrimSuffix(sockName, ".sock") + ".owner"
+}
+
+// claimOwner is called once from the Publish* constructor
+func (pub *Publication) claimOwner(ownerFile string) {
+	f, owner, err := lockOwner(ownerFile, pub.agentName)
+	if err != nil {
+		// Can not enforce but do not fail the publish
+		log.Errorf("claimOwner(%s) failed: %s\n", pub.nameString(), err)
+		return
+	}
+	if owner != nil {
+		errStr := fmt.Sprintf("claimOwner(%s) owned by %s pid %d since %s; second writer %s pid %d",
+			pub.nameString(), owner.AgentName, owner.Pid,
+			owner.Time.Format(time.RFC3339), pub.agentName, os.Getpid())
+		if !WarnOnlyOwnership {
+			log.Fatal(errStr)
+		}
+		log.Warnln(errStr)
+		return
+	}
+	pub.ownerLock = f
+}
+
+// releaseOwner lets another publisher take over. We leave the file in
+// place since a process waiting to lock it would otherwise lock an
+// unlinked file.
+func (pub *Publication) releaseOwner() {
+	if pub.ownerLock == nil {
+		return
+	}
+	pub.ownerLock.Close()
+	pub.ownerLock = nil
+}
+
+// lockOwner takes the lock and records us as the owner. If another open
+// file holds the lock, which might be in this process, the recorded
+// owner is returned.
+func lockOwner(fileName string, agentName string) (*os.File, *topicOwner, error) {
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		owner, err := readOwner(fileName)
+		if err != nil {
+			// Locked but not yet written
+			owner = topicOwner{AgentName: "unknown"}
+		}
+		return nil, &owner, nil
+	} else if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	owner := topicOwner{
+		AgentName: agentName,
+		Pid:       os.Getpid(),
+		Time:      time.Now(),
+	}
+	log.Infof("lockOwner(%s) by %s pid %d\n", fileName,
+		owner.AgentName, owner.Pid)
+	b, err := json.Marshal(owner)
+	if err != nil {
+		log.Fatal("json Marshal in lockOwner", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, nil, nil
+}
+
+func readOwner(fileName string) (topicOwner, error) {
+	var owner topicOwner
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return owner, err
+	}
+	err = json.Unmarshal(b, &owner)
+	return owner, err
+}
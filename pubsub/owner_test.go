@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package pubsub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func writeTestOwner(t *testing.T, fileName string, pid int) {
+	b, _ := json.Marshal(topicOwner{AgentName: "other", Pid: pid,
+		Time: time.Now()})
+	if err := ioutil.WriteFile(fileName, b, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+}
+
+func TestLockOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ownertest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := dir + "/topic.owner"
+
+	// No owner yet
+	f, owner, err := lockOwner(fileName, "test")
+	if err != nil || owner != nil || f == nil {
+		t.Fatalf("Not locked: %v %+v\n", err, owner)
+	}
+	recorded, err := readOwner(fileName)
+	if err != nil || recorded.Pid != os.Getpid() ||
+		recorded.AgentName != "test" {
+		t.Errorf("Not recorded: %+v %v\n", recorded, err)
+	}
+
+	// A second writer, even in the same process, is refused
+	f2, owner, err := lockOwner(fileName, "second")
+	if err != nil || f2 != nil || owner == nil ||
+		owner.Pid != os.Getpid() || owner.AgentName != "test" {
+		t.Errorf("Second writer got %v %+v %v\n", f2, owner, err)
+	}
+
+	// Released when the owner closes or exits, whatever the file says
+	f.Close()
+	writeTestOwner(t, fileName, 1)
+	f, owner, err = lockOwner(fileName, "second")
+	if err != nil || owner != nil || f == nil {
+		t.Fatalf("Not taken over: %v %+v\n", err, owner)
+	}
+	defer f.Close()
+	recorded, err = readOwner(fileName)
+	if err != nil || recorded.AgentName != "second" {
+		t.Errorf("Not recorded: %+v %v\n", recorded, err)
+	}
+}
+
+func TestClaimOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ownertest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := dir + "/topic.owner"
+
+	pub := &Publication{agentName: "test", topic: "topic"}
+	pub.claimOwner(fileName)
+	if pub.ownerLock == nil {
+		t.Fatalf("Not claimed\n")
+	}
+
+	// A second writer is fatal unless WarnOnlyOwnership
+	WarnOnlyOwnership = true
+	defer func() { WarnOnlyOwnership = false }()
+	pub2 := &Publication{agentName: "test2", topic: "topic"}
+	pub2.claimOwner(fileName)
+	if pub2.ownerLock != nil {
+		t.Errorf("Second writer got the lock\n")
+	}
+
+	pub.releaseOwner()
+	pub2.claimOwner(fileName)
+	if pub2.ownerLock == nil {
+		t.Errorf("Not claimed after release\n")
+	}
+	pub2.releaseOwner()
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package pubsub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The initial state of a persistent subscription is reported once the
+// saved objects have been read, or right away if nothing was saved
+func TestInitialStatePersistent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsubpersist")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	saved := persistDir
+	persistDir = dir
+	defer func() {
+		persistDir = saved
+		os.RemoveAll(dir)
+	}()
+
+	// Saved objects
+	ctx := initialStateCtx{}
+	sub, err := SubscribePersistent("persisttest", memTestItem{}, false,
+		&ctx)
+	if err != nil {
+		t.Fatalf("SubscribePersistent failed: %s\n", err)
+	}
+	if err := os.MkdirAll(sub.dirName, 0700); err != nil {
+		t.Fatalf("MkdirAll failed: %s\n", err)
+	}
+	for _, item := range []memTestItem{{"a", 1}, {"b", 2}} {
+		b, _ := json.Marshal(item)
+		filename := filepath.Join(sub.dirName, item.Name+".json")
+		if err := ioutil.WriteFile(filename, b, 0600); err != nil {
+			t.Fatalf("WriteFile failed: %s\n", err)
+		}
+	}
+	sub.InitialStateHandler = handleInitialStateTest
+	sub.InitialStateTimeout = 5 * time.Second
+	if err := sub.Activate(); err != nil {
+		t.Fatalf("Activate failed: %s\n", err)
+	}
+	waitForSub(t, sub, "initial state", sub.InitialStateDone)
+	if ctx.calls != 1 || ctx.count != 2 || ctx.timedOut {
+		t.Errorf("Unexpected initial state: %+v\n", ctx)
+	}
+
+	// Nothing saved
+	ctx2 := initialStateCtx{}
+	sub2, err := SubscribePersistent("persisttest2", memTestItem{}, false,
+		&ctx2)
+	if err != nil {
+		t.Fatalf("SubscribePersistent failed: %s\n", err)
+	}
+	sub2.InitialStateHandler = handleInitialStateTest
+	sub2.InitialStateTimeout = 5 * time.Second
+	if err := sub2.Activate(); err != nil {
+		t.Fatalf("Activate failed: %s\n", err)
+	}
+	waitForSub(t, sub2, "no initial state", sub2.InitialStateDone)
+	if ctx2.calls != 1 || ctx2.count != 0 || ctx2.timedOut {
+		t.Errorf("Unexpected initial state: %+v\n", ctx2)
+	}
+}
+
+// A failed Activate does not leave a timer behind
+func TestInitialStateActivateFails(t *testing.T) {
+	ctx := initialStateCtx{}
+	sub, err := SubscribePersistent("persisttest3", memTestItem{}, false,
+		&ctx)
+	if err != nil {
+		t.Fatalf("SubscribePersistent failed: %s\n", err)
+	}
+	// A wildcard requires a socket
+	sub.instance = WildcardInstance
+	sub.InitialStateHandler = handleInitialStateTest
+	sub.InitialStateTimeout = time.Millisecond
+	if err := sub.Activate(); err == nil {
+		t.Fatalf("Activate succeeded\n")
+	}
+	if sub.initialTimer != nil {
+		t.Errorf("Timer started by the failed Activate\n")
+	}
+}
@@ -7,10 +7,13 @@
 package pubsub
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/google/go-cmp/cmp"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/watch"
@@ -40,6 +43,11 @@ import (
 //	"delete" topic key
 //	"complete" topic (aka synchronized)
 //	"restarted" topic
+//
+// Topic names are hierarchical; agentName/topic, agentName/scope/topic,
+// or agentName/topic/instance when a publisher has one collection per
+// instance (e.g., per network instance.) A subscriber can use
+// WildcardInstance to receive the items from all instances of a topic.
 
 // Maintain a collection which is used to handle the restart of a subscriber
 // map of agentname, key to get a json string
@@ -62,6 +70,14 @@ const subscribeFromSock = true // XXX
 const fixedName = "zededa"
 const fixedDir = "/var/tmp/" + fixedName
 
+// Where the sockets and the non-persistent checkpoints live. A variable
+// so that the tests can use a temporary directory.
+var runDir = "/var/run"
+
+// WildcardInstance as the instance in SubscribeInstance subscribes to
+// all current and future instances of the topic.
+const WildcardInstance = "*"
+
 type notify struct{}
 
 // The set of channels to which we need to send notifications
@@ -87,7 +103,7 @@ func updatersAdd(updater chan notify, name string, instance int) {
 
 func updatersRemove(updater chan notify) {
 	updaterList.lock.Lock()
-	servers := make([]notifyName, len(updaterList.servers))
+	servers := make([]notifyName, 0, len(updaterList.servers))
 	found := false
 	for _, old := range updaterList.servers {
 		if old.ch == updater {
@@ -141,6 +157,7 @@ type Publication struct {
 	agentName  string
 	agentScope string
 	topic      string
+	instance   string
 	km         keyMap
 	sockName   string
 	listener   net.Listener
@@ -148,24 +165,42 @@ type Publication struct {
 	publishToDir bool // Handle special case of file only info
 	dirName      string
 	persistent   bool
+	inMemory     bool // From PublishInMemory
+
+	ownerLock *os.File // Held while we own the topic; see owner.go
+	closed    chan struct{}
+
+	objectHashes sync.Map // By key; only kept when ObjectEventHook is set
 }
 
 func Publish(agentName string, topicType interface{}) (*Publication, error) {
-	return publishImpl(agentName, "", topicType, false)
+	return publishImpl(agentName, "", "", topicType, false)
 }
 
 func PublishPersistent(agentName string, topicType interface{}) (*Publication, error) {
-	return publishImpl(agentName, "", topicType, true)
+	return publishImpl(agentName, "", "", topicType, true)
 }
 
 func PublishScope(agentName string, agentScope string, topicType interface{}) (*Publication, error) {
-	return publishImpl(agentName, agentScope, topicType, false)
+	return publishImpl(agentName, agentScope, "", topicType, false)
+}
+
+// PublishInstance publishes agentName/topic/instance so that subscribers
+// can pick a single instance or use WildcardInstance.
+func PublishInstance(agentName string, instance string, topicType interface{}) (*Publication, error) {
+	if instance == "" || instance == WildcardInstance ||
+		strings.Contains(instance, "/") {
+		errStr := fmt.Sprintf("PublishInstance(%s): invalid instance <%s>",
+			agentName, instance)
+		return nil, errors.New(errStr)
+	}
+	return publishImpl(agentName, "", instance, topicType, false)
 }
 
 // Init function to create directory and socket listener based on above settings
 // We read any checkpointed state from dirName and insert in pub.km as initial
 // values.
-func publishImpl(agentName string, agentScope string,
+func publishImpl(agentName string, agentScope string, instance string,
 	topicType interface{}, persistent bool) (*Publication, error) {
 
 	topic := TypeToName(topicType)
@@ -174,6 +209,7 @@ func publishImpl(agentName string, agentScope string,
 	pub.agentName = agentName
 	pub.agentScope = agentScope
 	pub.topic = topic
+	pub.instance = instance
 	pub.km = keyMap{key: NewLockedStringMap()}
 	pub.persistent = persistent
 	name := pub.nameString()
@@ -214,6 +250,7 @@ func publishImpl(agentName string, agentScope string,
 				return nil, errors.New(errStr)
 			}
 		}
+		pub.claimOwner(ownerFileName(sockName))
 		if _, err := os.Stat(sockName); err == nil {
 			if err := os.Remove(sockName); err != nil {
 				errStr := fmt.Sprintf("Publish(%s): %s",
@@ -221,14 +258,28 @@ func publishImpl(agentName string, agentScope string,
 				return nil, errors.New(errStr)
 			}
 		}
-		s, err := net.Listen("unixpacket", sockName)
+		// Listen before the socket appears under its name so that
+		// a subscriber watching for it can connect right away
+		tmpName := sockName + ".tmp"
+		os.Remove(tmpName)
+		s, err := net.Listen("unixpacket", tmpName)
 		if err != nil {
 			errStr := fmt.Sprintf("Publish(%s): failed %s",
 				name, err)
 			return nil, errors.New(errStr)
 		}
+		// Close would otherwise unlink tmpName, which might by then
+		// be used by a new publisher; Close removes sockName itself
+		s.(*net.UnixListener).SetUnlinkOnClose(false)
+		if err := os.Rename(tmpName, sockName); err != nil {
+			s.Close()
+			errStr := fmt.Sprintf("Publish(%s): failed %s",
+				name, err)
+			return nil, errors.New(errStr)
+		}
 		pub.sockName = sockName
 		pub.listener = s
+		pub.closed = make(chan struct{})
 		go pub.publisher()
 	}
 	return pub, nil
@@ -291,6 +342,12 @@ func (pub *Publication) publisher() {
 	for {
 		c, err := pub.listener.Accept()
 		if err != nil {
+			select {
+			case <-pub.closed:
+				log.Infof("publisher(%s) closed\n", name)
+				return
+			default:
+			}
 			log.Errorf("publisher(%s) failed %s\n", name, err)
 			continue
 		}
@@ -371,7 +428,13 @@ func (pub *Publication) serveConnection(s net.Conn, instance int) {
 		log.Debugf("serveConnection(%s/%d) waiting for notification\n",
 			name, instance)
 		startWait := time.Now()
-		<-updater
+		select {
+		case <-updater:
+		case <-pub.closed:
+			log.Infof("serveConnection(%s/%d) closed\n",
+				name, instance)
+			return
+		}
 		waitTime := time.Since(startWait)
 		log.Debugf("serveConnection(%s/%d) received notification waited %d seconds\n",
 			name, instance, waitTime/time.Second)
@@ -457,30 +520,44 @@ func TypeToName(something interface{}) string {
 }
 
 func SockName(name string) string {
-	return fmt.Sprintf("/var/run/%s.sock", name)
+	return fmt.Sprintf("%s/%s.sock", runDir, name)
 }
 
 func PubDirName(name string) string {
-	return fmt.Sprintf("/var/run/%s", name)
+	return fmt.Sprintf("%s/%s", runDir, name)
 }
 
 func FixedDirName(name string) string {
 	return fmt.Sprintf("%s/%s", fixedDir, name)
 }
 
+// Where the persistent checkpoints live. A variable for the tests.
+var persistDir = "/persist/status"
+
 func PersistentDirName(name string) string {
-	return fmt.Sprintf("/persist/status/%s", name)
+	return fmt.Sprintf("%s/%s", persistDir, name)
 }
 
 func (pub *Publication) nameString() string {
 	if pub.publishToDir {
 		return pub.dirName
-	} else if pub.agentScope == "" {
-		return fmt.Sprintf("%s/%s", pub.agentName, pub.topic)
-	} else {
-		return fmt.Sprintf("%s/%s/%s", pub.agentName, pub.agentScope,
-			pub.topic)
 	}
+	return topicName(pub.agentName, pub.agentScope, pub.topic, pub.instance)
+}
+
+// Form the hierarchical name agentName[/agentScope]/topic[/instance]
+func topicName(agentName string, agentScope string, topic string,
+	instance string) string {
+
+	name := agentName
+	if agentScope != "" {
+		name += "/" + agentScope
+	}
+	name += "/" + topic
+	if instance != "" {
+		name += "/" + instance
+	}
+	return name
 }
 
 // One shot create directory and publish one key in that directory
@@ -516,21 +593,28 @@ func (pub *Publication) Publish(key string, item interface{}) error {
 	}
 	// Perform a deepCopy so the Equal check will work
 	newItem := deepCopy(item)
-	if m, ok := pub.km.key.Load(key); ok {
+	m, ok := pub.km.key.Load(key)
+	if ok {
 		if cmp.Equal(m, newItem) {
 			log.Debugf("Publish(%s/%s) unchanged\n", name, key)
 			return nil
 		}
 		log.Debugf("Publish(%s/%s) replacing due to diff %s\n",
 			name, key, cmp.Diff(m, newItem))
+		pub.objectEvent("modify", key, m, newItem)
 	} else {
 		log.Debugf("Publish(%s/%s) adding %+v\n", name, key, newItem)
+		pub.objectEvent("publish", key, nil, newItem)
 	}
 	pub.km.key.Store(key, newItem)
 
 	if log.GetLevel() == log.DebugLevel {
 		pub.dump("after Publish")
 	}
+	if pub.inMemory {
+		pub.memNotify(memUpdate(key, newItem))
+		return nil
+	}
 	pub.updatersNotify(name)
 
 	fileName := pub.dirName + "/" + key + ".json"
@@ -590,6 +674,51 @@ func deepCopy(in interface{}) interface{} {
 	return output
 }
 
+// ObjectEventHook is called for each change to a publication with the
+// hashes of the old and new values. Set by agentlog for its audit trail
+// when enabled in GlobalConfig; nil otherwise so there is no cost.
+var ObjectEventHook func(op string, objType string, key string,
+	oldHash string, newHash string)
+
+// Only the new item is hashed; the hash of the old one is kept from when
+// it was published
+func (pub *Publication) objectEvent(op string, key string,
+	oldItem interface{}, newItem interface{}) {
+
+	hook := ObjectEventHook
+	if hook == nil {
+		pub.objectHashes.Delete(key)
+		return
+	}
+	oldHash := ""
+	if h, ok := pub.objectHashes.Load(key); ok {
+		oldHash = h.(string)
+	} else {
+		// Published before the hook was set
+		oldHash = objectHash(oldItem)
+	}
+	newHash := objectHash(newItem)
+	if newItem == nil {
+		pub.objectHashes.Delete(key)
+	} else {
+		pub.objectHashes.Store(key, newHash)
+	}
+	hook(op, pub.nameString(), key, oldHash, newHash)
+}
+
+// Short hash of the json encoding; empty for nil
+func objectHash(item interface{}) string {
+	if item == nil {
+		return ""
+	}
+	b, err := json.Marshal(item)
+	if err != nil {
+		log.Fatal("json Marshal in objectHash", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
 func (pub *Publication) Unpublish(key string) error {
 	name := pub.nameString()
 	if m, ok := pub.km.key.Load(key); ok {
@@ -600,10 +729,17 @@ func (pub *Publication) Unpublish(key string) error {
 		log.Errorf("%s\n", errStr)
 		return errors.New(errStr)
 	}
+	if m, ok := pub.km.key.Load(key); ok {
+		pub.objectEvent("delete", key, m, nil)
+	}
 	pub.km.key.Delete(key)
 	if log.GetLevel() == log.DebugLevel {
 		pub.dump("after Unpublish")
 	}
+	if pub.inMemory {
+		pub.memNotify(memDelete(key))
+		return nil
+	}
 	pub.updatersNotify(name)
 
 	fileName := pub.dirName + "/" + key + ".json"
@@ -638,6 +774,13 @@ func (pub *Publication) restartImpl(restarted bool) error {
 		return nil
 	}
 	pub.km.restarted = restarted
+	if pub.inMemory {
+		// Subscribers only see the transition to restarted
+		if restarted {
+			pub.memNotify("R done")
+		}
+		return nil
+	}
 	if restarted {
 		// XXX lock on restarted to make sure it gets noticed?
 		// Implicit in updaters lock??
@@ -768,13 +911,38 @@ func (pub *Publication) GetAll() map[string]interface{} {
 	return result
 }
 
+// Close stops serving the subscribers and removes the socket. Used when
+// an instance goes away; wildcard subscribers then see the keys of the
+// instance as deleted. The checkpoint directory is left in place.
+func (pub *Publication) Close() {
+	if pub.closed == nil {
+		return
+	}
+	select {
+	case <-pub.closed:
+		return
+	default:
+	}
+	name := pub.nameString()
+	log.Infof("Close(%s)\n", name)
+	close(pub.closed)
+	pub.listener.Close()
+	if err := os.Remove(pub.sockName); err != nil {
+		log.Errorf("Close(%s): %s\n", name, err)
+	}
+	pub.releaseOwner()
+}
+
 // Usage:
 //  s1 := pubsub.Subscribe("foo", fooStruct{}, true, &myctx)
 // Or
 //  s1 := pubsub.Subscribe("foo", fooStruct{}, false, &myctx)
 //  s1.ModifyHandler = func(...), // Optional
+//  s1.ModifyDiffHandler = func(...), // Optional; gets previous value
 //  s1.DeleteHandler = func(...), // Optional
 //  s1.RestartHandler = func(...), // Optional
+//  s1.InitialStateHandler = func(...), // Optional
+//  s1.InitialStateTimeout = 30 * time.Second // Optional
 //  [ Initialize myctx ]
 //  s1.Activate()
 //  ...
@@ -788,15 +956,30 @@ func (pub *Publication) GetAll() map[string]interface{} {
 //  fooAll := s1.GetAll()
 
 type SubModifyHandler func(ctx interface{}, key string, status interface{})
+
+// The oldStatus is nil when the key is new. Called after ModifyHandler
+// if both are set.
+type SubModifyDiffHandler func(ctx interface{}, key string, status interface{},
+	oldStatus interface{})
 type SubDeleteHandler func(ctx interface{}, key string, status interface{})
 type SubRestartHandler func(ctx interface{}, restarted bool)
 
+// Called once when the initial state has been received, with the number
+// of objects. For a persistent subscription that is when the objects
+// saved by the publisher have been read, or right away if the publisher
+// never saved any. If InitialStateTimeout is set and passes first it is
+// called with timedOut set and the objects received so far.
+type SubInitialStateHandler func(ctx interface{}, count int, timedOut bool)
+
 type Subscription struct {
 	C                   <-chan string
 	ModifyHandler       SubModifyHandler
+	ModifyDiffHandler   SubModifyDiffHandler
 	DeleteHandler       SubDeleteHandler
 	RestartHandler      SubRestartHandler
 	SynchronizedHandler SubRestartHandler
+	InitialStateHandler SubInitialStateHandler
+	InitialStateTimeout time.Duration // Zero means wait forever
 
 	// Private fields
 	sendChan   chan<- string
@@ -804,27 +987,22 @@ type Subscription struct {
 	agentName  string
 	agentScope string
 	topic      string
+	instance   string // Can be WildcardInstance
 	km         keyMap
 	userCtx    interface{}
-	sock       net.Conn // For socket subscriptions
 
 	synchronized     bool
-	subscribeFromDir bool // Handle special case of file only info
+	initialState     bool        // InitialStateHandler called
+	initialTimer     *time.Timer // For InitialStateTimeout
+	subscribeFromDir bool        // Handle special case of file only info
 	dirName          string
 	persistent       bool
+	inMemory         bool     // From SubscribeInMemory
+	memDrops         memDrops // When the in-memory queue was full
 }
 
 func (sub *Subscription) nameString() string {
-	agentName := sub.agentName
-	if agentName == "" {
-		agentName = fixedName
-	}
-	if sub.agentScope == "" {
-		return fmt.Sprintf("%s/%s", sub.agentName, sub.topic)
-	} else {
-		return fmt.Sprintf("%s/%s/%s", sub.agentName, sub.agentScope,
-			sub.topic)
-	}
+	return topicName(sub.agentName, sub.agentScope, sub.topic, sub.instance)
 }
 
 // Init function for Subscribe; returns a context.
@@ -835,24 +1013,44 @@ func (sub *Subscription) nameString() string {
 func Subscribe(agentName string, topicType interface{}, activate bool,
 	ctx interface{}) (*Subscription, error) {
 
-	return subscribeImpl(agentName, "", topicType, activate, ctx, false)
+	return subscribeImpl(agentName, "", "", topicType, activate, ctx,
+		false)
 }
 
 func SubscribeScope(agentName string, agentScope string, topicType interface{},
 	activate bool, ctx interface{}) (*Subscription, error) {
 
-	return subscribeImpl(agentName, agentScope, topicType, activate, ctx,
-		false)
+	return subscribeImpl(agentName, agentScope, "", topicType, activate,
+		ctx, false)
 }
 
 func SubscribePersistent(agentName string, topicType interface{}, activate bool,
 	ctx interface{}) (*Subscription, error) {
 
-	return subscribeImpl(agentName, "", topicType, activate, ctx, true)
+	return subscribeImpl(agentName, "", "", topicType, activate, ctx, true)
 }
 
-func subscribeImpl(agentName string, agentScope string, topicType interface{},
-	activate bool, ctx interface{}, persistent bool) (*Subscription, error) {
+// SubscribeInstance subscribes to one instance published using
+// PublishInstance, or to all of them when instance is WildcardInstance.
+// With a wildcard the keys from the different instances are merged into
+// one collection hence they need to be unique across the instances.
+func SubscribeInstance(agentName string, instance string,
+	topicType interface{}, activate bool,
+	ctx interface{}) (*Subscription, error) {
+
+	if agentName == "" || instance == "" ||
+		strings.Contains(instance, "/") {
+		errStr := fmt.Sprintf("SubscribeInstance(%s): invalid instance <%s>",
+			agentName, instance)
+		return nil, errors.New(errStr)
+	}
+	return subscribeImpl(agentName, "", instance, topicType, activate,
+		ctx, false)
+}
+
+func subscribeImpl(agentName string, agentScope string, instance string,
+	topicType interface{}, activate bool, ctx interface{},
+	persistent bool) (*Subscription, error) {
 
 	topic := TypeToName(topicType)
 	changes := make(chan string)
@@ -863,6 +1061,7 @@ func subscribeImpl(agentName string, agentScope string, topicType interface{},
 	sub.agentName = agentName
 	sub.agentScope = agentScope
 	sub.topic = topic
+	sub.instance = instance
 	sub.userCtx = ctx
 	sub.km = keyMap{key: NewLockedStringMap()}
 	sub.persistent = persistent
@@ -897,22 +1096,44 @@ func subscribeImpl(agentName string, agentScope string, topicType interface{},
 func (sub *Subscription) Activate() error {
 
 	name := sub.nameString()
-	if sub.subscribeFromDir {
-		// Waiting for directory to appear
-		for {
-			if _, err := os.Stat(sub.dirName); err != nil {
-				errStr := fmt.Sprintf("Subscribe(%s): failed %s; waiting",
-					name, err)
-				log.Errorln(errStr)
-				time.Sleep(10 * time.Second)
-			} else {
-				break
-			}
+	if sub.instance == WildcardInstance {
+		if sub.subscribeFromDir || !subscribeFromSock {
+			errStr := fmt.Sprintf("Subscribe(%s): wildcard requires socket",
+				name)
+			return errors.New(errStr)
+		}
+		sub.startInitialTimer()
+		go sub.watchInstances()
+		return nil
+	}
+	if sub.inMemory {
+		sub.startInitialTimer()
+		sub.memActivate()
+		return nil
+	}
+	if sub.subscribeFromDir && sub.persistent {
+		sub.startInitialTimer()
+		if _, err := os.Stat(sub.dirName); err != nil {
+			// Nothing was saved; wait in the background
+			log.Infof("Subscribe(%s): no persistent state: %s\n",
+				name, err)
+			go func() {
+				sub.sendSignal(signalNoPersistentState)
+				sub.waitForDir()
+				watch.WatchStatus(sub.dirName, true, sub.sendChan)
+			}()
+			return nil
 		}
 		go watch.WatchStatus(sub.dirName, true, sub.sendChan)
 		return nil
+	} else if sub.subscribeFromDir {
+		sub.startInitialTimer()
+		sub.waitForDir()
+		go watch.WatchStatus(sub.dirName, true, sub.sendChan)
+		return nil
 	} else if subscribeFromSock {
-		go sub.watchSock()
+		sub.startInitialTimer()
+		go sub.watchSock(SockName(name), nil)
 		return nil
 	} else {
 		errStr := fmt.Sprintf("Subscribe(%s): failed %s",
@@ -921,10 +1142,148 @@ func (sub *Subscription) Activate() error {
 	}
 }
 
-func (sub *Subscription) watchSock() {
+// Signals queued on the change channel by the subscription itself, in
+// addition to the changes from the publisher. Their operation "I" is not
+// used by watch nor by the socket protocol.
+type subSignal string
+
+const (
+	signalNoPersistentState subSignal = "I none"
+	signalInitialTimeout    subSignal = "I timeout"
+)
+
+func (sub *Subscription) sendSignal(signal subSignal) {
+	sub.sendChan <- string(signal)
+}
 
+// Once Activate can no longer fail
+func (sub *Subscription) startInitialTimer() {
+	if sub.InitialStateTimeout == 0 {
+		return
+	}
+	sub.initialTimer = time.AfterFunc(sub.InitialStateTimeout,
+		func() { sub.sendSignal(signalInitialTimeout) })
+}
+
+// Waiting for directory to appear
+func (sub *Subscription) waitForDir() {
 	for {
-		msg, key, val := sub.connectAndRead()
+		if _, err := os.Stat(sub.dirName); err != nil {
+			errStr := fmt.Sprintf("Subscribe(%s): failed %s; waiting",
+				sub.nameString(), err)
+			log.Errorln(errStr)
+			time.Sleep(10 * time.Second)
+		} else {
+			break
+		}
+	}
+}
+
+// The watchSock goroutine for one instance of a wildcard subscription.
+// done is closed when the socket is removed, and exited is closed once
+// the keys from the instance have been reported as deleted.
+type instanceWatch struct {
+	done   chan struct{}
+	exited chan struct{}
+}
+
+// Look for new instances of the topic and start a watchSock for each one.
+// When the socket of an instance is removed (see Publication.Close) the
+// keys received from that instance are deleted. If the publisher just
+// exits the socket remains and we reconnect once it restarts.
+func (sub *Subscription) watchInstances() {
+
+	name := sub.nameString()
+	sockDir := path.Dir(SockName(name))
+	if err := os.MkdirAll(sockDir, 0700); err != nil {
+		log.Fatalf("watchInstances(%s): %s\n", name, err)
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatalf("watchInstances(%s): NewWatcher %s\n", name, err)
+	}
+	defer w.Close()
+	if err := w.Add(sockDir); err != nil {
+		log.Fatalf("watchInstances(%s): %s %s\n", name, sockDir, err)
+	}
+	watching := make(map[string]*instanceWatch)
+	add := func(fileName string) {
+		if !strings.HasSuffix(fileName, ".sock") {
+			return
+		}
+		instance := strings.TrimSuffix(fileName, ".sock")
+		prev, ok := watching[instance]
+		if ok {
+			select {
+			case <-prev.done:
+			default:
+				return
+			}
+		}
+		log.Infof("watchInstances(%s): found instance %s\n",
+			name, instance)
+		iw := &instanceWatch{
+			done:   make(chan struct{}),
+			exited: make(chan struct{}),
+		}
+		watching[instance] = iw
+		go func() {
+			// Let the previous one delete its keys first
+			if prev != nil {
+				<-prev.exited
+			}
+			sub.watchSock(sockDir+"/"+fileName, iw.done)
+			close(iw.exited)
+		}()
+	}
+	remove := func(fileName string) {
+		instance := strings.TrimSuffix(fileName, ".sock")
+		iw, ok := watching[instance]
+		if !ok {
+			return
+		}
+		select {
+		case <-iw.done:
+			return
+		default:
+		}
+		log.Infof("watchInstances(%s): removed instance %s\n",
+			name, instance)
+		close(iw.done)
+	}
+
+	// Added the watch first hence we do not miss anything created
+	// after the ReadDir
+	files, err := ioutil.ReadDir(sockDir)
+	if err != nil {
+		log.Errorf("watchInstances(%s): %s\n", name, err)
+	}
+	for _, file := range files {
+		add(file.Name())
+	}
+	for {
+		select {
+		case event := <-w.Events:
+			baseName := path.Base(event.Name)
+			if event.Op&fsnotify.Create != 0 {
+				add(baseName)
+			} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				remove(baseName)
+			}
+		case err := <-w.Errors:
+			log.Errorf("watchInstances(%s): %s\n", name, err)
+		}
+	}
+}
+
+// If done is non-nil we return once it is closed, after reporting all
+// the keys we received as deleted.
+func (sub *Subscription) watchSock(sockName string, done <-chan struct{}) {
+
+	var sock net.Conn
+	received := make(map[string]bool)
+	for {
+		msg, key, val := sub.connectAndRead(sockName, &sock, done)
 		switch msg {
 		case "hello":
 			// Do nothing
@@ -938,54 +1297,80 @@ func (sub *Subscription) watchSock() {
 			sub.sendChan <- "R done"
 
 		case "delete":
+			if done != nil {
+				delete(received, key)
+			}
 			sub.sendChan <- "D " + key
 
 		case "update":
+			if done != nil {
+				received[key] = true
+			}
 			// XXX is size of val any issue? pointer?
 			sub.sendChan <- "M " + key + " " + val
+
+		case "closed":
+			for key := range received {
+				sub.sendChan <- "D " + key
+			}
+			return
 		}
 	}
 }
 
 // Returns msg, key, val
 // key and val are base64-encoded
-func (sub *Subscription) connectAndRead() (string, string, string) {
+// The caller owns sock so that a wildcard subscription can have one
+// connection per instance. Returns "closed" once done is closed.
+func (sub *Subscription) connectAndRead(sockName string,
+	sock *net.Conn, done <-chan struct{}) (string, string, string) {
 
 	name := sub.nameString()
-	sockName := SockName(name)
 	buf := make([]byte, 65536)
 
 	// Waiting for publisher to appear; retry on error
 	for {
-		if sub.sock == nil {
+		select {
+		case <-done:
+			if *sock != nil {
+				(*sock).Close()
+				*sock = nil
+			}
+			return "closed", "", ""
+		default:
+		}
+		if *sock == nil {
 			s, err := net.Dial("unixpacket", sockName)
 			if err != nil {
 				errStr := fmt.Sprintf("connectAndRead(%s): Dial failed %s",
 					name, err)
 				log.Warnln(errStr)
-				time.Sleep(10 * time.Second)
+				select {
+				case <-done:
+				case <-time.After(10 * time.Second):
+				}
 				continue
 			}
-			sub.sock = s
+			*sock = s
 			req := fmt.Sprintf("request %s", sub.topic)
 			_, err = s.Write([]byte(req))
 			if err != nil {
 				errStr := fmt.Sprintf("connectAndRead(%s): sock write failed %s",
 					name, err)
 				log.Errorln(errStr)
-				sub.sock.Close()
-				sub.sock = nil
+				(*sock).Close()
+				*sock = nil
 				continue
 			}
 		}
 
-		res, err := sub.sock.Read(buf)
+		res, err := (*sock).Read(buf)
 		if err != nil {
 			errStr := fmt.Sprintf("connectAndRead(%s): sock read failed %s",
 				name, err)
 			log.Errorln(errStr)
-			sub.sock.Close()
-			sub.sock = nil
+			(*sock).Close()
+			*sock = nil
 			continue
 		}
 
@@ -1091,6 +1476,14 @@ func (sub *Subscription) connectAndRead() (string, string, string) {
 // is removed by HandleStatusEvent.
 func (sub *Subscription) ProcessChange(change string) {
 
+	switch subSignal(change) {
+	case signalInitialTimeout:
+		handleInitialState(sub, true)
+		return
+	case signalNoPersistentState:
+		handleInitialState(sub, false)
+		return
+	}
 	if sub.subscribeFromDir {
 		var restartFn watch.StatusRestartHandler = handleRestart
 		var completeFn watch.StatusRestartHandler = handleSynchronized
@@ -1178,6 +1571,13 @@ func handleModify(ctxArg interface{}, key string, item interface{}) {
 	if sub.ModifyHandler != nil {
 		(sub.ModifyHandler)(sub.userCtx, key, newItem)
 	}
+	if sub.ModifyDiffHandler != nil {
+		var oldItem interface{}
+		if ok {
+			oldItem = m
+		}
+		(sub.ModifyDiffHandler)(sub.userCtx, key, newItem, oldItem)
+	}
 	log.Debugf("pubsub.handleModify(%s) done for key %s\n", name, key)
 }
 
@@ -1232,10 +1632,42 @@ func handleSynchronized(ctxArg interface{}, synchronized bool) {
 	if sub.SynchronizedHandler != nil {
 		(sub.SynchronizedHandler)(sub.userCtx, synchronized)
 	}
+	if synchronized {
+		handleInitialState(sub, false)
+	}
 	log.Debugf("pubsub.handleSynchronized(%s) done for synchronized %v\n",
 		name, synchronized)
 }
 
+// Report the initial state once; whichever of synchronized, no
+// persistent state, or the timeout comes first
+func handleInitialState(sub *Subscription, timedOut bool) {
+	if sub.initialState {
+		return
+	}
+	sub.initialState = true
+	if sub.initialTimer != nil {
+		sub.initialTimer.Stop()
+	}
+	count := 0
+	counter := func(key string, val interface{}) bool {
+		count++
+		return true
+	}
+	sub.km.key.Range(counter)
+	name := sub.nameString()
+	if timedOut {
+		log.Warnf("pubsub.handleInitialState(%s) timed out with %d objects\n",
+			name, count)
+	} else {
+		log.Infof("pubsub.handleInitialState(%s) done with %d objects\n",
+			name, count)
+	}
+	if sub.InitialStateHandler != nil {
+		(sub.InitialStateHandler)(sub.userCtx, count, timedOut)
+	}
+}
+
 func (sub *Subscription) dump(infoStr string) {
 	name := sub.nameString()
 	log.Debugf("dump(%s) %s\n", name, infoStr)
@@ -1281,3 +1713,8 @@ func (sub *Subscription) Restarted() bool {
 func (sub *Subscription) Synchronized() bool {
 	return sub.synchronized
 }
+
+// InitialStateDone is set once the InitialStateHandler would be called
+func (sub *Subscription) InitialStateDone() bool {
+	return sub.initialState
+}
@@ -57,16 +57,10 @@ else
 fi
 
 # Create the watchdog(8) config files we will use
+# The hardware watchdog is driven by hwwatchdog hence watchdog(8) does
+# not open /dev/watchdog
 # XXX should we enable realtime in the kernel?
-if [ $USE_HW_WATCHDOG = 1 ]; then
-    cat >$TMPDIR/watchdogbase.conf <<EOF
-watchdog-device = /dev/watchdog
-EOF
-else
-    cat >$TMPDIR/watchdogbase.conf <<EOF
-EOF
-fi
-cat >>$TMPDIR/watchdogbase.conf <<EOF
+cat >$TMPDIR/watchdogbase.conf <<EOF
 admin =
 #realtime = yes
 #priority = 1
@@ -107,7 +101,7 @@ done
 if [ -f /var/run/watchdog.pid ]; then
     kill "$(cat /var/run/watchdog.pid)"
 fi
-# Always run watchdog(8) in case we have a hardware watchdog timer to advance
+# Always run watchdog(8) for the software checks and reports
 /usr/sbin/watchdog -c $TMPDIR/watchdogbase.conf -F -s &
 
 DIRS="$CONFIGDIR $PERSISTDIR $TMPDIR $CONFIGDIR/DevicePortConfig $TMPDIR/DeviceNetworkConfig/ $TMPDIR/AssignableAdapters"
@@ -167,6 +161,30 @@ if ! CURPART=$(zboot curpart); then
     CURPART="IMGA"
 fi
 
+# hwwatchdog stops pinging the hardware watchdog if an agent which has
+# started stops calling StillRunning
+if [ $USE_HW_WATCHDOG = 1 ]; then
+    if [ -f /var/run/hwwatchdog.pid ]; then
+	# The device can only be opened once the old one has exited. It
+	# keeps running meanwhile, hence we do not wait longer than its
+	# timeout.
+	pid=$(cat /var/run/hwwatchdog.pid)
+	kill "$pid"
+	i=0
+	while kill -0 "$pid" 2>/dev/null && [ $i -lt 20 ]; do
+	    sleep 1
+	    i=$((i + 1))
+	done
+	if kill -0 "$pid" 2>/dev/null; then
+	    kill -9 "$pid"
+	    sleep 1
+	fi
+	rm -f /var/run/hwwatchdog.pid
+    fi
+    echo "$(date -Ins -u) Starting hwwatchdog"
+    $BINDIR/hwwatchdog -c $CURPART $AGENTS &
+fi
+
 if [ ! -d $LOGDIRA ]; then
     echo "$(date -Ins -u) Creating $LOGDIRA"
     mkdir -p $LOGDIRA
@@ -214,11 +232,11 @@ if [ ! -d $PERSISTDIR/$CURPART/log/lisp ]; then
 fi
 ln -s $PERSISTDIR/$CURPART/log/lisp $LISPDIR/logs
 
-# BlinkCounter 1 means we have started; might not yet have IP addresses
-# client/selfRegister and zedagent update this when the found at least
-# one free uplink with IP address(s)
+# DeviceState 1 (DeviceStateNoDHCP) means we have started; might not yet
+# have IP addresses. client/selfRegister and zedagent update this when
+# they found at least one free uplink with IP address(s)
 mkdir -p /var/tmp/zededa/LedBlinkCounter/
-echo '{"BlinkCounter": 1}' > '/var/tmp/zededa/LedBlinkCounter/ledconfig.json'
+echo '{"DeviceState": 1}' > '/var/tmp/zededa/LedBlinkCounter/ledconfig.json'
 
 # If ledmanager is already running we don't have to start it.
 # TBD: Should we start it earlier before wwan and wlan services?
@@ -252,8 +270,17 @@ if [ -n "$SPECIAL" ] && [ -b "$SPECIAL" ]; then
 	else
 	    echo "$(date -Ins -u) $keyfile not found on $SPECIAL"
 	fi
+	bundle=/mnt/provision.json
+	if [ -f $bundle ]; then
+	    echo "$(date -Ins -u) Applying provisioning bundle $bundle from $SPECIAL"
+	    $BINDIR/client -c $CURPART -B $bundle provision
+	fi
     fi
 fi
+if [ -f $CONFIGDIR/provision.json ]; then
+    echo "$(date -Ins -u) Applying provisioning bundle $CONFIGDIR/provision.json"
+    $BINDIR/client -c $CURPART provision
+fi
 
 # Copy any DevicePortConfig from /config
 dir=$CONFIGDIR/DevicePortConfig
@@ -311,9 +338,13 @@ if [ -f /var/run/watchdog.pid ]; then
 fi
 /usr/sbin/watchdog -c $TMPDIR/watchdogclient.conf -F -s &
 
-if ! [ -f $CONFIGDIR/device.cert.pem ] || ! [ -f $CONFIGDIR/device.key.pem ]; then
+if ! [ -f $CONFIGDIR/device.cert.pem ] || { ! [ -f $CONFIGDIR/device.key.pem ] && ! [ -f $CONFIGDIR/device.key.tpm ]; }; then
     echo "$(date -Ins -u) Generating a device key pair and self-signed cert (using TPM/TEE if available)"
-    $BINDIR/generate-device.sh $CONFIGDIR/device
+    if { [ -c /dev/tpmrm0 ] || [ -c /dev/tpm0 ]; } && $BINDIR/client -c $CURPART tpmDeviceCert; then
+	echo "$(date -Ins -u) Device key is in the TPM"
+    else
+	$BINDIR/generate-device.sh $CONFIGDIR/device
+    fi
     SELF_REGISTER=1
 elif [ -f $CONFIGDIR/self-register-failed ]; then
     echo "$(date -Ins -u) self-register failed/killed/rebooted"
@@ -396,7 +427,11 @@ if [ ! -d $LISPDIR ]; then
 fi
 
 # Need a key for device-to-device map-requests
-cp -p $CONFIGDIR/device.key.pem $LISPDIR/lisp-sig.pem
+if [ -f $CONFIGDIR/device.key.pem ]; then
+    cp -p $CONFIGDIR/device.key.pem $LISPDIR/lisp-sig.pem
+else
+    echo "$(date -Ins -u) Device key is in the TPM; no lisp-sig.pem"
+fi
 
 # Setup default amount of space for images
 # Half of /persist by default! Convert to kbytes
@@ -0,0 +1,222 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// DeviceKeyHandle is the persistent handle for the device key
+const DeviceKeyHandle = 0x81000002
+
+// AltDeviceKeyHandle holds the new key while the device key is rotated
+const AltDeviceKeyHandle = 0x81000003
+
+// The device key is an unrestricted ECC P-256 signing key. The scheme is
+// left open so that the TLS stack can pick the hash.
+// A primary key is derived from the hierarchy seed and the template,
+// hence the random unique.x to get a new key each time.
+func writeKeyTemplate(c *command, unique []byte) {
+	var tmpl command
+	tmpl.u16(algECC)
+	tmpl.u16(algSHA256) // nameAlg
+	tmpl.u32(attrFixedTPM | attrFixedParent | attrSensitiveDataOrigin |
+		attrUserWithAuth | attrNoDA | attrSign)
+	tmpl.tpm2b(nil)   // authPolicy
+	tmpl.u16(algNull) // symmetric
+	tmpl.u16(algNull) // scheme
+	tmpl.u16(eccP256)
+	tmpl.u16(algNull)  // kdf
+	tmpl.tpm2b(unique) // unique.x
+	tmpl.tpm2b(nil)    // unique.y
+	c.tpm2b(tmpl.params.Bytes())
+}
+
+// CreateDeviceKey creates the device key in the owner hierarchy and
+// persists it at handle. Any existing key at handle is left alone and
+// an error is returned.
+func CreateDeviceKey(handle uint32) (*ecdsa.PublicKey, error) {
+	if _, err := ReadPublic(handle); err == nil {
+		errStr := fmt.Sprintf("TPM handle 0x%x already in use", handle)
+		return nil, errors.New(errStr)
+	}
+	c := &command{code: ccCreatePrimary, handles: []uint32{rhOwner},
+		auth: true}
+	// TPM2B_SENSITIVE_CREATE with empty userAuth and data
+	c.tpm2b([]byte{0, 0, 0, 0})
+	unique := make([]byte, 32)
+	if _, err := rand.Read(unique); err != nil {
+		return nil, err
+	}
+	writeKeyTemplate(c, unique)
+	c.tpm2b(nil) // outsideInfo
+	c.u32(0)     // creationPCR
+	r, handles, err := run(c, 1)
+	if err != nil {
+		return nil, err
+	}
+	transient := handles[0]
+	pub, err := parsePublic(r.tpm2b(), r.err)
+	if err == nil {
+		err = evictControl(transient, handle)
+	}
+	if ferr := flushContext(transient); ferr != nil && err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func evictControl(transient uint32, persistent uint32) error {
+	c := &command{code: ccEvictControl,
+		handles: []uint32{rhOwner, transient}, auth: true}
+	c.u32(persistent)
+	_, _, err := run(c, 0)
+	return err
+}
+
+// DeleteKey removes the persistent key at handle
+func DeleteKey(handle uint32) error {
+	return evictControl(handle, handle)
+}
+
+func flushContext(handle uint32) error {
+	c := &command{code: ccFlushContext}
+	c.u32(handle)
+	_, _, err := run(c, 0)
+	return err
+}
+
+// ReadPublic returns the public key of the key at handle
+func ReadPublic(handle uint32) (*ecdsa.PublicKey, error) {
+	c := &command{code: ccReadPublic, handles: []uint32{handle}}
+	r, _, err := run(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublic(r.tpm2b(), r.err)
+}
+
+// parsePublic extracts the ECC point from a TPMT_PUBLIC
+func parsePublic(b []byte, err error) (*ecdsa.PublicKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	r := newResponse(b)
+	keyType := r.u16()
+	r.u16() // nameAlg
+	r.u32() // objectAttributes
+	r.tpm2b()
+	if keyType != algECC {
+		errStr := fmt.Sprintf("TPM key type 0x%x is not ECC", keyType)
+		return nil, errors.New(errStr)
+	}
+	if r.u16() != algNull {
+		r.u16() // keyBits
+		r.u16() // mode
+	}
+	if r.u16() != algNull {
+		r.u16() // hashAlg
+	}
+	curve := r.u16()
+	if r.u16() != algNull {
+		r.u16() // kdf hashAlg
+	}
+	x := r.tpm2b()
+	y := r.tpm2b()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if curve != eccP256 {
+		errStr := fmt.Sprintf("TPM key curve 0x%x is not P-256", curve)
+		return nil, errors.New(errStr)
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(),
+		X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+// Signer is a crypto.Signer for a key in the TPM
+type Signer struct {
+	handle uint32
+	pub    *ecdsa.PublicKey
+}
+
+// NewSigner reads the public key at handle
+func NewSigner(handle uint32) (*Signer, error) {
+	pub, err := ReadPublic(handle)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{handle: handle, pub: pub}, nil
+}
+
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign returns an ASN.1 ECDSA signature of digest
+func (s *Signer) Sign(rand io.Reader, digest []byte,
+	opts crypto.SignerOpts) ([]byte, error) {
+
+	hashAlg, err := hashAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	c := &command{code: ccSign, handles: []uint32{s.handle}, auth: true}
+	c.tpm2b(digest)
+	c.u16(algECDSA)
+	c.u16(hashAlg)
+	// Null ticket since the digest was not computed by the TPM
+	c.u16(stHashCheck)
+	c.u32(rhNull)
+	c.tpm2b(nil)
+	r, _, err := run(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return parseSignature(r)
+}
+
+func hashAlgorithm(h crypto.Hash) (uint16, error) {
+	switch h {
+	case crypto.SHA256:
+		return algSHA256, nil
+	case crypto.SHA384:
+		return algSHA384, nil
+	case crypto.SHA512:
+		return algSHA512, nil
+	default:
+		errStr := fmt.Sprintf("Unsupported hash %v for TPM", h)
+		return 0, errors.New(errStr)
+	}
+}
+
+// parseSignature converts a TPMT_SIGNATURE to ASN.1
+func parseSignature(r *response) ([]byte, error) {
+	sigAlg := r.u16()
+	r.u16() // hash
+	sigR := r.tpm2b()
+	sigS := r.tpm2b()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sigAlg != algECDSA {
+		errStr := fmt.Sprintf("TPM signature algorithm 0x%x is not ECDSA",
+			sigAlg)
+		return nil, errors.New(errStr)
+	}
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{new(big.Int).SetBytes(sigR), new(big.Int).SetBytes(sigS)})
+}
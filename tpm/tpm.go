@@ -0,0 +1,266 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Minimal TPM 2.0 client for a device key which never leaves the TPM.
+// No TPM library is vendored, so we only implement the few commands we
+// need: create and persist an ECC P-256 signing key, read its public
+// part, and sign. The encoding follows TPM 2.0 Part 3 and the tests
+// check it against the byte layout given there. Authorization is with
+// empty passwords using the TPM_RS_PW session.
+
+package tpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// The resource manager device lets several agents use the TPM
+	deviceName       = "/dev/tpmrm0"
+	directDeviceName = "/dev/tpm0"
+	maxResponseSize  = 4096
+)
+
+// Structure tags
+const (
+	stNoSessions = 0x8001
+	stSessions   = 0x8002
+	stHashCheck  = 0x8024
+)
+
+// Command codes
+const (
+	ccEvictControl  = 0x00000120
+	ccCreatePrimary = 0x00000131
+	ccSign          = 0x0000015D
+	ccFlushContext  = 0x00000165
+	ccReadPublic    = 0x00000173
+)
+
+// Handles
+const (
+	rhOwner = 0x40000001
+	rsPW    = 0x40000009
+	rhNull  = 0x40000007
+)
+
+// Algorithms and curves
+const (
+	algSHA256 = 0x000B
+	algSHA384 = 0x000C
+	algSHA512 = 0x000D
+	algNull   = 0x0010
+	algECDSA  = 0x0018
+	algECC    = 0x0023
+	eccP256   = 0x0003
+)
+
+// Object attributes
+const (
+	attrFixedTPM            = 1 << 1
+	attrFixedParent         = 1 << 4
+	attrSensitiveDataOrigin = 1 << 5
+	attrUserWithAuth        = 1 << 6
+	attrNoDA                = 1 << 10
+	attrSign                = 1 << 18
+)
+
+// Response code for success
+const rcSuccess = 0
+
+var (
+	lock sync.Mutex
+	// Tests replace this
+	openDevice = func() (io.ReadWriteCloser, error) {
+		f, err := os.OpenFile(deviceName, os.O_RDWR, 0)
+		if err == nil || !os.IsNotExist(err) {
+			return f, err
+		}
+		return os.OpenFile(directDeviceName, os.O_RDWR, 0)
+	}
+)
+
+// IsAvailable returns true if there is a TPM 2.0 device
+func IsAvailable() bool {
+	for _, name := range []string{deviceName, directDeviceName} {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseError is a non-zero response code from the TPM
+type ResponseError struct {
+	Command uint32
+	Code    uint32
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("TPM command 0x%x failed: response code 0x%x",
+		e.Command, e.Code)
+}
+
+// command builds a command buffer. If auth is set the handles are
+// followed by a password session for the first handle.
+type command struct {
+	code    uint32
+	handles []uint32
+	auth    bool
+	params  bytes.Buffer
+}
+
+func (c *command) u8(v uint8) {
+	c.params.WriteByte(v)
+}
+
+func (c *command) u16(v uint16) {
+	binary.Write(&c.params, binary.BigEndian, v)
+}
+
+func (c *command) u32(v uint32) {
+	binary.Write(&c.params, binary.BigEndian, v)
+}
+
+// tpm2b writes a size-prefixed byte array
+func (c *command) tpm2b(b []byte) {
+	c.u16(uint16(len(b)))
+	c.params.Write(b)
+}
+
+func (c *command) bytes() []byte {
+	var buf bytes.Buffer
+	tag := uint16(stNoSessions)
+	if c.auth {
+		tag = stSessions
+	}
+	binary.Write(&buf, binary.BigEndian, tag)
+	binary.Write(&buf, binary.BigEndian, uint32(0)) // Size; set below
+	binary.Write(&buf, binary.BigEndian, c.code)
+	for _, h := range c.handles {
+		binary.Write(&buf, binary.BigEndian, h)
+	}
+	if c.auth {
+		// TPMS_AUTH_COMMAND: handle, nonce, attributes, password
+		binary.Write(&buf, binary.BigEndian, uint32(9))
+		binary.Write(&buf, binary.BigEndian, uint32(rsPW))
+		binary.Write(&buf, binary.BigEndian, uint16(0))
+		buf.WriteByte(0)
+		binary.Write(&buf, binary.BigEndian, uint16(0))
+	}
+	buf.Write(c.params.Bytes())
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[2:6], uint32(len(b)))
+	return b
+}
+
+// response parses a response buffer
+type response struct {
+	buf *bytes.Reader
+	err error
+}
+
+func newResponse(b []byte) *response {
+	return &response{buf: bytes.NewReader(b)}
+}
+
+func (r *response) u8() uint8 {
+	var v uint8
+	r.read(&v)
+	return v
+}
+
+func (r *response) u16() uint16 {
+	var v uint16
+	r.read(&v)
+	return v
+}
+
+func (r *response) u32() uint32 {
+	var v uint32
+	r.read(&v)
+	return v
+}
+
+func (r *response) tpm2b() []byte {
+	size := r.u16()
+	if r.err != nil {
+		return nil
+	}
+	if int(size) > r.buf.Len() {
+		r.err = errors.New("TPM response truncated")
+		return nil
+	}
+	b := make([]byte, size)
+	r.buf.Read(b)
+	return b
+}
+
+func (r *response) read(v interface{}) {
+	if r.err != nil {
+		return
+	}
+	if err := binary.Read(r.buf, binary.BigEndian, v); err != nil {
+		r.err = errors.New("TPM response truncated")
+	}
+}
+
+// run sends the command and returns the response after the header and
+// the handles, positioned at the parameters
+func run(c *command, handleCount int) (*response, []uint32, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	dev, err := openDevice()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dev.Close()
+	if _, err := dev.Write(c.bytes()); err != nil {
+		return nil, nil, err
+	}
+	b := make([]byte, maxResponseSize)
+	n, err := dev.Read(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseResponse(c.code, b[:n], handleCount)
+}
+
+func parseResponse(code uint32, b []byte,
+	handleCount int) (*response, []uint32, error) {
+
+	r := newResponse(b)
+	tag := r.u16()
+	size := r.u32()
+	rc := r.u32()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if rc != rcSuccess {
+		return nil, nil, &ResponseError{Command: code, Code: rc}
+	}
+	if int(size) != len(b) {
+		errStr := fmt.Sprintf("TPM response size %d but read %d",
+			size, len(b))
+		return nil, nil, errors.New(errStr)
+	}
+	var handles []uint32
+	for i := 0; i < handleCount; i++ {
+		handles = append(handles, r.u32())
+	}
+	if tag == stSessions {
+		// parameterSize; the sessions follow the parameters
+		r.u32()
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return r, handles, nil
+}
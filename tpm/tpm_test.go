@@ -0,0 +1,177 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// fakeDevice records the command and returns a canned response
+type fakeDevice struct {
+	command  []byte
+	response []byte
+}
+
+func (d *fakeDevice) Write(b []byte) (int, error) {
+	d.command = append([]byte{}, b...)
+	return len(b), nil
+}
+
+func (d *fakeDevice) Read(b []byte) (int, error) {
+	return copy(b, d.response), nil
+}
+
+func (d *fakeDevice) Close() error {
+	return nil
+}
+
+// Returns a function to restore the real device
+func useFakeDevice(response []byte) (*fakeDevice, func()) {
+	dev := &fakeDevice{response: response}
+	saved := openDevice
+	openDevice = func() (io.ReadWriteCloser, error) {
+		return dev, nil
+	}
+	return dev, func() { openDevice = saved }
+}
+
+// fromHex returns the bytes written as hex in the layout of TPM 2.0
+// Part 3, with spaces between the fields
+func fromHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatalf("Bad hex %s: %s", s, err)
+	}
+	return b
+}
+
+func TestSign(t *testing.T) {
+	// TPMT_SIGNATURE ECDSA SHA-256 with r=0x1234 s=0x5678
+	resp := fromHex(t, "8002 0000001f 00000000 0000000c "+
+		"0018 000b 0002 1234 0002 5678 0000 00 0000")
+	dev, restore := useFakeDevice(resp)
+	defer restore()
+
+	digest := sha256.Sum256([]byte("hello"))
+	s := &Signer{handle: DeviceKeyHandle}
+	b, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(b, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.R.Int64() != 0x1234 || parsed.S.Int64() != 0x5678 {
+		t.Errorf("Got signature %v %v", parsed.R, parsed.S)
+	}
+
+	// TPM2_Sign: header, keyHandle, TPM_RS_PW session, digest,
+	// inScheme, null TPMT_TK_HASHCHECK
+	expected := fromHex(t, "8002 00000049 0000015d 81000002 "+
+		"00000009 40000009 0000 00 0000 "+
+		"0020 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 "+
+		"0018 000b 8024 40000007 0000")
+	if !bytes.Equal(dev.command, expected) {
+		t.Errorf("Got command %x expected %x", dev.command, expected)
+	}
+}
+
+// The P-256 base point
+const (
+	testX = "6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296"
+	testY = "4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5"
+)
+
+func TestReadPublic(t *testing.T) {
+	// TPMT_PUBLIC as from our template, then name and qualifiedName
+	zeros := strings.Repeat("00", 32)
+	resp := fromHex(t, "8001 000000aa 00000000 "+
+		"0056 0023 000b 00040472 0000 0010 0010 0003 0010 "+
+		"0020 "+testX+" 0020 "+testY+" "+
+		"0022 000b "+zeros+" 0022 000b "+zeros)
+	dev, restore := useFakeDevice(resp)
+	defer restore()
+
+	pub, err := ReadPublic(DeviceKeyHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.X.Cmp(elliptic.P256().Params().Gx) != 0 ||
+		pub.Y.Cmp(elliptic.P256().Params().Gy) != 0 {
+		t.Errorf("Got public key %v %v", pub.X, pub.Y)
+	}
+	expected := fromHex(t, "8001 0000000e 00000173 81000002")
+	if !bytes.Equal(dev.command, expected) {
+		t.Errorf("Got command %x expected %x", dev.command, expected)
+	}
+
+	// An RSA key
+	resp[12] = 0x00
+	resp[13] = 0x01
+	if _, err := ReadPublic(DeviceKeyHandle); err == nil {
+		t.Errorf("No error for an RSA key")
+	}
+}
+
+func TestKeyTemplate(t *testing.T) {
+	var c command
+	writeKeyTemplate(&c, bytes.Repeat([]byte{1}, 32))
+	// ECC, SHA-256, fixedTPM|fixedParent|sensitiveDataOrigin|
+	// userWithAuth|noDA|sign, no policy, null symmetric and scheme,
+	// NIST P-256, null kdf, unique
+	expected := fromHex(t, "0036 0023 000b 00040472 0000 0010 0010 "+
+		"0003 0010 0020 "+strings.Repeat("01", 32)+" 0000")
+	if !bytes.Equal(c.params.Bytes(), expected) {
+		t.Errorf("Got template %x expected %x", c.params.Bytes(),
+			expected)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	var resp command
+	resp.u16(stNoSessions)
+	resp.u32(10)
+	resp.u32(0x18b) // TPM_RC_HANDLE
+	_, restore := useFakeDevice(resp.params.Bytes())
+	defer restore()
+
+	_, err := ReadPublic(DeviceKeyHandle)
+	rerr, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("Got %v expected a ResponseError", err)
+	}
+	if rerr.Command != ccReadPublic || rerr.Code != 0x18b {
+		t.Errorf("Got %+v", rerr)
+	}
+}
+
+func TestDeleteKey(t *testing.T) {
+	dev, restore := useFakeDevice(fromHex(t,
+		"8002 00000013 00000000 00000000 0000 00 0000"))
+	defer restore()
+
+	if err := DeleteKey(DeviceKeyHandle); err != nil {
+		t.Fatal(err)
+	}
+	// TPM2_EvictControl: header, owner and object handles, TPM_RS_PW
+	// session, persistent handle
+	expected := fromHex(t, "8002 00000023 00000120 40000001 81000002 "+
+		"00000009 40000009 0000 00 0000 81000002")
+	if !bytes.Equal(dev.command, expected) {
+		t.Errorf("Got command %x expected %x", dev.command, expected)
+	}
+}
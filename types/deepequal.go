@@ -0,0 +1,17 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Equal and Diff for the structs listed in gendeepequal are generated
+// into deepequal_generated.go. cmp.Equal uses the Equal methods.
+
+//go:generate go run gendeepequal/main.go
+
+package types
+
+// fieldPath is the path of a field for Diff
+func fieldPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,1332 @@
+// Code generated by gendeepequal; DO NOT EDIT.
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/eriknordmark/ipinfo"
+)
+
+// Equal is true if all fields are equal
+func (a DeviceNetworkStatus) Equal(b DeviceNetworkStatus) bool {
+	return equalDeviceNetworkStatus(a, b)
+}
+
+// Diff returns a line per field which differs
+func (a DeviceNetworkStatus) Diff(b DeviceNetworkStatus) string {
+	var w bytes.Buffer
+	diffDeviceNetworkStatus("", a, b, &w)
+	return w.String()
+}
+
+// Equal is true if all fields are equal
+func (a DevicePortConfig) Equal(b DevicePortConfig) bool {
+	return equalDevicePortConfig(a, b)
+}
+
+// Diff returns a line per field which differs
+func (a DevicePortConfig) Diff(b DevicePortConfig) string {
+	var w bytes.Buffer
+	diffDevicePortConfig("", a, b, &w)
+	return w.String()
+}
+
+// Equal is true if all fields are equal
+func (a DevicePortConfigList) Equal(b DevicePortConfigList) bool {
+	return equalDevicePortConfigList(a, b)
+}
+
+// Diff returns a line per field which differs
+func (a DevicePortConfigList) Diff(b DevicePortConfigList) string {
+	var w bytes.Buffer
+	diffDevicePortConfigList("", a, b, &w)
+	return w.String()
+}
+
+// Equal is true if all fields are equal
+func (a DomainStatus) Equal(b DomainStatus) bool {
+	return equalDomainStatus(a, b)
+}
+
+// Diff returns a line per field which differs
+func (a DomainStatus) Diff(b DomainStatus) string {
+	var w bytes.Buffer
+	diffDomainStatus("", a, b, &w)
+	return w.String()
+}
+
+func equalDeviceNetworkStatus(a, b DeviceNetworkStatus) bool {
+	if a.Version != b.Version {
+		return false
+	}
+	if a.Testing != b.Testing {
+		return false
+	}
+	if a.DPCKey != b.DPCKey {
+		return false
+	}
+	if !a.TimePriority.Equal(b.TimePriority) {
+		return false
+	}
+	if !a.LastFailed.Equal(b.LastFailed) {
+		return false
+	}
+	if !a.LastSucceeded.Equal(b.LastSucceeded) {
+		return false
+	}
+	if !equalSliceOfNetworkPortStatus(a.Ports, b.Ports) {
+		return false
+	}
+	return true
+}
+
+func diffDeviceNetworkStatus(path string, a, b DeviceNetworkStatus, w *bytes.Buffer) {
+	if a.Version != b.Version {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Version"), a.Version, b.Version)
+	}
+	if a.Testing != b.Testing {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Testing"), a.Testing, b.Testing)
+	}
+	if a.DPCKey != b.DPCKey {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DPCKey"), a.DPCKey, b.DPCKey)
+	}
+	if !a.TimePriority.Equal(b.TimePriority) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "TimePriority"), a.TimePriority, b.TimePriority)
+	}
+	if !a.LastFailed.Equal(b.LastFailed) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastFailed"), a.LastFailed, b.LastFailed)
+	}
+	if !a.LastSucceeded.Equal(b.LastSucceeded) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastSucceeded"), a.LastSucceeded, b.LastSucceeded)
+	}
+	diffSliceOfNetworkPortStatus(fieldPath(path, "Ports"), a.Ports, b.Ports, w)
+}
+
+func equalDevicePortConfig(a, b DevicePortConfig) bool {
+	if a.Version != b.Version {
+		return false
+	}
+	if a.Key != b.Key {
+		return false
+	}
+	if !a.TimePriority.Equal(b.TimePriority) {
+		return false
+	}
+	if !a.LastFailed.Equal(b.LastFailed) {
+		return false
+	}
+	if !a.LastSucceeded.Equal(b.LastSucceeded) {
+		return false
+	}
+	if a.LastError != b.LastError {
+		return false
+	}
+	if !equalSliceOfNetworkPortConfig(a.Ports, b.Ports) {
+		return false
+	}
+	return true
+}
+
+func diffDevicePortConfig(path string, a, b DevicePortConfig, w *bytes.Buffer) {
+	if a.Version != b.Version {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Version"), a.Version, b.Version)
+	}
+	if a.Key != b.Key {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Key"), a.Key, b.Key)
+	}
+	if !a.TimePriority.Equal(b.TimePriority) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "TimePriority"), a.TimePriority, b.TimePriority)
+	}
+	if !a.LastFailed.Equal(b.LastFailed) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastFailed"), a.LastFailed, b.LastFailed)
+	}
+	if !a.LastSucceeded.Equal(b.LastSucceeded) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastSucceeded"), a.LastSucceeded, b.LastSucceeded)
+	}
+	if a.LastError != b.LastError {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastError"), a.LastError, b.LastError)
+	}
+	diffSliceOfNetworkPortConfig(fieldPath(path, "Ports"), a.Ports, b.Ports, w)
+}
+
+func equalDevicePortConfigList(a, b DevicePortConfigList) bool {
+	if a.CurrentIndex != b.CurrentIndex {
+		return false
+	}
+	if !equalSliceOfDevicePortConfig(a.PortConfigList, b.PortConfigList) {
+		return false
+	}
+	return true
+}
+
+func diffDevicePortConfigList(path string, a, b DevicePortConfigList, w *bytes.Buffer) {
+	if a.CurrentIndex != b.CurrentIndex {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "CurrentIndex"), a.CurrentIndex, b.CurrentIndex)
+	}
+	diffSliceOfDevicePortConfig(fieldPath(path, "PortConfigList"), a.PortConfigList, b.PortConfigList, w)
+}
+
+func equalDomainStatus(a, b DomainStatus) bool {
+	if !equalUUIDandVersion(a.UUIDandVersion, b.UUIDandVersion) {
+		return false
+	}
+	if a.DisplayName != b.DisplayName {
+		return false
+	}
+	if a.State != b.State {
+		return false
+	}
+	if a.Activated != b.Activated {
+		return false
+	}
+	if a.AppNum != b.AppNum {
+		return false
+	}
+	if a.PendingAdd != b.PendingAdd {
+		return false
+	}
+	if a.PendingModify != b.PendingModify {
+		return false
+	}
+	if a.PendingDelete != b.PendingDelete {
+		return false
+	}
+	if a.DomainName != b.DomainName {
+		return false
+	}
+	if a.DomainId != b.DomainId {
+		return false
+	}
+	if !a.BootTime.Equal(b.BootTime) {
+		return false
+	}
+	if !equalSliceOfDiskStatus(a.DiskStatusList, b.DiskStatusList) {
+		return false
+	}
+	if !equalSliceOfVifInfo(a.VifList, b.VifList) {
+		return false
+	}
+	if !equalSliceOfIoAdapter(a.IoAdapterList, b.IoAdapterList) {
+		return false
+	}
+	if a.VirtualizationMode != b.VirtualizationMode {
+		return false
+	}
+	if a.EnableVnc != b.EnableVnc {
+		return false
+	}
+	if a.VncDisplay != b.VncDisplay {
+		return false
+	}
+	if a.VncPasswd != b.VncPasswd {
+		return false
+	}
+	if a.IOThreadCPUs != b.IOThreadCPUs {
+		return false
+	}
+	if a.TriedCount != b.TriedCount {
+		return false
+	}
+	if !equalErrorAndTime(a.ErrorAndTime, b.ErrorAndTime) {
+		return false
+	}
+	if a.BootFailed != b.BootFailed {
+		return false
+	}
+	if a.AdaptersFailed != b.AdaptersFailed {
+		return false
+	}
+	return true
+}
+
+func diffDomainStatus(path string, a, b DomainStatus, w *bytes.Buffer) {
+	diffUUIDandVersion(fieldPath(path, "UUIDandVersion"), a.UUIDandVersion, b.UUIDandVersion, w)
+	if a.DisplayName != b.DisplayName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DisplayName"), a.DisplayName, b.DisplayName)
+	}
+	if a.State != b.State {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "State"), a.State, b.State)
+	}
+	if a.Activated != b.Activated {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Activated"), a.Activated, b.Activated)
+	}
+	if a.AppNum != b.AppNum {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "AppNum"), a.AppNum, b.AppNum)
+	}
+	if a.PendingAdd != b.PendingAdd {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "PendingAdd"), a.PendingAdd, b.PendingAdd)
+	}
+	if a.PendingModify != b.PendingModify {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "PendingModify"), a.PendingModify, b.PendingModify)
+	}
+	if a.PendingDelete != b.PendingDelete {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "PendingDelete"), a.PendingDelete, b.PendingDelete)
+	}
+	if a.DomainName != b.DomainName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DomainName"), a.DomainName, b.DomainName)
+	}
+	if a.DomainId != b.DomainId {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DomainId"), a.DomainId, b.DomainId)
+	}
+	if !a.BootTime.Equal(b.BootTime) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "BootTime"), a.BootTime, b.BootTime)
+	}
+	diffSliceOfDiskStatus(fieldPath(path, "DiskStatusList"), a.DiskStatusList, b.DiskStatusList, w)
+	diffSliceOfVifInfo(fieldPath(path, "VifList"), a.VifList, b.VifList, w)
+	diffSliceOfIoAdapter(fieldPath(path, "IoAdapterList"), a.IoAdapterList, b.IoAdapterList, w)
+	if a.VirtualizationMode != b.VirtualizationMode {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "VirtualizationMode"), a.VirtualizationMode, b.VirtualizationMode)
+	}
+	if a.EnableVnc != b.EnableVnc {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "EnableVnc"), a.EnableVnc, b.EnableVnc)
+	}
+	if a.VncDisplay != b.VncDisplay {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "VncDisplay"), a.VncDisplay, b.VncDisplay)
+	}
+	if a.VncPasswd != b.VncPasswd {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "VncPasswd"), a.VncPasswd, b.VncPasswd)
+	}
+	if a.IOThreadCPUs != b.IOThreadCPUs {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IOThreadCPUs"), a.IOThreadCPUs, b.IOThreadCPUs)
+	}
+	if a.TriedCount != b.TriedCount {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "TriedCount"), a.TriedCount, b.TriedCount)
+	}
+	diffErrorAndTime(fieldPath(path, "ErrorAndTime"), a.ErrorAndTime, b.ErrorAndTime, w)
+	if a.BootFailed != b.BootFailed {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "BootFailed"), a.BootFailed, b.BootFailed)
+	}
+	if a.AdaptersFailed != b.AdaptersFailed {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "AdaptersFailed"), a.AdaptersFailed, b.AdaptersFailed)
+	}
+}
+
+func equalSliceOfNetworkPortStatus(a, b []NetworkPortStatus) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalNetworkPortStatus(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfNetworkPortStatus(path string, a, b []NetworkPortStatus, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffNetworkPortStatus(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalSliceOfNetworkPortConfig(a, b []NetworkPortConfig) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalNetworkPortConfig(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfNetworkPortConfig(path string, a, b []NetworkPortConfig, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffNetworkPortConfig(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalSliceOfDevicePortConfig(a, b []DevicePortConfig) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfDevicePortConfig(path string, a, b []DevicePortConfig, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffDevicePortConfig(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalUUIDandVersion(a, b UUIDandVersion) bool {
+	if a.UUID != b.UUID {
+		return false
+	}
+	if a.Version != b.Version {
+		return false
+	}
+	return true
+}
+
+func diffUUIDandVersion(path string, a, b UUIDandVersion, w *bytes.Buffer) {
+	if a.UUID != b.UUID {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "UUID"), a.UUID, b.UUID)
+	}
+	if a.Version != b.Version {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Version"), a.Version, b.Version)
+	}
+}
+
+func equalSliceOfDiskStatus(a, b []DiskStatus) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalDiskStatus(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfDiskStatus(path string, a, b []DiskStatus, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffDiskStatus(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalSliceOfVifInfo(a, b []VifInfo) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalVifInfo(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfVifInfo(path string, a, b []VifInfo, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffVifInfo(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalSliceOfIoAdapter(a, b []IoAdapter) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalIoAdapter(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfIoAdapter(path string, a, b []IoAdapter, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffIoAdapter(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalErrorAndTime(a, b ErrorAndTime) bool {
+	if !equalErrorDescription(a.ErrorDescription, b.ErrorDescription) {
+		return false
+	}
+	return true
+}
+
+func diffErrorAndTime(path string, a, b ErrorAndTime, w *bytes.Buffer) {
+	diffErrorDescription(fieldPath(path, "ErrorDescription"), a.ErrorDescription, b.ErrorDescription, w)
+}
+
+func equalNetworkPortStatus(a, b NetworkPortStatus) bool {
+	if a.IfName != b.IfName {
+		return false
+	}
+	if a.Name != b.Name {
+		return false
+	}
+	if a.IsMgmt != b.IsMgmt {
+		return false
+	}
+	if a.Free != b.Free {
+		return false
+	}
+	if !equalNetworkObjectConfig(a.NetworkObjectConfig, b.NetworkObjectConfig) {
+		return false
+	}
+	if !equalSliceOfAddrInfo(a.AddrInfoList, b.AddrInfoList) {
+		return false
+	}
+	if !equalProxyConfig(a.ProxyConfig, b.ProxyConfig) {
+		return false
+	}
+	if !equalPtrToWirelessStatus(a.Wireless, b.Wireless) {
+		return false
+	}
+	if a.DhcpFallback != b.DhcpFallback {
+		return false
+	}
+	if !equalPtrToAddrConflict(a.AddrConflict, b.AddrConflict) {
+		return false
+	}
+	if !equalErrorAndTime(a.ErrorAndTime, b.ErrorAndTime) {
+		return false
+	}
+	return true
+}
+
+func diffNetworkPortStatus(path string, a, b NetworkPortStatus, w *bytes.Buffer) {
+	if a.IfName != b.IfName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IfName"), a.IfName, b.IfName)
+	}
+	if a.Name != b.Name {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Name"), a.Name, b.Name)
+	}
+	if a.IsMgmt != b.IsMgmt {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IsMgmt"), a.IsMgmt, b.IsMgmt)
+	}
+	if a.Free != b.Free {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Free"), a.Free, b.Free)
+	}
+	diffNetworkObjectConfig(fieldPath(path, "NetworkObjectConfig"), a.NetworkObjectConfig, b.NetworkObjectConfig, w)
+	diffSliceOfAddrInfo(fieldPath(path, "AddrInfoList"), a.AddrInfoList, b.AddrInfoList, w)
+	diffProxyConfig(fieldPath(path, "ProxyConfig"), a.ProxyConfig, b.ProxyConfig, w)
+	diffPtrToWirelessStatus(fieldPath(path, "Wireless"), a.Wireless, b.Wireless, w)
+	if a.DhcpFallback != b.DhcpFallback {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DhcpFallback"), a.DhcpFallback, b.DhcpFallback)
+	}
+	diffPtrToAddrConflict(fieldPath(path, "AddrConflict"), a.AddrConflict, b.AddrConflict, w)
+	diffErrorAndTime(fieldPath(path, "ErrorAndTime"), a.ErrorAndTime, b.ErrorAndTime, w)
+}
+
+func equalNetworkPortConfig(a, b NetworkPortConfig) bool {
+	if a.IfName != b.IfName {
+		return false
+	}
+	if a.Name != b.Name {
+		return false
+	}
+	if a.IsMgmt != b.IsMgmt {
+		return false
+	}
+	if a.Free != b.Free {
+		return false
+	}
+	if !equalDhcpConfig(a.DhcpConfig, b.DhcpConfig) {
+		return false
+	}
+	if !equalProxyConfig(a.ProxyConfig, b.ProxyConfig) {
+		return false
+	}
+	return true
+}
+
+func diffNetworkPortConfig(path string, a, b NetworkPortConfig, w *bytes.Buffer) {
+	if a.IfName != b.IfName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IfName"), a.IfName, b.IfName)
+	}
+	if a.Name != b.Name {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Name"), a.Name, b.Name)
+	}
+	if a.IsMgmt != b.IsMgmt {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IsMgmt"), a.IsMgmt, b.IsMgmt)
+	}
+	if a.Free != b.Free {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Free"), a.Free, b.Free)
+	}
+	diffDhcpConfig(fieldPath(path, "DhcpConfig"), a.DhcpConfig, b.DhcpConfig, w)
+	diffProxyConfig(fieldPath(path, "ProxyConfig"), a.ProxyConfig, b.ProxyConfig, w)
+}
+
+func equalDiskStatus(a, b DiskStatus) bool {
+	if a.ImageSha256 != b.ImageSha256 {
+		return false
+	}
+	if a.ReadOnly != b.ReadOnly {
+		return false
+	}
+	if a.Preserve != b.Preserve {
+		return false
+	}
+	if a.FileLocation != b.FileLocation {
+		return false
+	}
+	if a.Maxsizebytes != b.Maxsizebytes {
+		return false
+	}
+	if a.Format != b.Format {
+		return false
+	}
+	if a.Devtype != b.Devtype {
+		return false
+	}
+	if a.Vdev != b.Vdev {
+		return false
+	}
+	if a.ActiveFileLocation != b.ActiveFileLocation {
+		return false
+	}
+	if a.Virtio != b.Virtio {
+		return false
+	}
+	if a.Queues != b.Queues {
+		return false
+	}
+	return true
+}
+
+func diffDiskStatus(path string, a, b DiskStatus, w *bytes.Buffer) {
+	if a.ImageSha256 != b.ImageSha256 {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ImageSha256"), a.ImageSha256, b.ImageSha256)
+	}
+	if a.ReadOnly != b.ReadOnly {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ReadOnly"), a.ReadOnly, b.ReadOnly)
+	}
+	if a.Preserve != b.Preserve {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Preserve"), a.Preserve, b.Preserve)
+	}
+	if a.FileLocation != b.FileLocation {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "FileLocation"), a.FileLocation, b.FileLocation)
+	}
+	if a.Maxsizebytes != b.Maxsizebytes {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Maxsizebytes"), a.Maxsizebytes, b.Maxsizebytes)
+	}
+	if a.Format != b.Format {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Format"), a.Format, b.Format)
+	}
+	if a.Devtype != b.Devtype {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Devtype"), a.Devtype, b.Devtype)
+	}
+	if a.Vdev != b.Vdev {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Vdev"), a.Vdev, b.Vdev)
+	}
+	if a.ActiveFileLocation != b.ActiveFileLocation {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ActiveFileLocation"), a.ActiveFileLocation, b.ActiveFileLocation)
+	}
+	if a.Virtio != b.Virtio {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Virtio"), a.Virtio, b.Virtio)
+	}
+	if a.Queues != b.Queues {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Queues"), a.Queues, b.Queues)
+	}
+}
+
+func equalVifInfo(a, b VifInfo) bool {
+	if a.Bridge != b.Bridge {
+		return false
+	}
+	if a.Vif != b.Vif {
+		return false
+	}
+	if a.Mac != b.Mac {
+		return false
+	}
+	if a.Virtio != b.Virtio {
+		return false
+	}
+	if a.Queues != b.Queues {
+		return false
+	}
+	return true
+}
+
+func diffVifInfo(path string, a, b VifInfo, w *bytes.Buffer) {
+	if a.Bridge != b.Bridge {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Bridge"), a.Bridge, b.Bridge)
+	}
+	if a.Vif != b.Vif {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Vif"), a.Vif, b.Vif)
+	}
+	if a.Mac != b.Mac {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Mac"), a.Mac, b.Mac)
+	}
+	if a.Virtio != b.Virtio {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Virtio"), a.Virtio, b.Virtio)
+	}
+	if a.Queues != b.Queues {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Queues"), a.Queues, b.Queues)
+	}
+}
+
+func equalIoAdapter(a, b IoAdapter) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Name != b.Name {
+		return false
+	}
+	return true
+}
+
+func diffIoAdapter(path string, a, b IoAdapter, w *bytes.Buffer) {
+	if a.Type != b.Type {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Type"), a.Type, b.Type)
+	}
+	if a.Name != b.Name {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Name"), a.Name, b.Name)
+	}
+}
+
+func equalErrorDescription(a, b ErrorDescription) bool {
+	if a.Error != b.Error {
+		return false
+	}
+	if !a.ErrorTime.Equal(b.ErrorTime) {
+		return false
+	}
+	if a.ErrorSeverity != b.ErrorSeverity {
+		return false
+	}
+	if a.ErrorCode != b.ErrorCode {
+		return false
+	}
+	if a.ErrorRetryCondition != b.ErrorRetryCondition {
+		return false
+	}
+	return true
+}
+
+func diffErrorDescription(path string, a, b ErrorDescription, w *bytes.Buffer) {
+	if a.Error != b.Error {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Error"), a.Error, b.Error)
+	}
+	if !a.ErrorTime.Equal(b.ErrorTime) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ErrorTime"), a.ErrorTime, b.ErrorTime)
+	}
+	if a.ErrorSeverity != b.ErrorSeverity {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ErrorSeverity"), a.ErrorSeverity, b.ErrorSeverity)
+	}
+	if a.ErrorCode != b.ErrorCode {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ErrorCode"), a.ErrorCode, b.ErrorCode)
+	}
+	if a.ErrorRetryCondition != b.ErrorRetryCondition {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ErrorRetryCondition"), a.ErrorRetryCondition, b.ErrorRetryCondition)
+	}
+}
+
+func equalNetworkObjectConfig(a, b NetworkObjectConfig) bool {
+	if a.UUID != b.UUID {
+		return false
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Dhcp != b.Dhcp {
+		return false
+	}
+	if !equalNetIPNet(a.Subnet, b.Subnet) {
+		return false
+	}
+	if !a.Gateway.Equal(b.Gateway) {
+		return false
+	}
+	if a.DomainName != b.DomainName {
+		return false
+	}
+	if !a.NtpServer.Equal(b.NtpServer) {
+		return false
+	}
+	if !equalSliceOfNetIP(a.DnsServers, b.DnsServers) {
+		return false
+	}
+	if !equalIpRange(a.DhcpRange, b.DhcpRange) {
+		return false
+	}
+	if !equalSliceOfDnsNameToIP(a.DnsNameToIPList, b.DnsNameToIPList) {
+		return false
+	}
+	if !equalPtrToProxyConfig(a.Proxy, b.Proxy) {
+		return false
+	}
+	return true
+}
+
+func diffNetworkObjectConfig(path string, a, b NetworkObjectConfig, w *bytes.Buffer) {
+	if a.UUID != b.UUID {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "UUID"), a.UUID, b.UUID)
+	}
+	if a.Type != b.Type {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Type"), a.Type, b.Type)
+	}
+	if a.Dhcp != b.Dhcp {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Dhcp"), a.Dhcp, b.Dhcp)
+	}
+	diffNetIPNet(fieldPath(path, "Subnet"), a.Subnet, b.Subnet, w)
+	if !a.Gateway.Equal(b.Gateway) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Gateway"), a.Gateway, b.Gateway)
+	}
+	if a.DomainName != b.DomainName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DomainName"), a.DomainName, b.DomainName)
+	}
+	if !a.NtpServer.Equal(b.NtpServer) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "NtpServer"), a.NtpServer, b.NtpServer)
+	}
+	diffSliceOfNetIP(fieldPath(path, "DnsServers"), a.DnsServers, b.DnsServers, w)
+	diffIpRange(fieldPath(path, "DhcpRange"), a.DhcpRange, b.DhcpRange, w)
+	diffSliceOfDnsNameToIP(fieldPath(path, "DnsNameToIPList"), a.DnsNameToIPList, b.DnsNameToIPList, w)
+	diffPtrToProxyConfig(fieldPath(path, "Proxy"), a.Proxy, b.Proxy, w)
+}
+
+func equalSliceOfAddrInfo(a, b []AddrInfo) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalAddrInfo(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfAddrInfo(path string, a, b []AddrInfo, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffAddrInfo(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalProxyConfig(a, b ProxyConfig) bool {
+	if !equalSliceOfProxyEntry(a.Proxies, b.Proxies) {
+		return false
+	}
+	if a.Exceptions != b.Exceptions {
+		return false
+	}
+	if a.Pacfile != b.Pacfile {
+		return false
+	}
+	if a.NetworkProxyEnable != b.NetworkProxyEnable {
+		return false
+	}
+	if a.NetworkProxyURL != b.NetworkProxyURL {
+		return false
+	}
+	if a.WpadURL != b.WpadURL {
+		return false
+	}
+	return true
+}
+
+func diffProxyConfig(path string, a, b ProxyConfig, w *bytes.Buffer) {
+	diffSliceOfProxyEntry(fieldPath(path, "Proxies"), a.Proxies, b.Proxies, w)
+	if a.Exceptions != b.Exceptions {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Exceptions"), a.Exceptions, b.Exceptions)
+	}
+	if a.Pacfile != b.Pacfile {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Pacfile"), a.Pacfile, b.Pacfile)
+	}
+	if a.NetworkProxyEnable != b.NetworkProxyEnable {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "NetworkProxyEnable"), a.NetworkProxyEnable, b.NetworkProxyEnable)
+	}
+	if a.NetworkProxyURL != b.NetworkProxyURL {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "NetworkProxyURL"), a.NetworkProxyURL, b.NetworkProxyURL)
+	}
+	if a.WpadURL != b.WpadURL {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "WpadURL"), a.WpadURL, b.WpadURL)
+	}
+}
+
+func equalPtrToWirelessStatus(a, b *WirelessStatus) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return !(!equalWirelessStatus(*a, *b))
+}
+
+func diffPtrToWirelessStatus(path string, a, b *WirelessStatus, w *bytes.Buffer) {
+	if a == nil || b == nil {
+		if a != b {
+			fmt.Fprintf(w, "%s: %v -> %v\n", path, a, b)
+		}
+		return
+	}
+	diffWirelessStatus(path, *a, *b, w)
+}
+
+func equalPtrToAddrConflict(a, b *AddrConflict) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return !(!equalAddrConflict(*a, *b))
+}
+
+func diffPtrToAddrConflict(path string, a, b *AddrConflict, w *bytes.Buffer) {
+	if a == nil || b == nil {
+		if a != b {
+			fmt.Fprintf(w, "%s: %v -> %v\n", path, a, b)
+		}
+		return
+	}
+	diffAddrConflict(path, *a, *b, w)
+}
+
+func equalDhcpConfig(a, b DhcpConfig) bool {
+	if a.Dhcp != b.Dhcp {
+		return false
+	}
+	if a.AddrSubnet != b.AddrSubnet {
+		return false
+	}
+	if !a.Gateway.Equal(b.Gateway) {
+		return false
+	}
+	if a.DomainName != b.DomainName {
+		return false
+	}
+	if !a.NtpServer.Equal(b.NtpServer) {
+		return false
+	}
+	if !equalSliceOfNetIP(a.DnsServers, b.DnsServers) {
+		return false
+	}
+	if a.DhcpTimeout != b.DhcpTimeout {
+		return false
+	}
+	if a.FallbackAddrSubnet != b.FallbackAddrSubnet {
+		return false
+	}
+	if !a.FallbackGateway.Equal(b.FallbackGateway) {
+		return false
+	}
+	return true
+}
+
+func diffDhcpConfig(path string, a, b DhcpConfig, w *bytes.Buffer) {
+	if a.Dhcp != b.Dhcp {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Dhcp"), a.Dhcp, b.Dhcp)
+	}
+	if a.AddrSubnet != b.AddrSubnet {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "AddrSubnet"), a.AddrSubnet, b.AddrSubnet)
+	}
+	if !a.Gateway.Equal(b.Gateway) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Gateway"), a.Gateway, b.Gateway)
+	}
+	if a.DomainName != b.DomainName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DomainName"), a.DomainName, b.DomainName)
+	}
+	if !a.NtpServer.Equal(b.NtpServer) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "NtpServer"), a.NtpServer, b.NtpServer)
+	}
+	diffSliceOfNetIP(fieldPath(path, "DnsServers"), a.DnsServers, b.DnsServers, w)
+	if a.DhcpTimeout != b.DhcpTimeout {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "DhcpTimeout"), a.DhcpTimeout, b.DhcpTimeout)
+	}
+	if a.FallbackAddrSubnet != b.FallbackAddrSubnet {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "FallbackAddrSubnet"), a.FallbackAddrSubnet, b.FallbackAddrSubnet)
+	}
+	if !a.FallbackGateway.Equal(b.FallbackGateway) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "FallbackGateway"), a.FallbackGateway, b.FallbackGateway)
+	}
+}
+
+func equalNetIPNet(a, b net.IPNet) bool {
+	if !a.IP.Equal(b.IP) {
+		return false
+	}
+	if !equalNetIPMask(a.Mask, b.Mask) {
+		return false
+	}
+	return true
+}
+
+func diffNetIPNet(path string, a, b net.IPNet, w *bytes.Buffer) {
+	if !a.IP.Equal(b.IP) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IP"), a.IP, b.IP)
+	}
+	diffNetIPMask(fieldPath(path, "Mask"), a.Mask, b.Mask, w)
+}
+
+func equalSliceOfNetIP(a, b []net.IP) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfNetIP(path string, a, b []net.IP, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if !a[i].Equal(b[i]) {
+			fmt.Fprintf(w, "%s: %v -> %v\n", fmt.Sprintf("%s[%d]", path, i), a[i], b[i])
+		}
+	}
+}
+
+func equalIpRange(a, b IpRange) bool {
+	if !a.Start.Equal(b.Start) {
+		return false
+	}
+	if !a.End.Equal(b.End) {
+		return false
+	}
+	return true
+}
+
+func diffIpRange(path string, a, b IpRange, w *bytes.Buffer) {
+	if !a.Start.Equal(b.Start) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Start"), a.Start, b.Start)
+	}
+	if !a.End.Equal(b.End) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "End"), a.End, b.End)
+	}
+}
+
+func equalSliceOfDnsNameToIP(a, b []DnsNameToIP) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalDnsNameToIP(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfDnsNameToIP(path string, a, b []DnsNameToIP, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffDnsNameToIP(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalPtrToProxyConfig(a, b *ProxyConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return !(!equalProxyConfig(*a, *b))
+}
+
+func diffPtrToProxyConfig(path string, a, b *ProxyConfig, w *bytes.Buffer) {
+	if a == nil || b == nil {
+		if a != b {
+			fmt.Fprintf(w, "%s: %v -> %v\n", path, a, b)
+		}
+		return
+	}
+	diffProxyConfig(path, *a, *b, w)
+}
+
+func equalAddrInfo(a, b AddrInfo) bool {
+	if !a.Addr.Equal(b.Addr) {
+		return false
+	}
+	if !equalIpinfoIPInfo(a.Geo, b.Geo) {
+		return false
+	}
+	if !a.LastGeoTimestamp.Equal(b.LastGeoTimestamp) {
+		return false
+	}
+	return true
+}
+
+func diffAddrInfo(path string, a, b AddrInfo, w *bytes.Buffer) {
+	if !a.Addr.Equal(b.Addr) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Addr"), a.Addr, b.Addr)
+	}
+	diffIpinfoIPInfo(fieldPath(path, "Geo"), a.Geo, b.Geo, w)
+	if !a.LastGeoTimestamp.Equal(b.LastGeoTimestamp) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "LastGeoTimestamp"), a.LastGeoTimestamp, b.LastGeoTimestamp)
+	}
+}
+
+func equalSliceOfProxyEntry(a, b []ProxyEntry) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalProxyEntry(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffSliceOfProxyEntry(path string, a, b []ProxyEntry, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		diffProxyEntry(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], w)
+	}
+}
+
+func equalWirelessStatus(a, b WirelessStatus) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.SignalStrength != b.SignalStrength {
+		return false
+	}
+	if a.SSID != b.SSID {
+		return false
+	}
+	if a.Operator != b.Operator {
+		return false
+	}
+	if a.IMEI != b.IMEI {
+		return false
+	}
+	if a.ICCID != b.ICCID {
+		return false
+	}
+	if a.RxBytes != b.RxBytes {
+		return false
+	}
+	if a.TxBytes != b.TxBytes {
+		return false
+	}
+	return true
+}
+
+func diffWirelessStatus(path string, a, b WirelessStatus, w *bytes.Buffer) {
+	if a.Type != b.Type {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Type"), a.Type, b.Type)
+	}
+	if a.SignalStrength != b.SignalStrength {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "SignalStrength"), a.SignalStrength, b.SignalStrength)
+	}
+	if a.SSID != b.SSID {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "SSID"), a.SSID, b.SSID)
+	}
+	if a.Operator != b.Operator {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Operator"), a.Operator, b.Operator)
+	}
+	if a.IMEI != b.IMEI {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IMEI"), a.IMEI, b.IMEI)
+	}
+	if a.ICCID != b.ICCID {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "ICCID"), a.ICCID, b.ICCID)
+	}
+	if a.RxBytes != b.RxBytes {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "RxBytes"), a.RxBytes, b.RxBytes)
+	}
+	if a.TxBytes != b.TxBytes {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "TxBytes"), a.TxBytes, b.TxBytes)
+	}
+}
+
+func equalAddrConflict(a, b AddrConflict) bool {
+	if !a.Addr.Equal(b.Addr) {
+		return false
+	}
+	if a.Mac != b.Mac {
+		return false
+	}
+	if !a.Time.Equal(b.Time) {
+		return false
+	}
+	return true
+}
+
+func diffAddrConflict(path string, a, b AddrConflict, w *bytes.Buffer) {
+	if !a.Addr.Equal(b.Addr) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Addr"), a.Addr, b.Addr)
+	}
+	if a.Mac != b.Mac {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Mac"), a.Mac, b.Mac)
+	}
+	if !a.Time.Equal(b.Time) {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Time"), a.Time, b.Time)
+	}
+}
+
+func equalNetIPMask(a, b net.IPMask) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func diffNetIPMask(path string, a, b net.IPMask, w *bytes.Buffer) {
+	if len(a) != len(b) {
+		fmt.Fprintf(w, "%s: length %d -> %d\n", path, len(a), len(b))
+	} else if (a == nil) != (b == nil) {
+		fmt.Fprintf(w, "%s: nil %t -> %t\n", path, a == nil, b == nil)
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			fmt.Fprintf(w, "%s: %v -> %v\n", fmt.Sprintf("%s[%d]", path, i), a[i], b[i])
+		}
+	}
+}
+
+func equalDnsNameToIP(a, b DnsNameToIP) bool {
+	if a.HostName != b.HostName {
+		return false
+	}
+	if !equalSliceOfNetIP(a.IPs, b.IPs) {
+		return false
+	}
+	return true
+}
+
+func diffDnsNameToIP(path string, a, b DnsNameToIP, w *bytes.Buffer) {
+	if a.HostName != b.HostName {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "HostName"), a.HostName, b.HostName)
+	}
+	diffSliceOfNetIP(fieldPath(path, "IPs"), a.IPs, b.IPs, w)
+}
+
+func equalIpinfoIPInfo(a, b ipinfo.IPInfo) bool {
+	if a.IP != b.IP {
+		return false
+	}
+	if a.Hostname != b.Hostname {
+		return false
+	}
+	if a.City != b.City {
+		return false
+	}
+	if a.Region != b.Region {
+		return false
+	}
+	if a.Country != b.Country {
+		return false
+	}
+	if a.Loc != b.Loc {
+		return false
+	}
+	if a.Org != b.Org {
+		return false
+	}
+	if a.Postal != b.Postal {
+		return false
+	}
+	return true
+}
+
+func diffIpinfoIPInfo(path string, a, b ipinfo.IPInfo, w *bytes.Buffer) {
+	if a.IP != b.IP {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "IP"), a.IP, b.IP)
+	}
+	if a.Hostname != b.Hostname {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Hostname"), a.Hostname, b.Hostname)
+	}
+	if a.City != b.City {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "City"), a.City, b.City)
+	}
+	if a.Region != b.Region {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Region"), a.Region, b.Region)
+	}
+	if a.Country != b.Country {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Country"), a.Country, b.Country)
+	}
+	if a.Loc != b.Loc {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Loc"), a.Loc, b.Loc)
+	}
+	if a.Org != b.Org {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Org"), a.Org, b.Org)
+	}
+	if a.Postal != b.Postal {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Postal"), a.Postal, b.Postal)
+	}
+}
+
+func equalProxyEntry(a, b ProxyEntry) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Server != b.Server {
+		return false
+	}
+	if a.Port != b.Port {
+		return false
+	}
+	if a.UseTLS != b.UseTLS {
+		return false
+	}
+	if a.Username != b.Username {
+		return false
+	}
+	if a.Password != b.Password {
+		return false
+	}
+	if a.AuthType != b.AuthType {
+		return false
+	}
+	return true
+}
+
+func diffProxyEntry(path string, a, b ProxyEntry, w *bytes.Buffer) {
+	if a.Type != b.Type {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Type"), a.Type, b.Type)
+	}
+	if a.Server != b.Server {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Server"), a.Server, b.Server)
+	}
+	if a.Port != b.Port {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Port"), a.Port, b.Port)
+	}
+	if a.UseTLS != b.UseTLS {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "UseTLS"), a.UseTLS, b.UseTLS)
+	}
+	if a.Username != b.Username {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "Username"), a.Username, b.Username)
+	}
+	if a.Password != b.Password {
+		fmt.Fprintf(w, "%s: <redacted> changed\n", fieldPath(path, "Password"))
+	}
+	if a.AuthType != b.AuthType {
+		fmt.Fprintf(w, "%s: %v -> %v\n", fieldPath(path, "AuthType"), a.AuthType, b.AuthType)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eriknordmark/ipinfo"
+)
+
+func testDNS() DeviceNetworkStatus {
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	port := NetworkPortStatus{IfName: "eth0", IsMgmt: true,
+		AddrInfoList: []AddrInfo{{Addr: net.ParseIP("192.168.1.10"),
+			Geo: ipinfo.IPInfo{City: "Boston"}}}}
+	port.DnsServers = []net.IP{net.ParseIP("8.8.8.8")}
+	return DeviceNetworkStatus{Version: DPCIsMgmt, DPCKey: "zedagent",
+		TimePriority: now, Ports: []NetworkPortStatus{port}}
+}
+
+func TestDeviceNetworkStatusEqual(t *testing.T) {
+	a := testDNS()
+	b := testDNS()
+	if !a.Equal(b) || a.Diff(b) != "" {
+		t.Fatalf("Expected equal got %s", a.Diff(b))
+	}
+
+	// Same IP and time in other forms are equal, as with cmp
+	b.Ports[0].AddrInfoList[0].Addr = net.ParseIP("192.168.1.10").To4()
+	b.TimePriority = a.TimePriority.In(time.FixedZone("EST", -5*3600))
+	if !a.Equal(b) {
+		t.Errorf("Expected equal got %s", a.Diff(b))
+	}
+
+	b.Ports[0].AddrInfoList[0].Geo.City = "Paris"
+	if a.Equal(b) {
+		t.Errorf("Expected not equal")
+	}
+	diff := a.Diff(b)
+	if diff != "Ports[0].AddrInfoList[0].Geo.City: Boston -> Paris\n" {
+		t.Errorf("Got diff %q", diff)
+	}
+
+	// nil and empty differ
+	b = testDNS()
+	b.Ports[0].DnsServers = []net.IP{}
+	if a.Equal(b) || !strings.Contains(a.Diff(b), "DnsServers") {
+		t.Errorf("Expected DnsServers to differ: %s", a.Diff(b))
+	}
+
+	b = testDNS()
+	b.Ports[0].Proxy = &ProxyConfig{Exceptions: "example.com"}
+	if a.Equal(b) || !strings.Contains(a.Diff(b), "Ports[0].NetworkObjectConfig.Proxy") {
+		t.Errorf("Expected Proxy to differ: %s", a.Diff(b))
+	}
+
+	b = testDNS()
+	b.Ports = append(b.Ports, NetworkPortStatus{IfName: "eth1"})
+	if a.Equal(b) || a.Diff(b) != "Ports: length 1 -> 2\n" {
+		t.Errorf("Got diff %q", a.Diff(b))
+	}
+}
+
+func TestProxyPasswordRedacted(t *testing.T) {
+	proxy := ProxyEntry{Type: NPT_HTTP, Server: "proxy", Port: 8080,
+		Username: "user", Password: "secret1"}
+	port := NetworkPortConfig{IfName: "eth0", IsMgmt: true}
+	port.Proxies = []ProxyEntry{proxy}
+	a := DevicePortConfig{Version: DPCIsMgmt, Ports: []NetworkPortConfig{port}}
+	b := DevicePortConfig{Version: DPCIsMgmt,
+		Ports: []NetworkPortConfig{port}}
+	b.Ports[0].Proxies = []ProxyEntry{proxy}
+	b.Ports[0].Proxies[0].Password = "secret2"
+	if a.Equal(b) {
+		t.Fatalf("Expected not equal")
+	}
+	diff := a.Diff(b)
+	if strings.Contains(diff, "secret") {
+		t.Errorf("Password in diff %q", diff)
+	}
+	if diff != "Ports[0].ProxyConfig.Proxies[0].Password: <redacted> changed\n" {
+		t.Errorf("Got diff %q", diff)
+	}
+}
@@ -69,6 +69,9 @@ type VmConfig struct {
 	EnableVnc          bool
 	VncDisplay         uint32
 	VncPasswd          string
+	// IO threads for the virtio disks; HVM only
+	IOThreads    int    // default 0; the disks use the main loop
+	IOThreadCPUs string // default "", list of "2,3" to pin the IO threads
 }
 
 type VmMode uint8
@@ -98,9 +101,9 @@ type DomainStatus struct {
 	EnableVnc          bool
 	VncDisplay         uint32
 	VncPasswd          string
+	IOThreadCPUs       string // From config
 	TriedCount         int
-	LastErr            string // Xen error
-	LastErrTime        time.Time
+	ErrorAndTime       // Xen error
 	BootFailed         bool
 	AdaptersFailed     bool
 }
@@ -139,6 +142,8 @@ type VifInfo struct {
 	Bridge string
 	Vif    string
 	Mac    string
+	Virtio bool // HVM only; virtio-net instead of the emulated NIC
+	Queues int  // virtio-net queues; default 0 is one
 }
 
 // XenManager will pass these to the xen xl config file
@@ -154,6 +159,8 @@ type DiskConfig struct {
 	Maxsizebytes uint64 // Resize filesystem to this size if set
 	Format       string // Default "raw"; could be raw, qcow, qcow2, vhd
 	Devtype      string // Default ""; could be e.g. "cdrom"
+	Virtio       bool   // HVM only; virtio-blk instead of xvd
+	Queues       int    // virtio-blk queues; default 0 is one
 }
 
 type DiskStatus struct {
@@ -166,6 +173,8 @@ type DiskStatus struct {
 	Devtype            string // From config
 	Vdev               string // Allocated
 	ActiveFileLocation string // Allocated; private copy if RW; FileLocation if RO
+	Virtio             bool   // From config
+	Queues             int    // From config
 }
 
 // Track the active image files in rwImgDirname
@@ -180,3 +189,69 @@ type ImageStatus struct {
 func (status ImageStatus) Key() string {
 	return status.Filename
 }
+
+// DiskMetric is the size of an image file
+type DiskMetric struct {
+	DiskPath         string
+	Format           string
+	ProvisionedBytes uint64 // Virtual size
+	UsedBytes        uint64 // Allocated on the filesystem
+	Dirty            bool
+}
+
+// AppDiskMetric is the disks of an app instance, published by domainmgr
+// with the app instance UUID as key
+type AppDiskMetric struct {
+	UUIDandVersion   UUIDandVersion
+	DisplayName      string
+	DomainName       string
+	DiskMetrics      []DiskMetric
+	ProvisionedBytes uint64 // Sum over the disks
+	UsedBytes        uint64
+}
+
+func (metric AppDiskMetric) Key() string {
+	return metric.UUIDandVersion.UUID.String()
+}
+
+// DiskUsage is the images in the image directories, published by
+// domainmgr with key "global"
+type DiskUsage struct {
+	DirUsage         []DirDiskUsage
+	ProvisionedBytes uint64 // Sum over the directories
+	UsedBytes        uint64
+	IOStats          []DiskIOStats
+}
+
+func (usage DiskUsage) Key() string {
+	return "global"
+}
+
+// DirDiskUsage is the sum over the images in a directory tree
+type DirDiskUsage struct {
+	Dirname          string
+	ImageCount       int
+	ProvisionedBytes uint64
+	UsedBytes        uint64
+}
+
+// DiskIOStats is the I/O counters of a block device from /proc/diskstats
+// and the rates since the previous sample
+type DiskIOStats struct {
+	DevName          string
+	SampleTime       time.Time
+	ReadCount        uint64 // Completed reads
+	ReadBytes        uint64
+	ReadTimeMs       uint64 // Spent on reads
+	WriteCount       uint64
+	WriteBytes       uint64
+	WriteTimeMs      uint64
+	InFlight         uint64 // Requests in the queue
+	IOTimeMs         uint64 // Device busy
+	QueueTimeMs      uint64 // Weighted by the number in flight
+	ReadsPerSec      float64
+	WritesPerSec     float64
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+	UtilPercent      float64 // Device busy over the interval
+}
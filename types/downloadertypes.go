@@ -65,8 +65,7 @@ type DownloaderStatus struct {
 	Size             uint64  // Once DOWNLOADED; in bytes
 	Progress         uint    // In percent i.e., 0-100
 	ModTime          time.Time
-	LastErr          string // Download error
-	LastErrTime      time.Time
+	ErrorAndTime     // Download error
 	RetryCount       int
 }
 
@@ -0,0 +1,88 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrorSeverity tells the controller how to present an error
+type ErrorSeverity uint8
+
+const (
+	ErrorSeverityUnspecified ErrorSeverity = iota
+	ErrorSeverityNotice                    // Informational; no action needed
+	ErrorSeverityWarning                   // Degraded but working
+	ErrorSeverityError                     // The operation failed
+)
+
+func (severity ErrorSeverity) String() string {
+	switch severity {
+	case ErrorSeverityUnspecified:
+		return "Unspecified"
+	case ErrorSeverityNotice:
+		return "Notice"
+	case ErrorSeverityWarning:
+		return "Warning"
+	case ErrorSeverityError:
+		return "Error"
+	default:
+		return fmt.Sprintf("Unknown ErrorSeverity %d", severity)
+	}
+}
+
+// ErrorDescription is an error with when it happened, how severe it is,
+// an agent specific code, and when it will be retried if at all
+type ErrorDescription struct {
+	Error               string
+	ErrorTime           time.Time
+	ErrorSeverity       ErrorSeverity
+	ErrorCode           int    // Agent specific; zero if unset
+	ErrorRetryCondition string // E.g., "Retrying in 10 minutes"
+}
+
+// ErrorAndTime is embedded in the status structs. The field names are
+// promoted hence status.Error and status.ErrorTime work as before.
+type ErrorAndTime struct {
+	ErrorDescription
+}
+
+// SetErrorNow records the error with the current time
+func (et *ErrorAndTime) SetErrorNow(errStr string) {
+	et.SetError(errStr, time.Now())
+}
+
+// SetError records the error with the time
+func (et *ErrorAndTime) SetError(errStr string, errTime time.Time) {
+	et.ErrorDescription = ErrorDescription{
+		Error:     errStr,
+		ErrorTime: errTime,
+	}
+	if errStr != "" {
+		et.ErrorSeverity = ErrorSeverityError
+	}
+}
+
+// SetErrorDescription records the error with its severity, code and
+// retry condition. The time is set to now if zero.
+func (et *ErrorAndTime) SetErrorDescription(desc ErrorDescription) {
+	if desc.ErrorTime.IsZero() {
+		desc.ErrorTime = time.Now()
+	}
+	if desc.ErrorSeverity == ErrorSeverityUnspecified {
+		desc.ErrorSeverity = ErrorSeverityError
+	}
+	et.ErrorDescription = desc
+}
+
+// ClearError removes the error
+func (et *ErrorAndTime) ClearError() {
+	et.ErrorDescription = ErrorDescription{}
+}
+
+// HasError is true if an error is set
+func (et ErrorAndTime) HasError() bool {
+	return !et.ErrorTime.IsZero()
+}
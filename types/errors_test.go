@@ -0,0 +1,47 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestErrorAndTime(t *testing.T) {
+	var status DomainStatus
+	if status.HasError() {
+		t.Errorf("Unexpected error %+v", status.ErrorDescription)
+	}
+	status.SetErrorNow("xl create failed")
+	if !status.HasError() || status.Error != "xl create failed" ||
+		status.ErrorSeverity != ErrorSeverityError {
+		t.Errorf("Got %+v", status.ErrorDescription)
+	}
+	status.SetErrorDescription(ErrorDescription{Error: "low memory",
+		ErrorSeverity: ErrorSeverityWarning, ErrorCode: 12,
+		ErrorRetryCondition: "Retrying in 10 minutes"})
+	if status.ErrorTime.IsZero() || status.ErrorSeverity.String() != "Warning" {
+		t.Errorf("Got %+v", status.ErrorDescription)
+	}
+	status.ClearError()
+	if status.HasError() || status.Error != "" || status.ErrorCode != 0 {
+		t.Errorf("Got %+v after clear", status.ErrorDescription)
+	}
+
+	// The fields are flattened in the json as before
+	when := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	status.SetError("failed", when)
+	b, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["Error"] != "failed" || m["ErrorTime"] != "2019-05-01T12:00:00Z" {
+		t.Errorf("Got %s", b)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Generate Equal and Diff methods for the status structs which change
+// often so that the handlers do not pay for cmp.Equal and cmp.Diff.
+// The semantics match cmp: an Equal method of a field's type is used,
+// and nil and empty slices and maps differ.
+// Run with "go generate" in the types directory.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/zededa/go-provision/types"
+)
+
+const outputFile = "deepequal_generated.go"
+
+// The structs which get Equal and Diff methods
+var roots = []interface{}{
+	types.DeviceNetworkStatus{},
+	types.DevicePortConfig{},
+	types.DevicePortConfigList{},
+	types.DomainStatus{},
+}
+
+var typesPkg = reflect.TypeOf(types.DeviceNetworkStatus{}).PkgPath()
+
+// Secrets; Diff only reports that they changed
+var redactedFields = map[string]bool{
+	"ProxyEntry.Password": true,
+}
+
+type generator struct {
+	rootTypes map[reflect.Type]bool
+	done      map[reflect.Type]bool
+	pending   []reflect.Type
+	imports   map[string]bool
+	helpers   bytes.Buffer
+}
+
+func main() {
+	g := generator{
+		rootTypes: make(map[reflect.Type]bool),
+		done:      make(map[reflect.Type]bool),
+		imports:   map[string]bool{"bytes": true},
+	}
+	for _, r := range roots {
+		g.rootTypes[reflect.TypeOf(r)] = true
+	}
+	var methods bytes.Buffer
+	for _, r := range roots {
+		t := reflect.TypeOf(r)
+		g.need(t)
+		fmt.Fprintf(&methods, `
+// Equal is true if all fields are equal
+func (a %[1]s) Equal(b %[1]s) bool {
+	return %[2]s(a, b)
+}
+
+// Diff returns a line per field which differs
+func (a %[1]s) Diff(b %[1]s) string {
+	var w bytes.Buffer
+	%[3]s("", a, b, &w)
+	return w.String()
+}
+`, t.Name(), equalFunc(t), diffFunc(t))
+	}
+	for len(g.pending) != 0 {
+		t := g.pending[0]
+		g.pending = g.pending[1:]
+		g.genHelpers(t)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by gendeepequal; DO NOT EDIT.\n\n")
+	out.WriteString("package types\n\nimport (\n")
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	// Standard library first
+	for _, std := range []bool{true, false} {
+		if !std {
+			out.WriteString("\n")
+		}
+		for _, imp := range imports {
+			if strings.Contains(strings.Split(imp, "/")[0], ".") != std {
+				fmt.Fprintf(&out, "\t%q\n", imp)
+			}
+		}
+	}
+	out.WriteString(")\n")
+	out.Write(methods.Bytes())
+	out.Write(g.helpers.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatalf("format: %s\n%s", err, out.String())
+	}
+	if err := ioutil.WriteFile(outputFile, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// need queues the helpers for t
+func (g *generator) need(t reflect.Type) {
+	if !g.done[t] {
+		g.done[t] = true
+		g.pending = append(g.pending, t)
+	}
+}
+
+// typeName is how t is written in the types package
+func (g *generator) typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == typesPkg {
+			return t.Name()
+		}
+		if t.PkgPath() != "" {
+			g.imports[importPath(t.PkgPath())] = true
+		}
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.typeName(t.Elem()))
+	case reflect.Ptr:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// importPath drops the vendor prefix
+func importPath(pkgPath string) string {
+	if i := strings.LastIndex(pkgPath, "/vendor/"); i >= 0 {
+		return pkgPath[i+len("/vendor/"):]
+	}
+	return pkgPath
+}
+
+// helperName is unique per type and usable in a function name
+func helperName(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == typesPkg {
+			return t.Name()
+		}
+		parts := strings.Split(t.String(), ".")
+		return strings.Title(parts[0]) + parts[1]
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return "SliceOf" + helperName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("Array%dOf%s", t.Len(), helperName(t.Elem()))
+	case reflect.Ptr:
+		return "PtrTo" + helperName(t.Elem())
+	case reflect.Map:
+		return "MapOf" + helperName(t.Key()) + "To" + helperName(t.Elem())
+	}
+	return strings.Title(t.String())
+}
+
+func equalFunc(t reflect.Type) string {
+	return "equal" + helperName(t)
+}
+
+func diffFunc(t reflect.Type) string {
+	return "diff" + helperName(t)
+}
+
+// hasEqual is true if t has an Equal(t) bool method. The roots are
+// treated as having one whether or not it has been generated yet.
+func (g *generator) hasEqual(t reflect.Type) bool {
+	if g.rootTypes[t] {
+		return true
+	}
+	if t.PkgPath() == typesPkg {
+		return false
+	}
+	m, ok := t.MethodByName("Equal")
+	if !ok {
+		return false
+	}
+	mt := m.Type
+	return mt.NumIn() == 2 && mt.In(1) == t && mt.NumOut() == 1 &&
+		mt.Out(0).Kind() == reflect.Bool
+}
+
+func isBasic(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isBasic(t.Elem())
+	}
+	return false
+}
+
+// opaque is true for structs from other packages with unexported fields
+// and for interfaces; those are compared with reflect.DeepEqual
+func opaque(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Func, reflect.Chan:
+		return true
+	case reflect.Struct:
+		if t.PkgPath() == typesPkg {
+			return false
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notEqual returns an expression which is true if a and b differ
+func (g *generator) notEqual(t reflect.Type, a string, b string) string {
+	switch {
+	case g.hasEqual(t):
+		return fmt.Sprintf("!%s.Equal(%s)", a, b)
+	case isBasic(t):
+		return fmt.Sprintf("%s != %s", a, b)
+	case opaque(t):
+		g.imports["reflect"] = true
+		return fmt.Sprintf("!reflect.DeepEqual(%s, %s)", a, b)
+	}
+	g.need(t)
+	return fmt.Sprintf("!%s(%s, %s)", equalFunc(t), a, b)
+}
+
+// diffStmt returns the statements writing the differences of a and b
+func (g *generator) diffStmt(t reflect.Type, path string, a string,
+	b string) string {
+
+	if isBasic(t) || opaque(t) || (g.hasEqual(t) && !g.rootTypes[t]) {
+		g.imports["fmt"] = true
+		return fmt.Sprintf(`if %s {
+	fmt.Fprintf(w, "%%s: %%v -> %%v\n", %s, %s, %s)
+}
+`, g.notEqual(t, a, b), path, a, b)
+	}
+	g.need(t)
+	return fmt.Sprintf("%s(%s, %s, %s, w)\n", diffFunc(t), path, a, b)
+}
+
+func (g *generator) genHelpers(t reflect.Type) {
+	name := g.typeName(t)
+	w := &g.helpers
+	switch t.Kind() {
+	case reflect.Struct:
+		fmt.Fprintf(w, "\nfunc %s(a, b %s) bool {\n", equalFunc(t), name)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(w, "if %s {\nreturn false\n}\n",
+				g.notEqual(f.Type, "a."+f.Name, "b."+f.Name))
+		}
+		fmt.Fprintf(w, "return true\n}\n")
+
+		fmt.Fprintf(w, "\nfunc %s(path string, a, b %s, w *bytes.Buffer) {\n",
+			diffFunc(t), name)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			path := fmt.Sprintf("fieldPath(path, %q)", f.Name)
+			if redactedFields[t.Name()+"."+f.Name] {
+				g.imports["fmt"] = true
+				fmt.Fprintf(w, `if %s {
+	fmt.Fprintf(w, "%%s: <redacted> changed\n", %s)
+}
+`, g.notEqual(f.Type, "a."+f.Name, "b."+f.Name), path)
+				continue
+			}
+			w.WriteString(g.diffStmt(f.Type, path,
+				"a."+f.Name, "b."+f.Name))
+		}
+		fmt.Fprintf(w, "}\n")
+
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(w, "\nfunc %s(a, b %s) bool {\n", equalFunc(t), name)
+		if t.Kind() == reflect.Slice {
+			fmt.Fprintf(w, "if (a == nil) != (b == nil) || len(a) != len(b) {\nreturn false\n}\n")
+		}
+		fmt.Fprintf(w, "for i := range a {\nif %s {\nreturn false\n}\n}\nreturn true\n}\n",
+			g.notEqual(t.Elem(), "a[i]", "b[i]"))
+
+		g.imports["fmt"] = true
+		fmt.Fprintf(w, "\nfunc %s(path string, a, b %s, w *bytes.Buffer) {\n",
+			diffFunc(t), name)
+		if t.Kind() == reflect.Slice {
+			fmt.Fprintf(w, `if len(a) != len(b) {
+	fmt.Fprintf(w, "%%s: length %%d -> %%d\n", path, len(a), len(b))
+} else if (a == nil) != (b == nil) {
+	fmt.Fprintf(w, "%%s: nil %%t -> %%t\n", path, a == nil, b == nil)
+}
+`)
+		}
+		fmt.Fprintf(w, "for i := 0; i < len(a) && i < len(b); i++ {\n%s}\n}\n",
+			g.diffStmt(t.Elem(), `fmt.Sprintf("%s[%d]", path, i)`,
+				"a[i]", "b[i]"))
+
+	case reflect.Ptr:
+		fmt.Fprintf(w, "\nfunc %s(a, b %s) bool {\n", equalFunc(t), name)
+		fmt.Fprintf(w, "if a == nil || b == nil {\nreturn a == b\n}\nreturn !(%s)\n}\n",
+			g.notEqual(t.Elem(), "*a", "*b"))
+
+		g.imports["fmt"] = true
+		fmt.Fprintf(w, "\nfunc %s(path string, a, b %s, w *bytes.Buffer) {\n",
+			diffFunc(t), name)
+		fmt.Fprintf(w, `if a == nil || b == nil {
+	if a != b {
+		fmt.Fprintf(w, "%%s: %%v -> %%v\n", path, a, b)
+	}
+	return
+}
+%s}
+`, g.diffStmt(t.Elem(), "path", "*a", "*b"))
+
+	case reflect.Map:
+		fmt.Fprintf(w, "\nfunc %s(a, b %s) bool {\n", equalFunc(t), name)
+		fmt.Fprintf(w, `if (a == nil) != (b == nil) || len(a) != len(b) {
+	return false
+}
+for k, va := range a {
+	vb, ok := b[k]
+	if !ok || %s {
+		return false
+	}
+}
+return true
+}
+`, g.notEqual(t.Elem(), "va", "vb"))
+
+		g.imports["fmt"] = true
+		fmt.Fprintf(w, "\nfunc %s(path string, a, b %s, w *bytes.Buffer) {\n",
+			diffFunc(t), name)
+		fmt.Fprintf(w, `for k, va := range a {
+	p := fmt.Sprintf("%%s[%%v]", path, k)
+	vb, ok := b[k]
+	if !ok {
+		fmt.Fprintf(w, "%%s: removed\n", p)
+		continue
+	}
+	%s}
+for k := range b {
+	if _, ok := a[k]; !ok {
+		fmt.Fprintf(w, "%%s[%%v]: added\n", path, k)
+	}
+}
+}
+`, g.diffStmt(t.Elem(), "p", "va", "vb"))
+
+	default:
+		log.Fatalf("Unsupported type %s\n", t)
+	}
+}
@@ -5,8 +5,13 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/pubsub"
@@ -30,6 +35,7 @@ type GlobalConfig struct {
 	ResetIfCloudGoneTime    uint32 // reboot if no cloud connectivity
 	FallbackIfCloudGoneTime uint32 // ... and shorter during update
 	MintimeUpdateSuccess    uint32 // time before zedagent declares success
+	UpdateCheckWindow       uint32 // ... and then for health checks to pass
 	StaleConfigTime         uint32 // On reboot use saved config if not stale
 	DownloadGCTime          uint32 // Garbage collect if no use
 	VdiskGCTime             uint32 // Garbage collect RW disk if no use
@@ -45,6 +51,12 @@ type GlobalConfig struct {
 	NetworkTestBetterInterval uint32   // Look for better DevicePortConfig
 	NetworkFallbackAnyEth     TriState // When no connectivity try any Ethernet; XXX LTE?
 
+	// Timeouts for requests to zedcloud: In seconds
+	NetworkConnectTimeout        uint32 // TCP connect to zedcloud or proxy
+	NetworkTLSHandshakeTimeout   uint32
+	NetworkResponseHeaderTimeout uint32 // Wait for response after sending
+	NetworkSendTimeout           uint32 // Total including the response body
+
 	// UsbAccess
 	// Determines if Dom0 can use USB devices.
 	// If false:
@@ -59,6 +71,57 @@ type GlobalConfig struct {
 	AllowAppVnc           bool
 	DefaultLogLevel       string
 	DefaultRemoteLogLevel string
+
+	// Source prefixes allowed to use ssh and VNC when enabled; empty
+	// means any source
+	SshAllowedPrefixes []string
+	VncAllowedPrefixes []string
+	// New ssh connections per minute per source; zero means no limit
+	SshRateLimit uint32
+
+	// ICMP echo and ICMPv6 router advertisements to the device on the
+	// uplinks (Mgmt) and on the app network instance bridges (App)
+	IcmpEchoMgmt TriState
+	IcmpEchoApp  TriState
+	Icmpv6RaMgmt TriState
+	Icmpv6RaApp  TriState
+	// Packets rejected on the uplinks logged per minute per reject rule;
+	// zero means no logging
+	RejectLogRate uint32
+
+	// Remote console sessions: In seconds; zero means no limit
+	RemoteConsoleMaxDuration uint32
+	RemoteConsoleIdleTimeout uint32
+	// Remote console bandwidth: In bytes per second; zero means no limit
+	RemoteConsoleRxRate uint32 // From the controller
+	RemoteConsoleTxRate uint32 // To the controller
+
+	// How to treat the OCSP response stapled by zedcloud
+	OCSPPolicy OCSPPolicy
+
+	// Conntrack table pressure. When the table is more than
+	// ConntrackWarnPercent full zedrouter warns and, if set, raises
+	// nf_conntrack_max to ConntrackMax and deletes the TCP flows which
+	// have been idle for ConntrackEvictTimeout seconds.
+	ConntrackWarnPercent  uint32
+	ConntrackMax          uint32
+	ConntrackEvictTimeout uint32
+
+	// Percent used of /persist and /config at which zedagent raises a
+	// warning or critical alarm. If StorageCleanup is enabled old logs
+	// and unused app images are removed when critical.
+	StorageWarnPercent     uint32
+	StorageCriticalPercent uint32
+	StorageCleanup         TriState
+
+	// How apps on a NAT network instance are told that the uplink
+	// used for their traffic changed
+	UplinkChangeNotify UplinkChangeNotify
+	// Hand out the bridge IP as DNS and NTP server on local network
+	// instances and relay those upstream via the uplink of the instance
+	LocalDnsNtpProxy TriState
+	// Audit trail of the objects each agent publishes; see agentlog
+	ObjectEventLog TriState
 	// XXX add max space for downloads?
 	// XXX add LTE management port usage policy?
 
@@ -67,6 +130,130 @@ type GlobalConfig struct {
 	AgentSettings map[string]PerAgentSettings
 }
 
+// OCSPPolicy determines whether a missing or bad stapled OCSP response
+// fails the connection to zedcloud (and sets LED 13), is logged as a
+// warning, or is not checked at all.
+type OCSPPolicy uint8
+
+const (
+	OCSP_NONE OCSPPolicy = iota // Use default
+	OCSP_OFF
+	OCSP_SOFT_FAIL
+	OCSP_REQUIRE
+)
+
+func ParseOCSPPolicy(value string) (OCSPPolicy, error) {
+	var policy OCSPPolicy
+
+	switch value {
+	case "none":
+		policy = OCSP_NONE
+	case "off", "disabled":
+		policy = OCSP_OFF
+	case "soft-fail", "warn":
+		policy = OCSP_SOFT_FAIL
+	case "require-staple", "require":
+		policy = OCSP_REQUIRE
+	default:
+		err := errors.New(fmt.Sprintf("Bad value: %s", value))
+		return policy, err
+	}
+	return policy, nil
+}
+
+func (policy OCSPPolicy) String() string {
+	switch policy {
+	case OCSP_NONE:
+		return "none"
+	case OCSP_OFF:
+		return "off"
+	case OCSP_SOFT_FAIL:
+		return "soft-fail"
+	case OCSP_REQUIRE:
+		return "require-staple"
+	default:
+		return fmt.Sprintf("Unknown OCSPPolicy %d", policy)
+	}
+}
+
+// UplinkChangeNotify selects how app instances are told that the uplink
+// of their network instance changed, so that NAT-sensitive apps can
+// re-establish their sessions.
+type UplinkChangeNotify uint8
+
+const (
+	UCN_NONE UplinkChangeNotify = iota // Use default
+	UCN_OFF
+	UCN_FORCERENEW // DHCP FORCERENEW to each app
+	UCN_RA         // Restart radvd to send router advertisements
+	UCN_EVENT      // Publish an AppNetworkEvent
+)
+
+func ParseUplinkChangeNotify(value string) (UplinkChangeNotify, error) {
+	var notify UplinkChangeNotify
+
+	switch value {
+	case "none":
+		notify = UCN_NONE
+	case "off", "disabled":
+		notify = UCN_OFF
+	case "forcerenew":
+		notify = UCN_FORCERENEW
+	case "ra":
+		notify = UCN_RA
+	case "event":
+		notify = UCN_EVENT
+	default:
+		err := errors.New(fmt.Sprintf("Bad value: %s", value))
+		return notify, err
+	}
+	return notify, nil
+}
+
+func (notify UplinkChangeNotify) String() string {
+	switch notify {
+	case UCN_NONE:
+		return "none"
+	case UCN_OFF:
+		return "off"
+	case UCN_FORCERENEW:
+		return "forcerenew"
+	case UCN_RA:
+		return "ra"
+	case UCN_EVENT:
+		return "event"
+	default:
+		return fmt.Sprintf("Unknown UplinkChangeNotify %d", notify)
+	}
+}
+
+// ParsePrefixList parses a comma-separated list of addresses and CIDR
+// prefixes, returning them as prefixes
+func ParsePrefixList(value string) ([]string, error) {
+	var prefixes []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, ipnet, err := net.ParseCIDR(s); err == nil {
+			prefixes = append(prefixes, ipnet.String())
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			err := errors.New(fmt.Sprintf("Bad prefix: %s", s))
+			return nil, err
+		}
+		if ip.To4() != nil {
+			prefixes = append(prefixes, ip.String()+"/32")
+		} else {
+			prefixes = append(prefixes, ip.String()+"/128")
+		}
+	}
+	return prefixes, nil
+}
+
 type PerAgentSettings struct {
 	LogLevel       string // What we log to files
 	RemoteLogLevel string // What we log to zedcloud
@@ -88,6 +275,7 @@ var GlobalConfigDefaults = GlobalConfig{
 	ResetIfCloudGoneTime:    7 * 24 * 3600,
 	FallbackIfCloudGoneTime: 300,
 	MintimeUpdateSuccess:    600,
+	UpdateCheckWindow:       300,
 
 	NetworkGeoRedoTime:        3600, // 1 hour
 	NetworkGeoRetryTime:       600,  // 10 minutes
@@ -96,6 +284,16 @@ var GlobalConfigDefaults = GlobalConfig{
 	NetworkTestBetterInterval: 0,   // Disabled
 	NetworkFallbackAnyEth:     TS_ENABLED,
 
+	NetworkConnectTimeout:        10,
+	NetworkTLSHandshakeTimeout:   10,
+	NetworkResponseHeaderTimeout: 15,
+	NetworkSendTimeout:           15,
+
+	IcmpEchoMgmt: TS_ENABLED,
+	IcmpEchoApp:  TS_ENABLED,
+	Icmpv6RaMgmt: TS_ENABLED,
+	Icmpv6RaApp:  TS_ENABLED,
+
 	UsbAccess:             true,   // Contoller likely to default to false
 	SshAccess:             true,   // Contoller likely to default to false
 	StaleConfigTime:       600,    // Use stale config for up to 10 minutes
@@ -105,6 +303,18 @@ var GlobalConfigDefaults = GlobalConfig{
 	DomainBootRetryTime:   600,    // 10 minutes
 	DefaultLogLevel:       "info", // XXX Should we change to warning?
 	DefaultRemoteLogLevel: "info", // XXX Should we change to warning?
+	// XXX zedcloud does not staple OCSP responses yet
+	OCSPPolicy: OCSP_OFF,
+
+	ConntrackWarnPercent: 80,
+
+	StorageWarnPercent:     80,
+	StorageCriticalPercent: 95,
+	StorageCleanup:         TS_DISABLED,
+
+	UplinkChangeNotify: UCN_OFF,
+	LocalDnsNtpProxy:   TS_DISABLED,
+	ObjectEventLog:     TS_DISABLED,
 }
 
 // Check which values are set and which should come from defaults
@@ -126,6 +336,9 @@ func ApplyGlobalConfig(newgc GlobalConfig) GlobalConfig {
 	if newgc.MintimeUpdateSuccess == 0 {
 		newgc.MintimeUpdateSuccess = GlobalConfigDefaults.MintimeUpdateSuccess
 	}
+	if newgc.UpdateCheckWindow == 0 {
+		newgc.UpdateCheckWindow = GlobalConfigDefaults.UpdateCheckWindow
+	}
 	if newgc.NetworkGeoRedoTime == 0 {
 		newgc.NetworkGeoRedoTime = GlobalConfigDefaults.NetworkGeoRedoTime
 	}
@@ -143,6 +356,30 @@ func ApplyGlobalConfig(newgc GlobalConfig) GlobalConfig {
 	if newgc.NetworkFallbackAnyEth == TS_NONE {
 		newgc.NetworkFallbackAnyEth = GlobalConfigDefaults.NetworkFallbackAnyEth
 	}
+	if newgc.IcmpEchoMgmt == TS_NONE {
+		newgc.IcmpEchoMgmt = GlobalConfigDefaults.IcmpEchoMgmt
+	}
+	if newgc.IcmpEchoApp == TS_NONE {
+		newgc.IcmpEchoApp = GlobalConfigDefaults.IcmpEchoApp
+	}
+	if newgc.Icmpv6RaMgmt == TS_NONE {
+		newgc.Icmpv6RaMgmt = GlobalConfigDefaults.Icmpv6RaMgmt
+	}
+	if newgc.Icmpv6RaApp == TS_NONE {
+		newgc.Icmpv6RaApp = GlobalConfigDefaults.Icmpv6RaApp
+	}
+	if newgc.NetworkConnectTimeout == 0 {
+		newgc.NetworkConnectTimeout = GlobalConfigDefaults.NetworkConnectTimeout
+	}
+	if newgc.NetworkTLSHandshakeTimeout == 0 {
+		newgc.NetworkTLSHandshakeTimeout = GlobalConfigDefaults.NetworkTLSHandshakeTimeout
+	}
+	if newgc.NetworkResponseHeaderTimeout == 0 {
+		newgc.NetworkResponseHeaderTimeout = GlobalConfigDefaults.NetworkResponseHeaderTimeout
+	}
+	if newgc.NetworkSendTimeout == 0 {
+		newgc.NetworkSendTimeout = GlobalConfigDefaults.NetworkSendTimeout
+	}
 	if newgc.StaleConfigTime == 0 {
 		newgc.StaleConfigTime = GlobalConfigDefaults.StaleConfigTime
 	}
@@ -164,6 +401,32 @@ func ApplyGlobalConfig(newgc GlobalConfig) GlobalConfig {
 	if newgc.DefaultRemoteLogLevel == "" {
 		newgc.DefaultRemoteLogLevel = GlobalConfigDefaults.DefaultRemoteLogLevel
 	}
+	if newgc.OCSPPolicy == OCSP_NONE {
+		newgc.OCSPPolicy = GlobalConfigDefaults.OCSPPolicy
+	}
+	// We allow ConntrackMax and ConntrackEvictTimeout to be zero
+	// meaning disabled
+	if newgc.ConntrackWarnPercent == 0 {
+		newgc.ConntrackWarnPercent = GlobalConfigDefaults.ConntrackWarnPercent
+	}
+	if newgc.StorageWarnPercent == 0 {
+		newgc.StorageWarnPercent = GlobalConfigDefaults.StorageWarnPercent
+	}
+	if newgc.StorageCriticalPercent == 0 {
+		newgc.StorageCriticalPercent = GlobalConfigDefaults.StorageCriticalPercent
+	}
+	if newgc.StorageCleanup == TS_NONE {
+		newgc.StorageCleanup = GlobalConfigDefaults.StorageCleanup
+	}
+	if newgc.UplinkChangeNotify == UCN_NONE {
+		newgc.UplinkChangeNotify = GlobalConfigDefaults.UplinkChangeNotify
+	}
+	if newgc.LocalDnsNtpProxy == TS_NONE {
+		newgc.LocalDnsNtpProxy = GlobalConfigDefaults.LocalDnsNtpProxy
+	}
+	if newgc.ObjectEventLog == TS_NONE {
+		newgc.ObjectEventLog = GlobalConfigDefaults.ObjectEventLog
+	}
 	return newgc
 }
 
@@ -174,6 +437,7 @@ var GlobalConfigMinimums = GlobalConfig{
 	ResetIfCloudGoneTime:    120,
 	FallbackIfCloudGoneTime: 60,
 	MintimeUpdateSuccess:    30,
+	UpdateCheckWindow:       30,
 
 	NetworkGeoRedoTime:        60,
 	NetworkGeoRetryTime:       5,
@@ -181,6 +445,11 @@ var GlobalConfigMinimums = GlobalConfig{
 	NetworkTestInterval:       300, // 5 minutes
 	NetworkTestBetterInterval: 0,   // Disabled
 
+	NetworkConnectTimeout:        2,
+	NetworkTLSHandshakeTimeout:   2,
+	NetworkResponseHeaderTimeout: 5,
+	NetworkSendTimeout:           5,
+
 	StaleConfigTime:     0, // Don't use stale config
 	DownloadGCTime:      60,
 	VdiskGCTime:         60,
@@ -215,6 +484,11 @@ func EnforceGlobalConfigMinimums(newgc GlobalConfig) GlobalConfig {
 			newgc.MintimeUpdateSuccess, GlobalConfigMinimums.MintimeUpdateSuccess)
 		newgc.MintimeUpdateSuccess = GlobalConfigMinimums.MintimeUpdateSuccess
 	}
+	if newgc.UpdateCheckWindow < GlobalConfigMinimums.UpdateCheckWindow {
+		log.Warnf("Enforce minimum UpdateCheckWindow received %d; using %d",
+			newgc.UpdateCheckWindow, GlobalConfigMinimums.UpdateCheckWindow)
+		newgc.UpdateCheckWindow = GlobalConfigMinimums.UpdateCheckWindow
+	}
 	if newgc.NetworkGeoRedoTime < GlobalConfigMinimums.NetworkGeoRedoTime {
 		log.Warnf("Enforce minimum NetworkGeoRedoTime received %d; using %d",
 			newgc.NetworkGeoRedoTime, GlobalConfigMinimums.NetworkGeoRedoTime)
@@ -238,6 +512,26 @@ func EnforceGlobalConfigMinimums(newgc GlobalConfig) GlobalConfig {
 			newgc.NetworkTestBetterInterval, GlobalConfigMinimums.NetworkTestBetterInterval)
 		newgc.NetworkTestBetterInterval = GlobalConfigMinimums.NetworkTestBetterInterval
 	}
+	if newgc.NetworkConnectTimeout < GlobalConfigMinimums.NetworkConnectTimeout {
+		log.Warnf("Enforce minimum NetworkConnectTimeout received %d; using %d",
+			newgc.NetworkConnectTimeout, GlobalConfigMinimums.NetworkConnectTimeout)
+		newgc.NetworkConnectTimeout = GlobalConfigMinimums.NetworkConnectTimeout
+	}
+	if newgc.NetworkTLSHandshakeTimeout < GlobalConfigMinimums.NetworkTLSHandshakeTimeout {
+		log.Warnf("Enforce minimum NetworkTLSHandshakeTimeout received %d; using %d",
+			newgc.NetworkTLSHandshakeTimeout, GlobalConfigMinimums.NetworkTLSHandshakeTimeout)
+		newgc.NetworkTLSHandshakeTimeout = GlobalConfigMinimums.NetworkTLSHandshakeTimeout
+	}
+	if newgc.NetworkResponseHeaderTimeout < GlobalConfigMinimums.NetworkResponseHeaderTimeout {
+		log.Warnf("Enforce minimum NetworkResponseHeaderTimeout received %d; using %d",
+			newgc.NetworkResponseHeaderTimeout, GlobalConfigMinimums.NetworkResponseHeaderTimeout)
+		newgc.NetworkResponseHeaderTimeout = GlobalConfigMinimums.NetworkResponseHeaderTimeout
+	}
+	if newgc.NetworkSendTimeout < GlobalConfigMinimums.NetworkSendTimeout {
+		log.Warnf("Enforce minimum NetworkSendTimeout received %d; using %d",
+			newgc.NetworkSendTimeout, GlobalConfigMinimums.NetworkSendTimeout)
+		newgc.NetworkSendTimeout = GlobalConfigMinimums.NetworkSendTimeout
+	}
 
 	if newgc.StaleConfigTime < GlobalConfigMinimums.StaleConfigTime {
 		log.Warnf("Enforce minimum StaleConfigTime received %d; using %d",
@@ -267,6 +561,272 @@ func EnforceGlobalConfigMinimums(newgc GlobalConfig) GlobalConfig {
 	return newgc
 }
 
+// We report values above these as out of range and the getters use the
+// maximum instead. Zero means no maximum.
+var GlobalConfigMaximums = GlobalConfig{
+	ConfigInterval:          3600,
+	MetricInterval:          3600,
+	ResetIfCloudGoneTime:    30 * 24 * 3600,
+	FallbackIfCloudGoneTime: 24 * 3600,
+	MintimeUpdateSuccess:    3600,
+	UpdateCheckWindow:       3600,
+
+	NetworkGeoRedoTime:        24 * 3600,
+	NetworkGeoRetryTime:       3600,
+	NetworkTestDuration:       600,
+	NetworkTestInterval:       24 * 3600,
+	NetworkTestBetterInterval: 24 * 3600,
+
+	NetworkConnectTimeout:        300,
+	NetworkTLSHandshakeTimeout:   300,
+	NetworkResponseHeaderTimeout: 600,
+	NetworkSendTimeout:           3600,
+
+	StaleConfigTime:     7 * 24 * 3600,
+	DownloadGCTime:      7 * 24 * 3600,
+	VdiskGCTime:         30 * 24 * 3600,
+	DownloadRetryTime:   24 * 3600,
+	DomainBootRetryTime: 24 * 3600,
+
+	ConntrackWarnPercent:   100,
+	StorageWarnPercent:     100,
+	StorageCriticalPercent: 100,
+}
+
+// The range of a field for ValidateGlobalConfig and
+// EnforceGlobalConfigMaximums
+type globalConfigRange struct {
+	name  string
+	value *uint32
+	min   uint32
+	max   uint32
+}
+
+func globalConfigRanges(gc *GlobalConfig) []globalConfigRange {
+	min := GlobalConfigMinimums
+	max := GlobalConfigMaximums
+	return []globalConfigRange{
+		{"ConfigInterval", &gc.ConfigInterval, min.ConfigInterval, max.ConfigInterval},
+		{"MetricInterval", &gc.MetricInterval, min.MetricInterval, max.MetricInterval},
+		{"ResetIfCloudGoneTime", &gc.ResetIfCloudGoneTime, min.ResetIfCloudGoneTime, max.ResetIfCloudGoneTime},
+		{"FallbackIfCloudGoneTime", &gc.FallbackIfCloudGoneTime, min.FallbackIfCloudGoneTime, max.FallbackIfCloudGoneTime},
+		{"MintimeUpdateSuccess", &gc.MintimeUpdateSuccess, min.MintimeUpdateSuccess, max.MintimeUpdateSuccess},
+		{"UpdateCheckWindow", &gc.UpdateCheckWindow, min.UpdateCheckWindow, max.UpdateCheckWindow},
+		{"NetworkGeoRedoTime", &gc.NetworkGeoRedoTime, min.NetworkGeoRedoTime, max.NetworkGeoRedoTime},
+		{"NetworkGeoRetryTime", &gc.NetworkGeoRetryTime, min.NetworkGeoRetryTime, max.NetworkGeoRetryTime},
+		{"NetworkTestDuration", &gc.NetworkTestDuration, min.NetworkTestDuration, max.NetworkTestDuration},
+		{"NetworkTestInterval", &gc.NetworkTestInterval, min.NetworkTestInterval, max.NetworkTestInterval},
+		{"NetworkTestBetterInterval", &gc.NetworkTestBetterInterval, min.NetworkTestBetterInterval, max.NetworkTestBetterInterval},
+		{"NetworkConnectTimeout", &gc.NetworkConnectTimeout, min.NetworkConnectTimeout, max.NetworkConnectTimeout},
+		{"NetworkTLSHandshakeTimeout", &gc.NetworkTLSHandshakeTimeout, min.NetworkTLSHandshakeTimeout, max.NetworkTLSHandshakeTimeout},
+		{"NetworkResponseHeaderTimeout", &gc.NetworkResponseHeaderTimeout, min.NetworkResponseHeaderTimeout, max.NetworkResponseHeaderTimeout},
+		{"NetworkSendTimeout", &gc.NetworkSendTimeout, min.NetworkSendTimeout, max.NetworkSendTimeout},
+		{"StaleConfigTime", &gc.StaleConfigTime, min.StaleConfigTime, max.StaleConfigTime},
+		{"DownloadGCTime", &gc.DownloadGCTime, min.DownloadGCTime, max.DownloadGCTime},
+		{"VdiskGCTime", &gc.VdiskGCTime, min.VdiskGCTime, max.VdiskGCTime},
+		{"DownloadRetryTime", &gc.DownloadRetryTime, min.DownloadRetryTime, max.DownloadRetryTime},
+		{"DomainBootRetryTime", &gc.DomainBootRetryTime, min.DomainBootRetryTime, max.DomainBootRetryTime},
+		{"ConntrackWarnPercent", &gc.ConntrackWarnPercent, min.ConntrackWarnPercent, max.ConntrackWarnPercent},
+		{"StorageWarnPercent", &gc.StorageWarnPercent, min.StorageWarnPercent, max.StorageWarnPercent},
+		{"StorageCriticalPercent", &gc.StorageCriticalPercent, min.StorageCriticalPercent, max.StorageCriticalPercent},
+	}
+}
+
+// ValidateGlobalConfig reports the values outside of the minimums and
+// maximums. Zero is not reported since it means the default.
+func ValidateGlobalConfig(gc GlobalConfig) error {
+	var problems []string
+	for _, r := range globalConfigRanges(&gc) {
+		value := *r.value
+		if value == 0 {
+			continue
+		}
+		if value < r.min {
+			problems = append(problems,
+				fmt.Sprintf("%s %d below minimum %d",
+					r.name, value, r.min))
+		} else if r.max != 0 && value > r.max {
+			problems = append(problems,
+				fmt.Sprintf("%s %d above maximum %d",
+					r.name, value, r.max))
+		}
+	}
+	if gc.StorageWarnPercent != 0 && gc.StorageCriticalPercent != 0 &&
+		gc.StorageWarnPercent >= gc.StorageCriticalPercent {
+		problems = append(problems,
+			fmt.Sprintf("StorageWarnPercent %d not below StorageCriticalPercent %d",
+				gc.StorageWarnPercent, gc.StorageCriticalPercent))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	errStr := fmt.Sprintf("GlobalConfig out of range: %s",
+		strings.Join(problems, "; "))
+	return errors.New(errStr)
+}
+
+// EnforceGlobalConfigMaximums is the counterpart of
+// EnforceGlobalConfigMinimums. In addition a StorageWarnPercent which is
+// not below StorageCriticalPercent is replaced by the default for both.
+func EnforceGlobalConfigMaximums(newgc GlobalConfig) GlobalConfig {
+
+	for _, r := range globalConfigRanges(&newgc) {
+		if r.max != 0 && *r.value > r.max {
+			log.Warnf("Enforce maximum %s received %d; using %d",
+				r.name, *r.value, r.max)
+			*r.value = r.max
+		}
+	}
+	if newgc.StorageWarnPercent != 0 && newgc.StorageCriticalPercent != 0 &&
+		newgc.StorageWarnPercent >= newgc.StorageCriticalPercent {
+		log.Warnf("Enforce StorageWarnPercent %d below StorageCriticalPercent %d; using %d and %d",
+			newgc.StorageWarnPercent, newgc.StorageCriticalPercent,
+			GlobalConfigDefaults.StorageWarnPercent,
+			GlobalConfigDefaults.StorageCriticalPercent)
+		newgc.StorageWarnPercent = GlobalConfigDefaults.StorageWarnPercent
+		newgc.StorageCriticalPercent = GlobalConfigDefaults.StorageCriticalPercent
+	}
+	return newgc
+}
+
+// boundedUint32 returns the value, or def if zero, limited to min and
+// max. A zero max means no maximum.
+func boundedUint32(value uint32, def uint32, min uint32, max uint32) uint32 {
+	if value == 0 {
+		value = def
+	}
+	if value < min {
+		value = min
+	}
+	if max != 0 && value > max {
+		value = max
+	}
+	return value
+}
+
+func boundedSeconds(value uint32, def uint32, min uint32, max uint32) time.Duration {
+	return time.Duration(boundedUint32(value, def, min, max)) * time.Second
+}
+
+// The getters below return the value from the GlobalConfig, the default
+// if zero, limited to GlobalConfigMinimums and GlobalConfigMaximums
+
+func (gc GlobalConfig) GetConfigInterval() time.Duration {
+	return boundedSeconds(gc.ConfigInterval, GlobalConfigDefaults.ConfigInterval,
+		GlobalConfigMinimums.ConfigInterval, GlobalConfigMaximums.ConfigInterval)
+}
+
+func (gc GlobalConfig) GetMetricInterval() time.Duration {
+	return boundedSeconds(gc.MetricInterval, GlobalConfigDefaults.MetricInterval,
+		GlobalConfigMinimums.MetricInterval, GlobalConfigMaximums.MetricInterval)
+}
+
+func (gc GlobalConfig) GetResetIfCloudGoneTime() time.Duration {
+	return boundedSeconds(gc.ResetIfCloudGoneTime, GlobalConfigDefaults.ResetIfCloudGoneTime,
+		GlobalConfigMinimums.ResetIfCloudGoneTime, GlobalConfigMaximums.ResetIfCloudGoneTime)
+}
+
+func (gc GlobalConfig) GetFallbackIfCloudGoneTime() time.Duration {
+	return boundedSeconds(gc.FallbackIfCloudGoneTime, GlobalConfigDefaults.FallbackIfCloudGoneTime,
+		GlobalConfigMinimums.FallbackIfCloudGoneTime, GlobalConfigMaximums.FallbackIfCloudGoneTime)
+}
+
+func (gc GlobalConfig) GetMintimeUpdateSuccess() time.Duration {
+	return boundedSeconds(gc.MintimeUpdateSuccess, GlobalConfigDefaults.MintimeUpdateSuccess,
+		GlobalConfigMinimums.MintimeUpdateSuccess, GlobalConfigMaximums.MintimeUpdateSuccess)
+}
+
+func (gc GlobalConfig) GetUpdateCheckWindow() time.Duration {
+	return boundedSeconds(gc.UpdateCheckWindow, GlobalConfigDefaults.UpdateCheckWindow,
+		GlobalConfigMinimums.UpdateCheckWindow, GlobalConfigMaximums.UpdateCheckWindow)
+}
+
+func (gc GlobalConfig) GetNetworkGeoRedoTime() time.Duration {
+	return boundedSeconds(gc.NetworkGeoRedoTime, GlobalConfigDefaults.NetworkGeoRedoTime,
+		GlobalConfigMinimums.NetworkGeoRedoTime, GlobalConfigMaximums.NetworkGeoRedoTime)
+}
+
+func (gc GlobalConfig) GetNetworkGeoRetryTime() time.Duration {
+	return boundedSeconds(gc.NetworkGeoRetryTime, GlobalConfigDefaults.NetworkGeoRetryTime,
+		GlobalConfigMinimums.NetworkGeoRetryTime, GlobalConfigMaximums.NetworkGeoRetryTime)
+}
+
+func (gc GlobalConfig) GetNetworkTestDuration() time.Duration {
+	return boundedSeconds(gc.NetworkTestDuration, GlobalConfigDefaults.NetworkTestDuration,
+		GlobalConfigMinimums.NetworkTestDuration, GlobalConfigMaximums.NetworkTestDuration)
+}
+
+func (gc GlobalConfig) GetNetworkTestInterval() time.Duration {
+	return boundedSeconds(gc.NetworkTestInterval, GlobalConfigDefaults.NetworkTestInterval,
+		GlobalConfigMinimums.NetworkTestInterval, GlobalConfigMaximums.NetworkTestInterval)
+}
+
+// Zero means disabled
+func (gc GlobalConfig) GetNetworkTestBetterInterval() time.Duration {
+	return boundedSeconds(gc.NetworkTestBetterInterval, GlobalConfigDefaults.NetworkTestBetterInterval,
+		GlobalConfigMinimums.NetworkTestBetterInterval, GlobalConfigMaximums.NetworkTestBetterInterval)
+}
+
+func (gc GlobalConfig) GetNetworkConnectTimeout() time.Duration {
+	return boundedSeconds(gc.NetworkConnectTimeout, GlobalConfigDefaults.NetworkConnectTimeout,
+		GlobalConfigMinimums.NetworkConnectTimeout, GlobalConfigMaximums.NetworkConnectTimeout)
+}
+
+func (gc GlobalConfig) GetNetworkTLSHandshakeTimeout() time.Duration {
+	return boundedSeconds(gc.NetworkTLSHandshakeTimeout, GlobalConfigDefaults.NetworkTLSHandshakeTimeout,
+		GlobalConfigMinimums.NetworkTLSHandshakeTimeout, GlobalConfigMaximums.NetworkTLSHandshakeTimeout)
+}
+
+func (gc GlobalConfig) GetNetworkResponseHeaderTimeout() time.Duration {
+	return boundedSeconds(gc.NetworkResponseHeaderTimeout, GlobalConfigDefaults.NetworkResponseHeaderTimeout,
+		GlobalConfigMinimums.NetworkResponseHeaderTimeout, GlobalConfigMaximums.NetworkResponseHeaderTimeout)
+}
+
+func (gc GlobalConfig) GetNetworkSendTimeout() time.Duration {
+	return boundedSeconds(gc.NetworkSendTimeout, GlobalConfigDefaults.NetworkSendTimeout,
+		GlobalConfigMinimums.NetworkSendTimeout, GlobalConfigMaximums.NetworkSendTimeout)
+}
+
+func (gc GlobalConfig) GetStaleConfigTime() time.Duration {
+	return boundedSeconds(gc.StaleConfigTime, GlobalConfigDefaults.StaleConfigTime,
+		GlobalConfigMinimums.StaleConfigTime, GlobalConfigMaximums.StaleConfigTime)
+}
+
+func (gc GlobalConfig) GetDownloadGCTime() time.Duration {
+	return boundedSeconds(gc.DownloadGCTime, GlobalConfigDefaults.DownloadGCTime,
+		GlobalConfigMinimums.DownloadGCTime, GlobalConfigMaximums.DownloadGCTime)
+}
+
+func (gc GlobalConfig) GetVdiskGCTime() time.Duration {
+	return boundedSeconds(gc.VdiskGCTime, GlobalConfigDefaults.VdiskGCTime,
+		GlobalConfigMinimums.VdiskGCTime, GlobalConfigMaximums.VdiskGCTime)
+}
+
+func (gc GlobalConfig) GetDownloadRetryTime() time.Duration {
+	return boundedSeconds(gc.DownloadRetryTime, GlobalConfigDefaults.DownloadRetryTime,
+		GlobalConfigMinimums.DownloadRetryTime, GlobalConfigMaximums.DownloadRetryTime)
+}
+
+func (gc GlobalConfig) GetDomainBootRetryTime() time.Duration {
+	return boundedSeconds(gc.DomainBootRetryTime, GlobalConfigDefaults.DomainBootRetryTime,
+		GlobalConfigMinimums.DomainBootRetryTime, GlobalConfigMaximums.DomainBootRetryTime)
+}
+
+func (gc GlobalConfig) GetConntrackWarnPercent() uint32 {
+	return boundedUint32(gc.ConntrackWarnPercent, GlobalConfigDefaults.ConntrackWarnPercent,
+		GlobalConfigMinimums.ConntrackWarnPercent, GlobalConfigMaximums.ConntrackWarnPercent)
+}
+
+func (gc GlobalConfig) GetStorageWarnPercent() uint32 {
+	return boundedUint32(gc.StorageWarnPercent, GlobalConfigDefaults.StorageWarnPercent,
+		GlobalConfigMinimums.StorageWarnPercent, GlobalConfigMaximums.StorageWarnPercent)
+}
+
+func (gc GlobalConfig) GetStorageCriticalPercent() uint32 {
+	return boundedUint32(gc.StorageCriticalPercent, GlobalConfigDefaults.StorageCriticalPercent,
+		GlobalConfigMinimums.StorageCriticalPercent, GlobalConfigMaximums.StorageCriticalPercent)
+}
+
 // Agents which wait for GlobalConfig initialized should call this
 // on startup to make sure we have a GlobalConfig file.
 func EnsureGCFile() {
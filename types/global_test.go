@@ -0,0 +1,125 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrefixList(t *testing.T) {
+	prefixes, err := ParsePrefixList(" 10.1.0.0/16, 192.0.2.7,,fd00::/8 ,2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.1.0.0/16", "192.0.2.7/32", "fd00::/8",
+		"2001:db8::1/128"}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Got %v expected %v", prefixes, expected)
+	}
+	prefixes, err = ParsePrefixList("")
+	if err != nil || len(prefixes) != 0 {
+		t.Errorf("Got %v %v for empty", prefixes, err)
+	}
+	if _, err := ParsePrefixList("10.1.0.0/16,bogus"); err == nil {
+		t.Errorf("Expected an error for bogus")
+	}
+}
+
+func TestParseUplinkChangeNotify(t *testing.T) {
+	for _, notify := range []UplinkChangeNotify{UCN_NONE, UCN_OFF,
+		UCN_FORCERENEW, UCN_RA, UCN_EVENT} {
+		parsed, err := ParseUplinkChangeNotify(notify.String())
+		if err != nil || parsed != notify {
+			t.Errorf("%s parsed as %s: %v", notify, parsed, err)
+		}
+	}
+	if _, err := ParseUplinkChangeNotify("bogus"); err == nil {
+		t.Errorf("Expected an error for bogus")
+	}
+	gc := ApplyGlobalConfig(GlobalConfig{})
+	if gc.UplinkChangeNotify != UCN_OFF {
+		t.Errorf("Default %s", gc.UplinkChangeNotify)
+	}
+}
+
+func TestGlobalConfigGetters(t *testing.T) {
+	gc := GlobalConfig{}
+	if d := gc.GetNetworkTestInterval(); d != 300*time.Second {
+		t.Errorf("zero NetworkTestInterval got %v", d)
+	}
+	if d := gc.GetNetworkTestBetterInterval(); d != 0 {
+		t.Errorf("zero NetworkTestBetterInterval got %v", d)
+	}
+	gc.NetworkTestInterval = 1
+	if d := gc.GetNetworkTestInterval(); d != 300*time.Second {
+		t.Errorf("small NetworkTestInterval got %v", d)
+	}
+	gc.NetworkTestInterval = 1000000
+	if d := gc.GetNetworkTestInterval(); d != 24*time.Hour {
+		t.Errorf("large NetworkTestInterval got %v", d)
+	}
+	gc.NetworkTestInterval = 600
+	if d := gc.GetNetworkTestInterval(); d != 600*time.Second {
+		t.Errorf("NetworkTestInterval got %v", d)
+	}
+	gc.StorageCriticalPercent = 150
+	if p := gc.GetStorageCriticalPercent(); p != 100 {
+		t.Errorf("StorageCriticalPercent got %d", p)
+	}
+}
+
+func TestValidateGlobalConfig(t *testing.T) {
+	if err := ValidateGlobalConfig(GlobalConfig{}); err != nil {
+		t.Errorf("zero GlobalConfig: %s", err)
+	}
+	if err := ValidateGlobalConfig(GlobalConfigDefaults); err != nil {
+		t.Errorf("GlobalConfigDefaults: %s", err)
+	}
+	gc := GlobalConfigDefaults
+	gc.NetworkTestInterval = 1
+	gc.ConfigInterval = 100000
+	err := ValidateGlobalConfig(gc)
+	if err == nil {
+		t.Fatalf("no error for out of range values")
+	}
+	for _, name := range []string{"NetworkTestInterval", "ConfigInterval"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("%s not reported in %s", name, err)
+		}
+	}
+	gc = GlobalConfigDefaults
+	gc.StorageWarnPercent = gc.StorageCriticalPercent
+	if err := ValidateGlobalConfig(gc); err == nil {
+		t.Errorf("no error for StorageWarnPercent %d", gc.StorageWarnPercent)
+	}
+}
+
+func TestEnforceGlobalConfigMaximums(t *testing.T) {
+	gc := GlobalConfigDefaults
+	gc.NetworkTestInterval = 1000000
+	gc.StorageCriticalPercent = 150
+	gc = EnforceGlobalConfigMaximums(gc)
+	if gc.NetworkTestInterval != GlobalConfigMaximums.NetworkTestInterval {
+		t.Errorf("NetworkTestInterval %d", gc.NetworkTestInterval)
+	}
+	if gc.StorageCriticalPercent != 100 {
+		t.Errorf("StorageCriticalPercent %d", gc.StorageCriticalPercent)
+	}
+	if err := ValidateGlobalConfig(gc); err != nil {
+		t.Errorf("after enforce: %s", err)
+	}
+
+	gc = GlobalConfigDefaults
+	gc.StorageWarnPercent = 99
+	gc.StorageCriticalPercent = 90
+	gc = EnforceGlobalConfigMaximums(gc)
+	if gc.StorageWarnPercent != GlobalConfigDefaults.StorageWarnPercent ||
+		gc.StorageCriticalPercent != GlobalConfigDefaults.StorageCriticalPercent {
+		t.Errorf("Storage percents %d %d", gc.StorageWarnPercent,
+			gc.StorageCriticalPercent)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Hardware inventory published by zedagent at boot
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CPUInventory is from /proc/cpuinfo
+type CPUInventory struct {
+	Model   string
+	Sockets int
+	Cores   int // Physical cores in all sockets
+	Threads int // Logical CPUs
+	Flags   []string
+}
+
+// DiskInventory is a block device from /sys/block
+type DiskInventory struct {
+	DevName    string
+	Size       uint64 // In bytes
+	Model      string
+	Serial     string
+	Rotational bool
+	Removable  bool
+}
+
+// HardwareInventory is what zedagent determined about the hardware, with
+// "global" as the key
+type HardwareInventory struct {
+	HardwareModel string
+	Vendor        string
+	Product       string
+	Serial        string
+	ModelSource   string // Where the model was determined from
+	CPU           CPUInventory
+	TotalMemory   uint64 // In bytes
+	Disks         []DiskInventory
+	TPMPresent    bool
+}
+
+func (hi HardwareInventory) Key() string {
+	return "global"
+}
+
+// HasCPUFlag is used to check for e.g., "vmx" or "svm"
+func (hi HardwareInventory) HasCPUFlag(flag string) bool {
+	for _, f := range hi.CPU.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary is a few lines for diag
+func (hi HardwareInventory) Summary() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("model %s vendor %s product %s serial %s (from %s)",
+		hi.HardwareModel, hi.Vendor, hi.Product, hi.Serial,
+		hi.ModelSource))
+	lines = append(lines, fmt.Sprintf("CPU %s sockets %d cores %d threads %d",
+		hi.CPU.Model, hi.CPU.Sockets, hi.CPU.Cores, hi.CPU.Threads))
+	lines = append(lines, fmt.Sprintf("memory %d MB TPM %v",
+		hi.TotalMemory>>20, hi.TPMPresent))
+	for _, d := range hi.Disks {
+		lines = append(lines, fmt.Sprintf("disk %s %d MB model %s serial %s rotational %v removable %v",
+			d.DevName, d.Size>>20, d.Model, d.Serial, d.Rotational,
+			d.Removable))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -4,12 +4,57 @@
 package types
 
 import (
+	"fmt"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/pubsub"
 )
 
+// DeviceStateCode is what the device is doing as far as the person
+// installing it is concerned. The agents publish the state and
+// ledmanager maps it to a blink count.
+type DeviceStateCode uint8
+
+const (
+	DeviceStateUnknown              DeviceStateCode = iota
+	DeviceStateNoDHCP                               // Waiting for DHCP IP address(es)
+	DeviceStateConnectingController                 // Trying to connect to the controller
+	DeviceStateConnected                            // Connected but not onboarded
+	DeviceStateOnboarded                            // Connected and onboarded
+	DeviceStateOnboardConflict                      // Onboarding failure or conflict
+	DeviceStateNoModel                              // Missing DeviceNetworkConfig model file
+	DeviceStateNoTLS                                // Response without TLS
+	DeviceStateBadOCSP                              // Response without OCSP or bad OCSP
+)
+
+func (state DeviceStateCode) String() string {
+	switch state {
+	case DeviceStateUnknown:
+		return "Unknown"
+	case DeviceStateNoDHCP:
+		return "NoDHCP"
+	case DeviceStateConnectingController:
+		return "ConnectingController"
+	case DeviceStateConnected:
+		return "Connected"
+	case DeviceStateOnboarded:
+		return "Onboarded"
+	case DeviceStateOnboardConflict:
+		return "OnboardConflict"
+	case DeviceStateNoModel:
+		return "NoModel"
+	case DeviceStateNoTLS:
+		return "NoTLS"
+	case DeviceStateBadOCSP:
+		return "BadOCSP"
+	default:
+		return fmt.Sprintf("Unknown DeviceStateCode %d", state)
+	}
+}
+
+// LedBlinkCounter is the LED object published by the agents
 type LedBlinkCounter struct {
-	BlinkCounter int
+	DeviceState DeviceStateCode
 }
 
 const (
@@ -19,32 +64,35 @@ const (
 
 // Global variable to supress log messages when nothing changes from this
 // agent. Since other agents might have changed we still update the config.
-var lastCount = 0
+var lastState = DeviceStateUnknown
 
 // Used by callers to change the behavior or the LED
-func UpdateLedManagerConfig(count int) {
-	blinkCount := LedBlinkCounter{
-		BlinkCounter: count,
+func UpdateLedManagerConfig(state DeviceStateCode) {
+	ledState := LedBlinkCounter{
+		DeviceState: state,
 	}
-	err := pubsub.PublishToDir(tmpDirName, ledConfigKey, &blinkCount)
+	err := pubsub.PublishToDir(tmpDirName, ledConfigKey, &ledState)
 	if err != nil {
 		log.Errorln("err: ", err, tmpDirName)
 	} else {
-		if count != lastCount {
-			log.Infof("UpdateLedManagerConfig: set %d\n", count)
-			lastCount = count
+		if state != lastState {
+			log.Infof("UpdateLedManagerConfig: set %s\n", state)
+			lastState = state
 		}
 	}
 }
 
-// Merge the 1/2 values based on having usable addresses or not, with
-// the value we get based on access to zedcloud or errors.
-func DeriveLedCounter(ledCounter, usableAddressCount int) int {
+// Merge the NoDHCP and ConnectingController states based on having
+// usable addresses or not, with the state we get based on access to
+// zedcloud or errors.
+func DeriveDeviceState(state DeviceStateCode,
+	usableAddressCount int) DeviceStateCode {
+
 	if usableAddressCount == 0 {
-		return 1
-	} else if ledCounter < 2 {
-		return 2
+		return DeviceStateNoDHCP
+	} else if state < DeviceStateConnectingController {
+		return DeviceStateConnectingController
 	} else {
-		return ledCounter
+		return state
 	}
 }
@@ -0,0 +1,40 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDeriveDeviceState(t *testing.T) {
+	tests := []struct {
+		state       DeviceStateCode
+		usableAddrs int
+		expected    DeviceStateCode
+	}{
+		{DeviceStateUnknown, 0, DeviceStateNoDHCP},
+		{DeviceStateOnboarded, 0, DeviceStateNoDHCP},
+		{DeviceStateUnknown, 1, DeviceStateConnectingController},
+		{DeviceStateNoDHCP, 2, DeviceStateConnectingController},
+		{DeviceStateConnected, 1, DeviceStateConnected},
+		{DeviceStateBadOCSP, 1, DeviceStateBadOCSP},
+	}
+	for _, test := range tests {
+		got := DeriveDeviceState(test.state, test.usableAddrs)
+		if got != test.expected {
+			t.Errorf("%s with %d addresses: got %s expected %s",
+				test.state, test.usableAddrs, got, test.expected)
+		}
+	}
+}
+
+// device-steps.sh writes the initial state as JSON
+func TestLedBlinkCounterJSON(t *testing.T) {
+	var led LedBlinkCounter
+	err := json.Unmarshal([]byte(`{"DeviceState": 1}`), &led)
+	if err != nil || led.DeviceState != DeviceStateNoDHCP {
+		t.Errorf("got %+v %v", led, err)
+	}
+}
@@ -5,9 +5,69 @@ package types
 
 import (
 	"net"
+	"time"
 )
 
 type DnsNameToIP struct {
 	HostName string
 	IPs      []net.IP
 }
+
+// OnboardingPhase is the step of onboarding which client is doing
+type OnboardingPhase string
+
+const (
+	OnboardingCertificates OnboardingPhase = "certificates" // Loading the certificates
+	OnboardingNetwork      OnboardingPhase = "network"      // Waiting for an address
+	OnboardingProxy        OnboardingPhase = "proxy"        // WPAD discovery
+	OnboardingPing         OnboardingPhase = "ping"
+	OnboardingSelfRegister OnboardingPhase = "selfRegister"
+	OnboardingGetUuid      OnboardingPhase = "getUuid"
+	OnboardingComplete     OnboardingPhase = "complete"
+)
+
+// OnboardingState is the state of the current phase
+type OnboardingState string
+
+const (
+	OnboardingStarted   OnboardingState = "started"
+	OnboardingRetrying  OnboardingState = "retrying"
+	OnboardingSucceeded OnboardingState = "succeeded"
+	OnboardingFailed    OnboardingState = "failed"
+)
+
+// OnboardingErrorCode classifies the last error for tooling
+type OnboardingErrorCode string
+
+const (
+	OnboardingNoError         OnboardingErrorCode = ""
+	OnboardingCertError       OnboardingErrorCode = "cert"     // Missing or bad certificate
+	OnboardingServerError     OnboardingErrorCode = "server"   // Bad or missing server file
+	OnboardingProxyError      OnboardingErrorCode = "proxy"    // No PAC file from WPAD
+	OnboardingSendError       OnboardingErrorCode = "send"     // No response on any interface
+	OnboardingStatusError     OnboardingErrorCode = "status"   // Unexpected HTTP status
+	OnboardingConflictError   OnboardingErrorCode = "conflict" // Registered with a different certificate
+	OnboardingResponseError   OnboardingErrorCode = "response" // Bad content type or content
+	OnboardingWriteError      OnboardingErrorCode = "write"    // Could not save the result
+	OnboardingRetriesExceeded OnboardingErrorCode = "retries"  // Gave up after max retries
+)
+
+// OnboardingStatus is published by client with key "global" for each
+// change in phase or state, and optionally written as JSON lines for
+// installers and factory tooling
+type OnboardingStatus struct {
+	Phase      OnboardingPhase
+	State      OnboardingState
+	ErrorCode  OnboardingErrorCode
+	Error      string
+	RetryCount int
+	UpdateTime time.Time
+	DeviceUUID string // Set when getUuid succeeds
+
+	WpadURL string // Where WPAD found the PAC file if any
+	Proxy   string // Used for the last response; without the password
+}
+
+func (status OnboardingStatus) Key() string {
+	return "global"
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// The token with which the controller allows the client reonboard
+// operation. It is a secret hence it is kept in its own file, readable
+// only by root, instead of in GlobalConfig which is logged and
+// published to all agents.
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const reonboardTokenFile = "/persist/config/reonboard.token"
+
+// WriteReonboardToken saves the token, or removes the file if the token
+// is empty. The file is only rewritten when the token changes.
+func WriteReonboardToken(token string) error {
+	return writeReonboardToken(reonboardTokenFile, token)
+}
+
+// ReadReonboardToken returns the token; empty if none has been set
+func ReadReonboardToken() (string, error) {
+	return readReonboardToken(reonboardTokenFile)
+}
+
+func writeReonboardToken(fileName string, token string) error {
+	current, err := readReonboardToken(fileName)
+	if err == nil && current == token {
+		return nil
+	}
+	if token == "" {
+		log.Infof("Removing reonboard token\n")
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	log.Infof("Saving reonboard token\n")
+	tmpFile := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte(token), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, fileName)
+}
+
+func readReonboardToken(fileName string) (string, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReonboardToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reonboard")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := dir + "/reonboard.token"
+
+	if token, err := readReonboardToken(fileName); err != nil || token != "" {
+		t.Errorf("Expected no token, got <%s> %v\n", token, err)
+	}
+	if err := writeReonboardToken(fileName, "secret"); err != nil {
+		t.Fatalf("writeReonboardToken failed: %s\n", err)
+	}
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Stat failed: %s\n", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %o\n", info.Mode().Perm())
+	}
+	if token, err := readReonboardToken(fileName); err != nil || token != "secret" {
+		t.Errorf("Expected secret, got <%s> %v\n", token, err)
+	}
+	if err := writeReonboardToken(fileName, ""); err != nil {
+		t.Fatalf("writeReonboardToken failed: %s\n", err)
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("Token file not removed: %v\n", err)
+	}
+}
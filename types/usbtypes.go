@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// USB devices seen by dom0, published by domainmgr when they are attached
+// and unpublished when they are detached
+
+package types
+
+import (
+	"fmt"
+)
+
+// USB interface classes we care about
+const (
+	UsbClassComm        = 0x02 // CDC e.g., ECM/NCM modems and NICs
+	UsbClassHID         = 0x03
+	UsbClassMassStorage = 0x08
+	UsbClassCDCData     = 0x0a
+	UsbClassWireless    = 0xe0 // E.g., RNDIS
+	UsbClassVendor      = 0xff // Most cellular modems
+)
+
+// UsbDeviceStatus with the bus path e.g., "1-1.2" as the key
+type UsbDeviceStatus struct {
+	BusPath          string
+	VendorID         uint16
+	ProductID        uint16
+	Manufacturer     string
+	Product          string
+	Serial           string
+	DeviceClass      uint8
+	InterfaceClasses []uint8 // One per interface
+}
+
+func (status UsbDeviceStatus) Key() string {
+	return status.BusPath
+}
+
+// VendorProduct is the "vvvv:pppp" format used by lsusb
+func (status UsbDeviceStatus) VendorProduct() string {
+	return fmt.Sprintf("%04x:%04x", status.VendorID, status.ProductID)
+}
+
+// HasInterfaceClass returns true if any interface is of the class
+func (status UsbDeviceStatus) HasInterfaceClass(class uint8) bool {
+	for _, c := range status.InterfaceClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// MaybeNetwork returns true for devices which might show up as a network
+// interface, which is the case for modems and USB NICs
+func (status UsbDeviceStatus) MaybeNetwork() bool {
+	return status.HasInterfaceClass(UsbClassComm) ||
+		status.HasInterfaceClass(UsbClassWireless) ||
+		status.HasInterfaceClass(UsbClassVendor)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Validate checks the required fields, the ranges and the consistency
+// between fields of a config before it is published and upon receipt.
+
+package types
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/satori/go.uuid"
+)
+
+// Validate the port config and all its ports. A config without ports or
+// without management ports is allowed; the verification of the
+// DevicePortConfigList falls back from it like from any config which
+// does not reach the controller.
+func (portConfig DevicePortConfig) Validate() error {
+	if portConfig.Version > DPCIsMgmt {
+		errStr := fmt.Sprintf("DevicePortConfig %s: unknown version %d",
+			portConfig.Key, portConfig.Version)
+		return errors.New(errStr)
+	}
+	ifNames := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, port := range portConfig.Ports {
+		if err := port.Validate(); err != nil {
+			errStr := fmt.Sprintf("DevicePortConfig %s: %s",
+				portConfig.Key, err)
+			return errors.New(errStr)
+		}
+		if ifNames[port.IfName] {
+			errStr := fmt.Sprintf("DevicePortConfig %s: duplicate port %s",
+				portConfig.Key, port.IfName)
+			return errors.New(errStr)
+		}
+		ifNames[port.IfName] = true
+		if port.Name != "" {
+			if names[port.Name] {
+				errStr := fmt.Sprintf("DevicePortConfig %s: duplicate name %s",
+					portConfig.Key, port.Name)
+				return errors.New(errStr)
+			}
+			names[port.Name] = true
+		}
+	}
+	return nil
+}
+
+// Validate the port including its static IP and proxy config
+func (port NetworkPortConfig) Validate() error {
+	if port.IfName == "" {
+		return errors.New("port without IfName")
+	}
+	if port.Free && !port.IsMgmt {
+		errStr := fmt.Sprintf("port %s: Free but not IsMgmt", port.IfName)
+		return errors.New(errStr)
+	}
+	switch port.Dhcp {
+	case DT_NOOP, DT_NONE, DT_CLIENT:
+	case DT_STATIC:
+		if _, _, err := net.ParseCIDR(port.AddrSubnet); err != nil {
+			errStr := fmt.Sprintf("port %s: bad AddrSubnet %s: %s",
+				port.IfName, port.AddrSubnet, err)
+			return errors.New(errStr)
+		}
+		if port.Gateway == nil || port.Gateway.IsUnspecified() {
+			errStr := fmt.Sprintf("port %s: static without Gateway",
+				port.IfName)
+			return errors.New(errStr)
+		}
+	default:
+		errStr := fmt.Sprintf("port %s: unsupported Dhcp type %d",
+			port.IfName, port.Dhcp)
+		return errors.New(errStr)
+	}
+	for _, proxy := range port.Proxies {
+		if proxy.Server == "" {
+			errStr := fmt.Sprintf("port %s: proxy without Server",
+				port.IfName)
+			return errors.New(errStr)
+		}
+		if proxy.Port > 65535 {
+			errStr := fmt.Sprintf("port %s: bad proxy port %d",
+				port.IfName, proxy.Port)
+			return errors.New(errStr)
+		}
+	}
+	return nil
+}
+
+// ValidateStaticNeighbors checks that the static neighbors are unicast,
+// unique, and inside the subnet if one is set
+func (config NetworkInstanceConfig) ValidateStaticNeighbors() error {
+	ips := make(map[string]bool)
+	for _, n := range config.StaticNeighbors {
+		if n.IP == nil || n.IP.IsUnspecified() || n.IP.IsMulticast() {
+			errStr := fmt.Sprintf("static neighbor: bad IP %v", n.IP)
+			return errors.New(errStr)
+		}
+		if len(n.Mac) != 6 || n.Mac[0]&0x01 != 0 {
+			errStr := fmt.Sprintf("static neighbor %s: bad MAC %v",
+				n.IP, n.Mac)
+			return errors.New(errStr)
+		}
+		if config.Subnet.IP != nil && !config.Subnet.Contains(n.IP) {
+			errStr := fmt.Sprintf("static neighbor %s: not in subnet %s",
+				n.IP, config.Subnet.String())
+			return errors.New(errStr)
+		}
+		if ips[n.IP.String()] {
+			errStr := fmt.Sprintf("static neighbor %s: duplicate",
+				n.IP)
+			return errors.New(errStr)
+		}
+		ips[n.IP.String()] = true
+	}
+	return nil
+}
+
+// Validate the domain config and its disks
+func (config DomainConfig) Validate() error {
+	if uuid.Equal(config.UUIDandVersion.UUID, uuid.UUID{}) {
+		return errors.New("DomainConfig without UUID")
+	}
+	key := config.Key()
+	if config.DisplayName == "" {
+		errStr := fmt.Sprintf("DomainConfig %s: no DisplayName", key)
+		return errors.New(errStr)
+	}
+	if config.Memory < 0 || config.MaxMem < 0 || config.VCpus < 0 ||
+		config.MaxCpus < 0 {
+		errStr := fmt.Sprintf("DomainConfig %s: negative resources %d/%d kbytes %d/%d vcpus",
+			key, config.Memory, config.MaxMem, config.VCpus,
+			config.MaxCpus)
+		return errors.New(errStr)
+	}
+	if config.MaxMem != 0 && config.MaxMem < config.Memory {
+		errStr := fmt.Sprintf("DomainConfig %s: MaxMem %d below Memory %d",
+			key, config.MaxMem, config.Memory)
+		return errors.New(errStr)
+	}
+	if config.MaxCpus != 0 && config.MaxCpus < config.VCpus {
+		errStr := fmt.Sprintf("DomainConfig %s: MaxCpus %d below VCpus %d",
+			key, config.MaxCpus, config.VCpus)
+		return errors.New(errStr)
+	}
+	if config.VirtualizationMode > HVM {
+		errStr := fmt.Sprintf("DomainConfig %s: unknown VirtualizationMode %d",
+			key, config.VirtualizationMode)
+		return errors.New(errStr)
+	}
+	hvm := config.VirtualizationMode == HVM
+	if config.IOThreads < 0 || (config.IOThreads != 0 && !hvm) {
+		errStr := fmt.Sprintf("DomainConfig %s: IOThreads %d needs HVM",
+			key, config.IOThreads)
+		return errors.New(errStr)
+	}
+	if config.IOThreadCPUs != "" && config.IOThreads == 0 {
+		errStr := fmt.Sprintf("DomainConfig %s: IOThreadCPUs without IOThreads",
+			key)
+		return errors.New(errStr)
+	}
+	for _, disk := range config.DiskConfigList {
+		if err := disk.Validate(); err != nil {
+			errStr := fmt.Sprintf("DomainConfig %s: %s", key, err)
+			return errors.New(errStr)
+		}
+		if disk.Virtio && !hvm {
+			errStr := fmt.Sprintf("DomainConfig %s: virtio disk %s needs HVM",
+				key, disk.ImageSha256)
+			return errors.New(errStr)
+		}
+	}
+	for _, vif := range config.VifList {
+		if err := validateQueues(vif.Virtio, vif.Queues); err != nil {
+			errStr := fmt.Sprintf("DomainConfig %s: vif %s: %s",
+				key, vif.Vif, err)
+			return errors.New(errStr)
+		}
+		if vif.Virtio && !hvm {
+			errStr := fmt.Sprintf("DomainConfig %s: virtio vif %s needs HVM",
+				key, vif.Vif)
+			return errors.New(errStr)
+		}
+	}
+	if config.CloudInitUserData != "" {
+		_, err := base64.StdEncoding.DecodeString(config.CloudInitUserData)
+		if err != nil {
+			errStr := fmt.Sprintf("DomainConfig %s: bad CloudInitUserData: %s",
+				key, err)
+			return errors.New(errStr)
+		}
+	}
+	return nil
+}
+
+// Validate the disk
+func (disk DiskConfig) Validate() error {
+	if disk.ImageSha256 == "" {
+		return errors.New("disk without ImageSha256")
+	}
+	if err := validateQueues(disk.Virtio, disk.Queues); err != nil {
+		errStr := fmt.Sprintf("disk %s: %s", disk.ImageSha256, err)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// Most virtio queues a device can have
+const maxVirtioQueues = 64
+
+func validateQueues(virtio bool, queues int) error {
+	if queues < 0 || queues > maxVirtioQueues {
+		errStr := fmt.Sprintf("Queues %d outside 0-%d",
+			queues, maxVirtioQueues)
+		return errors.New(errStr)
+	}
+	if queues != 0 && !virtio {
+		errStr := fmt.Sprintf("Queues %d needs virtio", queues)
+		return errors.New(errStr)
+	}
+	return nil
+}
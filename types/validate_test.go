@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"net"
+	"testing"
+
+	"github.com/satori/go.uuid"
+)
+
+func TestDevicePortConfigValidate(t *testing.T) {
+	static := NetworkPortConfig{IfName: "eth0", Name: "uplink",
+		IsMgmt: true, Free: true}
+	static.Dhcp = DT_STATIC
+	static.AddrSubnet = "192.168.1.44/24"
+	static.Gateway = net.ParseIP("192.168.1.1")
+	client := NetworkPortConfig{IfName: "eth1"}
+	client.Dhcp = DT_CLIENT
+	valid := DevicePortConfig{Version: DPCIsMgmt, Key: "zedagent",
+		Ports: []NetworkPortConfig{static, client}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Unexpected %s", err)
+	}
+
+	noGateway := static
+	noGateway.Gateway = nil
+	badSubnet := static
+	badSubnet.AddrSubnet = "192.168.1.44"
+	freeOnly := client
+	freeOnly.Free = true
+	badDhcp := client
+	badDhcp.Dhcp = DT_Deprecated
+	badProxy := client
+	badProxy.Proxies = []ProxyEntry{{Server: "proxy", Port: 70000}}
+	tests := []struct {
+		name  string
+		ports []NetworkPortConfig
+	}{
+		{"no gateway", []NetworkPortConfig{noGateway}},
+		{"bad subnet", []NetworkPortConfig{badSubnet}},
+		{"free not mgmt", []NetworkPortConfig{static, freeOnly}},
+		{"bad dhcp", []NetworkPortConfig{static, badDhcp}},
+		{"bad proxy", []NetworkPortConfig{static, badProxy}},
+		{"duplicate", []NetworkPortConfig{static, static}},
+	}
+	for _, test := range tests {
+		dpc := DevicePortConfig{Version: DPCIsMgmt, Ports: test.ports}
+		if err := dpc.Validate(); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+	// Left to the verification of the DevicePortConfigList
+	for _, ports := range [][]NetworkPortConfig{nil, {client}} {
+		dpc := DevicePortConfig{Version: DPCIsMgmt, Ports: ports}
+		if err := dpc.Validate(); err != nil {
+			t.Errorf("Unexpected %s", err)
+		}
+	}
+}
+
+func TestValidateStaticNeighbors(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/24")
+	mac, _ := net.ParseMAC("00:16:3e:00:01:02")
+	plc := StaticNeighbor{IP: net.ParseIP("10.1.0.20"), Mac: mac}
+	config := NetworkInstanceConfig{Subnet: *subnet,
+		StaticNeighbors: []StaticNeighbor{plc}}
+	if err := config.ValidateStaticNeighbors(); err != nil {
+		t.Fatalf("Unexpected %s", err)
+	}
+
+	multicast, _ := net.ParseMAC("01:00:5e:00:00:01")
+	tests := []struct {
+		name      string
+		neighbors []StaticNeighbor
+	}{
+		{"no IP", []StaticNeighbor{{Mac: mac}}},
+		{"no MAC", []StaticNeighbor{{IP: plc.IP}}},
+		{"multicast MAC", []StaticNeighbor{{IP: plc.IP, Mac: multicast}}},
+		{"outside subnet", []StaticNeighbor{{IP: net.ParseIP("10.2.0.20"),
+			Mac: mac}}},
+		{"duplicate", []StaticNeighbor{plc, plc}},
+	}
+	for _, test := range tests {
+		config.StaticNeighbors = test.neighbors
+		if err := config.ValidateStaticNeighbors(); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+	// A switch network instance has no subnet
+	config = NetworkInstanceConfig{StaticNeighbors: []StaticNeighbor{
+		{IP: net.ParseIP("10.2.0.20"), Mac: mac}}}
+	if err := config.ValidateStaticNeighbors(); err != nil {
+		t.Errorf("Unexpected %s", err)
+	}
+}
+
+func TestDomainConfigValidate(t *testing.T) {
+	id, err := uuid.FromString("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := DomainConfig{
+		UUIDandVersion: UUIDandVersion{UUID: id},
+		DisplayName:    "app",
+		VmConfig:       VmConfig{Memory: 1024 * 1024, VCpus: 2},
+		DiskConfigList: []DiskConfig{{ImageSha256: "abcd",
+			Format: "qcow2"}},
+		CloudInitUserData: "I2Nsb3VkLWNvbmZpZw==",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Unexpected %s", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(config *DomainConfig)
+	}{
+		{"no uuid", func(c *DomainConfig) { c.UUIDandVersion = UUIDandVersion{} }},
+		{"no name", func(c *DomainConfig) { c.DisplayName = "" }},
+		{"negative", func(c *DomainConfig) { c.Memory = -1 }},
+		{"maxmem", func(c *DomainConfig) { c.MaxMem = 1024 }},
+		{"maxcpus", func(c *DomainConfig) { c.MaxCpus = 1 }},
+		{"mode", func(c *DomainConfig) { c.VirtualizationMode = HVM + 1 }},
+		{"disk", func(c *DomainConfig) { c.DiskConfigList[0].ImageSha256 = "" }},
+		{"cloud-init", func(c *DomainConfig) { c.CloudInitUserData = "%%" }},
+		{"virtio pv", func(c *DomainConfig) { c.DiskConfigList[0].Virtio = true }},
+		{"queues", func(c *DomainConfig) { c.DiskConfigList[0].Queues = 4 }},
+		{"iothreads pv", func(c *DomainConfig) { c.IOThreads = 1 }},
+		{"iothread cpus", func(c *DomainConfig) {
+			c.VirtualizationMode = HVM
+			c.IOThreadCPUs = "2"
+		}},
+		{"vif queues", func(c *DomainConfig) {
+			c.VirtualizationMode = HVM
+			c.VifList = []VifInfo{{Vif: "nbu1x1", Virtio: true,
+				Queues: maxVirtioQueues + 1}}
+		}},
+	}
+	for _, test := range tests {
+		config := valid
+		config.DiskConfigList = []DiskConfig{valid.DiskConfigList[0]}
+		test.modify(&config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	// Virtio with queues and IO threads for HVM
+	config := valid
+	config.VirtualizationMode = HVM
+	config.IOThreads = 2
+	config.IOThreadCPUs = "2,3"
+	config.DiskConfigList = []DiskConfig{{ImageSha256: "abcd",
+		Virtio: true, Queues: 4}}
+	config.VifList = []VifInfo{{Vif: "nbu1x1", Virtio: true, Queues: 2}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Unexpected %s", err)
+	}
+}
@@ -54,9 +54,8 @@ type VerifyImageStatus struct {
 	PendingModify bool
 	PendingDelete bool
 	ImageSha256   string  // sha256 of immutable image
-	State         SwState // DELIVERED; LastErr* set if failed
-	LastErr       string  // Verification error
-	LastErrTime   time.Time
+	State         SwState // DELIVERED; Error* set if failed
+	ErrorAndTime          // Verification error
 	Size          int64
 	RefCount      uint
 	LastUse       time.Time // When RefCount dropped to zero
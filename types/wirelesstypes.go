@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Status of wifi and cellular ports shared by nim, diag and zedagent
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WirelessType is marshaled as "wifi" or "cellular" in the JSON
+type WirelessType uint8
+
+const (
+	WirelessTypeNone WirelessType = iota
+	WirelessTypeWifi
+	WirelessTypeCellular
+)
+
+func (wt WirelessType) String() string {
+	switch wt {
+	case WirelessTypeNone:
+		return "none"
+	case WirelessTypeWifi:
+		return "wifi"
+	case WirelessTypeCellular:
+		return "cellular"
+	default:
+		return fmt.Sprintf("Unknown WirelessType %d", wt)
+	}
+}
+
+// MarshalText uses the names so that the JSON is readable
+func (wt WirelessType) MarshalText() ([]byte, error) {
+	switch wt {
+	case WirelessTypeNone, WirelessTypeWifi, WirelessTypeCellular:
+		return []byte(wt.String()), nil
+	default:
+		errStr := fmt.Sprintf("Unknown WirelessType %d", wt)
+		return nil, errors.New(errStr)
+	}
+}
+
+// UnmarshalText accepts the names in any case
+func (wt *WirelessType) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "", "none":
+		*wt = WirelessTypeNone
+	case "wifi":
+		*wt = WirelessTypeWifi
+	case "cellular":
+		*wt = WirelessTypeCellular
+	default:
+		errStr := fmt.Sprintf("Unknown WirelessType %q", string(text))
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// WirelessStatus is set in NetworkPortStatus for wifi and cellular ports
+type WirelessStatus struct {
+	Type WirelessType
+	// Signal strength in dBm; zero if unknown
+	SignalStrength int
+	// Wifi
+	SSID string `json:",omitempty"`
+	// Cellular
+	Operator string `json:",omitempty"`
+	IMEI     string `json:",omitempty"`
+	ICCID    string `json:",omitempty"`
+	// Data usage since the modem or interface was brought up
+	RxBytes uint64
+	TxBytes uint64
+}
+
+// Summary is a one line description for diag and logs
+func (ws WirelessStatus) Summary() string {
+	var network string
+	switch ws.Type {
+	case WirelessTypeWifi:
+		network = fmt.Sprintf("SSID %s", ws.SSID)
+	case WirelessTypeCellular:
+		network = fmt.Sprintf("operator %s IMEI %s ICCID %s",
+			ws.Operator, ws.IMEI, ws.ICCID)
+	}
+	signal := "unknown"
+	if ws.SignalStrength != 0 {
+		signal = fmt.Sprintf("%d dBm", ws.SignalStrength)
+	}
+	return fmt.Sprintf("%s %s signal %s rx %d tx %d bytes",
+		ws.Type, network, signal, ws.RxBytes, ws.TxBytes)
+}
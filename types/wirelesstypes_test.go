@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWirelessStatusJSON(t *testing.T) {
+	port := NetworkPortStatus{IfName: "wwan0",
+		Wireless: &WirelessStatus{Type: WirelessTypeCellular,
+			SignalStrength: -85, Operator: "Example", IMEI: "3520990017614823",
+			ICCID: "89014103211118510720", RxBytes: 1000, TxBytes: 200}}
+	b, err := json.Marshal(port)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if !strings.Contains(string(b), `"Type":"cellular"`) ||
+		strings.Contains(string(b), "SSID") {
+		t.Errorf("Got %s", string(b))
+	}
+	var got NetworkPortStatus
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if got.Wireless == nil || *got.Wireless != *port.Wireless {
+		t.Errorf("Got %+v expected %+v", got.Wireless, port.Wireless)
+	}
+
+	// Wired ports have no Wireless
+	b, err = json.Marshal(NetworkPortStatus{IfName: "eth0"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if strings.Contains(string(b), "Wireless") {
+		t.Errorf("Got %s", string(b))
+	}
+}
+
+func TestWirelessTypeText(t *testing.T) {
+	var wt WirelessType
+	if err := wt.UnmarshalText([]byte("WiFi")); err != nil ||
+		wt != WirelessTypeWifi {
+		t.Errorf("Got %v %v", wt, err)
+	}
+	if err := wt.UnmarshalText([]byte("bluetooth")); err == nil {
+		t.Errorf("Expected error")
+	}
+	if _, err := WirelessType(7).MarshalText(); err == nil {
+		t.Errorf("Expected error")
+	}
+}
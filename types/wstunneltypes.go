@@ -0,0 +1,96 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// WSTunnelStatus is published by wstunnelclient with key "global"
+type WSTunnelStatus struct {
+	ServerName      string
+	Connected       bool
+	ConnectedSince  time.Time // Zero if not connected
+	LastPong        time.Time
+	LastActivity    time.Time // Last request from the controller
+	ReconnectCount  uint32    // Number of connections after the first one
+	ConnectFailures uint32    // Consecutive failures to connect
+	ErrorAndTime              // Last failure
+
+	TrustAnchor string // Root which validated the tunnel server
+}
+
+func (status WSTunnelStatus) Key() string {
+	return "global"
+}
+
+// Uptime of the current connection
+func (status WSTunnelStatus) Uptime() time.Duration {
+	if !status.Connected || status.ConnectedSince.IsZero() {
+		return 0
+	}
+	return time.Since(status.ConnectedSince)
+}
+
+// Events recorded in the remote console audit trail
+const (
+	TunnelAuditOpen         = "tunnel-open"
+	TunnelAuditClose        = "tunnel-close"
+	TunnelAuditChannelOpen  = "channel-open"
+	TunnelAuditChannelClose = "channel-close"
+)
+
+// TunnelAuditEvent is published by wstunnelclient and appended to the
+// persistent audit file. The key is the sequence number.
+type TunnelAuditEvent struct {
+	Sequence    uint64
+	Time        time.Time
+	Event       string // One of the TunnelAudit* strings
+	ServerName  string
+	SessionId   string // From the controller when connecting; may be empty
+	Channel     string // Empty for the tunnel events
+	Destination string // Local host:port for the channel events
+	AppUUIDs    []string
+	AppNames    []string
+	BytesIn     uint64 // From the controller to the device
+	BytesOut    uint64 // From the device to the controller
+	Reason      string // Why the tunnel or channel was closed
+}
+
+func (event TunnelAuditEvent) Key() string {
+	return fmt.Sprintf("%d", event.Sequence)
+}
+
+// RemoteAccessRequest is published by zedagent to ask wstunnelclient for
+// a tunnel channel to a port on an app instance for a time window. The
+// Destination must be an address of that app instance.
+type RemoteAccessRequest struct {
+	RequestId   string
+	AppUUID     string
+	Destination string    // host:port
+	NotBefore   time.Time // Zero means now
+	NotAfter    time.Time
+}
+
+func (req RemoteAccessRequest) Key() string {
+	return req.RequestId
+}
+
+// Active returns true if now is in the time window
+func (req RemoteAccessRequest) Active(now time.Time) bool {
+	if !req.NotBefore.IsZero() && now.Before(req.NotBefore) {
+		return false
+	}
+	return now.Before(req.NotAfter)
+}
+
+// RemoteAccessChannelPrefix starts the name of the channels for the
+// requests; not allowed for other channels
+const RemoteAccessChannelPrefix = "access-"
+
+// ChannelName is the tunnel channel used for the request
+func (req RemoteAccessRequest) ChannelName() string {
+	return RemoteAccessChannelPrefix + req.RequestId
+}
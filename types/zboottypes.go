@@ -3,15 +3,23 @@
 
 package types
 
-type ZbootStatus struct {
+import (
+	"time"
+)
+
+// BaseOsPartitionStatus is the zboot state of IMGA or IMGB plus what is
+// recorded about the image installed in it
+type BaseOsPartitionStatus struct {
 	PartitionLabel   string
 	PartitionDevname string
 	PartitionState   string
 	ShortVersion     string
 	LongVersion      string
+	BuildDate        time.Time // Zero if unknown
+	Checksum         string    // sha256 of the image written; empty if unknown
 	CurrentPartition bool
 }
 
-func (status ZbootStatus) Key() string {
+func (status BaseOsPartitionStatus) Key() string {
 	return status.PartitionLabel
 }
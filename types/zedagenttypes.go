@@ -4,8 +4,10 @@
 package types
 
 import (
+	"fmt"
 	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
@@ -66,8 +68,7 @@ type BaseOsStatus struct {
 	State            SwState
 	MissingDatastore bool // If some DatastoreId not found
 	// error strings across all steps/StorageStatus
-	Error     string
-	ErrorTime time.Time
+	ErrorAndTime
 }
 
 func (status BaseOsStatus) Key() string {
@@ -133,8 +134,7 @@ type CertObjStatus struct {
 	State            SwState
 	MissingDatastore bool // If some DatastoreId not found
 	// error strings across all steps/StorageStatus
-	Error     string
-	ErrorTime time.Time
+	ErrorAndTime
 }
 
 func (status CertObjStatus) Key() string {
@@ -210,3 +210,83 @@ type DatastoreConfig struct {
 func (config DatastoreConfig) Key() string {
 	return config.UUID.String()
 }
+
+// StorageHealthStatus is the SMART health of a disk, published by
+// zedagent with the device name e.g., "sda" as key
+type StorageHealthStatus struct {
+	DevName            string
+	Model              string
+	SerialNumber       string
+	Supported          bool // False if the SMART data could not be read
+	Passed             bool // Overall self-assessment
+	Temperature        int  // Celsius; zero if unknown
+	PowerOnHours       uint64
+	WearPercent        int // Of the rated endurance; -1 if unknown
+	ReallocatedSectors uint64
+	PendingSectors     uint64
+	MediaErrors        uint64 // NVMe
+	Warning            bool   // Failing or close to worn out
+	ErrorAndTime              // Set if smartctl failed
+	UpdateTime         time.Time
+}
+
+func (status StorageHealthStatus) Key() string {
+	return status.DevName
+}
+
+// DiskSpaceLevel is how full a filesystem is compared to the
+// GlobalConfig StorageWarnPercent and StorageCriticalPercent
+type DiskSpaceLevel uint8
+
+const (
+	DiskSpaceOK DiskSpaceLevel = iota
+	DiskSpaceWarning
+	DiskSpaceCritical
+)
+
+func (level DiskSpaceLevel) String() string {
+	switch level {
+	case DiskSpaceOK:
+		return "ok"
+	case DiskSpaceWarning:
+		return "warning"
+	case DiskSpaceCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("Unknown DiskSpaceLevel %d", level)
+	}
+}
+
+// DiskSpaceAlarm is the free space of a filesystem, published by
+// zedagent with the mount path without slashes e.g., "persist" as key
+type DiskSpaceAlarm struct {
+	MountPath   string
+	Level       DiskSpaceLevel
+	LevelTime   time.Time // When the level changed
+	UsedPercent int
+	TotalBytes  uint64
+	FreeBytes   uint64
+	Cleanup     bool // Critical and StorageCleanup is enabled
+}
+
+func (alarm DiskSpaceAlarm) Key() string {
+	key := strings.Replace(strings.Trim(alarm.MountPath, "/"), "/", "-", -1)
+	if key == "" {
+		return "root"
+	}
+	return key
+}
+
+// DiskSpaceLevelFor returns the level for the percent used
+func DiskSpaceLevelFor(usedPercent int, warnPercent uint32,
+	criticalPercent uint32) DiskSpaceLevel {
+
+	switch {
+	case usedPercent >= int(criticalPercent):
+		return DiskSpaceCritical
+	case usedPercent >= int(warnPercent):
+		return DiskSpaceWarning
+	default:
+		return DiskSpaceOK
+	}
+}
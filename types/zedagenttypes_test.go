@@ -0,0 +1,37 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+)
+
+func TestDiskSpaceAlarm(t *testing.T) {
+	keys := map[string]string{
+		"/persist":   "persist",
+		"/config":    "config",
+		"/":          "root",
+		"/var/tmp/x": "var-tmp-x",
+	}
+	for path, expected := range keys {
+		alarm := DiskSpaceAlarm{MountPath: path}
+		if alarm.Key() != expected {
+			t.Errorf("%s: got %s expected %s", path, alarm.Key(),
+				expected)
+		}
+	}
+	levels := map[int]DiskSpaceLevel{
+		0:   DiskSpaceOK,
+		79:  DiskSpaceOK,
+		80:  DiskSpaceWarning,
+		94:  DiskSpaceWarning,
+		95:  DiskSpaceCritical,
+		100: DiskSpaceCritical,
+	}
+	for used, expected := range levels {
+		if level := DiskSpaceLevelFor(used, 80, 95); level != expected {
+			t.Errorf("%d%%: got %s expected %s", used, level, expected)
+		}
+	}
+}
@@ -63,6 +63,19 @@ type AppInstanceConfig struct {
 	PurgeCmd            AppInstanceOpsCmd
 	CloudInitUserData   string // base64-encoded
 	RemoteConsole       bool
+	// Local endpoints carried over the remote console tunnel in
+	// addition to guacamole
+	RemoteConsoleChannels []TunnelChannel
+	// In seconds; if non-zero these override the GlobalConfig limits
+	RemoteConsoleMaxDuration uint32
+	RemoteConsoleIdleTimeout uint32
+}
+
+// TunnelChannel is a local endpoint reached over the websocket tunnel.
+// The Name identifies the channel to the controller.
+type TunnelChannel struct {
+	Name string // E.g., "ssh"
+	Addr string // host:port e.g., "localhost:22"
 }
 
 type AppInstanceOpsCmd struct {
@@ -117,8 +130,7 @@ type AppInstanceStatus struct {
 	MissingNetwork   bool // If some Network UUID not found
 	// All error strings across all steps and all StorageStatus
 	ErrorSource string
-	Error       string
-	ErrorTime   time.Time
+	ErrorAndTime
 }
 
 // Track more complicated workflows
@@ -161,6 +173,7 @@ type EIDOverlayConfig struct {
 	Name string // From proto message
 	EIDConfigDetails
 	ACLs       []ACE
+	Limits     VifLimits
 	AppMacAddr net.HardwareAddr // If set use it for vif
 	AppIPAddr  net.IP           // EIDv4 or EIDv6
 	Network    uuid.UUID
@@ -228,9 +241,8 @@ type StorageStatus struct {
 	ActiveFileLocation string  // Location of filestystem
 	FinalObjDir        string  // Installation dir; may differ from verified
 	MissingDatastore   bool    // If DatastoreId not found
-	Error              string  // Download or verify error
 	ErrorSource        string
-	ErrorTime          time.Time
+	ErrorAndTime       // Download or verify error
 }
 
 // The Intermediate can be a byte sequence of PEM certs
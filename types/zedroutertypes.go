@@ -113,8 +113,7 @@ type AppNetworkStatus struct {
 	UnderlayNetworkList []UnderlayNetworkStatus
 	MissingNetwork      bool // If any Missing flag is set in the networks
 	// Any errros from provisioning the network
-	Error     string
-	ErrorTime time.Time
+	ErrorAndTime
 }
 
 func (status AppNetworkStatus) Key() string {
@@ -259,10 +258,34 @@ const (
 	NPT_LAST = 255
 )
 
+// How to authenticate to a proxy if Username is set
+type ProxyAuthType uint8
+
+const (
+	NPA_BASIC ProxyAuthType = iota
+	NPA_DIGEST
+)
+
 type ProxyEntry struct {
 	Type   NetworkProxyType
 	Server string
 	Port   uint32
+	// If set we talk TLS to the proxy itself i.e., an https:// proxy URL
+	UseTLS   bool
+	Username string
+	Password string // Never logged
+	AuthType ProxyAuthType
+}
+
+// String redacts the password when a ProxyEntry, or a struct containing
+// one, is logged using %v or %+v
+func (entry ProxyEntry) String() string {
+	type plainEntry ProxyEntry
+	plain := plainEntry(entry)
+	if plain.Password != "" {
+		plain.Password = "<redacted>"
+	}
+	return fmt.Sprintf("%+v", plain)
 }
 
 type ProxyConfig struct {
@@ -283,6 +306,11 @@ type DhcpConfig struct {
 	DomainName string
 	NtpServer  net.IP
 	DnsServers []net.IP // If not set we use Gateway as DNS server
+	// For DT_CLIENT; if no address after DhcpTimeout seconds we add the
+	// fallback address until DHCP provides one
+	DhcpTimeout        uint32 `json:",omitempty"`
+	FallbackAddrSubnet string `json:",omitempty"` // In CIDR
+	FallbackGateway    net.IP `json:",omitempty"`
 }
 
 type NetworkPortConfig struct {
@@ -302,8 +330,30 @@ type NetworkPortStatus struct {
 	NetworkObjectConfig
 	AddrInfoList []AddrInfo
 	ProxyConfig
-	Error     string
-	ErrorTime time.Time
+	Wireless     *WirelessStatus `json:",omitempty"` // Nil for wired ports
+	DhcpFallback bool            // Using FallbackAddrSubnet since DHCP failed
+	AddrConflict *AddrConflict   `json:",omitempty"` // Nil if none
+	ErrorAndTime
+}
+
+// ErrorCode in the ErrorAndTime of a NetworkPortStatus
+const (
+	PortErrorAddrConflict = 1 // See AddrConflict
+	PortErrorAssigned     = 2 // In pciback e.g., assigned to an application
+	PortErrorMissing      = 3 // No such interface
+)
+
+// AddrConflict is another host using the IPv4 address of a port as found
+// by address conflict detection (RFC 5227)
+type AddrConflict struct {
+	Addr net.IP
+	Mac  string // Of the other host
+	Time time.Time
+}
+
+func (conflict AddrConflict) String() string {
+	return fmt.Sprintf("Address conflict: %s in use by %s",
+		conflict.Addr, conflict.Mac)
 }
 
 type AddrInfo struct {
@@ -316,7 +366,21 @@ type AddrInfo struct {
 type DeviceNetworkStatus struct {
 	Version DevicePortConfigVersion // From DevicePortConfig
 	Testing bool                    // Ignore since it is not yet verified
-	Ports   []NetworkPortStatus
+	// From the DevicePortConfig used to make this status
+	DPCKey        string
+	TimePriority  time.Time
+	LastFailed    time.Time
+	LastSucceeded time.Time
+	Ports         []NetworkPortStatus
+}
+
+// SetDPC records which DevicePortConfig the status is from
+func (status *DeviceNetworkStatus) SetDPC(config DevicePortConfig) {
+	status.Version = config.Version
+	status.DPCKey = config.Key
+	status.TimePriority = config.TimePriority
+	status.LastFailed = config.LastFailed
+	status.LastSucceeded = config.LastSucceeded
 }
 
 func (status *DeviceNetworkStatus) GetPortByName(
@@ -813,6 +877,7 @@ type OverlayNetworkConfig struct {
 	EID           net.IP // Always EIDv6
 	LispSignature string
 	ACLs          []ACE
+	Limits        VifLimits
 	AppMacAddr    net.HardwareAddr // If set use it for vif
 	AppIPAddr     net.IP           // EIDv4 or EIDv6
 
@@ -889,6 +954,7 @@ type UnderlayNetworkConfig struct {
 	//   support.
 	UsesNetworkInstance bool
 	ACLs                []ACE
+	Limits              VifLimits
 }
 
 type UnderlayNetworkStatus struct {
@@ -950,6 +1016,8 @@ type NetworkInstanceInfo struct {
 
 	// interface names for the Port
 	IfNameList []string // Recorded at time of activate
+	// The one with the preferred default route in the bridge table
+	CurrentUplink string
 
 	// Collection of address assignments; from MAC address to IP address
 	IPAssignments map[string]net.IP
@@ -963,8 +1031,7 @@ type NetworkInstanceInfo struct {
 	Ipv4Eid bool // Track if this is a CryptoEid with IPv4 EIDs
 
 	// Any errrors from provisioning the network
-	Error     string
-	ErrorTime time.Time
+	ErrorAndTime
 
 	// Vif metric map. This should have a union of currently existing
 	// vifs and previously deleted vifs.
@@ -1081,8 +1148,7 @@ type NetworkServiceStatus struct {
 
 	MissingNetwork bool // If AppLink UUID not found
 	// Any errrors from provisioning the service
-	Error          string
-	ErrorTime      time.Time
+	ErrorAndTime
 	VpnStatus      *ServiceVpnStatus
 	LispInfoStatus *LispInfoStatus
 	LispMetrics    *LispMetrics
@@ -1212,7 +1278,8 @@ type NetworkInstanceConfig struct {
 	NtpServer       net.IP
 	DnsServers      []net.IP // If not set we use Gateway as DNS server
 	DhcpRange       IpRange
-	DnsNameToIPList []DnsNameToIP // Used for DNS and ACL ipset
+	DnsNameToIPList []DnsNameToIP    // Used for DNS and ACL ipset
+	StaticNeighbors []StaticNeighbor // Permanent ARP/ND entries on the bridge
 
 	HasEncap bool // Lisp/Vpn, for adjusting pMTU
 	// For other network services - Proxy / Lisp /StrongSwan etc..
@@ -1220,6 +1287,13 @@ type NetworkInstanceConfig struct {
 	LispConfig   NetworkInstanceLispConfig
 }
 
+// StaticNeighbor is a permanent ARP or ND entry for an app or a device
+// on the bridge which does not answer ARP/ND reliably
+type StaticNeighbor struct {
+	IP  net.IP
+	Mac net.HardwareAddr
+}
+
 func (config *NetworkInstanceConfig) Key() string {
 	return config.UUID.String()
 }
@@ -1364,6 +1438,13 @@ func (status *NetworkInstanceStatus) IsUsingPort(port string) bool {
 	return false
 }
 
+// VifLimits caps what an app can use through one vif; zero is unlimited
+type VifLimits struct {
+	RxBandwidth    uint64 // Bits per second towards the app
+	TxBandwidth    uint64 // Bits per second from the app
+	MaxConnections uint32 // Concurrent flows initiated by the app
+}
+
 // Similar support as in draft-ietf-netmod-acl-model
 type ACE struct {
 	Matches []ACEMatch
@@ -1647,3 +1728,96 @@ type VpnMetrics struct {
 	PhyErrStat LinkPktStats
 	VpnConns   []*VpnConnMetrics
 }
+
+// FlowCountMetrics is the conntrack summary for an app instance,
+// published by zedrouter
+type FlowCountMetrics struct {
+	UUIDandVersion UUIDandVersion
+	DisplayName    string
+	TotalFlows     int
+	ProtocolFlows  map[string]int // Flows per protocol name e.g., "tcp"
+	TopTalkers     []FlowTalker
+}
+
+func (metrics FlowCountMetrics) Key() string {
+	return metrics.UUIDandVersion.UUID.String()
+}
+
+// FlowTalker is a remote endpoint of an app instance
+type FlowTalker struct {
+	RemoteIP net.IP
+	Flows    int
+	Packets  uint64
+	Bytes    uint64
+}
+
+// ConntrackStatus is the usage of the conntrack table, published by
+// zedrouter with key "global"
+type ConntrackStatus struct {
+	Count       int
+	Max         int
+	Percent     int
+	Warning     bool // Above the GlobalConfig ConntrackWarnPercent
+	WarningTime time.Time
+	Evicting    bool // Deleting the idle TCP flows
+}
+
+func (status ConntrackStatus) Key() string {
+	return "global"
+}
+
+// AppNetworkEvent is published by zedrouter when the uplink of a network
+// instance used by an app changed and GlobalConfig UplinkChangeNotify
+// is "event"
+type AppNetworkEvent struct {
+	AppUUID         uuid.UUID
+	NetworkInstance uuid.UUID
+	OldUplink       string
+	NewUplink       string
+	Time            time.Time
+}
+
+func (event AppNetworkEvent) Key() string {
+	return event.AppUUID.String() + "-" + event.NetworkInstance.String()
+}
+
+// FirewallStatus is the iptables rules set by an agent, published by
+// each agent which sets rules with the agent name as key
+type FirewallStatus struct {
+	AgentName string
+	Owners    []FirewallOwnerStatus
+}
+
+func (status FirewallStatus) Key() string {
+	return status.AgentName
+}
+
+// FirewallOwnerStatus is the rules of one owner e.g., "ssh" or the ACLs
+// of an app interface. Rules are shown as for iptables -A.
+type FirewallOwnerStatus struct {
+	Owner        string
+	IPv4Rules    []string
+	IPv6Rules    []string
+	ErrorAndTime // Last apply or verify failure if any
+}
+
+// RejectedConnections summarizes the logged packets which were rejected
+// on the uplinks, published by nim with key "global"
+type RejectedConnections struct {
+	Sources []RejectedSource // Most recent first
+}
+
+func (status RejectedConnections) Key() string {
+	return "global"
+}
+
+// RejectedSource is the packets from a source to a port
+type RejectedSource struct {
+	IfName    string
+	Protocol  uint8
+	SrcIP     net.IP
+	DstPort   uint16
+	Count     uint64
+	FirstTime time.Time
+	LastTime  time.Time
+}
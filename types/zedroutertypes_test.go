@@ -4,6 +4,8 @@
 package types
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -43,3 +45,18 @@ func TestIsIPv6(t *testing.T) {
 	}
 	log.Infof("TestIsIPv6: DONE\n")
 }
+
+func TestProxyEntryString(t *testing.T) {
+	port := NetworkPortConfig{IfName: "eth0"}
+	port.Proxies = []ProxyEntry{{Server: "proxy", Port: 8080,
+		Username: "user", Password: "secret"}}
+	for _, format := range []string{"%v", "%+v"} {
+		out := fmt.Sprintf(format, port)
+		if strings.Contains(out, "secret") {
+			t.Errorf("Password in %s output %s", format, out)
+		}
+		if !strings.Contains(out, "user") {
+			t.Errorf("Username missing in %s output %s", format, out)
+		}
+	}
+}
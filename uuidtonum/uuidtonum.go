@@ -38,7 +38,11 @@ func UuidToNumAllocate(pub *pubsub.Publication, uuid uuid.UUID,
 		pub.Publish(u.Key(), u)
 		return
 	}
-	u := cast.CastUuidToNum(i)
+	u, err := cast.CastUuidToNum(i)
+	if err != nil {
+		log.Errorf("UuidToNumAllocate: %s\n", err)
+		return
+	}
 	if u.NumType != numType {
 		log.Fatalf("UuidToNumAllocate(%s) wrong numType %s vs. %s\n",
 			uuid.String(), u.NumType, numType)
@@ -75,7 +79,11 @@ func UuidToNumFree(pub *pubsub.Publication, uuid uuid.UUID) {
 	if err != nil {
 		log.Fatalf("UuidToNumFree(%s) does not exist\n", uuid.String())
 	}
-	u := cast.CastUuidToNum(i)
+	u, err := cast.CastUuidToNum(i)
+	if err != nil {
+		log.Errorf("UuidToNumFree: %s\n", err)
+		return
+	}
 	u.InUse = false
 	u.LastUseTime = time.Now()
 	log.Infof("UuidToNumFree(%s) publishing updated %v\n",
@@ -109,7 +117,11 @@ func UuidToNumGet(pub *pubsub.Publication, uuid uuid.UUID,
 	if err != nil {
 		return 0, err
 	}
-	u := cast.CastUuidToNum(i)
+	u, err := cast.CastUuidToNum(i)
+	if err != nil {
+		log.Errorf("UuidToNumGet: %s\n", err)
+		return 0, err
+	}
 	if u.Key() != key {
 		errStr := fmt.Sprintf("UuidToNumGet key/UUID mismatch %s vs %s; ignored %+v",
 			key, u.Key(), u)
@@ -129,7 +141,11 @@ func UuidToNumGetOldestUnused(pub *pubsub.Publication,
 	oldest := new(types.UuidToNum)
 	items := pub.GetAll()
 	for key, st := range items {
-		status := cast.CastUuidToNum(st)
+		status, err := cast.CastUuidToNum(st)
+		if err != nil {
+			log.Errorf("UuidToNumGetOldestUnused: %s\n", err)
+			continue
+		}
 		if status.Key() != key {
 			log.Errorf("UuidToNumGetOldestUnused key/UUID mismatch %s vs %s; ignored %+v\n",
 				key, status.Key(), status)
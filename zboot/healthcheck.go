@@ -0,0 +1,93 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Health checks after an update. The caller registers the checks and
+// runs them periodically once the update has run for a while. If they
+// have not all passed within the window the update should be rolled
+// back by rebooting while the current partition is still inprogress.
+
+package zboot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HealthCheckResult of running all the checks
+type HealthCheckResult uint8
+
+const (
+	HealthCheckPending HealthCheckResult = iota // Failures within window
+	HealthCheckPassed
+	HealthCheckFailed // Failures after the window
+)
+
+func (r HealthCheckResult) String() string {
+	switch r {
+	case HealthCheckPending:
+		return "pending"
+	case HealthCheckPassed:
+		return "passed"
+	case HealthCheckFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("Unknown HealthCheckResult %d", r)
+	}
+}
+
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// HealthChecker has the checks which must pass before Commit
+type HealthChecker struct {
+	checks []healthCheck
+	window time.Duration
+	start  time.Time // Of the first Run
+}
+
+// NewHealthChecker with the time the checks have to pass after the
+// first Run
+func NewHealthChecker(window time.Duration) *HealthChecker {
+	return &HealthChecker{window: window}
+}
+
+// Register a check which returns an error describing the failure
+func (hc *HealthChecker) Register(name string, check func() error) {
+	hc.checks = append(hc.checks, healthCheck{name: name, check: check})
+}
+
+// Run runs all the checks and returns the failures with the check names
+func (hc *HealthChecker) Run(now time.Time) (HealthCheckResult, []string) {
+	if hc.start.IsZero() {
+		hc.start = now
+	}
+	var failures []string
+	for _, c := range hc.checks {
+		if err := c.check(); err != nil {
+			failures = append(failures,
+				fmt.Sprintf("%s: %s", c.name, err))
+		}
+	}
+	if len(failures) == 0 {
+		log.Infof("HealthChecker: %d checks passed\n", len(hc.checks))
+		return HealthCheckPassed, nil
+	}
+	if now.Sub(hc.start) < hc.window {
+		log.Infof("HealthChecker: failed %v; %v left\n", failures,
+			hc.window-now.Sub(hc.start))
+		return HealthCheckPending, failures
+	}
+	log.Errorf("HealthChecker: failed %v after %v\n", failures, hc.window)
+	return HealthCheckFailed, failures
+}
+
+// FailureReason is for the reboot-reason file
+func FailureReason(failures []string) string {
+	return fmt.Sprintf("Update health checks failed: %s",
+		strings.Join(failures, "; "))
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zboot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	agentsOK := false
+	hc := NewHealthChecker(time.Minute)
+	hc.Register("controller", func() error { return nil })
+	hc.Register("agents", func() error {
+		if agentsOK {
+			return nil
+		}
+		return errors.New("nim not running")
+	})
+
+	start := time.Now()
+	result, failures := hc.Run(start)
+	if result != HealthCheckPending || len(failures) != 1 ||
+		failures[0] != "agents: nim not running" {
+		t.Errorf("first Run got %s %v", result, failures)
+	}
+	result, _ = hc.Run(start.Add(30 * time.Second))
+	if result != HealthCheckPending {
+		t.Errorf("within window got %s", result)
+	}
+	result, failures = hc.Run(start.Add(2 * time.Minute))
+	if result != HealthCheckFailed || len(failures) != 1 {
+		t.Errorf("after window got %s %v", result, failures)
+	}
+	reason := FailureReason(failures)
+	if reason != "Update health checks failed: agents: nim not running" {
+		t.Errorf("FailureReason got %s", reason)
+	}
+	agentsOK = true
+	result, failures = hc.Run(start.Add(3 * time.Minute))
+	if result != HealthCheckPassed || failures != nil {
+		t.Errorf("passing got %s %v", result, failures)
+	}
+}
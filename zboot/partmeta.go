@@ -0,0 +1,92 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// What is known about the image installed in each partition. The version
+// and build date come from the image itself; the checksum is the sha256
+// of the verified image which was written to the partition, recorded in
+// /persist since it can not be part of the image.
+
+package zboot
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const checksumDirname = "/persist/status/zboot"
+
+// PartitionMetadata for IMGA or IMGB
+type PartitionMetadata struct {
+	Version   string
+	BuildDate time.Time // When the version file was built into the image
+	Checksum  string    // Empty if not written by us
+}
+
+// GetPartitionMetadata reads the metadata for the partition. Mounts the
+// other partition hence fails if it does not contain an image.
+func GetPartitionMetadata(partName string) (PartitionMetadata, error) {
+	var meta PartitionMetadata
+	if err := checkPartitionName(partName); err != nil {
+		return meta, err
+	}
+	version, buildDate, err := readPartitionFile(partName, shortVersionFile)
+	if err != nil {
+		errStr := fmt.Sprintf("GetPartitionMetadata(%s): %s",
+			partName, err)
+		return meta, errors.New(errStr)
+	}
+	meta.Version = strings.TrimSpace(string(version))
+	meta.BuildDate = buildDate
+	meta.Checksum = readPartitionChecksum(checksumDirname, partName)
+	return meta, nil
+}
+
+// RecordPartitionChecksum after the image with that sha256 has been
+// written to the partition
+func RecordPartitionChecksum(partName string, checksum string) error {
+	if err := checkPartitionName(partName); err != nil {
+		return err
+	}
+	return writePartitionChecksum(checksumDirname, partName, checksum)
+}
+
+// clearPartitionChecksum when we start writing to the partition
+func clearPartitionChecksum(partName string) {
+	filename := checksumFilename(checksumDirname, partName)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		log.Errorf("clearPartitionChecksum: %s\n", err)
+	}
+}
+
+func checksumFilename(dirname string, partName string) string {
+	return filepath.Join(dirname, partName+".sha256")
+}
+
+func readPartitionChecksum(dirname string, partName string) string {
+	b, err := ioutil.ReadFile(checksumFilename(dirname, partName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func writePartitionChecksum(dirname string, partName string, checksum string) error {
+	if err := os.MkdirAll(dirname, 0700); err != nil {
+		return err
+	}
+	filename := checksumFilename(dirname, partName)
+	tmpname := filename + ".tmp"
+	err := ioutil.WriteFile(tmpname, []byte(strings.ToLower(checksum)+"\n"),
+		0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpname, filename)
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zboot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPartitionChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "partmeta_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if checksum := readPartitionChecksum(dir, "IMGB"); checksum != "" {
+		t.Errorf("got %s before write", checksum)
+	}
+	err = writePartitionChecksum(dir+"/zboot", "IMGB", "ABCDEF0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum := readPartitionChecksum(dir+"/zboot", "IMGB"); checksum != "abcdef0123" {
+		t.Errorf("got %s after write", checksum)
+	}
+	if checksum := readPartitionChecksum(dir+"/zboot", "IMGA"); checksum != "" {
+		t.Errorf("got %s for other partition", checksum)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Partition state API. The state changes check the current states and
+// then call zboot set_partstate; each is done as a transaction holding a
+// lock across the agents so that concurrent callers can not interleave.
+// The lifecycle of an update on the other partition is
+//	MarkTesting: unused -> updating; boot tries it next
+//	(boot): updating -> inprogress
+//	Commit: current inprogress -> active and other active -> unused
+//	Rollback: other updating/inprogress -> unused
+// We might crash between any two set_partstate calls, hence each
+// transaction keeps an active partition for boot to fall back to.
+
+package zboot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PartitionState is the zboot state of IMGA or IMGB
+type PartitionState string
+
+const (
+	PartStateActive     PartitionState = "active"
+	PartStateInProgress PartitionState = "inprogress" // Being tested
+	PartStateUnused     PartitionState = "unused"
+	PartStateUpdating   PartitionState = "updating" // Tested at next boot
+)
+
+// Valid returns true for the states zboot knows about
+func (state PartitionState) Valid() bool {
+	switch state {
+	case PartStateActive, PartStateInProgress, PartStateUnused,
+		PartStateUpdating:
+		return true
+	default:
+		return false
+	}
+}
+
+const lockTimeout = 60 * time.Second
+
+// Replaced by the tests
+var lockFilename = "/var/run/zboot.lock"
+var readPartitionState = GetPartitionState
+var writePartitionState = setPartitionState
+
+// Serializes the transactions within the process; the file lock does it
+// across processes
+var transactionMutex sync.Mutex
+
+// transaction runs fn holding the locks
+func transaction(name string, fn func() error) error {
+	transactionMutex.Lock()
+	defer transactionMutex.Unlock()
+
+	f, err := os.OpenFile(lockFilename, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fd := int(f.Fd())
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK || time.Now().After(deadline) {
+			errStr := fmt.Sprintf("%s: lock %s failed: %s",
+				name, lockFilename, err)
+			return errors.New(errStr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	log.Infof("zboot transaction %s\n", name)
+	if err := fn(); err != nil {
+		log.Errorf("zboot transaction %s failed: %s\n", name, err)
+		return err
+	}
+	return nil
+}
+
+func checkPartitionName(partName string) error {
+	if partName == "IMGA" || partName == "IMGB" {
+		return nil
+	}
+	errStr := fmt.Sprintf("invalid partition %s", partName)
+	return errors.New(errStr)
+}
+
+// GetPartitionState asks zboot
+func GetPartitionState(partName string) (PartitionState, error) {
+	if err := checkPartitionName(partName); err != nil {
+		return "", err
+	}
+	if !IsAvailable() {
+		if partName == "IMGA" {
+			return PartStateActive, nil
+		}
+		return PartStateUnused, nil
+	}
+	ret, err := execWithRetry(false, "zboot", "partstate", partName)
+	if err != nil {
+		errStr := fmt.Sprintf("zboot partstate %s: %s", partName, err)
+		return "", errors.New(errStr)
+	}
+	state := PartitionState(strings.TrimSpace(string(ret)))
+	if !state.Valid() {
+		errStr := fmt.Sprintf("zboot partstate %s: invalid state %s",
+			partName, state)
+		return "", errors.New(errStr)
+	}
+	return state, nil
+}
+
+func setPartitionState(partName string, state PartitionState) error {
+	log.Infof("setPartitionState(%s, %s)\n", partName, state)
+	if err := checkPartitionName(partName); err != nil {
+		return err
+	}
+	if !state.Valid() {
+		errStr := fmt.Sprintf("invalid partition state %s", state)
+		return errors.New(errStr)
+	}
+	_, err := execWithRetry(true, "zboot", "set_partstate",
+		partName, string(state))
+	if err != nil {
+		errStr := fmt.Sprintf("zboot set_partstate %s %s: %s",
+			partName, state, err)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+func checkOtherPartition(partName string) error {
+	if err := checkPartitionName(partName); err != nil {
+		return err
+	}
+	if partName != GetOtherPartition() {
+		errStr := fmt.Sprintf("not other partition %s", partName)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// MarkTesting marks the other partition, into which a new image has been
+// or is being written, to be booted and tested next
+func MarkTesting(partName string) error {
+	return transaction("MarkTesting "+partName, func() error {
+		if err := checkOtherPartition(partName); err != nil {
+			return err
+		}
+		return markTesting(GetCurrentPartition(), partName)
+	})
+}
+
+// The current partition must be active so that boot falls back to it if
+// the other fails
+func markTesting(curPart string, otherPart string) error {
+	curState, err := readPartitionState(curPart)
+	if err != nil {
+		return err
+	}
+	if curState != PartStateActive {
+		errStr := fmt.Sprintf("current partition %s is %s not active",
+			curPart, curState)
+		return errors.New(errStr)
+	}
+	state, err := readPartitionState(otherPart)
+	if err != nil {
+		return err
+	}
+	if state == PartStateActive {
+		errStr := fmt.Sprintf("other partition %s is active",
+			otherPart)
+		return errors.New(errStr)
+	}
+	return writePartitionState(otherPart, PartStateUpdating)
+}
+
+// Commit transitions the current partition from inprogress to active,
+// and the other from active or inprogress to unused
+func Commit() error {
+	return transaction("Commit", func() error {
+		return commit(GetCurrentPartition(), GetOtherPartition())
+	})
+}
+
+// The current partition is marked active before the other is marked
+// unused. A crash in between leaves both active, and either boots. Once
+// the current is active it stays active even if the other is in an
+// unexpected state, since it has passed its tests.
+func commit(curPart string, otherPart string) error {
+	state, err := readPartitionState(curPart)
+	if err != nil {
+		return err
+	}
+	if state != PartStateInProgress {
+		errStr := fmt.Sprintf("Current partition %s, is %s not inprogress",
+			curPart, state)
+		return errors.New(errStr)
+	}
+	if err := writePartitionState(curPart, PartStateActive); err != nil {
+		return err
+	}
+	otherState, err := readPartitionState(otherPart)
+	if err != nil {
+		return err
+	}
+	switch otherState {
+	case PartStateActive:
+		// Normal case
+	case PartStateInProgress:
+		// Activated what was already on the other partition
+	case PartStateUnused:
+		return nil
+	default:
+		errStr := fmt.Sprintf("Other partition %s, is %s not active/inprogress",
+			otherPart, otherState)
+		return errors.New(errStr)
+	}
+	return writePartitionState(otherPart, PartStateUnused)
+}
+
+// Rollback marks the other partition unused so that it is not booted
+func Rollback(partName string) error {
+	return transaction("Rollback "+partName, func() error {
+		if err := checkOtherPartition(partName); err != nil {
+			return err
+		}
+		return rollback(GetCurrentPartition(), partName)
+	})
+}
+
+// An active other partition is only marked unused if the current one is
+// active; otherwise there would be nothing to boot
+func rollback(curPart string, otherPart string) error {
+	state, err := readPartitionState(otherPart)
+	if err != nil {
+		return err
+	}
+	if state == PartStateActive {
+		curState, err := readPartitionState(curPart)
+		if err != nil {
+			return err
+		}
+		if curState != PartStateActive {
+			errStr := fmt.Sprintf("other partition %s is active and current %s is %s",
+				otherPart, curPart, curState)
+			return errors.New(errStr)
+		}
+	}
+	return writePartitionState(otherPart, PartStateUnused)
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zboot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePartStates replaces zboot with a map. Writes fail, like a crash,
+// once maxWrites is reached; negative means never.
+type fakePartStates struct {
+	states    map[string]PartitionState
+	writes    int
+	maxWrites int
+}
+
+func (f *fakePartStates) install() func() {
+	readPartitionState = func(partName string) (PartitionState, error) {
+		return f.states[partName], nil
+	}
+	writePartitionState = func(partName string, state PartitionState) error {
+		if f.maxWrites >= 0 && f.writes >= f.maxWrites {
+			return errors.New("crashed")
+		}
+		f.writes++
+		f.states[partName] = state
+		return nil
+	}
+	return func() {
+		readPartitionState = GetPartitionState
+		writePartitionState = setPartitionState
+	}
+}
+
+// Whatever it tries first, boot falls back to an active partition
+func bootable(states map[string]PartitionState) bool {
+	return states["IMGA"] == PartStateActive ||
+		states["IMGB"] == PartStateActive
+}
+
+func TestPartStateTransitions(t *testing.T) {
+	tests := map[string]struct {
+		fn       func() error
+		before   [2]PartitionState // IMGA current, IMGB other
+		after    [2]PartitionState
+		expError bool
+	}{
+		"MarkTesting": {
+			fn:     func() error { return markTesting("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateActive, PartStateUnused},
+			after:  [2]PartitionState{PartStateActive, PartStateUpdating},
+		},
+		"MarkTesting while testing": {
+			fn:       func() error { return markTesting("IMGA", "IMGB") },
+			before:   [2]PartitionState{PartStateInProgress, PartStateUnused},
+			after:    [2]PartitionState{PartStateInProgress, PartStateUnused},
+			expError: true,
+		},
+		"MarkTesting other active": {
+			fn:       func() error { return markTesting("IMGA", "IMGB") },
+			before:   [2]PartitionState{PartStateActive, PartStateActive},
+			after:    [2]PartitionState{PartStateActive, PartStateActive},
+			expError: true,
+		},
+		"Commit": {
+			fn:     func() error { return commit("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateInProgress, PartStateActive},
+			after:  [2]PartitionState{PartStateActive, PartStateUnused},
+		},
+		"Commit other inprogress": {
+			fn:     func() error { return commit("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateInProgress, PartStateInProgress},
+			after:  [2]PartitionState{PartStateActive, PartStateUnused},
+		},
+		"Commit other unused": {
+			fn:     func() error { return commit("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateInProgress, PartStateUnused},
+			after:  [2]PartitionState{PartStateActive, PartStateUnused},
+		},
+		// The current partition passed its tests hence is still
+		// committed
+		"Commit other updating": {
+			fn:       func() error { return commit("IMGA", "IMGB") },
+			before:   [2]PartitionState{PartStateInProgress, PartStateUpdating},
+			after:    [2]PartitionState{PartStateActive, PartStateUpdating},
+			expError: true,
+		},
+		"Commit not testing": {
+			fn:       func() error { return commit("IMGA", "IMGB") },
+			before:   [2]PartitionState{PartStateActive, PartStateUnused},
+			after:    [2]PartitionState{PartStateActive, PartStateUnused},
+			expError: true,
+		},
+		"Rollback": {
+			fn:     func() error { return rollback("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateActive, PartStateUpdating},
+			after:  [2]PartitionState{PartStateActive, PartStateUnused},
+		},
+		"Rollback fallback": {
+			fn:       func() error { return rollback("IMGA", "IMGB") },
+			before:   [2]PartitionState{PartStateInProgress, PartStateActive},
+			after:    [2]PartitionState{PartStateInProgress, PartStateActive},
+			expError: true,
+		},
+	}
+	for name, test := range tests {
+		f := fakePartStates{maxWrites: -1,
+			states: map[string]PartitionState{
+				"IMGA": test.before[0], "IMGB": test.before[1]}}
+		restore := f.install()
+		err := test.fn()
+		restore()
+		if (err != nil) != test.expError {
+			t.Errorf("%s: got error %v\n", name, err)
+		}
+		if f.states["IMGA"] != test.after[0] ||
+			f.states["IMGB"] != test.after[1] {
+			t.Errorf("%s: got %v\n", name, f.states)
+		}
+	}
+}
+
+// Whichever set_partstate we crash before, there is still a partition to
+// boot
+func TestPartStateCrash(t *testing.T) {
+	tests := map[string]struct {
+		fn     func() error
+		before [2]PartitionState
+	}{
+		"MarkTesting": {
+			fn:     func() error { return markTesting("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateActive, PartStateUnused},
+		},
+		"Commit": {
+			fn:     func() error { return commit("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateInProgress, PartStateActive},
+		},
+		"Rollback": {
+			fn:     func() error { return rollback("IMGA", "IMGB") },
+			before: [2]PartitionState{PartStateActive, PartStateInProgress},
+		},
+	}
+	for name, test := range tests {
+		for crashAt := 0; crashAt <= 2; crashAt++ {
+			f := fakePartStates{maxWrites: crashAt,
+				states: map[string]PartitionState{
+					"IMGA": test.before[0], "IMGB": test.before[1]}}
+			restore := f.install()
+			test.fn()
+			restore()
+			if !bootable(f.states) {
+				t.Errorf("%s: crash after %d writes left %v\n",
+					name, crashAt, f.states)
+			}
+		}
+	}
+}
+
+func TestTransactionLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "partstate")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	saved := lockFilename
+	lockFilename = filepath.Join(dir, "zboot.lock")
+	defer func() { lockFilename = saved }()
+
+	ran := false
+	if err := transaction("test", func() error {
+		ran = true
+		return nil
+	}); err != nil || !ran {
+		t.Errorf("transaction got %v ran %v\n", err, ran)
+	}
+	expected := errors.New("failed")
+	if err := transaction("test", func() error {
+		return expected
+	}); err != expected {
+		t.Errorf("transaction got %v\n", err)
+	}
+}
@@ -52,8 +52,11 @@ func Reset() {
 	}
 }
 
+// zboot can hang in the kernel hence we retry a few times on timeout
+const execRetries = 5
+
 func execWithRetry(dolog bool, command string, args ...string) ([]byte, error) {
-	for {
+	for i := 0; i < execRetries; i++ {
 		out, done, err := execWithTimeout(dolog, command, args...)
 		if err != nil {
 			return out, err
@@ -63,6 +66,9 @@ func execWithRetry(dolog bool, command string, args ...string) ([]byte, error) {
 		}
 		log.Errorf("Retrying %s %v", command, args)
 	}
+	errStr := fmt.Sprintf("%s %v timed out %d times", command, args,
+		execRetries)
+	return nil, errors.New(errStr)
 }
 
 func execWithTimeout(dolog bool, command string, args ...string) ([]byte, bool, error) {
@@ -153,22 +159,11 @@ func GetOtherPartition() string {
 	return partName
 }
 
+// validatePartitionName is fatal for an invalid partName
 func validatePartitionName(partName string) {
-
-	if partName == "IMGA" || partName == "IMGB" {
-		return
-	}
-	errStr := fmt.Sprintf("invalid partition %s", partName)
-	log.Fatal(errStr)
-}
-
-func validatePartitionState(partState string) {
-	if partState == "active" || partState == "inprogress" ||
-		partState == "unused" || partState == "updating" {
-		return
+	if err := checkPartitionName(partName); err != nil {
+		log.Fatal(err)
 	}
-	errStr := fmt.Sprintf("invalid partition state %s", partState)
-	log.Fatal(errStr)
 }
 
 func IsCurrentPartition(partName string) bool {
@@ -183,50 +178,6 @@ func IsOtherPartition(partName string) bool {
 	return otherPartName == partName
 }
 
-//  get/set api routines
-func GetPartitionState(partName string) string {
-
-	validatePartitionName(partName)
-	if !IsAvailable() {
-		if partName == "IMGA" {
-			return "active"
-		} else {
-			return "unused"
-		}
-	}
-	ret, err := execWithRetry(false, "zboot", "partstate", partName)
-	if err != nil {
-		log.Fatalf("zboot partstate %s: err %v\n", partName, err)
-	}
-	partState := string(ret)
-	partState = strings.TrimSpace(partState)
-	return partState
-}
-
-func IsPartitionState(partName string, partState string) bool {
-
-	validatePartitionName(partName)
-	validatePartitionState(partState)
-
-	curPartState := GetPartitionState(partName)
-	res := curPartState == partState
-	return res
-}
-
-func setPartitionState(partName string, partState string) {
-
-	log.Infof("setPartitionState(%s, %s)\n", partName, partState)
-	validatePartitionName(partName)
-	validatePartitionState(partState)
-
-	_, err := execWithRetry(true, "zboot", "set_partstate",
-		partName, partState)
-	if err != nil {
-		log.Fatalf("zboot set_partstate %s %s: err %v\n",
-			partName, partState, err)
-	}
-}
-
 // Cache - doesn't change in running system
 var partDev = make(map[string]string)
 
@@ -252,88 +203,16 @@ func GetPartitionDevname(partName string) string {
 	return devName
 }
 
-// set routines
-func setPartitionStateActive(partName string) {
-	setPartitionState(partName, "active")
-}
-
-func setPartitionStateUnused(partName string) {
-	setPartitionState(partName, "unused")
-}
-
-func setPartitionStateUpdating(partName string) {
-	setPartitionState(partName, "updating")
-}
-
-// check routines, for current partition
-func IsCurrentPartitionStateActive() bool {
-	partName := GetCurrentPartition()
-	return IsPartitionState(partName, "active")
-}
-
-func IsCurrentPartitionStateInProgress() bool {
-	partName := GetCurrentPartition()
-	return IsPartitionState(partName, "inprogress")
-}
-
-func IsCurrentPartitionStateUpdating() bool {
-	partName := GetCurrentPartition()
-	return IsPartitionState(partName, "updating")
-}
-
-// check routines, for other partition
-func IsOtherPartitionStateActive() bool {
-	partName := GetOtherPartition()
-	return IsPartitionState(partName, "active")
-}
-
+// IsOtherPartitionStateInProgress returns false if the state can not be
+// determined
 func IsOtherPartitionStateInProgress() bool {
 	partName := GetOtherPartition()
-	return IsPartitionState(partName, "inprogress")
-}
-
-func IsOtherPartitionStateUnused() bool {
-	partName := GetOtherPartition()
-	return IsPartitionState(partName, "unused")
-}
-
-func IsOtherPartitionStateUpdating() bool {
-	if !IsAvailable() {
+	state, err := GetPartitionState(partName)
+	if err != nil {
+		log.Errorf("IsOtherPartitionStateInProgress: %s\n", err)
 		return false
 	}
-	partName := GetOtherPartition()
-	return IsPartitionState(partName, "updating")
-}
-
-func setCurrentPartitionStateActive() {
-	partName := GetCurrentPartition()
-	setPartitionState(partName, "active")
-}
-
-func setCurrentPartitionStateUpdating() {
-	partName := GetCurrentPartition()
-	setPartitionState(partName, "updating")
-}
-
-func setCurrentPartitionStateUnused() {
-	partName := GetCurrentPartition()
-	setPartitionState(partName, "unused")
-}
-
-// set routines, for other partition
-func setOtherPartitionStateActive() {
-	partName := GetOtherPartition()
-	setPartitionState(partName, "active")
-}
-
-func SetOtherPartitionStateUpdating() {
-	partName := GetOtherPartition()
-	setPartitionState(partName, "updating")
-}
-
-func SetOtherPartitionStateUnused() {
-	partName := GetOtherPartition()
-	setPartitionState(partName, "unused")
+	return state == PartStateInProgress
 }
 
 func GetCurrentPartitionDevName() string {
@@ -363,6 +242,8 @@ func WriteToPartition(srcFilename string, partName string) error {
 
 	log.Infof("WriteToPartition %s, %s: %v\n", partName, devName, srcFilename)
 
+	clearPartitionChecksum(partName)
+
 	ddCmd := exec.Command("dd", "if="+srcFilename, "of="+devName, "bs=8M")
 	zbootMutex.Lock()
 	_, err := ddCmd.Output()
@@ -375,42 +256,6 @@ func WriteToPartition(srcFilename string, partName string) error {
 	return nil
 }
 
-// Transition current from inprogress to active, and other from active/inprogress
-// to unused
-func MarkCurrentPartitionStateActive() error {
-
-	curPart := GetCurrentPartition()
-	otherPart := GetOtherPartition()
-
-	log.Infof("Check current partition %s, for inProgress state\n", curPart)
-	if ret := IsCurrentPartitionStateInProgress(); ret == false {
-		errStr := fmt.Sprintf("Current partition %s, is not inProgress",
-			curPart)
-		return errors.New(errStr)
-	}
-
-	log.Infof("Mark the current partition %s, active\n", curPart)
-	setCurrentPartitionStateActive()
-
-	log.Infof("Check other partition %s for active state or inprogress\n",
-		otherPart)
-	state := GetPartitionState(otherPart)
-	switch state {
-	case "active":
-		// Normal case
-	case "inprogress":
-		// Activated what was already on the other partition
-	default:
-		errStr := fmt.Sprintf("Other partition %s, is %s not active/inprogress",
-			otherPart, state)
-		return errors.New(errStr)
-	}
-
-	log.Infof("Mark other partition %s, unused\n", otherPart)
-	SetOtherPartitionStateUnused()
-	return nil
-}
-
 // XXX known pathnames for the version file and the zededa-tools container
 const (
 	shortVersionFile = "/opt/zededa/bin/versioninfo"
@@ -432,47 +277,60 @@ func GetLongVersion(part string) string {
 func getVersion(part string, verFilename string) string {
 	validatePartitionName(part)
 
-	if part == GetCurrentPartition() {
-		filename := verFilename
-		version, err := ioutil.ReadFile(filename)
-		if err != nil {
-			log.Fatal(err)
-		}
-		versionStr := string(version)
-		versionStr = strings.TrimSpace(versionStr)
-		log.Infof("%s, readCurVersion %s\n", part, versionStr)
-		return versionStr
-	} else {
-		if !IsAvailable() {
-			return ""
-		}
-		devname := GetPartitionDevname(part)
-		target, err := ioutil.TempDir("/var/run", "tmpmnt")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer os.RemoveAll(target)
-		// Mount failure is ok; might not have a filesystem in the
-		// other partition
-		// XXX hardcoded file system type squashfs
-		mountFlags := MountFlagRDONLY
-		err = zbootMount(devname, target, "squashfs", mountFlags, "")
-		if err != nil {
-			log.Errorf("Mount of %s failed: %s\n", devname, err)
-			return ""
-		}
-		defer syscall.Unmount(target, 0)
-		filename := fmt.Sprintf("%s/%s/%s",
-			target, otherPrefix, verFilename)
-		version, err := ioutil.ReadFile(filename)
-		if err != nil {
+	version, _, err := readPartitionFile(part, verFilename)
+	if err != nil {
+		if part == GetCurrentPartition() {
 			log.Fatal(err)
 		}
-		versionStr := string(version)
-		versionStr = strings.TrimSpace(versionStr)
-		log.Infof("%s, readOtherVersion %s\n", part, versionStr)
-		return versionStr
+		log.Errorf("getVersion(%s): %s\n", part, err)
+		return ""
+	}
+	versionStr := strings.TrimSpace(string(version))
+	log.Infof("%s, readVersion %s\n", part, versionStr)
+	return versionStr
+}
+
+// readPartitionFile returns the content and modification time of a file
+// in the image in the partition. The other partition is mounted to read it.
+func readPartitionFile(part string, filename string) ([]byte, time.Time, error) {
+	if part == GetCurrentPartition() {
+		return readFileAndTime(filename)
+	}
+	if !IsAvailable() {
+		errStr := fmt.Sprintf("no zboot to read %s from %s",
+			filename, part)
+		return nil, time.Time{}, errors.New(errStr)
+	}
+	devname := GetPartitionDevname(part)
+	target, err := ioutil.TempDir("/var/run", "tmpmnt")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer os.RemoveAll(target)
+	// Mount failure is ok; might not have a filesystem in the
+	// other partition
+	// XXX hardcoded file system type squashfs
+	mountFlags := MountFlagRDONLY
+	err = zbootMount(devname, target, "squashfs", mountFlags, "")
+	if err != nil {
+		errStr := fmt.Sprintf("Mount of %s failed: %s", devname, err)
+		return nil, time.Time{}, errors.New(errStr)
+	}
+	defer syscall.Unmount(target, 0)
+	return readFileAndTime(fmt.Sprintf("%s/%s/%s",
+		target, otherPrefix, filename))
+}
+
+func readFileAndTime(filename string) ([]byte, time.Time, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
+	return content, info.ModTime(), nil
 }
 
 // XXX temporary? Needed to run on hikey's with no zboot yet.
@@ -13,6 +13,7 @@ import (
 	"github.com/zededa/go-provision/cmd/domainmgr"
 	"github.com/zededa/go-provision/cmd/downloader"
 	"github.com/zededa/go-provision/cmd/hardwaremodel"
+	"github.com/zededa/go-provision/cmd/hwwatchdog"
 	"github.com/zededa/go-provision/cmd/identitymgr"
 	"github.com/zededa/go-provision/cmd/ipcmonitor"
 	"github.com/zededa/go-provision/cmd/ledmanager"
@@ -41,6 +42,8 @@ func main() {
 		downloader.Run()
 	case "hardwaremodel":
 		hardwaremodel.Run()
+	case "hwwatchdog":
+		hwwatchdog.Run()
 	case "identitymgr":
 		identitymgr.Run()
 	case "ledmanager":
@@ -0,0 +1,179 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Request authentication in addition to, or instead of, the TLS client
+// certificate. Used for controllers and relays which do not terminate
+// the device's TLS connection themselves.
+//
+// The provider is selected per controller based on the host in the URL:
+//	zedcloudCtx.AuthProviders = map[string]zedcloud.AuthProvider{
+//		"relay.example.com": &zedcloud.BearerTokenAuth{Token: token},
+//	}
+// An entry with an empty key is used for all other hosts.
+
+package zedcloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthProvider adds credentials to a request before it is sent
+type AuthProvider interface {
+	Scheme() string
+	Authenticate(req *http.Request) error
+}
+
+// BearerTokenAuth sends "Authorization: Bearer <token>". If TokenFunc is
+// set it is called for each request e.g., to refresh an expiring token.
+type BearerTokenAuth struct {
+	Token     string
+	TokenFunc func() (string, error)
+}
+
+func (auth *BearerTokenAuth) Scheme() string {
+	return "bearer"
+}
+
+func (auth *BearerTokenAuth) Authenticate(req *http.Request) error {
+	token := auth.Token
+	if auth.TokenFunc != nil {
+		var err error
+		token, err = auth.TokenFunc()
+		if err != nil {
+			return err
+		}
+	}
+	if token == "" {
+		return errors.New("BearerTokenAuth: no token")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// HMACAuth signs the method, path, date, and body hash using
+// HMAC-SHA256 with a shared key
+type HMACAuth struct {
+	KeyId string
+	Key   []byte
+}
+
+const (
+	hmacDateHeader = "X-Zededa-Date"
+	hmacBodyHeader = "X-Zededa-Content-Sha256"
+)
+
+func (auth *HMACAuth) Scheme() string {
+	return "hmac-sha256"
+}
+
+func (auth *HMACAuth) Authenticate(req *http.Request) error {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	bodySum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(bodySum[:])
+	date := time.Now().UTC().Format(time.RFC3339)
+	req.Header.Set(hmacDateHeader, date)
+	req.Header.Set(hmacBodyHeader, bodyHash)
+	sig := auth.sign(req.Method, req.URL.RequestURI(), date, bodyHash)
+	req.Header.Set("Authorization",
+		fmt.Sprintf("HMAC-SHA256 KeyId=%s, Signature=%s", auth.KeyId, sig))
+	return nil
+}
+
+func (auth *HMACAuth) sign(method string, uri string, date string,
+	bodyHash string) string {
+
+	mac := hmac.New(sha256.New, auth.Key)
+	mac.Write([]byte(strings.Join([]string{method, uri, date, bodyHash},
+		"\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Select the provider for the request's host, if any
+func authenticate(ctx ZedCloudContext, req *http.Request) error {
+	if len(ctx.AuthProviders) == 0 {
+		return nil
+	}
+	auth, ok := ctx.AuthProviders[req.URL.Hostname()]
+	if !ok {
+		auth, ok = ctx.AuthProviders[""]
+	}
+	if !ok || auth == nil {
+		return nil
+	}
+	if err := auth.Authenticate(req); err != nil {
+		errStr := fmt.Sprintf("%s authentication for %s failed: %s",
+			auth.Scheme(), req.URL.Hostname(), err)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// Optional file read by the agents which talk to the controller
+const AuthConfigFilename = identityDirname + "/controller-auth.json"
+
+// Format of the AuthProviders file
+type authConfig struct {
+	Host   string // Empty means all hosts
+	Scheme string // "bearer" or "hmac-sha256"
+	Token  string
+	KeyId  string
+	Key    string // Hex encoded
+}
+
+// ReadAuthProviders parses a JSON list of authConfig. Returns nil if
+// the file does not exist.
+func ReadAuthProviders(filename string) (map[string]AuthProvider, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var configs []authConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		errStr := fmt.Sprintf("ReadAuthProviders(%s): %s", filename, err)
+		return nil, errors.New(errStr)
+	}
+	providers := make(map[string]AuthProvider)
+	for _, c := range configs {
+		switch strings.ToLower(c.Scheme) {
+		case "bearer":
+			providers[c.Host] = &BearerTokenAuth{Token: c.Token}
+		case "hmac-sha256", "hmac":
+			key, err := hex.DecodeString(c.Key)
+			if err != nil {
+				errStr := fmt.Sprintf("ReadAuthProviders(%s): bad key for %s: %s",
+					filename, c.Host, err)
+				return nil, errors.New(errStr)
+			}
+			providers[c.Host] = &HMACAuth{KeyId: c.KeyId, Key: key}
+		default:
+			errStr := fmt.Sprintf("ReadAuthProviders(%s): unknown scheme %s for %s",
+				filename, c.Scheme, c.Host)
+			return nil, errors.New(errStr)
+		}
+	}
+	return providers, nil
+}
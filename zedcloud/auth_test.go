@@ -0,0 +1,182 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBearerTokenAuth(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://zedcloud/api/v1/edgedevice/config", nil)
+	auth := &BearerTokenAuth{Token: "token1"}
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed: %s\n", err)
+	}
+	if hdr := req.Header.Get("Authorization"); hdr != "Bearer token1" {
+		t.Errorf("Unexpected header %s\n", hdr)
+	}
+
+	// TokenFunc takes precedence
+	auth.TokenFunc = func() (string, error) { return "token2", nil }
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed: %s\n", err)
+	}
+	if hdr := req.Header.Get("Authorization"); hdr != "Bearer token2" {
+		t.Errorf("Unexpected header %s\n", hdr)
+	}
+	auth.TokenFunc = func() (string, error) {
+		return "", errors.New("expired")
+	}
+	if err := auth.Authenticate(req); err == nil {
+		t.Errorf("No error from failed TokenFunc\n")
+	}
+
+	auth = &BearerTokenAuth{}
+	if err := auth.Authenticate(req); err == nil {
+		t.Errorf("No error without token\n")
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	key := []byte("secretkey")
+	body := []byte("some body")
+	req, _ := http.NewRequest("POST", "https://zedcloud/api/v1/edgedevice/info?x=1",
+		bytes.NewReader(body))
+	auth := &HMACAuth{KeyId: "key1", Key: key}
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed: %s\n", err)
+	}
+	date := req.Header.Get(hmacDateHeader)
+	if date == "" {
+		t.Errorf("No %s header\n", hmacDateHeader)
+	}
+	bodySum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(bodySum[:])
+	if hdr := req.Header.Get(hmacBodyHeader); hdr != bodyHash {
+		t.Errorf("%s: expected %s got %s\n", hmacBodyHeader, bodyHash, hdr)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("POST\n/api/v1/edgedevice/info?x=1\n" + date + "\n" +
+		bodyHash))
+	expected := "HMAC-SHA256 KeyId=key1, Signature=" +
+		hex.EncodeToString(mac.Sum(nil))
+	if hdr := req.Header.Get("Authorization"); hdr != expected {
+		t.Errorf("Expected %s got %s\n", expected, hdr)
+	}
+	// The body can still be sent
+	b, _ := ioutil.ReadAll(req.Body)
+	if !bytes.Equal(b, body) {
+		t.Errorf("Body consumed: %s\n", string(b))
+	}
+
+	// No body hashes as empty
+	req, _ = http.NewRequest("GET", "https://zedcloud/api/v1/edgedevice/config", nil)
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed: %s\n", err)
+	}
+	emptySum := sha256.Sum256(nil)
+	if hdr := req.Header.Get(hmacBodyHeader); hdr != hex.EncodeToString(emptySum[:]) {
+		t.Errorf("Unexpected %s for empty body: %s\n", hmacBodyHeader, hdr)
+	}
+}
+
+func TestAuthenticateSelectsHost(t *testing.T) {
+	ctx := ZedCloudContext{
+		AuthProviders: map[string]AuthProvider{
+			"relay.example.com": &BearerTokenAuth{Token: "relay"},
+			"":                  &BearerTokenAuth{Token: "default"},
+		},
+	}
+	tests := map[string]string{
+		"https://relay.example.com:8443/api": "Bearer relay",
+		"https://zedcloud.example.com/api":   "Bearer default",
+	}
+	for url, expected := range tests {
+		req, _ := http.NewRequest("GET", url, nil)
+		if err := authenticate(ctx, req); err != nil {
+			t.Errorf("%s: authenticate failed: %s\n", url, err)
+		}
+		if hdr := req.Header.Get("Authorization"); hdr != expected {
+			t.Errorf("%s: expected %s got %s\n", url, expected, hdr)
+		}
+	}
+
+	// Only the named host
+	delete(ctx.AuthProviders, "")
+	req, _ := http.NewRequest("GET", "https://zedcloud.example.com/api", nil)
+	if err := authenticate(ctx, req); err != nil {
+		t.Errorf("authenticate failed: %s\n", err)
+	}
+	if hdr := req.Header.Get("Authorization"); hdr != "" {
+		t.Errorf("Unexpected header %s\n", hdr)
+	}
+
+	// Failures name the scheme and host
+	ctx.AuthProviders["relay.example.com"] = &BearerTokenAuth{}
+	req, _ = http.NewRequest("GET", "https://relay.example.com/api", nil)
+	err := authenticate(ctx, req)
+	if err == nil || !strings.Contains(err.Error(), "bearer authentication for relay.example.com") {
+		t.Errorf("Unexpected error %v\n", err)
+	}
+}
+
+func TestReadAuthProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := dir + "/controller-auth.json"
+
+	providers, err := ReadAuthProviders(filename)
+	if err != nil || providers != nil {
+		t.Errorf("Missing file: got %v, %v\n", providers, err)
+	}
+
+	write := func(content string) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %s\n", err)
+		}
+	}
+	write(`[{"Host": "relay.example.com", "Scheme": "Bearer", "Token": "t1"},
+		{"Scheme": "hmac-sha256", "KeyId": "key1", "Key": "0a0b0c"}]`)
+	providers, err = ReadAuthProviders(filename)
+	if err != nil {
+		t.Fatalf("ReadAuthProviders failed: %s\n", err)
+	}
+	if len(providers) != 2 {
+		t.Errorf("Expected 2 providers got %d\n", len(providers))
+	}
+	bearer, ok := providers["relay.example.com"].(*BearerTokenAuth)
+	if !ok || bearer.Token != "t1" {
+		t.Errorf("Unexpected relay provider %+v\n",
+			providers["relay.example.com"])
+	}
+	hmacAuth, ok := providers[""].(*HMACAuth)
+	if !ok || hmacAuth.KeyId != "key1" ||
+		!bytes.Equal(hmacAuth.Key, []byte{0x0a, 0x0b, 0x0c}) {
+		t.Errorf("Unexpected default provider %+v\n", providers[""])
+	}
+
+	bad := []string{
+		`not json`,
+		`[{"Scheme": "hmac", "Key": "xyz"}]`,
+		`[{"Scheme": "basic"}]`,
+	}
+	for _, content := range bad {
+		write(content)
+		if _, err := ReadAuthProviders(filename); err == nil {
+			t.Errorf("No error for %s\n", content)
+		}
+	}
+}
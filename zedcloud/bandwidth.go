@@ -0,0 +1,227 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Per interface and per category byte counters so that data usage on
+// metered links can be attributed. Each agent keeps its own counters and
+// saves them under /persist so they survive reboots; ReadAllBandwidth
+// merges them for reporting.
+
+package zedcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/pubsub"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	bandwidthDir = "/persist/status/zedcloud/bandwidth"
+	// Don't write /persist on every request
+	bandwidthSaveInterval = 5 * time.Minute
+)
+
+// Request categories. Set ZedCloudContext.Category or the category is
+// determined from the URL.
+const (
+	CategoryConfig  = "config"
+	CategoryInfo    = "info"
+	CategoryMetrics = "metrics"
+	CategoryLogs    = "logs"
+	CategoryImage   = "image"
+	CategoryOther   = "other"
+)
+
+type BandwidthCounter struct {
+	SentBytes  uint64
+	RecvBytes  uint64
+	LastUpdate time.Time
+}
+
+// BandwidthMap is indexed by interface name and then category
+type BandwidthMap map[string]map[string]BandwidthCounter
+
+type bandwidthState struct {
+	lock      sync.Mutex
+	counters  BandwidthMap
+	agentName string // Empty means not persisted
+	lastSave  time.Time
+	dirty     bool
+}
+
+var bandwidth = bandwidthState{counters: make(BandwidthMap)}
+
+var bandwidthExitOnce sync.Once
+
+// InitBandwidth loads the saved counters for the agent and makes
+// SaveBandwidth persist them. The counters are also saved when the
+// agent exits due to log.Fatal or SIGTERM.
+func InitBandwidth(agentName string) {
+	bandwidthExitOnce.Do(handleBandwidthExit)
+	bandwidth.lock.Lock()
+	defer bandwidth.lock.Unlock()
+
+	bandwidth.agentName = agentName
+	filename := bandwidthFilename(agentName)
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("InitBandwidth: %s\n", err)
+		}
+		return
+	}
+	var saved BandwidthMap
+	if err := json.Unmarshal(b, &saved); err != nil {
+		log.Errorf("InitBandwidth: %s: %s\n", filename, err)
+		return
+	}
+	// Add anything counted before InitBandwidth was called
+	bandwidth.counters = mergeBandwidth(saved, bandwidth.counters)
+	log.Infof("InitBandwidth: loaded %s\n", filename)
+}
+
+func handleBandwidthExit() {
+	log.RegisterExitHandler(saveBandwidthOnExit)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Infof("handleBandwidthExit: received %v\n", sig)
+		saveBandwidthOnExit()
+		os.Exit(1)
+	}()
+}
+
+func saveBandwidthOnExit() {
+	if err := SaveBandwidth(true); err != nil {
+		log.Errorf("SaveBandwidth failed: %s\n", err)
+	}
+}
+
+func bandwidthFilename(agentName string) string {
+	return fmt.Sprintf("%s/%s.json", bandwidthDir, agentName)
+}
+
+// AddBandwidth accumulates bytes for the interface and category
+func AddBandwidth(intf string, category string, sent int64, recv int64) {
+	if category == "" {
+		category = CategoryOther
+	}
+	bandwidth.lock.Lock()
+	defer bandwidth.lock.Unlock()
+
+	m, ok := bandwidth.counters[intf]
+	if !ok {
+		m = make(map[string]BandwidthCounter)
+		bandwidth.counters[intf] = m
+	}
+	c := m[category]
+	if sent > 0 {
+		c.SentBytes += uint64(sent)
+	}
+	if recv > 0 {
+		c.RecvBytes += uint64(recv)
+	}
+	c.LastUpdate = time.Now()
+	m[category] = c
+	bandwidth.dirty = true
+}
+
+// GetBandwidth returns a copy of this agent's counters
+func GetBandwidth() BandwidthMap {
+	bandwidth.lock.Lock()
+	defer bandwidth.lock.Unlock()
+	return mergeBandwidth(nil, bandwidth.counters)
+}
+
+// SaveBandwidth writes the counters if they changed and the save
+// interval has passed. Called periodically by the agents; force is
+// used when exiting.
+func SaveBandwidth(force bool) error {
+	bandwidth.lock.Lock()
+	defer bandwidth.lock.Unlock()
+
+	if bandwidth.agentName == "" || !bandwidth.dirty {
+		return nil
+	}
+	if !force && time.Since(bandwidth.lastSave) < bandwidthSaveInterval {
+		return nil
+	}
+	if err := os.MkdirAll(bandwidthDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(bandwidth.counters)
+	if err != nil {
+		return err
+	}
+	if err := pubsub.WriteRename(bandwidthFilename(bandwidth.agentName), b); err != nil {
+		return err
+	}
+	bandwidth.lastSave = time.Now()
+	bandwidth.dirty = false
+	return nil
+}
+
+// ReadAllBandwidth returns the sum of the saved counters across agents
+func ReadAllBandwidth() (BandwidthMap, error) {
+	total := make(BandwidthMap)
+	files, err := filepath.Glob(bandwidthDir + "/*.json")
+	if err != nil {
+		return total, err
+	}
+	for _, filename := range files {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Errorf("ReadAllBandwidth: %s\n", err)
+			continue
+		}
+		var saved BandwidthMap
+		if err := json.Unmarshal(b, &saved); err != nil {
+			log.Errorf("ReadAllBandwidth: %s: %s\n", filename, err)
+			continue
+		}
+		total = mergeBandwidth(total, saved)
+	}
+	return total, nil
+}
+
+// Returns a new map with the sum of the two
+func mergeBandwidth(m1 BandwidthMap, m2 BandwidthMap) BandwidthMap {
+	res := make(BandwidthMap)
+	for _, m := range []BandwidthMap{m1, m2} {
+		for intf, cats := range m {
+			if _, ok := res[intf]; !ok {
+				res[intf] = make(map[string]BandwidthCounter)
+			}
+			for cat, c := range cats {
+				r := res[intf][cat]
+				r.SentBytes += c.SentBytes
+				r.RecvBytes += c.RecvBytes
+				if c.LastUpdate.After(r.LastUpdate) {
+					r.LastUpdate = c.LastUpdate
+				}
+				res[intf][cat] = r
+			}
+		}
+	}
+	return res
+}
+
+// Determine the category based on the API in the URL
+func categoryFromUrl(reqUrl string) string {
+	for _, cat := range []string{CategoryConfig, CategoryInfo,
+		CategoryMetrics, CategoryLogs} {
+		if strings.Contains(reqUrl, "/edgedevice/"+cat) {
+			return cat
+		}
+	}
+	return CategoryOther
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Client certificate providers so that a re-keyed device cert is picked up
+// on the next TLS handshake without restarting the agents.
+
+package zedcloud
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertProvider is called for each TLS handshake when set in
+// ZedCloudContext; it overrides the Certificates in the TlsConfig.
+// It is also called at the start of each request since a resumed
+// session skips the client certificate; a provider which notices a
+// new certificate must call FlushSessionCache.
+type CertProvider interface {
+	GetCertificate() (*tls.Certificate, error)
+}
+
+// FileCertProvider re-reads the cert and key files when their
+// modification time changes.
+type FileCertProvider struct {
+	certFile    string
+	keyFile     string
+	lock        sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func NewFileCertProvider(certFile string, keyFile string) *FileCertProvider {
+	return &FileCertProvider{certFile: certFile, keyFile: keyFile}
+}
+
+// DeviceCertProvider returns a provider for the device cert and key
+func DeviceCertProvider() *FileCertProvider {
+	return NewFileCertProvider(deviceCertName, deviceKeyName)
+}
+
+func (p *FileCertProvider) GetCertificate() (*tls.Certificate, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	certInfo, err := os.Stat(p.certFile)
+	if err != nil {
+		return p.cachedOrError(err)
+	}
+	// The key might be in the TPM
+	keyInfo, err := os.Stat(DeviceKeyFile(p.keyFile))
+	if err != nil {
+		return p.cachedOrError(err)
+	}
+	if p.cert != nil && certInfo.ModTime().Equal(p.certModTime) &&
+		keyInfo.ModTime().Equal(p.keyModTime) {
+		return p.cert, nil
+	}
+	cert, err := LoadKeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		// Could be half-way through a rewrite; try again next time
+		return p.cachedOrError(err)
+	}
+	if p.cert != nil {
+		log.Infof("FileCertProvider: reloaded %s\n", p.certFile)
+		// Resumed sessions would present the old identity
+		FlushSessionCache()
+	}
+	p.cert = &cert
+	p.certModTime = certInfo.ModTime()
+	p.keyModTime = keyInfo.ModTime()
+	return p.cert, nil
+}
+
+// Caller holds lock
+func (p *FileCertProvider) cachedOrError(err error) (*tls.Certificate, error) {
+	if p.cert != nil {
+		log.Warnf("FileCertProvider: using cached %s: %s\n",
+			p.certFile, err)
+		return p.cert, nil
+	}
+	errStr := fmt.Sprintf("FileCertProvider: %s: %s", p.certFile, err)
+	return nil, errors.New(errStr)
+}
+
+// StaticCertProvider returns the certificate last passed to
+// SetCertificate, e.g., from a pubsub handler.
+type StaticCertProvider struct {
+	lock sync.Mutex
+	cert *tls.Certificate
+}
+
+func (p *StaticCertProvider) SetCertificate(cert tls.Certificate) {
+	p.lock.Lock()
+	replaced := p.cert != nil
+	p.cert = &cert
+	p.lock.Unlock()
+	if replaced {
+		FlushSessionCache()
+	}
+}
+
+func (p *StaticCertProvider) GetCertificate() (*tls.Certificate, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cert == nil {
+		return nil, errors.New("StaticCertProvider: no certificate set")
+	}
+	return p.cert, nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+// Write a self-signed client cert and key with commonName
+func writeTestClientCert(t *testing.T, certFile string, keyFile string,
+	commonName string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %s\n", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %s\n", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %s\n", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY",
+		Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+}
+
+// A rotated certificate is used by the next request even though the
+// previous requests resumed the TLS session.
+func TestCertRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certprovider")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := dir + "/device.cert.pem"
+	keyFile := dir + "/device.key.pem"
+	writeTestClientCert(t, certFile, keyFile, "first")
+
+	var lock sync.Mutex
+	var seen []string
+	var resumed []bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		seen = append(seen, r.TLS.PeerCertificates[0].Subject.CommonName)
+		resumed = append(resumed, r.TLS.DidResume)
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+			},
+		},
+	}
+	FlushSessionCache()
+	ctx := ZedCloudContext{
+		DeviceNetworkStatus: &status,
+		NoLedManager:        true,
+		TlsConfig: &tls.Config{
+			RootCAs:            roots,
+			ServerName:         "example.com",
+			ClientSessionCache: getSessionCache(),
+		},
+		CertProvider: NewFileCertProvider(certFile, keyFile),
+	}
+	send := func() {
+		_, err := SendOnIntf(context.Background(), ctx, server.URL,
+			"lo", 0, nil, false, 0)
+		if err != nil {
+			t.Fatalf("SendOnIntf failed: %s\n", err)
+		}
+	}
+	send()
+	send()
+
+	writeTestClientCert(t, certFile, keyFile, "second")
+	// Make sure the modification time differs
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	send()
+
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{"first", "first", "second"}
+	if len(seen) != len(expected) {
+		t.Fatalf("Expected %v, got %v\n", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("Request %d: expected %s, got %s\n",
+				i, expected[i], seen[i])
+		}
+	}
+	// Otherwise the test does not show anything
+	if !resumed[1] {
+		t.Errorf("Second request did not resume the session\n")
+	}
+	if resumed[2] {
+		t.Errorf("Request after rotation resumed the session\n")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Compression of the request and response bodies to reduce the data usage
+// on e.g., LTE. We always offer gzip and deflate for the responses. A
+// request body is only compressed once the controller has listed the
+// coding in an Accept-Encoding response header (RFC 7694), and we stop
+// compressing for that host if it returns 415 for a compressed request.
+
+package zedcloud
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Smaller request bodies are sent as is
+const compressMinSize = 1024
+
+// acceptEncoding is offered in all requests
+const acceptEncoding = "gzip, deflate"
+
+// The coding for the request bodies indexed by host; none if not present
+var requestEncodings = struct {
+	sync.Mutex
+	hosts map[string]string
+}{hosts: make(map[string]string)}
+
+func lookupRequestEncoding(host string) string {
+	requestEncodings.Lock()
+	defer requestEncodings.Unlock()
+	return requestEncodings.hosts[host]
+}
+
+// learnRequestEncoding records what the host accepts based on the
+// response to a request sent with sentEncoding
+func learnRequestEncoding(host string, resp *http.Response,
+	sentEncoding string) {
+
+	requestEncodings.Lock()
+	defer requestEncodings.Unlock()
+	old := requestEncodings.hosts[host]
+	if sentEncoding != "" &&
+		resp.StatusCode == http.StatusUnsupportedMediaType {
+		log.Warnf("learnRequestEncoding(%s) %s rejected\n", host,
+			sentEncoding)
+		delete(requestEncodings.hosts, host)
+		return
+	}
+	accepted := resp.Header.Get("Accept-Encoding")
+	if accepted == "" {
+		// Not all responses carry it; keep what we have
+		return
+	}
+	encoding := pickEncoding(accepted)
+	if encoding == old {
+		return
+	}
+	log.Infof("learnRequestEncoding(%s) %q to %q\n", host, old, encoding)
+	if encoding == "" {
+		delete(requestEncodings.hosts, host)
+	} else {
+		requestEncodings.hosts[host] = encoding
+	}
+}
+
+// pickEncoding returns the coding we prefer from an Accept-Encoding
+// header, or empty if none is acceptable
+func pickEncoding(accepted string) string {
+	deflate := false
+	for _, field := range strings.Split(accepted, ",") {
+		params := strings.Split(field, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if rejectedCoding(params[1:]) {
+			continue
+		}
+		switch coding {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+// A coding with a zero q value is not acceptable
+func rejectedCoding(params []string) bool {
+	for _, param := range params {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+		q, err := strconv.ParseFloat(param[len("q="):], 64)
+		if err == nil && q == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compressBody returns the body in the encoding
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		// The zlib format per RFC 7230
+		w = zlib.NewWriter(&buf)
+	default:
+		errStr := fmt.Sprintf("unknown encoding %s", encoding)
+		return nil, errors.New(errStr)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func contentEncoding(resp *http.Response) string {
+	return strings.ToLower(strings.TrimSpace(
+		resp.Header.Get("Content-Encoding")))
+}
+
+// isEncoded returns true if the response body was compressed
+func isEncoded(resp *http.Response) bool {
+	encoding := contentEncoding(resp)
+	return encoding != "" && encoding != "identity"
+}
+
+// decodeBody returns the contents of the response decoded per its
+// Content-Encoding
+func decodeBody(resp *http.Response, contents []byte) ([]byte, error) {
+	encoding := contentEncoding(resp)
+	var r io.Reader
+	switch encoding {
+	case "", "identity":
+		return contents, nil
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			// Some servers send raw deflate
+			fr := flate.NewReader(bytes.NewReader(contents))
+			defer fr.Close()
+			r = fr
+		} else {
+			defer zr.Close()
+			r = zr
+		}
+	default:
+		errStr := fmt.Sprintf("unsupported Content-Encoding %s",
+			encoding)
+		return nil, errors.New(errStr)
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestPickEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                       "",
+		"identity":               "",
+		"gzip":                   "gzip",
+		"deflate, gzip":          "gzip",
+		"deflate":                "deflate",
+		"gzip;q=0, deflate":      "deflate",
+		"GZIP; q=0.5":            "gzip",
+		"br, gzip;q=0.0":         "",
+		"x-custom, deflate;q=1 ": "deflate",
+	}
+	for accepted, expected := range tests {
+		if encoding := pickEncoding(accepted); encoding != expected {
+			t.Errorf("pickEncoding(%q) %q expected %q", accepted,
+				encoding, expected)
+		}
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	body := bytes.Repeat([]byte("metrics "), 1000)
+	for _, encoding := range []string{"gzip", "deflate"} {
+		compressed, err := compressBody(encoding, body)
+		if err != nil {
+			t.Fatalf("compressBody(%s) failed: %s", encoding, err)
+		}
+		if len(compressed) >= len(body) {
+			t.Errorf("compressBody(%s) %d not less than %d", encoding,
+				len(compressed), len(body))
+		}
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Content-Encoding", encoding)
+		if !isEncoded(resp) {
+			t.Errorf("isEncoded(%s) false", encoding)
+		}
+		decoded, err := decodeBody(resp, compressed)
+		if err != nil {
+			t.Fatalf("decodeBody(%s) failed: %s", encoding, err)
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Errorf("decodeBody(%s) mismatch", encoding)
+		}
+	}
+	if _, err := compressBody("br", body); err == nil {
+		t.Errorf("compressBody(br) succeeded")
+	}
+	resp := &http.Response{Header: http.Header{}}
+	if decoded, err := decodeBody(resp, body); err != nil ||
+		!bytes.Equal(decoded, body) {
+		t.Errorf("decodeBody without encoding changed the body")
+	}
+}
+
+func TestLearnRequestEncoding(t *testing.T) {
+	host := "zedcloud.example.com"
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	learnRequestEncoding(host, resp, "")
+	if encoding := lookupRequestEncoding(host); encoding != "" {
+		t.Errorf("Unexpected %q without Accept-Encoding", encoding)
+	}
+	resp.Header.Set("Accept-Encoding", "gzip")
+	learnRequestEncoding(host, resp, "")
+	if encoding := lookupRequestEncoding(host); encoding != "gzip" {
+		t.Errorf("Expected gzip, got %q", encoding)
+	}
+	// Kept when a response does not say
+	resp.Header.Del("Accept-Encoding")
+	learnRequestEncoding(host, resp, "gzip")
+	if encoding := lookupRequestEncoding(host); encoding != "gzip" {
+		t.Errorf("Expected gzip kept, got %q", encoding)
+	}
+	resp.StatusCode = http.StatusUnsupportedMediaType
+	learnRequestEncoding(host, resp, "gzip")
+	if encoding := lookupRequestEncoding(host); encoding != "" {
+		t.Errorf("Expected none after 415, got %q", encoding)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Additional trust anchors and certificate pinning for on-prem and
+// air-gapped controllers using a private PKI.
+// Any PEM files in /config/controller-ca.d are added to the root
+// certificate pool. If /config/controller-pin exists it contains the hex
+// encoded sha256 of the DER encoded controller certificates which are
+// accepted, one per line; any other certificate is rejected even if it
+// chains to a trust anchor.
+
+package zedcloud
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	controllerCADirname   = identityDirname + "/controller-ca.d"
+	controllerPinFilename = identityDirname + "/controller-pin"
+)
+
+// Map from sha256 of the DER certificate to the file it came from so
+// that we can report which anchor validated a connection
+var (
+	trustAnchorLock  sync.Mutex
+	trustAnchorNames = make(map[string]string)
+)
+
+func certFingerprint(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// addTrustAnchors adds the certificates in the PEM data to the pool and
+// records them under name. Returns the fingerprints of the ones added.
+func addTrustAnchors(pool *x509.CertPool, pemData []byte, name string) []string {
+	var added []string
+	for len(pemData) > 0 {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			log.Errorf("addTrustAnchors: %s: %s\n", name, err)
+			continue
+		}
+		pool.AddCert(cert)
+		trustAnchorLock.Lock()
+		trustAnchorNames[certFingerprint(cert.Raw)] = name
+		trustAnchorLock.Unlock()
+		added = append(added, certFingerprint(cert.Raw))
+	}
+	return added
+}
+
+// loadControllerCAs adds the files in dirname to the pool and returns the
+// fingerprints. A missing directory is not an error.
+func loadControllerCAs(pool *x509.CertPool, dirname string) ([]string, error) {
+	files, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var anchors []string
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		filename := filepath.Join(dirname, file.Name())
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Errorf("loadControllerCAs: %s\n", err)
+			continue
+		}
+		added := addTrustAnchors(pool, b, file.Name())
+		if len(added) == 0 {
+			log.Warnf("loadControllerCAs: no certificates in %s\n",
+				filename)
+		}
+		anchors = append(anchors, added...)
+	}
+	return anchors, nil
+}
+
+// The anchors and pins the sessions in clientSessionCache were
+// established with
+var sessionTrustHash string
+
+// checkTrustChange flushes the session cache if the anchors or the pins
+// changed since the sessions were established. A resumed session skips
+// the verification of the controller certificate, hence without the
+// flush a removed anchor or a new pin would only apply once the sessions
+// expire. Returns true if it flushed.
+func checkTrustChange(anchors []string, pins []string) bool {
+	sorted := append([]string{}, anchors...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, anchor := range sorted {
+		h.Write([]byte("anchor " + anchor + "\n"))
+	}
+	for _, pin := range pins {
+		h.Write([]byte("pin " + pin + "\n"))
+	}
+	trustHash := hex.EncodeToString(h.Sum(nil))
+
+	sessionCacheLock.Lock()
+	defer sessionCacheLock.Unlock()
+	if trustHash == sessionTrustHash {
+		return false
+	}
+	flush := sessionTrustHash != ""
+	sessionTrustHash = trustHash
+	if !flush {
+		return false
+	}
+	log.Infof("checkTrustChange: controller CAs or pins changed; flushing TLS sessions\n")
+	clientSessionCache = tls.NewLRUClientSessionCache(sessionCacheSize)
+	return true
+}
+
+// readControllerPins returns nil if there is no pin file
+func readControllerPins(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var pins []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pin := strings.ToLower(strings.Replace(line, ":", "", -1))
+		if _, err := hex.DecodeString(pin); err != nil || len(pin) != 64 {
+			errStr := fmt.Sprintf("readControllerPins(%s): bad sha256 %s",
+				filename, line)
+			return nil, errors.New(errStr)
+		}
+		pins = append(pins, pin)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pins) == 0 {
+		errStr := fmt.Sprintf("readControllerPins(%s): no pins", filename)
+		return nil, errors.New(errStr)
+	}
+	return pins, nil
+}
+
+// pinVerifier returns a tls.Config.VerifyPeerCertificate function which
+// accepts the connection if the leaf certificate matches one of the pins
+func pinVerifier(pins []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("No controller certificate to check pin")
+		}
+		fp := certFingerprint(rawCerts[0])
+		for _, pin := range pins {
+			if pin == fp {
+				return nil
+			}
+		}
+		errStr := fmt.Sprintf("Controller certificate %s does not match pinned %v",
+			fp, pins)
+		log.Errorln(errStr)
+		return errors.New(errStr)
+	}
+}
+
+// TrustAnchor returns the file name of the root which validated the
+// connection, or the empty string if unknown
+func TrustAnchor(connState *tls.ConnectionState) string {
+	if connState == nil || len(connState.VerifiedChains) == 0 {
+		return ""
+	}
+	chain := connState.VerifiedChains[0]
+	if len(chain) == 0 {
+		return ""
+	}
+	root := chain[len(chain)-1]
+	trustAnchorLock.Lock()
+	defer trustAnchorLock.Unlock()
+	return trustAnchorNames[certFingerprint(root.Raw)]
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadControllerCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controllerca")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	caDir := filepath.Join(dir, "controller-ca.d")
+	if err := os.Mkdir(caDir, 0700); err != nil {
+		t.Fatalf("Mkdir failed: %s\n", err)
+	}
+	writeTestClientCert(t, filepath.Join(caDir, "a.pem"),
+		filepath.Join(dir, "a.key"), "a")
+	writeTestClientCert(t, filepath.Join(caDir, ".hidden.pem"),
+		filepath.Join(dir, "hidden.key"), "hidden")
+	if err := ioutil.WriteFile(filepath.Join(caDir, "junk.pem"),
+		[]byte("junk\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+
+	pool := x509.NewCertPool()
+	anchors, err := loadControllerCAs(pool, caDir)
+	if err != nil {
+		t.Fatalf("loadControllerCAs failed: %s\n", err)
+	}
+	if len(anchors) != 1 {
+		t.Fatalf("Got anchors %v\n", anchors)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(caDir, "a.pem"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %s\n", err)
+	}
+	block, _ := pem.Decode(b)
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %s\n", err)
+	}
+	if anchors[0] != certFingerprint(root.Raw) {
+		t.Errorf("Got anchor %s\n", anchors[0])
+	}
+	connState := tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{root}},
+	}
+	if name := TrustAnchor(&connState); name != "a.pem" {
+		t.Errorf("Got trust anchor %s\n", name)
+	}
+
+	anchors, err = loadControllerCAs(pool, filepath.Join(dir, "missing"))
+	if err != nil || anchors != nil {
+		t.Errorf("Missing directory got %v, %v\n", anchors, err)
+	}
+}
+
+func TestReadControllerPins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controllerca")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	pin := strings.Repeat("ab", 32)
+	colons := strings.ToUpper(strings.Repeat("AB:", 31) + "AB")
+	tests := []struct {
+		name    string
+		content string
+		pins    int
+		fail    bool
+	}{
+		{"valid", "# Controller\n" + pin + "\n\n" + colons + "\n", 2, false},
+		{"short", "abcd\n", 0, true},
+		{"not hex", strings.Repeat("zz", 32) + "\n", 0, true},
+		{"empty", "# Nothing\n", 0, true},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(filename, []byte(test.content),
+			0600); err != nil {
+			t.Fatalf("WriteFile failed: %s\n", err)
+		}
+		pins, err := readControllerPins(filename)
+		if (err != nil) != test.fail || len(pins) != test.pins {
+			t.Errorf("%s: got %v, %v\n", test.name, pins, err)
+		}
+		for _, p := range pins {
+			if p != pin {
+				t.Errorf("%s: got pin %s\n", test.name, p)
+			}
+		}
+	}
+	pins, err := readControllerPins(filepath.Join(dir, "missing"))
+	if err != nil || pins != nil {
+		t.Errorf("Missing file got %v, %v\n", pins, err)
+	}
+}
+
+// A resumed session skips the pin check, hence a change of the pins has
+// to flush the sessions for the new pin to apply right away
+func TestCheckTrustChange(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	anchors := []string{certFingerprint(server.Certificate().Raw)}
+	goodPins := []string{certFingerprint(server.Certificate().Raw)}
+	badPins := []string{strings.Repeat("00", 32)}
+
+	get := func(pins []string) (bool, error) {
+		transport := &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:               roots,
+				ServerName:            "example.com",
+				ClientSessionCache:    getSessionCache(),
+				VerifyPeerCertificate: pinVerifier(pins),
+			},
+			DisableKeepAlives: true,
+		}
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return false, err
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.TLS.DidResume, nil
+	}
+
+	sessionTrustHash = ""
+	FlushSessionCache()
+	if checkTrustChange(anchors, goodPins) {
+		t.Errorf("Flushed on the first call\n")
+	}
+	if _, err := get(goodPins); err != nil {
+		t.Fatalf("Get failed: %s\n", err)
+	}
+	resumed, err := get(goodPins)
+	if err != nil {
+		t.Fatalf("Get failed: %s\n", err)
+	}
+	if !resumed {
+		t.Errorf("Session not resumed\n")
+	}
+	cache := getSessionCache()
+	if checkTrustChange([]string{anchors[0]}, goodPins) ||
+		getSessionCache() != cache {
+		t.Errorf("Flushed without a change\n")
+	}
+
+	if !checkTrustChange(anchors, badPins) || getSessionCache() == cache {
+		t.Errorf("Not flushed on a pin change\n")
+	}
+	if _, err := get(badPins); err == nil {
+		t.Errorf("Connected with the wrong pin\n")
+	}
+
+	// Removing the pin, or an anchor, also flushes
+	if !checkTrustChange(anchors, nil) {
+		t.Errorf("Not flushed when the pin was removed\n")
+	}
+	if !checkTrustChange(nil, nil) {
+		t.Errorf("Not flushed when the anchor was removed\n")
+	}
+}
@@ -7,9 +7,11 @@ package zedcloud
 
 import (
 	"bytes"
+	"fmt"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/flextimer"
-	"time"
 )
 
 // Example usage:
@@ -20,8 +22,47 @@ import (
 // Before or after sending success call:
 //	zedcloud.RemoveDeferred(key)
 // After failure call
-// 	zedcloud.SetDeferred(key, buf, size, url, zedcloudCtx)
+// 	zedcloud.SetDeferred(key, buf, size, url, zedcloudCtx, return400, priority)
 // or AddDeferred to build a queue for each key
+//
+// The messages are sent in priority order. A failure to send a high
+// priority message stops the attempt, but a failure of a low priority one
+// does not hold up the high priority messages queued later.
+
+// DeferredPriority is the class of a deferred or spooled message
+type DeferredPriority uint8
+
+const (
+	DeferredHigh    DeferredPriority = iota // Info and alerts
+	DeferredLow                             // Metrics and logs
+	deferredClasses                         // Number of classes
+)
+
+func (p DeferredPriority) String() string {
+	switch p {
+	case DeferredHigh:
+		return "high"
+	case DeferredLow:
+		return "low"
+	default:
+		return fmt.Sprintf("unknown %d", p)
+	}
+}
+
+// Retry policy for a class. The retries back off from minRetry to
+// maxRetry while the highest priority message queued is of the class.
+// Spooled messages older than maxAge are dropped; zero means never.
+type deferredPolicy struct {
+	minRetry time.Duration
+	maxRetry time.Duration
+	maxAge   time.Duration
+}
+
+var deferredPolicies = [deferredClasses]deferredPolicy{
+	DeferredHigh: {minRetry: time.Minute, maxRetry: 5 * time.Minute},
+	DeferredLow: {minRetry: time.Minute, maxRetry: 15 * time.Minute,
+		maxAge: 24 * time.Hour},
+}
 
 type deferredItem struct {
 	buf         *bytes.Buffer
@@ -32,7 +73,8 @@ type deferredItem struct {
 }
 
 type deferredItemList struct {
-	list []deferredItem
+	list     []deferredItem
+	priority DeferredPriority
 }
 
 const longTime1 = time.Hour * 24
@@ -42,6 +84,7 @@ const longTime2 = time.Hour * 48
 type DeferredContext struct {
 	deferredItems map[string]deferredItemList
 	ticker        flextimer.FlexTickerHandle
+	timerPriority DeferredPriority // Policy of the running ticker
 }
 
 // From first InitDeferred
@@ -66,8 +109,9 @@ func initImpl() *DeferredContext {
 	return ctx
 }
 
-// Try to send all deferred items. Give up if any one fails
-// Stop timer if map becomes empty
+// Try to send the spooled and deferred items of each priority in turn,
+// the spooled ones first. Give up if any one fails
+// Stop timer if map and spool become empty
 // Returns true when there are no more deferred items
 func HandleDeferred(event time.Time, spacing time.Duration) bool {
 
@@ -83,47 +127,66 @@ func (ctx *DeferredContext) handleDeferred(event time.Time,
 	log.Infof("HandleDeferred(%v, %v) map %d\n",
 		event, spacing, len(ctx.deferredItems))
 	iteration := 0 // Do some load spreading
+	done := true
+	for p := DeferredHigh; p < deferredClasses; p++ {
+		if defaultSpool != nil && !defaultSpool.drain(p, iteration) {
+			log.Infof("HandleDeferred() spool %s not drained\n", p)
+			done = false
+			break
+		}
+		if !ctx.sendItems(p, &iteration, spacing) {
+			done = false
+			break
+		}
+	}
+	if len(ctx.deferredItems) == 0 && SpoolDepth() == 0 {
+		stopTimer(ctx)
+	} else if ctx.highestPriority() != ctx.timerPriority {
+		// Keep backing off unless the policy changed
+		startTimer(ctx)
+	}
+	log.Infof("HandleDeferred() done map %d\n", len(ctx.deferredItems))
+	return done && len(ctx.deferredItems) == 0
+}
+
+// Try to send the deferred items of the priority. Returns false if one
+// failed
+func (ctx *DeferredContext) sendItems(priority DeferredPriority,
+	iteration *int, spacing time.Duration) bool {
+
 	for key, l := range ctx.deferredItems {
+		if l.priority != priority {
+			continue
+		}
 		log.Infof("Trying to send for %s items %d\n", key, len(l.list))
-		failed := false
 		for i, item := range l.list {
 			if item.buf == nil {
 				continue
 			}
 			log.Infof("Trying to send for %s item %d data size %d\n",
 				key, i, item.size)
-			resp, _, err := SendOnAllIntf(item.zedcloudCtx, item.url,
-				item.size, item.buf, iteration, item.return400)
-			if item.return400 && resp != nil &&
-				resp.StatusCode == 400 {
+			res, err := SendOnAllIntf(item.zedcloudCtx, item.url,
+				item.size, item.buf, *iteration, item.return400)
+			if item.return400 && res.HasStatus(400) {
 				log.Infof("HandleDeferred: for %s ignore code %d\n",
-					key, resp.StatusCode)
+					key, res.StatusCode)
 			} else if err != nil {
 				log.Infof("HandleDeferred: for %s failed %s\n",
 					key, err)
-				failed = true
-				break
+				return false
 			}
-			item.buf = nil
+			l.list[i].buf = nil
 		}
-		if failed {
-			break
-		} else {
-			delete(ctx.deferredItems, key)
-			iteration += 1
-			// XXX sleeping in main thread
-			if len(ctx.deferredItems) != 0 && spacing != 0 {
-				log.Infof("HandleDeferred sleeping %v\n",
-					spacing)
-				time.Sleep(spacing)
-			}
+		delete(ctx.deferredItems, key)
+		*iteration += 1
+		// XXX sleeping in main thread
+		if len(ctx.deferredItems) != 0 && spacing != 0 {
+			log.Infof("HandleDeferred sleeping %v\n",
+				spacing)
+			time.Sleep(spacing)
 		}
 	}
-	if len(ctx.deferredItems) == 0 {
-		stopTimer(ctx)
-	}
-	log.Infof("HandleDeferred() done map %d\n", len(ctx.deferredItems))
-	return len(ctx.deferredItems) == 0
+	return true
 }
 
 // Check if there are any deferred items for this key
@@ -168,22 +231,22 @@ func (ctx *DeferredContext) removeDeferred(key string) {
 
 // Replace any item for the specified key. If timer not running start it
 func SetDeferred(key string, buf *bytes.Buffer, size int64, url string,
-	zedcloudCtx ZedCloudContext, return400 bool) {
+	zedcloudCtx ZedCloudContext, return400 bool, priority DeferredPriority) {
 
 	if defaultCtx == nil {
 		log.Fatal("SetDeferred no defaultCtx")
 	}
-	defaultCtx.setDeferred(key, buf, size, url, zedcloudCtx, return400)
+	defaultCtx.setDeferred(key, buf, size, url, zedcloudCtx, return400,
+		priority)
 }
 
 func (ctx *DeferredContext) setDeferred(key string, buf *bytes.Buffer,
-	size int64, url string, zedcloudCtx ZedCloudContext, return400 bool) {
+	size int64, url string, zedcloudCtx ZedCloudContext, return400 bool,
+	priority DeferredPriority) {
 
-	log.Infof("SetDeferred(%s) size %d map %d\n",
-		key, size, len(ctx.deferredItems))
-	if len(ctx.deferredItems) == 0 {
-		startTimer(ctx)
-	}
+	log.Infof("SetDeferred(%s) size %d priority %s map %d\n",
+		key, size, priority, len(ctx.deferredItems))
+	restart := len(ctx.deferredItems) == 0 || priority < ctx.timerPriority
 	_, ok := ctx.deferredItems[key]
 	if ok {
 		log.Debugf("Replacing key %s\n", key)
@@ -197,34 +260,39 @@ func (ctx *DeferredContext) setDeferred(key string, buf *bytes.Buffer,
 		zedcloudCtx: zedcloudCtx,
 		return400:   return400,
 	}
-	l := deferredItemList{}
+	l := deferredItemList{priority: priority}
 	l.list = append(l.list, item)
 	ctx.deferredItems[key] = l
+	if restart {
+		startTimer(ctx)
+	}
 }
 
 // Add to slice for this key
 func AddDeferred(key string, buf *bytes.Buffer, size int64, url string,
-	zedcloudCtx ZedCloudContext, return400 bool) {
+	zedcloudCtx ZedCloudContext, return400 bool, priority DeferredPriority) {
 
 	if defaultCtx == nil {
 		log.Fatal("SetDeferred no defaultCtx")
 	}
-	defaultCtx.addDeferred(key, buf, size, url, zedcloudCtx, return400)
+	defaultCtx.addDeferred(key, buf, size, url, zedcloudCtx, return400,
+		priority)
 }
 
+// The priority of the first item for a key applies to all of them
 func (ctx *DeferredContext) addDeferred(key string, buf *bytes.Buffer,
-	size int64, url string, zedcloudCtx ZedCloudContext, return400 bool) {
+	size int64, url string, zedcloudCtx ZedCloudContext, return400 bool,
+	priority DeferredPriority) {
 
-	log.Infof("AddDeferred(%s) size %d map %d\n", key,
-		size, len(ctx.deferredItems))
-	if len(ctx.deferredItems) == 0 {
-		startTimer(ctx)
-	}
+	log.Infof("AddDeferred(%s) size %d priority %s map %d\n", key,
+		size, priority, len(ctx.deferredItems))
+	restart := len(ctx.deferredItems) == 0 || priority < ctx.timerPriority
 	l, ok := ctx.deferredItems[key]
 	if ok {
 		log.Debugf("Appending to key %s have %d\n", key, len(l.list))
 	} else {
 		log.Debugf("Adding key %s\n", key)
+		l.priority = priority
 	}
 	item := deferredItem{
 		buf:         buf,
@@ -235,19 +303,42 @@ func (ctx *DeferredContext) addDeferred(key string, buf *bytes.Buffer,
 	}
 	l.list = append(l.list, item)
 	ctx.deferredItems[key] = l
+	if restart {
+		startTimer(ctx)
+	}
 }
 
-// Try every minute backoff to every 15 minutes
+// Backoff per the policy of the highest priority queued
 func startTimer(ctx *DeferredContext) {
 
-	log.Infof("startTimer()\n")
-	min := 1 * time.Minute
-	max := 15 * time.Minute
-	ctx.ticker.UpdateExpTicker(min, max, 0.3)
+	priority := ctx.highestPriority()
+	log.Infof("startTimer() priority %s\n", priority)
+	policy := deferredPolicies[priority]
+	ctx.timerPriority = priority
+	ctx.ticker.UpdateExpTicker(policy.minRetry, policy.maxRetry, 0.3)
+}
+
+// Of the deferred and spooled messages. Low if none.
+func (ctx *DeferredContext) highestPriority() DeferredPriority {
+	for p := DeferredHigh; p < deferredClasses; p++ {
+		for _, l := range ctx.deferredItems {
+			if l.priority == p {
+				return p
+			}
+		}
+		if defaultSpool != nil && defaultSpool.classDepth(p) != 0 {
+			return p
+		}
+	}
+	return deferredClasses - 1
 }
 
 func stopTimer(ctx *DeferredContext) {
 
+	if SpoolDepth() != 0 {
+		log.Infof("stopTimer() spool not empty\n")
+		return
+	}
 	log.Infof("stopTimer()\n")
 	ctx.ticker.UpdateRangeTicker(longTime1, longTime2)
 }
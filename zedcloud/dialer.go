@@ -0,0 +1,168 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Happy eyeballs (RFC 8305) style dialing across the source addresses
+// of an interface and the addresses of the controller. Instead of trying
+// each source address in turn with the full timeout, we start a new
+// connection attempt every raceDelay and use the first which succeeds.
+
+package zedcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync"
+	"time"
+)
+
+// Time between starting connection attempts
+const raceDelay = 250 * time.Millisecond
+
+type dialCandidate struct {
+	local  net.IP
+	remote net.IP
+}
+
+type dialResult struct {
+	conn net.Conn
+	cand dialCandidate
+	err  error
+}
+
+// raceDialer records the winning addresses for the caller
+type raceDialer struct {
+	localAddrs []net.IP
+	timeout    time.Duration
+	lookup     func(host string) ([]net.IP, error) // Nil for system
+
+	lock       sync.Mutex
+	localAddr  net.IP
+	remoteAddr net.IP
+}
+
+func (rd *raceDialer) winner() (net.IP, net.IP) {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	return rd.localAddr, rd.remoteAddr
+}
+
+// DialContext has the signature of http.Transport.DialContext
+func (rd *raceDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []net.IP
+	if rd.lookup != nil {
+		remotes, err = rd.lookup(host)
+	} else {
+		remotes, err = net.LookupIP(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	candidates := pairAddrs(rd.localAddrs, remotes)
+	if len(candidates) == 0 {
+		errStr := fmt.Sprintf("No source address matching address family of %s %v",
+			host, remotes)
+		return nil, errors.New(errStr)
+	}
+
+	results := make(chan dialResult, len(candidates))
+	dialOne := func(cand dialCandidate) {
+		d := net.Dialer{LocalAddr: &net.TCPAddr{IP: cand.local},
+			Timeout: rd.timeout}
+		conn, err := d.DialContext(ctx, network,
+			net.JoinHostPort(cand.remote.String(), port))
+		results <- dialResult{conn: conn, cand: cand, err: err}
+	}
+
+	started := 0
+	pending := 0
+	var lastErr error
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			go drainResults(results, pending)
+			return nil, ctx.Err()
+		case <-timer.C:
+			if started < len(candidates) {
+				log.Debugf("raceDialer: trying %v from %v\n",
+					candidates[started].remote,
+					candidates[started].local)
+				go dialOne(candidates[started])
+				started++
+				pending++
+				timer.Reset(raceDelay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				rd.lock.Lock()
+				rd.localAddr = r.cand.local
+				rd.remoteAddr = r.cand.remote
+				rd.lock.Unlock()
+				// Close any late winners
+				go drainResults(results, pending)
+				return r.conn, nil
+			}
+			log.Debugf("raceDialer: %v from %v failed: %s\n",
+				r.cand.remote, r.cand.local, r.err)
+			lastErr = r.err
+			if started < len(candidates) {
+				// Don't wait for the delay after a failure
+				timer.Reset(0)
+			} else if pending == 0 {
+				return nil, lastErr
+			}
+		}
+	}
+}
+
+// Close the connections from the attempts which lost the race
+func drainResults(results chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		r := <-results
+		if r.conn != nil {
+			r.conn.Close()
+		}
+	}
+}
+
+// Order the pairs with the families interleaved, starting with the
+// family of the first remote address
+func pairAddrs(locals []net.IP, remotes []net.IP) []dialCandidate {
+	var v4, v6 []dialCandidate
+	for _, remote := range remotes {
+		for _, local := range locals {
+			if (local.To4() == nil) != (remote.To4() == nil) {
+				continue
+			}
+			cand := dialCandidate{local: local, remote: remote}
+			if remote.To4() == nil {
+				v6 = append(v6, cand)
+			} else {
+				v4 = append(v4, cand)
+			}
+		}
+	}
+	first, second := v6, v4
+	if len(remotes) > 0 && remotes[0].To4() != nil {
+		first, second = v4, v6
+	}
+	var res []dialCandidate
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			res = append(res, first[i])
+		}
+		if i < len(second) {
+			res = append(res, second[i])
+		}
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestPairAddrs(t *testing.T) {
+	locals := []net.IP{net.ParseIP("192.168.1.10"),
+		net.ParseIP("2001:db8::10")}
+	remotes := []net.IP{net.ParseIP("2001:db8::1"),
+		net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	cands := pairAddrs(locals, remotes)
+	expected := []string{"2001:db8::1", "10.0.0.1", "10.0.0.2"}
+	if len(cands) != len(expected) {
+		t.Fatalf("Expected %d candidates, got %v\n", len(expected), cands)
+	}
+	for i, exp := range expected {
+		if cands[i].remote.String() != exp {
+			t.Errorf("Candidate %d: expected %s got %s\n",
+				i, exp, cands[i].remote)
+		}
+		if (cands[i].local.To4() == nil) != (cands[i].remote.To4() == nil) {
+			t.Errorf("Candidate %d: family mismatch %v\n", i, cands[i])
+		}
+	}
+}
+
+func TestRaceDial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	rd := raceDialer{localAddrs: []net.IP{net.ParseIP("127.0.0.1"),
+		net.ParseIP("127.0.0.2")}}
+	conn, err := rd.DialContext(context.Background(), "tcp",
+		l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %s\n", err)
+	}
+	conn.Close()
+	local, remote := rd.winner()
+	if local == nil || !remote.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Unexpected winner %v %v\n", local, remote)
+	}
+}
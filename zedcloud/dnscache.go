@@ -0,0 +1,351 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Per interface DNS cache for the send path. We query the DNS servers of
+// the port from its own addresses and cache the answers for their TTL.
+// Negative answers are cached per RFC 2308, and if the servers stop
+// answering we keep using the last addresses for a while so that a
+// flapping upstream does not make every retry fail differently.
+// Ports without DNS servers use the system resolver with a fixed TTL.
+// Names in /etc/hosts take precedence as they do for the system resolver.
+
+package zedcloud
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dnsMinTTL       = 10 * time.Second // Also how long a failure is cached
+	dnsMaxTTL       = time.Hour
+	dnsNegativeTTL  = 60 * time.Second // Max for negative answers
+	dnsSystemTTL    = 60 * time.Second // For the system resolver
+	dnsStaleTTL     = 5 * time.Minute  // Use after expiry if no answer
+	dnsQueryTimeout = 5 * time.Second
+)
+
+type dnsEntry struct {
+	addrs      []net.IP
+	err        error // Cached negative answer or failure
+	expires    time.Time
+	staleUntil time.Time
+}
+
+type dnsCache struct {
+	intf    string
+	servers []net.IP // Flushed when these change
+	lock    sync.Mutex
+	entries map[string]dnsEntry
+}
+
+var dnsCachesLock sync.Mutex
+var dnsCaches = make(map[string]*dnsCache)
+
+// getDNSCache returns the cache for intf, flushing it if the servers
+// have changed
+func getDNSCache(intf string, servers []net.IP) *dnsCache {
+	dnsCachesLock.Lock()
+	defer dnsCachesLock.Unlock()
+	cache, ok := dnsCaches[intf]
+	if ok && sameIPs(cache.servers, servers) {
+		return cache
+	}
+	if ok {
+		log.Infof("getDNSCache: %s servers changed from %v to %v\n",
+			intf, cache.servers, servers)
+	}
+	cache = &dnsCache{intf: intf, servers: servers,
+		entries: make(map[string]dnsEntry)}
+	dnsCaches[intf] = cache
+	return cache
+}
+
+func sameIPs(a []net.IP, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func clampTTL(ttl time.Duration, max time.Duration) time.Duration {
+	if ttl < dnsMinTTL {
+		return dnsMinTTL
+	}
+	if ttl > max {
+		return max
+	}
+	return ttl
+}
+
+// lookup returns the cached addresses for host or calls query
+func (cache *dnsCache) lookup(host string, now time.Time,
+	query func(host string) (dnsReply, error)) ([]net.IP, error) {
+
+	cache.lock.Lock()
+	entry, ok := cache.entries[host]
+	cache.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		log.Debugf("dnsCache: %s on %s cached %v %v\n", host,
+			cache.intf, entry.addrs, entry.err)
+		return entry.addrs, entry.err
+	}
+	reply, err := query(host)
+	if err != nil {
+		if ok && len(entry.addrs) != 0 && now.Before(entry.staleUntil) {
+			log.Warnf("dnsCache: %s on %s failed: %s; using %v\n",
+				host, cache.intf, err, entry.addrs)
+			entry.expires = now.Add(dnsMinTTL)
+			cache.store(host, entry)
+			return entry.addrs, nil
+		}
+		errStr := fmt.Sprintf("DNS lookup of %s on %s failed: %s",
+			host, cache.intf, err)
+		err = errors.New(errStr)
+		cache.store(host, dnsEntry{err: err,
+			expires: now.Add(dnsMinTTL)})
+		return nil, err
+	}
+	ttl := time.Duration(reply.ttl) * time.Second
+	if len(reply.addrs) == 0 {
+		if ttl == 0 {
+			ttl = dnsNegativeTTL
+		}
+		errStr := fmt.Sprintf("No addresses for %s on %s", host,
+			cache.intf)
+		err = errors.New(errStr)
+		cache.store(host, dnsEntry{err: err,
+			expires: now.Add(clampTTL(ttl, dnsNegativeTTL))})
+		return nil, err
+	}
+	expires := now.Add(clampTTL(ttl, dnsMaxTTL))
+	cache.store(host, dnsEntry{addrs: reply.addrs, expires: expires,
+		staleUntil: expires.Add(dnsStaleTTL)})
+	return reply.addrs, nil
+}
+
+func (cache *dnsCache) store(host string, entry dnsEntry) {
+	cache.lock.Lock()
+	cache.entries[host] = entry
+	cache.lock.Unlock()
+}
+
+// lookupHostOnIntf returns the addresses of host using the cache for
+// intf. Literal addresses are returned as is.
+func lookupHostOnIntf(status *types.DeviceNetworkStatus, intf string,
+	host string) ([]net.IP, error) {
+
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if addrs := lookupHostsFile(host); len(addrs) != 0 {
+		return addrs, nil
+	}
+	var servers []net.IP
+	for _, port := range status.Ports {
+		if port.IfName == intf {
+			servers = port.DnsServers
+			break
+		}
+	}
+	var locals []net.IP
+	count := types.CountLocalAddrAnyNoLinkLocalIf(*status, intf)
+	for i := 0; i < count; i++ {
+		addr, err := types.GetLocalAddrAnyNoLinkLocal(*status, i, intf)
+		if err == nil {
+			locals = append(locals, addr)
+		}
+	}
+	cache := getDNSCache(intf, servers)
+	return cache.lookup(host, time.Now(), func(host string) (dnsReply, error) {
+		if len(servers) == 0 {
+			return lookupSystem(host)
+		}
+		return lookupServers(locals, servers, host)
+	})
+}
+
+// Query the servers in turn until one answers, asking for the address
+// families we have source addresses for
+func lookupServers(locals []net.IP, servers []net.IP,
+	host string) (dnsReply, error) {
+
+	var qtypes []uint16
+	var local4, local6 net.IP
+	for _, local := range locals {
+		if local.To4() != nil && local4 == nil {
+			local4 = local
+			qtypes = append(qtypes, dnsTypeA)
+		} else if local.To4() == nil && local6 == nil {
+			local6 = local
+			qtypes = append(qtypes, dnsTypeAAAA)
+		}
+	}
+	lastErr := errors.New("no source address for the DNS servers")
+	for _, server := range servers {
+		local := local4
+		if server.To4() == nil {
+			local = local6
+		}
+		if local == nil {
+			continue
+		}
+		var reply dnsReply
+		var negTTL uint32
+		var err error
+		for _, qtype := range qtypes {
+			var r dnsReply
+			r, err = queryDNS(local, server, host, qtype,
+				dnsQueryTimeout)
+			if err != nil {
+				break
+			}
+			if len(r.addrs) == 0 {
+				negTTL = r.ttl
+				continue
+			}
+			if len(reply.addrs) == 0 || r.ttl < reply.ttl {
+				reply.ttl = r.ttl
+			}
+			reply.addrs = append(reply.addrs, r.addrs...)
+		}
+		if err != nil {
+			log.Debugf("lookupServers: %s from %s failed: %s\n",
+				host, server, err)
+			lastErr = err
+			continue
+		}
+		if len(reply.addrs) == 0 {
+			reply.ttl = negTTL
+		}
+		return reply, nil
+	}
+	return dnsReply{}, lastErr
+}
+
+func lookupSystem(host string) (dnsReply, error) {
+	addrs, err := net.LookupIP(host)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok &&
+			!dnsErr.Temporary() && !dnsErr.Timeout() {
+			return dnsReply{}, nil
+		}
+		return dnsReply{}, err
+	}
+	return dnsReply{addrs: addrs, ttl: uint32(dnsSystemTTL.Seconds())}, nil
+}
+
+// dialCached returns a DialContext for http.Transport which resolves
+// the address using lookup and tries the addresses of the same family
+// as the source address of the dialer in turn
+func dialCached(d net.Dialer,
+	lookup func(host string) ([]net.IP, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	var local net.IP
+	if tcpAddr, ok := d.LocalAddr.(*net.TCPAddr); ok {
+		local = tcpAddr.IP
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		remotes, err := lookup(host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, remote := range remotes {
+			if local != nil && (local.To4() == nil) != (remote.To4() == nil) {
+				continue
+			}
+			conn, err := d.DialContext(ctx, network,
+				net.JoinHostPort(remote.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if lastErr == nil {
+			errStr := fmt.Sprintf("No address for %s matching source %v: %v",
+				host, local, remotes)
+			lastErr = errors.New(errStr)
+		}
+		return nil, lastErr
+	}
+}
+
+// The parsed hosts file; reread when its modification time changes
+var hostsFile = "/etc/hosts"
+
+type hostsCache struct {
+	lock    sync.Mutex
+	modTime time.Time
+	addrs   map[string][]net.IP // Key is the lower case name
+}
+
+var hosts hostsCache
+
+// lookupHostsFile returns the addresses for host in hostsFile, if any
+func lookupHostsFile(host string) []net.IP {
+	hosts.lock.Lock()
+	defer hosts.lock.Unlock()
+	st, err := os.Stat(hostsFile)
+	if err != nil {
+		hosts.addrs = nil
+		return nil
+	}
+	if hosts.addrs == nil || !st.ModTime().Equal(hosts.modTime) {
+		hosts.addrs = readHostsFile(hostsFile)
+		hosts.modTime = st.ModTime()
+	}
+	return hosts.addrs[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+func readHostsFile(fileName string) map[string][]net.IP {
+	addrs := make(map[string][]net.IP)
+	f, err := os.Open(fileName)
+	if err != nil {
+		log.Errorf("readHostsFile: %s\n", err)
+		return addrs
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Drop any IPv6 zone as we can not use it to connect
+		ip := net.ParseIP(strings.SplitN(fields[0], "%", 2)[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			addrs[name] = append(addrs[name], ip)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+const testDNSHost = "zedcloud.example.com"
+
+// Append a record with the name pointing at the question
+func appendDNSRecord(msg []byte, rtype uint16, ttl uint32,
+	rdata []byte) []byte {
+
+	rec := make([]byte, 12)
+	binary.BigEndian.PutUint16(rec[0:], 0xC00C)
+	binary.BigEndian.PutUint16(rec[2:], rtype)
+	binary.BigEndian.PutUint16(rec[4:], dnsClassINET)
+	binary.BigEndian.PutUint32(rec[6:], ttl)
+	binary.BigEndian.PutUint16(rec[10:], uint16(len(rdata)))
+	return append(append(msg, rec...), rdata...)
+}
+
+func makeDNSReply(t *testing.T, flags uint16, ancount uint16,
+	nscount uint16) []byte {
+
+	msg, err := packDNSQuery(1234, testDNSHost, dnsTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[6:], ancount)
+	binary.BigEndian.PutUint16(msg[8:], nscount)
+	return msg
+}
+
+func TestParseDNSReply(t *testing.T) {
+	// CNAME then A with a lower TTL
+	msg := makeDNSReply(t, 0x8180, 2, 0)
+	msg = appendDNSRecord(msg, 5, 300, []byte{3, 'f', 'o', 'o', 0xC0, 0x0C})
+	msg = appendDNSRecord(msg, dnsTypeA, 60, []byte{192, 0, 2, 1})
+	reply, err := parseDNSReply(msg, 1234, testDNSHost, dnsTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.addrs) != 1 || !reply.addrs[0].Equal(net.ParseIP("192.0.2.1")) ||
+		reply.ttl != 60 {
+		t.Errorf("Positive got %+v", reply)
+	}
+	if _, err := parseDNSReply(msg, 1235, testDNSHost, dnsTypeA); err != errDNSIdMismatch {
+		t.Errorf("Id mismatch got %v", err)
+	}
+	// A reply for a different question is ignored
+	for _, host := range []string{"other.example.com", "zedcloud.example"} {
+		if _, err := parseDNSReply(msg, 1234, host, dnsTypeA); err != errDNSQuestionMismatch {
+			t.Errorf("Question %s got %v", host, err)
+		}
+	}
+	if _, err := parseDNSReply(msg, 1234, testDNSHost, dnsTypeAAAA); err != errDNSQuestionMismatch {
+		t.Errorf("Question type got %v", err)
+	}
+	if _, err := parseDNSReply(msg, 1234, "ZEDCLOUD.example.com.", dnsTypeA); err != nil {
+		t.Errorf("Question case got %v", err)
+	}
+
+	// NXDOMAIN with the SOA minimum lower than its TTL
+	msg = makeDNSReply(t, 0x8183, 0, 1)
+	soa := []byte{0, 0}
+	for _, v := range []uint32{1, 3600, 600, 86400, 120} {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		soa = append(soa, b...)
+	}
+	msg = appendDNSRecord(msg, dnsTypeSOA, 900, soa)
+	reply, err = parseDNSReply(msg, 1234, testDNSHost, dnsTypeA)
+	if err != nil || len(reply.addrs) != 0 || reply.ttl != 120 {
+		t.Errorf("Negative got %+v %v", reply, err)
+	}
+
+	// SERVFAIL and a truncated empty reply are failures
+	for _, flags := range []uint16{0x8182, 0x8380} {
+		msg = makeDNSReply(t, flags, 0, 0)
+		if _, err := parseDNSReply(msg, 1234, testDNSHost, dnsTypeA); err == nil {
+			t.Errorf("Flags 0x%x accepted", flags)
+		}
+	}
+	msg = makeDNSReply(t, 0x8180, 1, 0)
+	if _, err := parseDNSReply(msg, 1234, testDNSHost, dnsTypeA); err == nil {
+		t.Errorf("Missing record accepted")
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	cache := getDNSCache("test0", nil)
+	addr := net.ParseIP("192.0.2.1")
+	queries := 0
+	var next dnsReply
+	var nextErr error
+	query := func(host string) (dnsReply, error) {
+		queries++
+		return next, nextErr
+	}
+	now := time.Now()
+	next = dnsReply{addrs: []net.IP{addr}, ttl: 30}
+	steps := []struct {
+		name    string
+		offset  time.Duration
+		err     error // Returned by query
+		queries int   // Expected total
+		ok      bool
+	}{
+		{"first", 0, nil, 1, true},
+		{"cached", 20 * time.Second, nil, 1, true},
+		{"expired", 31 * time.Second, nil, 2, true},
+		{"stale", 70 * time.Second, errors.New("timeout"), 3, true},
+		{"stale cached", 75 * time.Second, errors.New("timeout"), 3, true},
+		{"too stale", 10 * time.Minute, errors.New("timeout"), 4, false},
+		{"failure cached", 10*time.Minute + time.Second, nil, 4, false},
+	}
+	for _, step := range steps {
+		nextErr = step.err
+		addrs, err := cache.lookup("zedcloud.example.com",
+			now.Add(step.offset), query)
+		if queries != step.queries || (err == nil) != step.ok {
+			t.Errorf("%s: got %v %v after %d queries", step.name,
+				addrs, err, queries)
+		}
+		if step.ok && (len(addrs) != 1 || !addrs[0].Equal(addr)) {
+			t.Errorf("%s: got %v", step.name, addrs)
+		}
+	}
+
+	// Negative answers are cached for at least dnsMinTTL
+	next = dnsReply{}
+	nextErr = nil
+	queries = 0
+	if _, err := cache.lookup("nxdomain.example.com", now, query); err == nil {
+		t.Errorf("Negative answer succeeded")
+	}
+	if _, err := cache.lookup("nxdomain.example.com",
+		now.Add(dnsMinTTL/2), query); err == nil || queries != 1 {
+		t.Errorf("Negative answer not cached: %v %d", err, queries)
+	}
+
+	// Changing the servers flushes the cache
+	if getDNSCache("test0", []net.IP{addr}) == cache {
+		t.Errorf("Cache not flushed")
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	saved := hostsFile
+	hostsFile = dir + "/hosts"
+	defer func() { hostsFile = saved }()
+
+	content := "# comment\n127.0.0.1 localhost\n" +
+		"192.0.2.7 Zedcloud.example.com zc # override\n" +
+		"2001:db8::7 zedcloud.example.com\n"
+	if err := ioutil.WriteFile(hostsFile, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+	status := types.DeviceNetworkStatus{}
+	addrs, err := lookupHostOnIntf(&status, "test1", "zedcloud.example.com")
+	if err != nil || len(addrs) != 2 ||
+		!addrs[0].Equal(net.ParseIP("192.0.2.7")) ||
+		!addrs[1].Equal(net.ParseIP("2001:db8::7")) {
+		t.Errorf("Override got %v %v", addrs, err)
+	}
+	if addrs := lookupHostsFile("ZC."); len(addrs) != 1 {
+		t.Errorf("Alias got %v", addrs)
+	}
+	if addrs := lookupHostsFile("comment"); len(addrs) != 0 {
+		t.Errorf("Comment got %v", addrs)
+	}
+
+	// A change is picked up
+	content = "192.0.2.8 zedcloud.example.com\n"
+	if err := ioutil.WriteFile(hostsFile, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s\n", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(hostsFile, later, later)
+	addrs = lookupHostsFile("zedcloud.example.com")
+	if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("192.0.2.8")) {
+		t.Errorf("Changed got %v", addrs)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Minimal DNS client for A and AAAA queries over UDP. Unlike the Go
+// resolver it returns the TTL of the answer, and it sends the query
+// from a given source address.
+// A reply is only accepted from the server address and port, with our
+// random id, and with the question we asked.
+
+package zedcloud
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA     = 1
+	dnsTypeSOA   = 6
+	dnsTypeAAAA  = 28
+	dnsClassINET = 1
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeNXDomain = 3
+)
+
+var errDNSIdMismatch = errors.New("DNS reply id mismatch")
+var errDNSQuestionMismatch = errors.New("DNS reply question mismatch")
+
+// dnsReply is the result of one query. A reply with no addrs and a nil
+// error is a negative answer which can be cached for ttl.
+type dnsReply struct {
+	addrs []net.IP
+	ttl   uint32
+}
+
+// Pack the query for host with the recursion desired flag set
+func packDNSQuery(id uint16, host string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			errStr := fmt.Sprintf("invalid DNS name %s", host)
+			return nil, errors.New(errStr)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = append(msg, byte(qtype>>8), byte(qtype),
+		byte(dnsClassINET>>8), byte(dnsClassINET))
+	return msg, nil
+}
+
+// Return the offset after the possibly compressed name at off
+func skipDNSName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		b := int(msg[off])
+		switch {
+		case b == 0:
+			return off + 1, nil
+		case b&0xC0 == 0xC0:
+			return off + 2, nil
+		default:
+			off += 1 + b
+		}
+	}
+	return 0, errors.New("DNS reply truncated in name")
+}
+
+// Return the name at off, following compression pointers, and the
+// offset after it
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	// Bound the pointers to avoid loops
+	for hops := 0; hops < 16; {
+		if off >= len(msg) {
+			break
+		}
+		b := int(msg[off])
+		switch {
+		case b == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case b&0xC0 == 0xC0:
+			if off+2 > len(msg) {
+				return "", 0, errors.New("DNS reply truncated in name")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			hops++
+		default:
+			if off+1+b > len(msg) {
+				return "", 0, errors.New("DNS reply truncated in name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+b]))
+			off += 1 + b
+		}
+	}
+	return "", 0, errors.New("DNS reply bad name")
+}
+
+// Parse the reply to the query with id for host and qtype. The TTL is
+// the minimum across the answers, which includes any CNAMEs, or for a
+// negative answer from the SOA per RFC 2308.
+func parseDNSReply(msg []byte, id uint16, host string,
+	qtype uint16) (dnsReply, error) {
+
+	var reply dnsReply
+	if len(msg) < 12 {
+		return reply, errors.New("DNS reply too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return reply, errDNSIdMismatch
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return reply, errors.New("DNS reply is not a response")
+	}
+	rcode := flags & 0xF
+	if rcode != dnsRcodeSuccess && rcode != dnsRcodeNXDomain {
+		errStr := fmt.Sprintf("DNS reply rcode %d", rcode)
+		return reply, errors.New(errStr)
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	nscount := int(binary.BigEndian.Uint16(msg[8:]))
+	if qdcount != 1 {
+		return reply, errDNSQuestionMismatch
+	}
+	qname, off, err := readDNSName(msg, 12)
+	if err != nil {
+		return reply, err
+	}
+	if off+4 > len(msg) {
+		return reply, errors.New("DNS reply truncated in question")
+	}
+	if !strings.EqualFold(qname, strings.TrimSuffix(host, ".")) ||
+		binary.BigEndian.Uint16(msg[off:]) != qtype ||
+		binary.BigEndian.Uint16(msg[off+2:]) != dnsClassINET {
+		return reply, errDNSQuestionMismatch
+	}
+	off += 4
+	haveTTL := false
+	negTTL := uint32(0)
+	for i := 0; i < ancount+nscount; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return reply, err
+		}
+		if off+10 > len(msg) {
+			return reply, errors.New("DNS reply truncated in record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rclass := binary.BigEndian.Uint16(msg[off+2:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return reply, errors.New("DNS reply truncated in data")
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+		if rclass != dnsClassINET {
+			continue
+		}
+		if i >= ancount {
+			// Authority section; only the SOA matters
+			if rtype == dnsTypeSOA && rdlen >= 4 {
+				negTTL = ttl
+				minimum := binary.BigEndian.Uint32(rdata[rdlen-4:])
+				if minimum < negTTL {
+					negTTL = minimum
+				}
+			}
+			continue
+		}
+		if !haveTTL || ttl < reply.ttl {
+			reply.ttl = ttl
+			haveTTL = true
+		}
+		switch {
+		case rtype == qtype && qtype == dnsTypeA && rdlen == net.IPv4len:
+			reply.addrs = append(reply.addrs,
+				net.IPv4(rdata[0], rdata[1], rdata[2], rdata[3]))
+		case rtype == qtype && qtype == dnsTypeAAAA && rdlen == net.IPv6len:
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, rdata)
+			reply.addrs = append(reply.addrs, ip)
+		}
+	}
+	if len(reply.addrs) == 0 {
+		if flags&0x0200 != 0 {
+			// Truncated hence not a negative answer
+			return reply, errors.New("DNS reply truncated")
+		}
+		reply.ttl = negTTL
+	}
+	return reply, nil
+}
+
+// queryDNS sends the query from localAddr to the server and waits for
+// the matching reply
+func queryDNS(localAddr net.IP, server net.IP, host string, qtype uint16,
+	timeout time.Duration) (dnsReply, error) {
+
+	id, err := dnsQueryId()
+	if err != nil {
+		return dnsReply{}, err
+	}
+	query, err := packDNSQuery(id, host, qtype)
+	if err != nil {
+		return dnsReply{}, err
+	}
+	serverAddr := &net.UDPAddr{IP: server, Port: 53}
+	conn, err := net.DialUDP("udp", &net.UDPAddr{IP: localAddr},
+		serverAddr)
+	if err != nil {
+		return dnsReply{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(query); err != nil {
+		return dnsReply{}, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		// The connected socket only receives from serverAddr; check
+		// anyhow
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return dnsReply{}, err
+		}
+		if !from.IP.Equal(server) || from.Port != serverAddr.Port {
+			continue
+		}
+		reply, err := parseDNSReply(buf[:n], id, host, qtype)
+		if err == errDNSIdMismatch || err == errDNSQuestionMismatch {
+			// Late reply to an earlier query, or spoofed
+			continue
+		}
+		return reply, err
+	}
+}
+
+// Random id so that an off-path attacker can not guess it
+func dnsQueryId() (uint16, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
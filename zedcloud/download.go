@@ -0,0 +1,307 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Streaming download to a file, for large objects such as images where
+// SendOnIntf reading all the contents into memory is not appropriate.
+// The download is written to Filename.part and resumed using a Range
+// request if interrupted; the .part file is renamed to Filename once
+// complete and the optional sha256 has been verified.
+
+package zedcloud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Called as data arrives; total is zero if the size is not known
+type DownloadProgress func(downloaded int64, total int64)
+
+type DownloadRequest struct {
+	Url      string
+	Filename string
+	Sha256   string // Hex encoded; verified if set
+	Progress DownloadProgress
+	// Fail if the object is larger; zero means no limit
+	MaxSize int64
+	// Number of times to resume after an interruption
+	MaxResume int
+	// Abort a connection which receives nothing for this long
+	IdleTimeout time.Duration
+}
+
+// Default for DownloadRequest.IdleTimeout
+const downloadIdleTimeout = 60 * time.Second
+
+// DownloadResult describes the completed download
+type DownloadResult struct {
+	Size    int64
+	Intf    string
+	Resumed int // Number of Range requests used
+	Sha256  string
+}
+
+func partName(filename string) string {
+	return filename + ".part"
+}
+
+// Download tries the free management ports first like SendOnAllIntf
+func Download(ctx ZedCloudContext, dreq DownloadRequest,
+	iteration int) (DownloadResult, error) {
+
+	var lastError error
+	intfs := types.GetMgmtPortsFree(*ctx.DeviceNetworkStatus, iteration)
+	intfs = append(intfs,
+		types.GetMgmtPortsNonFree(*ctx.DeviceNetworkStatus, iteration)...)
+	if len(intfs) == 0 {
+		return DownloadResult{}, errors.New("No management interfaces")
+	}
+	for _, intf := range intfs {
+		res, err := DownloadOnIntf(ctx, dreq, intf)
+		if err == nil {
+			return res, nil
+		}
+		lastError = err
+	}
+	errStr := fmt.Sprintf("All attempts to download %s failed: %s",
+		dreq.Url, lastError)
+	log.Errorln(errStr)
+	return DownloadResult{}, errors.New(errStr)
+}
+
+// DownloadOnIntf downloads using the source addresses on intf. Any
+// partial file from a previous call is resumed.
+func DownloadOnIntf(ctx ZedCloudContext, dreq DownloadRequest,
+	intf string) (DownloadResult, error) {
+
+	res := DownloadResult{Intf: intf}
+	reqUrl, useTLS := fullUrl(dreq.Url)
+	addrCount := types.CountLocalAddrAnyNoLinkLocalIf(*ctx.DeviceNetworkStatus, intf)
+	if addrCount == 0 {
+		errStr := fmt.Sprintf("No IP addresses to download %s using intf %s",
+			reqUrl, intf)
+		return res, errors.New(errStr)
+	}
+	idleTimeout := dreq.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = downloadIdleTimeout
+	}
+	proxyUrl, auth, err := lookupProxy(ctx.DeviceNetworkStatus, intf, reqUrl)
+	if err != nil {
+		proxyUrl = nil
+	}
+	transport := newTransport(ctx, proxyUrl, useTLS)
+	transport.ResponseHeaderTimeout = idleTimeout
+	defer transport.CloseIdleConnections()
+
+	tmpName := partName(dreq.Filename)
+	file, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return res, err
+	}
+	defer file.Close()
+
+	// Hash what we already have from an earlier attempt
+	h := sha256.New()
+	offset, err := io.Copy(h, file)
+	if err != nil {
+		return res, err
+	}
+	if offset != 0 {
+		log.Infof("DownloadOnIntf: resuming %s at %d\n", reqUrl, offset)
+	}
+
+	var lastError error
+	for attempt := 0; attempt <= dreq.MaxResume; attempt++ {
+		localAddr, err := types.GetLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus,
+			attempt, intf)
+		if err != nil {
+			return res, err
+		}
+		d := net.Dialer{LocalAddr: &net.TCPAddr{IP: localAddr},
+			Timeout: ctx.Timeouts.effective(0).Connect}
+		transport.Dial = d.Dial
+
+		req, err := http.NewRequest("GET", reqUrl, nil)
+		if err != nil {
+			return res, err
+		}
+		if offset != 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			res.Resumed++
+		}
+		if proxyUrl != nil {
+			err := setupProxyAuth(transport, req, d, proxyUrl, auth)
+			if err != nil {
+				lastError = err
+				continue
+			}
+		}
+		if err := runPreRequestHooks(ctx, req, intf); err != nil {
+			return res, err
+		}
+		if err := authenticate(ctx, req); err != nil {
+			return res, err
+		}
+		done, n, err := downloadOnce(ctx, transport, req, intf, file, h,
+			&offset, dreq, idleTimeout)
+		AddBandwidth(intf, CategoryImage, 0, n)
+		if err != nil {
+			log.Errorf("DownloadOnIntf: %s via %s source %v: %s\n",
+				reqUrl, intf, localAddr, err)
+			if ctx.FailureFunc != nil {
+				ctx.FailureFunc(intf, reqUrl, 0, n)
+			}
+			lastError = err
+			if !done {
+				continue
+			}
+			return res, err
+		}
+		if ctx.SuccessFunc != nil {
+			ctx.SuccessFunc(intf, reqUrl, 0, n)
+		}
+		res.Size = offset
+		res.Sha256 = hex.EncodeToString(h.Sum(nil))
+		if dreq.Sha256 != "" && !strings.EqualFold(dreq.Sha256, res.Sha256) {
+			os.Remove(tmpName)
+			errStr := fmt.Sprintf("sha256 mismatch for %s: expected %s got %s",
+				reqUrl, dreq.Sha256, res.Sha256)
+			log.Errorln(errStr)
+			return res, errors.New(errStr)
+		}
+		if err := file.Close(); err != nil {
+			return res, err
+		}
+		if err := os.Rename(tmpName, dreq.Filename); err != nil {
+			return res, err
+		}
+		log.Infof("DownloadOnIntf: %s size %d resumed %d times\n",
+			reqUrl, res.Size, res.Resumed)
+		return res, nil
+	}
+	errStr := fmt.Sprintf("Download %s using intf %s failed: %s",
+		reqUrl, intf, lastError)
+	return res, errors.New(errStr)
+}
+
+// downloadOnce does one GET and appends to file. Returns done if there
+// is no point in resuming, and the number of bytes received.
+func downloadOnce(ctx ZedCloudContext, transport *http.Transport,
+	req *http.Request, intf string, file *os.File, h hash.Hash, offset *int64,
+	dreq DownloadRequest, idleTimeout time.Duration) (bool, int64, error) {
+
+	startTime := time.Now()
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		runPostResponseHooks(ctx, req, intf, nil, nil, err,
+			time.Since(startTime))
+		return false, 0, err
+	}
+	defer resp.Body.Close()
+	runPostResponseHooks(ctx, req, intf, resp, nil, nil,
+		time.Since(startTime))
+
+	var total int64
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Server ignored the Range; start over
+		if *offset != 0 {
+			log.Warnf("downloadOnce: %s no range support; restarting\n",
+				req.URL)
+			if err := file.Truncate(0); err != nil {
+				return true, 0, err
+			}
+			h.Reset()
+			*offset = 0
+		}
+		if resp.ContentLength > 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusPartialContent:
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// We already have everything
+		return true, 0, nil
+	default:
+		errStr := fmt.Sprintf("download %s statuscode %d %s",
+			req.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+		// Only server errors are worth retrying
+		return resp.StatusCode < 500, 0, errors.New(errStr)
+	}
+	if dreq.MaxSize != 0 && total > dreq.MaxSize {
+		errStr := fmt.Sprintf("download %s size %d exceeds %d",
+			req.URL, total, dreq.MaxSize)
+		// Nothing to resume next time
+		file.Truncate(0)
+		return true, 0, errors.New(errStr)
+	}
+	if _, err := file.Seek(*offset, io.SeekStart); err != nil {
+		return true, 0, err
+	}
+	var received int64
+	buf := make([]byte, 32*1024)
+	for {
+		// Reset the deadline on each read
+		timer := time.AfterFunc(idleTimeout, func() {
+			resp.Body.Close()
+		})
+		n, err := resp.Body.Read(buf)
+		timer.Stop()
+		if n > 0 {
+			if _, werr := file.Write(buf[:n]); werr != nil {
+				return true, received, werr
+			}
+			h.Write(buf[:n])
+			*offset += int64(n)
+			received += int64(n)
+			if dreq.Progress != nil {
+				dreq.Progress(*offset, total)
+			}
+			if dreq.MaxSize != 0 && *offset > dreq.MaxSize {
+				errStr := fmt.Sprintf("download %s exceeds %d",
+					req.URL, dreq.MaxSize)
+				file.Truncate(0)
+				return true, received, errors.New(errStr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, received, err
+		}
+	}
+	if total != 0 && *offset < total {
+		errStr := fmt.Sprintf("download %s short: %d of %d",
+			req.URL, *offset, total)
+		return false, received, errors.New(errStr)
+	}
+	return true, received, nil
+}
+
+// Parse "bytes 100-199/200"; returns zero if the total is unknown
+func contentRangeTotal(contentRange string) int64 {
+	slash := strings.LastIndex(contentRange, "/")
+	if slash < 0 {
+		return 0
+	}
+	total, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return total
+}
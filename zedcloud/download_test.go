@@ -0,0 +1,147 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestDownloadResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	sum := sha256.Sum256(content)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Send half and drop the connection
+			w.Header().Set("Content-Length", "1048576")
+			w.Write(content[:len(content)/2])
+			return
+		}
+		http.ServeContent(w, r, "image", time.Now(),
+			bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "download_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+			},
+		},
+	}
+	ctx := ZedCloudContext{DeviceNetworkStatus: &status,
+		NoLedManager: true}
+	var lastProgress int64
+	dreq := DownloadRequest{
+		Url:       server.URL + "/image",
+		Filename:  filepath.Join(dir, "image"),
+		Sha256:    hex.EncodeToString(sum[:]),
+		MaxResume: 2,
+		Progress: func(downloaded int64, total int64) {
+			lastProgress = downloaded
+		},
+	}
+	res, err := DownloadOnIntf(ctx, dreq, "lo")
+	if err != nil {
+		t.Fatalf("DownloadOnIntf failed: %s\n", err)
+	}
+	if res.Size != int64(len(content)) || res.Resumed != 1 {
+		t.Errorf("Unexpected result %+v\n", res)
+	}
+	if lastProgress != int64(len(content)) {
+		t.Errorf("Progress reported %d\n", lastProgress)
+	}
+	got, err := ioutil.ReadFile(dreq.Filename)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Downloaded content mismatch: %v\n", err)
+	}
+	if _, err := os.Stat(partName(dreq.Filename)); err == nil {
+		t.Errorf("Part file left behind\n")
+	}
+}
+
+func TestDownloadMaxSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	chunked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if chunked {
+			// No Content-Length
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			w.Write(content[len(content)/2:])
+			return
+		}
+		http.ServeContent(w, r, "image", time.Now(),
+			bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "download_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+			},
+		},
+	}
+	ctx := ZedCloudContext{DeviceNetworkStatus: &status,
+		NoLedManager: true}
+	dreq := DownloadRequest{
+		Url:      server.URL + "/image",
+		Filename: filepath.Join(dir, "image"),
+		MaxSize:  int64(len(content)) - 1,
+	}
+	for _, chunked = range []bool{false, true} {
+		if _, err := DownloadOnIntf(ctx, dreq, "lo"); err == nil {
+			t.Errorf("No error above MaxSize, chunked %t\n", chunked)
+		}
+		if _, err := os.Stat(dreq.Filename); err == nil {
+			t.Errorf("File created above MaxSize, chunked %t\n", chunked)
+		}
+		if st, err := os.Stat(partName(dreq.Filename)); err == nil && st.Size() != 0 {
+			t.Errorf("Part file kept %d bytes, chunked %t\n",
+				st.Size(), chunked)
+		}
+	}
+
+	dreq.MaxSize = int64(len(content))
+	res, err := DownloadOnIntf(ctx, dreq, "lo")
+	if err != nil || res.Size != int64(len(content)) {
+		t.Errorf("Download at MaxSize: %+v, %v\n", res, err)
+	}
+}
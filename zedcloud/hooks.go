@@ -0,0 +1,49 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Request/response hooks for ZedCloudContext so that agents can add
+// headers, sign requests, or record timing without changing SendOnIntf.
+//
+// Example usage:
+//	zedcloudCtx.PreRequestHooks = append(zedcloudCtx.PreRequestHooks,
+//		func(req *http.Request, intf string) error {
+//			req.Header.Add("X-Foo", "bar")
+//			return nil
+//		})
+
+package zedcloud
+
+import (
+	"net/http"
+	"time"
+)
+
+// PreRequestHook is called before each attempt, after the request has
+// been fully formed. An error aborts that attempt.
+type PreRequestHook func(req *http.Request, intf string) error
+
+// PostResponseHook is called after each attempt. If the attempt failed
+// then resp is nil and err is set. The resp.Body has already been read
+// into contents.
+type PostResponseHook func(req *http.Request, intf string,
+	resp *http.Response, contents []byte, err error, elapsed time.Duration)
+
+func runPreRequestHooks(ctx ZedCloudContext, req *http.Request,
+	intf string) error {
+
+	for _, hook := range ctx.PreRequestHooks {
+		if err := hook(req, intf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runPostResponseHooks(ctx ZedCloudContext, req *http.Request,
+	intf string, resp *http.Response, contents []byte, err error,
+	elapsed time.Duration) {
+
+	for _, hook := range ctx.PostResponseHooks {
+		hook(req, intf, resp, contents, err, elapsed)
+	}
+}
@@ -17,6 +17,14 @@ import (
 func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 	rawUrl string) (*url.URL, error) {
 
+	proxy, _, err := lookupProxy(status, ifname, rawUrl)
+	return proxy, err
+}
+
+// Also returns the credentials if the proxy requires Digest auth
+func lookupProxy(status *types.DeviceNetworkStatus, ifname string,
+	rawUrl string) (*url.URL, *proxyAuth, error) {
+
 	for _, port := range status.Ports {
 		log.Debugf("LookupProxy: Looking for proxy config on port %s",
 			port.IfName)
@@ -34,7 +42,7 @@ func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 		if err != nil {
 			errStr := fmt.Sprintf("LookupProxy: malformed URL %s", rawUrl)
 			log.Errorf(errStr)
-			return nil, errors.New(errStr)
+			return nil, nil, errors.New(errStr)
 		}
 
 		// Check if we have a PAC file
@@ -43,7 +51,7 @@ func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 			if err != nil {
 				errStr := fmt.Sprintf("LookupProxy: Decoding proxy file failed: %s", err)
 				log.Errorf(errStr)
-				return nil, errors.New(errStr)
+				return nil, nil, errors.New(errStr)
 			}
 			proxyString, err := zedpac.Find_proxy_sync(
 				string(pacFile), rawUrl, u.Host)
@@ -51,16 +59,16 @@ func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 				errStr := fmt.Sprintf("LookupProxy: PAC file could not find proxy for %s: %s",
 					rawUrl, err)
 				log.Errorf(errStr)
-				return nil, errors.New(errStr)
+				return nil, nil, errors.New(errStr)
 			}
 			//if proxyString == "DIRECT" {
 			if strings.HasPrefix(proxyString, "DIRECT") {
-				return nil, nil
+				return nil, nil, nil
 			}
 			proxies := strings.Split(proxyString, ";")
 			if len(proxies) == 0 {
 				log.Errorf("LookupProxy: Number of proxies in PAC file result is Zero")
-				return nil, nil
+				return nil, nil, nil
 			}
 
 			// XXX Take the first proxy for now. Failing over to the next
@@ -79,35 +87,35 @@ func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 				errStr := fmt.Sprintf("LookupProxy: PAC file returned invalid proxy %s: %s",
 					proxyString, err)
 				log.Errorf(errStr)
-				return nil, errors.New(errStr)
+				return nil, nil, errors.New(errStr)
 			}
 			log.Debugf("LookupProxy: PAC proxy being used is %s", proxy0)
-			return proxy, err
+			proxy, auth := pacProxyAuth(proxyConfig.Proxies, proxy)
+			return proxy, auth, nil
 		}
 
 		config := &Config{}
+		digestAuth := make(map[string]*proxyAuth)
 		for _, proxy := range proxyConfig.Proxies {
+			proxyStr := proxyEntryString(proxy)
+			if proxy.Username != "" && proxy.AuthType == types.NPA_DIGEST {
+				pu, err := url.Parse(proxyStr)
+				if err == nil {
+					digestAuth[pu.Host] = &proxyAuth{
+						username: proxy.Username,
+						password: proxy.Password,
+					}
+				}
+			}
 			switch proxy.Type {
 			case types.NPT_HTTP:
-				var httpProxy string
-				if proxy.Port > 0 {
-					httpProxy = fmt.Sprintf("%s:%d", proxy.Server, proxy.Port)
-				} else {
-					httpProxy = fmt.Sprintf("%s", proxy.Server)
-				}
-				config.HTTPProxy = httpProxy
+				config.HTTPProxy = proxyStr
 				log.Debugf("LookupProxy: Adding HTTP proxy %s for port %s",
-					config.HTTPProxy, ifname)
+					redactedProxyString(config.HTTPProxy), ifname)
 			case types.NPT_HTTPS:
-				var httpsProxy string
-				if proxy.Port > 0 {
-					httpsProxy = fmt.Sprintf("%s:%d", proxy.Server, proxy.Port)
-				} else {
-					httpsProxy = fmt.Sprintf("%s", proxy.Server)
-				}
-				config.HTTPSProxy = httpsProxy
+				config.HTTPSProxy = proxyStr
 				log.Debugf("LookupProxy: Adding HTTPS proxy %s for port %s",
-					config.HTTPSProxy, ifname)
+					redactedProxyString(config.HTTPSProxy), ifname)
 			default:
 				// XXX We should take care of Socks proxy, FTP proxy also in future
 			}
@@ -118,10 +126,13 @@ func LookupProxy(status *types.DeviceNetworkStatus, ifname string,
 		if err != nil {
 			errStr := fmt.Sprintf("LookupProxy: proxyFunc error: %s", err)
 			log.Errorf(errStr)
-			return proxy, errors.New(errStr)
+			return proxy, nil, errors.New(errStr)
+		}
+		if proxy == nil {
+			return nil, nil, nil
 		}
-		return proxy, err
+		return proxy, digestAuth[proxy.Host], nil
 	}
 	log.Infof("LookupProxy: No proxy configured for port %s", ifname)
-	return nil, nil
+	return nil, nil, nil
 }
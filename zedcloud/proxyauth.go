@@ -0,0 +1,340 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Proxy authentication and TLS to the proxy.
+// Basic auth is handled by http.Transport based on the user info in the
+// proxy URL. For Digest we probe the proxy with a CONNECT to get the
+// challenge and then set the Proxy-Authorization header ourselves.
+
+package zedcloud
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// proxyAuth is returned by lookupProxy when we need to do Digest
+// authentication. The credentials are then not in the proxy URL since
+// http.Transport would send them using Basic.
+type proxyAuth struct {
+	username string
+	password string
+}
+
+// RedactedProxy returns the proxy URL with any password replaced, for
+// logging and SendAttempt
+func RedactedProxy(proxyUrl *url.URL) string {
+	if proxyUrl == nil {
+		return ""
+	}
+	if proxyUrl.User == nil {
+		return proxyUrl.String()
+	}
+	if _, has := proxyUrl.User.Password(); !has {
+		return proxyUrl.String()
+	}
+	u := *proxyUrl
+	u.User = url.UserPassword(proxyUrl.User.Username(), "xxxxx")
+	return u.String()
+}
+
+func redactedProxyString(proxyStr string) string {
+	u, err := url.Parse(proxyStr)
+	if err != nil {
+		return "<unparsable>"
+	}
+	return RedactedProxy(u)
+}
+
+// Form the string used in the proxy Config; includes the scheme and for
+// Basic the user info
+func proxyEntryString(proxy types.ProxyEntry) string {
+	u := url.URL{Scheme: "http", Host: proxy.Server}
+	if proxy.UseTLS {
+		u.Scheme = "https"
+	}
+	if proxy.Port > 0 {
+		u.Host = fmt.Sprintf("%s:%d", proxy.Server, proxy.Port)
+	}
+	if proxy.Username != "" && proxy.AuthType == types.NPA_BASIC {
+		u.User = url.UserPassword(proxy.Username, proxy.Password)
+	}
+	return u.String()
+}
+
+// pacProxyAuth adds the credentials of the configured proxy with the same
+// address, if any, to a proxy from a PAC file since the PAC file only
+// has the address
+func pacProxyAuth(proxies []types.ProxyEntry,
+	proxyUrl *url.URL) (*url.URL, *proxyAuth) {
+
+	for _, proxy := range proxies {
+		if proxy.Username == "" {
+			continue
+		}
+		u, err := url.Parse(proxyEntryString(proxy))
+		if err != nil || canonicalAddr(u) != canonicalAddr(proxyUrl) {
+			continue
+		}
+		if proxy.AuthType == types.NPA_DIGEST {
+			return proxyUrl, &proxyAuth{username: proxy.Username,
+				password: proxy.Password}
+		}
+		withUser := *proxyUrl
+		withUser.User = url.UserPassword(proxy.Username, proxy.Password)
+		return &withUser, nil
+	}
+	return proxyUrl, nil
+}
+
+// Dial the proxy, using TLS if it is an https proxy
+func dialProxy(reqCtx context.Context, d net.Dialer,
+	proxyUrl *url.URL) (net.Conn, error) {
+
+	addr := canonicalAddr(proxyUrl)
+	if proxyUrl.Scheme != "https" {
+		return d.DialContext(reqCtx, "tcp", addr)
+	}
+	return dialProxyTLS(reqCtx, d, proxyUrl.Hostname(), addr)
+}
+
+// closeOnCancel closes conn if reqCtx is cancelled before stop is called
+func closeOnCancel(reqCtx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-reqCtx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// The proxy certificate is verified against the system roots and the
+// proxy name, not the controller ones in ZedCloudContext.TlsConfig
+func dialProxyTLS(reqCtx context.Context, d net.Dialer, serverName string,
+	addr string) (net.Conn, error) {
+
+	conn, err := d.DialContext(reqCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+	stop := closeOnCancel(reqCtx, conn)
+	err = tlsConn.Handshake()
+	stop()
+	if err == nil {
+		err = reqCtx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		errStr := fmt.Sprintf("TLS to proxy %s failed: %s",
+			addr, err)
+		return nil, errors.New(errStr)
+	}
+	return tlsConn, nil
+}
+
+// Send a CONNECT without credentials and return the Digest challenge
+// parameters from the 407 response. Returns nil if the proxy does not
+// require authentication.
+func digestChallenge(reqCtx context.Context, d net.Dialer, proxyUrl *url.URL,
+	target string) (map[string]string, error) {
+
+	resp, err := proxyConnect(reqCtx, d, proxyUrl, target, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		errStr := fmt.Sprintf("proxy %s CONNECT status %s",
+			RedactedProxy(proxyUrl), resp.Status)
+		return nil, errors.New(errStr)
+	}
+	return proxyDigestChallenge(resp, proxyUrl)
+}
+
+// Return the Digest parameters from a 407 response
+func proxyDigestChallenge(resp *http.Response,
+	proxyUrl *url.URL) (map[string]string, error) {
+
+	for _, hdr := range resp.Header["Proxy-Authenticate"] {
+		if !strings.HasPrefix(strings.ToLower(hdr), "digest ") {
+			continue
+		}
+		return parseDigestChallenge(hdr[len("digest "):]), nil
+	}
+	errStr := fmt.Sprintf("proxy %s did not offer Digest auth: %v",
+		RedactedProxy(proxyUrl), resp.Header["Proxy-Authenticate"])
+	return nil, errors.New(errStr)
+}
+
+// Send a CONNECT for target with the optional Proxy-Authorization and
+// return the response. The connection is closed before returning, or
+// when reqCtx is cancelled.
+func proxyConnect(reqCtx context.Context, d net.Dialer, proxyUrl *url.URL,
+	target string, authorization string) (*http.Response, error) {
+
+	conn, err := dialProxy(reqCtx, d, proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer closeOnCancel(reqCtx, conn)()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if authorization != "" {
+		req += fmt.Sprintf("Proxy-Authorization: %s\r\n", authorization)
+	}
+	req += "\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		if reqCtx.Err() != nil {
+			return nil, reqCtx.Err()
+		}
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn),
+		&http.Request{Method: "CONNECT"})
+	if err != nil {
+		if reqCtx.Err() != nil {
+			return nil, reqCtx.Err()
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// Parse the comma separated key=value or key="value" list
+func parseDigestChallenge(str string) map[string]string {
+	params := make(map[string]string)
+	for len(str) > 0 {
+		str = strings.TrimLeft(str, " ,")
+		eq := strings.Index(str, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(str[:eq]))
+		str = str[eq+1:]
+		var val string
+		if strings.HasPrefix(str, "\"") {
+			end := strings.Index(str[1:], "\"")
+			if end < 0 {
+				val = str[1:]
+				str = ""
+			} else {
+				val = str[1 : end+1]
+				str = str[end+2:]
+			}
+		} else {
+			end := strings.Index(str, ",")
+			if end < 0 {
+				val = str
+				str = ""
+			} else {
+				val = str[:end]
+				str = str[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(val)
+	}
+	return params
+}
+
+func md5Hex(str string) string {
+	sum := md5.Sum([]byte(str))
+	return hex.EncodeToString(sum[:])
+}
+
+// Compute the Proxy-Authorization header value per RFC 2617 for the
+// method and uri; for CONNECT the uri is the host:port
+func digestAuthorization(chal map[string]string, auth proxyAuth,
+	method string, uri string) string {
+
+	realm := chal["realm"]
+	nonce := chal["nonce"]
+	ha1 := md5Hex(auth.username + ":" + realm + ":" + auth.password)
+	ha2 := md5Hex(method + ":" + uri)
+	hdr := fmt.Sprintf("Digest username=\"%s\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", algorithm=MD5",
+		auth.username, realm, nonce, uri)
+
+	qop := ""
+	for _, q := range strings.Split(chal["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop != "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		cnonce := hex.EncodeToString(b)
+		nc := "00000001"
+		response = md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce +
+			":" + qop + ":" + ha2)
+		hdr += fmt.Sprintf(", qop=%s, nc=%s, cnonce=\"%s\"",
+			qop, nc, cnonce)
+	} else {
+		response = md5Hex(ha1 + ":" + nonce + ":" + ha2)
+	}
+	hdr += fmt.Sprintf(", response=\"%s\"", response)
+	if opaque, ok := chal["opaque"]; ok {
+		hdr += fmt.Sprintf(", opaque=\"%s\"", opaque)
+	}
+	return hdr
+}
+
+// setupProxyAuth prepares the transport and request for the attempt.
+// For an https proxy we dial TLS to the proxy ourselves. For Digest we
+// probe for a challenge and set the headers.
+func setupProxyAuth(transport *http.Transport, req *http.Request,
+	d net.Dialer, proxyUrl *url.URL, auth *proxyAuth) error {
+
+	if proxyUrl.Scheme == "https" {
+		serverName := proxyUrl.Hostname()
+		transport.DialTLS = func(network, addr string) (net.Conn, error) {
+			return dialProxyTLS(context.Background(), d,
+				serverName, addr)
+		}
+	}
+	if auth == nil {
+		return nil
+	}
+	target := canonicalAddr(req.URL)
+	chal, err := digestChallenge(req.Context(), d, proxyUrl, target)
+	if err != nil {
+		return err
+	}
+	if chal == nil {
+		log.Debugf("setupProxyAuth: proxy %s needs no auth\n",
+			RedactedProxy(proxyUrl))
+		return nil
+	}
+	if req.URL.Scheme == "https" {
+		transport.ProxyConnectHeader = http.Header{
+			"Proxy-Authorization": []string{
+				digestAuthorization(chal, *auth, "CONNECT", target)},
+		}
+	} else {
+		req.Header.Set("Proxy-Authorization",
+			digestAuthorization(chal, *auth, req.Method,
+				req.URL.String()))
+	}
+	return nil
+}
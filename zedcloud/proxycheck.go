@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Check that the proxy for a port is reachable and accepts our
+// credentials before testing the controller, so that a failure is
+// reported against the proxy and not the controller behind it.
+
+package zedcloud
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyError is returned by CheckProxy when the proxy is the problem
+type ProxyError struct {
+	Intf  string
+	Proxy string // Redacted
+	Auth  bool   // Reachable but rejected the credentials
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	if e.Auth {
+		return fmt.Sprintf("proxy %s authentication failed via %s: %s",
+			e.Proxy, e.Intf, e.Err)
+	}
+	return fmt.Sprintf("proxy %s unreachable via %s: %s",
+		e.Proxy, e.Intf, e.Err)
+}
+
+// CheckProxy does a CONNECT through the proxy used for rawUrl on intf,
+// if any, to the host in rawUrl. Any response other than 407 means the
+// proxy is fine; e.g., a 502 is for the controller to be blamed.
+// Returns nil if no proxy is used. Cancelling reqCtx aborts the check.
+func CheckProxy(reqCtx context.Context, status *types.DeviceNetworkStatus,
+	intf string, rawUrl string, timeout time.Duration) error {
+
+	reqUrl, _ := fullUrl(rawUrl)
+	proxyUrl, auth, err := lookupProxy(status, intf, reqUrl)
+	if err != nil {
+		return err
+	}
+	if proxyUrl == nil {
+		return nil
+	}
+	u, err := url.Parse(reqUrl)
+	if err != nil {
+		return err
+	}
+	target := canonicalAddr(u)
+	proxyErr := &ProxyError{Intf: intf, Proxy: RedactedProxy(proxyUrl)}
+	localAddr, err := types.GetLocalAddrAnyNoLinkLocal(*status, 0, intf)
+	if err != nil {
+		proxyErr.Err = err
+		return proxyErr
+	}
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: localAddr},
+		Timeout: timeout}
+	authorization := ""
+	if proxyUrl.User != nil {
+		password, _ := proxyUrl.User.Password()
+		creds := proxyUrl.User.Username() + ":" + password
+		authorization = "Basic " +
+			base64.StdEncoding.EncodeToString([]byte(creds))
+	}
+	resp, err := proxyConnect(reqCtx, d, proxyUrl, target, authorization)
+	if err == nil && resp.StatusCode == http.StatusProxyAuthRequired &&
+		auth != nil {
+
+		var chal map[string]string
+		chal, err = proxyDigestChallenge(resp, proxyUrl)
+		if err == nil {
+			authorization = digestAuthorization(chal, *auth,
+				"CONNECT", target)
+			resp, err = proxyConnect(reqCtx, d, proxyUrl, target,
+				authorization)
+		}
+	}
+	if err != nil {
+		proxyErr.Err = err
+		return proxyErr
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		proxyErr.Auth = true
+		if authorization == "" {
+			proxyErr.Err = errors.New("no credentials configured")
+		} else {
+			proxyErr.Err = errors.New(resp.Status)
+		}
+		return proxyErr
+	}
+	log.Debugf("CheckProxy: proxy %s via %s CONNECT status %s\n",
+		proxyErr.Proxy, intf, resp.Status)
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestCheckProxy(t *testing.T) {
+	// Accepts basic:secret which is "YmFzaWM6c2VjcmV0"
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != "Basic YmFzaWM6c2VjcmV0" {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	host, portStr, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	// Nothing listens on port 1
+	testMatrix := map[string]struct {
+		entry types.ProxyEntry
+		ok    bool
+		auth  bool
+	}{
+		"Basic": {
+			entry: types.ProxyEntry{Type: types.NPT_HTTPS,
+				Server: host, Port: uint32(port),
+				Username: "basic", Password: "secret"},
+			ok: true,
+		},
+		"No credentials": {
+			entry: types.ProxyEntry{Type: types.NPT_HTTPS,
+				Server: host, Port: uint32(port)},
+			auth: true,
+		},
+		"Wrong password": {
+			entry: types.ProxyEntry{Type: types.NPT_HTTPS,
+				Server: host, Port: uint32(port),
+				Username: "basic", Password: "wrong"},
+			auth: true,
+		},
+		"Unreachable": {
+			entry: types.ProxyEntry{Type: types.NPT_HTTPS,
+				Server: host, Port: 1},
+		},
+	}
+	for testname, test := range testMatrix {
+		status := types.DeviceNetworkStatus{
+			Ports: []types.NetworkPortStatus{
+				{
+					IfName: "lo",
+					IsMgmt: true,
+					AddrInfoList: []types.AddrInfo{
+						{Addr: net.ParseIP("127.0.0.1")},
+					},
+					ProxyConfig: types.ProxyConfig{
+						Proxies: []types.ProxyEntry{test.entry},
+					},
+				},
+			},
+		}
+		err := CheckProxy(context.Background(), &status, "lo",
+			"controller.example.com/api/v1/edgedevice/ping",
+			5*time.Second)
+		if test.ok {
+			if err != nil {
+				t.Errorf("%s: %s", testname, err)
+			}
+			continue
+		}
+		proxyErr, ok := err.(*ProxyError)
+		if !ok {
+			t.Errorf("%s: expected ProxyError got %v", testname, err)
+			continue
+		}
+		if proxyErr.Auth != test.auth {
+			t.Errorf("%s: got auth %v: %s", testname, proxyErr.Auth,
+				proxyErr)
+		}
+	}
+
+	// No proxy configured
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{{IfName: "lo", IsMgmt: true}},
+	}
+	if err := CheckProxy(context.Background(), &status, "lo",
+		"controller.example.com", time.Second); err != nil {
+		t.Errorf("No proxy: %s", err)
+	}
+}
+
+// Cancelling aborts a check blocked on a proxy which never answers
+func TestCheckProxyCancel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %s\n", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	host, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+				ProxyConfig: types.ProxyConfig{
+					Proxies: []types.ProxyEntry{
+						{Type: types.NPT_HTTPS, Server: host,
+							Port: uint32(port)},
+					},
+				},
+			},
+		},
+	}
+	reqCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = CheckProxy(reqCtx, &status, "lo", "controller.example.com",
+		time.Minute)
+	if err == nil {
+		t.Errorf("Cancelled check succeeded\n")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Cancel took %v\n", elapsed)
+	}
+}
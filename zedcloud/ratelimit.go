@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Token bucket to limit the bandwidth used by e.g., a remote console
+// tunnel so that it does not saturate a metered uplink.
+
+package zedcloud
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket allows rate bytes per second with bursts up to burst bytes.
+// A zero rate means no limit.
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64 // Negative when callers are waiting
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. If burst is zero it is set to
+// one second worth of tokens.
+func NewTokenBucket(rate uint64, burst uint64) *TokenBucket {
+	tb := &TokenBucket{}
+	tb.SetRate(rate, burst)
+	return tb
+}
+
+// SetRate changes the limits; the bucket is refilled
+func (tb *TokenBucket) SetRate(rate uint64, burst uint64) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	if burst == 0 {
+		burst = rate
+	}
+	tb.rate = float64(rate)
+	tb.burst = float64(burst)
+	tb.tokens = tb.burst
+	tb.last = time.Now()
+}
+
+// Rate returns the limit in bytes per second
+func (tb *TokenBucket) Rate() uint64 {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	return uint64(tb.rate)
+}
+
+// reserve takes n tokens and returns how long the caller must wait
+func (tb *TokenBucket) reserve(n int, now time.Time) time.Duration {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	if tb.rate == 0 {
+		return 0
+	}
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// Wait blocks until n bytes can be sent or received
+func (tb *TokenBucket) Wait(n int) {
+	if tb == nil {
+		return
+	}
+	if delay := tb.reserve(n, time.Now()); delay > 0 {
+		time.Sleep(delay)
+	}
+}
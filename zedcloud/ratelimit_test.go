@@ -0,0 +1,34 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(1000, 100)
+	tb.last = now
+
+	// The burst is free
+	if delay := tb.reserve(100, now); delay != 0 {
+		t.Errorf("Expected no delay got %v", delay)
+	}
+	// The next 500 bytes take half a second
+	delay := tb.reserve(500, now)
+	if delay != 500*time.Millisecond {
+		t.Errorf("Expected 500ms got %v", delay)
+	}
+	// A second later we have paid back and the bucket is full again
+	if delay := tb.reserve(100, now.Add(time.Second)); delay != 0 {
+		t.Errorf("Expected no delay got %v", delay)
+	}
+	// No limit
+	tb.SetRate(0, 0)
+	if delay := tb.reserve(1000000, now); delay != 0 {
+		t.Errorf("Expected no delay got %v", delay)
+	}
+}
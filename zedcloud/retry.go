@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Retry policy with exponential backoff and jitter for attempts to reach
+// zedcloud
+
+package zedcloud
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryConfig controls how SendOnAllIntf and the callers which loop on
+// reaching zedcloud, such as the onboarding client and diag, retry.
+// The delay before attempt N is BaseDelay * 2^N capped at MaxDelay, and
+// then randomized by +/- Jitter (a fraction between 0 and 1) to avoid
+// many devices retrying in lockstep against the controller.
+// No more attempts are made once MaxElapsed has passed since the first
+// attempt; zero means no limit.
+type RetryConfig struct {
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Jitter     float64
+	MaxElapsed time.Duration
+}
+
+var DefaultRetryConfig = RetryConfig{
+	BaseDelay:  time.Second,
+	MaxDelay:   time.Minute,
+	Jitter:     0.3,
+	MaxElapsed: 2 * time.Minute,
+}
+
+// Replaced by the tests
+var retrySleep = time.Sleep
+
+// Delay returns the time to wait before retry number attempt, where
+// attempt zero is the first retry
+func (rc RetryConfig) Delay(attempt int) time.Duration {
+	delay := rc.BaseDelay
+	for i := 0; i < attempt && (rc.MaxDelay == 0 || delay < rc.MaxDelay); i++ {
+		delay *= 2
+	}
+	if rc.MaxDelay != 0 && delay > rc.MaxDelay {
+		delay = rc.MaxDelay
+	}
+	if rc.Jitter > 0 {
+		jitter := rc.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delta := float64(delay) * jitter * (2*rand.Float64() - 1)
+		delay += time.Duration(delta)
+	}
+	return delay
+}
+
+// Retry calls try until it returns true, waiting Delay between the calls.
+// retryCount is zero for the first call. If onRetry is set it is called
+// with the delay before each wait.
+// Returns false once maxRetries (if non-zero) retries have failed, or if
+// the next wait would go past MaxElapsed.
+func (rc RetryConfig) Retry(maxRetries int, try func(retryCount int) bool,
+	onRetry func(retryCount int, delay time.Duration)) bool {
+
+	startTime := time.Now()
+	retryCount := 0
+	for !try(retryCount) {
+		if maxRetries != 0 && retryCount >= maxRetries {
+			return false
+		}
+		delay := rc.Delay(retryCount)
+		if rc.MaxElapsed != 0 &&
+			time.Since(startTime)+delay > rc.MaxElapsed {
+			return false
+		}
+		retryCount++
+		if onRetry != nil {
+			onRetry(retryCount, delay)
+		}
+		retrySleep(delay)
+	}
+	return true
+}
+
+// We retry if we did not get a response or got a server error.
+// A 4xx means the controller has spoken and retrying will not help.
+func retryable(resp *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	if resp == nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
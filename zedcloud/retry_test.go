@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	rc := RetryConfig{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+	for attempt, exp := range expected {
+		delay := rc.Delay(attempt)
+		if delay != exp*time.Second {
+			t.Errorf("attempt %d: expected %v got %v\n",
+				attempt, exp*time.Second, delay)
+		}
+	}
+
+	rc.Jitter = 0.5
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := rc.Delay(attempt)
+		if delay < 500*time.Millisecond || delay > 15*time.Second {
+			t.Errorf("attempt %d: delay %v outside jitter range\n",
+				attempt, delay)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var slept []time.Duration
+	retrySleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { retrySleep = time.Sleep }()
+
+	rc := RetryConfig{BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	var retries []int
+	done := rc.Retry(0, func(retryCount int) bool {
+		return retryCount == 3
+	}, func(retryCount int, delay time.Duration) {
+		retries = append(retries, retryCount)
+	})
+	if !done || len(retries) != 3 || retries[2] != 3 {
+		t.Errorf("Got %v retries %v\n", done, retries)
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second,
+		4 * time.Second}
+	if len(slept) != len(expected) {
+		t.Fatalf("Slept %v\n", slept)
+	}
+	for i := range expected {
+		if slept[i] != expected[i] {
+			t.Errorf("Slept %v expected %v\n", slept, expected)
+		}
+	}
+
+	calls := 0
+	if rc.Retry(2, func(int) bool { calls++; return false }, nil) {
+		t.Errorf("Done with maxRetries\n")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls got %d\n", calls)
+	}
+
+	// The first delay is past the budget
+	rc.MaxElapsed = time.Second / 2
+	calls = 0
+	if rc.Retry(0, func(int) bool { calls++; return false }, nil) {
+		t.Errorf("Done with MaxElapsed\n")
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call got %d\n", calls)
+	}
+}
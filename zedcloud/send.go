@@ -7,15 +7,18 @@ package zedcloud
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/zededa/go-provision/types"
+	"golang.org/x/net/http2"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -28,16 +31,123 @@ type ZedCloudContext struct {
 	FailureFunc         func(intf string, url string, reqLen int64, respLen int64)
 	SuccessFunc         func(intf string, url string, reqLen int64, respLen int64)
 	NoLedManager        bool // Don't call UpdateLedManagerConfig
+	NoHTTP2             bool // Only offer http/1.1 in TLS ALPN
+	// Indexed by host; see auth.go
+	AuthProviders map[string]AuthProvider
+	// For AddBandwidth; if not set it is determined from the URL
+	Category string
+	// If set the client certificate is fetched for each handshake
+	CertProvider CertProvider
+	// Zero or OCSP_OFF means the stapled response is not checked
+	OCSPPolicy types.OCSPPolicy
+	// Try the source addresses one at a time instead of racing them
+	NoRaceDial bool
+	// Zero fields use DefaultTimeouts; see timeouts.go
+	Timeouts Timeouts
+	// If set SendOnAllIntf retries with backoff until MaxElapsed;
+	// otherwise a single pass
+	RetryConfig *RetryConfig
+	// Optional hooks called for each attempt in SendOnIntf
+	PreRequestHooks   []PreRequestHook
+	PostResponseHooks []PostResponseHook
+	// If set requests to the controller fail over; see servers.go
+	Servers *ServerList
+	// Neither compress request bodies nor ask for compressed responses;
+	// see compression.go
+	NoCompression bool
+	// Called with the body sizes before and after compression when a
+	// request or response body was compressed
+	CompressionFunc func(intf string, url string, uncompressed int64, compressed int64)
+}
+
+// SendAttempt records one attempt to reach the controller using a
+// particular interface and source address
+type SendAttempt struct {
+	Intf      string
+	LocalAddr net.IP // Nil if we did not get as far as picking one
+	// Controller or proxy address; set if we connected
+	RemoteAddr string
+	Proxy      string // Empty if no proxy
+	Error      error  // Nil if we got a response
+	// One of the OCSP* strings; set if we got as far as TLS
+	OCSPStatus string
+	// File name of the root which validated the controller certificate
+	TrustAnchor string
+}
+
+// SendResult is returned by the Send functions. The Resp.Body has been
+// read into Contents and closed. Resp is nil if no response was
+// received, in which case the Attempts explain why.
+type SendResult struct {
+	Resp       *http.Response
+	StatusCode int // Zero if no response
+	Contents   []byte
+	Intf       string // Interface which got the response
+	LocalAddr  net.IP
+	RemoteAddr string
+	Proxy      string // Proxy used for the response if any
+	Protocol   string // E.g., "HTTP/2.0"
+	TLSVersion uint16 // Zero unless https
+	DidResume  bool   // TLS session resumption
+	OCSPStatus string // From the attempt which got the response
+	// File name of the root which validated the controller certificate
+	TrustAnchor string
+	Attempts    []SendAttempt
+}
+
+// HasStatus is a helper for callers which check for a specific response
+func (res SendResult) HasStatus(statusCode int) bool {
+	return res.Resp != nil && res.StatusCode == statusCode
 }
 
 // Tries all interfaces (free first) until one succeeds. interation arg
 // ensure load spreading across multiple interfaces.
-// Returns response for first success. Caller can not use resp.Body but can
-// use []byte contents return.
-func SendOnAllIntf(ctx ZedCloudContext, url string, reqlen int64, b *bytes.Buffer, iteration int, return400 bool) (*http.Response, []byte, error) {
+// Returns result for first success. The result includes all the
+// attempts made.
+// If ctx.RetryConfig is set we retry with backoff until the budget is
+// exhausted.
+func SendOnAllIntf(ctx ZedCloudContext, url string, reqlen int64, b *bytes.Buffer, iteration int, return400 bool) (SendResult, error) {
+
+	if ctx.Servers != nil {
+		return sendOnServers(ctx, url, reqlen, b, iteration, return400)
+	}
+	if ctx.RetryConfig == nil {
+		return sendOnAllIntfOnce(ctx, url, reqlen, b, iteration,
+			return400)
+	}
+	var body []byte
+	if b != nil {
+		// Need to resend the same content on retry
+		body = b.Bytes()
+	}
+	var res SendResult
+	var err error
+	var attempts []SendAttempt
+	done := ctx.RetryConfig.Retry(0, func(retryCount int) bool {
+		var buf *bytes.Buffer
+		if b != nil {
+			buf = bytes.NewBuffer(body)
+		}
+		res, err = sendOnAllIntfOnce(ctx, url, reqlen, buf,
+			iteration+retryCount, return400)
+		attempts = append(attempts, res.Attempts...)
+		res.Attempts = attempts
+		return !retryable(res.Resp, err)
+	}, func(retryCount int, delay time.Duration) {
+		log.Infof("sendOnAllIntf: retry %d for %s in %v\n",
+			retryCount, url, delay)
+	})
+	if !done {
+		log.Errorf("sendOnAllIntf: giving up on %s\n", url)
+	}
+	return res, err
+}
+
+func sendOnAllIntfOnce(ctx ZedCloudContext, url string, reqlen int64, b *bytes.Buffer, iteration int, return400 bool) (SendResult, error) {
 	// If failed then try the non-free
 	const allowProxy = true
 	var lastError error
+	var attempts []SendAttempt
 
 	for try := 0; try < 2; try += 1 {
 		var intfs []string
@@ -64,115 +174,135 @@ func SendOnAllIntf(ctx ZedCloudContext, url string, reqlen int64, b *bytes.Buffe
 			}
 		}
 		for _, intf := range intfs {
-			// XXX Hard coded timeout to 15 seconds. Might need some adjusting
-			// depending on network conditions down the road.
-			resp, contents, err := SendOnIntf(ctx, url, intf, reqlen, b, allowProxy, 15)
-			if return400 && resp != nil &&
-				resp.StatusCode == 400 {
+			res, err := SendOnIntf(context.Background(), ctx, url,
+				intf, reqlen, b, allowProxy, 0)
+			attempts = append(attempts, res.Attempts...)
+			res.Attempts = attempts
+			if return400 && res.HasStatus(400) {
 				log.Infof("sendOnAllIntf: for %s reqlen %d ignore code %d\n",
-					url, reqlen, resp.StatusCode)
-				return resp, nil, err
+					url, reqlen, res.StatusCode)
+				res.Contents = nil
+				return res, err
 			}
 			if err != nil {
 				lastError = err
 				continue
 			}
-			return resp, contents, nil
+			return res, nil
 		}
 	}
 	errStr := fmt.Sprintf("All attempts to connect to %s failed: %s",
 		url, lastError)
 	log.Errorln(errStr)
-	return nil, nil, errors.New(errStr)
+	return SendResult{Attempts: attempts}, errors.New(errStr)
 }
 
-// We try with free interfaces first. If we find enough free interfaces through
-// which cloud connectivity can be achieved, we won't test non-free interfaces.
-// Otherwise we test non-free interfaces also.
-func VerifyAllIntf(ctx ZedCloudContext,
-	url string, successCount int, iteration int) (bool, error) {
-	var intfSuccessCount int = 0
-	const allowProxy = true
-	var lastError error
-
-	if successCount <= 0 {
-		// No need to test. Just return true.
-		return true, nil
+// Returns the URL with https:// added if there is no scheme, and
+// whether it uses TLS
+func fullUrl(destUrl string) (string, bool) {
+	if strings.HasPrefix(destUrl, "http:") {
+		return destUrl, false
 	}
+	if strings.HasPrefix(destUrl, "https:") {
+		return destUrl, true
+	}
+	return "https://" + destUrl, true
+}
 
-	for try := 0; try < 2; try += 1 {
-		var intfs []string
-		if try == 0 {
-			intfs = types.GetMgmtPortsFree(*ctx.DeviceNetworkStatus,
-				iteration)
-			log.Debugf("VerifyAllIntf: trying free %v\n", intfs)
-		} else {
-			intfs = types.GetMgmtPortsNonFree(*ctx.DeviceNetworkStatus,
-				iteration)
-			log.Debugf("VerifyAllIntf: non-free %v\n", intfs)
-		}
-		for _, intf := range intfs {
-			if intfSuccessCount >= successCount {
-				// We have enough uplinks with cloud connectivity working.
-				break
-			}
-			resp, _, err := SendOnIntf(ctx, url, intf, 0, nil, allowProxy, 15)
-			if err != nil {
-				// XXX Have code to mark this interface as not suitable
-				// for cloud/internet connectivity
-				log.Errorf("Zedcloud un-reachable via interface %s: %s",
-					intf, err)
-				lastError = err
-				continue
+// newTransport returns a transport using the proxy if not nil.
+// Each transport gets its own copy of the TlsConfig since configuring
+// HTTP/2 modifies NextProtos. The copy shares the ClientSessionCache
+// hence TLS sessions are resumed across calls.
+func newTransport(ctx ZedCloudContext, proxyUrl *url.URL,
+	useTLS bool) *http.Transport {
+
+	var tlsConfig *tls.Config
+	if ctx.TlsConfig != nil {
+		if ctx.CertProvider != nil {
+			// A resumed session does not ask for the client
+			// certificate, so check for a new one here. That
+			// flushes the session cache if it changed.
+			if _, err := ctx.CertProvider.GetCertificate(); err != nil {
+				log.Errorf("newTransport: %s\n", err)
 			}
-			switch resp.StatusCode {
-			case http.StatusOK:
-				log.Infof("VerifyAllIntf: Zedcloud reachable via interface %s", intf)
-				intfSuccessCount += 1
-			default:
-				errStr := fmt.Sprintf("Uplink test FAILED via %s to URL %s with "+
-					"status code %d and status %s",
-					intf, url, resp.StatusCode, http.StatusText(resp.StatusCode))
-				log.Errorln(errStr)
-				lastError = errors.New(errStr)
-				continue
+		}
+		tlsConfig = ctx.TlsConfig.Clone()
+		if tlsConfig.ClientSessionCache != nil {
+			// Pick up any flush due to a new certificate
+			tlsConfig.ClientSessionCache = getSessionCache()
+		}
+		if ctx.CertProvider != nil {
+			provider := ctx.CertProvider
+			tlsConfig.Certificates = nil
+			tlsConfig.NameToCertificate = nil
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return provider.GetCertificate()
 			}
 		}
 	}
-	if intfSuccessCount == 0 {
-		errStr := fmt.Sprintf("All test attempts to connect to %s failed: %s",
-			url, lastError)
-		log.Errorln(errStr)
-		return false, errors.New(errStr)
+	timeouts := ctx.Timeouts.effective(0)
+	transport := &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   timeouts.TLSHandshake,
+		ResponseHeaderTimeout: timeouts.ResponseHeader,
+	}
+	if proxyUrl != nil {
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	if ctx.NoCompression {
+		// Otherwise the transport asks for gzip
+		transport.DisableCompression = true
 	}
-	if intfSuccessCount < successCount {
-		errStr := fmt.Sprintf("Not enough Ports (%d) against required count %d to reach Zedcloud; last failed with %s",
-			intfSuccessCount, successCount, lastError)
-		log.Errorln(errStr)
-		return false, errors.New(errStr)
+	if useTLS && !ctx.NoHTTP2 {
+		// Use h2 if the controller offers it in ALPN
+		if err := http2.ConfigureTransport(transport); err != nil {
+			log.Warnf("sendOnIntf: HTTP/2 not available: %s\n", err)
+		}
 	}
-	return true, nil
+	return transport
 }
 
 // Tries all source addresses on interface until one succeeds.
-// Returns response for first success. Caller can not use resp.Body but can
-// use []byte contents return.
+// Returns result for first success. Caller can not use res.Resp.Body but
+// can use res.Contents.
 // If we get a http response, we return that even if it was an error
 // to allow the caller to look at StatusCode
-func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64, b *bytes.Buffer, allowProxy bool, timeout int) (*http.Response, []byte, error) {
+// A non-zero timeout in seconds overrides ctx.Timeouts.Total.
+// Cancelling reqCtx aborts the attempts, and its deadline if any bounds
+// them in addition to the timeouts.
+func SendOnIntf(reqCtx context.Context, ctx ZedCloudContext, destUrl string, intf string, reqlen int64, b *bytes.Buffer, allowProxy bool, timeout int) (SendResult, error) {
 
-	var reqUrl string
-	var useTLS bool
-	if strings.HasPrefix(destUrl, "http:") {
-		reqUrl = destUrl
-		useTLS = false
-	} else {
-		if strings.HasPrefix(destUrl, "https:") {
-			reqUrl = destUrl
-		} else {
-			reqUrl = "https://" + destUrl
+	var res SendResult
+
+	reqUrl, useTLS := fullUrl(destUrl)
+
+	// The body as sent; compressed if the controller accepts it
+	var body []byte
+	var encoding string
+	sentlen := reqlen
+	host := ""
+	if u, err := url.Parse(reqUrl); err == nil {
+		host = u.Host
+	}
+	if b != nil {
+		body = b.Bytes()
+		if !ctx.NoCompression && len(body) >= compressMinSize {
+			encoding = lookupRequestEncoding(host)
+		}
+		if encoding != "" {
+			compressed, err := compressBody(encoding, body)
+			if err != nil {
+				log.Errorf("compressBody %s failed %s\n", encoding, err)
+				encoding = ""
+			} else if len(compressed) >= len(body) {
+				encoding = ""
+			} else {
+				log.Debugf("Compressed %d to %d using %s\n",
+					len(body), len(compressed), encoding)
+				body = compressed
+				sentlen = int64(len(body))
+			}
 		}
-		useTLS = true
 	}
 
 	addrCount := types.CountLocalAddrAnyNoLinkLocalIf(*ctx.DeviceNetworkStatus, intf)
@@ -186,67 +316,132 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 		errStr := fmt.Sprintf("No IP addresses to connect to %s using intf %s",
 			reqUrl, intf)
 		log.Debugln(errStr)
-		return nil, nil, errors.New(errStr)
+		err := errors.New(errStr)
+		res.Attempts = append(res.Attempts,
+			SendAttempt{Intf: intf, Error: err})
+		return res, err
 	}
 	// Get the transport header with proxy information filled
-	proxyUrl, err := LookupProxy(ctx.DeviceNetworkStatus, intf, reqUrl)
-	var transport *http.Transport
-	if err == nil && proxyUrl != nil && allowProxy {
+	proxyUrl, auth, err := lookupProxy(ctx.DeviceNetworkStatus, intf, reqUrl)
+	var proxyStr string
+	useProxy := err == nil && proxyUrl != nil && allowProxy
+	if useProxy {
+		proxyStr = RedactedProxy(proxyUrl)
 		log.Debugf("sendOnIntf: For input URL %s, proxy found is %s",
-			reqUrl, proxyUrl.String())
-		transport = &http.Transport{
-			TLSClientConfig: ctx.TlsConfig,
-			Proxy:           http.ProxyURL(proxyUrl),
-		}
+			reqUrl, proxyStr)
 	} else {
-		transport = &http.Transport{
-			TLSClientConfig: ctx.TlsConfig,
-		}
+		proxyUrl = nil
 	}
+	timeouts := ctx.Timeouts.effective(timeout)
+	transport := newTransport(ctx, proxyUrl, useTLS)
 	// Since we recreate the transport on each call there is no benefit
 	// to keeping the connections open.
 	defer transport.CloseIdleConnections()
 
 	var lastError error
 
-	for retryCount := 0; retryCount < addrCount; retryCount += 1 {
+	// With several source addresses we race them instead of trying
+	// each one in turn with the full timeout
+	lookup := func(host string) ([]net.IP, error) {
+		return lookupHostOnIntf(ctx.DeviceNetworkStatus, intf, host)
+	}
+	var rd *raceDialer
+	loopCount := addrCount
+	if addrCount > 1 && !ctx.NoRaceDial {
+		rd = &raceDialer{timeout: timeouts.Connect, lookup: lookup}
+		for i := 0; i < addrCount; i++ {
+			addr, err := types.GetLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus,
+				i, intf)
+			if err == nil {
+				rd.localAddrs = append(rd.localAddrs, addr)
+			}
+		}
+		loopCount = 1
+	}
+
+	for retryCount := 0; retryCount < loopCount; retryCount += 1 {
+		if err := reqCtx.Err(); err != nil {
+			lastError = err
+			break
+		}
 		localAddr, err := types.GetLocalAddrAnyNoLinkLocal(*ctx.DeviceNetworkStatus,
 			retryCount, intf)
 		if err != nil {
 			log.Error(err)
-			return nil, nil, err
+			res.Attempts = append(res.Attempts,
+				SendAttempt{Intf: intf, Proxy: proxyStr, Error: err})
+			return res, err
 		}
+		attempt := SendAttempt{Intf: intf, LocalAddr: localAddr,
+			Proxy: proxyStr}
 		localTCPAddr := net.TCPAddr{IP: localAddr}
 		log.Debugf("Connecting to %s using intf %s source %v\n",
 			reqUrl, intf, localTCPAddr)
-		d := net.Dialer{LocalAddr: &localTCPAddr}
-		transport.Dial = d.Dial
-
-		client := &http.Client{Transport: transport}
-		if timeout != 0 {
-			client.Timeout = time.Duration(timeout) * time.Second
+		d := net.Dialer{LocalAddr: &localTCPAddr,
+			Timeout: timeouts.Connect}
+		if rd != nil {
+			transport.DialContext = rd.DialContext
+		} else {
+			transport.DialContext = dialCached(d, lookup)
 		}
 
+		client := &http.Client{Transport: transport,
+			Timeout: timeouts.Total}
+
 		var req *http.Request
 		if b != nil {
-			req, err = http.NewRequest("POST", reqUrl, b)
+			req, err = http.NewRequest("POST", reqUrl,
+				bytes.NewReader(body))
 		} else {
 			req, err = http.NewRequest("GET", reqUrl, nil)
 		}
 		if err != nil {
 			log.Errorf("NewRequest failed %s\n", err)
 			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
 			continue
 		}
 
 		if b != nil {
 			req.Header.Add("Content-Type", "application/x-proto-binary")
+			if encoding != "" {
+				req.Header.Add("Content-Encoding", encoding)
+			}
+		}
+		if !ctx.NoCompression {
+			req.Header.Add("Accept-Encoding", acceptEncoding)
+		}
+		if useProxy {
+			err := setupProxyAuth(transport, req, d, proxyUrl, auth)
+			if err != nil {
+				log.Errorf("Proxy setup failed %s\n", err)
+				lastError = err
+				attempt.Error = err
+				res.Attempts = append(res.Attempts, attempt)
+				continue
+			}
+		}
+		if err := runPreRequestHooks(ctx, req, intf); err != nil {
+			log.Errorf("PreRequestHook failed %s\n", err)
+			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
+			continue
+		}
+		if err := authenticate(ctx, req); err != nil {
+			log.Errorln(err)
+			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
+			continue
 		}
 		trace := &httptrace.ClientTrace{
 			GotConn: func(connInfo httptrace.GotConnInfo) {
 				log.Debugf("Got RemoteAddr: %+v, LocalAddr: %+v\n",
 					connInfo.Conn.RemoteAddr(),
 					connInfo.Conn.LocalAddr())
+				attempt.RemoteAddr = connInfo.Conn.RemoteAddr().String()
 			},
 			DNSDone: func(dnsInfo httptrace.DNSDoneInfo) {
 				log.Debugf("DNS Info: %+v\n", dnsInfo)
@@ -255,12 +450,22 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 				log.Debugf("DNS start: %+v\n", dnsInfo)
 			},
 		}
-		req = req.WithContext(httptrace.WithClientTrace(req.Context(),
-			trace))
+		req = req.WithContext(httptrace.WithClientTrace(reqCtx, trace))
+		startTime := time.Now()
 		resp, err := client.Do(req)
+		if rd != nil {
+			if winner, _ := rd.winner(); winner != nil {
+				localAddr = winner
+				attempt.LocalAddr = winner
+			}
+		}
 		if err != nil {
 			log.Errorf("client.Do fail: %v\n", err)
+			runPostResponseHooks(ctx, req, intf, nil, nil, err,
+				time.Since(startTime))
 			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
 			continue
 		}
 
@@ -269,12 +474,33 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 			log.Errorf("ReadAll failed %s\n", err)
 			resp.Body.Close()
 			resp.Body = nil
+			runPostResponseHooks(ctx, req, intf, nil, nil, err,
+				time.Since(startTime))
 			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
 			continue
 		}
 		resp.Body.Close()
 		resp.Body = nil
 		resplen := int64(len(contents))
+		contents, err = decodeBody(resp, contents)
+		if err != nil {
+			log.Errorf("decodeBody failed %s\n", err)
+			runPostResponseHooks(ctx, req, intf, nil, nil, err,
+				time.Since(startTime))
+			lastError = err
+			attempt.Error = err
+			res.Attempts = append(res.Attempts, attempt)
+			continue
+		}
+		runPostResponseHooks(ctx, req, intf, resp, contents, nil,
+			time.Since(startTime))
+		category := ctx.Category
+		if category == "" {
+			category = categoryFromUrl(reqUrl)
+		}
+		AddBandwidth(intf, category, sentlen, resplen)
 
 		if useTLS {
 			connState := resp.TLS
@@ -282,56 +508,87 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 				errStr := "no TLS connection state"
 				log.Errorln(errStr)
 				lastError = errors.New(errStr)
+				attempt.Error = lastError
+				res.Attempts = append(res.Attempts, attempt)
 				// Inform ledmanager about broken cloud connectivity
 				if !ctx.NoLedManager {
-					types.UpdateLedManagerConfig(12)
+					types.UpdateLedManagerConfig(types.DeviceStateNoTLS)
 				}
 				if ctx.FailureFunc != nil {
-					ctx.FailureFunc(intf, reqUrl, reqlen,
+					ctx.FailureFunc(intf, reqUrl, sentlen,
 						resplen)
 				}
 				continue
 			}
 
-			if connState.OCSPResponse == nil ||
-				!stapledCheck(connState) {
-
-				if connState.OCSPResponse == nil {
-					// XXX remove debug check
-					log.Debugf("no OCSP response for %s\n",
-						reqUrl)
+			attempt.TrustAnchor = TrustAnchor(connState)
+			ocspStatus, err := checkOCSP(ctx.OCSPPolicy, connState,
+				reqUrl)
+			attempt.OCSPStatus = ocspStatus
+			if err != nil {
+				// Inform ledmanager about broken cloud connectivity
+				if !ctx.NoLedManager {
+					types.UpdateLedManagerConfig(types.DeviceStateBadOCSP)
 				}
-				errStr := fmt.Sprintf("OCSP stapled check failed for %s",
-					reqUrl)
-
-				//XXX OSCP is not implemented in cloud side so
-				// commenting out it for now.
-				if false {
-					log.Errorln(errStr)
-					// Inform ledmanager about broken cloud connectivity
-					if !ctx.NoLedManager {
-						types.UpdateLedManagerConfig(13)
-					}
-					if ctx.FailureFunc != nil {
-						ctx.FailureFunc(intf, reqUrl,
-							reqlen, resplen)
-					}
-					lastError = errors.New(errStr)
-					continue
+				if ctx.FailureFunc != nil {
+					ctx.FailureFunc(intf, reqUrl,
+						sentlen, resplen)
 				}
-				log.Debugln(errStr)
+				lastError = err
+				attempt.Error = err
+				res.Attempts = append(res.Attempts, attempt)
+				continue
 			}
+			log.Debugf("sendOnIntf: %s using %s resumed %t\n",
+				reqUrl, resp.Proto, connState.DidResume)
 		}
 		// Even if we got e.g., a 404 we consider the connection a
 		// success since we care about the connectivity to the cloud.
 		if ctx.SuccessFunc != nil {
-			ctx.SuccessFunc(intf, reqUrl, reqlen, resplen)
+			ctx.SuccessFunc(intf, reqUrl, sentlen, resplen)
+		}
+		var uncompressed, compressed int64
+		if encoding != "" {
+			uncompressed += int64(b.Len())
+			compressed += sentlen
+		}
+		if isEncoded(resp) {
+			uncompressed += int64(len(contents))
+			compressed += resplen
+		}
+		if uncompressed != 0 && ctx.CompressionFunc != nil {
+			ctx.CompressionFunc(intf, reqUrl, uncompressed,
+				compressed)
+		}
+		learnRequestEncoding(host, resp, encoding)
+		if encoding != "" &&
+			resp.StatusCode == http.StatusUnsupportedMediaType {
+			// No longer compressed since the host is forgotten
+			log.Warnf("sendOnIntf to %s retrying without %s\n",
+				reqUrl, encoding)
+			return SendOnIntf(reqCtx, ctx, destUrl, intf, reqlen,
+				bytes.NewBuffer(b.Bytes()), allowProxy, timeout)
+		}
+		res.Attempts = append(res.Attempts, attempt)
+		res.Resp = resp
+		res.StatusCode = resp.StatusCode
+		res.Intf = intf
+		res.LocalAddr = localAddr
+		res.RemoteAddr = attempt.RemoteAddr
+		res.Proxy = proxyStr
+		res.Protocol = resp.Proto
+		if resp.TLS != nil {
+			res.TLSVersion = resp.TLS.Version
+			res.DidResume = resp.TLS.DidResume
 		}
+		res.OCSPStatus = attempt.OCSPStatus
+		res.TrustAnchor = attempt.TrustAnchor
+		res.Contents = contents
 
 		switch resp.StatusCode {
 		case http.StatusOK:
 			log.Debugf("SendOnIntf to %s StatusOK\n", reqUrl)
-			return resp, contents, nil
+			return res, nil
 		default:
 			errStr := fmt.Sprintf("sendOnIntf to %s reqlen %d statuscode %d %s",
 				reqUrl, reqlen, resp.StatusCode,
@@ -339,7 +596,7 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 			log.Errorln(errStr)
 			log.Debugf("received response %v\n", resp)
 			// Get caller to schedule a retry based on StatusCode
-			return resp, nil, errors.New(errStr)
+			return res, errors.New(errStr)
 		}
 	}
 	if ctx.FailureFunc != nil {
@@ -348,5 +605,5 @@ func SendOnIntf(ctx ZedCloudContext, destUrl string, intf string, reqlen int64,
 	errStr := fmt.Sprintf("All attempts to connect to %s using intf %s failed: %s",
 		reqUrl, intf, lastError)
 	log.Errorln(errStr)
-	return nil, nil, errors.New(errStr)
+	return res, errors.New(errStr)
 }
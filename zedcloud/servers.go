@@ -0,0 +1,277 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Controller endpoints for failover, e.g., during a controller migration.
+// The server file has one host[:port] per line, and the files in
+// server.d have the same format and are read in name order. Empty lines
+// and lines starting with # are ignored. The endpoint which last
+// responded is saved under /persist and tried first.
+// When ZedCloudContext.Servers is set, a request for a URL on any of the
+// endpoints is sent to the endpoints in turn until one responds.
+
+package zedcloud
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	serverDirname      = identityDirname + "/server.d"
+	lastServerDirname  = "/persist/status/zedcloud"
+	lastServerFilename = lastServerDirname + "/server"
+)
+
+// ServerList is the controller endpoints starting with the current one
+type ServerList struct {
+	lock         sync.Mutex
+	servers      []string // host[:port] in configured order
+	current      int
+	lastFilename string
+}
+
+// NewServerList reads the configured endpoints and the last working one
+func NewServerList() (*ServerList, error) {
+	return newServerList(serverFilename, serverDirname, lastServerFilename)
+}
+
+// NewServerListIn is NewServerList for a different identity directory
+func NewServerListIn(dirname string) (*ServerList, error) {
+	return newServerList(dirname+"/server", dirname+"/server.d",
+		lastServerFilename)
+}
+
+func newServerList(filename string, dirname string,
+	lastFilename string) (*ServerList, error) {
+
+	servers, err := ReadServers(filename, dirname)
+	if err != nil {
+		return nil, err
+	}
+	sl := &ServerList{servers: servers, lastFilename: lastFilename}
+	b, err := ioutil.ReadFile(lastFilename)
+	if err == nil {
+		last := strings.TrimSpace(string(b))
+		for i, server := range servers {
+			if server == last {
+				sl.current = i
+				break
+			}
+		}
+	}
+	return sl, nil
+}
+
+// ReadServers returns the endpoints in filename followed by those in
+// the files in dirname
+func ReadServers(filename string, dirname string) ([]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	servers := parseServers(b)
+	if names, err := ioutil.ReadDir(dirname); err == nil {
+		var files []string
+		for _, fi := range names {
+			if !fi.IsDir() {
+				files = append(files, fi.Name())
+			}
+		}
+		sort.Strings(files)
+		for _, name := range files {
+			b, err := ioutil.ReadFile(filepath.Join(dirname, name))
+			if err != nil {
+				log.Errorf("ReadServers: %s\n", err)
+				continue
+			}
+			for _, server := range parseServers(b) {
+				if !containsServer(servers, server) {
+					servers = append(servers, server)
+				}
+			}
+		}
+	}
+	if len(servers) == 0 {
+		errStr := fmt.Sprintf("No controller in %s or %s", filename,
+			dirname)
+		return nil, errors.New(errStr)
+	}
+	return servers, nil
+}
+
+func parseServers(b []byte) []string {
+	var servers []string
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		server := strings.TrimSpace(string(line))
+		if server == "" || strings.HasPrefix(server, "#") {
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+func containsServer(servers []string, server string) bool {
+	for _, s := range servers {
+		if s == server {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckServer returns an error unless server is host[:port]
+func CheckServer(server string) error {
+	if strings.ContainsAny(server, "/@ \t") {
+		errStr := fmt.Sprintf("%s is not host[:port]", server)
+		return errors.New(errStr)
+	}
+	host, port := server, ""
+	if i := strings.LastIndex(server, ":"); i != -1 {
+		host, port = server[:i], server[i+1:]
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			errStr := fmt.Sprintf("Bad port in %s", server)
+			return errors.New(errStr)
+		}
+	}
+	if host == "" || strings.Contains(host, ":") {
+		errStr := fmt.Sprintf("%s is not host[:port]", server)
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// ServerHost returns the host part of host[:port]
+func ServerHost(server string) string {
+	return strings.Split(server, ":")[0]
+}
+
+// Current returns the endpoint to use
+func (sl *ServerList) Current() string {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	return sl.servers[sl.current]
+}
+
+// CurrentHost returns the host part of Current
+func (sl *ServerList) CurrentHost() string {
+	return ServerHost(sl.Current())
+}
+
+// Servers returns all of the endpoints starting with the current one
+func (sl *ServerList) Servers() []string {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	var servers []string
+	for i := range sl.servers {
+		servers = append(servers,
+			sl.servers[(sl.current+i)%len(sl.servers)])
+	}
+	return servers
+}
+
+// setCurrent saves the endpoint if it changed
+func (sl *ServerList) setCurrent(server string) {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	for i, s := range sl.servers {
+		if s != server {
+			continue
+		}
+		if i == sl.current {
+			return
+		}
+		log.Infof("Controller changed from %s to %s\n",
+			sl.servers[sl.current], server)
+		sl.current = i
+		if err := os.MkdirAll(filepath.Dir(sl.lastFilename), 0755); err != nil {
+			log.Errorf("setCurrent: %s\n", err)
+			return
+		}
+		b := []byte(server + "\n")
+		if err := ioutil.WriteFile(sl.lastFilename, b, 0644); err != nil {
+			log.Errorf("setCurrent: %s\n", err)
+		}
+		return
+	}
+}
+
+// path returns the scheme and the part of the URL after the endpoint
+// if the URL is for one of the endpoints. The URL can have the host with
+// or without the port.
+func (sl *ServerList) path(url string) (string, string, bool) {
+	scheme := ""
+	rest := url
+	for _, s := range []string{"https://", "http://"} {
+		if strings.HasPrefix(url, s) {
+			scheme = s
+			rest = strings.TrimPrefix(url, s)
+			break
+		}
+	}
+	host := rest
+	path := ""
+	if i := strings.Index(rest, "/"); i != -1 {
+		host = rest[:i]
+		path = rest[i:]
+	}
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	for _, server := range sl.servers {
+		if host == server || host == ServerHost(server) {
+			return scheme, path, true
+		}
+	}
+	return "", "", false
+}
+
+// sendOnServers tries the endpoints in turn until one responds
+func sendOnServers(ctx ZedCloudContext, url string, reqlen int64,
+	b *bytes.Buffer, iteration int, return400 bool) (SendResult, error) {
+
+	servers := ctx.Servers
+	ctx.Servers = nil
+	scheme, path, ok := servers.path(url)
+	if !ok {
+		return SendOnAllIntf(ctx, url, reqlen, b, iteration, return400)
+	}
+	var body []byte
+	if b != nil {
+		body = b.Bytes()
+	}
+	var attempts []SendAttempt
+	var res SendResult
+	var err error
+	for _, server := range servers.Servers() {
+		sctx := ctx
+		if ctx.TlsConfig != nil {
+			sctx.TlsConfig = ctx.TlsConfig.Clone()
+			sctx.TlsConfig.ServerName = ServerHost(server)
+		}
+		var buf *bytes.Buffer
+		if b != nil {
+			buf = bytes.NewBuffer(body)
+		}
+		res, err = SendOnAllIntf(sctx, scheme+server+path, reqlen, buf,
+			iteration, return400)
+		attempts = append(attempts, res.Attempts...)
+		if res.Resp != nil {
+			servers.setCurrent(server)
+			break
+		}
+		log.Errorf("sendOnServers: no response from %s: %v\n",
+			server, err)
+	}
+	res.Attempts = attempts
+	return res, err
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeServerFiles(t *testing.T, server string,
+	serverD map[string]string) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "servers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "server"),
+		[]byte(server), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if serverD != nil {
+		os.Mkdir(filepath.Join(dir, "server.d"), 0755)
+		for name, contents := range serverD {
+			err := ioutil.WriteFile(filepath.Join(dir, "server.d", name),
+				[]byte(contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestReadServers(t *testing.T) {
+	dir, restore := writeServerFiles(t,
+		"# primary\nzedcloud.example.com\n\nold.example.com:8443\n",
+		map[string]string{
+			"20-dr":    "dr.example.com\n",
+			"10-new":   "new.example.com\nzedcloud.example.com\n",
+			"30-empty": "# nothing\n",
+		})
+	defer restore()
+
+	servers, err := ReadServers(filepath.Join(dir, "server"),
+		filepath.Join(dir, "server.d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"zedcloud.example.com", "old.example.com:8443",
+		"new.example.com", "dr.example.com"}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Errorf("got %v expected %v", servers, expected)
+	}
+
+	// No server.d
+	servers, err = ReadServers(filepath.Join(dir, "server"),
+		filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 {
+		t.Errorf("got %v expected 2 servers", servers)
+	}
+}
+
+func TestReadServersEmpty(t *testing.T) {
+	dir, restore := writeServerFiles(t, "# none yet\n", nil)
+	defer restore()
+
+	_, err := ReadServers(filepath.Join(dir, "server"),
+		filepath.Join(dir, "server.d"))
+	if err == nil {
+		t.Errorf("expected an error for no controllers")
+	}
+}
+
+func TestServerListPath(t *testing.T) {
+	dir, restore := writeServerFiles(t,
+		"zedcloud.example.com:443\ndr.example.com\n", nil)
+	defer restore()
+
+	sl, err := newServerList(filepath.Join(dir, "server"),
+		filepath.Join(dir, "server.d"), filepath.Join(dir, "last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMatrix := map[string]struct {
+		url    string
+		scheme string
+		path   string
+		ok     bool
+	}{
+		"With port": {
+			url:  "zedcloud.example.com:443/api/v1/edgedevice/ping",
+			path: "/api/v1/edgedevice/ping",
+			ok:   true,
+		},
+		"Without port": {
+			url:    "https://zedcloud.example.com/api/v1/edgedevice/config",
+			scheme: "https://",
+			path:   "/api/v1/edgedevice/config",
+			ok:     true,
+		},
+		"Second server": {
+			url:  "dr.example.com/api/v1/edgedevice/ping",
+			path: "/api/v1/edgedevice/ping",
+			ok:   true,
+		},
+		"Other host": {
+			url: "https://www.example.com/index.html",
+			ok:  false,
+		},
+	}
+	for testname, test := range testMatrix {
+		scheme, path, ok := sl.path(test.url)
+		if ok != test.ok || scheme != test.scheme || path != test.path {
+			t.Errorf("%s: got %q %q %v expected %q %q %v", testname,
+				scheme, path, ok, test.scheme, test.path, test.ok)
+		}
+	}
+}
+
+func TestServerListCurrent(t *testing.T) {
+	dir, restore := writeServerFiles(t,
+		"a.example.com\nb.example.com:8443\nc.example.com\n", nil)
+	defer restore()
+
+	filename := filepath.Join(dir, "server")
+	dirname := filepath.Join(dir, "server.d")
+	lastFilename := filepath.Join(dir, "status", "server")
+	sl, err := newServerList(filename, dirname, lastFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl.Current() != "a.example.com" {
+		t.Errorf("got current %s expected a.example.com", sl.Current())
+	}
+	sl.setCurrent("b.example.com:8443")
+	if sl.CurrentHost() != "b.example.com" {
+		t.Errorf("got current host %s expected b.example.com",
+			sl.CurrentHost())
+	}
+
+	// The last working server is tried first after a restart
+	sl, err = newServerList(filename, dirname, lastFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"b.example.com:8443", "c.example.com",
+		"a.example.com"}
+	if !reflect.DeepEqual(sl.Servers(), expected) {
+		t.Errorf("got %v expected %v", sl.Servers(), expected)
+	}
+
+	// A server which was removed from the configuration is ignored
+	ioutil.WriteFile(lastFilename, []byte("gone.example.com\n"), 0644)
+	sl, err = newServerList(filename, dirname, lastFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl.Current() != "a.example.com" {
+		t.Errorf("got current %s expected a.example.com", sl.Current())
+	}
+}
+
+func TestCheckServer(t *testing.T) {
+	testMatrix := map[string]struct {
+		server string
+		ok     bool
+	}{
+		"Host":           {server: "zedcloud.example.com", ok: true},
+		"Host and port":  {server: "zedcloud.example.com:8443", ok: true},
+		"IP and port":    {server: "192.0.2.1:443", ok: true},
+		"URL":            {server: "https://zedcloud.example.com", ok: false},
+		"Path":           {server: "zedcloud.example.com/api", ok: false},
+		"Bad port":       {server: "zedcloud.example.com:http", ok: false},
+		"Port too large": {server: "zedcloud.example.com:70000", ok: false},
+		"No host":        {server: ":443", ok: false},
+	}
+	for testname, test := range testMatrix {
+		err := CheckServer(test.server)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v expected ok %v", testname, err, test.ok)
+		}
+	}
+}
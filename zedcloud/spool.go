@@ -0,0 +1,364 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Persistent queue of messages for the controller which would otherwise be
+// lost during a connectivity outage, e.g., metrics. The messages are saved
+// under /persist so they survive a reboot, and are sent in the order they
+// were queued when HandleDeferred runs, the high priority messages first.
+// A message identical to one already queued is dropped, and one queued
+// with replace set supersedes the queued messages with the same key, e.g.,
+// the info for an object. When full the oldest low priority message is
+// dropped, and low priority messages are dropped once older than the
+// maxAge of their policy.
+// Once the queue has messages of a priority the caller should queue new
+// messages of that priority instead of sending them directly to preserve
+// the order; see SpoolPriorityDepth.
+
+package zedcloud
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/pubsub"
+)
+
+const (
+	spoolDir      = "/persist/status/zedcloud/spool"
+	spoolMaxItems = 1000
+	spoolMaxBytes = 16 * 1024 * 1024
+)
+
+type spoolItem struct {
+	Seq       uint64
+	Key       string
+	URL       string
+	Return400 bool
+	Priority  DeferredPriority
+	Hash      string // Of URL and Payload
+	Time      time.Time
+	Payload   []byte
+}
+
+// SpoolMetrics is the state of the queue of an agent
+type SpoolMetrics struct {
+	Items      int   // Queued
+	Bytes      int64 // Queued
+	Sent       uint64
+	Duplicates uint64 // Not queued since identical to a queued one
+	Replaced   uint64 // Superseded by a newer message with the same key
+	Dropped    uint64 // Oldest dropped since the queue was full
+	Expired    uint64 // Dropped since older than the maxAge of the priority
+	Rejected   uint64 // Dropped since the controller returned 4xx
+}
+
+type spoolState struct {
+	lock        sync.Mutex
+	dirName     string
+	zedcloudCtx *ZedCloudContext
+	items       []spoolItem // In Seq order
+	nextSeq     uint64
+	metrics     SpoolMetrics
+	// Replaced by tests
+	send func(ctx ZedCloudContext, url string, reqlen int64,
+		b *bytes.Buffer, iteration int, return400 bool) (SendResult, error)
+}
+
+// From InitSpool
+var defaultSpool *spoolState
+
+// InitSpool loads the messages queued by the agent. Call after
+// InitDeferred since the messages are sent by HandleDeferred.
+func InitSpool(agentName string, zedcloudCtx *ZedCloudContext) {
+	if defaultSpool != nil {
+		log.Fatal("InitSpool called twice")
+	}
+	defaultSpool = newSpool(fmt.Sprintf("%s/%s", spoolDir, agentName),
+		zedcloudCtx)
+	if defaultSpool.depth() != 0 && defaultCtx != nil {
+		startTimer(defaultCtx)
+	}
+}
+
+func newSpool(dirName string, zedcloudCtx *ZedCloudContext) *spoolState {
+	s := &spoolState{
+		dirName:     dirName,
+		zedcloudCtx: zedcloudCtx,
+		send:        SendOnAllIntf,
+	}
+	if err := os.MkdirAll(dirName, 0700); err != nil {
+		log.Errorf("InitSpool: %s\n", err)
+		return s
+	}
+	s.load()
+	return s
+}
+
+// Read the saved messages in Seq order
+func (s *spoolState) load() {
+	files, err := filepath.Glob(s.dirName + "/*.json")
+	if err != nil {
+		log.Errorf("InitSpool: %s\n", err)
+		return
+	}
+	for _, filename := range files {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Errorf("InitSpool: %s\n", err)
+			continue
+		}
+		var item spoolItem
+		if err := json.Unmarshal(b, &item); err != nil {
+			log.Errorf("InitSpool: %s: %s\n", filename, err)
+			os.Remove(filename)
+			continue
+		}
+		s.items = append(s.items, item)
+	}
+	sort.Slice(s.items, func(i, j int) bool {
+		return s.items[i].Seq < s.items[j].Seq
+	})
+	if len(s.items) != 0 {
+		s.nextSeq = s.items[len(s.items)-1].Seq + 1
+	}
+	s.updateMetrics()
+	log.Infof("InitSpool(%s) loaded %d messages\n", s.dirName,
+		len(s.items))
+}
+
+// SpoolMessage queues the message. With replace the queued messages with
+// the same key are removed.
+func SpoolMessage(key string, buf *bytes.Buffer, url string,
+	return400 bool, replace bool, priority DeferredPriority) {
+
+	if defaultSpool == nil {
+		log.Fatal("SpoolMessage no defaultSpool")
+	}
+	defaultSpool.add(key, buf.Bytes(), url, return400, replace, priority)
+	if defaultCtx != nil {
+		startTimer(defaultCtx)
+	}
+}
+
+func (s *spoolState) add(key string, payload []byte, url string,
+	return400 bool, replace bool, priority DeferredPriority) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash := spoolHash(url, payload)
+	if replace {
+		s.removeKey(key)
+	}
+	for _, item := range s.items {
+		if item.Hash == hash {
+			log.Infof("SpoolMessage(%s) duplicate of %d\n", key,
+				item.Seq)
+			s.metrics.Duplicates++
+			return
+		}
+	}
+	item := spoolItem{
+		Seq:       s.nextSeq,
+		Key:       key,
+		URL:       url,
+		Return400: return400,
+		Priority:  priority,
+		Hash:      hash,
+		Time:      time.Now(),
+		Payload:   append([]byte{}, payload...),
+	}
+	s.nextSeq++
+	b, err := json.Marshal(item)
+	if err != nil {
+		log.Fatal("json Marshal in SpoolMessage", err)
+	}
+	if err := pubsub.WriteRename(s.filename(item), b); err != nil {
+		// Still send it if we stay up
+		log.Errorf("SpoolMessage(%s): %s\n", key, err)
+	}
+	log.Infof("SpoolMessage(%s) seq %d size %d priority %s\n", key,
+		item.Seq, len(payload), priority)
+	s.items = append(s.items, item)
+	s.updateMetrics()
+	for len(s.items) > spoolMaxItems ||
+		(len(s.items) > 1 && s.metrics.Bytes > spoolMaxBytes) {
+		i := s.oldest(DeferredLow)
+		if i < 0 {
+			i = 0
+		}
+		log.Warnf("SpoolMessage full; dropping %s seq %d\n",
+			s.items[i].Key, s.items[i].Seq)
+		s.remove(i)
+		s.metrics.Dropped++
+	}
+}
+
+// Caller holds the lock. Returns the index of the oldest message of the
+// priority or -1 if none
+func (s *spoolState) oldest(priority DeferredPriority) int {
+	for i, item := range s.items {
+		if item.Priority == priority {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveSpooled removes the queued messages with the key, e.g., before
+// sending a newer message for the same object
+func RemoveSpooled(key string) {
+	if defaultSpool == nil {
+		return
+	}
+	defaultSpool.lock.Lock()
+	defaultSpool.removeKey(key)
+	defaultSpool.lock.Unlock()
+}
+
+// Caller holds the lock
+func (s *spoolState) removeKey(key string) {
+	for i := 0; i < len(s.items); {
+		if s.items[i].Key == key {
+			log.Debugf("spool replacing %s seq %d\n", key,
+				s.items[i].Seq)
+			s.remove(i)
+			s.metrics.Replaced++
+		} else {
+			i++
+		}
+	}
+}
+
+// Caller holds the lock
+func (s *spoolState) remove(i int) {
+	if err := os.Remove(s.filename(s.items[i])); err != nil &&
+		!os.IsNotExist(err) {
+		log.Errorf("spool remove: %s\n", err)
+	}
+	s.items = append(s.items[:i], s.items[i+1:]...)
+	s.updateMetrics()
+}
+
+// drain sends the messages of the priority in order until one fails.
+// Returns true if there are none left of the priority.
+func (s *spoolState) drain(priority DeferredPriority, iteration int) bool {
+	maxAge := deferredPolicies[priority].maxAge
+	for {
+		s.lock.Lock()
+		i := s.oldest(priority)
+		if i < 0 {
+			s.lock.Unlock()
+			return true
+		}
+		item := s.items[i]
+		if maxAge != 0 && time.Since(item.Time) > maxAge {
+			log.Warnf("spool dropping %s seq %d queued at %v\n",
+				item.Key, item.Seq, item.Time)
+			s.remove(i)
+			s.metrics.Expired++
+			s.lock.Unlock()
+			continue
+		}
+		s.lock.Unlock()
+
+		log.Infof("spool sending %s seq %d\n", item.Key, item.Seq)
+		res, err := s.send(*s.zedcloudCtx, item.URL,
+			int64(len(item.Payload)), bytes.NewBuffer(item.Payload),
+			iteration, item.Return400)
+		rejected := res.Resp != nil && res.StatusCode >= 400 &&
+			res.StatusCode < 500
+		if err != nil && !rejected {
+			log.Infof("spool sending %s seq %d failed: %s\n",
+				item.Key, item.Seq, err)
+			return false
+		}
+		s.lock.Lock()
+		// Could have been replaced while sending
+		if i := s.oldest(priority); i >= 0 && s.items[i].Seq == item.Seq {
+			s.remove(i)
+		}
+		if rejected {
+			log.Warnf("spool dropping %s seq %d due to code %d\n",
+				item.Key, item.Seq, res.StatusCode)
+			s.metrics.Rejected++
+		} else {
+			s.metrics.Sent++
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (s *spoolState) depth() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.items)
+}
+
+func (s *spoolState) classDepth(priority DeferredPriority) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := 0
+	for _, item := range s.items {
+		if item.Priority == priority {
+			count++
+		}
+	}
+	return count
+}
+
+// Caller holds the lock
+func (s *spoolState) updateMetrics() {
+	s.metrics.Items = len(s.items)
+	s.metrics.Bytes = 0
+	for _, item := range s.items {
+		s.metrics.Bytes += int64(len(item.Payload))
+	}
+}
+
+func (s *spoolState) filename(item spoolItem) string {
+	return fmt.Sprintf("%s/%020d.json", s.dirName, item.Seq)
+}
+
+func spoolHash(url string, payload []byte) string {
+	h := sha256.New()
+	h.Write([]byte(url))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SpoolDepth returns the number of queued messages
+func SpoolDepth() int {
+	if defaultSpool == nil {
+		return 0
+	}
+	return defaultSpool.depth()
+}
+
+// SpoolPriorityDepth returns the number of queued messages of the priority
+func SpoolPriorityDepth(priority DeferredPriority) int {
+	if defaultSpool == nil {
+		return 0
+	}
+	return defaultSpool.classDepth(priority)
+}
+
+// GetSpoolMetrics returns a copy of the metrics
+func GetSpoolMetrics() SpoolMetrics {
+	if defaultSpool == nil {
+		return SpoolMetrics{}
+	}
+	defaultSpool.lock.Lock()
+	defer defaultSpool.lock.Unlock()
+	return defaultSpool.metrics
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// Records what is sent; fails once sent reaches failAfter
+type fakeSender struct {
+	sent      []string
+	failAfter int
+	status    int
+}
+
+func (f *fakeSender) send(ctx ZedCloudContext, url string, reqlen int64,
+	b *bytes.Buffer, iteration int, return400 bool) (SendResult, error) {
+
+	if len(f.sent) >= f.failAfter {
+		return SendResult{}, errors.New("unreachable")
+	}
+	f.sent = append(f.sent, b.String())
+	if f.status != 0 {
+		return SendResult{Resp: &http.Response{StatusCode: f.status},
+			StatusCode: f.status}, errors.New("status")
+	}
+	return SendResult{}, nil
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spooltest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := ZedCloudContext{}
+	s := newSpool(dir, &ctx)
+	s.add("metrics", []byte("m1"), "url", false, false, DeferredLow)
+	s.add("dev", []byte("i1"), "url", true, true, DeferredLow)
+	s.add("metrics", []byte("m2"), "url", false, false, DeferredLow)
+	// Duplicate
+	s.add("metrics", []byte("m1"), "url", false, false, DeferredLow)
+	// Replaces i1
+	s.add("dev", []byte("i2"), "url", true, true, DeferredLow)
+	if s.depth() != 3 || s.metrics.Duplicates != 1 ||
+		s.metrics.Replaced != 1 || s.metrics.Bytes != 6 {
+		t.Errorf("Unexpected %+v", s.metrics)
+	}
+
+	// Survives a restart in order
+	s = newSpool(dir, &ctx)
+	if s.depth() != 3 {
+		t.Fatalf("Loaded %d", s.depth())
+	}
+	sender := fakeSender{failAfter: 2}
+	s.send = sender.send
+	if s.drain(DeferredLow, 0) {
+		t.Errorf("Drained despite failure")
+	}
+	s.add("metrics", []byte("m3"), "url", false, false, DeferredLow)
+	sender.failAfter = 10
+	if !s.drain(DeferredLow, 0) {
+		t.Errorf("Not drained")
+	}
+	expected := []string{"m1", "m2", "i2", "m3"}
+	if len(sender.sent) != len(expected) {
+		t.Fatalf("Expected %v got %v", expected, sender.sent)
+	}
+	for i := range expected {
+		if sender.sent[i] != expected[i] {
+			t.Errorf("Expected %v got %v", expected, sender.sent)
+			break
+		}
+	}
+	if s.metrics.Sent != 4 || s.metrics.Items != 0 {
+		t.Errorf("Unexpected %+v", s.metrics)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("Files left %d", len(files))
+	}
+
+	// Rejected by the controller hence dropped
+	s.add("metrics", []byte("m4"), "url", false, false, DeferredLow)
+	sender.status = 403
+	if !s.drain(DeferredLow, 0) || s.metrics.Rejected != 1 {
+		t.Errorf("Not rejected %+v", s.metrics)
+	}
+
+	// Oldest dropped when full
+	for i := 0; i < spoolMaxItems+1; i++ {
+		s.add("metrics", []byte{byte(i), byte(i >> 8)}, "url", false,
+			false, DeferredLow)
+	}
+	if s.depth() != spoolMaxItems || s.metrics.Dropped != 1 ||
+		s.items[0].Payload[0] != 1 {
+		t.Errorf("Unexpected %d %+v", s.depth(), s.metrics)
+	}
+}
+
+func TestSpoolPriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spooltest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := ZedCloudContext{}
+	s := newSpool(dir, &ctx)
+	s.add("metrics", []byte("m1"), "url", false, false, DeferredLow)
+	s.add("dev", []byte("i1"), "url", true, true, DeferredHigh)
+	s.add("metrics", []byte("m2"), "url", false, false, DeferredLow)
+	if s.classDepth(DeferredHigh) != 1 || s.classDepth(DeferredLow) != 2 {
+		t.Errorf("Unexpected depth high %d low %d",
+			s.classDepth(DeferredHigh), s.classDepth(DeferredLow))
+	}
+
+	// The high priority message is sent even if the metrics fail
+	sender := fakeSender{failAfter: 1}
+	s.send = sender.send
+	if !s.drain(DeferredHigh, 0) {
+		t.Errorf("High not drained")
+	}
+	if s.drain(DeferredLow, 0) {
+		t.Errorf("Low drained despite failure")
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != "i1" {
+		t.Errorf("Unexpected sent %v", sender.sent)
+	}
+
+	// Old low priority messages are dropped
+	s.items[0].Time = time.Now().Add(-deferredPolicies[DeferredLow].maxAge -
+		time.Minute)
+	sender.failAfter = 10
+	if !s.drain(DeferredLow, 0) || s.metrics.Expired != 1 {
+		t.Errorf("Not expired %+v", s.metrics)
+	}
+	if len(sender.sent) != 2 || sender.sent[1] != "m2" {
+		t.Errorf("Unexpected sent %v", sender.sent)
+	}
+
+	// The low priority messages are dropped first when full
+	s.add("dev", []byte("i2"), "url", true, true, DeferredHigh)
+	for i := 0; i < spoolMaxItems; i++ {
+		s.add("metrics", []byte{byte(i), byte(i >> 8)}, "url", false,
+			false, DeferredLow)
+	}
+	if s.depth() != spoolMaxItems || s.classDepth(DeferredHigh) != 1 ||
+		s.metrics.Dropped != 1 {
+		t.Errorf("Unexpected %d %+v", s.depth(), s.metrics)
+	}
+}
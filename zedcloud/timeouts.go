@@ -0,0 +1,56 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Separate timeouts for the phases of a request so that a slow proxy or
+// controller is not mistaken for an interface without connectivity.
+// A short connect timeout detects a dead interface quickly while the
+// response header and total timeouts can be generous.
+
+package zedcloud
+
+import (
+	"github.com/zededa/go-provision/types"
+	"time"
+)
+
+// Timeouts for ZedCloudContext. Zero fields use DefaultTimeouts.
+type Timeouts struct {
+	Connect        time.Duration // TCP connect to the controller or proxy
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration // After the request has been sent
+	Total          time.Duration // Including reading the response body
+}
+
+// DefaultTimeouts are used until the agent has read GlobalConfig
+var DefaultTimeouts = TimeoutsFromGlobalConfig(types.GlobalConfigDefaults)
+
+// TimeoutsFromGlobalConfig converts the Network*Timeout seconds
+func TimeoutsFromGlobalConfig(gc types.GlobalConfig) Timeouts {
+	return Timeouts{
+		Connect:        gc.GetNetworkConnectTimeout(),
+		TLSHandshake:   gc.GetNetworkTLSHandshakeTimeout(),
+		ResponseHeader: gc.GetNetworkResponseHeaderTimeout(),
+		Total:          gc.GetNetworkSendTimeout(),
+	}
+}
+
+// Fill in the defaults. A non-zero timeout in seconds from the caller
+// overrides Total for that call.
+func (t Timeouts) effective(timeout int) Timeouts {
+	if t.Connect == 0 {
+		t.Connect = DefaultTimeouts.Connect
+	}
+	if t.TLSHandshake == 0 {
+		t.TLSHandshake = DefaultTimeouts.TLSHandshake
+	}
+	if t.ResponseHeader == 0 {
+		t.ResponseHeader = DefaultTimeouts.ResponseHeader
+	}
+	if t.Total == 0 {
+		t.Total = DefaultTimeouts.Total
+	}
+	if timeout != 0 {
+		t.Total = time.Duration(timeout) * time.Second
+	}
+	return t
+}
@@ -8,10 +8,15 @@ package zedcloud
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
 	"golang.org/x/crypto/ocsp"
 	"io/ioutil"
-	"strings"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -23,34 +28,79 @@ const (
 	rootCertName    = identityDirname + "/root-certificate.pem"
 )
 
-// If a server arg is specified it overrides the serverFilename content.
+// Shared across all the tls.Configs we return so that session tickets
+// survive the per-request http.Transport in SendOnIntf. Resuming a session
+// saves a full handshake and the certificate exchange on each request.
+// The cache is replaced when the client certificate, the controller CAs
+// or the pins change.
+const sessionCacheSize = 64
+
+var (
+	sessionCacheLock   sync.Mutex
+	clientSessionCache = tls.NewLRUClientSessionCache(sessionCacheSize)
+)
+
+func getSessionCache() tls.ClientSessionCache {
+	sessionCacheLock.Lock()
+	defer sessionCacheLock.Unlock()
+	return clientSessionCache
+}
+
+// FlushSessionCache drops all the TLS sessions so that the next handshake
+// is a full one
+func FlushSessionCache() {
+	sessionCacheLock.Lock()
+	clientSessionCache = tls.NewLRUClientSessionCache(sessionCacheSize)
+	sessionCacheLock.Unlock()
+}
+
+// If a server arg is specified it overrides the current controller in the
+// serverFilename and server.d content.
 // If a clientCert is specified it overrides the device*Name files.
+// The root certificate is combined with any anchors in controllerCADirname
+// and the controller certificate pin, if any, is enforced.
 func GetTlsConfig(serverName string, clientCert *tls.Certificate) (*tls.Config, error) {
 	if serverName == "" {
-		// get the server name
-		bytes, err := ioutil.ReadFile(serverFilename)
+		servers, err := NewServerList()
 		if err != nil {
 			return nil, err
 		}
-		strTrim := strings.TrimSpace(string(bytes))
-		serverName = strings.Split(strTrim, ":")[0]
+		serverName = servers.CurrentHost()
 	}
 	if clientCert == nil {
-		deviceCert, err := tls.LoadX509KeyPair(deviceCertName,
-			deviceKeyName)
+		deviceCert, err := LoadKeyPair(deviceCertName, deviceKeyName)
 		if err != nil {
 			return nil, err
 		}
 		clientCert = &deviceCert
 	}
 
-	// Load CA cert
+	// Load CA certs. With a private PKI the root certificate file
+	// can be absent as long as there are anchors in controllerCADirname
+	caCertPool := x509.NewCertPool()
+	var anchors []string
 	caCert, err := ioutil.ReadFile(rootCertName)
+	if err == nil {
+		anchors = addTrustAnchors(caCertPool, caCert,
+			filepath.Base(rootCertName))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	added, err := loadControllerCAs(caCertPool, controllerCADirname)
+	if err != nil {
+		log.Errorf("GetTlsConfig: %s\n", err)
+	}
+	anchors = append(anchors, added...)
+	if len(anchors) == 0 {
+		errStr := fmt.Sprintf("No trust anchors in %s or %s",
+			rootCertName, controllerCADirname)
+		return nil, errors.New(errStr)
+	}
+	pins, err := readControllerPins(controllerPinFilename)
 	if err != nil {
 		return nil, err
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	checkTrustChange(anchors, pins)
 
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{*clientCert},
@@ -60,18 +110,59 @@ func GetTlsConfig(serverName string, clientCert *tls.Certificate) (*tls.Config,
 			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
 		// TLS 1.2 because we can
-		MinVersion: tls.VersionTLS12,
+		MinVersion:         tls.VersionTLS12,
+		ClientSessionCache: getSessionCache(),
+	}
+	if pins != nil {
+		tlsConfig.VerifyPeerCertificate = pinVerifier(pins)
 	}
 	tlsConfig.BuildNameToCertificate()
 	return tlsConfig, nil
 }
 
+// Result of the OCSP check for a connection as recorded in SendAttempt
+const (
+	OCSPNotChecked = ""            // Policy off or not TLS
+	OCSPGood       = "good"        // Stapled and verified
+	OCSPNotStapled = "not-stapled" // No stapled response from server
+	OCSPBad        = "bad"         // Stapled but failed verification
+)
+
+// checkOCSP applies the policy to the connection. Returns the status to
+// record and an error if the policy says the connection should fail.
+func checkOCSP(policy types.OCSPPolicy, connState *tls.ConnectionState,
+	reqUrl string) (string, error) {
+
+	switch policy {
+	case types.OCSP_SOFT_FAIL, types.OCSP_REQUIRE:
+		// Check below
+	default:
+		return OCSPNotChecked, nil
+	}
+	var status string
+	if connState.OCSPResponse == nil {
+		status = OCSPNotStapled
+	} else if !stapledCheck(connState) {
+		status = OCSPBad
+	} else {
+		return OCSPGood, nil
+	}
+	errStr := fmt.Sprintf("OCSP stapled check for %s: %s (policy %s)",
+		reqUrl, status, policy)
+	if policy == types.OCSP_REQUIRE {
+		log.Errorln(errStr)
+		return status, errors.New(errStr)
+	}
+	log.Warnln(errStr)
+	return status, nil
+}
+
 func stapledCheck(connState *tls.ConnectionState) bool {
 	if connState.VerifiedChains == nil {
 		log.Errorln("stapledCheck: No VerifiedChains")
 		return false
 	}
-	if len(connState.VerifiedChains[0]) == 0 {
+	if len(connState.VerifiedChains[0]) < 2 {
 		log.Errorln("stapledCheck: No VerifiedChains 2")
 		return false
 	}
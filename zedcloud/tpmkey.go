@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Device keys in the TPM. Instead of the PEM key file there is a file
+// with the same basename and a .tpm suffix which holds the persistent
+// handle of the key.
+
+package zedcloud
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/zededa/go-provision/tpm"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TPMKeyFile returns the name of the handle file for keyFile
+func TPMKeyFile(keyFile string) string {
+	return strings.TrimSuffix(keyFile, ".pem") + ".tpm"
+}
+
+// DeviceKeyFile returns the name of the key file or the TPM handle file,
+// whichever exists
+func DeviceKeyFile(keyFile string) string {
+	if _, err := os.Stat(keyFile); err != nil && os.IsNotExist(err) {
+		tpmFile := TPMKeyFile(keyFile)
+		if _, err := os.Stat(tpmFile); err == nil {
+			return tpmFile
+		}
+	}
+	return keyFile
+}
+
+// LoadKeyPair is tls.LoadX509KeyPair except that the key can be in the
+// TPM
+func LoadKeyPair(certFile string, keyFile string) (tls.Certificate, error) {
+	keyFile = DeviceKeyFile(keyFile)
+	if !strings.HasSuffix(keyFile, ".tpm") {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	handle, err := ReadTPMKeyFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		errStr := fmt.Sprintf("No certificate in %s", certFile)
+		return tls.Certificate{}, errors.New(errStr)
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	signer, err := tpm.NewSigner(handle)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	tpmPub := signer.Public().(*ecdsa.PublicKey)
+	if !ok || certPub.X.Cmp(tpmPub.X) != 0 || certPub.Y.Cmp(tpmPub.Y) != 0 {
+		errStr := fmt.Sprintf("%s does not match the TPM key 0x%x",
+			certFile, handle)
+		return tls.Certificate{}, errors.New(errStr)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{block.Bytes},
+		PrivateKey:  signer,
+		Leaf:        leaf,
+	}, nil
+}
+
+// ReadTPMKeyFile returns the persistent handle
+func ReadTPMKeyFile(filename string) (uint32, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	handle, err := strconv.ParseUint(strings.TrimSpace(string(b)), 0, 32)
+	if err != nil {
+		errStr := fmt.Sprintf("Bad TPM handle in %s: %s", filename, err)
+		return 0, errors.New(errStr)
+	}
+	return uint32(handle), nil
+}
+
+// WriteTPMKeyFile records the persistent handle
+func WriteTPMKeyFile(filename string, handle uint32) error {
+	b := []byte(fmt.Sprintf("0x%x\n", handle))
+	return ioutil.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpmkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "device.key.pem")
+	tpmFile := filepath.Join(dir, "device.key.tpm")
+	if TPMKeyFile(keyFile) != tpmFile {
+		t.Errorf("TPMKeyFile got %s", TPMKeyFile(keyFile))
+	}
+	// Neither exists
+	if DeviceKeyFile(keyFile) != keyFile {
+		t.Errorf("DeviceKeyFile got %s", DeviceKeyFile(keyFile))
+	}
+	if err := WriteTPMKeyFile(tpmFile, 0x81000002); err != nil {
+		t.Fatal(err)
+	}
+	if DeviceKeyFile(keyFile) != tpmFile {
+		t.Errorf("DeviceKeyFile got %s", DeviceKeyFile(keyFile))
+	}
+	handle, err := ReadTPMKeyFile(tpmFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handle != 0x81000002 {
+		t.Errorf("ReadTPMKeyFile got 0x%x", handle)
+	}
+	// The PEM file takes precedence
+	if err := ioutil.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if DeviceKeyFile(keyFile) != keyFile {
+		t.Errorf("DeviceKeyFile got %s", DeviceKeyFile(keyFile))
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Verify connectivity to zedcloud by probing the management ports in
+// parallel. Testing a DevicePortConfig with several dead ports would
+// otherwise take the full timeout for each of them in turn.
+
+package zedcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
+	"net/http"
+)
+
+// Maximum number of interfaces probed at the same time
+const verifyWorkers = 4
+
+// IntfResult is the outcome of probing one interface
+type IntfResult struct {
+	Intf    string
+	Free    bool
+	Probed  bool // False if not started, or still running when we returned
+	Success bool
+	Error   error
+	Result  SendResult
+}
+
+type intfProbe struct {
+	index  int
+	result IntfResult
+}
+
+// We try with free interfaces first. If we find enough free interfaces through
+// which cloud connectivity can be achieved, we won't test non-free interfaces.
+// Otherwise we test non-free interfaces also.
+// Cancelling reqCtx aborts the probes in progress.
+func VerifyAllIntf(reqCtx context.Context, ctx ZedCloudContext,
+	url string, successCount int, iteration int) (bool, error) {
+
+	_, err := VerifyAllIntfResults(reqCtx, ctx, url, successCount,
+		iteration)
+	return err == nil, err
+}
+
+// VerifyAllIntfResults is VerifyAllIntf returning the result for each
+// interface. It returns as soon as successCount interfaces succeed; any
+// probes still in progress are left to complete in the background and
+// are reported as not Probed. Those probes are aborted when reqCtx is
+// cancelled.
+func VerifyAllIntfResults(reqCtx context.Context, ctx ZedCloudContext,
+	url string, successCount int, iteration int) ([]IntfResult, error) {
+
+	var results []IntfResult
+	var intfSuccessCount int = 0
+	var lastError error
+
+	if successCount <= 0 {
+		// No need to test. Just return true.
+		return results, nil
+	}
+
+	for try := 0; try < 2; try += 1 {
+		var intfs []string
+		free := try == 0
+		if free {
+			intfs = types.GetMgmtPortsFree(*ctx.DeviceNetworkStatus,
+				iteration)
+			log.Debugf("VerifyAllIntf: trying free %v\n", intfs)
+		} else {
+			intfs = types.GetMgmtPortsNonFree(*ctx.DeviceNetworkStatus,
+				iteration)
+			log.Debugf("VerifyAllIntf: non-free %v\n", intfs)
+		}
+		if intfSuccessCount >= successCount || reqCtx.Err() != nil {
+			// We have enough uplinks with cloud connectivity working.
+			for _, intf := range intfs {
+				results = append(results,
+					IntfResult{Intf: intf, Free: free})
+			}
+			continue
+		}
+		tryResults, count, err := probeIntfs(reqCtx, ctx, url, intfs, free,
+			successCount-intfSuccessCount)
+		results = append(results, tryResults...)
+		intfSuccessCount += count
+		if err != nil {
+			lastError = err
+		}
+	}
+	if err := reqCtx.Err(); err != nil && intfSuccessCount < successCount {
+		errStr := fmt.Sprintf("Test of %s aborted: %s", url, err)
+		log.Errorln(errStr)
+		return results, errors.New(errStr)
+	}
+	if intfSuccessCount == 0 {
+		errStr := fmt.Sprintf("All test attempts to connect to %s failed: %s",
+			url, lastError)
+		log.Errorln(errStr)
+		return results, errors.New(errStr)
+	}
+	if intfSuccessCount < successCount {
+		errStr := fmt.Sprintf("Not enough Ports (%d) against required count %d to reach Zedcloud; last failed with %s",
+			intfSuccessCount, successCount, lastError)
+		log.Errorln(errStr)
+		return results, errors.New(errStr)
+	}
+	return results, nil
+}
+
+// probeIntfs probes the interfaces using up to verifyWorkers at a time
+// and returns once needed have succeeded or all have been probed.
+// Returns the results in the order of intfs, the number of successes
+// and the last error. Returns early if reqCtx is cancelled.
+func probeIntfs(reqCtx context.Context, ctx ZedCloudContext, url string, intfs []string,
+	free bool, needed int) ([]IntfResult, int, error) {
+
+	results := make([]IntfResult, len(intfs))
+	for i, intf := range intfs {
+		results[i] = IntfResult{Intf: intf, Free: free}
+	}
+	if len(intfs) == 0 {
+		return results, 0, nil
+	}
+	// Buffered so that workers we no longer wait for do not block
+	work := make(chan int, len(intfs))
+	done := make(chan intfProbe, len(intfs))
+	stop := make(chan struct{})
+	for i := range intfs {
+		work <- i
+	}
+	close(work)
+	workers := verifyWorkers
+	if workers > len(intfs) {
+		workers = len(intfs)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range work {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				done <- intfProbe{index: i,
+					result: probeIntf(reqCtx, ctx, url,
+						intfs[i], free)}
+			}
+		}()
+	}
+
+	successes := 0
+	var lastError error
+	for received := 0; received < len(intfs); received++ {
+		var p intfProbe
+		select {
+		case p = <-done:
+		case <-reqCtx.Done():
+			close(stop)
+			return results, successes, reqCtx.Err()
+		}
+		results[p.index] = p.result
+		if p.result.Success {
+			successes++
+			if successes >= needed {
+				close(stop)
+				break
+			}
+		} else {
+			lastError = p.result.Error
+		}
+	}
+	return results, successes, lastError
+}
+
+func probeIntf(reqCtx context.Context, ctx ZedCloudContext, url string,
+	intf string, free bool) IntfResult {
+
+	const allowProxy = true
+	ir := IntfResult{Intf: intf, Free: free, Probed: true}
+	res, err := SendOnIntf(reqCtx, ctx, url, intf, 0, nil, allowProxy, 0)
+	ir.Result = res
+	if err != nil && res.Resp == nil {
+		// XXX Have code to mark this interface as not suitable
+		// for cloud/internet connectivity
+		log.Errorf("Zedcloud un-reachable via interface %s: %s",
+			intf, err)
+		ir.Error = err
+		return ir
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		log.Infof("VerifyAllIntf: Zedcloud reachable via interface %s", intf)
+		ir.Success = true
+	default:
+		errStr := fmt.Sprintf("Uplink test FAILED via %s to URL %s with "+
+			"status code %d and status %s",
+			intf, url, res.StatusCode, http.StatusText(res.StatusCode))
+		log.Errorln(errStr)
+		ir.Error = errors.New(errStr)
+	}
+	return ir
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zededa/go-provision/types"
+)
+
+func TestVerifyAllIntf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// The address on bad0 is not configured hence the bind fails
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "bad0",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("192.0.2.1")},
+				},
+			},
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+			},
+		},
+	}
+	ctx := ZedCloudContext{DeviceNetworkStatus: &status,
+		NoLedManager: true}
+
+	ok, err := VerifyAllIntf(context.Background(), ctx, server.URL, 1, 0)
+	if !ok || err != nil {
+		t.Errorf("VerifyAllIntf 1 failed: %v", err)
+	}
+	results, err := VerifyAllIntfResults(context.Background(), ctx,
+		server.URL, 2, 0)
+	if err == nil {
+		t.Errorf("VerifyAllIntfResults 2 succeeded")
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results got %d", len(results))
+	}
+	for _, ir := range results {
+		if !ir.Probed {
+			t.Errorf("%s not probed", ir.Intf)
+		}
+		if ir.Success != (ir.Intf == "lo") {
+			t.Errorf("%s unexpected success %t: %v",
+				ir.Intf, ir.Success, ir.Error)
+		}
+	}
+}
+
+func TestVerifyAllIntfCancel(t *testing.T) {
+	// Never answers until the test is done
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	status := types.DeviceNetworkStatus{
+		Ports: []types.NetworkPortStatus{
+			{
+				IfName: "lo",
+				IsMgmt: true,
+				Free:   true,
+				AddrInfoList: []types.AddrInfo{
+					{Addr: net.ParseIP("127.0.0.1")},
+				},
+			},
+		},
+	}
+	ctx := ZedCloudContext{DeviceNetworkStatus: &status,
+		NoLedManager: true}
+	reqCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	results, err := VerifyAllIntfResults(reqCtx, ctx, server.URL, 1, 0)
+	if err == nil {
+		t.Errorf("Cancelled verify succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Cancel took %v", elapsed)
+	}
+	if len(results) != 1 || results[0].Success {
+		t.Errorf("Unexpected results %+v", results)
+	}
+}
@@ -6,6 +6,8 @@ package zedcloud
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,11 +20,15 @@ import (
 
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
+	"github.com/zededa/go-provision/types"
 )
 
-const (
-	maxRetryAttempts = 50
-)
+// Backoff between attempts to (re)connect the websocket
+var wsRetryConfig = RetryConfig{
+	BaseDelay: 5 * time.Second,
+	MaxDelay:  5 * time.Minute,
+	Jitter:    0.3,
+}
 
 // WSTunnelClient represents a persistent tunnel that can cycle through many websockets.
 // The conn field points to the latest websocket,
@@ -36,18 +42,60 @@ type WSTunnelClient struct {
 	Timeout          time.Duration     // timeout on websocket
 	Connected        bool              // true when we have an active connection to remote server
 	Dialer           *websocket.Dialer // dialer connection initialized & tested for success
+	RetryConfig      RetryConfig       // backoff between connection attempts
+	PingInterval     time.Duration     // keepalive pings; Timeout/3 if zero
 	exitChan         chan struct{}     // channel to tell the tunnel goroutines to end
 	conn             *WSConnection     // reference to remote websocket connection
 	retryOnFailCount int               // no of times the ws connection attempts have continuously failed
+
+	statusLock    sync.Mutex
+	status        types.WSTunnelStatus
+	everConnected bool
+
+	channelLock sync.Mutex
+	channels    []types.TunnelChannel // see SetChannels
+
+	// Optional audit trail of connections and channels; must not block
+	AuditFunc func(types.TunnelAuditEvent)
+
+	// Bandwidth limits; see SetRateLimit
+	rxLimit *TokenBucket
+	txLimit *TokenBucket
+
+	// Applied to each new websocket; see SetOCSPPolicy
+	ocspPolicy types.OCSPPolicy
 }
 
 // WSConnection represents a single websocket connection
 type WSConnection struct {
-	ws              *websocket.Conn // websocket connection
-	tun             *WSTunnelClient // link back to tunnel
-	localConnection net.Conn        // connection to local relay
+	ws               *websocket.Conn       // websocket connection
+	tun              *WSTunnelClient       // link back to tunnel
+	channels         []types.TunnelChannel // as sent when connecting
+	localConnections map[uint8]net.Conn    // connections to local relays by channel
+	sessionId        string                // from the server when connecting
+	counters         map[uint8]*channelCounters
+}
+
+// Bytes moved on a channel; protected by connMutex
+type channelCounters struct {
+	in  uint64 // from the server to the local relay
+	out uint64 // from the local relay to the server
 }
 
+// Response header from the server identifying the remote session
+const tunnelSessionHeader = "X-Zededa-Session-Id"
+
+// When there are channels in addition to LocalRelayServer we send their
+// names in this header when connecting. The position in the list is the
+// channel identifier which then follows the request id in each message.
+// Channel 0 is LocalRelayServer. Without the header the messages have no
+// channel identifier and everything goes to LocalRelayServer.
+const (
+	tunnelChannelsHeader = "X-Zededa-Tunnel-Channels"
+	DefaultTunnelChannel = "guacamole"
+	maxTunnelChannels    = 256 // Including channel 0
+)
+
 var wsWriterMutex sync.Mutex // mutex to allow a single goroutine to send a response at a time
 var connMutex sync.Mutex     // mutex to allow a single goroutine to check and re-initialize connection if required
 
@@ -59,7 +107,11 @@ func InitializeTunnelClient(serverName string, localRelay string) *WSTunnelClien
 		Tunnel:           "wss://" + serverName,
 		LocalRelayServer: localRelay,
 		Timeout:          calcTimeout(30),
+		RetryConfig:      wsRetryConfig,
+		rxLimit:          NewTokenBucket(0, 0),
+		txLimit:          NewTokenBucket(0, 0),
 	}
+	tunnelClient.status.ServerName = serverName
 
 	return &tunnelClient
 }
@@ -96,9 +148,9 @@ func (t *WSTunnelClient) TestConnection(proxyURL *url.URL, localAddr net.IP) err
 
 	log.Debugf("Testing connection to %s on local address: %v, proxy: %v", t.Tunnel, localAddr, proxyURL)
 
-	tlsConfig, err := GetTlsConfig(t.TunnelServerName, nil)
+	tlsConfig, err := t.tlsConfig()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	dialer := &websocket.Dialer{
 		ReadBufferSize:  100 * 1024,
@@ -116,11 +168,17 @@ func (t *WSTunnelClient) TestConnection(proxyURL *url.URL, localAddr net.IP) err
 
 	url := fmt.Sprintf("%s/api/v1/edgedevice/connection/tunnel", t.Tunnel)
 	log.Debugf("Testing connection to url: %s", url)
-	_, resp, err := dialer.Dial(url, nil)
+	ws, resp, err := dialer.Dial(url, nil)
 	if resp != nil {
 		resp.Body.Close()
 	}
 	if err == nil {
+		if err = t.checkOCSP(ws, url); err != nil {
+			ws.Close()
+		}
+	}
+	if err == nil {
+		ws.Close()
 		t.DestURL = url
 		t.Dialer = dialer
 		log.Infof("Connection test succeeded for url: %s on local address: %v, proxy: %v", url, localAddr, proxyURL)
@@ -129,10 +187,180 @@ func (t *WSTunnelClient) TestConnection(proxyURL *url.URL, localAddr net.IP) err
 	return err
 }
 
+// tlsConfig uses the device certificate as the client certificate and
+// verifies the tunnel server against the same trust anchors and pins as
+// the other controller connections
+func (t *WSTunnelClient) tlsConfig() (*tls.Config, error) {
+	host := tunnelHost(t.TunnelServerName)
+	tlsConfig, err := GetTlsConfig(host, nil)
+	if err != nil {
+		errStr := fmt.Sprintf("TLS config for tunnel to %s: %s",
+			host, err)
+		return nil, errors.New(errStr)
+	}
+	return tlsConfig, nil
+}
+
+// SetOCSPPolicy sets the policy for the stapled OCSP response of the
+// tunnel server. Takes effect for the next websocket.
+func (t *WSTunnelClient) SetOCSPPolicy(policy types.OCSPPolicy) {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	if t.ocspPolicy != policy {
+		log.Infof("Tunnel OCSP policy %s", policy)
+		t.ocspPolicy = policy
+	}
+}
+
+// checkOCSP applies the policy to a new websocket
+func (t *WSTunnelClient) checkOCSP(ws *websocket.Conn, url string) error {
+	tlsConn, ok := ws.UnderlyingConn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	t.statusLock.Lock()
+	policy := t.ocspPolicy
+	t.statusLock.Unlock()
+	connState := tlsConn.ConnectionState()
+	_, err := checkOCSP(policy, &connState, url)
+	return err
+}
+
+// The TLS server name is the host part of hostname[:port]
+func tunnelHost(serverName string) string {
+	host, _, err := net.SplitHostPort(serverName)
+	if err != nil {
+		return serverName
+	}
+	return host
+}
+
+// trustAnchor returns the root which validated the server certificate
+func trustAnchor(ws *websocket.Conn) string {
+	tlsConn, ok := ws.UnderlyingConn().(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	connState := tlsConn.ConnectionState()
+	return TrustAnchor(&connState)
+}
+
+// Status returns a snapshot of the connection state
+func (t *WSTunnelClient) Status() types.WSTunnelStatus {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	return t.status
+}
+
+func (t *WSTunnelClient) setConnected(conn *WSConnection) {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	t.conn = conn
+	t.Connected = conn != nil
+	t.status.Connected = conn != nil
+	if conn != nil {
+		t.status.ConnectedSince = time.Now()
+		t.status.TrustAnchor = trustAnchor(conn.ws)
+		if t.everConnected {
+			t.status.ReconnectCount++
+		}
+		t.everConnected = true
+	} else {
+		t.status.ConnectedSince = time.Time{}
+	}
+}
+
+func (t *WSTunnelClient) setError(err error) {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	t.status.SetErrorNow(err.Error())
+}
+
+func (t *WSTunnelClient) setConnectFailures(count int) {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	t.status.ConnectFailures = uint32(count)
+}
+
+func (t *WSTunnelClient) setActivity() {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	t.status.LastActivity = time.Now()
+}
+
+func (t *WSTunnelClient) setPong() {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+	t.status.LastPong = time.Now()
+}
+
+// SetRateLimit sets the bytes per second from the server (rx) and to the
+// server (tx). Zero means no limit.
+func (t *WSTunnelClient) SetRateLimit(rx uint64, tx uint64) {
+	if t.rxLimit.Rate() != rx {
+		log.Infof("Tunnel rx rate limit %d bytes/s", rx)
+		t.rxLimit.SetRate(rx, 0)
+	}
+	if t.txLimit.Rate() != tx {
+		log.Infof("Tunnel tx rate limit %d bytes/s", tx)
+		t.txLimit.SetRate(tx, 0)
+	}
+}
+
+// SetChannels sets the local endpoints carried in addition to
+// LocalRelayServer. The channels are sent to the server when connecting
+// hence the caller should Reconnect if this returns true.
+func (t *WSTunnelClient) SetChannels(channels []types.TunnelChannel) bool {
+	if len(channels) > maxTunnelChannels-1 {
+		log.Errorf("SetChannels: ignoring %d channels beyond %d",
+			len(channels)-(maxTunnelChannels-1), maxTunnelChannels-1)
+		channels = channels[:maxTunnelChannels-1]
+	}
+	t.channelLock.Lock()
+	defer t.channelLock.Unlock()
+	if sameChannels(t.channels, channels) {
+		return false
+	}
+	t.channels = append([]types.TunnelChannel{}, channels...)
+	return true
+}
+
+func (t *WSTunnelClient) getChannels() []types.TunnelChannel {
+	t.channelLock.Lock()
+	defer t.channelLock.Unlock()
+	return t.channels
+}
+
+func sameChannels(c1 []types.TunnelChannel, c2 []types.TunnelChannel) bool {
+	if len(c1) != len(c2) {
+		return false
+	}
+	for i := range c1 {
+		if c1[i] != c2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// channelHeader returns nil if there are no additional channels
+func channelHeader(channels []types.TunnelChannel) http.Header {
+	if len(channels) == 0 {
+		return nil
+	}
+	names := []string{DefaultTunnelChannel}
+	for _, c := range channels {
+		names = append(names, c.Name)
+	}
+	return http.Header{tunnelChannelsHeader: []string{strings.Join(names, ",")}}
+}
+
 // startSession connects to configured backend on a
 // secure websocket and waits for commands from the backend
 // to forward to local relay.
-// XXX Does it ever retry using different intf/srcIp?
+// If the connection fails or is lost we reconnect with backoff until
+// Stop is called. Network changes which require a different interface
+// or source address need a new TestConnection by the caller.
 func (t *WSTunnelClient) startSession() error {
 
 	// signal that tells tunnel client to exit instead of reopening
@@ -145,16 +373,25 @@ func (t *WSTunnelClient) startSession() error {
 	go func() {
 		log.Debug("Looping through websocket connection requests")
 		for {
-			if t.retryOnFailCount == maxRetryAttempts {
-				log.Errorf("Shutting down tunnel client after %d failed attempts.", maxRetryAttempts)
-				break
-			}
-			// Retry timer of 30 seconds between attempts.
-			timer := time.NewTimer(30 * time.Second)
-
 			log.Debugf("Attempting WS connection to url: %s", t.DestURL)
 
-			ws, resp, err := t.Dialer.Dial(t.DestURL, nil)
+			// Reload in case the device certificate or the trust
+			// anchors changed
+			tlsConfig, err := t.tlsConfig()
+			if err == nil {
+				t.Dialer.TLSClientConfig = tlsConfig
+			} else {
+				log.Errorln(err)
+			}
+			channels := t.getChannels()
+			ws, resp, err := t.Dialer.Dial(t.DestURL,
+				channelHeader(channels))
+			if err == nil {
+				if err = t.checkOCSP(ws, t.DestURL); err != nil {
+					ws.Close()
+					resp = nil
+				}
+			}
 			if err != nil {
 				extra := ""
 				if resp != nil {
@@ -167,26 +404,40 @@ func (t *WSTunnelClient) startSession() error {
 					resp.Body.Close()
 					log.Errorf("Error opening connection: %v, response: %v", err.Error(), resp)
 				}
+				t.setError(err)
 				t.retryOnFailCount++
+				t.setConnectFailures(t.retryOnFailCount)
 			} else {
-				t.conn = &WSConnection{ws: ws, tun: t}
+				conn := &WSConnection{ws: ws, tun: t,
+					channels:         channels,
+					localConnections: make(map[uint8]net.Conn),
+					counters:         make(map[uint8]*channelCounters)}
+				if resp != nil {
+					conn.sessionId = resp.Header.Get(tunnelSessionHeader)
+				}
 				// Safety setting
 				ws.SetReadLimit(100 * 1024 * 1024)
 				// Request Loop
-				t.Connected = true
+				t.setConnected(conn)
 				t.retryOnFailCount = 0
-				t.conn.handleRequests()
-				t.Connected = false
+				t.setConnectFailures(0)
+				conn.audit(types.TunnelAuditOpen, 0, nil, "")
+				err := conn.handleRequests()
+				if err != nil {
+					t.setError(err)
+				}
+				t.setConnected(nil)
+				conn.auditClose(err)
 			}
-			// check whether we need to exit
+			// ensure we don't open connections too rapidly,
+			delay := t.RetryConfig.Delay(t.retryOnFailCount)
+			log.Infof("Reconnecting to %s in %v", t.DestURL, delay)
 			select {
 			case <-t.exitChan:
-				break
-			default: // non-blocking receive
+				log.Infof("Tunnel client for %s exiting", t.DestURL)
+				return
+			case <-time.After(delay):
 			}
-
-			// ensure we don't open connections too rapidly,
-			<-timer.C
 		}
 	}()
 
@@ -197,22 +448,39 @@ func (t *WSTunnelClient) startSession() error {
 func (t *WSTunnelClient) Stop() {
 	log.Info("Shutting down WS tunnel client and exiting.")
 	t.exitChan <- struct{}{}
+	t.Reconnect()
+}
+
+// Reconnect closes the current websocket, if any, so that the session
+// loop opens a new one
+func (t *WSTunnelClient) Reconnect() {
+	t.statusLock.Lock()
+	conn := t.conn
+	t.statusLock.Unlock()
+	if conn != nil {
+		log.Infof("Closing websocket connection to %s", t.DestURL)
+		conn.ws.Close()
+	}
 }
 
 // handleRequests reads a request from the socket, then forks
 // a goroutine to relay the request locally and optionally
 // return the result if any.
-func (wsc *WSConnection) handleRequests() {
+// Returns the reason the connection ended.
+func (wsc *WSConnection) handleRequests() error {
+	var reason error
 	go wsc.pinger()
 	for {
 		wsc.ws.SetReadDeadline(time.Time{}) // separate ping-pong routine does timeout
 		messageType, reader, err := wsc.ws.NextReader()
 		if err != nil {
 			log.Debugf("WS ReadMessage Error: %s", err.Error())
+			reason = err
 			break
 		}
 		if messageType != websocket.BinaryMessage {
 			log.Debugf("WS ReadMessage Invalid message type: %d", messageType)
+			reason = fmt.Errorf("Invalid message type: %d", messageType)
 			break
 		}
 		// give the sender a minute to produce the request
@@ -222,8 +490,18 @@ func (wsc *WSConnection) handleRequests() {
 		_, err = fmt.Fscanf(io.LimitReader(reader, 4), "%04x", &id)
 		if err != nil {
 			log.Debugf("WS cannot read request ID Error: %s", err.Error())
+			reason = err
 			break
 		}
+		var channel uint8
+		if wsc.multiplexed() {
+			_, err = fmt.Fscanf(io.LimitReader(reader, 2), "%02x", &channel)
+			if err != nil {
+				log.Debugf("[id=%d] WS cannot read channel Error: %s", id, err.Error())
+				reason = err
+				break
+			}
+		}
 		// read the whole message, this is bounded (to something large) by the
 		// SetReadLimit on the websocket. We have to do this because we want to handle
 		// the request in a goroutine (see "go process..Request" calls below) and the
@@ -231,13 +509,18 @@ func (wsc *WSConnection) handleRequests() {
 		request, err := ioutil.ReadAll(reader)
 		if err != nil {
 			log.Debugf("[id=%d] WS cannot read request message Error: %s", id, err.Error())
+			reason = err
 			break
 		}
-		log.Debugf("[id=%d] WS processing request payload: %v", id, string(request))
+		log.Debugf("[id=%d] WS processing request payload for channel %d: %v",
+			id, channel, string(request))
 
 		// Finish off while we read the next request
 		if len(request) > 0 {
-			if err := wsc.processRequest(id, request); err != nil {
+			wsc.tun.setActivity()
+			// Not reading from the websocket slows down the sender
+			wsc.tun.rxLimit.Wait(len(request))
+			if err := wsc.processRequest(id, channel, request); err != nil {
 				log.Error(err)
 			}
 		} else {
@@ -250,7 +533,12 @@ func (wsc *WSConnection) handleRequests() {
 		log.Info("Closing websocket connection")
 		time.Sleep(5 * time.Second)
 		wsc.ws.Close()
+		wsc.closeLocalConnections()
 	}()
+	if reason == nil {
+		reason = errors.New("websocket connection closed")
+	}
+	return reason
 }
 
 // Pinger that keeps connections alive and terminates them if they seem stuck
@@ -264,6 +552,10 @@ func (wsc *WSConnection) pinger() {
 	}()
 	log.Infof("pinger starting for websocket connection to: %s", wsc.tun.DestURL)
 	tunTimeout := wsc.tun.Timeout
+	pingInterval := wsc.tun.PingInterval
+	if pingInterval == 0 {
+		pingInterval = tunTimeout / 3
+	}
 
 	// timeout handler sends a close message, waits a few seconds, then kills the socket
 	timeout := func() {
@@ -282,6 +574,7 @@ func (wsc *WSConnection) pinger() {
 	// pong handler resets last pong time
 	ph := func(message string) error {
 		timer.Reset(tunTimeout)
+		wsc.tun.setPong()
 		return nil
 	}
 	wsc.ws.SetPongHandler(ph)
@@ -291,55 +584,161 @@ func (wsc *WSConnection) pinger() {
 			log.Errorf("WS not found for destination: %s", wsc.tun.DestURL)
 			break
 		}
-		err := wsc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(tunTimeout/3))
+		err := wsc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingInterval))
 		if err != nil {
 			log.Errorf("WS WriteControl Error: %s", err.Error())
 			break
 		}
-		time.Sleep(tunTimeout / 3)
+		time.Sleep(pingInterval)
 	}
 	log.Infof("pinger ending (WS errored or closed) for destination: %s", wsc.tun.DestURL)
 	wsc.ws.Close()
 }
 
+// audit reports an event for the channel, or the tunnel if counters is
+// nil, to the AuditFunc
+func (wsc *WSConnection) audit(event string, channel uint8,
+	counters *channelCounters, reason string) {
+
+	if wsc.tun.AuditFunc == nil {
+		return
+	}
+	ae := types.TunnelAuditEvent{
+		Time:       time.Now(),
+		Event:      event,
+		ServerName: wsc.tun.TunnelServerName,
+		SessionId:  wsc.sessionId,
+		Reason:     reason,
+	}
+	if event == types.TunnelAuditChannelOpen ||
+		event == types.TunnelAuditChannelClose {
+		ae.Channel = wsc.channelName(channel)
+		ae.Destination, _ = wsc.channelAddr(channel)
+	}
+	if counters != nil {
+		ae.BytesIn = counters.in
+		ae.BytesOut = counters.out
+	}
+	wsc.tun.AuditFunc(ae)
+}
+
+// auditClose reports the channels used and then the tunnel with the
+// total bytes
+func (wsc *WSConnection) auditClose(err error) {
+	reason := "closed"
+	if err != nil {
+		reason = err.Error()
+	}
+	connMutex.Lock()
+	counters := make(map[uint8]channelCounters)
+	for channel, c := range wsc.counters {
+		counters[channel] = *c
+	}
+	connMutex.Unlock()
+	var total channelCounters
+	for channel, c := range counters {
+		c := c
+		wsc.audit(types.TunnelAuditChannelClose, channel, &c, reason)
+		total.in += c.in
+		total.out += c.out
+	}
+	wsc.audit(types.TunnelAuditClose, 0, &total, reason)
+}
+
+// addBytes counts the bytes moved on the channel
+func (wsc *WSConnection) addBytes(channel uint8, in int, out int) {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	c, ok := wsc.counters[channel]
+	if !ok {
+		c = &channelCounters{}
+		wsc.counters[channel] = c
+	}
+	c.in += uint64(in)
+	c.out += uint64(out)
+}
+
+func (wsc *WSConnection) channelName(channel uint8) string {
+	if channel == 0 {
+		return DefaultTunnelChannel
+	}
+	if int(channel) > len(wsc.channels) {
+		return fmt.Sprintf("unknown-%d", channel)
+	}
+	return wsc.channels[channel-1].Name
+}
+
+func (wsc *WSConnection) multiplexed() bool {
+	return len(wsc.channels) != 0
+}
+
+// channelAddr returns the local endpoint for the channel
+func (wsc *WSConnection) channelAddr(channel uint8) (string, error) {
+	if channel == 0 {
+		return wsc.tun.LocalRelayServer, nil
+	}
+	if int(channel) > len(wsc.channels) {
+		return "", fmt.Errorf("Unknown tunnel channel %d", channel)
+	}
+	return wsc.channels[channel-1].Addr, nil
+}
+
+func (wsc *WSConnection) getLocalConnection(channel uint8) net.Conn {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	return wsc.localConnections[channel]
+}
+
+func (wsc *WSConnection) closeLocalConnections() {
+	connMutex.Lock()
+	defer connMutex.Unlock()
+	for channel, c := range wsc.localConnections {
+		c.Close()
+		delete(wsc.localConnections, channel)
+	}
+}
+
 // processRequest forwards the received message to local relay
-// server and starts a separate go-routine to check for and return
-// any responses that are optionally received.
-func (wsc *WSConnection) processRequest(id int16, req []byte) (err error) {
+// server for the channel and starts a separate go-routine to check for
+// and return any responses that are optionally received.
+func (wsc *WSConnection) processRequest(id int16, channel uint8, req []byte) (err error) {
 
-	host := wsc.tun.LocalRelayServer
-	if err := wsc.refreshLocalConnection(host, false); err != nil {
+	host, err := wsc.channelAddr(channel)
+	if err != nil {
+		return err
+	}
+	if err := wsc.refreshLocalConnection(channel, false); err != nil {
 		return err
 	}
 	log.Debugf("[id=%d] Forwarding request: %v to local connection: %s", id, string(req), host)
 	for tries := 1; tries <= 3; tries++ {
-		_, err := wsc.localConnection.Write(req)
+		_, err := wsc.getLocalConnection(channel).Write(req)
 		if err == nil {
 			log.Debugf("[id=%d] Completed writing request: \"%s\" to local connection",
 				id, string(req))
+			wsc.addBytes(channel, len(req), 0)
 			break
 		} else {
 			log.Debugf("[id=%d] Error encountered while writing request to local connection : %s",
 				id, err.Error())
-			if err := wsc.refreshLocalConnection(host, true); err != nil {
+			if err := wsc.refreshLocalConnection(channel, true); err != nil {
 				return err
 			}
 		}
 	}
-	go wsc.listenForResponse(id)
+	go wsc.listenForResponse(id, channel)
 	return nil
 }
 
 // refreshLocalConnection checks if the cached connection is still
 // valid or else creates & caches a new one. The forceCreate flag
 // can be used to forcily update the cached local connection.
-func (wsc *WSConnection) refreshLocalConnection(host string, forceCreate bool) (err error) {
+func (wsc *WSConnection) refreshLocalConnection(channel uint8, forceCreate bool) (err error) {
 
 	connMutex.Lock()
 	defer connMutex.Unlock()
 
-	if wsc.localConnection != nil && !forceCreate {
-		c := wsc.localConnection
+	if c := wsc.localConnections[channel]; c != nil && !forceCreate {
 		one := []byte{}
 		c.SetReadDeadline(time.Now())
 		_, err := c.Read(one)
@@ -349,26 +748,32 @@ func (wsc *WSConnection) refreshLocalConnection(host string, forceCreate bool) (
 				err == io.ErrClosedPipe ||
 				err == io.ErrUnexpectedEOF {
 				log.Debug("Lost local server connection, reconnecting...")
-				if err := wsc.dialLocalConnection(); err != nil {
+				if err := wsc.dialLocalConnection(channel); err != nil {
 					return err
 				}
 			}
 		}
 	} else {
-		if err := wsc.dialLocalConnection(); err != nil {
+		if err := wsc.dialLocalConnection(channel); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// dialLocalConnection creates a new connection to local relay server.
-func (wsc *WSConnection) dialLocalConnection() (err error) {
+// dialLocalConnection creates a new connection to the local relay server
+// for the channel. Called with connMutex held.
+func (wsc *WSConnection) dialLocalConnection(channel uint8) (err error) {
 
-	host := wsc.tun.LocalRelayServer
+	host, err := wsc.channelAddr(channel)
+	if err != nil {
+		return err
+	}
 	if host == "" {
-		log.Error("Local server not found for WS connection")
-		return
+		errStr := fmt.Sprintf("Local server not found for WS connection channel %d",
+			channel)
+		log.Errorln(errStr)
+		return errors.New(errStr)
 	}
 
 	log.Debugf("Initializing local server connection: %s", host)
@@ -377,25 +782,38 @@ func (wsc *WSConnection) dialLocalConnection() (err error) {
 		log.Errorf("Could not connect to local server: %s, error: %s", host, err.Error())
 		return err
 	}
-	wsc.localConnection = localConnection
+	if old := wsc.localConnections[channel]; old != nil {
+		old.Close()
+	} else {
+		// First use of the channel on this websocket
+		wsc.counters[channel] = &channelCounters{}
+		wsc.audit(types.TunnelAuditChannelOpen, channel, nil, "")
+	}
+	wsc.localConnections[channel] = localConnection
 	log.Debugf("Successfully connected to local server: %s", host)
 	return nil
 }
 
 // listenForResponse waits to read response message from the local relay
 // server and forwards them back over the websocket.
-func (wsc *WSConnection) listenForResponse(id int16) {
-	log.Debugf("[id=%d] Waiting for response on local connection", id)
-	wsc.localConnection.SetReadDeadline(time.Now().Add(5 * time.Second))
+func (wsc *WSConnection) listenForResponse(id int16, channel uint8) {
+	log.Debugf("[id=%d] Waiting for response on local connection for channel %d",
+		id, channel)
+	localConnection := wsc.getLocalConnection(channel)
+	if localConnection == nil {
+		log.Debugf("[id=%d] No local connection for channel %d", id, channel)
+		return
+	}
+	localConnection.SetReadDeadline(time.Now().Add(5 * time.Second))
 	responseBuffer := make([]byte, 8192)
-	num, err := wsc.localConnection.Read(responseBuffer)
+	num, err := localConnection.Read(responseBuffer)
 	if err != nil {
 		log.Debugf("[id=%d] Could not read response on local connection: %s", id, err.Error())
 	} else {
 		if num > 0 {
 			response := responseBuffer[:num]
 			log.Debugf("[id=%d] Read local connection payload: \"%s\"", id, string(response))
-			wsc.writeResponseMessage(id, bytes.NewBuffer(response))
+			wsc.writeResponseMessage(id, channel, bytes.NewBuffer(response))
 		} else {
 			log.Debugf("[id=%d] Empty response received from local connection", id)
 		}
@@ -403,7 +821,8 @@ func (wsc *WSConnection) listenForResponse(id int16) {
 }
 
 // writeResponseMessage forwards the response message on the websocket.
-func (wsc *WSConnection) writeResponseMessage(id int16, resp *bytes.Buffer) {
+func (wsc *WSConnection) writeResponseMessage(id int16, channel uint8, resp *bytes.Buffer) {
+	wsc.tun.txLimit.Wait(resp.Len())
 	// Get writer's lock
 	wsWriterMutex.Lock()
 	defer wsWriterMutex.Unlock()
@@ -422,14 +841,22 @@ func (wsc *WSConnection) writeResponseMessage(id int16, resp *bytes.Buffer) {
 		wsc.ws.Close()
 		return
 	}
+	if wsc.multiplexed() {
+		_, err = fmt.Fprintf(writer, "%02x", channel)
+		if err != nil {
+			wsc.ws.Close()
+			return
+		}
+	}
 
 	// write the response itself
-	_, err = io.Copy(writer, resp)
+	n, err := io.Copy(writer, resp)
 	if err != nil {
 		log.Errorf("WS cannot write response: %s", err.Error())
 		wsc.ws.Close()
 		return
 	}
+	wsc.addBytes(channel, 0, int(n))
 
 	// done
 	err = writer.Close()
@@ -0,0 +1,24 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"testing"
+)
+
+func TestTunnelHost(t *testing.T) {
+	testMatrix := map[string]string{
+		"zedcloud.example.com":     "zedcloud.example.com",
+		"zedcloud.example.com:443": "zedcloud.example.com",
+		"10.1.2.3:8443":            "10.1.2.3",
+		"[fd00::1]:443":            "fd00::1",
+	}
+	for serverName, expected := range testMatrix {
+		host := tunnelHost(serverName)
+		if host != expected {
+			t.Errorf("tunnelHost(%s): got %s expected %s",
+				serverName, host, expected)
+		}
+	}
+}
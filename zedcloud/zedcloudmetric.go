@@ -2,24 +2,53 @@
 // SPDX-License-Identifier: Apache-2.0
 
 // Functions to maintain metrics about the connectivity to zedcloud.
-// Just success and failures.
-// Reported as device metrics
+// Success and failures, bytes, last error, a latency histogram, and the
+// success and failures in the past hour per interface.
+// Each agent publishes its metricsMap; zedagent merges them using Append,
+// reports them as device metrics, and publishes the merged result.
 
 package zedcloud
 
 import (
 	"encoding/json"
 	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Upper bounds in milliseconds for the latency histogram buckets. There is
+// one additional bucket for anything above the last bound.
+var LatencyBucketBounds = []int64{100, 250, 500, 1000, 2500, 5000, 10000}
+
+// The recent history is kept in intervals of HistoryInterval
+const (
+	HistoryInterval = 5 * time.Minute
+	HistoryLength   = 12 // One hour
+)
+
 type zedcloudMetric struct {
-	FailureCount uint64
+	FailureCount   uint64
+	SuccessCount   uint64
+	LastFailure    time.Time
+	LastSuccess    time.Time
+	LastError      string // From last failed attempt
+	SentByteCount  int64  // Sum across UrlCounters
+	RecvByteCount  int64
+	LatencyCount   uint64 // Number of responses in histogram
+	LatencyTotalMs uint64
+	LatencyBuckets []uint64 // Indexed as LatencyBucketBounds plus one
+	UrlCounters    map[string]urlcloudMetrics
+	History        []metricInterval // Oldest first
+}
+
+// Success and failures in the HistoryInterval from Start
+type metricInterval struct {
+	Start        time.Time
 	SuccessCount uint64
-	LastFailure  time.Time
-	LastSuccess  time.Time
-	UrlCounters  map[string]urlcloudMetrics
+	FailureCount uint64
+	LastError    string // From the last failure in the interval
 }
 
 type urlcloudMetrics struct {
@@ -29,6 +58,19 @@ type urlcloudMetrics struct {
 	SentByteCount int64
 	RecvMsgCount  int64
 	RecvByteCount int64 // Based on content-length which could be off
+	// Request and response bodies which were compressed; before and
+	// after compression
+	UncompressedByteCount int64
+	CompressedByteCount   int64
+}
+
+// CompressionRatio is the uncompressed size divided by the compressed
+// size of the compressed bodies; zero if none
+func (u urlcloudMetrics) CompressionRatio() float64 {
+	if u.CompressedByteCount == 0 {
+		return 0
+	}
+	return float64(u.UncompressedByteCount) / float64(u.CompressedByteCount)
 }
 
 // Key is ifname string
@@ -44,7 +86,8 @@ func maybeInit(ifname string) {
 	if _, ok := metrics[ifname]; !ok {
 		log.Debugf("create zedcloudmetric for %s\n", ifname)
 		metrics[ifname] = zedcloudMetric{
-			UrlCounters: make(map[string]urlcloudMetrics),
+			LatencyBuckets: make([]uint64, len(LatencyBucketBounds)+1),
+			UrlCounters:    make(map[string]urlcloudMetrics),
 		}
 	}
 }
@@ -55,6 +98,7 @@ func ZedCloudFailure(ifname string, url string, reqLen int64, respLen int64) {
 	m := metrics[ifname]
 	m.FailureCount += 1
 	m.LastFailure = time.Now()
+	m.currentInterval(m.LastFailure).FailureCount += 1
 	var u urlcloudMetrics
 	var ok bool
 	if u, ok = m.UrlCounters[url]; !ok {
@@ -65,6 +109,7 @@ func ZedCloudFailure(ifname string, url string, reqLen int64, respLen int64) {
 	if respLen != 0 {
 		u.RecvMsgCount += 1
 		u.RecvByteCount += respLen
+		m.RecvByteCount += respLen
 	}
 	m.UrlCounters[url] = u
 	metrics[ifname] = m
@@ -77,6 +122,7 @@ func ZedCloudSuccess(ifname string, url string, reqLen int64, respLen int64) {
 	m := metrics[ifname]
 	m.SuccessCount += 1
 	m.LastSuccess = time.Now()
+	m.currentInterval(m.LastSuccess).SuccessCount += 1
 	var u urlcloudMetrics
 	var ok bool
 	if u, ok = m.UrlCounters[url]; !ok {
@@ -87,10 +133,129 @@ func ZedCloudSuccess(ifname string, url string, reqLen int64, respLen int64) {
 	u.RecvMsgCount += 1
 	u.RecvByteCount += respLen
 	m.UrlCounters[url] = u
+	m.SentByteCount += reqLen
+	m.RecvByteCount += respLen
+	metrics[ifname] = m
+	mutex.Unlock()
+}
+
+// ZedCloudCompressed records the sizes of a compressed body. Use as the
+// CompressionFunc.
+func ZedCloudCompressed(ifname string, url string, uncompressed int64,
+	compressed int64) {
+
+	mutex.Lock()
+	maybeInit(ifname)
+	m := metrics[ifname]
+	u := m.UrlCounters[url]
+	u.UncompressedByteCount += uncompressed
+	u.CompressedByteCount += compressed
+	m.UrlCounters[url] = u
+	metrics[ifname] = m
+	mutex.Unlock()
+}
+
+// ZedCloudMetricsHook is a PostResponseHook which records the latency of
+// responses and the last error for the interface. Use together with
+// ZedCloudFailure and ZedCloudSuccess.
+func ZedCloudMetricsHook(req *http.Request, ifname string,
+	resp *http.Response, contents []byte, err error, elapsed time.Duration) {
+
+	mutex.Lock()
+	maybeInit(ifname)
+	m := metrics[ifname]
+	if err != nil {
+		m.LastError = err.Error()
+		m.currentInterval(time.Now()).LastError = m.LastError
+	}
+	if resp != nil {
+		ms := int64(elapsed / time.Millisecond)
+		bucket := len(LatencyBucketBounds)
+		for i, bound := range LatencyBucketBounds {
+			if ms <= bound {
+				bucket = i
+				break
+			}
+		}
+		if len(m.LatencyBuckets) != len(LatencyBucketBounds)+1 {
+			m.LatencyBuckets = make([]uint64, len(LatencyBucketBounds)+1)
+		}
+		m.LatencyBuckets[bucket] += 1
+		m.LatencyCount += 1
+		m.LatencyTotalMs += uint64(ms)
+	}
 	metrics[ifname] = m
 	mutex.Unlock()
 }
 
+// Mean latency in milliseconds; zero if no responses
+func (m zedcloudMetric) MeanLatencyMs() uint64 {
+	if m.LatencyCount == 0 {
+		return 0
+	}
+	return m.LatencyTotalMs / m.LatencyCount
+}
+
+// currentInterval returns the history interval for now, adding it and
+// dropping the ones older than HistoryLength intervals as needed
+func (m *zedcloudMetric) currentInterval(now time.Time) *metricInterval {
+	start := now.Truncate(HistoryInterval)
+	n := len(m.History)
+	if n == 0 || !m.History[n-1].Start.Equal(start) {
+		m.History = append(m.History, metricInterval{Start: start})
+		m.History = pruneHistory(m.History, now)
+	}
+	return &m.History[len(m.History)-1]
+}
+
+// pruneHistory drops the intervals older than HistoryLength before now
+func pruneHistory(history []metricInterval, now time.Time) []metricInterval {
+	oldest := now.Truncate(HistoryInterval).Add(-(HistoryLength - 1) * HistoryInterval)
+	for len(history) != 0 && history[0].Start.Before(oldest) {
+		history = history[1:]
+	}
+	return history
+}
+
+// RecentHistory returns the intervals within the past hour as of now
+func (m zedcloudMetric) RecentHistory(now time.Time) []metricInterval {
+	return pruneHistory(m.History, now)
+}
+
+// Merge the intervals with the same Start
+func appendHistory(history []metricInterval,
+	history1 []metricInterval) []metricInterval {
+
+	merged := make(map[time.Time]metricInterval)
+	for _, list := range [][]metricInterval{history, history1} {
+		for _, i1 := range list {
+			start := i1.Start.UTC()
+			i, ok := merged[start]
+			if !ok {
+				merged[start] = i1
+				continue
+			}
+			i.SuccessCount += i1.SuccessCount
+			i.FailureCount += i1.FailureCount
+			if i1.LastError != "" {
+				i.LastError = i1.LastError
+			}
+			merged[start] = i
+		}
+	}
+	result := make([]metricInterval, 0, len(merged))
+	for _, i := range merged {
+		result = append(result, i)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Start.Before(result[b].Start)
+	})
+	if len(result) > HistoryLength {
+		result = result[len(result)-HistoryLength:]
+	}
+	return result
+}
+
 func GetCloudMetrics() metricsMap {
 	return metrics
 }
@@ -116,9 +281,14 @@ func Append(cms metricsMap, cms1 metricsMap) metricsMap {
 		cm, ok := cms[ifname]
 		if !ok {
 			// New ifname; take all
-			cms[ifname] = cm
+			cms[ifname] = cm1
 			continue
 		}
+		// Take the LastError from whomever had the most recent failure
+		if cm1.LastError != "" && (cm.LastError == "" ||
+			!cm1.LastFailure.Before(cm.LastFailure)) {
+			cm.LastError = cm1.LastError
+		}
 		if cm.LastFailure.IsZero() {
 			// Don't care if cm1 is zero
 			cm.LastFailure = cm1.LastFailure
@@ -135,6 +305,20 @@ func Append(cms metricsMap, cms1 metricsMap) metricsMap {
 		}
 		cm.FailureCount += cm1.FailureCount
 		cm.SuccessCount += cm1.SuccessCount
+		cm.SentByteCount += cm1.SentByteCount
+		cm.RecvByteCount += cm1.RecvByteCount
+		cm.LatencyCount += cm1.LatencyCount
+		cm.LatencyTotalMs += cm1.LatencyTotalMs
+		if len(cm1.LatencyBuckets) != 0 {
+			if len(cm.LatencyBuckets) != len(cm1.LatencyBuckets) {
+				cm.LatencyBuckets = make([]uint64,
+					len(cm1.LatencyBuckets))
+			}
+			for i, count := range cm1.LatencyBuckets {
+				cm.LatencyBuckets[i] += count
+			}
+		}
+		cm.History = appendHistory(cm.History, cm1.History)
 		if cm.UrlCounters == nil {
 			cm.UrlCounters = make(map[string]urlcloudMetrics)
 		}
@@ -147,12 +331,13 @@ func Append(cms metricsMap, cms1 metricsMap) metricsMap {
 				continue
 			}
 			um.TryMsgCount += um1.TryMsgCount
-			um.TryMsgCount += um1.TryMsgCount
 			um.TryByteCount += um1.TryByteCount
 			um.SentMsgCount += um1.SentMsgCount
 			um.SentByteCount += um1.SentByteCount
 			um.RecvMsgCount += um1.RecvMsgCount
 			um.RecvByteCount += um1.RecvByteCount
+			um.UncompressedByteCount += um1.UncompressedByteCount
+			um.CompressedByteCount += um1.CompressedByteCount
 			cmu[url] = um
 		}
 		cms[ifname] = cm
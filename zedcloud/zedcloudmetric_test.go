@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Zededa, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package zedcloud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricHistory(t *testing.T) {
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	var m zedcloudMetric
+	m.currentInterval(now).SuccessCount++
+	m.currentInterval(now.Add(time.Minute)).FailureCount++
+	m.currentInterval(now.Add(HistoryInterval)).SuccessCount++
+	if len(m.History) != 2 {
+		t.Fatalf("Expected 2 intervals, got %+v", m.History)
+	}
+	if m.History[0].SuccessCount != 1 || m.History[0].FailureCount != 1 {
+		t.Errorf("Unexpected first interval %+v", m.History[0])
+	}
+	// An hour later only the second interval is within the past hour
+	later := now.Add(time.Hour)
+	if recent := m.RecentHistory(later); len(recent) != 1 ||
+		!recent[0].Start.Equal(now.Add(HistoryInterval)) {
+		t.Errorf("Unexpected recent history %+v", recent)
+	}
+	m.currentInterval(later).SuccessCount++
+	if len(m.History) != 2 {
+		t.Errorf("Expected pruned history, got %+v", m.History)
+	}
+
+	other := zedcloudMetric{History: []metricInterval{
+		{Start: now.Add(HistoryInterval), FailureCount: 2,
+			LastError: "timeout"},
+		{Start: later.Add(HistoryInterval), SuccessCount: 3},
+	}}
+	merged := appendHistory(m.History, other.History)
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 merged intervals, got %+v", merged)
+	}
+	if merged[0].SuccessCount != 1 || merged[0].FailureCount != 2 ||
+		merged[0].LastError != "timeout" {
+		t.Errorf("Unexpected merged interval %+v", merged[0])
+	}
+	if !merged[2].Start.Equal(later.Add(HistoryInterval)) {
+		t.Errorf("Not sorted %+v", merged)
+	}
+}